@@ -45,6 +45,7 @@ CXX=${CXX:-g++}
 
 go install github.com/google/wuffs/cmd/...
 go test    github.com/google/wuffs/...
+go test -race github.com/google/wuffs/internal/cgen github.com/google/wuffs/lang/check
 wuffs gen
 
 # Compiler warning flags are discussed at
@@ -37,6 +37,9 @@ const (
 	IterscaleMax     = 1000000
 	IterscaleUsage   = `a scaling factor for the number of iterations per benchmark`
 
+	LinedirectivesDefault = false
+	LinedirectivesUsage   = `whether to generate #line directives that map C code back to Wuffs source`
+
 	MimicDefault = false
 	MimicUsage   = `whether to compare Wuffs' output with other libraries' output`
 
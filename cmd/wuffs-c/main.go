@@ -41,6 +41,8 @@ func main1() error {
 		return doGenlib(args)
 	case "genrelease":
 		return doGenrelease(args)
+	case "selfcheck":
+		return doSelfcheck(args)
 	case "test":
 		return doTest(args)
 	}
@@ -0,0 +1,115 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	selfcheckCcDefault = "gcc -std=c99 -Wall -Werror -Werror=vla -c"
+	selfcheckCcUsage   = `the C compiler command line, such as "cl /nologo /W3 /WX /c" for MSVC, that must compile the generated C code without error`
+)
+
+// doSelfcheck compiles each package's generated C code, as an
+// implementation (with WUFFS_IMPLEMENTATION defined) and optionally as a
+// WUFFS_CONFIG__DLL implementation, with a configurable C compiler. It is
+// intended for CI (continuous integration) machines, to check that the
+// generated code still compiles with compilers, such as MSVC, that the
+// developer doesn't have.
+//
+// The compiler command line is split on white space. A "selfcheck-etc.c"
+// file name, in a temporary working directory, is appended to it.
+func doSelfcheck(args []string) error {
+	flags := flag.FlagSet{}
+	ccFlag := flags.String("cc", selfcheckCcDefault, selfcheckCcUsage)
+	dllFlag := flags.Bool("dll", false, "whether to also compile with WUFFS_CONFIG__DLL defined")
+	srcdirFlag := flags.String("srcdir", "", "directory containing the C source files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	cc := strings.Fields(*ccFlag)
+	if len(cc) == 0 {
+		return fmt.Errorf("empty -cc flag")
+	}
+	if *srcdirFlag == "" {
+		return fmt.Errorf("empty -srcdir flag")
+	}
+	srcdir, err := filepath.Abs(*srcdirFlag)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "wuffs-c-selfcheck-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	configs := []string{""}
+	if *dllFlag {
+		configs = append(configs, "WUFFS_CONFIG__DLL")
+	}
+
+	failed := false
+	for _, arg := range args {
+		name := strings.Replace(filepath.ToSlash(arg), "/", "-", -1)
+		in := filepath.Join(srcdir, "wuffs-"+name+".c")
+		if _, err := os.Stat(in); err != nil {
+			return err
+		}
+		for _, config := range configs {
+			label := name
+			if config != "" {
+				label += " (" + config + ")"
+			}
+			if err := selfcheck1(workDir, cc, name, in, config); err != nil {
+				fmt.Printf("selfcheck: FAIL %s\n%v\n", label, err)
+				failed = true
+			} else {
+				fmt.Printf("selfcheck: ok   %s\n", label)
+			}
+		}
+	}
+	if failed {
+		return fmt.Errorf("selfcheck: some packages failed")
+	}
+	return nil
+}
+
+func selfcheck1(workDir string, cc []string, name string, in string, config string) error {
+	src := "#define WUFFS_IMPLEMENTATION\n"
+	suffix := ""
+	if config != "" {
+		src += "#define " + config + "\n"
+		suffix = "-" + strings.ToLower(config)
+	}
+	src += fmt.Sprintf("#include \"%s\"\n", filepath.ToSlash(in))
+
+	filename := "selfcheck-" + name + suffix + ".c"
+	if err := os.WriteFile(filepath.Join(workDir, filename), []byte(src), 0644); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(cc[0], append(cc[1:len(cc):len(cc)], filename)...)
+	cmd.Dir = workDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v\n%s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+)
+
+// doGenlib is a no-op. Unlike C, the generated Rust code is not compiled to
+// object files ahead of time. Cargo builds it from the release file instead.
+func doGenlib(args []string) error {
+	flags := flag.FlagSet{}
+	flags.String("dstdir", "", "directory containing the object files")
+	flags.String("srcdir", "", "directory containing the Rust source files")
+	return flags.Parse(args)
+}
+
+// doGenrelease concatenates the generated per-package files into a single
+// Rust source file, wrapping each package in a module named after its file:
+// "wuffs-std-crc32.rs" becomes "pub mod wuffs_std_crc32". The base module
+// comes first.
+func doGenrelease(args []string) error {
+	flags := flag.FlagSet{}
+	commitDateFlag := flags.String("commitdate", "", "git commit date the release was built from")
+	gitRevListCountFlag := flags.Int("gitrevlistcount", 0, `git "rev-list --count" that the release was built from`)
+	revisionFlag := flags.String("revision", "", "git revision the release was built from")
+	versionFlag := flags.String("version", cf.VersionDefault, cf.VersionUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*gitRevListCountFlag < 0) || (0x7FFFFFFF < *gitRevListCountFlag) {
+		return fmt.Errorf("bad -gitrevlistcount flag value %d", *gitRevListCountFlag)
+	}
+	if !cf.IsAlphaNumericIsh(*commitDateFlag) {
+		return fmt.Errorf("bad -commitdate flag value %q", *commitDateFlag)
+	}
+	if !cf.IsAlphaNumericIsh(*revisionFlag) {
+		return fmt.Errorf("bad -revision flag value %q", *revisionFlag)
+	}
+	v, ok := cf.ParseVersion(*versionFlag)
+	if !ok {
+		return fmt.Errorf("bad -version flag value %q", *versionFlag)
+	}
+	args = flags.Args()
+
+	filenames := append([]string(nil), args...)
+	sort.SliceStable(filenames, func(i, j int) bool {
+		return (filepath.Base(filenames[i]) == "wuffs-base.rs") &&
+			(filepath.Base(filenames[j]) != "wuffs-base.rs")
+	})
+	if (len(filenames) == 0) || (filepath.Base(filenames[0]) != "wuffs-base.rs") {
+		return fmt.Errorf("could not find wuffs-base.rs")
+	}
+
+	commitDate := "0"
+	if *commitDateFlag != "" {
+		commitDate = strings.Replace(*commitDateFlag, "-", "", -1)
+	}
+	buildMetadata := ""
+	if *gitRevListCountFlag != 0 {
+		buildMetadata = fmt.Sprintf("+%d.%s", *gitRevListCountFlag, commitDate)
+	}
+
+	w := &bytes.Buffer{}
+	w.WriteString("// Code generated by wuffs-rs. DO NOT EDIT.\n\n")
+	if *revisionFlag != "" && *commitDateFlag != "" {
+		fmt.Fprintf(w, "// Based on revision %s committed on %s.\n\n", *revisionFlag, *commitDateFlag)
+	}
+	fmt.Fprintf(w, "pub const WUFFS_VERSION: u64 = 0x%09X;\n", v.Uint64())
+	fmt.Fprintf(w, "pub const WUFFS_VERSION_STRING: &str = %q;\n", v.String()+buildMetadata)
+
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(filename), ".rs")
+		fmt.Fprintf(w, "\npub mod %s {\n", strings.Replace(name, "-", "_", -1))
+		w.Write(src)
+		w.WriteString("}\n")
+	}
+	_, err := os.Stdout.Write(w.Bytes())
+	return err
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+)
+
+const (
+	ccDefault = ""
+	ccUsage   = `if non-empty, the C compiler command line (such as "clang -std=c99 -Wall -Werror -c") to compile the generated C code with, instead of the wuffs-c selfcheck default`
+
+	dllDefault = false
+	dllUsage   = `whether to also compile the generated C code with WUFFS_CONFIG__DLL defined`
+)
+
+// doBuild (re-)generates the packages' code, as "wuffs gen" does, and then
+// checks that the generated code compiles with the host toolchain, via
+// "wuffs-c selfcheck" for the "c" lang. Unlike "wuffs genlib", it doesn't
+// write any libraries.
+func doBuild(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet(`"wuffs build <flags> std/pkg1 std/pkg2 etc"`, flag.ExitOnError)
+	ccFlag := flags.String("cc", ccDefault, ccUsage)
+	dllFlag := flags.Bool("dll", dllDefault, dllUsage)
+	langsFlag := flags.String("langs", langsDefault, langsUsage)
+	skipgenFlag := flags.Bool("skipgen", skipgenDefault, skipgenUsage)
+	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	langs, err := parseLangs(*langsFlag)
+	if err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"base", "std/..."}
+	}
+
+	h := genHelper{
+		wuffsRoot:   wuffsRoot,
+		langs:       langs,
+		skipgen:     *skipgenFlag,
+		skipgendeps: *skipgendepsFlag,
+	}
+	for _, arg := range args {
+		recursive := strings.HasSuffix(arg, "/...")
+		if recursive {
+			arg = arg[:len(arg)-4]
+		}
+		if arg == "" {
+			continue
+		}
+
+		if err := h.gen(arg, recursive); err != nil {
+			return err
+		}
+	}
+	if !*skipgenFlag {
+		if err := genrelease(wuffsRoot, langs, cf.Version{}); err != nil {
+			return err
+		}
+	}
+
+	for _, lang := range langs {
+		command := "wuffs-" + lang
+		cmdArgs := []string{"selfcheck"}
+		cmdArgs = append(cmdArgs, "-srcdir", filepath.Join(wuffsRoot, "gen", lang))
+		if (lang == "c") && (*ccFlag != ccDefault) {
+			cmdArgs = append(cmdArgs, "-cc", *ccFlag)
+		}
+		if *dllFlag {
+			cmdArgs = append(cmdArgs, "-dll")
+		}
+		cmdArgs = append(cmdArgs, h.affected...)
+		cmd := exec.Command(command, cmdArgs...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
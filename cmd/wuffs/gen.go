@@ -39,7 +39,14 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	}
 
 	flags := flag.NewFlagSet(flagSetName, flag.ExitOnError)
+	checkabiFlag := flags.String("checkabi", checkabiDefault, checkabiUsage)
+	genabiFlag := flags.Bool("genabi", genabiDefault, genabiUsage)
+	genbenchFlag := flags.Bool("genbench", genbenchDefault, genbenchUsage)
+	genfuzzFlag := flags.Bool("genfuzz", genfuzzDefault, genfuzzUsage)
 	genlinenumFlag := flags.Bool("genlinenum", cf.GenlinenumDefault, cf.GenlinenumUsage)
+	genmetadataFlag := flags.Bool("genmetadata", genmetadataDefault, genmetadataUsage)
+	gentestFlag := flags.Bool("gentest", gentestDefault, gentestUsage)
+	linedirectivesFlag := flags.Bool("linedirectives", cf.LinedirectivesDefault, cf.LinedirectivesUsage)
 	langsFlag := flags.String("langs", langsDefault, langsUsage)
 	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
 
@@ -79,15 +86,26 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	}
 
 	h := genHelper{
-		wuffsRoot:   wuffsRoot,
-		langs:       langs,
-		genlinenum:  *genlinenumFlag,
-		skipgen:     genlib && *skipgenFlag,
-		skipgendeps: *skipgendepsFlag,
+		wuffsRoot:      wuffsRoot,
+		langs:          langs,
+		checkabi:       *checkabiFlag,
+		genabi:         *genabiFlag,
+		genbench:       *genbenchFlag,
+		genfuzz:        *genfuzzFlag,
+		genlinenum:     *genlinenumFlag,
+		genmetadata:    *genmetadataFlag,
+		gentest:        *gentestFlag,
+		linedirectives: *linedirectivesFlag,
+		skipgen:        genlib && *skipgenFlag,
+		skipgendeps:    *skipgendepsFlag,
 	}
 	if genlib {
 		h.ccompilers = *ccompilersFlag
 	}
+	if h.genmetadata {
+		h.version = v
+		h.gitRevision = runGitCommand(wuffsRoot, "rev-parse", "HEAD")
+	}
 
 	for _, arg := range args {
 		recursive := strings.HasSuffix(arg, "/...")
@@ -103,6 +121,11 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 		}
 	}
 
+	if h.genfuzz {
+		if err := h.genOSSFuzzBuildScript(); err != nil {
+			return err
+		}
+	}
 	if genlib {
 		return h.genlibAffected()
 	}
@@ -110,12 +133,23 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 }
 
 type genHelper struct {
-	wuffsRoot   string
-	langs       []string
-	ccompilers  string
-	genlinenum  bool
-	skipgen     bool
-	skipgendeps bool
+	wuffsRoot      string
+	langs          []string
+	ccompilers     string
+	checkabi       string
+	genabi         bool
+	genbench       bool
+	genfuzz        bool
+	genlinenum     bool
+	genmetadata    bool
+	gentest        bool
+	linedirectives bool
+	skipgen        bool
+	skipgendeps    bool
+
+	// version and gitRevision are what -genmetadata records.
+	version     cf.Version
+	gitRevision string
 
 	affected []string
 	seen     map[string]struct{}
@@ -191,6 +225,51 @@ func (h *genHelper) genDir(dirname string, qualFilenames []string) error {
 		if h.genlinenum != cf.GenlinenumDefault {
 			cmdArgs = append(cmdArgs, fmt.Sprintf("-genlinenum=%t", h.genlinenum))
 		}
+		if h.linedirectives != cf.LinedirectivesDefault {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-linedirectives=%t", h.linedirectives))
+		}
+		if h.genmetadata && (lang == "c") && (packageName != "base") {
+			cmdArgs = append(cmdArgs, "-build_metadata", "-version", h.version.String())
+			if h.gitRevision != "" {
+				cmdArgs = append(cmdArgs, "-git_revision", h.gitRevision)
+			}
+		}
+		targets := genTargets(nil)
+		if h.genfuzz && (lang == "c") && (packageName != "base") {
+			fuzzTarget := filepath.Join(h.wuffsRoot, "gen", "fuzz", "c", filepath.FromSlash(dirname)+"_fuzzer.c")
+			if err := targets.add("-fuzz_target", fuzzTarget); err != nil {
+				return err
+			}
+		}
+		if h.genbench && (lang == "c") && (packageName != "base") {
+			benchTarget := filepath.Join(h.wuffsRoot, "gen", "bench", "c", filepath.FromSlash(dirname)+"_bench.c")
+			if err := targets.add("-bench_target", benchTarget); err != nil {
+				return err
+			}
+		}
+		if h.gentest && (lang == "c") && (packageName != "base") {
+			testTarget := filepath.Join(h.wuffsRoot, "gen", "test", "c", filepath.FromSlash(dirname)+"_test.c")
+			if err := targets.add("-test_target", testTarget); err != nil {
+				return err
+			}
+		}
+		if (lang == "c") && (packageName != "base") {
+			if h.checkabi != "" {
+				// Packages that weren't in the previous release have nothing
+				// to check against.
+				old := filepath.Join(h.checkabi, filepath.FromSlash(dirname)+".json")
+				if _, err := os.Stat(old); err == nil {
+					cmdArgs = append(cmdArgs, "-check_abi", old)
+				}
+			}
+			if h.genabi {
+				abiJSON := filepath.Join(h.wuffsRoot, "gen", "abi", "c", filepath.FromSlash(dirname)+".json")
+				if err := targets.add("-abi_json", abiJSON); err != nil {
+					return err
+				}
+			}
+		}
+		cmdArgs = append(cmdArgs, targets.args()...)
 		cmdArgs = append(cmdArgs, qualFilenames...)
 		stdout := &bytes.Buffer{}
 
@@ -211,6 +290,7 @@ func (h *genHelper) genDir(dirname string, qualFilenames []string) error {
 		if err := h.genFile(flatDirname, lang, out); err != nil {
 			return err
 		}
+		targets.report()
 	}
 	if len(h.langs) > 0 && packageName != "base" {
 		if err := h.genWuffs(dirname, qualFilenames); err != nil {
@@ -247,6 +327,39 @@ func (h *genHelper) genFile(dirname string, lang string, out []byte) error {
 	)
 }
 
+// genTargets are the extra files, such as fuzz targets, that a wuffs-c
+// command writes alongside a package's C code. Each one is a flag name and a
+// filename.
+type genTargets [][2]string
+
+// add creates filename's directory, so that the command can write that file
+// when passed flag.
+func (t *genTargets) add(flag string, filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	*t = append(*t, [2]string{flag, filename})
+	return nil
+}
+
+// args returns the command line arguments for the targets.
+func (t genTargets) args() (ret []string) {
+	for _, x := range t {
+		ret = append(ret, x[0], x[1])
+	}
+	return ret
+}
+
+// report prints the targets that the command wrote. It can remove a target
+// instead, such as the fuzz target for a package with no decoders.
+func (t genTargets) report() {
+	for _, x := range t {
+		if _, err := os.Stat(x[1]); err == nil {
+			fmt.Println("gen wrote:     ", x[1])
+		}
+	}
+}
+
 func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error {
 	files, err := generate.ParseFiles(&h.tm, qualifiedFilenames, &parse.Options{
 		AllowDoubleUnderscoreNames: true,
@@ -255,77 +368,39 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 		return err
 	}
 
+	api, err := generate.PublicAPI(&h.tm, files)
+	if err != nil {
+		return err
+	}
+
 	out := &bytes.Buffer{}
 	fmt.Fprintf(out, "// Code generated by running \"wuffs gen\". DO NOT EDIT.\n\n")
-
-	for _, f := range files {
-		for _, n := range f.TopLevelDecls() {
-			switch n.Kind() {
-			case a.KConst:
-				n := n.AsConst()
-				if !n.Public() {
-					continue
-				}
-				fmt.Fprintf(out, "pub const %s : %s = %v\n",
-					n.QID().Str(&h.tm), n.XType().Str(&h.tm), n.Value().Str(&h.tm))
-
-			case a.KFunc:
-				n := n.AsFunc()
-				if !n.Public() {
-					continue
-				}
-				if n.Receiver().IsZero() {
-					return fmt.Errorf("TODO: genWuffs for a free-standing function")
-				}
-				// TODO: look at n.Asserts().
-				fmt.Fprintf(out, "pub func %s.%s%v(", n.Receiver().Str(&h.tm), n.FuncName().Str(&h.tm), n.Effect())
-				for i, field := range n.In().Fields() {
-					field := field.AsField()
-					if i > 0 {
-						fmt.Fprintf(out, ", ")
-					}
-					// TODO: what happens if the XType is from another package?
-					// Similarly for the out-param.
-					fmt.Fprintf(out, "%s: %s", field.Name().Str(&h.tm), field.XType().Str(&h.tm))
-				}
-				fmt.Fprintf(out, ") ")
-				if o := n.Out(); o != nil {
-					fmt.Fprintf(out, "%s ", o.Str(&h.tm))
-				}
-				fmt.Fprintf(out, "{ }\n")
-
-			case a.KStatus:
-				n := n.AsStatus()
-				if !n.Public() {
-					continue
-				}
-				fmt.Fprintf(out, "pub status %s\n", n.QID().Str(&h.tm))
-
-			case a.KStruct:
-				n := n.AsStruct()
-				if !n.Public() {
-					continue
-				}
-				fmt.Fprintf(out, "pub struct %s", n.QID().Str(&h.tm))
-				if n.Classy() {
-					fmt.Fprintf(out, "?")
-				}
-				if imps := n.Implements(); len(imps) > 0 {
-					fmt.Fprintf(out, " implements ")
-					for i, imp := range imps {
-						if i > 0 {
-							fmt.Fprintf(out, ", ")
-						}
-						fmt.Fprintf(out, "%s", imp.AsTypeExpr().Str(&h.tm))
-					}
-				}
-				fmt.Fprintf(out, "()\n")
-			}
-		}
-	}
+	out.Write(api)
 	return h.genFile(dirname, "wuffs", out.Bytes())
 }
 
+// genOSSFuzzBuildScript writes a build.sh script, for OSS-Fuzz, that builds
+// the fuzz targets generated by the -genfuzz flag.
+func (h *genHelper) genOSSFuzzBuildScript() error {
+	return writeFile(filepath.Join(h.wuffsRoot, "gen", "fuzz", "c", "oss-fuzz-build.sh"), []byte(ossFuzzBuildScript))
+}
+
+const ossFuzzBuildScript = `#!/bin/bash -eu
+# Code generated by running "wuffs gen -genfuzz". DO NOT EDIT.
+
+# This script builds the generated fuzz targets for OSS-Fuzz, which sets the
+# CC, CFLAGS, CXX, CXXFLAGS, LIB_FUZZING_ENGINE, OUT and WORK environment
+# variables. Run it with bash from the Wuffs root directory, after
+# "wuffs gen -genfuzz".
+
+for f in gen/fuzz/c/std/*_fuzzer.c; do
+  b=$(basename $f .c)
+  echo "Building $OUT/wuffs_gen_$b"
+  $CC $CFLAGS -I. -c $f -o $WORK/wuffs_gen_$b.o
+  $CXX $CXXFLAGS $WORK/wuffs_gen_$b.o -o $OUT/wuffs_gen_$b $LIB_FUZZING_ENGINE
+done
+`
+
 func (h *genHelper) genlibAffected() error {
 	for _, lang := range h.langs {
 		command := "wuffs-" + lang
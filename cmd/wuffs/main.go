@@ -30,6 +30,7 @@ var commands = []struct {
 	do   func(wuffsRoot string, args []string) error
 }{
 	{"bench", doBench},
+	{"build", doBuild},
 	{"gen", doGen},
 	{"genlib", doGenlib},
 	{"test", doTest},
@@ -45,6 +46,7 @@ Usage:
 The commands are:
 
 	bench   benchmark packages
+	build   generate code for packages and check that it compiles
 	gen     generate code for packages and dependencies
 	genlib  generate software libraries
 	test    test packages
@@ -161,6 +163,24 @@ func writeFile(filename string, contents []byte) error {
 }
 
 const (
+	checkabiDefault = ""
+	checkabiUsage   = "if non-empty, a directory of previous -genabi output (such as a released gen/abi/c) to check the C packages' public struct layouts against"
+
+	genabiDefault = false
+	genabiUsage   = `whether to also generate JSON descriptions of the C packages' struct layouts, in gen/abi/c`
+
+	genbenchDefault = false
+	genbenchUsage   = `whether to also generate benchmark programs for the C packages' decoders`
+
+	genmetadataDefault = false
+	genmetadataUsage   = `whether to also record the Wuffs version, git revision and wuffs-c flags in the generated C packages`
+
+	gentestDefault = false
+	gentestUsage   = `whether to also generate programs that run the C packages' test funcs`
+
+	genfuzzDefault = false
+	genfuzzUsage   = `whether to also generate libFuzzer fuzz targets (and OSS-Fuzz build glue) for the C packages' decoders`
+
 	langsDefault = "c"
 	langsUsage   = `comma-separated list of target languages (file extensions), e.g. "c,go,rs"`
 
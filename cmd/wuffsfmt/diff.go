@@ -0,0 +1,185 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// numContextLines is the number of unchanged lines around each change in a
+// unified diff, the same as the "diff -u" default.
+const numContextLines = 3
+
+// edit is one line of an edit script: an unchanged (' '), removed ('-') or
+// added ('+') line.
+type edit struct {
+	op   byte
+	line []byte
+}
+
+// splitLines splits b into lines, each including its trailing '\n' (except
+// possibly for the final line).
+func splitLines(b []byte) [][]byte {
+	ret := [][]byte(nil)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			i = len(b)
+		}
+		ret = append(ret, b[:i])
+		b = b[i:]
+	}
+	return ret
+}
+
+// editScript returns a shortest edit script from x to y, based on their
+// longest common subsequence.
+func editScript(x [][]byte, y [][]byte) []edit {
+	// Trim the common prefix and suffix, which is typically most of the
+	// lines, before the quadratic part.
+	prefix := 0
+	for (prefix < len(x)) && (prefix < len(y)) && bytes.Equal(x[prefix], y[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for (suffix < len(x)-prefix) && (suffix < len(y)-prefix) &&
+		bytes.Equal(x[len(x)-1-suffix], y[len(y)-1-suffix]) {
+		suffix++
+	}
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+
+	// lcs[i*w+j] is the length of the longest common subsequence of mx[i:]
+	// and my[j:].
+	w := len(my) + 1
+	lcs := make([]int32, (len(mx)+1)*w)
+	for i := len(mx) - 1; i >= 0; i-- {
+		for j := len(my) - 1; j >= 0; j-- {
+			if bytes.Equal(mx[i], my[j]) {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else if a, b := lcs[(i+1)*w+j], lcs[i*w+j+1]; a >= b {
+				lcs[i*w+j] = a
+			} else {
+				lcs[i*w+j] = b
+			}
+		}
+	}
+
+	ret := make([]edit, 0, len(x)+len(y)-prefix-suffix)
+	for _, line := range x[:prefix] {
+		ret = append(ret, edit{' ', line})
+	}
+	i, j := 0, 0
+	for (i < len(mx)) || (j < len(my)) {
+		switch {
+		case (i < len(mx)) && (j < len(my)) && bytes.Equal(mx[i], my[j]):
+			ret = append(ret, edit{' ', mx[i]})
+			i, j = i+1, j+1
+		case (j == len(my)) || ((i < len(mx)) && (lcs[(i+1)*w+j] >= lcs[i*w+j+1])):
+			ret = append(ret, edit{'-', mx[i]})
+			i++
+		default:
+			ret = append(ret, edit{'+', my[j]})
+			j++
+		}
+	}
+	for _, line := range x[len(x)-suffix:] {
+		ret = append(ret, edit{' ', line})
+	}
+	return ret
+}
+
+// unifiedDiff returns the unified diff from x, named xName, to y, named yName,
+// or nil if x and y are equal.
+func unifiedDiff(xName string, yName string, x []byte, y []byte) []byte {
+	if bytes.Equal(x, y) {
+		return nil
+	}
+	edits := editScript(splitLines(x), splitLines(y))
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", xName, yName)
+	// xLine and yLine are the 1-based line numbers of edits[i].
+	for i, xLine, yLine := 0, 1, 1; i < len(edits); {
+		if edits[i].op == ' ' {
+			i, xLine, yLine = i+1, xLine+1, yLine+1
+			continue
+		}
+
+		// Find the hunk's extent: the changes, merging those separated by
+		// at most 2*numContextLines unchanged lines, plus context.
+		begin := i - numContextLines
+		if begin < 0 {
+			begin = 0
+		}
+		end := i
+		for unchanged := 0; (end < len(edits)) && (unchanged <= 2*numContextLines); end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// Trim the trailing unchanged lines to at most numContextLines.
+		if n := countTrailingUnchanged(edits[i:end]); n > numContextLines {
+			end -= n - numContextLines
+		}
+
+		xBegin, yBegin := xLine-(i-begin), yLine-(i-begin)
+		xCount, yCount := 0, 0
+		for _, e := range edits[begin:end] {
+			if e.op != '+' {
+				xCount++
+			}
+			if e.op != '-' {
+				yCount++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(xBegin, xCount), hunkRange(yBegin, yCount))
+		for _, e := range edits[begin:end] {
+			buf.WriteByte(e.op)
+			buf.Write(e.line)
+			if (len(e.line) == 0) || (e.line[len(e.line)-1] != '\n') {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		for _, e := range edits[i:end] {
+			if e.op != '+' {
+				xLine++
+			}
+			if e.op != '-' {
+				yLine++
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+func countTrailingUnchanged(edits []edit) int {
+	n := 0
+	for ; (n < len(edits)) && (edits[len(edits)-1-n].op == ' '); n++ {
+	}
+	return n
+}
+
+// hunkRange formats a hunk header's range, as "diff -u" does. An empty range
+// starts at the line before it.
+func hunkRange(begin int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", begin-1)
+	case 1:
+		return fmt.Sprintf("%d", begin)
+	}
+	return fmt.Sprintf("%d,%d", begin, count)
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(tt *testing.T) {
+	// The wanted diffs, other than their "---" and "+++" lines, are what
+	// "diff -u" prints.
+	testCases := []struct {
+		x    string
+		y    string
+		want string
+	}{{
+		x:    "1\n2\n3\n",
+		y:    "1\n2\n3\n",
+		want: "",
+	}, {
+		x:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		y:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n",
+		want: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+	}, {
+		x:    "1\n2\n3\n4\n5\n6\n",
+		y:    "one\n2\n3\n4\n5\n6\n",
+		want: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n",
+	}, {
+		// Changes separated by at most 6 unchanged lines share a hunk.
+		x: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+		y: "1\n2\nthree\n4\n5\n6\n7\n8\n9\nten\n11\n12\n",
+		want: "@@ -1,12 +1,12 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n 7\n 8\n 9\n" +
+			"-10\n+ten\n 11\n 12\n",
+	}, {
+		// Changes separated by 7 do not.
+		x: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+		y: "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\neleven\n12\n13\n",
+		want: "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+			"@@ -8,6 +8,6 @@\n 8\n 9\n 10\n-11\n+eleven\n 12\n 13\n",
+	}, {
+		x:    "",
+		y:    "a\nb\n",
+		want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+	}, {
+		x:    "a\nb\nc\n",
+		y:    "a\nc\n",
+		want: "@@ -1,3 +1,2 @@\n a\n-b\n c\n",
+	}, {
+		x: "a\nb",
+		y: "a\nc",
+		want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n" +
+			"+c\n\\ No newline at end of file\n",
+	}}
+
+	for _, tc := range testCases {
+		got := string(unifiedDiff("x", "y", []byte(tc.x), []byte(tc.y)))
+		want := ""
+		if tc.want != "" {
+			want = "--- x\n+++ y\n" + tc.want
+		}
+		if got != want {
+			tt.Errorf("x=%q, y=%q:\ngot:\n%s\nwant:\n%s", tc.x, tc.y, got, want)
+		}
+	}
+}
+
+func TestEditScript(tt *testing.T) {
+	testCases := []struct {
+		x    string
+		y    string
+		want string
+	}{
+		{"", "", ""},
+		{"a\n", "a\n", " "},
+		{"a\nb\nc\n", "a\nc\n", " - "},
+		{"a\nc\n", "a\nb\nc\n", " + "},
+		{"a\nb\n", "c\nd\n", "--++"},
+		// The longest common subsequence, "b d", is kept.
+		{"a\nb\nc\nd\n", "b\nx\nd\ny\n", "- -+ +"},
+	}
+
+	for _, tc := range testCases {
+		got := []byte(nil)
+		for _, e := range editScript(splitLines([]byte(tc.x)), splitLines([]byte(tc.y))) {
+			got = append(got, e.op)
+		}
+		if string(got) != tc.want {
+			tt.Errorf("x=%q, y=%q: got %q, want %q", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
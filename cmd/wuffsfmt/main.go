@@ -12,11 +12,30 @@
 
 // wuffsfmt formats Wuffs programs.
 //
-// Without explicit paths, it rewrites the standard input to standard output.
-// Otherwise, the -l (list files that would change) or -w (write files in
-// place) or both flags must be given. Given a file path, it operates on that
-// file; given a directory path, it operates on all *.wuffs files in that
-// directory, recursively. File paths starting with a period are ignored.
+// Without explicit paths, it rewrites the standard input to standard output,
+// or with the -d flag, prints a unified diff of the changes it would make.
+// Otherwise, at least one of the -d (print diffs), -l (list files that would
+// change) or -w (write files in place) flags must be given. Given a file path,
+// it operates on that file; given a directory path, it operates on all *.wuffs
+// files in that directory, recursively. File paths starting with a period are
+// ignored.
+//
+// The -r flag gives a rewrite rule, "pattern -> replacement", to apply before
+// formatting, such as "x.length() > 0 -> not x.is_empty()". Both sides are
+// expressions, and single lower case letter identifiers, such as x, are
+// wildcards: in the pattern, they match any expression and in the replacement,
+// they stand for what they matched.
+//
+// The -unicode_idents flag allows identifiers with non-ASCII letters, like
+// the "wuffs-c gen" flag of the same name.
+//
+// With -d or -l but without -w, the exit status is 1 if any file's formatting
+// differs from wuffsfmt's, so that a continuous integration check can run
+// "wuffsfmt -l std".
+//
+// Formatting keeps every comment and where blank lines separate groups of
+// lines, although a run of blank lines becomes a single one. It is
+// idempotent: formatting wuffsfmt's output again changes nothing.
 package main
 
 import (
@@ -37,8 +56,14 @@ import (
 )
 
 var (
+	dFlag = flag.Bool("d", false, "print diffs instead of rewriting files")
 	lFlag = flag.Bool("l", false, "list files whose formatting differs from wuffsfmt's")
 	wFlag = flag.Bool("w", false, "write result to (source) file instead of stdout")
+
+	rFlag        = flag.String("r", "", "rewrite rule (e.g. \"x.length() > 0 -> not x.is_empty()\")")
+	maxWidthFlag = flag.Int("max_width", 0, "if positive, wrap lines wider than this many columns")
+
+	unicodeIdentsFlag = flag.Bool("unicode_idents", false, "whether identifiers can contain non-ASCII letters, as per UAX #31")
 )
 
 func usage() {
@@ -46,8 +71,17 @@ func usage() {
 	flag.PrintDefaults()
 }
 
+// errNeedsFormatting is returned by main1 when a file's formatting differs
+// from wuffsfmt's, under the -d or -l flags but not the -w flag.
+var errNeedsFormatting = errors.New("some files need formatting")
+
+// needsFormatting is whether any file's formatting differs from wuffsfmt's.
+var needsFormatting = false
+
 func main() {
-	if err := main1(); err != nil {
+	if err := main1(); err == errNeedsFormatting {
+		os.Exit(1)
+	} else if err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
 	}
@@ -64,11 +98,17 @@ func main1() error {
 		if *wFlag {
 			return errors.New("cannot use -w with standard input")
 		}
-		return do(os.Stdin, "<standard input>")
+		if err := do(os.Stdin, "<standard input>"); err != nil {
+			return err
+		}
+		if needsFormatting && *dFlag {
+			return errNeedsFormatting
+		}
+		return nil
 	}
 
-	if !*lFlag && !*wFlag {
-		return errors.New("must use -l or -w if paths are given")
+	if !*dFlag && !*lFlag && !*wFlag {
+		return errors.New("must use -d, -l or -w if paths are given")
 	}
 
 	for i := 0; i < flag.NArg(); i++ {
@@ -77,7 +117,9 @@ func main1() error {
 		case err != nil:
 			return err
 		case dir.IsDir():
-			return filepath.Walk(arg, walk)
+			if err := filepath.Walk(arg, walk); err != nil {
+				return err
+			}
 		default:
 			if err := do(nil, arg); err != nil {
 				return err
@@ -85,6 +127,9 @@ func main1() error {
 		}
 	}
 
+	if needsFormatting && (*dFlag || *lFlag) && !*wFlag {
+		return errNeedsFormatting
+	}
 	return nil
 }
 
@@ -117,31 +162,53 @@ func do(r io.Reader, filename string) error {
 	}
 
 	tm := &t.Map{}
-	tokens, comments, err := t.Tokenize(tm, filename, src)
+	tokens, comments, err := t.TokenizeOptions(tm, filename, src, &t.Options{
+		UnicodeIdents: *unicodeIdentsFlag,
+	})
 	if err != nil {
 		return err
 	}
 	// We don't need the AST node to pretty-print, but it's worth rejecting
 	// syntax errors early. This is just a parse, not a full type check.
-	if _, err := parse.Parse(tm, filename, tokens, &parse.Options{
+	parseOpts := &parse.Options{
 		AllowDoubleUnderscoreNames: true,
-	}); err != nil {
+	}
+	f, err := parse.Parse(tm, filename, tokens, parseOpts)
+	if err != nil {
 		return err
 	}
+	if *rFlag != "" {
+		rule, err := parseRewriteRule(tm, *rFlag)
+		if err != nil {
+			return err
+		}
+		tokens, comments = rule.rewrite(tokens, comments, f)
+		if _, err := parse.Parse(tm, filename, tokens, parseOpts); err != nil {
+			return fmt.Errorf("rewriting %s produced invalid code: %v", filename, err)
+		}
+	}
 	buf := &bytes.Buffer{}
-	if err := render.Render(buf, tm, tokens, comments); err != nil {
+	if err := render.RenderOptions(buf, tm, tokens, comments, &render.Options{
+		MaxWidth: *maxWidthFlag,
+	}); err != nil {
 		return err
 	}
 	dst := buf.Bytes()
 
-	if r != nil {
+	if (r != nil) && !*dFlag {
 		if _, err := os.Stdout.Write(dst); err != nil {
 			return err
 		}
 	} else if !bytes.Equal(dst, src) {
+		needsFormatting = true
 		if *lFlag {
 			fmt.Println(filename)
 		}
+		if *dFlag {
+			if _, err := os.Stdout.Write(unifiedDiff(filename+".orig", filename, src, dst)); err != nil {
+				return err
+			}
+		}
 		if *wFlag {
 			if err := writeFile(filename, dst); err != nil {
 				return err
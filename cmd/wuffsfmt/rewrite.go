@@ -0,0 +1,374 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// rewriteRule is a "pattern -> replacement" rewrite rule, as given by the -r
+// flag. Both sides are expressions. In the pattern, an identifier that is a
+// single lower case letter, such as x, is a wildcard that matches any
+// expression. In the replacement, it stands for what it matched.
+//
+// Like the renderer, rewriting works on tokens: each match's tokens are
+// replaced by the replacement's tokens, with parentheses added where the
+// grammar needs them. A multi-line match is joined onto its first line.
+type rewriteRule struct {
+	tm *t.Map
+
+	pattern     *a.Expr
+	replacement *a.Expr
+	// replTokens are the tokens that replacement's spans index.
+	replTokens []t.Token
+}
+
+// parseRewriteRule parses s, such as "x.length() > 0 -> not x.is_empty()".
+func parseRewriteRule(tm *t.Map, s string) (*rewriteRule, error) {
+	sides := strings.Split(s, "->")
+	if len(sides) != 2 {
+		return nil, errors.New(`rewrite rule must be of the form "pattern -> replacement"`)
+	}
+	pattern, _, err := parseRewriteExpr(tm, sides[0])
+	if err != nil {
+		return nil, fmt.Errorf("rewrite rule's pattern: %v", err)
+	}
+	replacement, replTokens, err := parseRewriteExpr(tm, sides[1])
+	if err != nil {
+		return nil, fmt.Errorf("rewrite rule's replacement: %v", err)
+	}
+	if (pattern.Operator() == 0) && isWildcard(tm, pattern.Ident()) {
+		return nil, errors.New("rewrite rule's pattern cannot be a lone wildcard")
+	}
+
+	// Every wildcard in the replacement must be bound by the pattern.
+	bound := map[t.ID]bool{}
+	pattern.AsNode().Walk(func(o *a.Node) error {
+		if id := wildcard(tm, o); id != 0 {
+			bound[id] = true
+		}
+		return nil
+	})
+	if err := replacement.AsNode().Walk(func(o *a.Node) error {
+		if id := wildcard(tm, o); (id != 0) && !bound[id] {
+			return fmt.Errorf("rewrite rule's replacement has unbound wildcard %q", id.Str(tm))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &rewriteRule{
+		tm:          tm,
+		pattern:     pattern,
+		replacement: replacement,
+		replTokens:  replTokens,
+	}, nil
+}
+
+// parseRewriteExpr parses one side of a rewrite rule. It is parsed within
+// parentheses, so that the whole of s has to be a single expression.
+func parseRewriteExpr(tm *t.Map, s string) (*a.Expr, []t.Token, error) {
+	tokens, _, err := t.Tokenize(tm, "-r", []byte("("+s+")"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for (len(tokens) > 0) && (tokens[len(tokens)-1].ID == t.IDSemicolon) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	n, err := parse.ParseExpr(tm, "-r", tokens, &parse.Options{
+		AllowDoubleUnderscoreNames: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return n, tokens, nil
+}
+
+func isWildcard(tm *t.Map, id t.ID) bool {
+	s := id.Str(tm)
+	return (len(s) == 1) && ('a' <= s[0]) && (s[0] <= 'z')
+}
+
+// wildcard returns the wildcard identifier that n is, or zero if n is not a
+// wildcard.
+func wildcard(tm *t.Map, n *a.Node) t.ID {
+	if n.Kind() == a.KExpr {
+		if o := n.AsExpr(); (o.Operator() == 0) && isWildcard(tm, o.Ident()) {
+			return o.Ident()
+		}
+	}
+	return 0
+}
+
+// isBinary returns whether n is a binary or associative operator expression,
+// which has to be parenthesized when it is an operand.
+func isBinary(n *a.Expr) bool {
+	op := n.Operator()
+	return op.IsXBinaryOp() || op.IsXAssociativeOp()
+}
+
+// isOperand returns whether child, a sub-expression of parent, is one of its
+// operands, such as the "x" in "-x", "x + y" or "x.foo()", as opposed to, for
+// example, a call argument or an index.
+func isOperand(parent *a.Node, child *a.Node) bool {
+	if (parent == nil) || (parent.Kind() != a.KExpr) {
+		return false
+	}
+	o := parent.AsExpr()
+	switch op := o.Operator(); {
+	case op.IsXUnaryOp(), op.IsXBinaryOp(), op.IsXAssociativeOp():
+		return true
+	case (op == a.ExprOperatorCall) || (op == a.ExprOperatorIndex) ||
+		(op == a.ExprOperatorSlice) || (op == a.ExprOperatorSelector):
+		return o.LHS() == child
+	}
+	return false
+}
+
+// match returns whether n matches pattern, adding the expressions that the
+// pattern's wildcards match to bindings.
+func (r *rewriteRule) match(pattern *a.Node, n *a.Node, bindings map[t.ID]*a.Expr) bool {
+	if (pattern == nil) || (n == nil) {
+		return (pattern == nil) && (n == nil)
+	}
+	if id := wildcard(r.tm, pattern); id != 0 {
+		if n.Kind() != a.KExpr {
+			return false
+		} else if b := bindings[id]; b != nil {
+			return b.Eq(n.AsExpr())
+		}
+		bindings[id] = n.AsExpr()
+		return true
+	}
+
+	if pattern.Kind() != n.Kind() {
+		return false
+	}
+	switch pattern.Kind() {
+	case a.KTypeExpr:
+		return pattern.AsTypeExpr().Eq(n.AsTypeExpr())
+	case a.KArg:
+		return (pattern.AsArg().Name() == n.AsArg().Name()) &&
+			r.match(pattern.AsArg().Value().AsNode(), n.AsArg().Value().AsNode(), bindings)
+	case a.KExpr:
+		p, o := pattern.AsExpr(), n.AsExpr()
+		if (p.Operator() != o.Operator()) || (p.Ident() != o.Ident()) ||
+			(p.Effect() != o.Effect()) || (p.Truncates() != o.Truncates()) ||
+			(len(p.Args()) != len(o.Args())) {
+			return false
+		}
+		if !r.match(p.LHS(), o.LHS(), bindings) ||
+			!r.match(p.MHS(), o.MHS(), bindings) ||
+			!r.match(p.RHS(), o.RHS(), bindings) {
+			return false
+		}
+		for i, x := range p.Args() {
+			if !r.match(x, o.Args()[i], bindings) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// rewriteEdit replaces src[span.Begin:span.End] with tokens.
+type rewriteEdit struct {
+	span   a.Span
+	tokens []t.Token
+}
+
+// collect appends the edits for n, whose parent is parent, and its
+// sub-nodes. The matches do not overlap: a match's sub-expressions are only
+// rewritten as part of the wildcards that they match.
+func (r *rewriteRule) collect(edits []rewriteEdit, src []t.Token, parent *a.Node, n *a.Node) []rewriteEdit {
+	if n == nil {
+		return edits
+	}
+	if (n.Kind() == a.KExpr) && (n.Span() != a.Span{}) {
+		bindings := map[t.ID]*a.Expr{}
+		if r.match(r.pattern.AsNode(), n, bindings) {
+			tokens := r.substitute(src, bindings)
+			if isBinary(r.replacement) && !isBinary(n.AsExpr()) && isOperand(parent, n) {
+				tokens = parenthesize(tokens)
+			}
+			return append(edits, rewriteEdit{n.Span(), tokens})
+		}
+	}
+	for _, o := range n.AsRaw().SubNodes() {
+		edits = r.collect(edits, src, n, o)
+	}
+	for _, l := range n.AsRaw().SubLists() {
+		for _, o := range l {
+			edits = r.collect(edits, src, n, o)
+		}
+	}
+	return edits
+}
+
+// substitute returns the replacement's tokens, with each wildcard replaced by
+// the (rewritten) tokens of the expression that it is bound to.
+func (r *rewriteRule) substitute(src []t.Token, bindings map[t.ID]*a.Expr) []t.Token {
+	edits := []rewriteEdit(nil)
+	var visit func(parent *a.Node, n *a.Node)
+	visit = func(parent *a.Node, n *a.Node) {
+		if n == nil {
+			return
+		} else if id := wildcard(r.tm, n); id != 0 {
+			b := bindings[id]
+			tokens := r.apply(src, b.AsNode())
+			// If b itself is rewritten, what matters is whether its
+			// replacement is binary.
+			binary := isBinary(b)
+			if r.match(r.pattern.AsNode(), b.AsNode(), map[t.ID]*a.Expr{}) {
+				binary = isBinary(r.replacement)
+			}
+			if binary && isOperand(parent, n) {
+				tokens = parenthesize(tokens)
+			}
+			edits = append(edits, rewriteEdit{n.Span(), tokens})
+			return
+		}
+		for _, o := range n.AsRaw().SubNodes() {
+			visit(n, o)
+		}
+		for _, l := range n.AsRaw().SubLists() {
+			for _, o := range l {
+				visit(n, o)
+			}
+		}
+	}
+	visit(nil, r.replacement.AsNode())
+
+	s := r.replacement.AsNode().Span()
+	return splice(r.replTokens[:s.End], s.Begin, edits)
+}
+
+// apply returns the tokens of n, with every match of the rule, including n
+// itself, rewritten.
+func (r *rewriteRule) apply(src []t.Token, n *a.Node) []t.Token {
+	s := n.Span()
+	return splice(src[:s.End], s.Begin, r.collect(nil, src, nil, n))
+}
+
+// splice returns src[begin:], with the edits (within that range) applied.
+func splice(src []t.Token, begin int, edits []rewriteEdit) []t.Token {
+	sortEdits(edits)
+	ret := []t.Token(nil)
+	for _, e := range edits {
+		ret = append(ret, src[begin:e.span.Begin]...)
+		ret = append(ret, e.tokens...)
+		begin = e.span.End
+	}
+	return append(ret, src[begin:]...)
+}
+
+// sortEdits sorts edits by position, as a node's sub-nodes are not
+// necessarily in source order.
+func sortEdits(edits []rewriteEdit) {
+	sort.Slice(edits, func(i int, j int) bool {
+		return edits[i].span.Begin < edits[j].span.Begin
+	})
+}
+
+func parenthesize(tokens []t.Token) []t.Token {
+	ret := make([]t.Token, 0, len(tokens)+2)
+	ret = append(ret, t.Token{ID: t.IDOpenParen})
+	ret = append(ret, tokens...)
+	return append(ret, t.Token{ID: t.IDCloseParen})
+}
+
+// rewrite returns src, the tokens of f, with every match of the rule
+// rewritten, and the comments, indexed by line, to go with them. Each
+// rewritten expression is put on the line that it started on, along with the
+// rest of the line that it ended on, as adding a line break could change where
+// the implicit semicolons are. The lines that that empties are removed, unless
+// they have a comment.
+func (r *rewriteRule) rewrite(src []t.Token, comments []string, f *a.File) ([]t.Token, []string) {
+	edits := r.collect(nil, src, nil, f.AsNode())
+	if len(edits) == 0 {
+		return src, comments
+	}
+	sortEdits(edits)
+
+	// lineMap maps the last line of each multi-line match to its first line.
+	lineMap := map[uint32]uint32{}
+	mapLine := func(line uint32) uint32 {
+		if x, ok := lineMap[line]; ok {
+			return x
+		}
+		return line
+	}
+	// emptied are the lines after the first line of each multi-line match.
+	emptied := map[uint32]bool{}
+
+	ret := make([]t.Token, 0, len(src))
+	begin := 0
+	for _, e := range edits {
+		for _, tok := range src[begin:e.span.Begin] {
+			tok.Line = mapLine(tok.Line)
+			ret = append(ret, tok)
+		}
+		first := mapLine(src[e.span.Begin].Line)
+		for _, tok := range e.tokens {
+			ret = append(ret, t.Token{ID: tok.ID, Line: first})
+		}
+		if last := src[e.span.End-1].Line; mapLine(last) != first {
+			lineMap[last] = first
+			for line := src[e.span.Begin].Line + 1; line <= last; line++ {
+				emptied[line] = true
+			}
+		}
+		begin = e.span.End
+	}
+	for _, tok := range src[begin:] {
+		tok.Line = mapLine(tok.Line)
+		ret = append(ret, tok)
+	}
+
+	// Renumber the lines, removing the emptied ones without a comment, so
+	// that the renderer does not see them as blank lines.
+	commentAt := func(line uint32) string {
+		if uint(line) < uint(len(comments)) {
+			return comments[line]
+		}
+		return ""
+	}
+	maxLine := uint32(len(comments))
+	if n := len(src); (n > 0) && (maxLine < src[n-1].Line) {
+		maxLine = src[n-1].Line
+	}
+	newLines := make([]uint32, maxLine+1)
+	newComments := []string(nil)
+	for line, n := uint32(0), uint32(0); line <= maxLine; line++ {
+		newLines[line] = n
+		if emptied[line] && (commentAt(line) == "") {
+			continue
+		}
+		if line < uint32(len(comments)) {
+			newComments = append(newComments, comments[line])
+		}
+		n++
+	}
+	for i := range ret {
+		ret[i].Line = newLines[ret[i].Line]
+	}
+	return ret, newComments
+}
@@ -0,0 +1,154 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/lang/render"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// rewriteSrc applies the rewrite rule to a func whose body is body, returning
+// the formatted body.
+func rewriteSrc(rule string, body string) (string, error) {
+	const filename = "test.wuffs"
+	const prefix = "pri func f(a: base.u32, b: base.u32) base.u32 {\n"
+	tm := &t.Map{}
+	tokens, comments, err := t.Tokenize(tm, filename, []byte(prefix+body+"}\n"))
+	if err != nil {
+		return "", err
+	}
+	f, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		return "", err
+	}
+	r, err := parseRewriteRule(tm, rule)
+	if err != nil {
+		return "", err
+	}
+	tokens, comments = r.rewrite(tokens, comments, f)
+	if _, err := parse.Parse(tm, filename, tokens, nil); err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := render.Render(buf, tm, tokens, comments); err != nil {
+		return "", err
+	}
+	s := strings.TrimPrefix(buf.String(), prefix)
+	return strings.TrimSuffix(s, "}\n"), nil
+}
+
+func TestRewrite(tt *testing.T) {
+	testCases := []struct {
+		rule string
+		body string
+		want string
+	}{{
+		rule: "x.length() > 0 -> not x.is_empty()",
+		body: "if this.s.length() > 0 {\nreturn 1\n}\nreturn 0\n",
+		want: "    if not this.s.is_empty() {\n        return 1\n    }\n    return 0\n",
+	}, {
+		// A wildcard that appears twice must match equal expressions. The
+		// source's parentheses are not part of the match.
+		rule: "x - x -> 0",
+		body: "return (args.a - args.a) + (args.a - args.b)\n",
+		want: "    return (0) + (args.a - args.b)\n",
+	}, {
+		// A binary replacement is parenthesized where it is an operand.
+		rule: "x.max(no_less_than: y) -> x | y",
+		body: "return args.a.max(no_less_than: 1) * 2\n",
+		want: "    return (args.a | 1) * 2\n",
+	}, {
+		// But not where it is not.
+		rule: "x.max(no_less_than: y) -> x | y",
+		body: "return this.g(x: args.a.max(no_less_than: 1))\n",
+		want: "    return this.g(x: args.a | 1)\n",
+	}, {
+		// A binary expression that a wildcard matched is parenthesized where
+		// the replacement makes it an operand.
+		rule: "this.g(x: y) -> y * 2",
+		body: "return this.g(x: args.a + 1)\n",
+		want: "    return (args.a + 1) * 2\n",
+	}, {
+		// What a wildcard matched is also rewritten.
+		rule: "x + 0 -> x",
+		body: "return ((args.a + 0) + 0) * 2\n",
+		want: "    return (args.a) * 2\n",
+	}, {
+		// A rewritten binary operand keeps its parentheses only if its
+		// replacement is binary.
+		rule: "x + 0 -> x",
+		body: "return ((args.a + args.b) + 0) * 2\n",
+		want: "    return (args.a + args.b) * 2\n",
+	}, {
+		// A multi-line match is joined onto its first line.
+		rule: "x + 0 -> x",
+		body: "return this.g(x: args.a +\n0,\ny: args.b)\n",
+		want: "    return this.g(x: args.a,\n            y: args.b)\n",
+	}, {
+		rule: "x + 0 -> x",
+		body: "return this.g(x: args.a +\n0,\ny: args.b +\n\n0)\n",
+		want: "    return this.g(x: args.a,\n            y: args.b)\n",
+	}, {
+		// Unless a line that it empties has a comment.
+		rule: "x + 0 -> x",
+		body: "return this.g(x: args.a +\n0,  // c\ny: args.b)\n",
+		want: "    return this.g(x: args.a,\n            // c\n            y: args.b)\n",
+	}, {
+		// Named arguments must match.
+		rule: "x.max(no_less_than: y) -> x | y",
+		body: "return this.max(no_more_than: 1)\n",
+		want: "    return this.max(no_more_than: 1)\n",
+	}}
+
+	for _, tc := range testCases {
+		got, err := rewriteSrc(tc.rule, tc.body)
+		if err != nil {
+			tt.Errorf("rule %q, body %q: %v", tc.rule, tc.body, err)
+			continue
+		}
+		if got != tc.want {
+			tt.Errorf("rule %q, body %q:\ngot:\n%s\nwant:\n%s", tc.rule, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestParseRewriteRule(tt *testing.T) {
+	testCases := []struct {
+		rule    string
+		wantErr string
+	}{
+		{"x.length() > 0 -> not x.is_empty()", ""},
+		{"x + 0 -> x", ""},
+		{"x + 0", "must be of the form"},
+		{"x -> y -> z", "must be of the form"},
+		{"x -> x + 0", "cannot be a lone wildcard"},
+		{"x + 0 -> y", "unbound wildcard \"y\""},
+		{"x + -> x", "rewrite rule's pattern"},
+		{"x + 0 -> x +", "rewrite rule's replacement"},
+	}
+
+	for _, tc := range testCases {
+		_, err := parseRewriteRule(&t.Map{}, tc.rule)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got error %v, want nil", tc.rule, err)
+			}
+		} else if (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got error %v, want one containing %q", tc.rule, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// abiDataModel is the C data model that an abiReport's sizes and offsets
+// assume: 8 byte pointers and 8 byte aligned uint64_t's.
+const abiDataModel = "LP64"
+
+// abiReport describes the memory layout of a package's generated C structs.
+// It is written, as JSON, by the -abi_json flag and read back by the
+// -check_abi flag.
+type abiReport struct {
+	Package   string      `json:"package"`
+	DataModel string      `json:"data_model"`
+	Structs   []abiStruct `json:"structs"`
+}
+
+type abiStruct struct {
+	Name   string     `json:"name"`
+	Public bool       `json:"public"`
+	Size   uint64     `json:"size"`
+	Align  uint64     `json:"align"`
+	Fields []abiField `json:"fields"`
+}
+
+// abiField is a leaf field of an abiStruct. Its Name is a path through any
+// nested structs, such as "private_data.s_decode.v_n", and its Offset is
+// relative to the outermost struct.
+type abiField struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
+}
+
+// abiBaseTypes holds the {size, align} of the base package's types that can
+// be struct fields.
+var abiBaseTypes = map[t.ID][2]uint64{
+	t.IDI8:   {1, 1},
+	t.IDI16:  {2, 2},
+	t.IDI32:  {4, 4},
+	t.IDI64:  {8, 8},
+	t.IDU8:   {1, 1},
+	t.IDU16:  {2, 2},
+	t.IDU32:  {4, 4},
+	t.IDU64:  {8, 8},
+	t.IDBool: {1, 1},
+
+	t.IDBitvec256:     {32, 8},
+	t.IDPixelSwizzler: {24, 8},
+	t.IDStatus:        {8, 8},
+}
+
+// abiLayout accumulates the fields of a C struct.
+type abiLayout struct {
+	fields []abiField
+	size   uint64
+	align  uint64
+}
+
+func abiAlignUp(x uint64, align uint64) uint64 {
+	return (x + align - 1) &^ (align - 1)
+}
+
+func (l *abiLayout) add(name string, typ string, size uint64, align uint64) {
+	if l.align < align {
+		l.align = align
+	}
+	l.size = abiAlignUp(l.size, align)
+	l.fields = append(l.fields, abiField{name, typ, l.size, size})
+	l.size += size
+}
+
+// addStruct adds sub's fields, as a nested struct called name.
+func (l *abiLayout) addStruct(name string, sub *abiLayout) {
+	sub.finish()
+	if l.align < sub.align {
+		l.align = sub.align
+	}
+	l.size = abiAlignUp(l.size, sub.align)
+	for _, f := range sub.fields {
+		f.Name = name + "." + f.Name
+		f.Offset += l.size
+		l.fields = append(l.fields, f)
+	}
+	l.size += sub.size
+}
+
+// finish pads the struct's size to a multiple of its alignment.
+func (l *abiLayout) finish() {
+	if l.align == 0 {
+		l.align = 1
+	}
+	l.size = abiAlignUp(l.size, l.align)
+}
+
+// abiContext holds the layouts of the structs seen so far.
+type abiContext struct {
+	known map[string]abiStruct
+
+	// dep returns the layout of a struct, such as a wuffs_deflate__decoder
+	// field in a wuffs_zlib__decoder, from the used package pkg.
+	dep func(name string, pkg t.ID) (abiStruct, error)
+
+	// use, if non-nil, is called for every struct-typed field.
+	use func(name string, pkg t.ID)
+}
+
+// generateABIReport returns the layout of the package's structs. It must be
+// called after generate, which populates g.structList and g.funks.
+//
+// Structs from used packages are looked up in that package's report, in
+// depDir.
+func (g *gen) generateABIReport(depDir string) (*abiReport, error) {
+	r := &abiReport{
+		Package:   g.pkgName,
+		DataModel: abiDataModel,
+	}
+	c := &abiContext{known: map[string]abiStruct{}}
+	deps := map[t.ID]*abiReport{}
+	c.dep = func(name string, pkg t.ID) (abiStruct, error) {
+		depFilename := filepath.Join(depDir, pkg.Str(g.tm)+".json")
+		dep := deps[pkg]
+		if dep == nil {
+			var err error
+			if dep, err = readABIReport(depFilename); err != nil {
+				return abiStruct{}, fmt.Errorf("no layout for %s: %v", name, err)
+			}
+			deps[pkg] = dep
+		}
+		for _, ds := range dep.Structs {
+			if ds.Name == name {
+				return ds, nil
+			}
+		}
+		return abiStruct{}, fmt.Errorf("no layout for %s in %s", name, depFilename)
+	}
+	for _, n := range g.structList {
+		s, err := g.abiStruct(n, c)
+		if err != nil {
+			return nil, err
+		}
+		r.Structs = append(r.Structs, s)
+	}
+	return r, nil
+}
+
+// abiStruct mirrors writeStructPrivateImpl.
+func (g *gen) abiStruct(n *a.Struct, c *abiContext) (abiStruct, error) {
+	impl := &abiLayout{}
+	if n.Classy() {
+		impl.add("magic", "uint32_t", 4, 4)
+		impl.add("active_coroutine", "uint32_t", 4, 4)
+		if g.threadSafety {
+			impl.add("busy", "uint32_t", 4, 4)
+		}
+		for _, o := range n.Implements() {
+			qid := o.AsTypeExpr().QID()
+			impl.add(fmt.Sprintf("vtable_for__wuffs_%s__%s", qid[0].Str(g.tm), qid[1].Str(g.tm)),
+				"wuffs_base__vtable", 16, 8)
+		}
+		impl.add("null_vtable", "wuffs_base__vtable", 16, 8)
+	}
+	data := &abiLayout{}
+	for _, o := range n.Fields() {
+		o := o.AsField()
+		if o.XType().IsEtcUtilityType() {
+			continue
+		}
+		l := impl
+		if o.PrivateData() {
+			l = data
+		}
+		if err := g.abiAdd(l, o.XType(), fPrefix+o.Name().Str(g.tm), c); err != nil {
+			return abiStruct{}, err
+		}
+	}
+
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			o := tld.AsFunc()
+			if (o.Receiver() != n.QID()) || !n.Classy() {
+				continue
+			}
+			funcName := o.FuncName().Str(g.tm)
+			if o.Choosy() {
+				sig := buffer(nil)
+				if err := g.writeFuncSignature(&sig, o, wfsCFuncPtrFieldChoosy); err != nil {
+					return abiStruct{}, err
+				}
+				impl.add("choosy_"+funcName, strings.Join(strings.Fields(string(sig)), " "), 8, 8)
+				continue
+			} else if !o.Effect().Coroutine() {
+				continue
+			}
+
+			k := g.funks[o.QQID()]
+			if k.coroSuspPoint != 0 {
+				impl.add(pPrefix+funcName, "uint32_t", 4, 4)
+			}
+			sub := &abiLayout{}
+			if k.coroSuspPoint != 0 {
+				for _, v := range k.varList {
+					typ := v.XType()
+					if typ.Innermost().IsEtcUtilityType() || typ.HasPointers() ||
+						(k.varResumables == nil) || !k.varResumables[v.Name()] {
+						continue
+					}
+					if err := g.abiAdd(sub, typ, vPrefix+v.Name().Str(g.tm), c); err != nil {
+						return abiStruct{}, err
+					}
+				}
+			}
+			if k.usesScratch {
+				sub.add("scratch", "uint64_t", 8, 8)
+			}
+			if len(sub.fields) > 0 {
+				data.addStruct(sPrefix+funcName, sub)
+			}
+		}
+	}
+
+	if len(impl.fields) == 0 {
+		impl.add("placeholder", "uint8_t", 1, 1)
+	}
+	outer := &abiLayout{}
+	outer.addStruct("private_impl", impl)
+	if len(data.fields) > 0 {
+		outer.addStruct("private_data", data)
+	}
+	outer.finish()
+	s := abiStruct{
+		Name:   g.pkgPrefix + n.QID()[1].Str(g.tm),
+		Public: n.Public(),
+		Size:   outer.size,
+		Align:  outer.align,
+		Fields: outer.fields,
+	}
+	c.known[s.Name] = s
+	return s, nil
+}
+
+// abiAdd adds a field of type typ to l.
+func (g *gen) abiAdd(l *abiLayout, typ *a.TypeExpr, name string, c *abiContext) error {
+	cType := buffer(nil)
+	if err := g.writeCTypeName(&cType, typ, "", ""); err != nil {
+		return err
+	}
+	size, align, err := g.abiSizeAlign(typ, c)
+	if err != nil {
+		return fmt.Errorf("abi: field %s: %v", name, err)
+	}
+	l.add(name, string(cType), size, align)
+	return nil
+}
+
+func (g *gen) abiSizeAlign(typ *a.TypeExpr, c *abiContext) (size uint64, align uint64, err error) {
+	switch {
+	case typ.IsEitherArrayType():
+		if inner := typ.Innermost(); (c.use != nil) && (inner.QID()[0] != t.IDBase) {
+			return 0, 0, fmt.Errorf("unsupported array of structs %q", typ.Str(g.tm))
+		}
+		size, align, err := g.abiSizeAlign(typ.Inner(), c)
+		if err != nil {
+			return 0, 0, err
+		}
+		return size * typ.ArrayLength().ConstValue().Uint64(), align, nil
+	case typ.IsPointerType():
+		return 8, 8, nil
+	case typ.IsEitherSliceType():
+		return 16, 8, nil
+	case typ.IsEitherTableType():
+		return 32, 8, nil
+	}
+
+	qid := typ.QID()
+	if qid[0] == t.IDBase {
+		if sa, ok := abiBaseTypes[qid[1]]; ok {
+			return sa[0], sa[1], nil
+		}
+		return 0, 0, fmt.Errorf("unsupported type %q", typ.Str(g.tm))
+	}
+
+	name := g.packagePrefix(qid) + qid[1].Str(g.tm)
+	if c.use != nil {
+		c.use(name, qid[0])
+	}
+	if s, ok := c.known[name]; ok {
+		return s.Size, s.Align, nil
+	} else if qid[0] == 0 {
+		return 0, 0, fmt.Errorf("no layout for %s", name)
+	}
+	s, err := c.dep(name, qid[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return s.Size, s.Align, nil
+}
+
+func readABIReport(filename string) (*abiReport, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := &abiReport{}
+	if err := json.Unmarshal(src, r); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if r.DataModel != abiDataModel {
+		return nil, fmt.Errorf("%s: data model %q, want %q", filename, r.DataModel, abiDataModel)
+	}
+	return r, nil
+}
+
+// writeABIReport writes generateABIReport's output to filename.
+func (g *gen) writeABIReport(filename string) error {
+	r, err := g.generateABIReport(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(out, '\n'), 0644)
+}
+
+// checkABI returns an error listing how the package's public structs' layouts
+// differ from the previous report in filename. Fields and structs that are
+// new, or private structs that were removed, are not ABI breaks.
+func (g *gen) checkABI(filename string) error {
+	old, err := readABIReport(filename)
+	if err != nil {
+		return err
+	}
+	r, err := g.generateABIReport(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	diffs := diffABIReports(old, r)
+	if len(diffs) > 0 {
+		return fmt.Errorf("abi: %s: layout differs from %s:\n\t%s",
+			g.pkgName, filename, strings.Join(diffs, "\n\t"))
+	}
+	return nil
+}
+
+func diffABIReports(old *abiReport, cur *abiReport) (diffs []string) {
+	newStructs := map[string]*abiStruct{}
+	for i := range cur.Structs {
+		newStructs[cur.Structs[i].Name] = &cur.Structs[i]
+	}
+
+	for _, o := range old.Structs {
+		if !o.Public {
+			continue
+		}
+		n := newStructs[o.Name]
+		if n == nil {
+			diffs = append(diffs, fmt.Sprintf("%s: removed", o.Name))
+			continue
+		}
+		if (o.Size != n.Size) || (o.Align != n.Align) {
+			diffs = append(diffs, fmt.Sprintf("%s: size/align changed from %d/%d to %d/%d",
+				o.Name, o.Size, o.Align, n.Size, n.Align))
+		}
+
+		newFields := map[string]*abiField{}
+		for i := range n.Fields {
+			newFields[n.Fields[i].Name] = &n.Fields[i]
+		}
+		for _, of := range o.Fields {
+			nf := newFields[of.Name]
+			if nf == nil {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: removed", o.Name, of.Name))
+			} else if of.Type != nf.Type {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: type changed from %q to %q",
+					o.Name, of.Name, of.Type, nf.Type))
+			} else if (of.Offset != nf.Offset) || (of.Size != nf.Size) {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: offset/size changed from %d/%d to %d/%d",
+					o.Name, of.Name, of.Offset, of.Size, nf.Offset, nf.Size))
+			}
+		}
+	}
+	return diffs
+}
+
+// structSizeMacroSuffix completes the name of the C macro for an upper bound
+// on a struct's size, such as WUFFS_ZLIB__DECODER_STRUCT_SIZE_MAX_INCL_WORST_CASE.
+const structSizeMacroSuffix = "_STRUCT_SIZE_MAX_INCL_WORST_CASE"
+
+// structAlignMacroSuffix completes the name of the C macro for an upper bound
+// on a struct's alignment, such as WUFFS_ZLIB__DECODER_STRUCT_ALIGN_MAX.
+const structAlignMacroSuffix = "_STRUCT_ALIGN_MAX"
+
+// writeStructSizes writes, for each public struct, a C macro for an upper
+// bound on its size, so that -nomalloc callers can statically allocate it.
+// With -opaque_structs, it also writes a C macro for an upper bound on its
+// alignment.
+//
+// The values are computed from the struct's LP64 layout. Structs from used
+// packages count as their own size macro, plus 7 bytes of padding slack. That
+// arithmetic is not what guarantees the bounds, as some ABIs align types to
+// 16 bytes. Instead, writeInitializerImpl and writeInitializeStorageImpl
+// generate compile-time checks that sizeof (and the alignment) is within the
+// macro's value, so a C compiler for an ABI where a bound doesn't hold rejects
+// the code rather than accepting an undersized allocation.
+func (g *gen) writeStructSizes(b *buffer) error {
+	deps := map[string][]string{}
+	current := []string(nil)
+	c := &abiContext{known: map[string]abiStruct{}}
+	c.dep = func(name string, pkg t.ID) (abiStruct, error) {
+		return abiStruct{Name: name, Size: 0, Align: 8}, nil
+	}
+	c.use = func(name string, pkg t.ID) {
+		if pkg == 0 {
+			current = append(current, deps[name]...)
+		} else {
+			current = append(current, strings.ToUpper(name)+structSizeMacroSuffix)
+		}
+	}
+
+	for _, n := range g.structList {
+		current = nil
+		s, err := g.abiStruct(n, c)
+		if err != nil {
+			return err
+		}
+		deps[s.Name] = current
+		if !n.Public() {
+			continue
+		}
+		structName := n.QID().Str(g.tm)
+		b.printf("// %s%s is an upper bound on\n", g.PKGPREFIX, strings.ToUpper(structName)+structSizeMacroSuffix)
+		b.printf("// sizeof(%s%s).\n", g.pkgPrefix, structName)
+		b.printf("#define %s%s ", g.PKGPREFIX, strings.ToUpper(structName)+structSizeMacroSuffix)
+		if len(current) == 0 {
+			b.printf("%d\n\n", s.Size)
+		} else {
+			b.printf("(%d + %s)\n\n", s.Size+(7*uint64(len(current))), strings.Join(current, " + "))
+		}
+		if g.opaqueStructs {
+			b.printf("// %s%s is an upper bound on\n", g.PKGPREFIX, strings.ToUpper(structName)+structAlignMacroSuffix)
+			b.printf("// alignof(%s%s).\n", g.pkgPrefix, structName)
+			b.printf("#define %s%s %d\n\n", g.PKGPREFIX, strings.ToUpper(structName)+structAlignMacroSuffix, s.Align)
+		}
+	}
+	return nil
+}
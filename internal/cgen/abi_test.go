@@ -0,0 +1,91 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestABILayout(tt *testing.T) {
+	// struct {
+	//   struct {
+	//     uint8_t a;
+	//     uint32_t b;
+	//     uint8_t c;
+	//   } private_impl;
+	//   struct {
+	//     uint16_t d;
+	//     struct {
+	//       uint64_t scratch;
+	//     } s_f;
+	//   } private_data;
+	// }
+	impl := &abiLayout{}
+	impl.add("a", "uint8_t", 1, 1)
+	impl.add("b", "uint32_t", 4, 4)
+	impl.add("c", "uint8_t", 1, 1)
+	sub := &abiLayout{}
+	sub.add("scratch", "uint64_t", 8, 8)
+	data := &abiLayout{}
+	data.add("d", "uint16_t", 2, 2)
+	data.addStruct("s_f", sub)
+	outer := &abiLayout{}
+	outer.addStruct("private_impl", impl)
+	outer.addStruct("private_data", data)
+	outer.finish()
+
+	if outer.size != 32 || outer.align != 8 {
+		tt.Fatalf("size/align: got %d/%d, want 32/8", outer.size, outer.align)
+	}
+	got := []uint64(nil)
+	for _, f := range outer.fields {
+		got = append(got, f.Offset)
+	}
+	if want := []uint64{0, 4, 8, 16, 24}; !reflect.DeepEqual(got, want) {
+		tt.Fatalf("offsets: got %v, want %v", got, want)
+	}
+	if got, want := outer.fields[4].Name, "private_data.s_f.scratch"; got != want {
+		tt.Fatalf("name: got %q, want %q", got, want)
+	}
+}
+
+func TestDiffABIReports(tt *testing.T) {
+	old := &abiReport{Structs: []abiStruct{{
+		Name: "wuffs_foo__bar", Public: true, Size: 8, Align: 4,
+		Fields: []abiField{
+			{"private_impl.f_x", "uint32_t", 0, 4},
+			{"private_impl.f_y", "uint32_t", 4, 4},
+		},
+	}, {
+		Name: "wuffs_foo__private", Size: 4, Align: 4,
+	}}}
+
+	same := &abiReport{Structs: []abiStruct{old.Structs[0]}}
+	if diffs := diffABIReports(old, same); len(diffs) != 0 {
+		tt.Fatalf("same: got %q, want no diffs", diffs)
+	}
+
+	changed := &abiReport{Structs: []abiStruct{{
+		Name: "wuffs_foo__bar", Public: true, Size: 8, Align: 4,
+		Fields: []abiField{
+			{"private_impl.f_x", "int32_t", 0, 4},
+			{"private_impl.f_z", "uint32_t", 4, 4},
+		},
+	}}}
+	want := []string{
+		`wuffs_foo__bar.private_impl.f_x: type changed from "uint32_t" to "int32_t"`,
+		`wuffs_foo__bar.private_impl.f_y: removed`,
+	}
+	if diffs := diffABIReports(old, changed); !reflect.DeepEqual(diffs, want) {
+		tt.Fatalf("changed: got %q, want %q", diffs, want)
+	}
+}
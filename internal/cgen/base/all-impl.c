@@ -18,7 +18,7 @@
 
 // ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.
 
-// ¡ INSERT base/copyright
+// ¡ {{insert "base/copyright"}}
 
 #include <stdbool.h>
 #include <stdint.h>
@@ -39,9 +39,9 @@
 extern "C" {
 #endif
 
-// ¡ INSERT base/all-public.h.
+// ¡ {{insert "base/all-public.h"}}
 
-// ¡ INSERT InterfaceDeclarations.
+// ¡ {{insert "InterfaceDeclarations"}}
 
 // ----------------
 
@@ -56,7 +56,7 @@ extern "C" {
 extern "C" {
 #endif
 
-// ¡ INSERT base/all-private.h.
+// ¡ {{insert "base/all-private.h"}}
 
 // ----------------
 
@@ -111,9 +111,9 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
     0x08, 0x0A, 0x0C, 0x10, 0x18, 0x20, 0x30, 0x40,
 };
 
-// ¡ INSERT wuffs_base__status strings.
+// ¡ {{insert "wuffs_base__status strings"}}
 
-// ¡ INSERT vtable names.
+// ¡ {{insert "vtable names"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE)  ||
@@ -122,7 +122,7 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \
     defined(WUFFS_CONFIG__MODULE__BASE__INTERFACES)
 
-// ¡ INSERT InterfaceDefinitions.
+// ¡ {{insert "InterfaceDefinitions"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE) ||
@@ -131,7 +131,7 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \
     defined(WUFFS_CONFIG__MODULE__BASE__FLOATCONV)
 
-// ¡ INSERT base/floatconv-submodule.c.
+// ¡ {{insert "base/floatconv-submodule.c"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE) ||
@@ -140,7 +140,7 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \
     defined(WUFFS_CONFIG__MODULE__BASE__INTCONV)
 
-// ¡ INSERT base/intconv-submodule.c.
+// ¡ {{insert "base/intconv-submodule.c"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE) ||
@@ -149,7 +149,7 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \
     defined(WUFFS_CONFIG__MODULE__BASE__MAGIC)
 
-// ¡ INSERT base/magic-submodule.c.
+// ¡ {{insert "base/magic-submodule.c"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE) ||
@@ -158,11 +158,11 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \
     defined(WUFFS_CONFIG__MODULE__BASE__PIXCONV)
 
-// ¡ INSERT base/pixconv-submodule-regular.c.
+// ¡ {{insert "base/pixconv-submodule-regular.c"}}
 
-// ¡ INSERT base/pixconv-submodule-ycck.c.
+// ¡ {{insert "base/pixconv-submodule-ycck.c"}}
 
-// ¡ INSERT base/pixconv-submodule-x86-avx2.c.
+// ¡ {{insert "base/pixconv-submodule-x86-avx2.c"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE) ||
@@ -171,7 +171,7 @@ const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16] = {
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \
     defined(WUFFS_CONFIG__MODULE__BASE__UTF8)
 
-// ¡ INSERT base/utf8-submodule.c.
+// ¡ {{insert "base/utf8-submodule.c"}}
 
 #endif  // !defined(WUFFS_CONFIG__MODULES) ||
         // defined(WUFFS_CONFIG__MODULE__BASE) ||
@@ -213,10 +213,25 @@
 // faster compiles and smaller binaries. Other motivations are discussed in the
 // "ALLOW STATIC IMPLEMENTATION" section of
 // https://raw.githubusercontent.com/nothings/stb/master/docs/stb_howto.txt
+//
+// Define WUFFS_CONFIG__DLL, both when building Wuffs as a Windows DLL (with
+// WUFFS_IMPLEMENTATION defined) and when using that DLL (without it), to
+// annotate Wuffs' non-static functions and data with __declspec(dllexport) or
+// __declspec(dllimport). It has no effect on other platforms.
+#if defined(WUFFS_CONFIG__DLL) && (defined(_WIN32) || defined(__CYGWIN__))
+#if defined(WUFFS_IMPLEMENTATION)
+#define WUFFS_BASE__DLL_API __declspec(dllexport)
+#else
+#define WUFFS_BASE__DLL_API __declspec(dllimport)
+#endif  // defined(WUFFS_IMPLEMENTATION)
+#else
+#define WUFFS_BASE__DLL_API
+#endif  // defined(WUFFS_CONFIG__DLL) && etc
+
 #if defined(WUFFS_CONFIG__STATIC_FUNCTIONS)
 #define WUFFS_BASE__MAYBE_STATIC static
 #else
-#define WUFFS_BASE__MAYBE_STATIC
+#define WUFFS_BASE__MAYBE_STATIC WUFFS_BASE__DLL_API
 #endif  // defined(WUFFS_CONFIG__STATIC_FUNCTIONS)
 
 // ---------------- CPU Architecture
@@ -538,7 +553,7 @@ typedef struct wuffs_base__status__struct {
 
 } wuffs_base__status;
 
-// ¡ INSERT wuffs_base__status names.
+// ¡ {{insert "wuffs_base__status names"}}
 
 static inline wuffs_base__status  //
 wuffs_base__make_status(const char* repr) {
@@ -678,13 +693,13 @@ typedef struct wuffs_base__transform__output__struct {
 // Wuffs' u32 values are big-endian ("JPEG" is 0x4A504547 not 0x4745504A) to
 // preserve ordering: "JPEG" < "MP3 " and 0x4A504547 < 0x4D503320.
 
-// ¡ INSERT FourCCs.
+// ¡ {{insert "FourCCs"}}
 
 // --------
 
 // Quirks.
 
-// ¡ INSERT Quirks.
+// ¡ {{insert "Quirks"}}
 
 // --------
 
@@ -1086,15 +1101,70 @@ wuffs_base__count_leading_zeroes_u64(uint64_t u) {
 //
 // However, the endian-agnostic implementations are slow on Microsoft's C
 // compiler (MSC). Alternative memcpy-based implementations restore speed, but
-// they are only correct on little-endian CPU architectures. Defining
-// WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE opts in to these implementations.
+// they are only correct if the CPU's endianness is known in advance. Defining
+// WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE or WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE
+// opts in to these implementations, for little-endian or big-endian CPUs. They
+// never dereference a cast uint32_t pointer (or similar), so they are still
+// correct on CPUs that require aligned loads and stores.
+//
+// Defining WUFFS_BASE__USE_PORTABLE_PEEK_POKE opts out of every memcpy-based
+// implementation, including the ones chosen automatically below. It takes
+// priority over the other two macros.
+//
+// The "wuffs-c gen -target" flag can define one of these three macros.
 //
 // https://godbolt.org/z/q4MfjzTPh
-#if defined(_MSC_VER) && !defined(__clang__) && \
-    (defined(_M_ARM64) || defined(_M_X64))
+#if defined(WUFFS_BASE__USE_PORTABLE_PEEK_POKE)
+#undef WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE
+#undef WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE
+#elif defined(_MSC_VER) && !defined(__clang__) && \
+    (defined(_M_ARM64) || defined(_M_X64)) &&      \
+    !defined(WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE)
 #define WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE
 #endif
 
+#if defined(WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE) && \
+    defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#error "define at most one of WUFFS_BASE__USE_MEMCPY_{BE,LE}_PEEK_POKE"
+#endif
+
+#if defined(WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE) || \
+    defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#define WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE
+
+#if defined(_MSC_VER) && !defined(__clang__)
+#define WUFFS_PRIVATE_IMPL__BSWAP16(x) _byteswap_ushort(x)
+#define WUFFS_PRIVATE_IMPL__BSWAP32(x) _byteswap_ulong(x)
+#define WUFFS_PRIVATE_IMPL__BSWAP64(x) _byteswap_uint64(x)
+#elif defined(__GNUC__) || defined(__clang__)
+#define WUFFS_PRIVATE_IMPL__BSWAP16(x) __builtin_bswap16(x)
+#define WUFFS_PRIVATE_IMPL__BSWAP32(x) __builtin_bswap32(x)
+#define WUFFS_PRIVATE_IMPL__BSWAP64(x) __builtin_bswap64(x)
+#else
+#error "the memcpy-based peek and poke implementations require clang, gcc or MSC"
+#endif
+
+// WUFFS_PRIVATE_IMPL__HOST_BEXX and WUFFS_PRIVATE_IMPL__HOST_LEXX convert
+// between host-endian and big-endian or little-endian values (in either
+// direction, as byte-swapping is its own inverse).
+#if defined(WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE)
+#define WUFFS_PRIVATE_IMPL__HOST_BE16(x) (x)
+#define WUFFS_PRIVATE_IMPL__HOST_BE32(x) (x)
+#define WUFFS_PRIVATE_IMPL__HOST_BE64(x) (x)
+#define WUFFS_PRIVATE_IMPL__HOST_LE16(x) WUFFS_PRIVATE_IMPL__BSWAP16(x)
+#define WUFFS_PRIVATE_IMPL__HOST_LE32(x) WUFFS_PRIVATE_IMPL__BSWAP32(x)
+#define WUFFS_PRIVATE_IMPL__HOST_LE64(x) WUFFS_PRIVATE_IMPL__BSWAP64(x)
+#else
+#define WUFFS_PRIVATE_IMPL__HOST_BE16(x) WUFFS_PRIVATE_IMPL__BSWAP16(x)
+#define WUFFS_PRIVATE_IMPL__HOST_BE32(x) WUFFS_PRIVATE_IMPL__BSWAP32(x)
+#define WUFFS_PRIVATE_IMPL__HOST_BE64(x) WUFFS_PRIVATE_IMPL__BSWAP64(x)
+#define WUFFS_PRIVATE_IMPL__HOST_LE16(x) (x)
+#define WUFFS_PRIVATE_IMPL__HOST_LE32(x) (x)
+#define WUFFS_PRIVATE_IMPL__HOST_LE64(x) (x)
+#endif
+
+#endif  // defined(WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE) etc
+
 #define wuffs_base__peek_u8be__no_bounds_check \
   wuffs_base__peek_u8__no_bounds_check
 #define wuffs_base__peek_u8le__no_bounds_check \
@@ -1107,10 +1177,10 @@ wuffs_base__peek_u8__no_bounds_check(const uint8_t* p) {
 
 static inline uint16_t  //
 wuffs_base__peek_u16be__no_bounds_check(const uint8_t* p) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
   uint16_t x;
   memcpy(&x, p, 2);
-  return _byteswap_ushort(x);
+  return (uint16_t)WUFFS_PRIVATE_IMPL__HOST_BE16(x);
 #else
   return (uint16_t)(((uint16_t)(p[0]) << 8) | ((uint16_t)(p[1]) << 0));
 #endif
@@ -1118,10 +1188,10 @@ wuffs_base__peek_u16be__no_bounds_check(const uint8_t* p) {
 
 static inline uint16_t  //
 wuffs_base__peek_u16le__no_bounds_check(const uint8_t* p) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
   uint16_t x;
   memcpy(&x, p, 2);
-  return x;
+  return (uint16_t)WUFFS_PRIVATE_IMPL__HOST_LE16(x);
 #else
   return (uint16_t)(((uint16_t)(p[0]) << 0) | ((uint16_t)(p[1]) << 8));
 #endif
@@ -1141,10 +1211,10 @@ wuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {
 
 static inline uint32_t  //
 wuffs_base__peek_u32be__no_bounds_check(const uint8_t* p) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
   uint32_t x;
   memcpy(&x, p, 4);
-  return _byteswap_ulong(x);
+  return (uint32_t)WUFFS_PRIVATE_IMPL__HOST_BE32(x);
 #else
   return ((uint32_t)(p[0]) << 24) | ((uint32_t)(p[1]) << 16) |
          ((uint32_t)(p[2]) << 8) | ((uint32_t)(p[3]) << 0);
@@ -1153,10 +1223,10 @@ wuffs_base__peek_u32be__no_bounds_check(const uint8_t* p) {
 
 static inline uint32_t  //
 wuffs_base__peek_u32le__no_bounds_check(const uint8_t* p) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
   uint32_t x;
   memcpy(&x, p, 4);
-  return x;
+  return (uint32_t)WUFFS_PRIVATE_IMPL__HOST_LE32(x);
 #else
   return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |
          ((uint32_t)(p[2]) << 16) | ((uint32_t)(p[3]) << 24);
@@ -1209,10 +1279,10 @@ wuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {
 
 static inline uint64_t  //
 wuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
   uint64_t x;
   memcpy(&x, p, 8);
-  return _byteswap_uint64(x);
+  return (uint64_t)WUFFS_PRIVATE_IMPL__HOST_BE64(x);
 #else
   return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |
          ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |
@@ -1223,10 +1293,10 @@ wuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {
 
 static inline uint64_t  //
 wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE)
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
   uint64_t x;
   memcpy(&x, p, 8);
-  return x;
+  return (uint64_t)WUFFS_PRIVATE_IMPL__HOST_LE64(x);
 #else
   return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
          ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
@@ -1249,13 +1319,21 @@ wuffs_base__poke_u8__no_bounds_check(uint8_t* p, uint8_t x) {
 
 static inline void  //
 wuffs_base__poke_u16be__no_bounds_check(uint8_t* p, uint16_t x) {
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
+  x = (uint16_t)WUFFS_PRIVATE_IMPL__HOST_BE16(x);
+  memcpy(p, &x, 2);
+#else
   p[0] = (uint8_t)(x >> 8);
   p[1] = (uint8_t)(x >> 0);
+#endif
 }
 
 static inline void  //
 wuffs_base__poke_u16le__no_bounds_check(uint8_t* p, uint16_t x) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE) || \
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
+  x = (uint16_t)WUFFS_PRIVATE_IMPL__HOST_LE16(x);
+  memcpy(p, &x, 2);
+#elif !defined(WUFFS_BASE__USE_PORTABLE_PEEK_POKE) && \
     (defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__))
   // This seems to perform better on gcc 10 (but not clang 9). Clang also
   // defines "__GNUC__".
@@ -1282,15 +1360,23 @@ wuffs_base__poke_u24le__no_bounds_check(uint8_t* p, uint32_t x) {
 
 static inline void  //
 wuffs_base__poke_u32be__no_bounds_check(uint8_t* p, uint32_t x) {
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
+  x = (uint32_t)WUFFS_PRIVATE_IMPL__HOST_BE32(x);
+  memcpy(p, &x, 4);
+#else
   p[0] = (uint8_t)(x >> 24);
   p[1] = (uint8_t)(x >> 16);
   p[2] = (uint8_t)(x >> 8);
   p[3] = (uint8_t)(x >> 0);
+#endif
 }
 
 static inline void  //
 wuffs_base__poke_u32le__no_bounds_check(uint8_t* p, uint32_t x) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE) || \
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
+  x = (uint32_t)WUFFS_PRIVATE_IMPL__HOST_LE32(x);
+  memcpy(p, &x, 4);
+#elif !defined(WUFFS_BASE__USE_PORTABLE_PEEK_POKE) && \
     (defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__))
   // This seems to perform better on gcc 10 (but not clang 9). Clang also
   // defines "__GNUC__".
@@ -1365,6 +1451,10 @@ wuffs_base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {
 
 static inline void  //
 wuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
+  x = (uint64_t)WUFFS_PRIVATE_IMPL__HOST_BE64(x);
+  memcpy(p, &x, 8);
+#else
   p[0] = (uint8_t)(x >> 56);
   p[1] = (uint8_t)(x >> 48);
   p[2] = (uint8_t)(x >> 40);
@@ -1373,11 +1463,15 @@ wuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {
   p[5] = (uint8_t)(x >> 16);
   p[6] = (uint8_t)(x >> 8);
   p[7] = (uint8_t)(x >> 0);
+#endif
 }
 
 static inline void  //
 wuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {
-#if defined(WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE) || \
+#if defined(WUFFS_PRIVATE_IMPL__USE_MEMCPY_PEEK_POKE)
+  x = (uint64_t)WUFFS_PRIVATE_IMPL__HOST_LE64(x);
+  memcpy(p, &x, 8);
+#elif !defined(WUFFS_BASE__USE_PORTABLE_PEEK_POKE) && \
     (defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__))
   // This seems to perform better on gcc 10 (but not clang 9). Clang also
   // defines "__GNUC__".
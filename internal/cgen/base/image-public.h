@@ -483,7 +483,8 @@ wuffs_base__make_pixel_format(uint32_t repr) {
 
 // clang-format on
 
-extern const uint32_t wuffs_private_impl__pixel_format__bits_per_channel[16];
+extern WUFFS_BASE__DLL_API const uint32_t
+    wuffs_private_impl__pixel_format__bits_per_channel[16];
 
 static inline bool  //
 wuffs_base__pixel_format__is_valid(const wuffs_base__pixel_format* f) {
@@ -0,0 +1,309 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"os"
+	"strings"
+
+	"github.com/google/wuffs/lib/dumbindent"
+)
+
+// benchInterfaces are the decoder interfaces that a generated benchmark
+// program can drive, keyed by their name in the base package.
+var benchInterfaces = map[string]func(g *gen, b *buffer, iName string){
+	"image_decoder":  (*gen).writeBenchImageDecoder,
+	"io_transformer": (*gen).writeBenchIOTransformer,
+	"token_decoder":  (*gen).writeBenchTokenDecoder,
+}
+
+// generateBenchTarget returns a benchmark program for the package's public
+// decoders, or nil if the package has none. It must be called after
+// generate, which populates g.structList.
+//
+// The program decodes each file named on its command line, once to warm up
+// and then -reps=N times (5 by default) per decoder. It prints
+// benchstat-compatible lines, where MB/s counts the decoded output: pixel
+// bytes for an image_decoder, dst bytes for an io_transformer and src bytes
+// for a token_decoder. Like the fuzz target, it #include's the release/c
+// single file library relative to the Wuffs root directory.
+func (g *gen) generateBenchTarget() ([]byte, error) {
+	decoders := g.findDecoders(benchInterfaces)
+	if len(decoders) == 0 {
+		return nil, nil
+	}
+
+	b := new(buffer)
+	b.writes("// This file is generated by \"wuffs-c gen -bench_target\". It benchmarks\n")
+	b.printf("// the wuffs_%s package's decoders on the files named by its arguments.\n", g.pkgName)
+	b.writes("// Compile it with the Wuffs root directory on the include path:\n")
+	b.writes("//\n")
+	b.printf("// gcc -O3 -I. gen/bench/c/std/%s_bench.c\n", g.pkgName)
+	b.writes("// ./a.out -reps=5 etc\n\n")
+
+	b.writes("#define WUFFS_IMPLEMENTATION\n")
+	b.writes("#define WUFFS_CONFIG__STATIC_FUNCTIONS\n\n")
+	b.writes("#include <inttypes.h>\n")
+	b.writes("#include <stdio.h>\n")
+	b.writes("#include <stdlib.h>\n")
+	b.writes("#include <string.h>\n")
+	b.writes("#include <sys/time.h>\n\n")
+	b.writes("#include \"release/c/wuffs-unsupported-snapshot.c\"\n\n")
+
+	for _, d := range decoders {
+		g.writeBenchDecoder(b, d)
+	}
+
+	b.writes("typedef struct {\n")
+	b.writes("const char* name;\n")
+	b.writes("const char* (*decode)(wuffs_base__io_buffer* src, uint64_t* n_bytes);\n")
+	b.writes("} bench_decoder;\n\n")
+	b.writes("static const bench_decoder g_decoders[] = {\n")
+	for _, d := range decoders {
+		b.printf("{\"%s\", bench_%s%s},\n", benchName(g.pkgPrefix+d.structName), g.pkgPrefix, d.structName)
+	}
+	b.writes("{NULL, NULL},\n};\n\n")
+
+	b.writes(benchMain)
+	return *b, nil
+}
+
+// benchName returns the benchmark name for a C struct name, in the Go style
+// that benchstat expects: "wuffs_deflate__decoder" becomes
+// "WuffsDeflateDecoder", printed as "BenchmarkWuffsDeflateDecoder/etc".
+func benchName(cName string) string {
+	sb := strings.Builder{}
+	for _, s := range strings.Split(cName, "_") {
+		if s != "" {
+			sb.WriteString(strings.ToUpper(s[:1]))
+			sb.WriteString(s[1:])
+		}
+	}
+	return sb.String()
+}
+
+// benchMain is the package-independent part of a generated benchmark
+// program.
+const benchMain = `static uint64_t  //
+now_nanos(void) {
+struct timeval tv;
+gettimeofday(&tv, NULL);
+return (((uint64_t)tv.tv_sec) * 1000000000) + (((uint64_t)tv.tv_usec) * 1000);
+}
+
+static int  //
+bench_file(const char* filename, uint64_t reps) {
+FILE* f = fopen(filename, "rb");
+if (!f) {
+fprintf(stderr, "could not open %s\n", filename);
+return 1;
+}
+uint8_t* data = NULL;
+size_t len = 0;
+size_t cap = 0;
+while (true) {
+if (len == cap) {
+cap = cap ? (2 * cap) : 65536;
+uint8_t* p = (uint8_t*)realloc(data, cap);
+if (!p) {
+free(data);
+fclose(f);
+fprintf(stderr, "out of memory\n");
+return 1;
+}
+data = p;
+}
+size_t n = fread(data + len, 1, cap - len, f);
+len += n;
+if (n == 0) {
+break;
+}
+}
+fclose(f);
+
+const char* basename = strrchr(filename, '/');
+basename = basename ? (basename + 1) : filename;
+
+int ret = 0;
+for (const bench_decoder* d = &g_decoders[0]; d->name; d++) {
+uint64_t n_bytes = 0;
+uint64_t nanos = 0;
+const char* msg = NULL;
+for (uint64_t i = 0; (i <= reps) && !msg; i++) {
+wuffs_base__io_buffer src = wuffs_base__ptr_u8__reader(data, len, true);
+uint64_t n = 0;
+uint64_t then = now_nanos();
+msg = (*d->decode)(&src, &n);
+uint64_t elapsed = now_nanos() - then;
+if (i > 0) {  // The first, untimed, run warms up.
+n_bytes += n;
+nanos += elapsed;
+}
+}
+if (msg) {
+fprintf(stderr, "%s/%s: %s\n", d->name, basename, msg);
+ret = 1;
+} else if (reps > 0) {
+printf("Benchmark%s/%s\t%8" PRIu64 "\t%8" PRIu64 " ns/op\t%12.3f MB/s\n",
+d->name, basename, reps, nanos / reps,
+(nanos > 0) ? ((1e3 * n_bytes) / nanos) : 0.0);
+fflush(stdout);
+}
+}
+free(data);
+return ret;
+}
+
+int  //
+main(int argc, char** argv) {
+uint64_t reps = 5;
+int ret = 0;
+for (int i = 1; i < argc; i++) {
+if (!strncmp(argv[i], "-reps=", 6)) {
+reps = strtoull(argv[i] + 6, NULL, 10);
+} else if (bench_file(argv[i], reps)) {
+ret = 1;
+}
+}
+return ret;
+}
+`
+
+// writeBenchTarget writes generateBenchTarget's output to filename, or
+// removes any existing file there if the package has no decoders.
+func (g *gen) writeBenchTarget(filename string) error {
+	target, err := g.generateBenchTarget()
+	if err != nil {
+		return err
+	} else if target == nil {
+		if err := os.Remove(filename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	target = dumbindent.FormatBytes(nil, target, nil)
+	return os.WriteFile(filename, target, 0644)
+}
+
+// writeBenchDecoder writes a bench_wuffs_foo__bar function that decodes src
+// with a freshly initialized wuffs_foo__bar, via "self", an upcast pointer to
+// that decoder.
+func (g *gen) writeBenchDecoder(b *buffer, d decoderStruct) {
+	cName := g.pkgPrefix + d.structName
+	iName := "wuffs_base__" + d.iName
+
+	b.writes("static const char*  //\n")
+	b.printf("bench_%s(wuffs_base__io_buffer* src, uint64_t* n_bytes) {\n", cName)
+	b.printf("static %s dec;\n", cName)
+	b.printf("wuffs_base__status status = %s__initialize(\n", cName)
+	b.writes("&dec, sizeof dec, WUFFS_VERSION,\n")
+	b.writes("WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED);\n")
+	b.writes("if (!wuffs_base__status__is_ok(&status)) {\n")
+	b.writes("return wuffs_base__status__message(&status);\n")
+	b.writes("}\n")
+	b.printf("%s* self = %s__upcast_as__%s(&dec);\n\n", iName, cName, iName)
+
+	d.write(g, b, iName)
+	b.writes("}\n\n")
+}
+
+func (g *gen) writeBenchImageDecoder(b *buffer, iName string) {
+	b.writes("const char* ret = NULL;\n")
+	b.writes("wuffs_base__slice_u8 pixbuf = wuffs_base__empty_slice_u8();\n")
+	b.writes("wuffs_base__slice_u8 workbuf = wuffs_base__empty_slice_u8();\n\n")
+
+	// Use a {} code block so that "goto exit" doesn't trigger "jump bypasses
+	// variable initialization" warnings.
+	b.writes("{\n")
+	b.writes("wuffs_base__image_config ic = ((wuffs_base__image_config){});\n")
+	b.printf("status = %s__decode_image_config(self, &ic, src);\n", iName)
+	b.writes("if (!wuffs_base__status__is_ok(&status)) {\n")
+	b.writes("ret = wuffs_base__status__message(&status);\n")
+	b.writes("goto exit;\n")
+	b.writes("}\n")
+	b.writes("uint64_t n = wuffs_base__pixel_config__pixbuf_len(&ic.pixcfg);\n")
+	b.writes("if (n > 0) {\n")
+	b.writes("pixbuf = wuffs_base__malloc_slice_u8(malloc, n);\n")
+	b.writes("if (!pixbuf.ptr) {\n")
+	b.writes("ret = \"out of memory\";\n")
+	b.writes("goto exit;\n")
+	b.writes("}\n")
+	b.writes("}\n")
+	b.printf("n = %s__workbuf_len(self).max_incl;\n", iName)
+	b.writes("if (n > 0) {\n")
+	b.writes("workbuf = wuffs_base__malloc_slice_u8(malloc, n);\n")
+	b.writes("if (!workbuf.ptr) {\n")
+	b.writes("ret = \"out of memory\";\n")
+	b.writes("goto exit;\n")
+	b.writes("}\n")
+	b.writes("}\n")
+	b.writes("wuffs_base__pixel_buffer pb = ((wuffs_base__pixel_buffer){});\n")
+	b.writes("status = wuffs_base__pixel_buffer__set_from_slice(&pb, &ic.pixcfg, pixbuf);\n")
+	b.writes("if (!wuffs_base__status__is_ok(&status)) {\n")
+	b.writes("ret = wuffs_base__status__message(&status);\n")
+	b.writes("goto exit;\n")
+	b.writes("}\n\n")
+
+	b.writes("while (true) {\n")
+	b.printf("status = %s__decode_frame(\n", iName)
+	b.writes("self, &pb, src, WUFFS_BASE__PIXEL_BLEND__SRC, workbuf, NULL);\n")
+	b.writes("if (status.repr == wuffs_base__note__end_of_data) {\n")
+	b.writes("break;\n")
+	b.writes("} else if (!wuffs_base__status__is_ok(&status)) {\n")
+	b.writes("ret = wuffs_base__status__message(&status);\n")
+	b.writes("goto exit;\n")
+	b.writes("}\n")
+	b.writes("*n_bytes += pixbuf.len;\n")
+	b.writes("}\n")
+	b.writes("}\n\n")
+
+	b.writes("exit:\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.writes("free(pixbuf.ptr);\n")
+	b.writes("return ret;\n")
+}
+
+func (g *gen) writeBenchIOTransformer(b *buffer, iName string) {
+	g.writeWorkbuf(b, iName, "bench")
+	b.writes("static uint8_t dst_array[65536];\n")
+	b.writes("wuffs_base__io_buffer dst =\n")
+	b.writes("wuffs_base__ptr_u8__writer(&dst_array[0], sizeof dst_array);\n\n")
+	b.writes("while (true) {\n")
+	b.printf("status = %s__transform_io(self, &dst, src, workbuf);\n", iName)
+	b.writes("*n_bytes += dst.meta.wi - dst.meta.ri;\n")
+	b.writes("dst.meta.ri = dst.meta.wi;\n")
+	g.writeShortWorkbuf(b, iName, "bench")
+	b.writes("if (status.repr != wuffs_base__suspension__short_write) {\n")
+	b.writes("break;\n")
+	b.writes("}\n")
+	g.writeCompactRetaining(b, iName, "bench")
+	b.writes("}\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.writes("return wuffs_base__status__message(&status);\n")
+}
+
+func (g *gen) writeBenchTokenDecoder(b *buffer, iName string) {
+	g.writeWorkbuf(b, iName, "bench")
+	b.writes("static wuffs_base__token tok_array[4096];\n")
+	b.writes("wuffs_base__token_buffer tok = wuffs_base__slice_token__writer(\n")
+	b.writes("wuffs_base__make_slice_token(&tok_array[0], 4096));\n\n")
+	b.writes("while (true) {\n")
+	b.writes("tok.meta.ri = 0;\n")
+	b.writes("tok.meta.wi = 0;\n")
+	b.printf("status = %s__decode_tokens(self, &tok, src, workbuf);\n", iName)
+	b.writes("if (status.repr != wuffs_base__suspension__short_write) {\n")
+	b.writes("break;\n")
+	b.writes("}\n")
+	b.writes("}\n")
+	b.writes("*n_bytes = src->meta.ri;\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.writes("return wuffs_base__status__message(&status);\n")
+}
@@ -0,0 +1,30 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"testing"
+)
+
+func TestBenchName(tt *testing.T) {
+	testCases := []struct {
+		cName, want string
+	}{
+		{"wuffs_deflate__decoder", "WuffsDeflateDecoder"},
+		{"wuffs_gif__decoder", "WuffsGifDecoder"},
+		{"myapp_json__decoder", "MyappJsonDecoder"},
+	}
+	for _, tc := range testCases {
+		if got := benchName(tc.cName); got != tc.want {
+			tt.Errorf("cName=%q: got %q, want %q", tc.cName, got, tc.want)
+		}
+	}
+}
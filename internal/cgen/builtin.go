@@ -26,21 +26,17 @@ var (
 )
 
 func (g *gen) writeBuiltinCall(b *buffer, n *a.Expr, sideEffectsOnly bool, depth uint32) error {
-	if n.Operator() != a.ExprOperatorCall {
+	x, ok := n.Intrinsic()
+	if !ok {
 		return errNoSuchBuiltin
 	}
-	method := n.LHS().AsExpr()
-	recv := method.LHS().AsExpr()
-	recvTyp := recv.MType()
-
-	switch recvTyp.Decorator() {
-	case 0:
-		// No-op.
+	recv, method := x.Recv, x.Method
 
-	case t.IDNptr, t.IDPtr:
+	switch x.Kind {
+	case a.IntrinsicPtr:
 		u64ToFlicksIndex := -1
 
-		if method.Ident() != t.IDSet {
+		if method != t.IDSet {
 			return errNoSuchBuiltin
 		}
 		recvName, err := g.recvName(recv)
@@ -48,7 +44,7 @@ func (g *gen) writeBuiltinCall(b *buffer, n *a.Expr, sideEffectsOnly bool, depth
 			return err
 		}
 
-		switch recvTyp.Inner().QID() {
+		switch recv.MType().Inner().QID() {
 		case t.QID{t.IDBase, t.IDImageConfig}:
 			b.printf("wuffs_base__image_config__set(\n%s", recvName)
 		case t.QID{t.IDBase, t.IDFrameConfig}:
@@ -58,7 +54,7 @@ func (g *gen) writeBuiltinCall(b *buffer, n *a.Expr, sideEffectsOnly bool, depth
 			return errNoSuchBuiltin
 		}
 
-		for i, o := range n.Args() {
+		for i, o := range x.Args {
 			b.writes(",\n")
 			if i == u64ToFlicksIndex {
 				if o.AsArg().Name().Str(g.tm) != "duration" {
@@ -76,72 +72,62 @@ func (g *gen) writeBuiltinCall(b *buffer, n *a.Expr, sideEffectsOnly bool, depth
 		b.writeb(')')
 		return nil
 
-	case t.IDRoslice, t.IDSlice:
-		return g.writeBuiltinSlice(b, recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
-	case t.IDRotable, t.IDTable:
-		return g.writeBuiltinTable(b, recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
-	default:
-		return errNoSuchBuiltin
-	}
-
-	qid := recvTyp.QID()
-	if qid[0] != t.IDBase {
-		return errNoSuchBuiltin
-	}
-
-	if qid[1].IsNumType() {
-		return g.writeBuiltinNumType(b, recv, method.Ident(), n.Args(), depth)
-	} else if qid[1].IsBuiltInCPUArch() {
-		return g.writeBuiltinCPUArch(b, recv, method.Ident(), n.MType(), n.Args(), sideEffectsOnly, depth)
-	} else {
-		switch qid[1] {
-		case t.IDIOReader:
-			return g.writeBuiltinIOReader(b, recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
-		case t.IDIOWriter:
-			return g.writeBuiltinIOWriter(b, recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
-		case t.IDPixelSwizzler:
-			switch method.Ident() {
-			case t.IDLimitedSwizzleU32InterleavedFromReader, t.IDSwizzleInterleavedFromReader:
-				b.writes("wuffs_base__pixel_swizzler__")
-				if method.Ident() == t.IDLimitedSwizzleU32InterleavedFromReader {
-					b.writes("limited_swizzle_u32_interleaved_from_reader")
-				} else {
-					b.writes("swizzle_interleaved_from_reader")
-				}
-				b.writes("(\n&")
-				if err := g.writeExpr(b, recv, false, depth); err != nil {
-					return err
-				}
-				args := n.Args()
-				for _, o := range args[:len(args)-1] {
-					b.writes(",\n")
-					if err := g.writeExpr(b, o.AsArg().Value(), false, depth); err != nil {
-						return err
-					}
-				}
-				readerArgName, err := g.recvName(args[len(args)-1].AsArg().Value())
-				if err != nil {
+	case a.IntrinsicSlice:
+		return g.writeBuiltinSlice(b, recv, method, x.Args, sideEffectsOnly, depth)
+	case a.IntrinsicTable:
+		return g.writeBuiltinTable(b, recv, method, x.Args, sideEffectsOnly, depth)
+	case a.IntrinsicNumType:
+		return g.writeBuiltinNumType(b, recv, method, x.Args, depth)
+	case a.IntrinsicCPUArch:
+		return g.writeBuiltinCPUArch(b, recv, method, n.MType(), x.Args, sideEffectsOnly, depth)
+	case a.IntrinsicIOReader:
+		return g.writeBuiltinIOReader(b, recv, method, x.Args, sideEffectsOnly, depth)
+	case a.IntrinsicIOWriter:
+		return g.writeBuiltinIOWriter(b, recv, method, x.Args, sideEffectsOnly, depth)
+	case a.IntrinsicTokenWriter:
+		return g.writeBuiltinTokenWriter(b, recv, method, x.Args, sideEffectsOnly, depth)
+
+	case a.IntrinsicPixelSwizzler:
+		switch method {
+		case t.IDLimitedSwizzleU32InterleavedFromReader, t.IDSwizzleInterleavedFromReader:
+			b.writes("wuffs_base__pixel_swizzler__")
+			if method == t.IDLimitedSwizzleU32InterleavedFromReader {
+				b.writes("limited_swizzle_u32_interleaved_from_reader")
+			} else {
+				b.writes("swizzle_interleaved_from_reader")
+			}
+			b.writes("(\n&")
+			if err := g.writeExpr(b, recv, false, depth); err != nil {
+				return err
+			}
+			args := x.Args
+			for _, o := range args[:len(args)-1] {
+				b.writes(",\n")
+				if err := g.writeExpr(b, o.AsArg().Value(), false, depth); err != nil {
 					return err
 				}
-				b.printf(",\n&%s%s,\n%s%s)", iopPrefix, readerArgName, io2Prefix, readerArgName)
-				return nil
 			}
-		case t.IDTokenWriter:
-			return g.writeBuiltinTokenWriter(b, recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
-		case t.IDUtility:
-			switch method.Ident() {
-			case t.IDCPUArchIs32Bit:
-				b.writes("(sizeof(void*) == 4u)")
-				return nil
-			case t.IDEmptyIOReader, t.IDEmptyIOWriter:
-				if !g.currFunk.usesEmptyIOBuffer {
-					g.currFunk.usesEmptyIOBuffer = true
-					g.currFunk.bPrologue.writes("wuffs_base__io_buffer empty_io_buffer = " +
-						"wuffs_base__empty_io_buffer();\n\n")
-				}
-				b.writes("&empty_io_buffer")
-				return nil
+			readerArgName, err := g.recvName(args[len(args)-1].AsArg().Value())
+			if err != nil {
+				return err
+			}
+			b.printf(",\n&%s%s,\n%s%s)", iopPrefix, readerArgName, io2Prefix, readerArgName)
+			return nil
+		}
+
+	case a.IntrinsicUtility:
+		switch method {
+		case t.IDCPUArchIs32Bit:
+			b.writes("(sizeof(void*) == 4u)")
+			return nil
+		case t.IDEmptyIOReader, t.IDEmptyIOWriter:
+			if !g.currFunk.usesEmptyIOBuffer {
+				g.currFunk.usesEmptyIOBuffer = true
+				g.currFunk.bPrologue.writes("wuffs_base__io_buffer empty_io_buffer = " +
+					"wuffs_base__empty_io_buffer();\n\n")
 			}
+			b.writes("&empty_io_buffer")
+			return nil
 		}
 	}
 	return errNoSuchBuiltin
@@ -1219,23 +1205,19 @@ func (g *gen) writeArgs(b *buffer, args []*a.Node, depth uint32) error {
 
 func (g *gen) writeBuiltinQuestionCall(b *buffer, n *a.Expr, depth uint32) error {
 	// TODO: also handle (or reject??) being on the RHS of an =? operator.
-	if (n.Operator() != a.ExprOperatorCall) || (!n.Effect().Coroutine()) {
+	intr, ok := n.Intrinsic()
+	if !ok || !n.Effect().Coroutine() ||
+		((intr.Kind != a.IntrinsicIOReader) && (intr.Kind != a.IntrinsicIOWriter)) {
 		return errNoSuchBuiltin
 	}
-	method := n.LHS().AsExpr()
-	recv := method.LHS().AsExpr()
-	recvTyp := recv.MType()
-	if !recvTyp.IsIOTokenType() {
-		return errNoSuchBuiltin
-	}
-	recvName, err := g.recvName(recv)
+	recvName, err := g.recvName(intr.Recv)
 	if err != nil {
 		return err
 	}
 
-	switch recvTyp.QID()[1] {
-	case t.IDIOReader:
-		switch method.Ident() {
+	switch intr.Kind {
+	case a.IntrinsicIOReader:
+		switch intr.Method {
 		case t.IDReadU8, t.IDReadU8AsU16, t.IDReadU8AsU32, t.IDReadU8AsU64:
 			if err := g.writeCoroSuspPoint(b, false); err != nil {
 				return err
@@ -1296,8 +1278,8 @@ func (g *gen) writeBuiltinQuestionCall(b *buffer, n *a.Expr, depth uint32) error
 			return nil
 		}
 
-		if method.Ident() >= readMethodsBase {
-			if m := method.Ident() - readMethodsBase; m < t.ID(len(readMethods)) {
+		if intr.Method >= readMethodsBase {
+			if m := intr.Method - readMethodsBase; m < t.ID(len(readMethods)) {
 				if p := readMethods[m]; p.n != 0 {
 					if err := g.writeCoroSuspPoint(b, false); err != nil {
 						return err
@@ -1307,8 +1289,8 @@ func (g *gen) writeBuiltinQuestionCall(b *buffer, n *a.Expr, depth uint32) error
 			}
 		}
 
-	case t.IDIOWriter:
-		switch method.Ident() {
+	case a.IntrinsicIOWriter:
+		switch intr.Method {
 		case t.IDWriteU8:
 			g.currFunk.usesScratch = true
 			scratchName := fmt.Sprintf("self->private_data.%s%s.scratch",
@@ -11,15 +11,19 @@
 package cgen
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"math/big"
+	"os"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/google/wuffs/internal/lower"
 	"github.com/google/wuffs/lang/builtin"
 	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
 	"github.com/google/wuffs/lib/dumbindent"
 
 	cf "github.com/google/wuffs/cmd/commonflags"
@@ -107,92 +111,341 @@ var BaseSubModules = []string{
 
 // Do transpiles a Wuffs program to a C program.
 //
-// The arguments list the source Wuffs files. If no arguments are given, it
-// reads from stdin.
+// The arguments list the source Wuffs files, or directories of them. If no
+// arguments are given, it reads from stdin. Each directory is a package, as
+// per generate.Do, and packages are generated in the order of their use
+// declarations, concurrently where that order allows.
 //
-// The generated program is written to stdout.
+// The generated program is written to stdout or, with the -outdir flag, one
+// file per package. If the -cpp_wrapper flag is set, a header-only C++
+// wrapper is also written to that file. Likewise for the -fuzz_target flag
+// and a libFuzzer fuzz target, the -bench_target flag and a benchmark
+// program, the -test_target flag and a program that runs the package's test
+// funcs and the -abi_json flag and a JSON description of the package's struct
+// layouts. If the -check_abi flag is set, it fails if those layouts differ
+// from a previous -abi_json file. Those flags require a single package. If
+// the -nomalloc flag is set, the generated code never allocates heap memory.
+// If the -opaque_structs flag is set, the public header hides the structs'
+// definitions from C++ as well as C callers. If the -thread_safety flag is
+// set, public coroutines guard against concurrent re-entry and the public API
+// has clang thread safety attributes. If the -single_file flag is set, the
+// generated program is amalgamated with its dependencies, as per singleFile.
+// The -target flag selects how it loads and stores multi-byte integers, as
+// per cTargets. If the -build_metadata flag is set, the generated header
+// records the -version and -git_revision flags and the other wuffs-c flags.
+// If the -linedirectives flag is set, the generated program contains #line
+// directives, as per resetLineDirectives, that assume that it is saved as
+// "wuffs-PKG.c".
 func Do(args []string) error {
 	flags := flag.FlagSet{}
 	genlinenumFlag := flags.Bool("genlinenum", cf.GenlinenumDefault, cf.GenlinenumUsage)
+	linedirectivesFlag := flags.Bool("linedirectives", cf.LinedirectivesDefault, cf.LinedirectivesUsage)
+	cppWrapperFlag := flags.String("cpp_wrapper", "",
+		"if non-empty, also write a header-only C++ wrapper to this file")
+	prefixFlag := flags.String("prefix", "",
+		"the C identifier prefix, such as \"myapp_gif\"; if empty, it comes from a use \"cgen prefix etc\" pragma or defaults to \"wuffs_\" then the package name")
+	fuzzTargetFlag := flags.String("fuzz_target", "",
+		"if non-empty, also write a libFuzzer fuzz target for the package's decoders to this file (or remove that file if there are none)")
+	benchTargetFlag := flags.String("bench_target", "",
+		"if non-empty, also write a benchmark program for the package's decoders to this file (or remove that file if there are none)")
+	testTargetFlag := flags.String("test_target", "",
+		"if non-empty, also write a self-contained C program that runs the package's test funcs to this file (or remove that file if there are none)")
+	abiJSONFlag := flags.String("abi_json", "",
+		"if non-empty, also write a JSON description of the package's struct layouts to this file (used packages' descriptions are read from the same directory)")
+	checkABIFlag := flags.String("check_abi", "",
+		"if non-empty, fail if the package's public struct layouts differ from this previously written -abi_json file")
+	nomallocFlag := flags.Bool("nomalloc", false,
+		"whether the generated code must never allocate heap memory, in which case the header defines worst-case struct sizes for static allocation")
+	threadSafetyFlag := flags.Bool("thread_safety", false,
+		"whether public coroutines return an error when re-entered concurrently, and the public API has clang thread safety attributes")
+	opaqueStructsFlag := flags.Bool("opaque_structs", false,
+		"whether the public structs are incomplete types (even in C++) unless WUFFS_IMPLEMENTATION is defined, with size and alignment macros and functions and an initialize_storage function for caller-allocated memory")
+	targetFlag := flags.String("target", "",
+		"how the generated code loads and stores multi-byte integers: portable (byte-wise, for any CPU), little_endian or big_endian (memcpy-based, for CPUs with that endianness); if empty, this is chosen when compiling the C code")
+	buildMetadataFlag := flags.Bool("build_metadata", false,
+		"whether the generated header records the Wuffs version, git revision and wuffs-c flags, and defines a wuffs_foo__version function")
+	versionFlag := flags.String("version", cf.VersionDefault,
+		"the Wuffs version, e.g. \"1.2.3-beta.4\", that -build_metadata records")
+	gitRevisionFlag := flags.String("git_revision", "",
+		"the Wuffs source code's git revision that -build_metadata records")
+	singleFileFlag := flags.Bool("single_file", false,
+		"whether to write one self-contained C file that also contains the base package and any used packages")
+
+	// These flags each name one file, so they apply to only one package.
+	onePackageFlags := []struct {
+		name  string
+		value *string
+	}{
+		{"abi_json", abiJSONFlag},
+		{"bench_target", benchTargetFlag},
+		{"check_abi", checkABIFlag},
+		{"cpp_wrapper", cppWrapperFlag},
+		{"fuzz_target", fuzzTargetFlag},
+		{"test_target", testTargetFlag},
+	}
+	// numPackages is updated atomically, as generate.Do can call its
+	// generator function concurrently.
+	numPackages := int32(0)
+
+	return generate.Do(&flags, "c", args, func(pkgName string, tm *t.Map, files []*a.File) ([]byte, error) {
+		if atomic.AddInt32(&numPackages, 1) > 1 {
+			for _, f := range onePackageFlags {
+				if *f.value != "" {
+					return nil, fmt.Errorf("-%s is incompatible with more than one package", f.name)
+				}
+			}
+		}
+		target, ok := cTargets[*targetFlag]
+		if !ok {
+			return nil, fmt.Errorf("bad -target flag value %q", *targetFlag)
+		}
+		version, ok := cf.ParseVersion(*versionFlag)
+		if !ok {
+			return nil, fmt.Errorf("bad -version flag value %q", *versionFlag)
+		}
+		if !cf.IsAlphaNumericIsh(*gitRevisionFlag) {
+			return nil, fmt.Errorf("bad -git_revision flag value %q", *gitRevisionFlag)
+		}
 
-	return generate.Do(&flags, args, func(pkgName string, tm *t.Map, files []*a.File) ([]byte, error) {
 		unformatted := []byte(nil)
 		if pkgName == "base" {
 			if len(files) != 0 {
 				return nil, fmt.Errorf("base package shouldn't have any .wuffs files")
 			}
-			buf := make(buffer, 0, 128*1024)
-			if err := expandBangInsert(&buf, embedBaseAllImplC.Trim(), map[string]func(*buffer) error{
-				"// ¡ INSERT InterfaceDeclarations.\n":             insertInterfaceDeclarations,
-				"// ¡ INSERT InterfaceDefinitions.\n":              insertInterfaceDefinitions,
-				"// ¡ INSERT base/all-private.h.\n":                insertBaseAllPrivateH,
-				"// ¡ INSERT base/all-public.h.\n":                 insertBaseAllPublicH,
-				"// ¡ INSERT base/copyright\n":                     insertBaseCopyright,
-				"// ¡ INSERT base/floatconv-submodule.c.\n":        insertBaseFloatConvSubmoduleC,
-				"// ¡ INSERT base/intconv-submodule.c.\n":          insertBaseIntConvSubmoduleC,
-				"// ¡ INSERT base/magic-submodule.c.\n":            insertBaseMagicSubmoduleC,
-				"// ¡ INSERT base/pixconv-submodule-regular.c.\n":  insertBasePixConvSubmoduleRegularC,
-				"// ¡ INSERT base/pixconv-submodule-x86-avx2.c.\n": insertBasePixConvSubmoduleX86Avx2C,
-				"// ¡ INSERT base/pixconv-submodule-ycck.c.\n":     insertBasePixConvSubmoduleYcckC,
-				"// ¡ INSERT base/utf8-submodule.c.\n":             insertBaseUTF8SubmoduleC,
-				"// ¡ INSERT vtable names.\n": func(b *buffer) error {
-					for _, n := range builtin.Interfaces {
-						buf.printf("const char wuffs_base__%s__vtable_name[] = "+
-							"\"{vtable}wuffs_base__%s\";\n", n, n)
-					}
-					return nil
-				},
-				"// ¡ INSERT wuffs_base__status strings.\n": func(b *buffer) error {
-					for _, z := range builtin.Statuses {
-						msg, _ := t.Unescape(z)
-						if msg == "" {
-							continue
-						}
-						pre := "note"
-						if msg[0] == '$' {
-							pre = "suspension"
-						} else if msg[0] == '#' {
-							pre = "error"
-						}
-						b.printf("const char wuffs_base__%s__%s[] = \"%sbase: %s\";\n",
-							pre, cName(msg, ""), msg[:1], msg[1:])
-					}
-					return nil
-				},
-			}); err != nil {
+			if *cppWrapperFlag != "" {
+				return nil, fmt.Errorf("base package doesn't have a C++ wrapper")
+			}
+			if *prefixFlag != "" {
+				return nil, fmt.Errorf("base package's prefix cannot be changed")
+			}
+			if *fuzzTargetFlag != "" {
+				return nil, fmt.Errorf("base package doesn't have a fuzz target")
+			}
+			if *benchTargetFlag != "" {
+				return nil, fmt.Errorf("base package doesn't have a bench target")
+			}
+			if *testTargetFlag != "" {
+				return nil, fmt.Errorf("base package doesn't have a test target")
+			}
+			if (*abiJSONFlag != "") || (*checkABIFlag != "") {
+				return nil, fmt.Errorf("base package doesn't have an ABI report")
+			}
+			if *nomallocFlag {
+				return nil, fmt.Errorf("base package doesn't have a -nomalloc mode")
+			}
+			if *threadSafetyFlag {
+				return nil, fmt.Errorf("base package doesn't have a -thread_safety mode")
+			}
+			if *opaqueStructsFlag {
+				return nil, fmt.Errorf("base package doesn't have an -opaque_structs mode")
+			}
+			if target != "" {
+				return nil, fmt.Errorf("base package doesn't have a -target; #define %s instead", target)
+			}
+			if *buildMetadataFlag {
+				return nil, fmt.Errorf("base package doesn't have -build_metadata; it already defines WUFFS_VERSION")
+			}
+			var err error
+			unformatted, err = generateBase()
+			if err != nil {
 				return nil, err
 			}
-			unformatted = []byte(buf)
 
 		} else {
+			if *nomallocFlag && (*cppWrapperFlag != "") {
+				return nil, fmt.Errorf("the C++ wrapper allocates heap memory, so it is incompatible with -nomalloc")
+			}
+			if *threadSafetyFlag && (*cppWrapperFlag != "") {
+				return nil, fmt.Errorf("the C++ wrapper owns its object, so it is incompatible with -thread_safety")
+			}
+			prefix, err := cPrefix(*prefixFlag, pkgName, tm, files)
+			if err != nil {
+				return nil, err
+			}
 			g := &gen{
-				PKGPREFIX:  "WUFFS_" + strings.ToUpper(pkgName) + "__",
-				PKGNAME:    strings.ToUpper(pkgName),
-				pkgPrefix:  "wuffs_" + pkgName + "__",
-				pkgName:    pkgName,
-				tm:         tm,
-				files:      files,
-				genlinenum: *genlinenumFlag,
+				PKGPREFIX:      strings.ToUpper(prefix) + "__",
+				PKGNAME:        strings.ToUpper(pkgName),
+				GUARDNAME:      strings.ToUpper(strings.TrimPrefix(prefix, "wuffs_")),
+				pkgPrefix:      prefix + "__",
+				pkgName:        pkgName,
+				tm:             tm,
+				files:          files,
+				genlinenum:     *genlinenumFlag,
+				linedirectives: *linedirectivesFlag,
+				nomalloc:       *nomallocFlag,
+				threadSafety:   *threadSafetyFlag,
+				opaqueStructs:  *opaqueStructsFlag,
+				target:         target,
+			}
+			if *buildMetadataFlag {
+				g.buildMetadata = &buildMetadata{
+					version:     version,
+					gitRevision: *gitRevisionFlag,
+					flags:       recordedFlags(&flags),
+				}
 			}
-			var err error
 			unformatted, err = g.generate()
 			if err != nil {
 				return nil, err
 			}
+			if *cppWrapperFlag != "" {
+				wrapper, err := g.generateCppWrapper()
+				if err != nil {
+					return nil, err
+				}
+				wrapper = dumbindent.FormatBytes(nil, wrapper, nil)
+				if err := os.WriteFile(*cppWrapperFlag, wrapper, 0644); err != nil {
+					return nil, err
+				}
+			}
+			if *fuzzTargetFlag != "" {
+				if err := g.writeFuzzTarget(*fuzzTargetFlag); err != nil {
+					return nil, err
+				}
+			}
+			if *benchTargetFlag != "" {
+				if err := g.writeBenchTarget(*benchTargetFlag); err != nil {
+					return nil, err
+				}
+			}
+			if *testTargetFlag != "" {
+				if err := g.writeTestTarget(*testTargetFlag); err != nil {
+					return nil, err
+				}
+			}
+			if *checkABIFlag != "" {
+				if err := g.checkABI(*checkABIFlag); err != nil {
+					return nil, err
+				}
+			}
+			if *abiJSONFlag != "" {
+				if err := g.writeABIReport(*abiJSONFlag); err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		// The base package is largely hand-written C, not transpiled from
 		// Wuffs, and that part is presumably already formatted. The rest is
 		// generated by this package. We take care here to print well indented
 		// C code, so further C formatting is unnecessary.
-		if pkgName == "base" {
-			return unformatted, nil
+		out := unformatted
+		if pkgName != "base" {
+			out = dumbindent.FormatBytes(nil, unformatted, nil)
 		}
 
-		return dumbindent.FormatBytes(nil, unformatted, nil), nil
+		if *singleFileFlag {
+			var err error
+			if out, err = singleFile(out); err != nil {
+				return nil, err
+			}
+		}
+		if *linedirectivesFlag && (pkgName != "base") {
+			out = resetLineDirectives(out, "wuffs-"+pkgName+".c")
+		}
+		return out, nil
 	})
 }
 
+// cTargets maps the -target flag's values to the base package's C macro that
+// selects the wuffs_base__peek_etc and wuffs_base__poke_etc implementations.
+// The memcpy-based ones are faster with some compilers, but are only correct
+// for one endianness. None of them assume aligned pointers.
+var cTargets = map[string]string{
+	"":              "",
+	"portable":      "WUFFS_BASE__USE_PORTABLE_PEEK_POKE",
+	"little_endian": "WUFFS_BASE__USE_MEMCPY_LE_PEEK_POKE",
+	"big_endian":    "WUFFS_BASE__USE_MEMCPY_BE_PEEK_POKE",
+}
+
+// cPrefix returns the C identifier prefix (e.g. "wuffs_gif", without the
+// trailing "__") for a package: flagValue if non-empty, otherwise the prefix
+// given by the files' `use "cgen prefix etc"` pragma, otherwise the default.
+func cPrefix(flagValue string, pkgName string, tm *t.Map, files []*a.File) (string, error) {
+	prefix := flagValue
+	if prefix == "" {
+		for _, file := range files {
+			p, ok := parse.CgenPrefixPragma(tm, file.CgenPrefixPragma())
+			if !ok {
+				continue
+			} else if (prefix != "") && (prefix != p) {
+				return "", fmt.Errorf("conflicting cgen prefix pragmas %q and %q", prefix, p)
+			}
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return "wuffs_" + pkgName, nil
+	} else if !validCPrefix(prefix) {
+		return "", fmt.Errorf("invalid cgen prefix %q", prefix)
+	} else if prefix == "wuffs_base" {
+		return "", fmt.Errorf("cgen prefix %q is reserved for the base package", prefix)
+	}
+	return prefix, nil
+}
+
+// validCPrefix returns whether s matches "[a-z][a-z0-9_]*", with no "__" and
+// no trailing "_", so that s+"__"+etc is an unambiguous C identifier.
+func validCPrefix(s string) bool {
+	if (s == "") || (s[0] < 'a') || ('z' < s[0]) ||
+		(s[len(s)-1] == '_') || strings.Contains(s, "__") {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if c := s[i]; (c != '_') && ((c < '0') || ('9' < c)) && ((c < 'a') || ('z' < c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateBase returns the C code for the base package, which is largely
+// hand-written C, not transpiled from Wuffs.
+func generateBase() ([]byte, error) {
+	buf := make(buffer, 0, 128*1024)
+	if err := expandTemplate(&buf, "base/all-impl.c", embedBaseAllImplC.Trim(), templateSections{
+		"InterfaceDeclarations":             insertInterfaceDeclarations,
+		"InterfaceDefinitions":              insertInterfaceDefinitions,
+		"base/all-private.h":                insertBaseAllPrivateH,
+		"base/all-public.h":                 insertBaseAllPublicH,
+		"base/copyright":                    insertBaseCopyright,
+		"base/floatconv-submodule.c":        insertBaseFloatConvSubmoduleC,
+		"base/intconv-submodule.c":          insertBaseIntConvSubmoduleC,
+		"base/magic-submodule.c":            insertBaseMagicSubmoduleC,
+		"base/pixconv-submodule-regular.c":  insertBasePixConvSubmoduleRegularC,
+		"base/pixconv-submodule-x86-avx2.c": insertBasePixConvSubmoduleX86Avx2C,
+		"base/pixconv-submodule-ycck.c":     insertBasePixConvSubmoduleYcckC,
+		"base/utf8-submodule.c":             insertBaseUTF8SubmoduleC,
+		"vtable names": func(b *buffer) error {
+			for _, n := range builtin.Interfaces {
+				b.printf("const char wuffs_base__%s__vtable_name[] = "+
+					"\"{vtable}wuffs_base__%s\";\n", n, n)
+			}
+			return nil
+		},
+		"wuffs_base__status strings": func(b *buffer) error {
+			for _, z := range builtin.Statuses {
+				msg, _ := t.Unescape(z)
+				if msg == "" {
+					continue
+				}
+				pre := "note"
+				if msg[0] == '$' {
+					pre = "suspension"
+				} else if msg[0] == '#' {
+					pre = "error"
+				}
+				b.printf("const char wuffs_base__%s__%s[] = \"%sbase: %s\";\n",
+					pre, cName(msg, ""), msg[:1], msg[1:])
+			}
+			return nil
+		},
+	}, nil); err != nil {
+		return nil, err
+	}
+	return []byte(buf), nil
+}
+
 type visibility uint32
 
 const (
@@ -247,40 +500,6 @@ func (b *buffer) undoWrites(s string) bool {
 	return true
 }
 
-func expandBangInsert(b *buffer, s string, m map[string]func(*buffer) error) error {
-	for {
-		remaining := ""
-		if i := strings.IndexByte(s, '\n'); i >= 0 {
-			s, remaining = s[:i+1], s[i+1:]
-		}
-
-		const prefix = "// ¡ INSERT "
-		if !strings.HasPrefix(s, prefix) {
-			b.writes(s)
-		} else if f := m[s]; f == nil {
-			msg := []byte(fmt.Sprintf("unrecognized line %q, want one of:\n", s))
-			keys := []string(nil)
-			for k := range m {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-			for _, k := range keys {
-				msg = append(msg, '\t')
-				msg = append(msg, k...)
-			}
-			return errors.New(string(msg))
-		} else if err := f(b); err != nil {
-			return err
-		}
-
-		if remaining == "" {
-			break
-		}
-		s = remaining
-	}
-	return nil
-}
-
 func insertBaseAllPrivateH(buf *buffer) error {
 	buf.writes(embedBaseFundamentalPrivateH.Trim())
 	buf.writeb('\n')
@@ -299,8 +518,8 @@ func insertBaseAllPrivateH(buf *buffer) error {
 }
 
 func insertBaseAllPublicH(buf *buffer) error {
-	if err := expandBangInsert(buf, embedBaseFundamentalPublicH.Trim(), map[string]func(*buffer) error{
-		"// ¡ INSERT FourCCs.\n": func(b *buffer) error {
+	if err := expandTemplate(buf, "base/fundamental-public.h", embedBaseFundamentalPublicH.Trim(), templateSections{
+		"FourCCs": func(b *buffer) error {
 			for i, z := range builtin.FourCCs {
 				if i != 0 {
 					b.writeb('\n')
@@ -316,7 +535,7 @@ func insertBaseAllPublicH(buf *buffer) error {
 			}
 			return nil
 		},
-		"// ¡ INSERT Quirks.\n": func(b *buffer) error {
+		"Quirks": func(b *buffer) error {
 			first := true
 			for _, z := range builtin.Consts {
 				if (z.Name == "") || (z.Name[0] != 'Q') || !strings.HasPrefix(z.Name, "QUIRK_") {
@@ -331,7 +550,7 @@ func insertBaseAllPublicH(buf *buffer) error {
 			}
 			return nil
 		},
-		"// ¡ INSERT wuffs_base__status names.\n": func(b *buffer) error {
+		"wuffs_base__status names": func(b *buffer) error {
 			for _, z := range builtin.Statuses {
 				msg, _ := t.Unescape(z)
 				if msg == "" {
@@ -343,11 +562,11 @@ func insertBaseAllPublicH(buf *buffer) error {
 				} else if statusMsgIsSuspension(msg) {
 					pre = "suspension"
 				}
-				b.printf("extern const char wuffs_base__%s__%s[];\n", pre, cName(msg, ""))
+				b.printf("extern WUFFS_BASE__DLL_API const char wuffs_base__%s__%s[];\n", pre, cName(msg, ""))
 			}
 			return nil
 		},
-	}); err != nil {
+	}, nil); err != nil {
 		return err
 	}
 	buf.writeb('\n')
@@ -433,7 +652,7 @@ func insertInterfaceDeclarations(buf *buffer) error {
 
 		qid := t.QID{t.IDBase, builtInTokenMap.ByName(n)}
 
-		buf.printf("extern const char wuffs_base__%s__vtable_name[];\n\n", n)
+		buf.printf("extern WUFFS_BASE__DLL_API const char wuffs_base__%s__vtable_name[];\n\n", n)
 
 		buf.printf("typedef struct wuffs_base__%s__func_ptrs__struct {\n", n)
 		for _, f := range builtInInterfaceMethods[qid] {
@@ -561,25 +780,31 @@ func insertInterfaceDefinitions(buf *buffer) error {
 	return nil
 }
 
+// builtInTokenMap and builtInInterfaceMethods are set once, by
+// parseBuiltInInterfaceMethods, and are read-only afterwards.
 var (
 	builtInTokenMap         = t.Map{}
 	builtInInterfaceMethods = map[t.QID][]*a.Func{}
+
+	builtInInterfaceMethodsOnce sync.Once
+	builtInInterfaceMethodsErr  error
 )
 
 func parseBuiltInInterfaceMethods() error {
-	if len(builtInInterfaceMethods) != 0 {
-		return nil
-	}
-	return builtin.ParseFuncs(&builtInTokenMap, builtin.InterfaceFuncs, func(f *a.Func) error {
-		qid := f.Receiver()
-		builtInInterfaceMethods[qid] = append(builtInInterfaceMethods[qid], f)
-		return nil
+	builtInInterfaceMethodsOnce.Do(func() {
+		builtInInterfaceMethodsErr = builtin.ParseFuncs(&builtInTokenMap, builtin.InterfaceFuncs, func(f *a.Func) error {
+			qid := f.Receiver()
+			builtInInterfaceMethods[qid] = append(builtInInterfaceMethods[qid], f)
+			return nil
+		})
 	})
+	return builtInInterfaceMethodsErr
 }
 
 type gen struct {
 	PKGPREFIX string // e.g. "WUFFS_JPEG__"
 	PKGNAME   string // e.g. "JPEG"
+	GUARDNAME string // e.g. "JPEG", or "MYAPP_JPEG" for a "myapp_jpeg" prefix
 	pkgPrefix string // e.g. "wuffs_jpeg__"
 	pkgName   string // e.g. "jpeg"
 
@@ -592,13 +817,60 @@ type gen struct {
 	// generated C code (due to line numbers changing) when editing Wuffs code.
 	genlinenum bool
 
+	// linedirectives is whether to print "#line 123 \"foo.wuffs\"" directives
+	// in the generated C code, so that C compiler warnings, debuggers and
+	// profilers refer to the Wuffs source code. Like genlinenum, it is not
+	// enabled by default.
+	linedirectives bool
+
+	// nomalloc is whether the generated C code must not allocate heap memory.
+	// It omits the wuffs_foo__bar__alloc functions and instead defines
+	// macros for upper bounds on the public structs' sizes.
+	nomalloc bool
+
+	// threadSafety is whether public coroutines check a private_impl.busy
+	// field, returning an error (instead of clobbering the coroutine state)
+	// if re-entered while another call is in progress, and whether the public
+	// function prototypes have clang thread safety attributes.
+	threadSafety bool
+
+	// opaqueStructs is whether the structs' definitions are hidden from the
+	// public header's C and C++ users alike, so that their layout can change
+	// without breaking those users. The header instead defines upper bounds
+	// on their sizes and alignments and declares alignof__wuffs_foo__bar and
+	// wuffs_foo__bar__initialize_storage functions, for callers that don't
+	// use wuffs_foo__bar__alloc.
+	opaqueStructs bool
+
+	// target is the C macro, from cTargets, that the generated code defines
+	// (before including the base package) to select how it loads and stores
+	// multi-byte integers. If empty, the base package chooses.
+	target string
+
+	// buildMetadata, if non-nil, is what the generated header records about
+	// how it was generated, for the -build_metadata flag.
+	buildMetadata *buildMetadata
+
+	// tests is whether to also generate the package's test funcs, and the
+	// funcs and consts that only they reach, for a -test_target program.
+	tests bool
+
 	privateDataFields map[t.QQID]struct{}
+	reachableConsts   map[t.QID]struct{}
+	reachableFuncs    map[t.QQID]struct{}
 	scalarConstsMap   map[t.QID]*a.Const
 	statusList        []status
 	statusMap         map[t.QID]status
 	structList        []*a.Struct
 	structMap         map[t.QID]*a.Struct
 
+	// flatFuncs are the funcs whose calls can be replaced by their bodies.
+	// cCalledFuncs are the funcs that at least one C function call (that
+	// wasn't flattened) calls. A flatFunc that isn't a cCalledFunc is
+	// omitted from the generated code.
+	flatFuncs    map[t.QQID]*flatFunc
+	cCalledFuncs map[t.QQID]struct{}
+
 	currFunk funk
 	funks    map[t.QQID]funk
 
@@ -608,63 +880,53 @@ type gen struct {
 func (g *gen) generate() ([]byte, error) {
 	b := new(buffer)
 
-	g.statusMap = map[t.QID]status{}
-	if err := g.forEachStatus(b, bothPubPri, (*gen).gatherStatuses); err != nil {
+	p, err := lower.Lower(g.pkgName, g.tm, g.files)
+	if err != nil {
 		return nil, err
 	}
-	for _, z := range builtin.Statuses {
-		id, err := g.tm.Insert(z)
-		if err != nil {
-			return nil, err
-		}
-		msg, _ := t.Unescape(z)
-		if msg == "" {
-			return nil, fmt.Errorf("bad built-in status %q", z)
-		}
-		if err := g.addStatus(t.QID{t.IDBase, id}, msg, true); err != nil {
+	g.statusMap = map[t.QID]status{}
+	for _, z := range p.Statuses {
+		g.addStatus(z)
+	}
+	if g.threadSafety {
+		g.statusList = append(g.statusList, status{
+			cName:       g.concurrentCallsCName(),
+			msg:         "#concurrent coroutine calls",
+			fromThisPkg: true,
+			public:      true,
+		})
+	}
+	g.scalarConstsMap = p.ScalarConsts
+	g.structList = p.Structs
+	g.structMap = p.StructMap
+	g.privateDataFields = p.PrivateDataFields
+	g.reachableConsts = p.ReachableConsts
+	if g.tests {
+		if err := p.IncludeTests(); err != nil {
 			return nil, err
 		}
 	}
-
-	g.scalarConstsMap = map[t.QID]*a.Const{}
-	if err := g.forEachConst(b, bothPubPri, (*gen).gatherScalarConsts); err != nil {
-		return nil, err
-	}
-
-	// Make a topologically sorted list of structs.
-	unsortedStructs := []*a.Struct(nil)
-	for _, file := range g.files {
-		for _, tld := range file.TopLevelDecls() {
-			if tld.Kind() == a.KStruct {
-				unsortedStructs = append(unsortedStructs, tld.AsStruct())
-			}
-		}
-	}
-	var ok bool
-	g.structList, ok = a.TopologicalSortStructs(unsortedStructs)
-	if !ok {
-		return nil, fmt.Errorf("cyclical struct definitions")
-	}
-	g.structMap = map[t.QID]*a.Struct{}
-	g.privateDataFields = map[t.QQID]struct{}{}
+	g.reachableFuncs = p.ReachableFuncs
 	g.numPublicCoroutines = map[t.QID]uint32{}
-	for _, n := range g.structList {
-		qid := n.QID()
-		g.structMap[qid] = n
-		for _, f := range n.Fields() {
-			f := f.AsField()
-			if f.PrivateData() {
-				g.privateDataFields[t.QQID{qid[0], qid[1], f.Name()}] = struct{}{}
-			}
+
+	if g.buildMetadata != nil {
+		if err := g.checkBuildMetadataNames(); err != nil {
+			return nil, err
 		}
 	}
 
+	g.findFlatFuncs()
 	g.funks = map[t.QQID]funk{}
 	if err := g.forEachFunc(nil, bothPubPri, (*gen).gatherFuncImpl); err != nil {
 		return nil, err
 	}
+	for qqid := range g.flatFuncs {
+		if _, ok := g.cCalledFuncs[qqid]; !ok {
+			delete(g.reachableFuncs, qqid)
+		}
+	}
 
-	includeGuard := "WUFFS_INCLUDE_GUARD__" + g.PKGNAME
+	includeGuard := "WUFFS_INCLUDE_GUARD__" + g.GUARDNAME
 	b.printf("#ifndef %s\n#define %s\n\n", includeGuard, includeGuard)
 
 	if err := g.genIncludes(b); err != nil {
@@ -700,6 +962,15 @@ func (g *gen) genIncludes(b *buffer) error {
 	b.writes("#define WUFFS_NONMONOLITHIC\n")
 	b.writes("#endif\n\n")
 
+	if g.target != "" {
+		b.writes("// This package was generated with \"wuffs-c gen -target\", which selects\n")
+		b.writes("// the base package's implementation of its multi-byte loads and stores.\n")
+		b.writes("// The base package must not already be included with a different one.\n")
+		b.printf("#if !defined(%s)\n", g.target)
+		b.printf("#define %s\n", g.target)
+		b.writes("#endif\n\n")
+	}
+
 	usesList := []string(nil)
 	usesMap := map[string]struct{}{}
 
@@ -737,6 +1008,10 @@ func (g *gen) genHeader(b *buffer) error {
 		") || defined(WUFFS_NONMONOLITHIC)"
 	b.printf("#if %s\n\n", module)
 
+	if g.buildMetadata != nil {
+		g.writeBuildMetadataDecls(b)
+	}
+
 	b.writes("// ---------------- Status Codes\n\n")
 
 	wroteStatus := false
@@ -744,7 +1019,7 @@ func (g *gen) genHeader(b *buffer) error {
 		if !z.fromThisPkg || !z.public {
 			continue
 		}
-		b.printf("extern const char %s[];\n", z.cName)
+		b.printf("extern WUFFS_BASE__DLL_API const char %s[];\n", z.cName)
 		wroteStatus = true
 	}
 	if wroteStatus {
@@ -759,9 +1034,14 @@ func (g *gen) genHeader(b *buffer) error {
 	b.writes("// ---------------- Struct Declarations\n\n")
 	for _, n := range g.structList {
 		structName := n.QID().Str(g.tm)
+		writeDocComment(b, n.Doc())
 		b.printf("typedef struct %s%s__struct %s%s;\n\n", g.pkgPrefix, structName, g.pkgPrefix, structName)
 	}
 
+	if g.threadSafety {
+		g.writeThreadSafetyDecls(b)
+	}
+
 	b.writes("#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
 
 	b.writes("// ---------------- Public Initializer Prototypes\n\n")
@@ -778,30 +1058,57 @@ func (g *gen) genHeader(b *buffer) error {
 		}
 	}
 
-	b.writes("// ---------------- Allocs\n\n")
-
-	b.writes("// These functions allocate and initialize Wuffs structs. They return NULL if\n")
-	b.writes("// memory allocation fails. If they return non-NULL, there is no need to call\n")
-	b.writes("// wuffs_foo__bar__initialize, but the caller is responsible for eventually\n")
-	b.writes("// calling free on the returned pointer. That pointer is effectively a C++\n")
-	b.writes("// std::unique_ptr<T, wuffs_unique_ptr_deleter>.\n\n")
-
-	for _, n := range g.structList {
-		if !n.Public() {
-			continue
+	if g.nomalloc || g.opaqueStructs {
+		b.writes("// ---------------- Struct Sizes\n\n")
+		if g.nomalloc {
+			b.writes("// This package was generated with \"wuffs-c gen -nomalloc\". It never\n")
+			b.writes("// allocates heap memory and there are no wuffs_foo__bar__alloc functions.\n")
+			b.writes("// Instead, callers can statically allocate (aligned) storage for a\n")
+			b.writes("// wuffs_foo__bar that is WUFFS_FOO__BAR_STRUCT_SIZE_MAX_INCL_WORST_CASE bytes\n")
+			b.writes("// long, then pass sizeof__wuffs_foo__bar() to wuffs_foo__bar__initialize.\n")
+			b.writes("// Any used packages must also be generated with -nomalloc.\n\n")
 		}
-		if err := g.writeAllocSignature(b, n); err != nil {
+		if g.opaqueStructs {
+			b.writes("// This package was generated with \"wuffs-c gen -opaque_structs\". Its\n")
+			b.writes("// structs are incomplete types, even in C++, unless WUFFS_IMPLEMENTATION is\n")
+			b.writes("// #define'd. Callers that don't use the wuffs_foo__bar__alloc functions can\n")
+			b.writes("// instead provide storage for a wuffs_foo__bar that is at least\n")
+			b.writes("// WUFFS_FOO__BAR_STRUCT_SIZE_MAX_INCL_WORST_CASE bytes long and aligned to\n")
+			b.writes("// WUFFS_FOO__BAR_STRUCT_ALIGN_MAX bytes (or, exactly, sizeof__wuffs_foo__bar()\n")
+			b.writes("// and alignof__wuffs_foo__bar()), then pass it to\n")
+			b.writes("// wuffs_foo__bar__initialize_storage. Any used packages must also be\n")
+			b.writes("// generated with -opaque_structs or -nomalloc.\n\n")
+		}
+		if err := g.writeStructSizes(b); err != nil {
 			return err
 		}
-		b.writes(";\n\n")
-		structName := n.QID().Str(g.tm)
-		for _, impl := range n.Implements() {
-			iQID := impl.AsTypeExpr().QID()
-			iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
-			b.printf("static inline %s*\n", iName)
-			b.printf("%s%s__alloc_as__%s(void) {\n", g.pkgPrefix, structName, iName)
-			b.printf("return (%s*)(%s%s__alloc());\n", iName, g.pkgPrefix, structName)
-			b.printf("}\n\n")
+	}
+	if !g.nomalloc {
+		b.writes("// ---------------- Allocs\n\n")
+
+		b.writes("// These functions allocate and initialize Wuffs structs. They return NULL if\n")
+		b.writes("// memory allocation fails. If they return non-NULL, there is no need to call\n")
+		b.writes("// wuffs_foo__bar__initialize, but the caller is responsible for eventually\n")
+		b.writes("// calling free on the returned pointer. That pointer is effectively a C++\n")
+		b.writes("// std::unique_ptr<T, wuffs_unique_ptr_deleter>.\n\n")
+
+		for _, n := range g.structList {
+			if !n.Public() {
+				continue
+			}
+			if err := g.writeAllocSignature(b, n); err != nil {
+				return err
+			}
+			b.writes(";\n\n")
+			structName := n.QID().Str(g.tm)
+			for _, impl := range n.Implements() {
+				iQID := impl.AsTypeExpr().QID()
+				iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
+				b.printf("static inline %s*\n", iName)
+				b.printf("%s%s__alloc_as__%s(void) {\n", g.pkgPrefix, structName, iName)
+				b.printf("return (%s*)(%s%s__alloc());\n", iName, g.pkgPrefix, structName)
+				b.printf("}\n\n")
+			}
 		}
 	}
 
@@ -823,22 +1130,31 @@ func (g *gen) genHeader(b *buffer) error {
 	if err := g.forEachFunc(b, pubOnly, (*gen).writeFuncPrototype); err != nil {
 		return err
 	}
+	if g.buildMetadata != nil {
+		g.writeBuildMetadataPrototype(b)
+	}
 
 	b.writes("#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n\n")
 
+	guard := "defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)"
 	b.writes("// ---------------- Struct Definitions\n\n")
 	b.writes("// These structs' fields, and the sizeof them, are private implementation\n")
 	b.writes("// details that aren't guaranteed to be stable across Wuffs versions.\n")
+	if g.opaqueStructs {
+		guard = "defined(WUFFS_IMPLEMENTATION)"
+		b.writes("// This package was generated with -opaque_structs, so C++ callers don't\n")
+		b.writes("// see them either.\n")
+	}
 	b.writes("//\n")
 	b.writes("// See https://en.wikipedia.org/wiki/Opaque_pointer#C\n\n")
-	b.writes("#if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)\n\n")
+	b.printf("#if %s\n\n", guard)
 
 	for _, n := range g.structList {
 		if err := g.writeStruct(b, n); err != nil {
 			return err
 		}
 	}
-	b.writes("#endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)\n\n")
+	b.printf("#endif  // %s\n\n", guard)
 
 	b.printf("#endif  // %s\n", module)
 	return nil
@@ -895,6 +1211,10 @@ func (g *gen) genImpl(b *buffer) error {
 		}
 	}
 
+	if g.buildMetadata != nil {
+		g.writeBuildMetadataImpl(b)
+	}
+
 	b.writes("// ---------------- Function Implementations\n\n")
 	if err := g.forEachFunc(b, bothPubPri, (*gen).writeFuncImpl); err != nil {
 		return err
@@ -936,22 +1256,6 @@ func (g *gen) forEachFunc(b *buffer, v visibility, f func(*gen, *buffer, *a.Func
 	return nil
 }
 
-func (g *gen) forEachStatus(b *buffer, v visibility, f func(*gen, *buffer, *a.Status) error) error {
-	for _, file := range g.files {
-		for _, tld := range file.TopLevelDecls() {
-			if tld.Kind() != a.KStatus ||
-				((v == pubOnly) && !tld.AsStatus().Public()) ||
-				((v == priOnly) && tld.AsStatus().Public()) {
-				continue
-			}
-			if err := f(g, b, tld.AsStatus()); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
 func (g *gen) findAstFunc(qqid t.QQID) *a.Func {
 	for _, file := range g.files {
 		for _, tld := range file.TopLevelDecls() {
@@ -1004,6 +1308,34 @@ func uintBits(qid t.QID) uint32 {
 	return 0
 }
 
+func intBits(qid t.QID) uint32 {
+	if qid[0] == t.IDBase {
+		switch qid[1] {
+		case t.IDI8:
+			return 8
+		case t.IDI16:
+			return 16
+		case t.IDI32:
+			return 32
+		case t.IDI64:
+			return 64
+		}
+	}
+	return 0
+}
+
+// signedModOperandCast returns the C cast that converts an iBits-bit signed
+// integer to the unsigned type that "~mod+", "~mod-" and "~mod*" do their
+// arithmetic in. Narrower than 32 bits, a uint8_t or uint16_t would be
+// promoted to (signed) int, and e.g. 0xFFFF * 0xFFFF overflows an int, so
+// those operands are widened to uint32_t.
+func signedModOperandCast(iBits uint32) string {
+	if iBits < 32 {
+		return fmt.Sprintf("(uint32_t)(uint%d_t)", iBits)
+	}
+	return fmt.Sprintf("(uint%d_t)", iBits)
+}
+
 func (g *gen) sizeof(typ *a.TypeExpr) (uint32, error) {
 	if typ.Decorator() == 0 {
 		if n := uintBits(typ.QID()); n != 0 {
@@ -1013,42 +1345,38 @@ func (g *gen) sizeof(typ *a.TypeExpr) (uint32, error) {
 	return 0, fmt.Errorf("unknown sizeof for %q", typ.Str(g.tm))
 }
 
-func (g *gen) gatherStatuses(b *buffer, n *a.Status) error {
-	raw := n.QID()[1].Str(g.tm)
-	msg, ok := t.Unescape(raw)
-	if !ok || msg == "" {
-		return fmt.Errorf("bad status message %q", raw)
+func (g *gen) addStatus(z lower.Status) {
+	c := status{
+		cName:       g.packagePrefix(z.QID) + z.Category() + "__" + z.Name(),
+		msg:         z.Msg,
+		fromThisPkg: z.FromThisPkg(),
+		public:      z.Public,
 	}
-	return g.addStatus(n.QID(), msg, n.Public())
+	g.statusList = append(g.statusList, c)
+	g.statusMap[z.QID] = c
 }
 
-func (g *gen) addStatus(qid t.QID, msg string, public bool) error {
-	category := "note__"
-	if msg[0] == '$' {
-		category = "suspension__"
-	} else if msg[0] == '#' {
-		category = "error__"
-	}
-	z := status{
-		cName:       g.packagePrefix(qid) + category + cName(msg, ""),
-		msg:         msg,
-		fromThisPkg: qid[0] == 0,
-		public:      public,
-	}
-	g.statusList = append(g.statusList, z)
-	g.statusMap[qid] = z
-	return nil
-}
-
-func (g *gen) gatherScalarConsts(b *buffer, n *a.Const) error {
-	if cv := n.Value().ConstValue(); cv != nil {
-		g.scalarConstsMap[n.QID()] = n
+// writeDocComment writes a Wuffs "///" doc comment, such as that returned by
+// Func.Doc, as a C "//" comment.
+func writeDocComment(b *buffer, doc []string) {
+	for _, line := range doc {
+		b.writes("//")
+		b.writes(strings.TrimPrefix(line, "///"))
+		b.writeb('\n')
 	}
-	return nil
 }
 
 func (g *gen) writeConst(b *buffer, n *a.Const) error {
-	if cv := n.Value().ConstValue(); cv != nil {
+	cv := n.Value().ConstValue()
+	if (cv == nil) && !n.Public() {
+		if _, ok := g.reachableConsts[n.QID()]; !ok {
+			// Omit private tables that no reachable func refers to.
+			return nil
+		}
+	}
+
+	writeDocComment(b, n.Doc())
+	if cv != nil {
 		suffix := ""
 		if cv.Sign() >= 0 {
 			suffix = "u"
@@ -1101,9 +1429,13 @@ func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
 	b.writes("// can be stack allocated when WUFFS_IMPLEMENTATION is defined.\n\n")
 
 	b.writes("struct {\n")
+	implLenB1 := len(*b)
 	if n.Classy() {
 		b.writes("uint32_t magic;\n")
 		b.writes("uint32_t active_coroutine;\n")
+		if g.threadSafety {
+			b.writes("uint32_t busy;\n")
+		}
 		for _, impl := range n.Implements() {
 			qid := impl.AsTypeExpr().QID()
 			b.printf("wuffs_base__vtable vtable_for__wuffs_%s__%s;\n",
@@ -1159,6 +1491,12 @@ func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
 			}
 		}
 	}
+	if implLenB1 == len(*b) {
+		// C (unlike C++) doesn't allow empty structs, and sizeof an empty
+		// struct can differ across compilers. Like wuffs_base__empty_struct,
+		// insert an otherwise unused field.
+		b.writes("uint8_t placeholder;\n")
+	}
 	b.writes("} private_impl;\n\n")
 
 	{
@@ -1251,23 +1589,25 @@ func (g *gen) writeCppMethods(b *buffer, n *a.Struct) error {
 	fullStructName := g.pkgPrefix + structName + "__struct"
 	b.writes("#ifdef __cplusplus\n")
 
-	b.writes("#if defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n")
-	b.printf("using unique_ptr = std::unique_ptr<%s%s, wuffs_unique_ptr_deleter>;\n\n", g.pkgPrefix, structName)
-	b.writes("// On failure, the alloc_etc functions return nullptr. They don't throw.\n\n")
-	b.writes("static inline unique_ptr\n")
-	b.writes("alloc() {\n")
-	b.printf("return unique_ptr(%s%s__alloc());\n", g.pkgPrefix, structName)
-	b.writes("}\n")
-	for _, impl := range n.Implements() {
-		iQID := impl.AsTypeExpr().QID()
-		iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
-		b.printf("\nstatic inline %s::unique_ptr\n", iName)
-		b.printf("alloc_as__%s() {\n", iName)
-		b.printf("return %s::unique_ptr(\n%s%s__alloc_as__%s());\n",
-			iName, g.pkgPrefix, structName, iName)
-		b.printf("}\n")
+	if !g.nomalloc {
+		b.writes("#if defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n")
+		b.printf("using unique_ptr = std::unique_ptr<%s%s, wuffs_unique_ptr_deleter>;\n\n", g.pkgPrefix, structName)
+		b.writes("// On failure, the alloc_etc functions return nullptr. They don't throw.\n\n")
+		b.writes("static inline unique_ptr\n")
+		b.writes("alloc() {\n")
+		b.printf("return unique_ptr(%s%s__alloc());\n", g.pkgPrefix, structName)
+		b.writes("}\n")
+		for _, impl := range n.Implements() {
+			iQID := impl.AsTypeExpr().QID()
+			iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
+			b.printf("\nstatic inline %s::unique_ptr\n", iName)
+			b.printf("alloc_as__%s() {\n", iName)
+			b.printf("return %s::unique_ptr(\n%s%s__alloc_as__%s());\n",
+				iName, g.pkgPrefix, structName, iName)
+			b.printf("}\n")
+		}
+		b.writes("#endif  // defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
 	}
-	b.writes("#endif  // defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
 
 	b.writes("#if defined(WUFFS_BASE__HAVE_EQ_DELETE) && !defined(WUFFS_IMPLEMENTATION)\n")
 	b.writes("// Disallow constructing or copying an object via standard C++ mechanisms,\n")
@@ -1327,6 +1667,7 @@ func (g *gen) writeCppMethods(b *buffer, n *a.Struct) error {
 			if err := g.writeFuncSignature(b, f, wfsCppDecl); err != nil {
 				return err
 			}
+			g.writeThreadSafetyRequires(b, f, "this")
 			b.writes(" {\n    return ")
 			b.writes(g.funcCName(f))
 			b.writes("(this")
@@ -1384,6 +1725,9 @@ func (g *gen) writeVTableImpl(b *buffer, n *a.Struct) error {
 
 func (g *gen) writeInitializerSignature(b *buffer, n *a.Struct, public bool) error {
 	structName := n.QID().Str(g.tm)
+	if public {
+		b.writes("WUFFS_BASE__DLL_API ")
+	}
 	b.printf("wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT\n"+
 		"%s%s__initialize(\n"+
 		"    %s%s* self,\n"+
@@ -1396,13 +1740,31 @@ func (g *gen) writeInitializerSignature(b *buffer, n *a.Struct, public bool) err
 
 func (g *gen) writeAllocSignature(b *buffer, n *a.Struct) error {
 	structName := n.QID().Str(g.tm)
-	b.printf("%s%s*\n%s%s__alloc(void)", g.pkgPrefix, structName, g.pkgPrefix, structName)
+	b.printf("WUFFS_BASE__DLL_API %s%s*\n%s%s__alloc(void)", g.pkgPrefix, structName, g.pkgPrefix, structName)
 	return nil
 }
 
 func (g *gen) writeSizeofSignature(b *buffer, n *a.Struct) error {
 	structName := n.QID().Str(g.tm)
-	b.printf("size_t\nsizeof__%s%s(void)", g.pkgPrefix, structName)
+	b.printf("WUFFS_BASE__DLL_API size_t\nsizeof__%s%s(void)", g.pkgPrefix, structName)
+	return nil
+}
+
+func (g *gen) writeAlignofSignature(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	b.printf("WUFFS_BASE__DLL_API size_t\nalignof__%s%s(void)", g.pkgPrefix, structName)
+	return nil
+}
+
+func (g *gen) writeInitializeStorageSignature(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	b.printf("WUFFS_BASE__DLL_API wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT\n"+
+		"%s%s__initialize_storage(\n"+
+		"    void* storage,\n"+
+		"    size_t storage_len,\n"+
+		"    uint64_t wuffs_version,\n"+
+		"    uint32_t options)",
+		g.pkgPrefix, structName)
 	return nil
 }
 
@@ -1421,6 +1783,17 @@ func (g *gen) writeInitializerPrototype(b *buffer, n *a.Struct) error {
 		}
 		b.writes(";\n\n")
 	}
+
+	if n.Public() && g.opaqueStructs {
+		if err := g.writeAlignofSignature(b, n); err != nil {
+			return err
+		}
+		b.writes(";\n\n")
+		if err := g.writeInitializeStorageSignature(b, n); err != nil {
+			return err
+		}
+		b.writes(";\n\n")
+	}
 	return nil
 }
 
@@ -1529,8 +1902,12 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 	b.writes("return wuffs_base__make_status(NULL);\n")
 	b.writes("}\n\n")
 
-	if n.Public() {
-		structName := n.QID().Str(g.tm)
+	if !n.Public() {
+		return nil
+	}
+	structName := n.QID().Str(g.tm)
+
+	if !g.nomalloc {
 		if err := g.writeAllocSignature(b, n); err != nil {
 			return err
 		}
@@ -1544,11 +1921,56 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 		b.writes("free(x);\nreturn NULL;\n}\n")
 		b.writes("return x;\n")
 		b.writes("}\n\n")
+	}
 
-		if err := g.writeSizeofSignature(b, n); err != nil {
-			return err
-		}
-		b.printf(" {\nreturn sizeof(%s%s);\n}\n\n", g.pkgPrefix, structName)
+	if err := g.writeSizeofSignature(b, n); err != nil {
+		return err
+	}
+	b.printf(" {\nreturn sizeof(%s%s);\n}\n\n", g.pkgPrefix, structName)
+
+	if g.nomalloc || g.opaqueStructs {
+		// Check, at C compile time, that the header's upper bound holds.
+		b.printf("typedef char %s%s__struct_size_check[\n", g.pkgPrefix, structName)
+		b.printf("(sizeof(%s%s) <= %s%s) ? 1 : -1];\n\n",
+			g.pkgPrefix, structName, g.PKGPREFIX, strings.ToUpper(structName)+structSizeMacroSuffix)
+	}
+
+	if g.opaqueStructs {
+		return g.writeInitializeStorageImpl(b, n)
+	}
+	return nil
+}
+
+// writeInitializeStorageImpl writes the alignof__wuffs_foo__bar and
+// wuffs_foo__bar__initialize_storage functions for -opaque_structs callers,
+// who can't apply sizeof (or C11's alignof) to the incomplete type.
+func (g *gen) writeInitializeStorageImpl(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	helper := g.pkgPrefix + structName + "__alignof_helper"
+
+	// The offset of x in a "struct { char c; T x; }" is T's alignment.
+	b.printf("struct %s {\nchar c;\n%s%s x;\n};\n\n", helper, g.pkgPrefix, structName)
+	b.printf("typedef char %s%s__struct_align_check[\n", g.pkgPrefix, structName)
+	b.printf("(offsetof(struct %s, x) <= %s%s) ? 1 : -1];\n\n",
+		helper, g.PKGPREFIX, strings.ToUpper(structName)+structAlignMacroSuffix)
+
+	if err := g.writeAlignofSignature(b, n); err != nil {
+		return err
 	}
+	b.printf(" {\nreturn offsetof(struct %s, x);\n}\n\n", helper)
+
+	if err := g.writeInitializeStorageSignature(b, n); err != nil {
+		return err
+	}
+	b.writes(" {\n")
+	b.printf("if (!storage || ((((uintptr_t)storage) %% alignof__%s%s()) != 0)) {\n", g.pkgPrefix, structName)
+	b.writes("  return wuffs_base__make_status(wuffs_base__error__bad_receiver);\n")
+	b.writes("}\n")
+	b.printf("if (storage_len < sizeof(%s%s)) {\n", g.pkgPrefix, structName)
+	b.writes("  return wuffs_base__make_status(wuffs_base__error__bad_sizeof_receiver);\n")
+	b.writes("}\n")
+	b.printf("return %s%s__initialize(\n(%s%s*)storage, sizeof(%s%s), wuffs_version, options);\n",
+		g.pkgPrefix, structName, g.pkgPrefix, structName, g.pkgPrefix, structName)
+	b.writes("}\n\n")
 	return nil
 }
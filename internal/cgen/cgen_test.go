@@ -0,0 +1,126 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeterministicOutput(tt *testing.T) {
+	const src = "" +
+		"pub status \"#bad foo\"\n" +
+		"pub status \"@note foo\"\n" +
+		"pri status \"#internal error\"\n" +
+		"\n" +
+		"pub const FOO_A : base.u32 = 1\n" +
+		"pub const FOO_B : base.u32 = 2\n" +
+		"\n" +
+		"pub struct alpha?(\n" +
+		"\tn : base.u32,\n" +
+		")\n" +
+		"\n" +
+		"pub struct beta?(\n" +
+		"\tm : base.u64,\n" +
+		"\tb : array[4] base.u8,\n" +
+		")\n" +
+		"\n" +
+		"pub func alpha.get() base.u32 {\n" +
+		"\treturn this.n\n" +
+		"}\n" +
+		"\n" +
+		"pub func beta.get() base.u64 {\n" +
+		"\treturn this.m\n" +
+		"}\n" +
+		"\n" +
+		"pub func beta.run?(src: base.io_reader) {\n" +
+		"\tthis.m = args.src.read_u64le?()\n" +
+		"}\n"
+
+	pkgDir := filepath.Join(tt.TempDir(), "foo")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		tt.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkgDir, "foo.wuffs"), []byte(src), 0644); err != nil {
+		tt.Fatal(err)
+	}
+
+	outs := [][]byte(nil)
+	for i := 0; i < 4; i++ {
+		outDir := tt.TempDir()
+		if err := Do([]string{"-outdir", outDir, "-nomalloc", pkgDir}); err != nil {
+			tt.Fatalf("Do: %v", err)
+		}
+		out, err := os.ReadFile(filepath.Join(outDir, "wuffs-foo.c"))
+		if err != nil {
+			tt.Fatal(err)
+		}
+		outs = append(outs, out)
+	}
+	for i := 1; i < len(outs); i++ {
+		if !bytes.Equal(outs[0], outs[i]) {
+			tt.Fatalf("output #%d differs from output #0", i)
+		}
+	}
+}
+
+func TestConcurrentOutput(tt *testing.T) {
+	pkgs := []string{"std/adler32", "std/crc32", "std/deflate", "std/gzip", "std/zlib"}
+	args := []string{"-pkgpath", filepath.Join("..", "..")}
+	for _, p := range pkgs {
+		args = append(args, filepath.Join("..", "..", filepath.FromSlash(p)))
+	}
+
+	outDirs := [2]string{}
+	for i, jobs := range [2]string{"1", "4"} {
+		outDirs[i] = tt.TempDir()
+		if err := Do(append([]string{"-jobs", jobs, "-outdir", outDirs[i]}, args...)); err != nil {
+			tt.Fatalf("-jobs %s: Do: %v", jobs, err)
+		}
+	}
+
+	for _, p := range pkgs {
+		filename := "wuffs-" + strings.Replace(p, "/", "-", -1) + ".c"
+		out0, err := os.ReadFile(filepath.Join(outDirs[0], filename))
+		if err != nil {
+			tt.Fatal(err)
+		}
+		out1, err := os.ReadFile(filepath.Join(outDirs[1], filename))
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if !bytes.Equal(out0, out1) {
+			tt.Errorf("%s: -jobs 4 output differs from -jobs 1 output", filename)
+		}
+	}
+}
+
+func TestSignedModOperandCast(tt *testing.T) {
+	testCases := []struct {
+		iBits uint32
+		want  string
+	}{
+		// 0xFFFF * 0xFFFF would overflow a (promoted) int.
+		{8, "(uint32_t)(uint8_t)"},
+		{16, "(uint32_t)(uint16_t)"},
+		{32, "(uint32_t)"},
+		{64, "(uint64_t)"},
+	}
+
+	for _, tc := range testCases {
+		if got := signedModOperandCast(tc.iBits); got != tc.want {
+			tt.Errorf("iBits=%d: got %q, want %q", tc.iBits, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// generateCppWrapper returns a header-only C++ wrapper for the package's
+// public structs. It must be called after generate, which populates
+// g.structList.
+//
+// Each wrapper class owns a heap-allocated C struct (RAII) and forwards its
+// methods on to the C functions. Status-returning methods either throw a
+// wuffs_cpp::error or, when WUFFS_CPP_WRAPPER__USE_EXPECTED is #define'd,
+// return a std::expected.
+func (g *gen) generateCppWrapper() ([]byte, error) {
+	b := new(buffer)
+
+	includeGuard := "WUFFS_CPP_WRAPPER__" + g.GUARDNAME
+	namespace := strings.ToLower(g.GUARDNAME)
+	b.printf("#ifndef %s\n#define %s\n\n", includeGuard, includeGuard)
+
+	b.writes("// This file is generated. It is a header-only C++ wrapper around the C\n")
+	b.printf("// API in wuffs-%s.c. It requires C++11, or C++23 when\n", g.pkgName)
+	b.writes("// WUFFS_CPP_WRAPPER__USE_EXPECTED is #define'd.\n\n")
+
+	b.writes("#if !defined(WUFFS_INCLUDE_GUARD)\n")
+	b.printf("#include \"./wuffs-%s.c\"\n", g.pkgName)
+	b.writes("#endif\n\n")
+
+	b.writes("#include <cstdlib>\n#include <memory>\n#include <new>\n#include <stdexcept>\n\n")
+	b.writes("#if defined(WUFFS_CPP_WRAPPER__USE_EXPECTED)\n#include <expected>\n#endif\n\n")
+
+	g.writeCppWrapperBase(b)
+
+	b.writes("namespace wuffs_cpp {\n")
+	b.printf("namespace %s {\n\n", namespace)
+	for _, n := range g.structList {
+		if !n.Public() {
+			continue
+		}
+		if err := g.writeCppWrapperClass(b, n); err != nil {
+			return nil, err
+		}
+	}
+	b.printf("}  // namespace %s\n", namespace)
+	b.writes("}  // namespace wuffs_cpp\n\n")
+
+	b.printf("#endif  // %s\n", includeGuard)
+	return *b, nil
+}
+
+// writeCppWrapperBase writes the package-independent part of the C++
+// wrapper. It is guarded so that it is only compiled once when including the
+// wrappers for more than one package.
+func (g *gen) writeCppWrapperBase(b *buffer) {
+	b.writes("#ifndef WUFFS_CPP_WRAPPER__BASE\n#define WUFFS_CPP_WRAPPER__BASE\n\n")
+	b.writes("namespace wuffs_cpp {\n\n")
+
+	b.writes("// error is thrown when a status-returning method fails, unless\n")
+	b.writes("// WUFFS_CPP_WRAPPER__USE_EXPECTED is #define'd.\n")
+	b.writes("class error : public std::runtime_error {\n")
+	b.writes("public:\n")
+	b.writes("explicit error(wuffs_base__status status)\n" +
+		": std::runtime_error(status.message() ? status.message() : \"\"),\n" +
+		"status_(status) {}\n\n")
+	b.writes("wuffs_base__status status() const { return status_; }\n\n")
+	b.writes("private:\n")
+	b.writes("wuffs_base__status status_;\n")
+	b.writes("};\n\n")
+
+	b.writes("const char error__out_of_memory[] = \"#wuffs_cpp: out of memory\";\n\n")
+
+	b.writes("#if defined(WUFFS_CPP_WRAPPER__USE_EXPECTED)\n")
+	b.writes("template <typename T>\n")
+	b.writes("using result = std::expected<T, wuffs_base__status>;\n\n")
+	b.writes("inline result<wuffs_base__status>\n")
+	b.writes("check_status(wuffs_base__status status) {\n")
+	b.writes("if (status.is_error()) {\n")
+	b.writes("return std::unexpected(status);\n")
+	b.writes("}\n")
+	b.writes("return status;\n")
+	b.writes("}\n")
+	b.writes("#else\n")
+	b.writes("template <typename T>\n")
+	b.writes("using result = T;\n\n")
+	b.writes("inline result<wuffs_base__status>\n")
+	b.writes("check_status(wuffs_base__status status) {\n")
+	b.writes("if (status.is_error()) {\n")
+	b.writes("throw error(status);\n")
+	b.writes("}\n")
+	b.writes("return status;\n")
+	b.writes("}\n")
+	b.writes("#endif  // defined(WUFFS_CPP_WRAPPER__USE_EXPECTED)\n\n")
+
+	b.writes("}  // namespace wuffs_cpp\n\n")
+	b.writes("#endif  // WUFFS_CPP_WRAPPER__BASE\n\n")
+}
+
+func (g *gen) writeCppWrapperClass(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	cName := g.pkgPrefix + structName
+
+	writeDocComment(b, n.Doc())
+	b.printf("class %s {\n", structName)
+	b.writes("public:\n")
+
+	b.writes("// make returns a newly allocated and initialized object. The options are\n")
+	b.writes("// WUFFS_INITIALIZE__ETC flags.\n")
+	b.printf("static result<%s>\n", structName)
+	b.writes("make(uint32_t options = 0) {\n")
+	b.printf("%s* p = (%s*)malloc(sizeof__%s());\n", cName, cName, cName)
+	b.writes("if (!p) {\n")
+	b.writes("#if defined(WUFFS_CPP_WRAPPER__USE_EXPECTED)\n")
+	b.writes("return std::unexpected(wuffs_base__make_status(error__out_of_memory));\n")
+	b.writes("#else\n")
+	b.writes("throw std::bad_alloc();\n")
+	b.writes("#endif\n")
+	b.writes("}\n")
+	b.printf("%s w(p);\n", structName)
+	b.printf("wuffs_base__status status = %s__initialize(\np, sizeof__%s(), WUFFS_VERSION, options);\n",
+		cName, cName)
+	b.writes("if (status.is_error()) {\n")
+	b.writes("#if defined(WUFFS_CPP_WRAPPER__USE_EXPECTED)\n")
+	b.writes("return std::unexpected(status);\n")
+	b.writes("#else\n")
+	b.writes("throw error(status);\n")
+	b.writes("#endif\n")
+	b.writes("}\n")
+	b.writes("return w;\n")
+	b.writes("}\n\n")
+
+	b.printf("%s(%s&&) = default;\n", structName, structName)
+	b.printf("%s& operator=(%s&&) = default;\n", structName, structName)
+	b.printf("%s(const %s&) = delete;\n", structName, structName)
+	b.printf("%s& operator=(const %s&) = delete;\n\n", structName, structName)
+
+	b.writes("// get returns the underlying C struct, for calling the C API directly.\n")
+	b.printf("%s* get() const { return ptr_.get(); }\n\n", cName)
+
+	for _, impl := range n.Implements() {
+		iQID := impl.AsTypeExpr().QID()
+		iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
+		b.printf("%s* upcast_as__%s() const {\n", iName, iName)
+		b.printf("return %s__upcast_as__%s(ptr_.get());\n", cName, iName)
+		b.writes("}\n\n")
+	}
+
+	structID := n.QID()[1]
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() != a.KFunc) || !tld.AsFunc().Public() {
+				continue
+			}
+			f := tld.AsFunc()
+			if f.QQID()[1] != structID {
+				continue
+			}
+
+			returnsStatus := f.Effect().Coroutine() ||
+				((f.Out() != nil) && f.Out().IsStatus())
+
+			if err := g.writeFuncSignature(b, f, wfsCppWrapper); err != nil {
+				return err
+			}
+			b.writes(" {\n")
+			if returnsStatus {
+				b.writes("return check_status(")
+			} else {
+				b.writes("return ")
+			}
+			b.writes(g.funcCName(f))
+			b.writes("(\nptr_.get()")
+			for _, o := range f.In().Fields() {
+				b.writes(", ")
+				b.writes(aPrefix)
+				b.writes(o.AsField().Name().Str(g.tm))
+			}
+			if returnsStatus {
+				b.writes(")")
+			}
+			b.writes(");\n}\n\n")
+		}
+	}
+
+	b.writes("private:\n")
+	b.printf("explicit %s(%s* p) : ptr_(p) {}\n\n", structName, cName)
+	b.printf("std::unique_ptr<%s, wuffs_unique_ptr_deleter> ptr_;\n", cName)
+	b.printf("};  // class %s\n\n", structName)
+	return nil
+}
@@ -25,6 +25,11 @@ func (g *gen) writeExpr(b *buffer, n *a.Expr, sideEffectsOnly bool, depth uint32
 	}
 	depth++
 
+	if name, ok := g.currFunk.loopInvariants[n]; ok {
+		b.writes(name)
+		return nil
+	}
+
 	if cv := n.ConstValue(); cv != nil {
 		if typ := n.MType(); typ.IsNumTypeOrIdeal() {
 			b.writes(cv.String())
@@ -230,6 +235,9 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, sideEffectsOnly bool, depth u
 	case t.IDDot:
 		lhs := n.LHS().AsExpr()
 		if lhs.Ident() == t.IDArgs {
+			if g.currFunk.flatScope != nil {
+				return g.writeFlatArg(b, n, depth)
+			}
 			b.writes(aPrefix)
 			b.writes(n.Ident().Str(g.tm))
 			return nil
@@ -281,6 +289,22 @@ func (g *gen) writeExprUnaryOp(b *buffer, n *a.Expr, depth uint32) error {
 		return fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
 	}
 
+	if op == t.IDXUnaryTilde {
+		// C promotes small integers to int before applying "~", so cast the
+		// result back to the Wuffs type.
+		b.writes("((")
+		if err := g.writeCTypeName(b, n.MType(), "", ""); err != nil {
+			return err
+		}
+		b.writes(")(")
+		b.writes(opName)
+		if err := g.writeExpr(b, n.RHS().AsExpr(), false, depth); err != nil {
+			return err
+		}
+		b.writes("))")
+		return nil
+	}
+
 	b.writes(opName)
 	return g.writeExpr(b, n.RHS().AsExpr(), false, depth)
 }
@@ -302,10 +326,21 @@ func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, depth uint32) error {
 		b.printf("wuffs_base__u%d__sat_%s", uBits, uOp)
 		opName = ", "
 
+	case t.IDXBinaryLessQuestion, t.IDXBinaryGreaterQuestion:
+		fName, err := minMaxCFuncName(g.tm, op, n.MType())
+		if err != nil {
+			return err
+		}
+		b.writes(fName)
+		opName, overallCast = ", ", false
+
 	case t.IDXBinaryAs:
 		return g.writeExprAs(b, n.LHS().AsExpr(), n.RHS().AsTypeExpr(), depth)
 
 	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar:
+		if iBits := intBits(n.MType().QID()); iBits != 0 {
+			return g.writeExprSignedModOp(b, iBits, n.LHS().AsExpr(), cOpName(op), n.RHS().AsExpr(), depth)
+		}
 		overallCast = true
 
 	case t.IDXBinaryTildeModShiftL:
@@ -361,6 +396,23 @@ func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, depth uint32) error {
 	return nil
 }
 
+// writeExprSignedModOp writes a two's complement wrapping "lhs op rhs", such
+// as "x ~mod+ y", for iBits-bit signed integers. Signed overflow is undefined
+// behavior in C, so the arithmetic is done on unsigned integers.
+func (g *gen) writeExprSignedModOp(b *buffer, iBits uint32, lhs *a.Expr, opName string, rhs *a.Expr, depth uint32) error {
+	cast := signedModOperandCast(iBits)
+	b.printf("((int%d_t)((%s(", iBits, cast)
+	if err := g.writeExpr(b, lhs, false, depth); err != nil {
+		return err
+	}
+	b.printf("))%s(%s(", opName, cast)
+	if err := g.writeExpr(b, rhs, false, depth); err != nil {
+		return err
+	}
+	b.writes("))))")
+	return nil
+}
+
 func (g *gen) writeExprRepr(b *buffer, n *a.Expr, depth uint32) error {
 	isStatus := n.MType().IsStatus()
 	if isStatus {
@@ -501,6 +553,11 @@ func (g *gen) writeExprUserDefinedCall(b *buffer, n *a.Expr, depth uint32) error
 			n.Str(g.tm), recv.MType().Str(g.tm))
 	}
 	qid := recvTyp.QID()
+	qqid := t.QQID{qid[0], qid[1], method.Ident()}
+	if ff := g.flatFuncs[qqid]; (ff != nil) && ff.canFlatten(n) {
+		return g.writeFlatCall(b, ff, n, depth)
+	}
+	g.cCalledFuncs[qqid] = struct{}{}
 	b.printf("%s%s__%s(", g.packagePrefix(qid), qid[1].Str(g.tm), method.Ident().Str(g.tm))
 	if !recvTyp.IsEtcUtilityType() {
 		b.writes(addr)
@@ -681,6 +738,19 @@ var cTypeNames = [...]string{
 
 const noSuchCOperator = " no_such_C_operator "
 
+// minMaxCFuncName returns the C function that implements the "<?" or ">?"
+// operator (or their assignment forms) for the given type, such as
+// "wuffs_base__u32__min".
+func minMaxCFuncName(tm *t.Map, op t.ID, typ *a.TypeExpr) (string, error) {
+	if qid := typ.QID(); (qid[0] != t.IDBase) || !typ.IsNumType() {
+		return "", fmt.Errorf("unsupported %q operator type %q", op.AmbiguousForm().Str(tm), typ.Str(tm))
+	}
+	if (op == t.IDXBinaryLessQuestion) || (op == t.IDLessQuestionEq) {
+		return "wuffs_base__" + typ.QID()[1].Str(tm) + "__min", nil
+	}
+	return "wuffs_base__" + typ.QID()[1].Str(tm) + "__max", nil
+}
+
 func cOpName(x t.ID) string {
 	if x < t.ID(len(cOpNames)) {
 		if s := cOpNames[x]; s != "" {
@@ -708,6 +778,9 @@ var cOpNames = [...]string{
 	t.IDTildeSatPlusEq:   noSuchCOperator,
 	t.IDTildeSatMinusEq:  noSuchCOperator,
 
+	t.IDLessQuestionEq:    noSuchCOperator,
+	t.IDGreaterQuestionEq: noSuchCOperator,
+
 	t.IDEq:         " = ",
 	t.IDEqQuestion: " = ",
 
@@ -737,6 +810,9 @@ var cOpNames = [...]string{
 	t.IDXBinaryOr:             " || ",
 	t.IDXBinaryAs:             noSuchCOperator,
 
+	t.IDXBinaryLessQuestion:    noSuchCOperator,
+	t.IDXBinaryGreaterQuestion: noSuchCOperator,
+
 	t.IDXAssociativePlus: " + ",
 	t.IDXAssociativeStar: " * ",
 	t.IDXAssociativeAmp:  " & ",
@@ -747,5 +823,6 @@ var cOpNames = [...]string{
 
 	t.IDXUnaryPlus:  " + ",
 	t.IDXUnaryMinus: " - ",
+	t.IDXUnaryTilde: " ~ ",
 	t.IDXUnaryNot:   " ! ",
 }
@@ -36,6 +36,7 @@ type funk struct {
 	derivedVars       map[t.ID]struct{}
 	jumpTargets       map[a.Loop]string
 	activeLoops       a.LoopStack
+	cSwitchDepth      int
 	coroSuspPoint     uint32
 	ioManips          uint32
 	tempW             uint32
@@ -43,6 +44,16 @@ type funk struct {
 	usesEmptyIOBuffer bool
 	usesScratch       bool
 	hasGotoOK         bool
+
+	// loopInvariants maps the while loop conditions' operands that
+	// writeLoopInvariants hoisted out of their loops to the C local variables
+	// holding their values.
+	loopInvariants    map[*a.Expr]string
+	numLoopInvariants uint32
+
+	// flatScope is non-nil while writing a flattened call's callee's
+	// returned expression.
+	flatScope *flatScope
 }
 
 func (k *funk) jumpTarget(tm *t.Map, n a.Loop) (string, error) {
@@ -82,6 +93,7 @@ const (
 	wfsCFuncPtrField       = 3
 	wfsCFuncPtrFieldChoosy = 4
 	wfsCFuncPtrType        = 5
+	wfsCppWrapper          = 6
 )
 
 func (g *gen) writeFuncSignature(b *buffer, n *a.Func, wfs uint32) error {
@@ -90,6 +102,8 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, wfs uint32) error {
 		b.writes("WUFFS_BASE__GENERATED_C_CODE\n")
 		if n.Public() {
 			b.writes("WUFFS_BASE__MAYBE_STATIC ")
+		} else if n.Inline() {
+			b.writes("static inline WUFFS_BASE__FORCE_INLINE ")
 		} else {
 			b.writes("static ")
 		}
@@ -101,17 +115,17 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, wfs uint32) error {
 	case wfsCppDecl:
 		b.writes("  inline ")
 
+	case wfsCppWrapper:
+		b.writes("inline ")
+
 	case wfsCFuncPtrField, wfsCFuncPtrFieldChoosy, wfsCFuncPtrType:
 		// No-op.
 	}
 
-	// TODO: write n's return values.
-	if n.Effect().Coroutine() {
-		b.writes("wuffs_base__status")
-	} else if out := n.Out(); out == nil {
-		b.writes("wuffs_base__empty_struct")
-		// TODO: does writeCTypeName generate the right C if out is an array?
-	} else if err := g.writeCTypeName(b, out, "", ""); err != nil {
+	if (wfs == wfsCppWrapper) && (n.Effect().Coroutine() ||
+		((n.Out() != nil) && n.Out().IsStatus())) {
+		b.writes("result<wuffs_base__status>")
+	} else if err := g.writeFuncOutCTypeName(b, n); err != nil {
 		return err
 	}
 
@@ -120,6 +134,8 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, wfs uint32) error {
 		b.writes("\n")
 	case wfsCppDecl:
 		b.writes("\n  ")
+	case wfsCppWrapper:
+		b.writes("\n")
 	case wfsCFuncPtrField, wfsCFuncPtrFieldChoosy:
 		b.writes(" ")
 	}
@@ -148,6 +164,13 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, wfs uint32) error {
 			b.writes("\n      ")
 		}
 
+	case wfsCppWrapper:
+		b.writes(n.FuncName().Str(g.tm))
+		b.writeb('(')
+		if len(n.In().Fields()) > 0 {
+			b.writes("\n")
+		}
+
 	case wfsCFuncPtrField, wfsCFuncPtrFieldChoosy, wfsCFuncPtrType:
 		b.writes("(*")
 		if wfs == wfsCFuncPtrField {
@@ -194,23 +217,63 @@ func (g *gen) writeFuncSignature(b *buffer, n *a.Func, wfs uint32) error {
 	}
 
 	b.printf(")")
-	if (wfs == wfsCppDecl) && !n.Receiver().IsZero() && n.Effect().Pure() {
+	if ((wfs == wfsCppDecl) || (wfs == wfsCppWrapper)) &&
+		!n.Receiver().IsZero() && n.Effect().Pure() {
 		b.writes(" const")
 	}
 	return nil
 }
 
+// writeFuncOutCTypeName writes the C type that n returns.
+func (g *gen) writeFuncOutCTypeName(b *buffer, n *a.Func) error {
+	// TODO: write n's return values.
+	if n.Effect().Coroutine() {
+		b.writes("wuffs_base__status")
+	} else if n.Outs() != nil {
+		b.writes(outsCTypeName(g.funcCName(n)))
+	} else if out := n.Out(); out == nil {
+		b.writes("wuffs_base__empty_struct")
+		// TODO: does writeCTypeName generate the right C if out is an array?
+	} else if err := g.writeCTypeName(b, out, "", ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+// outsCTypeName returns the name of the C struct type that holds a func's
+// multiple return values, given that func's C name.
+func outsCTypeName(funcCName string) string {
+	return funcCName + "__out"
+}
+
 func (g *gen) writeFuncPrototype(b *buffer, n *a.Func) error {
+	if _, ok := g.reachableFuncs[n.QQID()]; !ok {
+		return nil
+	}
 	caMacro, _, _, err := cpuArchCNames(n.Asserts())
 	if err != nil {
 		return err
 	}
+	writeDocComment(b, n.Doc())
+	if outs := n.Outs(); outs != nil {
+		b.writes("typedef struct {\n")
+		for _, o := range outs.Fields() {
+			o := o.AsField()
+			b.writes("  ")
+			if err := g.writeCTypeName(b, o.XType(), fPrefix, o.Name().Str(g.tm)); err != nil {
+				return err
+			}
+			b.writes(";\n")
+		}
+		b.printf("} %s;\n\n", outsCTypeName(g.funcCName(n)))
+	}
 	if caMacro != "" {
 		b.printf("#if defined(WUFFS_PRIVATE_IMPL__CPU_ARCH__%s)\n", caMacro)
 	}
 	if err := g.writeFuncSignature(b, n, wfsCDecl); err != nil {
 		return err
 	}
+	g.writeThreadSafetyRequires(b, n, "self")
 	b.writes(";\n")
 	if caMacro != "" {
 		b.printf("#endif  // defined(WUFFS_PRIVATE_IMPL__CPU_ARCH__%s)\n", caMacro)
@@ -226,6 +289,11 @@ func (g *gen) writeFuncPrototype(b *buffer, n *a.Func) error {
 }
 
 func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
+	if _, ok := g.reachableFuncs[n.QQID()]; !ok {
+		// Nothing can call n, so omit it. Its funk was still gathered, as
+		// a coroutine's resume state is part of the struct layout.
+		return nil
+	}
 	k := g.funks[n.QQID()]
 
 	caMacro, caName, caAttribute, err := cpuArchCNames(n.Asserts())
@@ -242,6 +310,7 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 	if caAttribute != "" {
 		b.printf("%s\n", caAttribute)
 	}
+	g.writeThreadSafetyOptOut(b)
 
 	if err := g.writeFuncSignature(b, n, wfsCDecl); err != nil {
 		return err
@@ -255,6 +324,7 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 		}
 		b.writes(");\n}\n\n")
 
+		g.writeThreadSafetyOptOut(b)
 		if err := g.writeFuncSignature(b, n, wfsCDeclChoosy); err != nil {
 			return err
 		}
@@ -267,6 +337,9 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 			b.writex(k.bBodyResume)
 		}
 		b.writex(k.bBody)
+		if g.linedirectives && (len(k.bBody) > 0) {
+			b.writes(lineDirectiveReset)
+		}
 		if n.Effect().Coroutine() {
 			b.writex(k.bBodySuspend)
 		} else if k.hasGotoOK {
@@ -429,12 +502,22 @@ func (g *gen) writeFuncImplPrologue(b *buffer) error {
 		// For public coroutines, check that we are not suspended in an active
 		// coroutine.
 		if g.currFunk.astFunc.Effect().Coroutine() {
+			if g.threadSafety {
+				// Unlike the active_coroutine check, this doesn't disable self,
+				// as the other (concurrent) call still owns it.
+				b.writes("if (self->private_impl.busy) {\n")
+				b.printf("return wuffs_base__make_status(%s);\n", g.concurrentCallsCName())
+				b.writes("}\n")
+			}
 			b.printf("if ((self->private_impl.active_coroutine != 0) &&\n"+
 				"(self->private_impl.active_coroutine != %d)) {\n", g.currFunk.coroID)
 			b.writes("self->private_impl.magic = WUFFS_BASE__DISABLED;\n")
 			b.writes("return wuffs_base__make_status(wuffs_base__error__interleaved_coroutine_calls);\n")
 			b.writes("}\n")
 			b.writes("self->private_impl.active_coroutine = 0;\n")
+			if g.threadSafety {
+				b.writes("self->private_impl.busy = 1;\n")
+			}
 		}
 	}
 
@@ -545,13 +628,16 @@ func (g *gen) writeFuncImplEpilogue(b *buffer) error {
 		b.writes("goto exit;\nexit:\n") // The goto avoids the "unused label" warning.
 
 		if g.currFunk.astFunc.Public() {
-			epilogue = "if (wuffs_base__status__is_error(&status)) {\n" +
+			if g.threadSafety && g.currFunk.astFunc.Effect().Coroutine() {
+				epilogue = "self->private_impl.busy = 0;\n"
+			}
+			epilogue += "if (wuffs_base__status__is_error(&status)) {\n" +
 				"self->private_impl.magic = WUFFS_BASE__DISABLED;\n}\n" +
 				"return status;\n"
 		} else {
 			epilogue = "return status;\n"
 		}
-	} else if g.currFunk.astFunc.Out() == nil {
+	} else if (g.currFunk.astFunc.Out() == nil) && (g.currFunk.astFunc.Outs() == nil) {
 		epilogue = "return wuffs_base__make_empty_struct();\n"
 	}
 
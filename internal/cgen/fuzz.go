@@ -0,0 +1,281 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/wuffs/lib/dumbindent"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// fuzzInterfaces are the decoder interfaces that a generated fuzz target can
+// drive, keyed by their name in the base package.
+var fuzzInterfaces = map[string]func(g *gen, b *buffer, iName string){
+	"image_decoder":  (*gen).writeFuzzImageDecoder,
+	"io_transformer": (*gen).writeFuzzIOTransformer,
+	"token_decoder":  (*gen).writeFuzzTokenDecoder,
+}
+
+// decoderStruct is a public struct that implements one of the fuzzInterfaces
+// or benchInterfaces.
+type decoderStruct struct {
+	structName string
+	iName      string
+	write      func(g *gen, b *buffer, iName string)
+}
+
+// findDecoders returns the package's public structs that implement one of
+// the interfaces, in g.structList order.
+func (g *gen) findDecoders(interfaces map[string]func(g *gen, b *buffer, iName string)) []decoderStruct {
+	decoders := []decoderStruct(nil)
+	for _, n := range g.structList {
+		if !n.Public() {
+			continue
+		}
+		for _, impl := range n.Implements() {
+			iQID := impl.AsTypeExpr().QID()
+			if iQID[0] != t.IDBase {
+				continue
+			}
+			iName := iQID[1].Str(g.tm)
+			if write := interfaces[iName]; write != nil {
+				decoders = append(decoders, decoderStruct{n.QID()[1].Str(g.tm), iName, write})
+				break
+			}
+		}
+	}
+	return decoders
+}
+
+// generateFuzzTarget returns a libFuzzer fuzz target for the package's public
+// decoders, or nil if the package has none. It must be called after
+// generate, which populates g.structList.
+//
+// The fuzz target #include's the release/c single file library and the
+// fuzz/c/fuzzlib helpers, relative to the Wuffs root directory, which must be
+// on the C compiler's include path. When there are multiple decoders, the
+// fuzzed input's hash picks one of them.
+func (g *gen) generateFuzzTarget() ([]byte, error) {
+	decoders := g.findDecoders(fuzzInterfaces)
+	hasImageDecoder := false
+	for _, d := range decoders {
+		hasImageDecoder = hasImageDecoder || (d.iName == "image_decoder")
+	}
+	if len(decoders) == 0 {
+		return nil, nil
+	}
+
+	b := new(buffer)
+	b.writes("// This file is generated by \"wuffs-c gen -fuzz_target\". It is a libFuzzer\n")
+	b.printf("// fuzz target for the wuffs_%s package's decoders. Compile it with the Wuffs\n", g.pkgName)
+	b.writes("// root directory on the include path. Defining WUFFS_CONFIG__FUZZLIB_MAIN\n")
+	b.writes("// lets you run it directly over a set of files, as per fuzz/c/std/README.md.\n\n")
+
+	b.writes("#define WUFFS_IMPLEMENTATION\n\n")
+	b.writes("#if defined(WUFFS_CONFIG__FUZZLIB_MAIN)\n")
+	b.writes("#define WUFFS_CONFIG__STATIC_FUNCTIONS\n")
+	b.writes("#endif\n\n")
+	b.writes("#include \"release/c/wuffs-unsupported-snapshot.c\"\n")
+	b.writes("#include \"fuzz/c/fuzzlib/fuzzlib.c\"\n")
+	if hasImageDecoder {
+		b.writes("#include \"fuzz/c/fuzzlib/fuzzlib_image_decoder.c\"\n")
+	}
+	b.writes("\n")
+
+	quirks := []string{"WUFFS_BASE__QUIRK_IGNORE_CHECKSUM"}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KConst {
+				continue
+			}
+			n := tld.AsConst()
+			if name := n.QID()[1].Str(g.tm); n.Public() && strings.HasPrefix(name, "QUIRK_") {
+				quirks = append(quirks, g.PKGPREFIX+name)
+			}
+		}
+	}
+	if len(quirks) > 64 {
+		return nil, fmt.Errorf("too many quirks for a fuzz target")
+	}
+
+	b.writes("// Setting each quirk (to 1) depends on one bit of the hash.\n")
+	b.writes("static const uint32_t g_quirks[] = {\n")
+	for _, q := range quirks {
+		b.printf("%s,\n", q)
+	}
+	b.writes("0,\n};\n\n")
+
+	for _, d := range decoders {
+		g.writeFuzzDecoder(b, d)
+	}
+
+	b.writes("const char*  //\n")
+	b.writes("fuzz(wuffs_base__io_buffer* src, uint64_t hash) {\n")
+	if len(decoders) == 1 {
+		b.printf("return fuzz_%s%s(src, hash);\n", g.pkgPrefix, decoders[0].structName)
+	} else {
+		b.printf("switch (hash %% %d) {\n", len(decoders))
+		for i, d := range decoders {
+			b.printf("case %d:\nreturn fuzz_%s%s(src, hash / %d);\n", i, g.pkgPrefix, d.structName, len(decoders))
+		}
+		b.writes("}\nreturn NULL;\n")
+	}
+	b.writes("}\n")
+	return *b, nil
+}
+
+// writeFuzzTarget writes generateFuzzTarget's output to filename, or removes
+// any existing file there if the package has no decoders.
+func (g *gen) writeFuzzTarget(filename string) error {
+	target, err := g.generateFuzzTarget()
+	if err != nil {
+		return err
+	} else if target == nil {
+		if err := os.Remove(filename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	target = dumbindent.FormatBytes(nil, target, nil)
+	return os.WriteFile(filename, target, 0644)
+}
+
+// writeFuzzDecoder writes a fuzz_wuffs_foo__bar function that initializes a
+// wuffs_foo__bar, sets some quirks and then calls the interface-specific code
+// with "self", an upcast pointer to that decoder.
+func (g *gen) writeFuzzDecoder(b *buffer, d decoderStruct) {
+	cName := g.pkgPrefix + d.structName
+	iName := "wuffs_base__" + d.iName
+
+	b.writes("static const char*  //\n")
+	b.printf("fuzz_%s(wuffs_base__io_buffer* src, uint64_t hash) {\n", cName)
+	b.printf("%s dec;\n", cName)
+	b.printf("wuffs_base__status status = %s__initialize(\n", cName)
+	b.writes("&dec, sizeof dec, WUFFS_VERSION,\n")
+	b.writes("(hash & 1) ? WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED : 0);\n")
+	b.writes("hash = wuffs_base__u64__rotate_right(hash, 1);\n")
+	b.writes("if (!wuffs_base__status__is_ok(&status)) {\n")
+	b.writes("return wuffs_base__status__message(&status);\n")
+	b.writes("}\n")
+	b.printf("%s* self = %s__upcast_as__%s(&dec);\n\n", iName, cName, iName)
+
+	b.writes("for (uint32_t i = 0; g_quirks[i]; i++) {\n")
+	b.writes("if (hash & (((uint64_t)1) << i)) {\n")
+	b.printf("status = %s__set_quirk(self, g_quirks[i], 1);\n", iName)
+	b.writes("}\n")
+	b.writes("}\n")
+	b.writes("hash = wuffs_base__u64__rotate_right(hash, 32);\n\n")
+
+	d.write(g, b, iName)
+	b.writes("}\n\n")
+}
+
+func (g *gen) writeFuzzImageDecoder(b *buffer, iName string) {
+	b.writes("return fuzz_image_decoder(src, hash, self);\n")
+}
+
+// writeWorkbuf writes C code that allocates a work buffer, returning an error
+// message prefixed by prog if that fails. The caller is responsible for
+// freeing it.
+func (g *gen) writeWorkbuf(b *buffer, iName string, prog string) {
+	b.writes("wuffs_base__slice_u8 workbuf = wuffs_base__empty_slice_u8();\n")
+	g.writeWorkbufAlloc(b, iName, prog)
+	b.writes("\n")
+}
+
+// writeWorkbufAlloc writes C code that sets an empty workbuf to a new
+// allocation of the io_transformer's or token_decoder's current workbuf_len.
+func (g *gen) writeWorkbufAlloc(b *buffer, iName string, prog string) {
+	b.printf("{\nuint64_t n = %s__workbuf_len(self).max_incl;\n", iName)
+	b.writes("if (n > 64 * 1024 * 1024) {  // Don't allocate more than 64 MiB.\n")
+	b.printf("return \"%s: workbuf too large\";\n", prog)
+	b.writes("} else if (n > 0) {\n")
+	b.writes("workbuf = wuffs_base__malloc_slice_u8(malloc, n);\n")
+	b.writes("if (!workbuf.ptr) {\n")
+	b.printf("return \"%s: out of memory\";\n", prog)
+	b.writes("}\n")
+	b.writes("}\n")
+	b.writes("}\n")
+}
+
+// writeShortWorkbuf writes C code that, when an io_transformer suspends
+// because its workbuf_len has grown (e.g. after decoding a header), replaces
+// the work buffer and tries again.
+func (g *gen) writeShortWorkbuf(b *buffer, iName string, prog string) {
+	b.writes("if (status.repr == wuffs_base__suspension__short_workbuf) {\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.writes("workbuf = wuffs_base__empty_slice_u8();\n")
+	g.writeWorkbufAlloc(b, iName, prog)
+	b.writes("continue;\n")
+	b.writes("}\n")
+}
+
+// writeCompactRetaining writes C code that discards the dst bytes that an
+// io_transformer has produced, other than those that it needs as history.
+// Unlike compacting to zero bytes, this lets an io_transformer such as a
+// deflate decoder refer back to earlier output after a short write.
+func (g *gen) writeCompactRetaining(b *buffer, iName string, prog string) {
+	b.printf("wuffs_base__optional_u63 hrl = %s__dst_history_retain_length(self);\n", iName)
+	b.writes("wuffs_base__io_buffer__compact_retaining(\n")
+	b.writes("&dst, wuffs_base__optional_u63__value_or(&hrl, UINT64_MAX));\n")
+	b.writes("if (dst.meta.wi == dst.data.len) {\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.printf("return \"%s: unsupported history length\";\n", prog)
+	b.writes("}\n")
+}
+
+func (g *gen) writeFuzzIOTransformer(b *buffer, iName string) {
+	g.writeWorkbuf(b, iName, "fuzz")
+	b.writes("static uint8_t dst_array[65536];\n")
+	b.writes("wuffs_base__io_buffer dst =\n")
+	b.writes("wuffs_base__ptr_u8__writer(&dst_array[0], sizeof dst_array);\n\n")
+	b.writes("while (true) {\n")
+	b.printf("status = %s__transform_io(self, &dst, src, workbuf);\n", iName)
+	g.writeShortWorkbuf(b, iName, "fuzz")
+	b.writes("if (status.repr != wuffs_base__suspension__short_write) {\n")
+	b.writes("break;\n")
+	b.writes("}\n")
+	b.writes("if (dst.meta.ri == dst.meta.wi) {\n")
+	b.printf("fprintf(stderr, \"%s__transform_io made no progress\\n\");\n", iName)
+	b.writes("intentional_segfault();\n")
+	b.writes("}\n")
+	b.writes("dst.meta.ri = dst.meta.wi;\n")
+	g.writeCompactRetaining(b, iName, "fuzz")
+	b.writes("}\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.writes("return wuffs_base__status__message(&status);\n")
+}
+
+func (g *gen) writeFuzzTokenDecoder(b *buffer, iName string) {
+	g.writeWorkbuf(b, iName, "fuzz")
+	b.writes("static wuffs_base__token tok_array[4096];\n")
+	b.writes("wuffs_base__token_buffer tok = wuffs_base__slice_token__writer(\n")
+	b.writes("wuffs_base__make_slice_token(&tok_array[0], 4096));\n\n")
+	b.writes("while (true) {\n")
+	b.writes("tok.meta.ri = 0;\n")
+	b.writes("tok.meta.wi = 0;\n")
+	b.printf("status = %s__decode_tokens(self, &tok, src, workbuf);\n", iName)
+	b.writes("if (status.repr != wuffs_base__suspension__short_write) {\n")
+	b.writes("break;\n")
+	b.writes("}\n")
+	b.writes("if (tok.meta.wi == 0) {\n")
+	b.printf("fprintf(stderr, \"%s__decode_tokens made no progress\\n\");\n", iName)
+	b.writes("intentional_segfault();\n")
+	b.writes("}\n")
+	b.writes("}\n")
+	b.writes("free(workbuf.ptr);\n")
+	b.writes("return wuffs_base__status__message(&status);\n")
+}
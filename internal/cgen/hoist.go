@@ -0,0 +1,271 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/wuffs/internal/lower"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// findLoopInvariants returns the operands of a while loop's condition that
+// are worth evaluating once, before the loop, instead of once per iteration.
+// Such an operand (the "this.n" in "while i < this.n") reads at least one
+// "this.foo" field and isn't modified by the loop:
+//
+//	while i < this.n {
+//	    args.dst[i] = 0  // A C compiler can't tell that this doesn't alias n.
+//	    i += 1
+//	}
+//
+// A C compiler can't hoist the self->private_impl.f_n load itself, as the
+// loop body's uint8_t stores could alias any other object.
+//
+// The condition must be a comparison, so that both of its operands are
+// evaluated on the loop's first iteration. Loops that could suspend are never
+// hoisted out of, as resuming the coroutine jumps into the loop body.
+//
+// This is deliberately narrow. It is not general loop-invariant code motion:
+// it only considers a while loop condition's two operands, not invariant
+// subexpressions elsewhere in the condition or in the loop body, and it does
+// not apply to iterate loops. It is also a C-backend-only analysis of the
+// checked AST, not an internal/lower pass, as cgen doesn't use the func IR.
+//
+// In particular, it doesn't hoist buffer end pointers or masks. An io_reader
+// or io_writer's end pointer is already an io2_etc local variable, set once
+// per function call, and a mask with a ConstValue is written as a C literal.
+// Masks that depend on fields, such as "(1 << this.width) - 1" in a loop
+// body, are re-evaluated each iteration.
+func findLoopInvariants(n *a.While) []*a.Expr {
+	if n.IsWhileTrue() {
+		return nil
+	}
+	cond := n.Condition()
+	switch cond.Operator() {
+	case t.IDXBinaryEqEq, t.IDXBinaryNotEq,
+		t.IDXBinaryLessThan, t.IDXBinaryLessEq,
+		t.IDXBinaryGreaterThan, t.IDXBinaryGreaterEq:
+	default:
+		return nil
+	}
+
+	mods, ok := findLoopModifications(n)
+	if !ok {
+		return nil
+	}
+
+	ret := []*a.Expr(nil)
+	for _, o := range [2]*a.Expr{cond.LHS().AsExpr(), cond.RHS().AsExpr()} {
+		if (o.ConstValue() != nil) || !o.MType().IsNumType() {
+			continue
+		}
+		fields, locals := map[t.ID]struct{}{}, map[t.ID]struct{}{}
+		if !isLoopInvariantCandidate(o, fields, locals) || (len(fields) == 0) {
+			continue
+		} else if mods.callsThis || mods.modifies(fields, locals) {
+			continue
+		}
+		ret = append(ret, o)
+	}
+	return ret
+}
+
+// isLoopInvariantCandidate returns whether n is a side-effect-free numeric
+// expression built from constants, local variables and "this.foo" or
+// "args.foo" fields. It adds the fields and local variables to the two maps.
+func isLoopInvariantCandidate(n *a.Expr, fields map[t.ID]struct{}, locals map[t.ID]struct{}) bool {
+	if n.ConstValue() != nil {
+		return true
+	} else if !n.MType().IsNumType() {
+		return false
+	}
+
+	switch op := n.Operator(); {
+	case op == 0:
+		if !lower.IsLocalVar(n) {
+			return false
+		}
+		locals[n.Ident()] = struct{}{}
+		return true
+
+	case op == t.IDDot:
+		lhs := n.LHS().AsExpr()
+		if (lhs.Operator() != 0) || lhs.GlobalIdent() {
+			return false
+		} else if lhs.Ident() == t.IDThis {
+			fields[n.Ident()] = struct{}{}
+			return true
+		}
+		return lhs.Ident() == t.IDArgs
+
+	case op == t.IDXBinaryAs:
+		return isLoopInvariantCandidate(n.LHS().AsExpr(), fields, locals)
+
+	case op.IsXUnaryOp():
+		return isLoopInvariantCandidate(n.RHS().AsExpr(), fields, locals)
+
+	case op.IsXBinaryOp():
+		return isLoopInvariantCandidate(n.LHS().AsExpr(), fields, locals) &&
+			isLoopInvariantCandidate(n.RHS().AsExpr(), fields, locals)
+
+	case op.IsXAssociativeOp():
+		for _, o := range n.Args() {
+			if !isLoopInvariantCandidate(o.AsExpr(), fields, locals) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// loopModifications are what a while loop's condition and body could modify.
+type loopModifications struct {
+	fields map[t.ID]struct{}
+	locals map[t.ID]struct{}
+
+	// callsThis is whether the loop calls an impure method whose receiver
+	// could be "this", which could modify any of its fields.
+	callsThis bool
+}
+
+func (m *loopModifications) modifies(fields map[t.ID]struct{}, locals map[t.ID]struct{}) bool {
+	for id := range fields {
+		if _, ok := m.fields[id]; ok {
+			return true
+		}
+	}
+	for id := range locals {
+		if _, ok := m.locals[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+var errLoopCanSuspend = errors.New("cgen: internal error: loop can suspend")
+
+// findLoopModifications returns what the while loop n could modify, or false
+// if n could suspend.
+func findLoopModifications(n *a.While) (m loopModifications, ok bool) {
+	m.fields = map[t.ID]struct{}{}
+	m.locals = map[t.ID]struct{}{}
+	visit := func(o *a.Node) error {
+		switch o.Kind() {
+		case a.KAssign:
+			if lhs := o.AsAssign().LHS(); lhs != nil {
+				m.addAssignee(lhs)
+			}
+		case a.KRet:
+			if o.AsRet().Keyword() == t.IDYield {
+				return errLoopCanSuspend
+			}
+		case a.KExpr:
+			x := o.AsExpr()
+			if x.Effect().Coroutine() {
+				return errLoopCanSuspend
+			} else if (x.Operator() == t.IDOpenParen) && !x.Effect().Pure() && !isBaseMethodCall(x) {
+				m.callsThis = true
+			}
+		}
+		return nil
+	}
+
+	if err := n.Condition().AsNode().Walk(visit); err != nil {
+		return loopModifications{}, false
+	}
+	for _, o := range n.Body() {
+		if err := o.Walk(visit); err != nil {
+			return loopModifications{}, false
+		}
+	}
+	return m, true
+}
+
+// addAssignee records the variable or "this.foo" field that assigning to n,
+// such as "x", "this.foo" or "this.foo[i]", modifies.
+func (m *loopModifications) addAssignee(n *a.Expr) {
+	for {
+		switch n.Operator() {
+		case 0:
+			m.locals[n.Ident()] = struct{}{}
+			return
+		case t.IDDot:
+			if lhs := n.LHS().AsExpr(); (lhs.Operator() == 0) && (lhs.Ident() == t.IDThis) {
+				m.fields[n.Ident()] = struct{}{}
+				return
+			}
+			n = n.LHS().AsExpr()
+		case t.IDOpenBracket, t.IDDotDot:
+			n = n.LHS().AsExpr()
+		default:
+			// Be conservative about anything else.
+			m.callsThis = true
+			return
+		}
+	}
+}
+
+// isBaseMethodCall returns whether the function call n is to a method of a
+// base package type, such as an io_writer or a slice. Those can't modify
+// "this", unlike methods of this package's structs.
+func isBaseMethodCall(n *a.Expr) bool {
+	if n.LHS().AsExpr().Operator() != t.IDDot {
+		// A func without a receiver can't modify "this".
+		return true
+	}
+	_, ok := n.Intrinsic()
+	return ok
+}
+
+// writeLoopInvariants opens a C block that declares and initializes a const
+// local variable for each of the loop invariants, and records their names for
+// writeExpr to use instead of re-evaluating them. The caller is responsible
+// for calling unwriteLoopInvariants after writing the loop.
+func (g *gen) writeLoopInvariants(b *buffer, invariants []*a.Expr) error {
+	if len(invariants) == 0 {
+		return nil
+	}
+	if g.currFunk.loopInvariants == nil {
+		g.currFunk.loopInvariants = map[*a.Expr]string{}
+	}
+	b.writes("{\n")
+	for _, o := range invariants {
+		name := fmt.Sprintf("inv%d", g.currFunk.numLoopInvariants)
+		g.currFunk.numLoopInvariants++
+		b.writes("const ")
+		if err := g.writeCTypeName(b, o.MType(), iPrefix, name); err != nil {
+			return err
+		}
+		b.writes(" = ")
+		if err := g.writeExpr(b, o, false, 0); err != nil {
+			return err
+		}
+		b.writes(";\n")
+		g.currFunk.loopInvariants[o] = iPrefix + name
+	}
+	return nil
+}
+
+// unwriteLoopInvariants closes writeLoopInvariants' C block.
+func (g *gen) unwriteLoopInvariants(b *buffer, invariants []*a.Expr) {
+	if len(invariants) == 0 {
+		return
+	}
+	for _, o := range invariants {
+		delete(g.currFunk.loopInvariants, o)
+	}
+	b.writes("}\n")
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestFindLoopInvariants(tt *testing.T) {
+	testCases := []struct {
+		cond string
+		body string
+		want string
+	}{
+		{"i < this.n", "this.b[i & 15] = 0", "this.n"},
+		{"i < (this.n & 7)", "this.b[i & 15] = 0", "this.n & 7"},
+		{"(this.n ~mod+ j) > i", "this.b[i & 15] = 0", "this.n ~mod+ j"},
+		{"this.m < this.n", "this.m ~mod+= 1", "this.n"},
+		{"i < 16", "this.b[i & 15] = 0", ""},
+		{"i < j", "this.b[i & 15] = 0", ""},
+		{"i < this.n", "this.n = 3", ""},
+		{"i < (this.n ~mod+ j)", "j ~mod+= 1", ""},
+		{"i < this.n", "this.helper!()", ""},
+		{"i < this.n", "args.src.skip_u32?(n: 1)", ""},
+		{"i < this.n", "yield? base.\"$short read\"", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "" +
+			"pub struct foo?(\n" +
+			"\tb : array[16] base.u8,\n" +
+			"\tm : base.u32,\n" +
+			"\tn : base.u32,\n" +
+			")\n" +
+			"\n" +
+			"pri func foo.helper!() {\n" +
+			"}\n" +
+			"\n" +
+			"pub func foo.bar?(src: base.io_reader) {\n" +
+			"\tvar i : base.u32\n" +
+			"\tvar j : base.u32\n" +
+			"\twhile " + tc.cond + " {\n" +
+			"\t\t" + tc.body + "\n" +
+			"\t\ti ~mod+= 1\n" +
+			"\t}\n" +
+			"}\n"
+
+		const filename = "test.wuffs"
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("cond=%q, body=%q: Tokenize: %v", tc.cond, tc.body, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("cond=%q, body=%q: Parse: %v", tc.cond, tc.body, err)
+		}
+		if _, err := check.Check(tm, []*a.File{file}, nil); err != nil {
+			tt.Fatalf("cond=%q, body=%q: Check: %v", tc.cond, tc.body, err)
+		}
+
+		got := []string(nil)
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			for _, o := range tld.AsFunc().Body() {
+				if o.Kind() != a.KWhile {
+					continue
+				}
+				for _, x := range findLoopInvariants(o.AsWhile()) {
+					got = append(got, x.Str(tm))
+				}
+			}
+		}
+		if g := strings.Join(got, ", "); g != tc.want {
+			tt.Errorf("cond=%q, body=%q: got %q, want %q", tc.cond, tc.body, g, tc.want)
+		}
+	}
+}
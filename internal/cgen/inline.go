@@ -0,0 +1,263 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"errors"
+
+	"github.com/google/wuffs/internal/lower"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// maxFlatFuncNodes is the largest number of AST nodes that a func's returned
+// expression can have for its calls to be flattened automatically. Funcs
+// declared "via inline" have no such limit.
+const maxFlatFuncNodes = 12
+
+// flatFunc is a func whose "this.foo(etc)" calls can be flattened: replaced,
+// in the generated C code, by the func's returned expression. Its body must
+// be a single "return" statement. For example, given:
+//
+//	pri func decoder.low_nibble(x: base.u8) base.u8 {
+//	    return args.x & 0x0F
+//	}
+//
+// the C code for "this.low_nibble(x: b)" is "((uint8_t)(((uint8_t)(v_b)) &
+// 15u))" instead of "wuffs_foo__decoder__low_nibble(self, v_b)".
+type flatFunc struct {
+	f   *a.Func
+	ret *a.Expr
+
+	// uses counts how often the returned expression reads each "args.foo".
+	uses map[t.ID]int
+}
+
+// flatScope maps a flattened call's callee's "args.foo" to the caller's
+// argument values. It is nil outside of flattened calls. Calls can nest,
+// since a caller's argument values can themselves read the caller's (when
+// the caller is also being flattened) "args.foo".
+type flatScope struct {
+	args  map[t.ID]flatArg
+	outer *flatScope
+}
+
+type flatArg struct {
+	typ   *a.TypeExpr
+	value *a.Expr
+}
+
+var errInternalFlatArg = errors.New("cgen: internal error: missing flattened call argument")
+
+// findFlatFuncs sets g.flatFuncs to the package's funcs whose calls can be
+// flattened. It must be called before generating any C code for function
+// calls.
+func (g *gen) findFlatFuncs() {
+	g.flatFuncs = map[t.QQID]*flatFunc{}
+	g.cCalledFuncs = map[t.QQID]struct{}{}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if ff := makeFlatFunc(tld.AsFunc()); ff != nil {
+				g.flatFuncs[ff.f.QQID()] = ff
+			}
+		}
+	}
+}
+
+// makeFlatFunc returns n as a flatFunc, or nil if n's calls can't (or, for a
+// large returned expression without "via inline", shouldn't) be flattened.
+func makeFlatFunc(n *a.Func) *flatFunc {
+	if n.Public() || n.Test() || n.Choosy() || n.HasChooseCPUArch() ||
+		!n.Effect().Pure() || n.Receiver().IsZero() ||
+		(n.Outs() != nil) || (n.Out() == nil) || !isFlatType(n.Out()) {
+		return nil
+	}
+	for _, o := range n.In().Fields() {
+		if !isFlatType(o.AsField().XType()) {
+			return nil
+		}
+	}
+
+	body := n.Body()
+	if (len(body) != 1) || (body[0].Kind() != a.KRet) {
+		return nil
+	}
+	ret := body[0].AsRet()
+	if (ret.Keyword() != t.IDReturn) || (ret.Value() == nil) {
+		return nil
+	}
+
+	ff := &flatFunc{
+		f:    n,
+		ret:  ret.Value(),
+		uses: map[t.ID]int{},
+	}
+	numNodes := 0
+	if !ff.isFlatExpr(ff.ret, &numNodes) {
+		return nil
+	} else if (numNodes > maxFlatFuncNodes) && !n.Inline() {
+		return nil
+	}
+	return ff
+}
+
+// isFlatType returns whether typ is a numeric or bool type, which can be
+// passed and returned by value.
+func isFlatType(typ *a.TypeExpr) bool {
+	return typ.IsNumType() || typ.IsBool()
+}
+
+// isFlatExpr returns whether n is built only from constants, "args.foo" and
+// "this.foo" fields, global consts, indexing and unary, binary and
+// associative operators. Such an expression means the same thing in the
+// caller's C code as in the callee's. It also counts n's nodes and the
+// "args.foo" uses.
+func (ff *flatFunc) isFlatExpr(n *a.Expr, numNodes *int) bool {
+	*numNodes++
+	if n.ConstValue() != nil {
+		return true
+	}
+
+	switch op := n.Operator(); {
+	case op == 0:
+		return n.GlobalIdent()
+
+	case op == t.IDDot:
+		lhs := n.LHS().AsExpr()
+		if (lhs.Operator() != 0) || lhs.GlobalIdent() {
+			return false
+		} else if lhs.Ident() == t.IDArgs {
+			ff.uses[n.Ident()]++
+			return true
+		}
+		return lhs.Ident() == t.IDThis
+
+	case op == t.IDOpenBracket:
+		return ff.isFlatExpr(n.LHS().AsExpr(), numNodes) &&
+			ff.isFlatExpr(n.RHS().AsExpr(), numNodes)
+
+	case op == t.IDXBinaryAs:
+		return ff.isFlatExpr(n.LHS().AsExpr(), numNodes)
+
+	case op.IsXUnaryOp():
+		return ff.isFlatExpr(n.RHS().AsExpr(), numNodes)
+
+	case op.IsXBinaryOp():
+		return ff.isFlatExpr(n.LHS().AsExpr(), numNodes) &&
+			ff.isFlatExpr(n.RHS().AsExpr(), numNodes)
+
+	case op.IsXAssociativeOp():
+		for _, o := range n.Args() {
+			if !ff.isFlatExpr(o.AsExpr(), numNodes) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// canFlatten returns whether the function call n can be flattened. Its
+// argument values must have no side effects, since flattening can re-order,
+// duplicate or drop them. An argument value that the callee reads more than
+// once must also be cheap to re-evaluate.
+func (ff *flatFunc) canFlatten(n *a.Expr) bool {
+	if recv := n.LHS().AsExpr().LHS().AsExpr(); (recv.Operator() != 0) || (recv.Ident() != t.IDThis) {
+		return false
+	}
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		v := o.Value()
+		if !v.Effect().Pure() {
+			return false
+		} else if (ff.uses[o.Name()] > 1) && !isCheapExpr(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCheapExpr returns whether n is a constant, a local variable or an
+// "args.foo" or "this.foo" field.
+func isCheapExpr(n *a.Expr) bool {
+	if n.ConstValue() != nil {
+		return true
+	}
+	switch n.Operator() {
+	case 0:
+		return lower.IsLocalVar(n)
+	case t.IDDot:
+		lhs := n.LHS().AsExpr()
+		return (lhs.Operator() == 0) && !lhs.GlobalIdent() &&
+			((lhs.Ident() == t.IDArgs) || (lhs.Ident() == t.IDThis))
+	}
+	return false
+}
+
+// writeFlatCall writes the flattened form of the function call n.
+func (g *gen) writeFlatCall(b *buffer, ff *flatFunc, n *a.Expr, depth uint32) error {
+	s := &flatScope{
+		args:  map[t.ID]flatArg{},
+		outer: g.currFunk.flatScope,
+	}
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		s.args[o.Name()] = flatArg{value: o.Value()}
+	}
+	for _, o := range ff.f.In().Fields() {
+		o := o.AsField()
+		arg := s.args[o.Name()]
+		arg.typ = o.XType()
+		s.args[o.Name()] = arg
+	}
+
+	b.writes("((")
+	if err := g.writeCTypeName(b, ff.f.Out(), "", ""); err != nil {
+		return err
+	}
+	b.writes(")(")
+	g.currFunk.flatScope = s
+	err := g.writeExpr(b, ff.ret, false, depth)
+	g.currFunk.flatScope = s.outer
+	if err != nil {
+		return err
+	}
+	b.writes("))")
+	return nil
+}
+
+// writeFlatArg writes the caller's value for the "args.foo" expression n, in
+// the callee's returned expression, converted to the callee's argument type.
+func (g *gen) writeFlatArg(b *buffer, n *a.Expr, depth uint32) error {
+	s := g.currFunk.flatScope
+	arg := s.args[n.Ident()]
+	if arg.value == nil {
+		return errInternalFlatArg
+	}
+
+	b.writes("((")
+	if err := g.writeCTypeName(b, arg.typ, "", ""); err != nil {
+		return err
+	}
+	b.writes(")(")
+	g.currFunk.flatScope = s.outer
+	err := g.writeExpr(b, arg.value, false, depth)
+	g.currFunk.flatScope = s
+	if err != nil {
+		return err
+	}
+	b.writes("))")
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestMakeFlatFunc(tt *testing.T) {
+	big := "args.x" + strings.Repeat(" + args.x", maxFlatFuncNodes)
+	testCases := []struct {
+		decl string
+		body string
+		want bool
+	}{
+		{"(x: base.u8) base.u8", "return args.x & 0x0F", true},
+		{"(x: base.u8[..= 15]) base.u8", "return this.b[args.x]", true},
+		{"(x: base.u8) base.bool", "return args.x == this.n", true},
+		{"() base.u32", "return 7", true},
+		{"(x: base.u8[..= 1]) base.u8", "return " + big, false},
+		{"(x: base.u8[..= 1]) base.u8, via inline", "return " + big, true},
+		{"(x: base.u8) base.u8", "return this.helper(x: args.x)", false},
+		{"(x: base.u8) base.u8", "var y : base.u8\n\ty = args.x\n\treturn y", false},
+		{"(x: base.u8) base.u8", "return args.x + 0", true},
+		{"!(x: base.u8) base.u8", "return args.x", false},
+		{"(x: slice base.u8) base.u64", "return args.x.length()", false},
+	}
+
+	for _, tc := range testCases {
+		src := "" +
+			"pub struct foo?(\n" +
+			"\tb : array[16] base.u8,\n" +
+			"\tn : base.u8,\n" +
+			")\n" +
+			"\n" +
+			"pri func foo.helper(x: base.u8) base.u8 {\n" +
+			"\treturn args.x\n" +
+			"}\n" +
+			"\n" +
+			"pri func foo.bar" + tc.decl + " {\n" +
+			"\t" + tc.body + "\n" +
+			"}\n"
+
+		const filename = "test.wuffs"
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Fatalf("decl=%q: Tokenize: %v", tc.decl, err)
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("decl=%q: Parse: %v", tc.decl, err)
+		}
+		if _, err := check.Check(tm, []*a.File{file}, nil); err != nil {
+			tt.Fatalf("decl=%q: Check: %v", tc.decl, err)
+		}
+
+		bar := tm.ByName("bar")
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() != a.KFunc) || (tld.AsFunc().FuncName() != bar) {
+				continue
+			}
+			if got := makeFlatFunc(tld.AsFunc()) != nil; got != tc.want {
+				tt.Errorf("decl=%q, body=%q: got %t, want %t", tc.decl, tc.body, got, tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// lineDirectiveReset is a placeholder, written after a function body's
+// statements (each of which has a "#line 123 \"foo.wuffs\"" directive), that
+// resetLineDirectives replaces with a "#line" directive for the C code itself.
+// The placeholder's line number isn't known until the C code is formatted.
+const lineDirectiveReset = "#line WUFFS_RESET_LINE_DIRECTIVE\n"
+
+// resetLineDirectives replaces each lineDirectiveReset placeholder in src with
+// a directive that maps the following lines back to their actual line number
+// in src, as if src was saved as cFilename. Without it, the C code after a
+// function body (such as the coroutine epilogue and the next function) would
+// be attributed to the Wuffs source code.
+func resetLineDirectives(src []byte, cFilename string) []byte {
+	placeholder := []byte(lineDirectiveReset[:len(lineDirectiveReset)-1])
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	dst := make([]byte, 0, len(src))
+	for i, line := range lines {
+		if bytes.Equal(bytes.TrimSuffix(line, []byte("\n")), placeholder) {
+			// The directive is on line (i + 1). It applies to the line after.
+			line = []byte(fmt.Sprintf("#line %d %s\n", i+2, cStringLiteral(cFilename)))
+		}
+		dst = append(dst, line...)
+	}
+	return dst
+}
+
+// cStringLiteral returns s as a double-quoted C string literal.
+func cStringLiteral(s string) string {
+	sb := strings.Builder{}
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case (c == '"') || (c == '\\'):
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case (c < 0x20) || (c == 0x7F):
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"testing"
+)
+
+func TestResetLineDirectives(tt *testing.T) {
+	src := "void f() {\n" +
+		"#line 7 \"foo.wuffs\"\n" +
+		"x = 1;\n" +
+		lineDirectiveReset +
+		"return;\n" +
+		"}\n"
+	want := "void f() {\n" +
+		"#line 7 \"foo.wuffs\"\n" +
+		"x = 1;\n" +
+		"#line 5 \"wuffs-foo.c\"\n" +
+		"return;\n" +
+		"}\n"
+	if got := string(resetLineDirectives([]byte(src), "wuffs-foo.c")); got != want {
+		tt.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCStringLiteral(tt *testing.T) {
+	testCases := []struct {
+		s    string
+		want string
+	}{
+		{"", `""`},
+		{"std/gif/decode_gif.wuffs", `"std/gif/decode_gif.wuffs"`},
+		{`a"b\c`, `"a\"b\\c"`},
+		{"tab\there", `"tab\011here"`},
+	}
+
+	for _, tc := range testCases {
+		if got := cStringLiteral(tc.s); got != tc.want {
+			tt.Errorf("s=%q: got %s, want %s", tc.s, got, tc.want)
+		}
+	}
+}
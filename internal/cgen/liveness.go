@@ -217,6 +217,11 @@ loop:
 				break loop
 			}
 
+		case a.KSwitch:
+			if err := h.doSwitch(r, o.AsSwitch(), depth); err != nil {
+				return err
+			}
+
 		case a.KVar:
 			if err := h.doVar(r, o.AsVar(), depth); err != nil {
 				return err
@@ -246,21 +251,31 @@ func (h *livenessHelper) doAssign(r livenesses, n *a.Assign, depth uint32) error
 		return nil
 	}
 
-	// If the LHS is not a local variable (e.g. "this.foo[bar] = etc", or if
-	// the LHS is implicitly also on the RHS (e.g. for a += or *= operator),
-	// walk the LHS Expr.
-	if n.LHS().Operator() != 0 || (n.Operator() != t.IDEq && n.Operator() != t.IDEqQuestion) {
-		if err := h.doExpr(r, n.LHS()); err != nil {
-			return err
-		}
+	// A multiple assignment, "x, y = etc", has a list Expr LHS.
+	lhss := []*a.Node{n.LHS().AsNode()}
+	if n.LHS().Operator() == a.ExprOperatorList {
+		lhss = n.LHS().Args()
 	}
 
-	// If the LHS is just a local variable, then call lowerWeakToNone.
-	if lhs := n.LHS(); lhs.Operator() == 0 {
-		if i, ok := h.vars[lhs.Ident()]; !ok {
-			return fmt.Errorf("unrecognized variable %q", lhs.Ident().Str(h.tm))
-		} else {
-			r.lowerWeakToNone(i)
+	for _, o := range lhss {
+		lhs := o.AsExpr()
+
+		// If the LHS is not a local variable (e.g. "this.foo[bar] = etc", or
+		// if the LHS is implicitly also on the RHS (e.g. for a += or *=
+		// operator), walk the LHS Expr.
+		if lhs.Operator() != 0 || (n.Operator() != t.IDEq && n.Operator() != t.IDEqQuestion) {
+			if err := h.doExpr(r, lhs); err != nil {
+				return err
+			}
+		}
+
+		// If the LHS is just a local variable, then call lowerWeakToNone.
+		if lhs.Operator() == 0 {
+			if i, ok := h.vars[lhs.Ident()]; !ok {
+				return fmt.Errorf("unrecognized variable %q", lhs.Ident().Str(h.tm))
+			} else {
+				r.lowerWeakToNone(i)
+			}
 		}
 	}
 	return nil
@@ -405,6 +420,26 @@ func (h *livenessHelper) doRet(r livenesses, n *a.Ret, depth uint32) error {
 	return nil
 }
 
+func (h *livenessHelper) doSwitch(r livenesses, n *a.Switch, depth uint32) error {
+	if err := h.doExpr(r, n.Subject()); err != nil {
+		return err
+	}
+
+	// The checker has already verified that a switch without a default case
+	// is exhaustive, so exactly one case body is always taken.
+	scratch := make(livenesses, len(r))
+	result := make(livenesses, len(r))
+	for _, o := range n.Cases() {
+		copy(scratch, r)
+		if err := h.doBlock(scratch, o.AsCase().Body(), depth); err != nil {
+			return err
+		}
+		result.reconcile(scratch)
+	}
+	copy(r, result)
+	return nil
+}
+
 func (h *livenessHelper) doVar(r livenesses, n *a.Var, depth uint32) error {
 	name := n.Name()
 	if i, ok := h.vars[name]; !ok {
@@ -0,0 +1,48 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"github.com/google/wuffs/internal/lower"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// writeMemLoop writes m as a call to memset or memcpy, followed by setting the
+// loop variable to the loop bound, as the while loop would have left it.
+//
+// The C compiler may or may not recognize the equivalent C loop. Calling
+// memset or memcpy instead lets the C library's SIMD implementations do the
+// work, without cgen having to emit SSE2 or NEON intrinsics itself.
+func (g *gen) writeMemLoop(b *buffer, n *a.While, m lower.MemLoop) error {
+	condition, i, bound, dst, src := buffer(nil), buffer(nil), buffer(nil), buffer(nil), buffer(nil)
+	if err := g.writeExpr(&condition, n.Condition(), false, 0); err != nil {
+		return err
+	} else if err := g.writeExpr(&i, m.I, false, 0); err != nil {
+		return err
+	} else if err := g.writeExpr(&bound, m.N, false, 0); err != nil {
+		return err
+	} else if err := g.writeExpr(&dst, m.Dst, false, 0); err != nil {
+		return err
+	} else if err := g.writeExpr(&src, m.Src, false, 0); err != nil {
+		return err
+	}
+
+	b.printf("if (%s) {\n", trimParens(condition))
+	if m.IsCopy {
+		b.printf("memcpy(&%s, &%s, ((size_t)(%s - %s)) * sizeof(%s));\n", dst, src, bound, i, dst)
+	} else {
+		b.printf("memset(&%s, %s, ((size_t)(%s - %s)) * sizeof(%s));\n", dst, src, bound, i, dst)
+	}
+	b.printf("%s = %s;\n", i, bound)
+	b.writes("}\n")
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// buildMetadata is what a -build_metadata package records about how it was
+// generated.
+type buildMetadata struct {
+	version     cf.Version
+	gitRevision string
+	flags       string
+}
+
+// unrecordedFlags are the wuffs-c flags that buildMetadata.flags leaves out:
+// those naming files or directories, so that the generated code doesn't
+// depend on where it was generated, and those for the metadata itself.
+var unrecordedFlags = map[string]bool{
+	"abi_json":       true,
+	"bench_target":   true,
+	"build_metadata": true,
+	"cache_dir":      true,
+	"check_abi":      true,
+	"cpp_wrapper":    true,
+	"fuzz_target":    true,
+	"git_revision":   true,
+	"test_target":    true,
+	"version":        true,
+}
+
+// recordedFlags returns the explicitly set flags, other than unrecordedFlags,
+// as a space-separated "-name=value" list sorted by name.
+func recordedFlags(flags *flag.FlagSet) string {
+	list := []string(nil)
+	flags.Visit(func(f *flag.Flag) {
+		if !unrecordedFlags[f.Name] {
+			list = append(list, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+		}
+	})
+	sort.Strings(list)
+	return strings.Join(list, " ")
+}
+
+// versionCName is the C name of the function that returns the package's
+// WUFFS_FOO__WUFFS_VERSION.
+func (g *gen) versionCName() string {
+	return g.pkgPrefix + "version"
+}
+
+// checkBuildMetadataNames checks that the package doesn't already have a
+// versionCName function.
+func (g *gen) checkBuildMetadataNames() error {
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() == a.KFunc) && (g.funcCName(tld.AsFunc()) == g.versionCName()) {
+				return fmt.Errorf("-build_metadata's %s function conflicts with func %q",
+					g.versionCName(), tld.AsFunc().QQID().Str(g.tm))
+			}
+		}
+	}
+	return nil
+}
+
+// writeBuildMetadataDecls writes the WUFFS_FOO__WUFFS_VERSION etc macros, and
+// checks at compile time that the base package is compatible with them, by
+// the same rule as wuffs_foo__bar__initialize's run time check.
+func (g *gen) writeBuildMetadataDecls(b *buffer) {
+	m := g.buildMetadata
+	b.writes("// ---------------- Build Metadata\n\n")
+	b.writes("// This package was generated with \"wuffs-c gen -build_metadata\".\n")
+	b.writes("// WUFFS_FOO__WUFFS_VERSION etc are the WUFFS_VERSION etc that it was\n")
+	b.writes("// generated for. WUFFS_FOO__GIT_REVISION, if non-empty, identifies the\n")
+	b.writes("// Wuffs source code. WUFFS_FOO__WUFFS_C_FLAGS are the other (non-file)\n")
+	b.writes("// wuffs-c flags. wuffs_foo__version returns WUFFS_FOO__WUFFS_VERSION as\n")
+	b.writes("// it was when the library (not necessarily its caller) was compiled.\n\n")
+
+	b.printf("#define %sWUFFS_VERSION 0x%09X\n", g.PKGPREFIX, m.version.Uint64())
+	b.printf("#define %sWUFFS_VERSION_MAJOR %d\n", g.PKGPREFIX, m.version.Major)
+	b.printf("#define %sWUFFS_VERSION_MINOR %d\n", g.PKGPREFIX, m.version.Minor)
+	b.printf("#define %sWUFFS_VERSION_PATCH %d\n", g.PKGPREFIX, m.version.Patch)
+	b.printf("#define %sWUFFS_VERSION_STRING %s\n", g.PKGPREFIX, cStringLiteral(m.version.String()))
+	b.printf("#define %sGIT_REVISION %s\n", g.PKGPREFIX, cStringLiteral(m.gitRevision))
+	b.printf("#define %sWUFFS_C_FLAGS %s\n\n", g.PKGPREFIX, cStringLiteral(m.flags))
+
+	b.printf("#if (WUFFS_VERSION_MAJOR != %sWUFFS_VERSION_MAJOR) || \\\n", g.PKGPREFIX)
+	b.printf("    (WUFFS_VERSION_MINOR < %sWUFFS_VERSION_MINOR)\n", g.PKGPREFIX)
+	b.printf("#error \"%s was generated for an incompatible WUFFS_VERSION\"\n", g.pkgPrefix[:len(g.pkgPrefix)-2])
+	b.writes("#endif\n\n")
+}
+
+// writeBuildMetadataPrototype writes the versionCName function's prototype.
+func (g *gen) writeBuildMetadataPrototype(b *buffer) {
+	b.writes("WUFFS_BASE__GENERATED_C_CODE\n")
+	b.printf("WUFFS_BASE__MAYBE_STATIC uint64_t\n%s(void);\n\n", g.versionCName())
+}
+
+// writeBuildMetadataImpl writes the versionCName function's definition.
+func (g *gen) writeBuildMetadataImpl(b *buffer) {
+	b.writes("// ---------------- Build Metadata Implementations\n\n")
+	b.writes("WUFFS_BASE__GENERATED_C_CODE\n")
+	b.printf("WUFFS_BASE__MAYBE_STATIC uint64_t\n%s(void) {\n", g.versionCName())
+	b.printf("return %sWUFFS_VERSION;\n", g.PKGPREFIX)
+	b.writes("}\n\n")
+}
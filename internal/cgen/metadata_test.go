@@ -0,0 +1,38 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestRecordedFlags(tt *testing.T) {
+	flags := flag.FlagSet{}
+	flags.String("package_name", "", "")
+	flags.String("prefix", "", "")
+	flags.Bool("nomalloc", false, "")
+	flags.Bool("build_metadata", false, "")
+	flags.String("fuzz_target", "", "")
+	flags.String("git_revision", "", "")
+	if err := flags.Parse([]string{
+		"-prefix=myapp_", "-nomalloc", "-build_metadata", "-fuzz_target=/tmp/f.c",
+		"-git_revision=abc", "-package_name", "zlib", "a.wuffs",
+	}); err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+
+	got := recordedFlags(&flags)
+	want := "-nomalloc=true -package_name=zlib -prefix=myapp_"
+	if got != want {
+		tt.Fatalf("got %q, want %q", got, want)
+	}
+}
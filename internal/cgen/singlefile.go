@@ -0,0 +1,196 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/wuffs/lang/wuffsroot"
+)
+
+var (
+	sfIncludeQuote = []byte("#include \"")
+	sfWmrAbove     = []byte("// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.\n")
+	sfWmrBelow     = []byte("// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING BELOW.\n")
+)
+
+// singleFile amalgamates src, the generated C code for one package, with the
+// generated C code for the packages it #include's (transitively), including
+// the base package. The result is one self-contained C file, in the same
+// shape as the monolithic release: all of the header fragments (in #include-ee
+// before #include-er order) then all of the implementation fragments.
+//
+// The base package's C code is generated afresh. Other packages' C code is
+// read from the "gen/c" directory under the Wuffs root directory, where "wuffs
+// gen" writes it.
+func singleFile(src []byte) ([]byte, error) {
+	h := singleFileHelper{
+		files: map[string]singleFileFragments{},
+	}
+	root, err := h.parse("", src)
+	if err != nil {
+		return nil, err
+	}
+
+	order := []string(nil)
+	seen := map[string]bool{}
+	if err := h.visit(&order, seen, "", root, 0); err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(nil)
+	out.WriteString("#ifndef WUFFS_INCLUDE_GUARD\n")
+	out.WriteString("#define WUFFS_INCLUDE_GUARD\n\n")
+	out.WriteString("// This file was generated by \"wuffs-c gen -single_file\". It is a\n")
+	out.WriteString("// \"single file C library\": #define WUFFS_IMPLEMENTATION before\n")
+	out.WriteString("// #include'ing or compiling it to use it as a \"foo.c\"-like implementation,\n")
+	out.WriteString("// instead of a \"foo.h\"-like header.\n\n")
+	for _, name := range order {
+		out.Write(h.files[name].header)
+		out.WriteString("\n\n")
+	}
+	out.Write(wiStartImpl[1:]) // [1:] skips the initial '\n'.
+	for _, name := range order {
+		out.Write(h.files[name].impl)
+		out.WriteString("\n\n")
+	}
+	out.Write(wiEnd[1:]) // [1:] skips the initial '\n'.
+	out.WriteString("#endif  // WUFFS_INCLUDE_GUARD\n")
+	return out.Bytes(), nil
+}
+
+type singleFileFragments struct {
+	includes []string
+	header   []byte
+	impl     []byte
+}
+
+type singleFileHelper struct {
+	files map[string]singleFileFragments
+}
+
+// parse splits a generated C file into its #include's and its header and
+// implementation fragments, discarding the parts that the monolithic release
+// also discards. The root file (the one being generated) has an empty name.
+func (h *singleFileHelper) parse(name string, s []byte) (singleFileFragments, error) {
+	displayName := name
+	if displayName == "" {
+		displayName = "the generated C code"
+	}
+	f := singleFileFragments{}
+
+	if i := bytes.Index(s, sfWmrAbove); i < 0 {
+		return f, fmt.Errorf("could not find %q in %s", sfWmrAbove, displayName)
+	} else {
+		f.includes = parseQuotedIncludes(s[:i])
+		s = s[i+len(sfWmrAbove):]
+	}
+
+	if i := bytes.LastIndex(s, sfWmrBelow); i < 0 {
+		return f, fmt.Errorf("could not find %q in %s", sfWmrBelow, displayName)
+	} else {
+		s = s[:i]
+	}
+
+	if i := bytes.Index(s, wiStartImpl); i < 0 {
+		return f, fmt.Errorf("could not find %q in %s", wiStartImpl, displayName)
+	} else {
+		f.header, s = bytes.TrimSpace(s[:i]), s[i+len(wiStartImpl):]
+	}
+
+	if i := bytes.LastIndex(s, wiEnd); i < 0 {
+		return f, fmt.Errorf("could not find %q in %s", wiEnd, displayName)
+	} else {
+		f.impl = bytes.TrimSpace(s[:i])
+	}
+
+	h.files[name] = f
+	return f, nil
+}
+
+// load returns the named file's fragments, generating or reading and then
+// parsing that file if it hasn't been seen before.
+func (h *singleFileHelper) load(name string) (singleFileFragments, error) {
+	if f, ok := h.files[name]; ok {
+		return f, nil
+	}
+
+	var s []byte
+	if name == "wuffs-base.c" {
+		b, err := generateBase()
+		if err != nil {
+			return singleFileFragments{}, err
+		}
+		s = b
+	} else {
+		wuffsRoot, err := wuffsroot.Value()
+		if err != nil {
+			return singleFileFragments{}, err
+		}
+		b, err := os.ReadFile(filepath.Join(wuffsRoot, "gen", "c", filepath.FromSlash(name)))
+		if err != nil {
+			return singleFileFragments{}, fmt.Errorf("%v (run \"wuffs gen\" to generate it)", err)
+		}
+		s = b
+	}
+	return h.parse(name, s)
+}
+
+// visit appends the names of f's (transitive) #include's and then name, f's
+// own name, to order.
+func (h *singleFileHelper) visit(order *[]string, seen map[string]bool, name string, f singleFileFragments, depth uint32) error {
+	if depth > 1024 {
+		return fmt.Errorf("single_file recursion depth too large")
+	}
+	depth++
+
+	for _, inc := range f.includes {
+		inc = strings.TrimPrefix(inc, "./")
+		if seen[inc] {
+			continue
+		}
+		seen[inc] = true
+		g, err := h.load(inc)
+		if err != nil {
+			return err
+		}
+		if err := h.visit(order, seen, inc, g, depth); err != nil {
+			return err
+		}
+	}
+
+	*order = append(*order, name)
+	return nil
+}
+
+// parseQuotedIncludes returns the sorted names in s's `#include "etc"` lines.
+func parseQuotedIncludes(s []byte) (ret []string) {
+	for remaining := []byte(nil); len(s) > 0; s, remaining = remaining, nil {
+		if i := bytes.IndexByte(s, '\n'); i >= 0 {
+			s, remaining = s[:i+1], s[i+1:]
+		}
+		if !bytes.HasPrefix(s, sfIncludeQuote) {
+			continue
+		}
+		s = s[len(sfIncludeQuote):]
+		if len(s) < 2 || s[len(s)-2] != '"' || s[len(s)-1] != '\n' {
+			continue
+		}
+		ret = append(ret, string(s[:len(s)-2]))
+	}
+	sort.Strings(ret)
+	return ret
+}
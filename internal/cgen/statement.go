@@ -11,10 +11,14 @@
 package cgen
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/google/wuffs/internal/lower"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -26,7 +30,10 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 	depth++
 
 	if n.Kind() == a.KAssert {
-		// Assertions only apply at compile-time.
+		if g.currFunk.astFunc.Test() && (n.AsAssert().Keyword() == t.IDAssert) {
+			return g.writeTestAssert(b, n.AsAssert())
+		}
+		// Other assertions only apply at compile-time.
 		return nil
 	}
 
@@ -49,6 +56,10 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 		}
 		b.printf("// %s:%d\n", filename, line)
 	}
+	if g.linedirectives {
+		filename, line := n.AsRaw().FilenameLine()
+		b.printf("#line %d %s\n", line, cStringLiteral(filepath.ToSlash(filename)))
+	}
 
 	switch n.Kind() {
 	case a.KAssign:
@@ -66,6 +77,8 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 		return g.writeStatementJump(b, n.AsJump(), depth)
 	case a.KRet:
 		return g.writeStatementRet(b, n.AsRet(), depth)
+	case a.KSwitch:
+		return g.writeStatementSwitch(b, n.AsSwitch(), depth)
 	case a.KVar:
 		return nil
 	case a.KWhile:
@@ -83,9 +96,7 @@ func (g *gen) writeStatementAssign(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr,
 	needWriteLoadExprDerivedVars := false
 	if (len(g.currFunk.derivedVars) > 0) &&
 		(rhs.Operator() == a.ExprOperatorCall) {
-		method := rhs.LHS().AsExpr()
-		recvTyp := method.LHS().MType().Pointee()
-		if (recvTyp.Decorator() == 0) && (recvTyp.QID()[0] != t.IDBase) {
+		if _, ok := rhs.Intrinsic(); !ok {
 			n := len(*b)
 			if err := g.writeSaveExprDerivedVars(b, rhs); err != nil {
 				return err
@@ -124,6 +135,9 @@ func (g *gen) writeStatementAssign(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr,
 }
 
 func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr, skipRHS bool) error {
+	if (lhs != nil) && (lhs.Operator() == a.ExprOperatorList) {
+		return g.writeStatementAssignMultiple(b, lhs, rhs)
+	}
 	lhsBuf := buffer(nil)
 	opName, closer, disableWconversion := "", "", false
 
@@ -165,6 +179,33 @@ func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr
 				b.printf("wuffs_private_impl__u%d__sat_%s_indirect(&", uBits, uOp)
 				opName, closer = ", ", ")"
 
+			case t.IDLessQuestionEq, t.IDGreaterQuestionEq:
+				fName, err := minMaxCFuncName(g.tm, op, lTyp)
+				if err != nil {
+					return err
+				}
+				b.printf("%s = %s(", lhsBuf, fName)
+				opName, closer = ", ", ")"
+
+			case t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeModStarEq:
+				if iBits := intBits(lTyp.QID()); iBits != 0 {
+					// Signed overflow is undefined behavior in C, so "x ~mod+= y"
+					// becomes "x = ((int32_t)(((uint32_t)(x)) + ((uint32_t)(y))))",
+					// with the operands widened as per signedModOperandCast.
+					binOp := t.IDXBinaryTildeModPlus
+					if op == t.IDTildeModMinusEq {
+						binOp = t.IDXBinaryTildeModMinus
+					} else if op == t.IDTildeModStarEq {
+						binOp = t.IDXBinaryTildeModStar
+					}
+					cast := signedModOperandCast(iBits)
+					b.printf("%s = ((int%d_t)((%s(", lhsBuf, iBits, cast)
+					opName = fmt.Sprintf("))%s(%s(", cOpName(binOp), cast)
+					closer = "))))"
+					break
+				}
+				fallthrough
+
 			default:
 				opName = cOpName(op)
 				if opName == "" {
@@ -228,6 +269,35 @@ func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr
 	return nil
 }
 
+func (g *gen) writeStatementAssignMultiple(b *buffer, lhs *a.Expr, rhs *a.Expr) error {
+	fTyp := rhs.LHS().AsExpr().MType()
+	recv := fTyp.Receiver().QID()
+	f := g.findAstFunc(t.QQID{recv[0], recv[1], fTyp.FuncName()})
+	if (f == nil) || (f.Outs() == nil) {
+		return fmt.Errorf("internal error: could not find multiple-value func for %q", rhs.Str(g.tm))
+	}
+	if g.currFunk.tempW > maxTemp {
+		return fmt.Errorf("too many temporary variables required")
+	}
+	temp := g.currFunk.tempW
+	g.currFunk.tempW++
+	g.currFunk.tempR++
+
+	b.printf("{\n%s %s%d = ", outsCTypeName(g.funcCName(f)), tPrefix, temp)
+	if err := g.writeExpr(b, rhs, false, 0); err != nil {
+		return err
+	}
+	b.writes(";\n")
+	for i, o := range lhs.Args() {
+		if err := g.writeExpr(b, o.AsExpr(), false, 0); err != nil {
+			return err
+		}
+		b.printf(" = %s%d.%s%s;\n", tPrefix, temp, fPrefix, f.Outs().Fields()[i].AsField().Name().Str(g.tm))
+	}
+	b.writes("}\n")
+	return nil
+}
+
 func (g *gen) writeStatementChoose(b *buffer, n *a.Choose, depth uint32) error {
 	recv := g.currFunk.astFunc.Receiver()
 	args := n.Args()
@@ -608,7 +678,10 @@ func (g *gen) writeStatementJump(b *buffer, n *a.Jump, depth uint32) error {
 	if n.Keyword() == t.IDBreak {
 		keyword = "break"
 	}
-	if n.JumpTarget() == g.currFunk.activeLoops.Top() {
+	// A C "break" inside a C "switch" would only leave the switch.
+	insideCSwitch := (n.Keyword() == t.IDBreak) &&
+		(g.currFunk.cSwitchDepth > len(g.currFunk.activeLoops))
+	if (n.JumpTarget() == g.currFunk.activeLoops.Top()) && !insideCSwitch {
 		b.printf("%s;\n", keyword)
 	} else if jt, err := g.currFunk.jumpTarget(g.tm, n.JumpTarget()); err != nil {
 		return err
@@ -670,6 +743,10 @@ func (g *gen) writeStatementRet(b *buffer, n *a.Ret, depth uint32) error {
 		}
 	}
 
+	if outs := g.currFunk.astFunc.Outs(); outs != nil {
+		return g.writeStatementRetMultiple(b, retExpr, outs, depth)
+	}
+
 	b.writes("return ")
 	if g.currFunk.astFunc.Out() == nil {
 		b.writes("wuffs_base__make_empty_struct()")
@@ -699,7 +776,127 @@ func (g *gen) writeStatementRet(b *buffer, n *a.Ret, depth uint32) error {
 	return nil
 }
 
+func (g *gen) writeStatementRetMultiple(b *buffer, retExpr *a.Expr, outs *a.Struct, depth uint32) error {
+	if g.currFunk.tempW > maxTemp {
+		return fmt.Errorf("too many temporary variables required")
+	}
+	temp := g.currFunk.tempW
+	g.currFunk.tempW++
+	g.currFunk.tempR++
+
+	b.printf("{\n%s %s%d;\n", outsCTypeName(g.currFunk.cName), tPrefix, temp)
+	for i, o := range retExpr.Args() {
+		b.printf("%s%d.%s%s = ", tPrefix, temp, fPrefix, outs.Fields()[i].AsField().Name().Str(g.tm))
+		if err := g.writeExpr(b, o.AsExpr(), false, depth); err != nil {
+			return err
+		}
+		b.writes(";\n")
+	}
+	b.printf("return %s%d;\n}\n", tPrefix, temp)
+	return nil
+}
+
+func (g *gen) writeStatementSwitch(b *buffer, n *a.Switch, depth uint32) error {
+	subject := buffer(nil)
+	if err := g.writeExpr(&subject, n.Subject(), false, 0); err != nil {
+		return err
+	}
+
+	// Coroutine suspension points are themselves "case" labels of the
+	// function-wide C switch, so they cannot be nested inside another C
+	// switch. Fall back to an if-else chain if any case body could suspend.
+	if switchCouldSuspend(n) {
+		for i, o := range n.Cases() {
+			o := o.AsCase()
+			if i > 0 {
+				b.writes("} else ")
+			}
+			if o.IsDefault() {
+				b.writes("{\n")
+			} else {
+				condition := buffer(nil)
+				for j, v := range o.Values() {
+					if j > 0 {
+						condition.writes(" || ")
+					}
+					condition.printf("(%s == ", trimParens(subject))
+					if err := g.writeExpr(&condition, v.AsExpr(), false, 0); err != nil {
+						return err
+					}
+					condition.writeb(')')
+				}
+				if len(o.Values()) == 1 {
+					// Calling trimParens avoids clang's -Wparentheses-equality
+					// warning. It is only valid for a single parenthesized
+					// comparison, not for "(etc) || (etc)".
+					condition = trimParens(condition)
+				}
+				b.printf("if (%s) {\n", condition)
+			}
+			for _, p := range o.Body() {
+				if err := g.writeStatement(b, p, depth); err != nil {
+					return err
+				}
+			}
+		}
+		b.writes("}\n")
+		return nil
+	}
+
+	oldCSwitchDepth := g.currFunk.cSwitchDepth
+	g.currFunk.cSwitchDepth = len(g.currFunk.activeLoops) + 1
+	defer func() { g.currFunk.cSwitchDepth = oldCSwitchDepth }()
+
+	b.printf("switch (%s) {\n", trimParens(subject))
+	for _, o := range n.Cases() {
+		o := o.AsCase()
+		if o.IsDefault() {
+			b.writes("default:\n")
+		}
+		for _, v := range o.Values() {
+			b.writes("case ")
+			if err := g.writeExpr(b, v.AsExpr(), false, 0); err != nil {
+				return err
+			}
+			b.writes(":\n")
+		}
+		b.writes("{\n")
+		for _, p := range o.Body() {
+			if err := g.writeStatement(b, p, depth); err != nil {
+				return err
+			}
+		}
+		if !a.Terminates(o.Body()) {
+			b.writes("break;\n")
+		}
+		b.writes("}\n")
+	}
+	b.writes("}\n")
+	return nil
+}
+
+func switchCouldSuspend(n *a.Switch) bool {
+	return n.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() == a.KExpr {
+			if o.AsExpr().Effect().Coroutine() {
+				return errCouldSuspend
+			}
+		} else if o.Kind() == a.KRet {
+			if o.AsRet().Keyword() == t.IDYield {
+				return errCouldSuspend
+			}
+		}
+		return nil
+	}) != nil
+}
+
+var errCouldSuspend = errors.New("cgen: internal error: could suspend")
+
 func (g *gen) writeStatementWhile(b *buffer, n *a.While, depth uint32) error {
+	if m, ok := lower.FindMemLoop(n); ok {
+		return g.writeMemLoop(b, n, m)
+	}
+
 	body, isTrivialLoop := n.Body(), false
 	if n.IsWhileTrue() && !n.HasContinue() && (len(body) > 0) {
 		if finalStatement := body[len(body)-1]; finalStatement.Kind() != a.KJump {
@@ -718,9 +915,14 @@ func (g *gen) writeStatementWhile(b *buffer, n *a.While, depth uint32) error {
 	}
 	g.currFunk.activeLoops.Push(n)
 
+	invariants := []*a.Expr(nil)
 	if isTrivialLoop {
 		b.writes("do {\n")
 	} else {
+		invariants = findLoopInvariants(n)
+		if err := g.writeLoopInvariants(b, invariants); err != nil {
+			return err
+		}
 		condition := buffer(nil)
 		if err := g.writeExpr(&condition, n.Condition(), false, 0); err != nil {
 			return err
@@ -740,6 +942,7 @@ func (g *gen) writeStatementWhile(b *buffer, n *a.While, depth uint32) error {
 	} else {
 		b.writes("}\n")
 	}
+	g.unwriteLoopInvariants(b, invariants)
 
 	g.currFunk.activeLoops.Pop()
 	if n.HasDeepBreak() {
@@ -0,0 +1,76 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// The hand-written C code (such as base/all-impl.c) is a text/template whose
+// actions are whole lines that look like C comments, so that the C code is
+// still valid C before expansion:
+//
+//	// ¡ {{insert "base/all-public.h"}}
+//	// ¡ {{if .Foo}}
+//	// ¡ {{end}}
+//
+// The trailing "}}\n" is part of the delimiter, so that an action line expands
+// to nothing (not even a blank line) other than the action's own output.
+const (
+	templateLeftDelim  = "// ¡ {{"
+	templateRightDelim = "}}\n"
+)
+
+// templateSections maps section names, the argument to the "insert" template
+// function, to the funcs that write those sections.
+type templateSections map[string]func(*buffer) error
+
+// sortedNames returns the section names, sorted.
+func (s templateSections) sortedNames() []string {
+	names := make([]string, 0, len(s))
+	for k := range s {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandTemplate parses src as a template and writes its expansion to b.
+// Template actions can use the standard text/template features (such as "if",
+// "range", "define" and "template") and data, the template's "dot" value. The
+// additional {{insert "name"}} function writes the named section.
+func expandTemplate(b *buffer, name string, src string, sections templateSections, data interface{}) error {
+	tmpl, err := template.New(name).
+		Delims(templateLeftDelim, templateRightDelim).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"insert": func(section string) (string, error) {
+				f := sections[section]
+				if f == nil {
+					return "", fmt.Errorf("unknown section %q, want one of: %s",
+						section, strings.Join(sections.sortedNames(), ", "))
+				}
+				buf := buffer(nil)
+				if err := f(&buf); err != nil {
+					return "", err
+				}
+				return string(buf), nil
+			},
+		}).
+		Parse(src)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(b, data)
+}
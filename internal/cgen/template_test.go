@@ -0,0 +1,123 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the testdata/*.golden files")
+
+// checkGolden compares got with the golden file, or updates the golden file
+// if the -update flag is set.
+func checkGolden(tt *testing.T, golden string, got []byte) {
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			tt.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines := bytes.Split(got, []byte("\n"))
+	wantLines := bytes.Split(want, []byte("\n"))
+	for i := 0; ; i++ {
+		if (i >= len(gotLines)) || (i >= len(wantLines)) || !bytes.Equal(gotLines[i], wantLines[i]) {
+			g, w := "(EOF)", "(EOF)"
+			if i < len(gotLines) {
+				g = string(gotLines[i])
+			}
+			if i < len(wantLines) {
+				w = string(wantLines[i])
+			}
+			tt.Fatalf("%s: line %d differs (run \"go test -update\" to update the golden file):\n"+
+				"got  %s\nwant %s", golden, i+1, g, w)
+		}
+	}
+}
+
+type testTemplateData struct {
+	Fields []string
+	Debug  bool
+}
+
+var testTemplateSections = templateSections{
+	"constants": func(b *buffer) error {
+		b.writes("#define FOO_MIN 0\n#define FOO_MAX 255\n")
+		return nil
+	},
+}
+
+// TestTemplateGolden tests expanding a template that exercises sections,
+// conditionals, loops and named sub-templates.
+func TestTemplateGolden(tt *testing.T) {
+	src, err := os.ReadFile("testdata/template.c")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	data := testTemplateData{
+		Fields: []string{"width", "height"},
+	}
+	got := buffer(nil)
+	if err := expandTemplate(&got, "template.c", string(src), testTemplateSections, data); err != nil {
+		tt.Fatal(err)
+	}
+	checkGolden(tt, "testdata/template.golden", got)
+}
+
+func TestTemplateErrors(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"// ¡ {{insert \"bogus\"}}\n", `unknown section "bogus", want one of: constants`},
+		{"// ¡ {{if .Debug}}\n", "unexpected EOF"},
+		{"// ¡ {{.Bogus}}\n", "can't evaluate field Bogus"},
+		{"// ¡ {{template \"bogus\"}}\n", `template "bogus" not defined`},
+	}
+
+	for _, tc := range testCases {
+		got := buffer(nil)
+		err := expandTemplate(&got, "test", tc.src, testTemplateSections, testTemplateData{})
+		if err == nil {
+			tt.Errorf("src=%q: got nil error, want %q", tc.src, tc.wantErr)
+		} else if !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("src=%q: got error %q, want it to contain %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+// TestTemplateBase tests expanding the base package's templates. Its C code
+// is too large to check in, so the golden file has its length (in lines) and
+// CRC-32 checksum. After editing the base directory's C code, re-run "go test
+// -update" as well as "wuffs gen base".
+func TestTemplateBase(tt *testing.T) {
+	got, err := generateBase()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if bytes.Contains(got, []byte(templateLeftDelim)) {
+		tt.Fatalf("generated base C code contains %q", templateLeftDelim)
+	}
+	checkGolden(tt, "testdata/base.golden", []byte(fmt.Sprintf("%08x %6d wuffs-base.c\n",
+		crc32.ChecksumIEEE(got), bytes.Count(got, []byte("\n")))))
+}
@@ -0,0 +1,27 @@
+// This file exercises the cgen template features. Its expansion, with the
+// data and sections given in template_test.go, is template.golden.
+
+#include <stdint.h>
+
+// ¡ {{insert "constants"}}
+
+// ¡ {{/* Action lines, like this comment, expand to nothing. */}}
+// ¡ {{define "getter"}}
+static inline uint32_t  //
+// ¡ {{printf "get_%s(const foo* self) {\n  return self->%s;\n}\n" . .}}
+// ¡ {{end}}
+typedef struct {
+// ¡ {{range .Fields}}
+// ¡ {{printf "  uint32_t %s;\n" .}}
+// ¡ {{end}}
+} foo;
+// ¡ {{range .Fields}}
+
+// ¡ {{template "getter" .}}
+// ¡ {{end}}
+
+// ¡ {{if .Debug}}
+#define FOO_DEBUG 1
+// ¡ {{else}}
+#define FOO_DEBUG 0
+// ¡ {{end}}
@@ -0,0 +1,182 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/wuffs/lib/dumbindent"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// testFailureCName is the C name of the variable that a test func's failing
+// assert sets before returning early.
+func (g *gen) testFailureCName() string {
+	return g.pkgPrefix + "test_failure"
+}
+
+// writeTestAssert writes an assert statement in a test func as a run-time
+// check. The checker assumed, instead of proving, that n's condition holds.
+func (g *gen) writeTestAssert(b *buffer, n *a.Assert) error {
+	condition := buffer(nil)
+	if err := g.writeExpr(&condition, n.Condition(), false, 0); err != nil {
+		return err
+	}
+	filename, line := n.AsNode().AsRaw().FilenameLine()
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	msg := fmt.Sprintf("%s:%d: assert %s", filename, line, n.Condition().Str(g.tm))
+	msg = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(msg)
+
+	b.printf("if (!(%s)) {\n", trimParens(condition))
+	b.printf("%s = \"%s\";\n", g.testFailureCName(), msg)
+	b.writes("return wuffs_base__make_empty_struct();\n")
+	b.writes("}\n")
+	return nil
+}
+
+// generateTestTarget returns a self-contained C program that runs the
+// package's test funcs, or nil if there are none. Each test func with a
+// receiver is called on a freshly initialized object.
+//
+// The program contains a fresh generation of the package, this time including
+// its test funcs and the private funcs and consts that only they reach,
+// amalgamated (like -single_file) with the base package and any used packages.
+func (g *gen) generateTestTarget() ([]byte, error) {
+	tests := []*a.Func(nil)
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() == a.KFunc) && tld.AsFunc().Test() {
+				tests = append(tests, tld.AsFunc())
+			}
+		}
+	}
+	if len(tests) == 0 {
+		return nil, nil
+	}
+
+	h := &gen{
+		PKGPREFIX:     g.PKGPREFIX,
+		PKGNAME:       g.PKGNAME,
+		GUARDNAME:     g.GUARDNAME,
+		pkgPrefix:     g.pkgPrefix,
+		pkgName:       g.pkgName,
+		tm:            g.tm,
+		files:         g.files,
+		nomalloc:      g.nomalloc,
+		threadSafety:  g.threadSafety,
+		target:        g.target,
+		tests:         true,
+		buildMetadata: g.buildMetadata,
+	}
+	unformatted, err := h.generate()
+	if err != nil {
+		return nil, err
+	}
+	amalgamated, err := singleFile(dumbindent.FormatBytes(nil, unformatted, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(buffer)
+	b.writes("// This file is generated by \"wuffs-c gen -test_target\". It runs the\n")
+	b.printf("// wuffs_%s package's test funcs. It is self-contained, also containing\n", g.pkgName)
+	b.writes("// the base package and any used packages:\n")
+	b.writes("//\n")
+	b.printf("// gcc -std=c99 gen/test/c/std/%s_test.c && ./a.out\n\n", g.pkgName)
+
+	b.writes("#define WUFFS_IMPLEMENTATION\n\n")
+	b.writes("#include <stdio.h>\n\n")
+	b.printf("static const char* %s = NULL;\n\n", g.testFailureCName())
+	b.writex(amalgamated)
+	b.writes("\n// ---------------- Test Runner\n\n")
+
+	for _, n := range tests {
+		if err := g.writeTestRunFunc(b, n); err != nil {
+			return nil, err
+		}
+	}
+
+	b.writes("static int  //\n")
+	b.writes("run_test(const char* name, const char* (*f)(void)) {\n")
+	b.writes("const char* msg = (*f)();\n")
+	b.writes("if (msg) {\n")
+	b.writes("printf(\"FAIL  %s: %s\\n\", name, msg);\n")
+	b.writes("return 1;\n")
+	b.writes("}\n")
+	b.writes("printf(\"ok    %s\\n\", name);\n")
+	b.writes("return 0;\n")
+	b.writes("}\n\n")
+
+	b.writes("int  //\n")
+	b.writes("main(void) {\n")
+	b.writes("int failures = 0;\n")
+	for _, n := range tests {
+		b.printf("failures += run_test(\"%s.%s\", %s__run);\n",
+			g.pkgName, n.QQID().Str(g.tm), g.funcCName(n))
+	}
+	b.writes("if (failures) {\n")
+	b.writes("printf(\"FAIL\\n\");\n")
+	b.writes("return 1;\n")
+	b.writes("}\n")
+	b.writes("printf(\"PASS\\n\");\n")
+	b.writes("return 0;\n")
+	b.writes("}\n")
+	return *b, nil
+}
+
+// writeTestRunFunc writes a wuffs_foo__bar__test_baz__run function that calls
+// the test func n and returns its failure message, or NULL if it passed.
+func (g *gen) writeTestRunFunc(b *buffer, n *a.Func) error {
+	cName := g.funcCName(n)
+	b.printf("static const char*  //\n%s__run(void) {\n", cName)
+	if recv := n.Receiver(); recv.IsZero() {
+		b.printf("%s = NULL;\n", g.testFailureCName())
+		b.printf("%s();\n", cName)
+	} else {
+		s := g.structMap[recv]
+		if s == nil {
+			return fmt.Errorf("cannot find the receiver struct for test func %q", n.QQID().Str(g.tm))
+		}
+		structName := g.pkgPrefix + recv[1].Str(g.tm)
+		b.printf("static %s self;\n", structName)
+		if s.Classy() {
+			b.printf("wuffs_base__status status = %s__initialize(\n"+
+				"&self, sizeof(self), WUFFS_VERSION, WUFFS_INITIALIZE__DEFAULT_OPTIONS);\n", structName)
+			b.writes("if (status.repr) {\nreturn status.repr;\n}\n")
+		}
+		b.printf("%s = NULL;\n", g.testFailureCName())
+		b.printf("%s(&self);\n", cName)
+	}
+	b.printf("return %s;\n", g.testFailureCName())
+	b.writes("}\n\n")
+	return nil
+}
+
+// writeTestTarget writes generateTestTarget's output to filename, or removes
+// any existing file there if the package has no test funcs.
+func (g *gen) writeTestTarget(filename string) error {
+	target, err := g.generateTestTarget()
+	if err != nil {
+		return err
+	} else if target == nil {
+		if err := os.Remove(filename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	target = dumbindent.FormatBytes(nil, target, nil)
+	return os.WriteFile(filename, target, 0644)
+}
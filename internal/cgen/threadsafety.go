@@ -0,0 +1,84 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package cgen
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// concurrentCallsCName is the C name of the error that a -thread_safety
+// package's public coroutines return when their receiver is busy.
+func (g *gen) concurrentCallsCName() string {
+	return g.pkgPrefix + "error__concurrent_coroutine_calls"
+}
+
+// writeThreadSafetyDecls writes the WUFFS_FOO__THREAD_SAFETY macro and marks
+// each public struct as a clang capability, so that clang's -Wthread-safety
+// can check that callers hold (e.g. via their own lock) a wuffs_foo__bar
+// while calling its methods.
+//
+// See https://clang.llvm.org/docs/ThreadSafetyAnalysis.html
+func (g *gen) writeThreadSafetyDecls(b *buffer) {
+	b.writes("// ---------------- Thread Safety\n\n")
+	b.writes("// This package was generated with \"wuffs-c gen -thread_safety\". It has no\n")
+	b.writes("// global mutable state (and no _Thread_local variables), so that different\n")
+	b.writes("// wuffs_foo__bar objects can be used concurrently, but each object must be\n")
+	b.writes("// used by only one thread at a time. Public coroutines return a\n")
+	b.writes("// wuffs_foo__error__concurrent_coroutine_calls error, instead of clobbering\n")
+	b.writes("// their suspended state, if their object is already busy. This is a best\n")
+	b.writes("// effort check, not a lock: there are no atomic operations.\n")
+	b.writes("//\n")
+	b.writes("// With clang, each wuffs_foo__bar is also a capability and its methods\n")
+	b.writes("// require holding it, for -Wthread-safety to check. #define\n")
+	b.writes("// WUFFS_CONFIG__DISABLE_THREAD_SAFETY_ATTRIBUTES to opt out.\n\n")
+
+	b.printf("#if !defined(%sTHREAD_SAFETY)\n", g.PKGPREFIX)
+	b.writes("#if defined(__clang__) && !defined(WUFFS_CONFIG__DISABLE_THREAD_SAFETY_ATTRIBUTES)\n")
+	b.printf("#define %sTHREAD_SAFETY(x) __attribute__((x))\n", g.PKGPREFIX)
+	b.writes("#else\n")
+	b.printf("#define %sTHREAD_SAFETY(x)\n", g.PKGPREFIX)
+	b.writes("#endif\n")
+	b.printf("#endif  // !defined(%sTHREAD_SAFETY)\n\n", g.PKGPREFIX)
+
+	for _, n := range g.structList {
+		if !n.Public() {
+			continue
+		}
+		structName := n.QID().Str(g.tm)
+		b.printf("struct %sTHREAD_SAFETY(capability(\"%s%s\")) %s%s__struct;\n",
+			g.PKGPREFIX, g.pkgPrefix, structName, g.pkgPrefix, structName)
+	}
+	b.writes("\n")
+}
+
+// writeThreadSafetyRequires writes the attribute that requires holding the
+// receiver, named self (C) or this (C++), to call the public method n. Pure
+// methods only require a shared hold.
+func (g *gen) writeThreadSafetyRequires(b *buffer, n *a.Func, receiver string) {
+	if !g.threadSafety || !n.Public() || n.Receiver().IsZero() {
+		return
+	}
+	if n.Effect().Pure() {
+		b.printf(" %sTHREAD_SAFETY(requires_shared_capability(%s))", g.PKGPREFIX, receiver)
+	} else {
+		b.printf(" %sTHREAD_SAFETY(requires_capability(%s))", g.PKGPREFIX, receiver)
+	}
+}
+
+// writeThreadSafetyOptOut writes the attribute that excludes a function
+// definition from clang's analysis. The implementation doesn't acquire
+// capabilities, even when calling a public method of a private_data field, but
+// its callers are still checked against the public prototypes.
+func (g *gen) writeThreadSafetyOptOut(b *buffer) {
+	if g.threadSafety {
+		b.printf("%sTHREAD_SAFETY(no_thread_safety_analysis)\n", g.PKGPREFIX)
+	}
+}
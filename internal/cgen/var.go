@@ -235,9 +235,9 @@ func (g *gen) couldHaveDerivedVar(n *a.Expr) bool {
 		}
 
 	case t.IDOpenParen:
-		switch n.LHS().AsExpr().Ident() {
-		case t.IDEmptyIOReader, t.IDEmptyIOWriter:
-			if n.LHS().AsExpr().LHS().AsExpr().MType().IsEtcUtilityType() {
+		if x, ok := n.Intrinsic(); ok && (x.Kind == a.IntrinsicUtility) {
+			switch x.Method {
+			case t.IDEmptyIOReader, t.IDEmptyIOWriter:
 				return false
 			}
 		}
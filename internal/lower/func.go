@@ -0,0 +1,444 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	"fmt"
+	"strconv"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// LowerFunc lowers a checked func's body to the IR.
+//
+// Coroutines and the I/O statements (such as io_bind) are not supported yet.
+// Lowering them returns an error.
+func (p *Package) LowerFunc(n *a.Func) (*Func, error) {
+	if n.Effect().Coroutine() {
+		return nil, fmt.Errorf("lower: coroutines are not supported")
+	}
+	f := &funcLowerer{
+		p:     p,
+		tm:    p.TM,
+		ast:   n,
+		loops: map[a.Loop]*Stmt{},
+	}
+	ret := &Func{AST: n}
+	for _, o := range n.Body() {
+		if o.Kind() == a.KVar {
+			o := o.AsVar()
+			ret.Locals = append(ret.Locals, Local{Name: o.Name(), Type: o.XType()})
+		}
+	}
+	body, err := f.lowerBlock(n.Body())
+	if err != nil {
+		return nil, err
+	}
+	ret.Body = body
+	return ret, nil
+}
+
+type funcLowerer struct {
+	p     *Package
+	tm    *t.Map
+	ast   *a.Func
+	loops map[a.Loop]*Stmt
+}
+
+// PosError is an error at a Wuffs source code position.
+type PosError struct {
+	Filename string
+	Line     uint32
+	Err      error
+}
+
+func (e *PosError) Error() string { return fmt.Sprintf("%s:%d: %v", e.Filename, e.Line, e.Err) }
+
+func (f *funcLowerer) lowerBlock(nodes []*a.Node) ([]*Stmt, error) {
+	ret := []*Stmt(nil)
+	for _, o := range nodes {
+		s, err := f.lowerStmt(o)
+		if err != nil {
+			if _, ok := err.(*PosError); !ok {
+				filename, line := o.AsRaw().FilenameLine()
+				err = &PosError{filename, line, err}
+			}
+			return nil, err
+		}
+		if s != nil {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
+}
+
+func (f *funcLowerer) lowerStmt(n *a.Node) (*Stmt, error) {
+	filename, line := n.AsRaw().FilenameLine()
+	s := &Stmt{Filename: filename, Line: line}
+
+	switch n.Kind() {
+	case a.KAssert, a.KVar:
+		return nil, nil
+
+	case a.KAssign:
+		n := n.AsAssign()
+		if n.Operator() == t.IDEqQuestion {
+			return nil, fmt.Errorf("lower: coroutines are not supported")
+		}
+		s.Op, s.Operator = StmtOpAssign, n.Operator()
+		if lhs := n.LHS(); lhs != nil {
+			if lhs.Operator() == a.ExprOperatorList {
+				return nil, fmt.Errorf("lower: multiple assignment is not supported")
+			}
+			var err error
+			if s.LHS, err = f.lowerExpr(lhs, 0); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if s.RHS, err = f.lowerExpr(n.RHS(), 0); err != nil {
+			return nil, err
+		}
+		return s, nil
+
+	case a.KChoose:
+		s.Op, s.Name = StmtOpChoose, n.AsChoose().Name()
+		return s, nil
+
+	case a.KIf:
+		return f.lowerIf(s, n.AsIf())
+
+	case a.KIOManip:
+		return nil, fmt.Errorf("lower: %s is not supported", n.AsIOManip().Keyword().Str(f.tm))
+
+	case a.KIterate:
+		return f.lowerIterate(s, n.AsIterate())
+
+	case a.KJump:
+		n := n.AsJump()
+		s.Op = StmtOpContinue
+		if n.Keyword() == t.IDBreak {
+			s.Op = StmtOpBreak
+		}
+		if s.Target = f.loops[n.JumpTarget()]; s.Target == nil {
+			return nil, fmt.Errorf("lower: unresolved %s", n.Keyword().Str(f.tm))
+		}
+		return s, nil
+
+	case a.KRet:
+		return f.lowerRet(s, n.AsRet())
+
+	case a.KSwitch:
+		n := n.AsSwitch()
+		s.Op = StmtOpSwitch
+		var err error
+		if s.Cond, err = f.lowerExpr(n.Subject(), 0); err != nil {
+			return nil, err
+		}
+		for _, o := range n.Cases() {
+			o := o.AsCase()
+			c := &Case{}
+			if !o.IsDefault() {
+				for _, v := range o.Values() {
+					x, err := f.lowerExpr(v.AsExpr(), 0)
+					if err != nil {
+						return nil, err
+					}
+					c.Values = append(c.Values, x)
+				}
+			}
+			if c.Body, err = f.lowerBlock(o.Body()); err != nil {
+				return nil, err
+			}
+			s.Cases = append(s.Cases, c)
+		}
+		return s, nil
+
+	case a.KWhile:
+		n := n.AsWhile()
+		if m, ok := FindMemLoop(n); ok {
+			return f.lowerMemLoop(s, n, m)
+		}
+		s.Op, s.Label = StmtOpWhile, n.Label()
+		s.HasDeepJump = n.HasDeepBreak() || n.HasDeepContinue()
+		if !n.IsWhileTrue() {
+			var err error
+			if s.Cond, err = f.lowerExpr(n.Condition(), 0); err != nil {
+				return nil, err
+			}
+		}
+		f.loops[n] = s
+		var err error
+		if s.Body, err = f.lowerBlock(n.Body()); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("lower: unrecognized ast.Kind (%s)", n.Kind())
+}
+
+func (f *funcLowerer) lowerMemLoop(s *Stmt, n *a.While, m MemLoop) (*Stmt, error) {
+	s.Op = StmtOpMemLoop
+	var err error
+	if s.Cond, err = f.lowerExpr(n.Condition(), 0); err != nil {
+		return nil, err
+	} else if s.LHS, err = f.lowerExpr(m.Dst, 0); err != nil {
+		return nil, err
+	} else if s.RHS, err = f.lowerExpr(m.Src, 0); err != nil {
+		return nil, err
+	}
+	if (s.Cond.Op != ExprOpBinary) || (s.LHS.Op != ExprOpLoad) ||
+		(m.IsCopy != (s.RHS.Op == ExprOpLoad)) {
+		return nil, fmt.Errorf("lower: internal error: inconsistent MemLoop")
+	}
+	return s, nil
+}
+
+func (f *funcLowerer) lowerIf(s *Stmt, n *a.If) (*Stmt, error) {
+	s.Op = StmtOpIf
+	var err error
+	if s.Cond, err = f.lowerExpr(n.Condition(), 0); err != nil {
+		return nil, err
+	}
+	if s.Body, err = f.lowerBlock(n.BodyIfTrue()); err != nil {
+		return nil, err
+	}
+	if elseIf := n.ElseIf(); elseIf != nil {
+		filename, line := elseIf.AsNode().AsRaw().FilenameLine()
+		e, err := f.lowerIf(&Stmt{Filename: filename, Line: line}, elseIf)
+		if err != nil {
+			return nil, err
+		}
+		s.Else = []*Stmt{e}
+	} else if s.Else, err = f.lowerBlock(n.BodyIfFalse()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (f *funcLowerer) lowerIterate(s *Stmt, n *a.Iterate) (*Stmt, error) {
+	s.Op, s.Label = StmtOpIterate, n.Label()
+	s.HasDeepJump = n.HasDeepBreak() || n.HasDeepContinue()
+	s.Iterate = &Iterate{}
+	for _, o := range n.Assigns() {
+		o := o.AsAssign()
+		slice, err := f.lowerExpr(o.RHS(), 0)
+		if err != nil {
+			return nil, err
+		}
+		s.Iterate.Vars = append(s.Iterate.Vars, o.LHS().Ident())
+		s.Iterate.Types = append(s.Iterate.Types, o.LHS().MType())
+		s.Iterate.Slices = append(s.Iterate.Slices, slice)
+	}
+	if len(s.Iterate.Vars) == 0 {
+		return nil, nil
+	}
+
+	f.loops[n] = s
+	for ; n != nil; n = n.ElseIterate() {
+		length, err := strconv.Atoi(n.Length().Str(f.tm))
+		if err != nil {
+			return nil, err
+		}
+		advance, err := strconv.Atoi(n.Advance().Str(f.tm))
+		if err != nil {
+			return nil, err
+		}
+		unroll, err := strconv.Atoi(n.Unroll().Str(f.tm))
+		if err != nil {
+			return nil, err
+		}
+		// An unrolled round is followed by a non-unrolled round of the same
+		// body, which handles the remaining elements.
+		for {
+			body, err := f.lowerBlock(n.Body())
+			if err != nil {
+				return nil, err
+			}
+			s.Iterate.Rounds = append(s.Iterate.Rounds, IterateRound{
+				Length:  length,
+				Advance: advance,
+				Unroll:  unroll,
+				Body:    body,
+			})
+			if unroll == 1 {
+				break
+			}
+			unroll = 1
+		}
+	}
+	return s, nil
+}
+
+func (f *funcLowerer) lowerRet(s *Stmt, n *a.Ret) (*Stmt, error) {
+	if n.Keyword() == t.IDYield {
+		return nil, fmt.Errorf("lower: coroutines are not supported")
+	}
+	s.Op = StmtOpReturn
+	if f.ast.Out() == nil {
+		return s, nil
+	}
+	retExpr := n.Value()
+	var err error
+	if s.RHS, err = f.lowerExpr(retExpr, 0); err != nil {
+		return nil, err
+	}
+	if retExpr.MType().IsStatus() && !n.RetsError() {
+		s.MaybeSuspension = true
+		if x := s.RHS; x.Op == ExprOpStatus {
+			s.MaybeSuspension = x.Status.IsSuspension()
+		}
+	}
+	return s, nil
+}
+
+func (f *funcLowerer) lowerExpr(n *a.Expr, depth uint32) (*Expr, error) {
+	if depth > a.MaxExprDepth {
+		return nil, fmt.Errorf("lower: expression recursion depth too large")
+	}
+	depth++
+
+	x := &Expr{Type: n.MType(), AST: n}
+	op := n.Operator()
+
+	if (op == 0) && n.GlobalIdent() {
+		if _, ok := f.p.ScalarConsts[t.QID{0, n.Ident()}]; ok {
+			x.Op, x.Name, x.Value = ExprOpGlobal, n.Ident(), n.ConstValue()
+			return x, nil
+		}
+	}
+
+	if cv := n.ConstValue(); cv != nil {
+		if typ := n.MType(); typ.IsStatus() {
+			x.Op = ExprOpStatus
+		} else if typ.IsNumTypeOrIdeal() || typ.IsBool() {
+			x.Op, x.Value = ExprOpConst, cv
+		} else {
+			return nil, fmt.Errorf("lower: unsupported constant %q of type %q", n.Str(f.tm), typ.Str(f.tm))
+		}
+		return x, nil
+	}
+
+	switch {
+	case op.IsXUnaryOp():
+		x.Op, x.Operator = ExprOpUnary, op
+		return f.lowerArgs(x, depth, n.RHS().AsExpr())
+
+	case op == t.IDXBinaryAs:
+		x.Op = ExprOpConvert
+		return f.lowerArgs(x, depth, n.LHS().AsExpr())
+
+	case op.IsXBinaryOp():
+		x.Op, x.Operator = ExprOpBinary, op
+		return f.lowerArgs(x, depth, n.LHS().AsExpr(), n.RHS().AsExpr())
+
+	case op.IsXAssociativeOp():
+		// Fold "a + b + c" into "(a + b) + c".
+		binOp := op.AmbiguousForm().BinaryForm()
+		args := n.Args()
+		lhs, err := f.lowerExpr(args[0].AsExpr(), depth)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range args[1:] {
+			rhs, err := f.lowerExpr(o.AsExpr(), depth)
+			if err != nil {
+				return nil, err
+			}
+			lhs = &Expr{Op: ExprOpBinary, Type: n.MType(), Operator: binOp, Args: []*Expr{lhs, rhs}, AST: n}
+		}
+		return lhs, nil
+	}
+
+	switch op {
+	case 0:
+		if ident := n.Ident(); ident == t.IDThis {
+			x.Op = ExprOpThis
+		} else if ident.IsDQStrLiteral(f.tm) {
+			return f.lowerStatus(x, t.QID{0, ident})
+		} else if n.GlobalIdent() {
+			x.Op, x.Name = ExprOpGlobal, ident
+		} else {
+			x.Op, x.Name = ExprOpLocal, ident
+		}
+		return x, nil
+
+	case a.ExprOperatorCall:
+		if intrinsic, ok := n.Intrinsic(); ok {
+			x.Op, x.Kind, x.Method = ExprOpBuiltin, intrinsic.Kind, intrinsic.Method
+			return f.lowerCallArgs(x, depth, intrinsic.Recv, intrinsic.Args)
+		}
+		recv, method, args, ok := n.IsMethodCall()
+		if !ok {
+			break
+		}
+		x.Op, x.Method, x.Impure = ExprOpCall, method, !n.Effect().Pure()
+		return f.lowerCallArgs(x, depth, recv, args)
+
+	case a.ExprOperatorIndex:
+		arr, index, _ := n.IsIndex()
+		x.Op, x.InBounds = ExprOpLoad, true
+		return f.lowerArgs(x, depth, arr, index)
+
+	case a.ExprOperatorSlice:
+		arr, lo, hi, _ := n.IsSlice()
+		x.Op, x.InBounds = ExprOpSlice, true
+		return f.lowerArgs(x, depth, arr, lo, hi)
+
+	case a.ExprOperatorSelector:
+		lhs := n.LHS().AsExpr()
+		if lhs.Ident() == t.IDArgs {
+			x.Op, x.Name = ExprOpArg, n.Ident()
+			return x, nil
+		} else if (lhs.Operator() == 0) && n.Ident().IsDQStrLiteral(f.tm) {
+			return f.lowerStatus(x, t.QID{lhs.Ident(), n.Ident()})
+		}
+		x.Op, x.Name = ExprOpField, n.Ident()
+		return f.lowerArgs(x, depth, lhs)
+	}
+	return nil, fmt.Errorf("lower: unsupported expression %q", n.Str(f.tm))
+}
+
+func (f *funcLowerer) lowerStatus(x *Expr, qid t.QID) (*Expr, error) {
+	z, ok := f.p.StatusMap[qid]
+	if !ok {
+		return nil, fmt.Errorf("lower: unrecognized status %s", x.AST.Str(f.tm))
+	}
+	x.Op, x.Status = ExprOpStatus, z
+	return x, nil
+}
+
+// lowerArgs sets x.Args to the lowered nodes. A nil node (such as an omitted
+// slice bound) becomes a nil Expr.
+func (f *funcLowerer) lowerArgs(x *Expr, depth uint32, nodes ...*a.Expr) (*Expr, error) {
+	x.Args = make([]*Expr, len(nodes))
+	for i, o := range nodes {
+		if o == nil {
+			continue
+		}
+		arg, err := f.lowerExpr(o, depth)
+		if err != nil {
+			return nil, err
+		}
+		x.Args[i] = arg
+	}
+	return x, nil
+}
+
+func (f *funcLowerer) lowerCallArgs(x *Expr, depth uint32, recv *a.Expr, args []*a.Node) (*Expr, error) {
+	nodes := make([]*a.Expr, 0, 1+len(args))
+	nodes = append(nodes, recv)
+	for _, o := range args {
+		nodes = append(nodes, o.AsArg().Value())
+	}
+	return f.lowerArgs(x, depth, nodes...)
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func lowerForTest(tt *testing.T, src string) (*t.Map, *Package) {
+	const filename = "test.wuffs"
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	files := []*a.File{file}
+	if _, err := check.Check(tm, files, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	p, err := Lower("test", tm, files)
+	if err != nil {
+		tt.Fatalf("Lower: %v", err)
+	}
+	return tm, p
+}
+
+func TestLowerFunc(tt *testing.T) {
+	const src = "" +
+		"pub func sum(x: array[4] base.u8) base.u32 {\n" +
+		"\tvar i : base.u32\n" +
+		"\tvar s : base.u32\n" +
+		"\twhile i < 4 {\n" +
+		"\t\ts = s | (args.x[i] as base.u32) | 1\n" +
+		"\t\ti += 1\n" +
+		"\t}\n" +
+		"\treturn s\n" +
+		"}\n"
+
+	tm, p := lowerForTest(tt, src)
+	funcs := p.Funcs()
+	if len(funcs) != 1 {
+		tt.Fatalf("len(funcs): got %d, want 1", len(funcs))
+	}
+	fn, err := p.LowerFunc(funcs[0])
+	if err != nil {
+		tt.Fatalf("LowerFunc: %v", err)
+	}
+
+	if got, want := len(fn.Locals), 2; got != want {
+		tt.Fatalf("len(Locals): got %d, want %d", got, want)
+	}
+	for i, want := range []string{"i", "s"} {
+		if got := fn.Locals[i].Name.Str(tm); got != want {
+			tt.Errorf("Locals[%d]: got %q, want %q", i, got, want)
+		}
+	}
+
+	if got, want := len(fn.Body), 2; got != want {
+		tt.Fatalf("len(Body): got %d, want %d", got, want)
+	}
+	loop := fn.Body[0]
+	if (loop.Op != StmtOpWhile) || (len(loop.Body) != 2) {
+		tt.Fatalf("Body[0]: got op %d with %d statements, want a while loop with 2", loop.Op, len(loop.Body))
+	}
+	if ret := fn.Body[1]; (ret.Op != StmtOpReturn) || (ret.RHS.Op != ExprOpLocal) {
+		tt.Errorf("Body[1]: got op %d, want a return of a local", ret.Op)
+	}
+
+	// "s | (args.x[i] as base.u32) | 1" folds to
+	// "(s | (args.x[i] as base.u32)) | 1".
+	rhs := loop.Body[0].RHS
+	if (rhs.Op != ExprOpBinary) || (rhs.Operator != t.IDXBinaryPipe) || (rhs.Args[1].Op != ExprOpConst) {
+		tt.Fatalf("RHS: got op %d, want a binary | of a const", rhs.Op)
+	}
+	lhs := rhs.Args[0]
+	if (lhs.Op != ExprOpBinary) || (lhs.Operator != t.IDXBinaryPipe) {
+		tt.Fatalf("RHS.Args[0]: got op %d, want a binary |", lhs.Op)
+	}
+	conv := lhs.Args[1]
+	if (conv.Op != ExprOpConvert) || (conv.Args[0].Op != ExprOpLoad) {
+		tt.Fatalf("RHS.Args[0].Args[1]: got op %d, want a converted load", conv.Op)
+	}
+	if load := conv.Args[0]; !load.InBounds || (load.Args[0].Op != ExprOpArg) || (load.Args[1].Op != ExprOpLocal) {
+		tt.Errorf("load: got InBounds=%t, want an in-bounds load of an arg indexed by a local", load.InBounds)
+	}
+	for _, x := range []*Expr{rhs, lhs, conv} {
+		if x.Type == nil {
+			tt.Errorf("%q: no Type", x.AST.Str(tm))
+		}
+	}
+}
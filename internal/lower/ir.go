@@ -0,0 +1,204 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Func is the lowered form of a checked func's body. Only the Rust backend
+// consumes it.
+//
+// Unlike the AST, the IR is typed throughout (every Expr has a Type), has one
+// representation for each operation (associative operators are folded into
+// binary ones and parentheses, assertions and variable declarations are gone)
+// and makes array and slice element accesses explicit, recording that the
+// checker has proven them in bounds.
+type Func struct {
+	AST    *a.Func
+	Locals []Local
+	Body   []*Stmt
+}
+
+// Local is a local variable. Wuffs declares them all at the top of a func,
+// and they start as the zero value of their type.
+type Local struct {
+	Name t.ID
+	Type *a.TypeExpr
+}
+
+// StmtOp is an IR statement's operation.
+type StmtOp uint8
+
+const (
+	StmtOpInvalid = StmtOp(iota)
+
+	// StmtOpAssign is "LHS Operator RHS". Operator is an assignment operator
+	// such as t.IDEq or t.IDTildeModPlusEq. If LHS is nil, the statement is
+	// the expression RHS, evaluated for its side effects.
+	StmtOpAssign
+
+	// StmtOpChoose is "choose Name = etc", picking a choosy func's
+	// implementation. Backends may ignore it and always call the default
+	// implementation.
+	StmtOpChoose
+
+	// StmtOpIf is "if Cond { Body } else { Else }". An "else if" chain is an
+	// Else holding a single StmtOpIf.
+	StmtOpIf
+
+	// StmtOpIterate is an iterate loop. See the Iterate type.
+	StmtOpIterate
+
+	// StmtOpBreak and StmtOpContinue jump to their Target loop, a StmtOpWhile
+	// or StmtOpIterate.
+	StmtOpBreak
+	StmtOpContinue
+
+	// StmtOpReturn is "return RHS". RHS is nil for funcs without an out type.
+	// If MaybeSuspension is set, RHS is a status that the checker could not
+	// prove isn't a suspension, which only coroutines may return.
+	StmtOpReturn
+
+	// StmtOpSwitch is "switch Cond { Cases }".
+	StmtOpSwitch
+
+	// StmtOpWhile is "while Cond { Body }". Cond is nil for "while true".
+	StmtOpWhile
+
+	// StmtOpMemLoop is a while loop that fills or copies array elements one
+	// at a time (see MemLoop). Cond is "i < n", LHS is the ExprOpLoad "x[i]"
+	// and RHS is either a constant (a fill) or the ExprOpLoad "y[i]" (a
+	// copy). Backends should fill or copy elements i .. n in bulk, if Cond
+	// holds, and then set i to n.
+	StmtOpMemLoop
+)
+
+// Stmt is an IR statement. Which fields are used depends on Op.
+type Stmt struct {
+	Op StmtOp
+
+	Filename string
+	Line     uint32
+
+	Operator t.ID
+	LHS      *Expr
+	RHS      *Expr
+
+	Cond *Expr
+	Body []*Stmt
+	Else []*Stmt
+
+	// Label is the Wuffs loop label, which may be zero, for a StmtOpWhile or
+	// StmtOpIterate. HasDeepJump is whether a break or continue in a nested
+	// loop targets this one.
+	Label       t.ID
+	HasDeepJump bool
+	Target      *Stmt
+
+	Cases   []*Case
+	Iterate *Iterate
+
+	Name t.ID
+
+	MaybeSuspension bool
+}
+
+// Case is one case of a StmtOpSwitch. A nil Values is the default case.
+type Case struct {
+	Values []*Expr
+	Body   []*Stmt
+}
+
+// Iterate is an iterate loop. Each Var (a local variable) is set to
+// successive Length-element windows of its Slice, advancing by Advance
+// elements, for as long as there are enough elements left. When there are
+// multiple Vars, their Slices are first truncated to the shortest one's
+// length. Each Round is run in turn, and afterwards each Var is empty.
+type Iterate struct {
+	Vars   []t.ID
+	Types  []*a.TypeExpr
+	Slices []*Expr
+	Rounds []IterateRound
+}
+
+// IterateRound is one round of an iterate loop, running Body while at least
+// Length+(Advance*(Unroll-1)) elements remain. The Body is unrolled Unroll
+// times, each copy seeing the next window.
+type IterateRound struct {
+	Length  int
+	Advance int
+	Unroll  int
+	Body    []*Stmt
+}
+
+// ExprOp is an IR expression's operation.
+type ExprOp uint8
+
+const (
+	ExprOpInvalid = ExprOp(iota)
+
+	ExprOpConst  // A constant number or bool: Value (zero or one for a bool).
+	ExprOpGlobal // A package-level const: Name, and Value for a scalar const.
+	ExprOpLocal  // A local variable: Name.
+	ExprOpArg    // A func argument: Name.
+	ExprOpThis   // The method receiver.
+	ExprOpField  // A struct field, "Args[0].Name".
+	ExprOpStatus // A status: Status, whose zero value means OK.
+
+	// ExprOpLoad is an array or slice element, "Args[0][Args[1]]". It can
+	// also be the LHS of an assignment (a store).
+	ExprOpLoad
+
+	// ExprOpSlice is a sub-slice, "Args[0][Args[1] .. Args[2]]". Either
+	// bound can be nil.
+	ExprOpSlice
+
+	ExprOpUnary   // "Operator Args[0]". Operator is an X-unary ID.
+	ExprOpBinary  // "Args[0] Operator Args[1]". Operator is an X-binary ID.
+	ExprOpConvert // "Args[0] as Type".
+
+	// ExprOpBuiltin is a call to a built-in method, "Args[0].Method(Args[1:])",
+	// such as "x.low_bits(n: 4)". Kind categorizes the receiver.
+	ExprOpBuiltin
+
+	// ExprOpCall is a call to a func defined in Wuffs code,
+	// "Args[0].Method(Args[1:])".
+	ExprOpCall
+)
+
+// Expr is an IR expression. Which fields are used depends on Op. Type is
+// always set.
+type Expr struct {
+	Op   ExprOp
+	Type *a.TypeExpr
+
+	Value    *big.Int
+	Name     t.ID
+	Status   Status
+	Operator t.ID
+	Method   t.ID
+	Kind     a.IntrinsicKind
+	Args     []*Expr
+
+	// Impure is whether an ExprOpCall's callee has side effects.
+	Impure bool
+
+	// InBounds, for an ExprOpLoad or ExprOpSlice, is whether the checker has
+	// proven the index or bounds valid. For checked Wuffs code, it is always
+	// true, so backends can elide any run-time bounds checks.
+	InBounds bool
+
+	AST *a.Expr
+}
@@ -0,0 +1,229 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+// Package lower holds the target-language-independent part of lowering a
+// checked Wuffs package to another programming language, shared by the code
+// generation backends (such as internal/cgen for C and internal/rsgen for
+// Rust).
+//
+// This package gathers the package-level declarations that every backend
+// needs, such as the statuses, the scalar constants and the structs in
+// dependency order.
+//
+// It also lowers func bodies to a small typed IR (see the Func type). That IR
+// is Rust-only: internal/rsgen is its only consumer. internal/cgen uses this
+// package for the package-level declarations but generates func bodies by
+// walking the checked AST, as the IR cannot represent coroutines or I/O.
+package lower
+
+import (
+	"fmt"
+
+	"github.com/google/wuffs/lang/builtin"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Status is a status (an error, note or suspension) that a package's code can
+// refer to. Its QID[0] is zero for the package's own statuses.
+type Status struct {
+	QID    t.QID
+	Msg    string
+	Public bool
+}
+
+func (z Status) FromThisPkg() bool  { return z.QID[0] == 0 }
+func (z Status) IsError() bool      { return (len(z.Msg) != 0) && (z.Msg[0] == '#') }
+func (z Status) IsSuspension() bool { return (len(z.Msg) != 0) && (z.Msg[0] == '$') }
+func (z Status) IsNote() bool       { return !z.IsError() && !z.IsSuspension() }
+
+// Category returns "error", "suspension" or "note".
+func (z Status) Category() string {
+	if z.IsError() {
+		return "error"
+	} else if z.IsSuspension() {
+		return "suspension"
+	}
+	return "note"
+}
+
+// Name returns the status message as a lower_snake_case identifier, such as
+// "bad_argument_length_too_short" for "#bad argument (length too short)". It
+// does not include the category (such as "error") or the package name.
+func (z Status) Name() string {
+	s := []byte(nil)
+	underscore := true
+	for _, r := range z.Msg {
+		if 'A' <= r && r <= 'Z' {
+			s = append(s, byte(r+'a'-'A'))
+			underscore = false
+		} else if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			s = append(s, byte(r))
+			underscore = false
+		} else if !underscore {
+			s = append(s, '_')
+			underscore = true
+		}
+	}
+	if underscore && (len(s) > 0) {
+		s = s[:len(s)-1]
+	}
+	return string(s)
+}
+
+// Package is the lowered form of a checked Wuffs package.
+type Package struct {
+	Name  string
+	TM    *t.Map
+	Files []*a.File
+
+	// Statuses lists the package's own statuses, in source order, followed
+	// by the built-in base statuses.
+	Statuses  []Status
+	StatusMap map[t.QID]Status
+
+	// ScalarConsts holds the package's constants whose values are known at
+	// compile time (as opposed to e.g. array constants).
+	ScalarConsts map[t.QID]*a.Const
+
+	// Structs lists the package's structs, topologically sorted so that a
+	// struct comes after the structs that it contains.
+	Structs   []*a.Struct
+	StructMap map[t.QID]*a.Struct
+
+	// PrivateDataFields holds the struct fields that are in the "private
+	// data" section (after the "+" in the struct definition).
+	PrivateDataFields map[t.QQID]struct{}
+
+	// ReachableFuncs and ReachableConsts hold the funcs and the non-scalar
+	// consts that are reachable from the package's public funcs (and, after
+	// IncludeTests, its test funcs). Backends can omit the rest.
+	// ReachableConsts may also hold scalar consts.
+	ReachableFuncs  map[t.QQID]struct{}
+	ReachableConsts map[t.QID]struct{}
+}
+
+// Lower gathers a checked package's package-level declarations, and which of
+// its funcs and consts are reachable.
+func Lower(pkgName string, tm *t.Map, files []*a.File) (*Package, error) {
+	p := &Package{
+		Name:              pkgName,
+		TM:                tm,
+		Files:             files,
+		StatusMap:         map[t.QID]Status{},
+		ScalarConsts:      map[t.QID]*a.Const{},
+		StructMap:         map[t.QID]*a.Struct{},
+		PrivateDataFields: map[t.QQID]struct{}{},
+		ReachableFuncs:    map[t.QQID]struct{}{},
+		ReachableConsts:   map[t.QID]struct{}{},
+	}
+
+	unsortedStructs := []*a.Struct(nil)
+	for _, file := range files {
+		for _, tld := range file.TopLevelDecls() {
+			switch tld.Kind() {
+			case a.KConst:
+				if n := tld.AsConst(); n.Value().ConstValue() != nil {
+					p.ScalarConsts[n.QID()] = n
+				}
+			case a.KStatus:
+				n := tld.AsStatus()
+				raw := n.QID()[1].Str(tm)
+				msg, ok := t.Unescape(raw)
+				if !ok || msg == "" {
+					return nil, fmt.Errorf("bad status message %q", raw)
+				}
+				p.addStatus(n.QID(), msg, n.Public())
+			case a.KStruct:
+				unsortedStructs = append(unsortedStructs, tld.AsStruct())
+			}
+		}
+	}
+
+	for _, z := range builtin.Statuses {
+		id, err := tm.Insert(z)
+		if err != nil {
+			return nil, err
+		}
+		msg, _ := t.Unescape(z)
+		if msg == "" {
+			return nil, fmt.Errorf("bad built-in status %q", z)
+		}
+		p.addStatus(t.QID{t.IDBase, id}, msg, true)
+	}
+
+	ok := false
+	p.Structs, ok = a.TopologicalSortStructs(unsortedStructs)
+	if !ok {
+		return nil, fmt.Errorf("cyclical struct definitions")
+	}
+	for _, n := range p.Structs {
+		qid := n.QID()
+		p.StructMap[qid] = n
+		for _, f := range n.Fields() {
+			if f := f.AsField(); f.PrivateData() {
+				p.PrivateDataFields[t.QQID{qid[0], qid[1], f.Name()}] = struct{}{}
+			}
+		}
+	}
+
+	if err := p.findReachable(false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Package) addStatus(qid t.QID, msg string, public bool) {
+	z := Status{
+		QID:    qid,
+		Msg:    msg,
+		Public: public,
+	}
+	p.Statuses = append(p.Statuses, z)
+	p.StatusMap[qid] = z
+}
+
+// Funcs returns the package's funcs, other than its test funcs, in source
+// order.
+func (p *Package) Funcs() (ret []*a.Func) {
+	for _, file := range p.Files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() == a.KFunc) && !tld.AsFunc().Test() {
+				ret = append(ret, tld.AsFunc())
+			}
+		}
+	}
+	return ret
+}
+
+// TestFuncs returns the package's test funcs, in source order.
+func (p *Package) TestFuncs() (ret []*a.Func) {
+	for _, file := range p.Files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() == a.KFunc) && tld.AsFunc().Test() {
+				ret = append(ret, tld.AsFunc())
+			}
+		}
+	}
+	return ret
+}
+
+// Consts returns the package's consts, in source order.
+func (p *Package) Consts() (ret []*a.Const) {
+	for _, file := range p.Files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() == a.KConst {
+				ret = append(ret, tld.AsConst())
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// MemLoop is a while loop that fills or copies array elements one at a time:
+//
+//	while i < n {
+//	    x[i] = v       // or "x[i] = y[i]".
+//	    i += 1
+//	}
+//
+// Backends can replace the loop by a bulk fill or copy of elements i .. n
+// (such as C's memset or memcpy, or Rust's fill or copy_from_slice), letting
+// the target language's library use SIMD instructions, followed by setting i
+// to n. LowerFunc produces a StmtOpMemLoop for each one. internal/cgen, which
+// does not use the IR, calls FindMemLoop directly.
+type MemLoop struct {
+	I      *a.Expr // The loop variable.
+	N      *a.Expr // The loop bound.
+	Dst    *a.Expr // "x[i]".
+	Src    *a.Expr // "v" or "y[i]".
+	IsCopy bool
+}
+
+// FindMemLoop returns whether n is a MemLoop.
+func FindMemLoop(n *a.While) (m MemLoop, ok bool) {
+	if n.HasContinue() || n.HasBreak() {
+		return MemLoop{}, false
+	}
+	cond := n.Condition()
+	if cond.Operator() != t.IDXBinaryLessThan {
+		return MemLoop{}, false
+	}
+	m.I, m.N = cond.LHS().AsExpr(), cond.RHS().AsExpr()
+	if !IsLocalVar(m.I) || !isMemLoopBound(m.N) || m.N.Mentions(m.I) {
+		return MemLoop{}, false
+	}
+
+	body := []*a.Assign(nil)
+	for _, o := range n.Body() {
+		switch o.Kind() {
+		case a.KAssert:
+			// Assertions only apply at compile-time.
+			continue
+		case a.KAssign:
+			body = append(body, o.AsAssign())
+			continue
+		}
+		return MemLoop{}, false
+	}
+	if len(body) != 2 {
+		return MemLoop{}, false
+	}
+
+	if incr := body[1]; (incr.Operator() != t.IDPlusEq) || (incr.LHS() == nil) ||
+		!incr.LHS().Eq(m.I) || !isConstValue(incr.RHS(), 1) {
+		return MemLoop{}, false
+	}
+
+	assign := body[0]
+	if (assign.Operator() != t.IDEq) || (assign.LHS() == nil) {
+		return MemLoop{}, false
+	}
+	m.Dst, m.Src = assign.LHS(), assign.RHS()
+	dstArray, ok := memLoopArray(m.Dst, m.I)
+	if !ok {
+		return MemLoop{}, false
+	}
+	elem := dstArray.MType().Inner()
+	if !elem.IsNumType() {
+		return MemLoop{}, false
+	}
+
+	if cv := m.Src.ConstValue(); cv != nil {
+		// memset's fill value is a byte, so it can only fill wider elements
+		// with zeroes.
+		if (cv.Sign() != 0) && (elem.QID()[1] != t.IDU8) && (elem.QID()[1] != t.IDI8) {
+			return MemLoop{}, false
+		}
+		return m, true
+	}
+
+	srcArray, ok := memLoopArray(m.Src, m.I)
+	if !ok || !m.Src.MType().EqIgnoringRefinements(m.Dst.MType()) ||
+		memLoopRoot(srcArray).Eq(memLoopRoot(dstArray)) {
+		// If the two arrays could be the same array, the copy could overlap,
+		// which memcpy does not allow.
+		return MemLoop{}, false
+	}
+	m.IsCopy = true
+	return m, true
+}
+
+// memLoopArray returns x for an "x[i]" expression where x is an array whose
+// evaluation does not depend on i or on any array elements.
+func memLoopArray(n *a.Expr, i *a.Expr) (*a.Expr, bool) {
+	if (n.Operator() != t.IDOpenBracket) || !n.RHS().AsExpr().Eq(i) {
+		return nil, false
+	}
+	x := n.LHS().AsExpr()
+	if !x.MType().IsEitherArrayType() || !isMemLoopPlace(x) || x.Mentions(i) {
+		return nil, false
+	}
+	return x, true
+}
+
+// memLoopRoot returns the variable or field that n, a memLoopArray, indexes
+// into, stripping any "[j]" suffixes.
+func memLoopRoot(n *a.Expr) *a.Expr {
+	for n.Operator() == t.IDOpenBracket {
+		n = n.LHS().AsExpr()
+	}
+	return n
+}
+
+// isMemLoopPlace returns whether n is a variable, a "this.foo" or "args.foo"
+// field or an element of another place, indexed by a constant or a local
+// variable.
+func isMemLoopPlace(n *a.Expr) bool {
+	switch n.Operator() {
+	case 0:
+		return IsLocalVar(n) || n.GlobalIdent()
+	case t.IDDot:
+		lhs := n.LHS().AsExpr()
+		return (lhs.Operator() == 0) && ((lhs.Ident() == t.IDThis) || (lhs.Ident() == t.IDArgs))
+	case t.IDOpenBracket:
+		index := n.RHS().AsExpr()
+		return isMemLoopPlace(n.LHS().AsExpr()) && ((index.ConstValue() != nil) || IsLocalVar(index))
+	}
+	return false
+}
+
+// isMemLoopBound returns whether n is a constant, a local variable or a
+// "this.foo" or "args.foo" field, none of which a MemLoop's stores can modify.
+func isMemLoopBound(n *a.Expr) bool {
+	return (n.ConstValue() != nil) || IsLocalVar(n) ||
+		((n.Operator() == t.IDDot) && isMemLoopPlace(n) && n.MType().IsNumType())
+}
+
+// IsLocalVar returns whether n is a local variable: a plain identifier that
+// isn't a const, a global or "this" or "args".
+func IsLocalVar(n *a.Expr) bool {
+	return (n.Operator() == 0) && !n.GlobalIdent() && (n.ConstValue() == nil) &&
+		(n.Ident() != t.IDThis) && (n.Ident() != t.IDArgs)
+}
+
+func isConstValue(n *a.Expr, v int64) bool {
+	cv := n.ConstValue()
+	return (cv != nil) && cv.IsInt64() && (cv.Int64() == v)
+}
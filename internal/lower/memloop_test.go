@@ -0,0 +1,90 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	"testing"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+func TestFindMemLoop(tt *testing.T) {
+	const (
+		notMemLoop = 0
+		isFill     = 1
+		isCopy     = 2
+	)
+
+	testCases := []struct {
+		body string
+		want int
+	}{
+		{"this.b[i] = 7", isFill},
+		{"this.w[i] = 0", isFill},
+		{"this.w[i] = 7", notMemLoop},
+		{"this.b[i] = this.c[i]", isCopy},
+		{"this.b[i] = this.b[i]", notMemLoop},
+		{"this.w[i] = this.b[i] as base.u16", notMemLoop},
+		{"this.b[i] = (i & 0xFF) as base.u8", notMemLoop},
+		{"this.b[i] = 7\n\tthis.c[i] = 7", notMemLoop},
+	}
+
+	for _, tc := range testCases {
+		src := "" +
+			"pub struct foo?(\n" +
+			"\tb : array[16] base.u8,\n" +
+			"\tc : array[16] base.u8,\n" +
+			"\tw : array[16] base.u16,\n" +
+			")\n" +
+			"\n" +
+			"pub func foo.bar!() {\n" +
+			"\tvar i : base.u32\n" +
+			"\twhile i < 16 {\n" +
+			"\t\t" + tc.body + "\n" +
+			"\t\ti += 1\n" +
+			"\t}\n" +
+			"}\n"
+
+		_, p := lowerForTest(tt, src)
+
+		got, gotOp := notMemLoop, StmtOp(0)
+		for _, f := range p.Funcs() {
+			for _, o := range f.Body() {
+				if o.Kind() != a.KWhile {
+					continue
+				} else if m, ok := FindMemLoop(o.AsWhile()); !ok {
+					got = notMemLoop
+				} else if m.IsCopy {
+					got = isCopy
+				} else {
+					got = isFill
+				}
+			}
+			lowered, err := p.LowerFunc(f)
+			if err != nil {
+				tt.Fatalf("body=%q: LowerFunc: %v", tc.body, err)
+			}
+			for _, o := range lowered.Body {
+				gotOp = o.Op
+			}
+		}
+		if got != tc.want {
+			tt.Errorf("body=%q: got %d, want %d", tc.body, got, tc.want)
+		}
+		wantOp := StmtOpMemLoop
+		if tc.want == notMemLoop {
+			wantOp = StmtOpWhile
+		}
+		if gotOp != wantOp {
+			tt.Errorf("body=%q: lowered Op: got %d, want %d", tc.body, gotOp, wantOp)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// findReachable walks the package's call graph, starting from its entry
+// points, to find the funcs and the non-scalar consts (tables) that the
+// generated code can refer to.
+//
+// The entry points are the public funcs and the choosy funcs, as every
+// struct's initializer refers to its choosy funcs' default implementations,
+// plus the test funcs if tests is true.
+func (p *Package) findReachable(tests bool) error {
+	funcs := map[t.QQID]*a.Func{}
+	queue := []*a.Func(nil)
+	for _, n := range p.Funcs() {
+		funcs[n.QQID()] = n
+		if n.Public() || n.Choosy() {
+			queue = append(queue, n)
+			p.ReachableFuncs[n.QQID()] = struct{}{}
+		}
+	}
+	if tests {
+		for _, n := range p.TestFuncs() {
+			queue = append(queue, n)
+			p.ReachableFuncs[n.QQID()] = struct{}{}
+		}
+	}
+
+	for len(queue) > 0 {
+		n := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		recv := n.Receiver()
+
+		visit := func(qqid t.QQID) {
+			if _, ok := p.ReachableFuncs[qqid]; ok {
+				return
+			} else if o := funcs[qqid]; o != nil {
+				p.ReachableFuncs[qqid] = struct{}{}
+				queue = append(queue, o)
+			}
+		}
+
+		if err := n.AsNode().Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KChoose:
+				for _, arg := range o.AsChoose().Args() {
+					visit(t.QQID{recv[0], recv[1], arg.AsExpr().Ident()})
+				}
+
+			case a.KExpr:
+				o := o.AsExpr()
+				switch o.Operator() {
+				case 0:
+					if o.GlobalIdent() {
+						p.ReachableConsts[t.QID{0, o.Ident()}] = struct{}{}
+					}
+				case t.IDOpenParen:
+					if qqid, ok := calleeQQID(o); ok {
+						visit(qqid)
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IncludeTests adds the package's test funcs, and the funcs and consts that
+// only they reach, to ReachableFuncs and ReachableConsts. A backend calls it
+// when generating a program that runs those tests.
+func (p *Package) IncludeTests() error {
+	return p.findReachable(true)
+}
+
+// calleeQQID returns the QQID of the func that n, a call expression, calls.
+// Calls to built-in methods return false.
+func calleeQQID(n *a.Expr) (t.QQID, bool) {
+	if _, ok := n.Intrinsic(); ok {
+		return t.QQID{}, false
+	}
+	method := n.LHS().AsExpr()
+	if method.Operator() != t.IDDot {
+		return t.QQID{}, false
+	}
+	recvTyp := method.LHS().AsExpr().MType()
+	if recvTyp == nil {
+		return t.QQID{}, false
+	} else if p := recvTyp.Decorator(); p == t.IDNptr || p == t.IDPtr {
+		recvTyp = recvTyp.Inner()
+	}
+	if recvTyp.Decorator() != 0 {
+		return t.QQID{}, false
+	}
+	qid := recvTyp.QID()
+	return t.QQID{qid[0], qid[1], method.Ident()}, true
+}
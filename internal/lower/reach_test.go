@@ -0,0 +1,87 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package lower
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReachable(tt *testing.T) {
+	const src = "" +
+		"pri const USED_TABLE : roarray[2] base.u8 = [1, 2]\n" +
+		"pri const UNUSED_TABLE : roarray[2] base.u8 = [3, 4]\n" +
+		"\n" +
+		"pub struct foo?(\n" +
+		"\tx : base.u32,\n" +
+		")\n" +
+		"\n" +
+		"pub func foo.bar!() {\n" +
+		"\tthis.x = this.used(i: 1)\n" +
+		"}\n" +
+		"\n" +
+		"pri func foo.used(i: base.u32[..= 1]) base.u32 {\n" +
+		"\treturn (USED_TABLE[args.i] as base.u32) ~mod+ this.leaf()\n" +
+		"}\n" +
+		"\n" +
+		"pri func foo.leaf() base.u32 {\n" +
+		"\treturn 7\n" +
+		"}\n" +
+		"\n" +
+		"pri func foo.unused() base.u32 {\n" +
+		"\treturn (UNUSED_TABLE[0] as base.u32) ~mod+ this.leaf()\n" +
+		"}\n" +
+		"\n" +
+		"test func foo.test_unused() {\n" +
+		"\tassert this.unused() == 10\n" +
+		"}\n"
+
+	tm, p := lowerForTest(tt, src)
+
+	gotFuncs := []string(nil)
+	for qqid := range p.ReachableFuncs {
+		gotFuncs = append(gotFuncs, qqid.Str(tm))
+	}
+	sort.Strings(gotFuncs)
+	if got, want := strings.Join(gotFuncs, " "), "foo.bar foo.leaf foo.used"; got != want {
+		tt.Errorf("ReachableFuncs: got %q, want %q", got, want)
+	}
+
+	gotConsts := []string(nil)
+	for qid := range p.ReachableConsts {
+		gotConsts = append(gotConsts, qid.Str(tm))
+	}
+	sort.Strings(gotConsts)
+	if got, want := strings.Join(gotConsts, " "), "USED_TABLE"; got != want {
+		tt.Errorf("ReachableConsts: got %q, want %q", got, want)
+	}
+
+	if err := p.IncludeTests(); err != nil {
+		tt.Fatalf("IncludeTests: %v", err)
+	}
+	gotFuncs = nil
+	for qqid := range p.ReachableFuncs {
+		gotFuncs = append(gotFuncs, qqid.Str(tm))
+	}
+	sort.Strings(gotFuncs)
+	if got, want := strings.Join(gotFuncs, " "), "foo.bar foo.leaf foo.test_unused foo.unused foo.used"; got != want {
+		tt.Errorf("ReachableFuncs with tests: got %q, want %q", got, want)
+	}
+	gotConsts = nil
+	for qid := range p.ReachableConsts {
+		gotConsts = append(gotConsts, qid.Str(tm))
+	}
+	sort.Strings(gotConsts)
+	if got, want := strings.Join(gotConsts, " "), "UNUSED_TABLE USED_TABLE"; got != want {
+		tt.Errorf("ReachableConsts with tests: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+// The generated package modules forbid unsafe code outright. This base module
+// only allows it for the "unchecked_index" feature's get and get_mut funcs.
+#![cfg_attr(not(feature = "unchecked_index"), forbid(unsafe_code))]
+#![allow(dead_code)]
+
+// ---------------- Status
+
+/// Status is an error, suspension or note, or OK. Its repr is None for OK.
+/// Otherwise, its repr's first byte is '#' for an error, '$' for a suspension
+/// or anything else (typically '@') for a note. The rest of the repr is the
+/// package name, a colon, a space and a human-readable message, such as
+/// "#base: bad argument".
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub struct Status {
+    pub repr: Option<&'static str>,
+}
+
+impl Status {
+    pub const OK: Status = Status { repr: None };
+
+    pub const fn new(repr: &'static str) -> Status {
+        Status { repr: Some(repr) }
+    }
+
+    pub fn is_ok(&self) -> bool {
+        self.repr.is_none()
+    }
+
+    pub fn is_error(&self) -> bool {
+        matches!(self.repr, Some(s) if s.starts_with('#'))
+    }
+
+    pub fn is_suspension(&self) -> bool {
+        matches!(self.repr, Some(s) if s.starts_with('$'))
+    }
+
+    pub fn is_note(&self) -> bool {
+        matches!(self.repr, Some(s) if !s.starts_with('#') && !s.starts_with('$'))
+    }
+
+    pub fn is_complete(&self) -> bool {
+        !self.is_error() && !self.is_suspension()
+    }
+
+    /// message returns the repr without its leading '#', '$' or '@' byte, or
+    /// "" for OK.
+    pub fn message(&self) -> &'static str {
+        match self.repr {
+            Some(s) if !s.is_empty() => &s[1..],
+            _ => "",
+        }
+    }
+
+    /// ensure_not_a_suspension converts a suspension to an error. Only
+    /// coroutines can return suspensions.
+    pub fn ensure_not_a_suspension(self) -> Status {
+        if self.is_suspension() {
+            return Status::new(ERROR_CANNOT_RETURN_A_SUSPENSION);
+        }
+        self
+    }
+}
+
+// ---------------- Bit Vectors
+
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub struct Bitvec256 {
+    pub elements_u64: [u64; 4],
+}
+
+impl Bitvec256 {
+    pub const fn new(e00: u64, e01: u64, e02: u64, e03: u64) -> Bitvec256 {
+        Bitvec256 {
+            elements_u64: [e00, e01, e02, e03],
+        }
+    }
+}
+
+// ---------------- Slices and Arrays
+
+// get and get_mut index into a slice (or an array, coerced to a slice). The
+// generated code uses them for every index that is not a constant index into
+// an array, all of which the Wuffs checker has already proven to be in
+// bounds.
+//
+// By default, they use Rust's usual bounds-checked indexing. With the
+// "unchecked_index" feature enabled, they instead trust the Wuffs checker's
+// proofs and skip the run-time bounds checks.
+
+#[cfg(not(feature = "unchecked_index"))]
+#[inline(always)]
+pub fn get<T: Copy>(s: &[T], i: usize) -> T {
+    s[i]
+}
+
+#[cfg(not(feature = "unchecked_index"))]
+#[inline(always)]
+pub fn get_mut<T>(s: &mut [T], i: usize) -> &mut T {
+    &mut s[i]
+}
+
+#[cfg(feature = "unchecked_index")]
+#[inline(always)]
+pub fn get<T: Copy>(s: &[T], i: usize) -> T {
+    debug_assert!(i < s.len());
+    // SAFETY: the Wuffs checker has proven that i < s.len().
+    unsafe { *s.get_unchecked(i) }
+}
+
+#[cfg(feature = "unchecked_index")]
+#[inline(always)]
+pub fn get_mut<T>(s: &mut [T], i: usize) -> &mut T {
+    debug_assert!(i < s.len());
+    // SAFETY: the Wuffs checker has proven that i < s.len().
+    unsafe { s.get_unchecked_mut(i) }
+}
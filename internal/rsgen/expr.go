@@ -0,0 +1,510 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package rsgen
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/wuffs/internal/lower"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// writeExpr writes n as a Rust expression. Wuffs' operator precedence rules
+// differ from Rust's, so every compound expression is fully parenthesized.
+func (g *gen) writeExpr(b *buffer, n *lower.Expr, depth uint32) error {
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("expression recursion depth too large")
+	}
+	depth++
+
+	if s, ok := g.currFunk.substs[n]; ok {
+		b.writes(s)
+		return nil
+	}
+
+	switch n.Op {
+	case lower.ExprOpConst:
+		if n.Type.IsBool() {
+			if n.Value.Sign() == 0 {
+				b.writes("false")
+			} else {
+				b.writes("true")
+			}
+			return nil
+		}
+		if n.Value.Sign() < 0 {
+			b.writeb('(')
+		}
+		b.writes(n.Value.String())
+		if n.Type.IsNumType() {
+			b.writes(n.Type.QID()[1].Str(g.tm))
+		}
+		if n.Value.Sign() < 0 {
+			b.writeb(')')
+		}
+		return nil
+
+	case lower.ExprOpGlobal:
+		b.writes(n.Name.Str(g.tm))
+		return nil
+
+	case lower.ExprOpLocal:
+		b.writes(vPrefix)
+		b.writes(n.Name.Str(g.tm))
+		return nil
+
+	case lower.ExprOpArg:
+		b.writes(aPrefix)
+		b.writes(n.Name.Str(g.tm))
+		return nil
+
+	case lower.ExprOpThis:
+		b.writes("self")
+		return nil
+
+	case lower.ExprOpField:
+		if err := g.writeExpr(b, n.Args[0], depth); err != nil {
+			return err
+		}
+		b.writes(".")
+		b.writes(fPrefix)
+		b.writes(n.Name.Str(g.tm))
+		return nil
+
+	case lower.ExprOpStatus:
+		return g.writeStatusExpr(b, n.Status)
+
+	case lower.ExprOpLoad:
+		return g.writeExprLoad(b, n, false, depth)
+
+	case lower.ExprOpSlice:
+		arr, lo, hi := n.Args[0], n.Args[1], n.Args[2]
+		b.writes("&")
+		if err := g.writeExpr(b, arr, depth); err != nil {
+			return err
+		}
+		b.writes("[")
+		if lo != nil {
+			if err := g.writeExprAsUsize(b, lo, depth); err != nil {
+				return err
+			}
+		}
+		b.writes("..")
+		if hi != nil {
+			if err := g.writeExprAsUsize(b, hi, depth); err != nil {
+				return err
+			}
+		}
+		b.writes("]")
+		return nil
+
+	case lower.ExprOpUnary:
+		return g.writeExprUnaryOp(b, n, depth)
+
+	case lower.ExprOpBinary:
+		return g.writeExprBinaryOp(b, n, depth)
+
+	case lower.ExprOpConvert:
+		typ, err := g.rsTypeName(n.Type)
+		if err != nil {
+			return err
+		}
+		b.writes("(")
+		if err := g.writeExpr(b, n.Args[0], depth); err != nil {
+			return err
+		}
+		b.printf(" as %s)", typ)
+		return nil
+
+	case lower.ExprOpBuiltin:
+		return g.writeExprBuiltin(b, n, depth)
+
+	case lower.ExprOpCall:
+		return g.writeExprUserDefinedCall(b, n, depth)
+	}
+	return fmt.Errorf("unsupported expression %q", n.AST.Str(g.tm))
+}
+
+// writeExprLoad writes n, an ExprOpLoad, as an element value or, if store is
+// set, as an assignable place.
+//
+// A constant index into an array is checked at compile time. An index that
+// the checker proved in bounds goes through the base module's get or get_mut,
+// which skip the run-time bounds check if the "unchecked_index" feature is
+// enabled. Any other index uses Rust's usual (always checked) indexing.
+func (g *gen) writeExprLoad(b *buffer, n *lower.Expr, store bool, depth uint32) error {
+	arr, index := n.Args[0], n.Args[1]
+	if (arr.Type.IsEitherArrayType() && (index.Op == lower.ExprOpConst)) || !n.InBounds {
+		if err := g.writeExpr(b, arr, depth); err != nil {
+			return err
+		}
+		b.writes("[")
+		if err := g.writeExprAsUsize(b, index, depth); err != nil {
+			return err
+		}
+		b.writes("]")
+		return nil
+	}
+
+	if store {
+		if arr.Op == lower.ExprOpLoad {
+			return fmt.Errorf("cannot assign to %q: nested indexes are not supported", n.AST.Str(g.tm))
+		}
+		b.printf("*%sget_mut(", g.basePrefix)
+	} else {
+		b.printf("%sget(", g.basePrefix)
+	}
+	if err := g.writeExprAsSlice(b, arr, store, depth); err != nil {
+		return err
+	}
+	b.writes(", ")
+	if err := g.writeExprAsUsize(b, index, depth); err != nil {
+		return err
+	}
+	b.writes(")")
+	return nil
+}
+
+func (g *gen) writeStatusExpr(b *buffer, z lower.Status) error {
+	if z.Msg == "" {
+		b.printf("%sStatus::OK", g.basePrefix)
+		return nil
+	}
+	prefix := ""
+	if !z.FromThisPkg() {
+		prefix = z.QID[0].Str(g.tm) + "::"
+	}
+	b.printf("%sStatus::new(%s%s)", g.basePrefix, prefix, statusRsName(z))
+	return nil
+}
+
+// writeExprAsSlice writes n, an array or slice, as a Rust slice (or as a
+// reference to an array, which Rust coerces to a slice). If mutable, it is a
+// mutable slice.
+func (g *gen) writeExprAsSlice(b *buffer, n *lower.Expr, mutable bool, depth uint32) error {
+	if n.Type.IsEitherArrayType() {
+		if mutable {
+			b.writes("&mut ")
+		} else {
+			b.writes("&")
+		}
+	} else if !n.Type.IsEitherSliceType() {
+		return fmt.Errorf("cannot index into %q of type %q", n.AST.Str(g.tm), n.Type.Str(g.tm))
+	} else if mutable {
+		return fmt.Errorf("cannot assign to an element of %q: mutable slices are not supported", n.AST.Str(g.tm))
+	}
+	return g.writeExpr(b, n, depth)
+}
+
+// writeExprAsUsize writes n, an index or a slice bound, as a Rust usize.
+func (g *gen) writeExprAsUsize(b *buffer, n *lower.Expr, depth uint32) error {
+	if n.Op == lower.ExprOpConst {
+		b.writes(n.Value.String())
+		return nil
+	}
+	b.writes("(")
+	if err := g.writeExpr(b, n, depth); err != nil {
+		return err
+	}
+	b.writes(" as usize)")
+	return nil
+}
+
+func (g *gen) writeExprBuiltin(b *buffer, n *lower.Expr, depth uint32) error {
+	switch n.Kind {
+	case a.IntrinsicNumType:
+		return g.writeExprNumTypeMethod(b, n, depth)
+
+	case a.IntrinsicSlice:
+		if n.Method == t.IDLength {
+			b.writes("(")
+			if err := g.writeExpr(b, n.Args[0], depth); err != nil {
+				return err
+			}
+			b.writes(".len() as u64)")
+			return nil
+		}
+
+	case a.IntrinsicUtility:
+		if n.Method.Str(g.tm) == "make_bitvec256" {
+			b.printf("%sBitvec256::new(", g.basePrefix)
+			if err := g.writeArgs(b, n.Args[1:], depth); err != nil {
+				return err
+			}
+			b.writes(")")
+			return nil
+		}
+	}
+	return fmt.Errorf("built-in method call %q is not supported", n.AST.Str(g.tm))
+}
+
+func (g *gen) writeExprNumTypeMethod(b *buffer, n *lower.Expr, depth uint32) error {
+	recv := n.Args[0]
+	if !recv.Type.IsNumType() || (len(n.Args) != 2) {
+		return fmt.Errorf("built-in method call %q is not supported", n.AST.Str(g.tm))
+	}
+	typName := recv.Type.QID()[1].Str(g.tm)
+	arg := n.Args[1]
+
+	switch n.Method {
+	case t.IDLowBits:
+		// "recv.low_bits(n:etc)" in Rust is one of:
+		//  - "(recv & constant)"
+		//  - "(recv & (1T.checked_shl(n).unwrap_or(0).wrapping_sub(1)))"
+		// The checked_shl avoids overflow when n is the full bit width.
+		b.writes("(")
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		if cv := arg.Value; (arg.Op == lower.ExprOpConst) && (cv.Sign() >= 0) && (cv.Cmp(sixtyFour) <= 0) {
+			mask := big.NewInt(0)
+			mask.Lsh(one, uint(cv.Uint64()))
+			mask.Sub(mask, one)
+			b.printf(" & 0x%s)", strings.ToUpper(mask.Text(16)))
+			return nil
+		}
+		b.printf(" & (1%s.checked_shl(", typName)
+		if err := g.writeExpr(b, arg, depth); err != nil {
+			return err
+		}
+		b.writes(" as u32).unwrap_or(0).wrapping_sub(1)))")
+		return nil
+
+	case t.IDHighBits:
+		// "recv.high_bits(n:etc)" in Rust is
+		// "recv.checked_shr(T::BITS - n).unwrap_or(0)". The checked_shr
+		// avoids overflow when n is zero.
+		b.writes("(")
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.printf(".checked_shr(%s::BITS - (", typName)
+		if err := g.writeExpr(b, arg, depth); err != nil {
+			return err
+		}
+		b.writes(" as u32)).unwrap_or(0))")
+		return nil
+
+	case t.IDMax, t.IDMin:
+		b.printf("%s::%s(", typName, n.Method.Str(g.tm))
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.writes(", ")
+		if err := g.writeExpr(b, arg, depth); err != nil {
+			return err
+		}
+		b.writes(")")
+		return nil
+	}
+	return fmt.Errorf("built-in method call %q is not supported", n.AST.Str(g.tm))
+}
+
+func (g *gen) writeExprUserDefinedCall(b *buffer, n *lower.Expr, depth uint32) error {
+	recv, args := n.Args[0], n.Args[1:]
+
+	// A method that takes "&mut self" cannot also take a slice argument that
+	// borrows from self, such as "this.up!(x: this.buf_data[..])". Copying
+	// the array into a temporary variable avoids the conflicting borrows.
+	// This differs from the C code's aliasing only if the method modifies
+	// the array while reading from the slice, which Wuffs code avoids.
+	if (recv.Op == lower.ExprOpThis) && n.Impure {
+		for _, o := range args {
+			if err := g.hoistThisArray(o); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := g.writeExpr(b, recv, depth); err != nil {
+		return err
+	}
+	b.printf(".%s(", rsIdent(n.Method.Str(g.tm)))
+	if err := g.writeArgs(b, args, depth); err != nil {
+		return err
+	}
+	b.writes(")")
+	return nil
+}
+
+func (g *gen) hoistThisArray(n *lower.Expr) error {
+	if !mentionsThis(n) {
+		return nil
+	}
+	if (n.Op == lower.ExprOpSlice) && (n.Args[0].Op == lower.ExprOpField) &&
+		(n.Args[0].Args[0].Op == lower.ExprOpThis) && n.Args[0].Type.IsEitherArrayType() {
+		arr := n.Args[0]
+		name := fmt.Sprintf("%s%d", tPrefix, g.currFunk.numTemps)
+		g.currFunk.numTemps++
+		g.currFunk.hoisted = append(g.currFunk.hoisted,
+			fmt.Sprintf("let %s = self.%s%s;\n", name, fPrefix, arr.Name.Str(g.tm)))
+		if g.currFunk.substs == nil {
+			g.currFunk.substs = map[*lower.Expr]string{}
+		}
+		g.currFunk.substs[arr] = name
+		return nil
+	}
+	if !n.Type.IsNumType() && !n.Type.IsBool() {
+		return fmt.Errorf("argument %q borrows from this while calling a mutating method", n.AST.Str(g.tm))
+	}
+	return nil
+}
+
+func mentionsThis(n *lower.Expr) bool {
+	if n == nil {
+		return false
+	} else if n.Op == lower.ExprOpThis {
+		return true
+	}
+	for _, o := range n.Args {
+		if mentionsThis(o) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	one       = big.NewInt(1)
+	sixtyFour = big.NewInt(64)
+)
+
+func (g *gen) writeArgs(b *buffer, args []*lower.Expr, depth uint32) error {
+	for i, o := range args {
+		if i > 0 {
+			b.writes(", ")
+		}
+		if err := g.writeExpr(b, o, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gen) writeExprUnaryOp(b *buffer, n *lower.Expr, depth uint32) error {
+	switch n.Operator {
+	case t.IDXUnaryPlus:
+		return g.writeExpr(b, n.Args[0], depth)
+	case t.IDXUnaryMinus:
+		b.writes("(-")
+	case t.IDXUnaryTilde, t.IDXUnaryNot:
+		b.writes("(!")
+	default:
+		return fmt.Errorf("unrecognized operator %q", n.Operator.AmbiguousForm().Str(g.tm))
+	}
+	if err := g.writeExpr(b, n.Args[0], depth); err != nil {
+		return err
+	}
+	b.writes(")")
+	return nil
+}
+
+func (g *gen) writeExprBinaryOp(b *buffer, n *lower.Expr, depth uint32) error {
+	if fName := rsMethodOpNames[n.Operator]; fName != "" {
+		return g.writeMethodOp(b, n.Type, fName, n.Args[0], n.Args[1], depth)
+	}
+
+	opName := rsOpNames[n.Operator]
+	if opName == "" {
+		return fmt.Errorf("unrecognized operator %q", n.Operator.AmbiguousForm().Str(g.tm))
+	}
+	b.writes("(")
+	if err := g.writeExpr(b, n.Args[0], depth); err != nil {
+		return err
+	}
+	b.writes(opName)
+	if err := g.writeExpr(b, n.Args[1], depth); err != nil {
+		return err
+	}
+	b.writes(")")
+	return nil
+}
+
+// writeMethodOp writes "typ::fName(lhs, rhs)", such as "u32::wrapping_add(x,
+// y)" for "x ~mod+ y".
+func (g *gen) writeMethodOp(b *buffer, typ *a.TypeExpr, fName string, lhs *lower.Expr, rhs *lower.Expr, depth uint32) error {
+	if !typ.IsNumType() {
+		return fmt.Errorf("unsupported type %q for %s", typ.Str(g.tm), fName)
+	}
+	b.printf("%s::%s(", typ.QID()[1].Str(g.tm), fName)
+	if err := g.writeExpr(b, lhs, depth); err != nil {
+		return err
+	}
+	b.writes(", ")
+	if err := g.writeExpr(b, rhs, depth); err != nil {
+		return err
+	}
+	b.writes(")")
+	return nil
+}
+
+// rsOpNames are the Rust operators for the Wuffs operators that map directly
+// to them. Rust's "<<" discards the high bits shifted out (it only checks that
+// the shift amount is less than the bit width), so it also implements Wuffs'
+// "~mod<<".
+var rsOpNames = [256]string{
+	t.IDPlusEq:           " += ",
+	t.IDMinusEq:          " -= ",
+	t.IDStarEq:           " *= ",
+	t.IDSlashEq:          " /= ",
+	t.IDShiftLEq:         " <<= ",
+	t.IDShiftREq:         " >>= ",
+	t.IDAmpEq:            " &= ",
+	t.IDPipeEq:           " |= ",
+	t.IDHatEq:            " ^= ",
+	t.IDPercentEq:        " %= ",
+	t.IDTildeModShiftLEq: " <<= ",
+	t.IDEq:               " = ",
+
+	t.IDXBinaryPlus:           " + ",
+	t.IDXBinaryMinus:          " - ",
+	t.IDXBinaryStar:           " * ",
+	t.IDXBinarySlash:          " / ",
+	t.IDXBinaryShiftL:         " << ",
+	t.IDXBinaryShiftR:         " >> ",
+	t.IDXBinaryAmp:            " & ",
+	t.IDXBinaryPipe:           " | ",
+	t.IDXBinaryHat:            " ^ ",
+	t.IDXBinaryPercent:        " % ",
+	t.IDXBinaryTildeModShiftL: " << ",
+	t.IDXBinaryNotEq:          " != ",
+	t.IDXBinaryLessThan:       " < ",
+	t.IDXBinaryLessEq:         " <= ",
+	t.IDXBinaryEqEq:           " == ",
+	t.IDXBinaryGreaterEq:      " >= ",
+	t.IDXBinaryGreaterThan:    " > ",
+	t.IDXBinaryAnd:            " && ",
+	t.IDXBinaryOr:             " || ",
+}
+
+// rsMethodOpNames are the Rust integer methods for the Wuffs operators (and
+// assignment operators) that do not map directly to Rust operators.
+var rsMethodOpNames = [256]string{
+	t.IDTildeModPlusEq:    "wrapping_add",
+	t.IDTildeModMinusEq:   "wrapping_sub",
+	t.IDTildeModStarEq:    "wrapping_mul",
+	t.IDTildeSatPlusEq:    "saturating_add",
+	t.IDTildeSatMinusEq:   "saturating_sub",
+	t.IDLessQuestionEq:    "min",
+	t.IDGreaterQuestionEq: "max",
+
+	t.IDXBinaryTildeModPlus:    "wrapping_add",
+	t.IDXBinaryTildeModMinus:   "wrapping_sub",
+	t.IDXBinaryTildeModStar:    "wrapping_mul",
+	t.IDXBinaryTildeSatPlus:    "saturating_add",
+	t.IDXBinaryTildeSatMinus:   "saturating_sub",
+	t.IDXBinaryLessQuestion:    "min",
+	t.IDXBinaryGreaterQuestion: "max",
+}
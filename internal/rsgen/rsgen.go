@@ -0,0 +1,746 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+// Package rsgen generates Rust code from checked Wuffs code.
+//
+// The generated code is safe Rust: each package's module forbids unsafe code.
+// Indexing goes through the base module's get and get_mut funcs, which are
+// bounds checked by default. The Wuffs checker has already proven every index
+// to be in bounds, so enabling the "unchecked_index" Cargo feature makes those
+// funcs skip the run-time checks, confining the unsafe code to the base
+// module.
+//
+// Only a subset of Wuffs is supported so far: enough for packages like
+// std/adler32, std/crc32 and std/sha256. Coroutines, I/O types and mutable
+// slices are not supported, and generating code that uses them fails with an
+// error.
+package rsgen
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/wuffs/internal/lower"
+	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/generate"
+
+	_ "embed"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Prefixes are prepended to names to form a namespace and to avoid e.g. "loop"
+// being a valid Wuffs variable name but not a valid Rust one.
+const (
+	aPrefix = "a_" // Function argument.
+	fPrefix = "f_" // Struct field.
+	iPrefix = "i_" // Iterate variable.
+	tPrefix = "t_" // Temporary local variable.
+	vPrefix = "v_" // Local variable.
+)
+
+// baseModule is what the generated code for non-base packages calls the base
+// package's module, via a "use super::wuffs_base as base" declaration.
+const baseModule = "base"
+
+//go:embed base/base.rs
+var embedBaseRs string
+
+// Do runs the "wuffs-rs gen" sub-command, printing the generated Rust code
+// for a Wuffs package to stdout.
+func Do(args []string) error {
+	flags := flag.FlagSet{}
+	// The wuffs tool passes these flags to every language's generator. They
+	// have no effect on the Rust code.
+	flags.Bool("genlinenum", cf.GenlinenumDefault, cf.GenlinenumUsage)
+	flags.Bool("linedirectives", cf.LinedirectivesDefault, cf.LinedirectivesUsage)
+
+	return generate.Do(&flags, "rs", args, func(pkgName string, tm *t.Map, files []*a.File) ([]byte, error) {
+		if pkgName == "base" {
+			if len(files) != 0 {
+				return nil, fmt.Errorf("base package shouldn't have any .wuffs files")
+			}
+			return generateBase()
+		}
+		p, err := lower.Lower(pkgName, tm, files)
+		if err != nil {
+			return nil, err
+		}
+		g := &gen{
+			pkgName:    pkgName,
+			tm:         tm,
+			p:          p,
+			basePrefix: baseModule + "::",
+			funcs:      map[t.QQID]*a.Func{},
+		}
+		return g.generate()
+	})
+}
+
+type buffer []byte
+
+func (b *buffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+func (b *buffer) printf(format string, args ...interface{}) { fmt.Fprintf(b, format, args...) }
+func (b *buffer) writeb(x byte)                             { *b = append(*b, x) }
+func (b *buffer) writes(s string)                           { *b = append(*b, s...) }
+func (b *buffer) writex(s []byte)                           { *b = append(*b, s...) }
+
+// atPos annotates err with a Wuffs source code position, unless it already
+// has one (from a more deeply nested node).
+func atPos(filename string, line uint32, err error) error {
+	if _, ok := err.(*lower.PosError); ok || (err == nil) {
+		return err
+	}
+	return &lower.PosError{Filename: filename, Line: line, Err: err}
+}
+
+type gen struct {
+	pkgName string
+	tm      *t.Map
+	p       *lower.Package
+
+	// basePrefix is how the generated code refers to the base module's
+	// items: "base::", or "" within the base module itself.
+	basePrefix string
+
+	funcs map[t.QQID]*a.Func
+
+	currFunk funk
+}
+
+// funk holds the state for generating a single func.
+type funk struct {
+	astFunc     *a.Func
+	activeLoops []*lower.Stmt
+	jumpTargets map[*lower.Stmt]string
+	numTemps    int
+
+	// hoisted holds statements, such as "let t_0 = self.f_buf;", that have
+	// to run before the current statement. substs maps expressions in the
+	// current statement to the temporary variables that replace them.
+	hoisted []string
+	substs  map[*lower.Expr]string
+}
+
+const header = "// Code generated by wuffs-rs. DO NOT EDIT.\n\n"
+
+func (g *gen) generate() ([]byte, error) {
+	b := &buffer{}
+	b.writes(header)
+	b.writes("#![forbid(unsafe_code)]\n")
+	b.writes("#![allow(dead_code, non_snake_case, non_upper_case_globals, unreachable_code, unused_assignments,\n" +
+		"unused_imports, unused_mut, unused_parens, unused_variables, while_true)]\n\n")
+	b.printf("use super::wuffs_base as %s;\n", baseModule)
+	for _, file := range g.p.Files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KUse {
+				continue
+			}
+			usePath, _ := t.Unescape(tld.AsUse().Path().Str(g.tm))
+			b.printf("use super::%s as %s;\n", rsModuleName(usePath), usePath[strings.LastIndexByte(usePath, '/')+1:])
+		}
+	}
+	b.writes("\n")
+
+	for _, n := range g.p.Funcs() {
+		g.funcs[n.QQID()] = n
+	}
+
+	b.writes("// ---------------- Status Codes\n\n")
+	wroteStatus := false
+	for _, z := range g.p.Statuses {
+		if !z.FromThisPkg() {
+			continue
+		}
+		g.writeStatus(b, z)
+		wroteStatus = true
+	}
+	if wroteStatus {
+		b.writes("\n")
+	}
+
+	b.writes("// ---------------- Consts\n\n")
+	for _, n := range g.p.Consts() {
+		if err := g.writeConst(b, n); err != nil {
+			return nil, atPos(n.Filename(), n.Line(), err)
+		}
+	}
+
+	b.writes("// ---------------- Structs\n\n")
+	for _, n := range g.p.Structs {
+		if err := g.writeStruct(b, n); err != nil {
+			return nil, atPos(n.Filename(), n.Line(), err)
+		}
+	}
+
+	wroteFuncs := false
+	for _, n := range g.p.Funcs() {
+		if !n.Receiver().IsZero() || skipFunc(n) {
+			continue
+		}
+		if !wroteFuncs {
+			b.writes("// ---------------- Funcs\n\n")
+			wroteFuncs = true
+		}
+		if err := g.writeFunc(b, n); err != nil {
+			return nil, err
+		}
+	}
+
+	return indent(*b), nil
+}
+
+func generateBase() ([]byte, error) {
+	tm := &t.Map{}
+	p, err := lower.Lower("base", tm, nil)
+	if err != nil {
+		return nil, err
+	}
+	g := &gen{
+		pkgName: "base",
+		tm:      tm,
+		p:       p,
+	}
+
+	b := &buffer{}
+	b.writes(header)
+	s := embedBaseRs
+	if strings.HasPrefix(s, "// Copyright ") {
+		if i := strings.Index(s, "\n\n"); i >= 0 {
+			s = s[i+2:]
+		}
+	}
+	b.writes(s)
+
+	b.writes("\n// ---------------- Status Codes\n\n")
+	for _, z := range g.p.Statuses {
+		g.writeStatus(b, z)
+	}
+
+	b.writes("\n// ---------------- Interfaces\n")
+	if err := g.writeInterfaces(b); err != nil {
+		return nil, err
+	}
+	return indent(*b), nil
+}
+
+// writeInterfaces writes a Rust trait for each of the built-in interfaces
+// (such as base.hasher_u32) whose methods' types are all supported.
+func (g *gen) writeInterfaces(b *buffer) error {
+	ifaceTM := &t.Map{}
+	methods := map[string][]*a.Func{}
+	if err := builtin.ParseFuncs(ifaceTM, builtin.InterfaceFuncs, func(f *a.Func) error {
+		name := f.Receiver()[1].Str(ifaceTM)
+		methods[name] = append(methods[name], f)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	ig := *g
+	ig.tm = ifaceTM
+loop:
+	for _, iface := range builtin.Interfaces {
+		tb := buffer(nil)
+		tb.printf("\npub trait %s {\n", camelCase(iface))
+		for _, f := range methods[iface] {
+			if err := ig.writeFuncSignature(&tb, f, false); err != nil {
+				continue loop
+			}
+			tb.writes(";\n")
+		}
+		tb.writes("}\n")
+		b.writex(tb)
+	}
+	return nil
+}
+
+func (g *gen) writeStatus(b *buffer, z lower.Status) {
+	if z.Public {
+		b.writes("pub ")
+	}
+	b.printf("const %s: &str = %s;\n", statusRsName(z),
+		rsStringLiteral(z.Msg[:1]+g.pkgName+": "+z.Msg[1:]))
+}
+
+// statusRsName returns the Rust name of a status' &str constant, such as
+// "ERROR_BAD_ARGUMENT" for "#bad argument".
+func statusRsName(z lower.Status) string {
+	return strings.ToUpper(z.Category() + "_" + z.Name())
+}
+
+func (g *gen) writeConst(b *buffer, n *a.Const) error {
+	writeDocComment(b, n.Doc())
+	typ, err := g.rsTypeName(n.XType())
+	if err != nil {
+		return err
+	}
+	pub := ""
+	if n.Public() {
+		pub = "pub "
+	}
+	name := n.QID()[1].Str(g.tm)
+	if cv := n.Value().ConstValue(); cv != nil {
+		b.printf("%sconst %s: %s = %s;\n\n", pub, name, typ, cv.String())
+		return nil
+	}
+	// Array constants are statics, not consts, so that each use does not
+	// copy the (possibly large) array.
+	b.printf("%sstatic %s: %s = ", pub, name, typ)
+	if err := g.writeConstList(b, n.Value(), 0); err != nil {
+		return err
+	}
+	b.writes(";\n\n")
+	return nil
+}
+
+func (g *gen) writeConstList(b *buffer, n *a.Expr, depth uint32) error {
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("expression recursion depth too large")
+	}
+	depth++
+
+	if cv := n.ConstValue(); cv != nil {
+		b.writes(cv.String())
+		return nil
+	}
+	args, ok := n.IsList()
+	if !ok {
+		return fmt.Errorf("invalid const value %q", n.Str(g.tm))
+	}
+	b.writes("[\n")
+	for i, o := range args {
+		if err := g.writeConstList(b, o.AsExpr(), depth); err != nil {
+			return err
+		}
+		b.writeb(',')
+		if (o.AsExpr().ConstValue() == nil) || (i == len(args)-1) || ((i & 7) == 7) {
+			b.writeb('\n')
+		} else {
+			b.writeb(' ')
+		}
+	}
+	b.writes("]")
+	return nil
+}
+
+func (g *gen) writeStruct(b *buffer, n *a.Struct) error {
+	name := camelCase(n.QID()[1].Str(g.tm))
+	pub := ""
+	if n.Public() {
+		pub = "pub "
+	}
+
+	fields := []*a.Field(nil)
+	for _, o := range n.Fields() {
+		o := o.AsField()
+		if o.XType().IsEtcUtilityType() {
+			// The base.utility type has no state.
+			continue
+		}
+		fields = append(fields, o)
+	}
+
+	writeDocComment(b, n.Doc())
+	b.printf("#[derive(Clone)]\n%sstruct %s {\n", pub, name)
+	for _, o := range fields {
+		typ, err := g.rsTypeName(o.XType())
+		if err != nil {
+			return fmt.Errorf("field %s: %v", o.Name().Str(g.tm), err)
+		}
+		b.printf("%s%s: %s,\n", fPrefix, o.Name().Str(g.tm), typ)
+	}
+	b.writes("}\n\n")
+
+	// Rust's #[derive(Default)] does not work for arrays longer than 32
+	// elements, so write the Default impl by hand.
+	b.printf("impl Default for %s {\nfn default() -> Self {\n%s {\n", name, name)
+	for _, o := range fields {
+		b.printf("%s%s: ", fPrefix, o.Name().Str(g.tm))
+		if err := g.writeZeroValue(b, o.XType()); err != nil {
+			return err
+		}
+		b.writes(",\n")
+	}
+	b.writes("}\n}\n}\n\n")
+
+	b.printf("impl %s {\n", name)
+	b.printf("%sfn new() -> Self {\nSelf::default()\n}\n", pub)
+	for _, o := range g.p.Funcs() {
+		if (o.Receiver() != n.QID()) || skipFunc(o) {
+			continue
+		}
+		b.writes("\n")
+		if err := g.writeFunc(b, o); err != nil {
+			return err
+		}
+	}
+	b.writes("}\n\n")
+
+	for _, o := range n.Implements() {
+		if err := g.writeImplements(b, n, o.AsTypeExpr()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeImplements writes the Rust trait impl for a "implements base.etc"
+// struct, forwarding to the struct's own (inherent) methods.
+func (g *gen) writeImplements(b *buffer, n *a.Struct, iface *a.TypeExpr) error {
+	ifaceName := iface.QID()[1].Str(g.tm)
+	ifaceTM := &t.Map{}
+	methods := []*a.Func(nil)
+	if err := builtin.ParseFuncs(ifaceTM, builtin.InterfaceFuncs, func(f *a.Func) error {
+		if f.Receiver()[1].Str(ifaceTM) == ifaceName {
+			methods = append(methods, f)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	b.printf("impl %s%s for %s {\n", g.basePrefix, camelCase(ifaceName), camelCase(n.QID()[1].Str(g.tm)))
+	for i, m := range methods {
+		qqid := t.QQID{n.QID()[0], n.QID()[1], g.tm.ByName(m.FuncName().Str(ifaceTM))}
+		f := g.funcs[qqid]
+		if f == nil {
+			return fmt.Errorf("struct %s does not define %s.%s",
+				n.QID().Str(g.tm), ifaceName, m.FuncName().Str(ifaceTM))
+		}
+		if i > 0 {
+			b.writes("\n")
+		}
+		if err := g.writeFuncSignature(b, f, false); err != nil {
+			return err
+		}
+		b.printf(" {\nSelf::%s(self", rsIdent(f.FuncName().Str(g.tm)))
+		for _, o := range f.In().Fields() {
+			b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+		}
+		b.writes(")\n}\n")
+	}
+	b.writes("}\n\n")
+	return nil
+}
+
+// skipFunc returns whether to skip generating n. The funcs that use CPU
+// architecture specific (SIMD) intrinsics are skipped and choosy funcs always
+// use their portable implementation.
+func skipFunc(n *a.Func) bool {
+	return n.HasChooseCPUArch()
+}
+
+func (g *gen) writeFuncSignature(b *buffer, n *a.Func, withBody bool) error {
+	if n.Effect().Coroutine() {
+		return fmt.Errorf("coroutines (\"?\" funcs) are not supported")
+	}
+	if n.Outs() != nil {
+		return fmt.Errorf("multiple return values are not supported")
+	}
+
+	if withBody && n.Public() {
+		b.writes("pub ")
+	}
+	b.printf("fn %s(", rsIdent(n.FuncName().Str(g.tm)))
+	comma := false
+	if !n.Receiver().IsZero() {
+		if n.Effect().Pure() {
+			b.writes("&self")
+		} else {
+			b.writes("&mut self")
+		}
+		comma = true
+	}
+	for _, o := range n.In().Fields() {
+		o := o.AsField()
+		typ, err := g.rsTypeName(o.XType())
+		if err != nil {
+			return fmt.Errorf("arg %s: %v", o.Name().Str(g.tm), err)
+		}
+		if comma {
+			b.writes(", ")
+		}
+		comma = true
+		if withBody {
+			// Wuffs code can re-assign its args, such as "args.x = args.x[1 ..]".
+			b.writes("mut ")
+		}
+		b.printf("%s%s: %s", aPrefix, o.Name().Str(g.tm), typ)
+	}
+	b.writes(")")
+
+	if out := n.Out(); out != nil {
+		typ, err := g.rsTypeName(out)
+		if err != nil {
+			return fmt.Errorf("return type: %v", err)
+		}
+		b.printf(" -> %s", typ)
+	}
+	return nil
+}
+
+func (g *gen) writeFunc(b *buffer, n *a.Func) error {
+	g.currFunk = funk{
+		astFunc: n,
+	}
+	if err := g.writeFunc1(b, n); err != nil {
+		return atPos(n.Filename(), n.Line(), fmt.Errorf("func %s: %v", n.QQID().Str(g.tm), err))
+	}
+	return nil
+}
+
+func (g *gen) writeFunc1(b *buffer, n *a.Func) error {
+	writeDocComment(b, n.Doc())
+	if err := g.writeFuncSignature(b, n, true); err != nil {
+		return err
+	}
+	b.writes(" {\n")
+
+	fn, err := g.p.LowerFunc(n)
+	if err != nil {
+		return err
+	}
+	for _, o := range fn.Locals {
+		typ, err := g.rsTypeName(o.Type)
+		if err != nil {
+			return fmt.Errorf("var %s: %v", o.Name.Str(g.tm), err)
+		}
+		b.printf("let mut %s%s: %s = ", vPrefix, o.Name.Str(g.tm), typ)
+		if err := g.writeZeroValue(b, o.Type); err != nil {
+			return err
+		}
+		b.writes(";\n")
+	}
+
+	for _, o := range fn.Body {
+		if err := g.writeStatement(b, o, 0); err != nil {
+			return err
+		}
+	}
+
+	if out := n.Out(); (out != nil) && !n.BodyEndsWithReturn() {
+		b.writes("return ")
+		if err := g.writeZeroValue(b, out); err != nil {
+			return err
+		}
+		b.writes(";\n")
+	}
+	b.writes("}\n")
+	return nil
+}
+
+func (g *gen) rsTypeName(n *a.TypeExpr) (string, error) {
+	switch n.Decorator() {
+	case 0:
+		qid := n.QID()
+		if n.IsNumType() {
+			return qid[1].Str(g.tm), nil
+		} else if n.IsBool() {
+			return "bool", nil
+		} else if n.IsStatus() {
+			return g.basePrefix + "Status", nil
+		} else if (qid[0] == t.IDBase) && (qid[1] == t.IDBitvec256) {
+			return g.basePrefix + "Bitvec256", nil
+		} else if qid[0] == 0 {
+			if _, ok := g.p.StructMap[qid]; ok {
+				return camelCase(qid[1].Str(g.tm)), nil
+			}
+		} else if qid[0] != t.IDBase {
+			return qid[0].Str(g.tm) + "::" + camelCase(qid[1].Str(g.tm)), nil
+		}
+
+	case t.IDArray, t.IDRoarray:
+		inner, err := g.rsTypeName(n.Inner())
+		if err != nil {
+			return "", err
+		}
+		cv := n.ArrayLength().ConstValue()
+		if cv == nil {
+			return "", fmt.Errorf("invalid array length for type %q", n.Str(g.tm))
+		}
+		return fmt.Sprintf("[%s; %v]", inner, cv), nil
+
+	case t.IDRoslice:
+		inner, err := g.rsTypeName(n.Inner())
+		if err != nil {
+			return "", err
+		}
+		return "&[" + inner + "]", nil
+
+	case t.IDSlice:
+		return "", fmt.Errorf("mutable slice type %q is not supported", n.Str(g.tm))
+	}
+	return "", fmt.Errorf("type %q is not supported", n.Str(g.tm))
+}
+
+func (g *gen) writeZeroValue(b *buffer, n *a.TypeExpr) error {
+	switch n.Decorator() {
+	case 0:
+		if n.IsNumType() {
+			b.writes("0")
+			return nil
+		} else if n.IsBool() {
+			b.writes("false")
+			return nil
+		} else if n.IsStatus() {
+			b.printf("%sStatus::OK", g.basePrefix)
+			return nil
+		}
+		if _, err := g.rsTypeName(n); err != nil {
+			return err
+		}
+		b.writes("Default::default()")
+		return nil
+
+	case t.IDArray, t.IDRoarray:
+		b.writes("[")
+		if err := g.writeZeroValue(b, n.Inner()); err != nil {
+			return err
+		}
+		b.printf("; %v]", n.ArrayLength().ConstValue())
+		return nil
+
+	case t.IDRoslice:
+		b.writes("&[]")
+		return nil
+	}
+	_, err := g.rsTypeName(n)
+	return err
+}
+
+// writeDocComment writes a Wuffs "///" doc comment, such as that returned by
+// Func.Doc, as a Rust "///" doc comment.
+func writeDocComment(b *buffer, doc []string) {
+	for _, line := range doc {
+		b.writes(line)
+		b.writeb('\n')
+	}
+}
+
+// camelCase converts a Wuffs snake_case name to a Rust CamelCase type name,
+// such as "IeeeHasher" for "ieee_hasher".
+func camelCase(s string) string {
+	b := make([]byte, 0, len(s))
+	upper := true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && ('a' <= c) && (c <= 'z') {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// rsModuleName returns the Rust module name for a Wuffs package path, such as
+// "wuffs_std_crc32" for "std/crc32". It matches the generated file's name,
+// such as "wuffs-std-crc32.rs", with dashes replaced by underscores.
+func rsModuleName(path string) string {
+	return "wuffs_" + strings.Map(func(r rune) rune {
+		if (r == '/') || (r == '-') {
+			return '_'
+		}
+		return r
+	}, path)
+}
+
+// rsKeywords are the Rust keywords that are valid Wuffs func names.
+var rsKeywords = map[string]bool{
+	"abstract": true, "as": true, "async": true, "await": true, "become": true,
+	"box": true, "break": true, "const": true, "continue": true, "crate": true,
+	"do": true, "dyn": true, "else": true, "enum": true, "extern": true,
+	"false": true, "final": true, "fn": true, "for": true, "if": true,
+	"impl": true, "in": true, "let": true, "loop": true, "macro": true,
+	"match": true, "mod": true, "move": true, "mut": true, "override": true,
+	"priv": true, "pub": true, "ref": true, "return": true, "static": true,
+	"struct": true, "trait": true, "true": true, "try": true, "type": true,
+	"typeof": true, "unsafe": true, "unsized": true, "use": true, "virtual": true,
+	"where": true, "while": true, "yield": true,
+}
+
+// rsIdent returns s as a Rust identifier, escaping it as a raw identifier
+// (such as "r#type") if it is a Rust keyword.
+func rsIdent(s string) string {
+	if rsKeywords[s] {
+		return "r#" + s
+	}
+	return s
+}
+
+// rsStringLiteral returns s as a double-quoted Rust string literal.
+func rsStringLiteral(s string) string {
+	b := []byte{'"'}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case (c == '"') || (c == '\\'):
+			b = append(b, '\\', c)
+		case (c < 0x20) || (c == 0x7F):
+			b = append(b, fmt.Sprintf("\\x%02X", c)...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(append(b, '"'))
+}
+
+// indent re-indents the generated Rust code, four spaces per level. The
+// generated code puts each opening bracket ('{', '[' or '(') at the end of a
+// line and each matching closing bracket at the start of a line, so the
+// nesting depth follows from the lines' first and last bytes.
+//
+// Unlike lib/dumbindent, it does not try to skip over string literals, which
+// in Rust would be confused by loop labels and lifetimes such as 'static.
+func indent(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+(len(src)/2))
+	depth := 0
+	for len(src) > 0 {
+		line := src
+		if i := strings.IndexByte(string(src), '\n'); i >= 0 {
+			line, src = src[:i], src[i+1:]
+		} else {
+			src = nil
+		}
+		line = []byte(strings.TrimSpace(string(line)))
+		if len(line) == 0 {
+			dst = append(dst, '\n')
+			continue
+		}
+		isComment := strings.HasPrefix(string(line), "//")
+		if !isComment && (depth > 0) {
+			if c := line[0]; (c == '}') || (c == ']') || (c == ')') {
+				depth--
+			}
+		}
+		for i := 0; i < depth; i++ {
+			dst = append(dst, "    "...)
+		}
+		dst = append(dst, line...)
+		dst = append(dst, '\n')
+		if !isComment {
+			if c := line[len(line)-1]; (c == '{') || (c == '[') || (c == '(') {
+				depth++
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package rsgen
+
+import (
+	"testing"
+)
+
+func TestNames(tt *testing.T) {
+	testCases := []struct {
+		f    func(string) string
+		src  string
+		want string
+	}{
+		{camelCase, "hasher", "Hasher"},
+		{camelCase, "ieee_hasher", "IeeeHasher"},
+		{camelCase, "decoder_x86_avx2", "DecoderX86Avx2"},
+		{rsModuleName, "base", "wuffs_base"},
+		{rsModuleName, "std/crc32", "wuffs_std_crc32"},
+		{rsIdent, "update", "update"},
+		{rsIdent, "type", "r#type"},
+		{rsStringLiteral, "#base: bad argument", `"#base: bad argument"`},
+		{rsStringLiteral, "a\"b\\c\nd", `"a\"b\\c\x0Ad"`},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.f(tc.src); got != tc.want {
+			tt.Errorf("src=%q: got %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestIndent(tt *testing.T) {
+	const src = "" +
+		"fn f(&self) -> u32 {\n" +
+		"'label_0: loop {\n" +
+		"// Comments do not { change the depth.\n" +
+		"if x {\n" +
+		"break 'label_0;\n" +
+		"} else {\n" +
+		"continue;\n" +
+		"}\n" +
+		"}\n" +
+		"\n" +
+		"return 0;\n" +
+		"}\n"
+
+	const want = "" +
+		"fn f(&self) -> u32 {\n" +
+		"    'label_0: loop {\n" +
+		"        // Comments do not { change the depth.\n" +
+		"        if x {\n" +
+		"            break 'label_0;\n" +
+		"        } else {\n" +
+		"            continue;\n" +
+		"        }\n" +
+		"    }\n" +
+		"\n" +
+		"    return 0;\n" +
+		"}\n"
+
+	if got := string(indent([]byte(src))); got != want {
+		tt.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
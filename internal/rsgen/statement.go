@@ -0,0 +1,408 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package rsgen
+
+import (
+	"fmt"
+
+	"github.com/google/wuffs/internal/lower"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+func (g *gen) writeStatement(b *buffer, n *lower.Stmt, depth uint32) error {
+	if depth > a.MaxBodyDepth {
+		return fmt.Errorf("body recursion depth too large")
+	}
+	depth++
+
+	if err := g.writeStatement1(b, n, depth); err != nil {
+		return atPos(n.Filename, n.Line, err)
+	}
+	return nil
+}
+
+func (g *gen) writeStatement1(b *buffer, n *lower.Stmt, depth uint32) error {
+	switch n.Op {
+	case lower.StmtOpAssign:
+		return g.writeHoisting(b, func(b *buffer) error {
+			return g.writeStatementAssign(b, n, depth)
+		})
+
+	case lower.StmtOpChoose:
+		// Choosy funcs always call their default implementation.
+		return nil
+
+	case lower.StmtOpIf:
+		return g.writeStatementIf(b, n, depth)
+
+	case lower.StmtOpIterate:
+		return g.writeStatementIterate(b, n, depth)
+
+	case lower.StmtOpBreak, lower.StmtOpContinue:
+		return g.writeStatementJump(b, n)
+
+	case lower.StmtOpReturn:
+		return g.writeHoisting(b, func(b *buffer) error {
+			return g.writeStatementRet(b, n, depth)
+		})
+
+	case lower.StmtOpSwitch:
+		return g.writeStatementSwitch(b, n, depth)
+
+	case lower.StmtOpWhile:
+		return g.writeStatementWhile(b, n, depth)
+
+	case lower.StmtOpMemLoop:
+		return g.writeStatementMemLoop(b, n, depth)
+	}
+	return fmt.Errorf("unrecognized lower.StmtOp (%d) for writeStatement", n.Op)
+}
+
+// writeHoisting calls f to write a statement. If writing that statement
+// hoisted any temporary variables, the statement and those variables'
+// declarations are wrapped in a block.
+func (g *gen) writeHoisting(b *buffer, f func(b *buffer) error) error {
+	stmt := buffer(nil)
+	err := f(&stmt)
+	hoisted := g.currFunk.hoisted
+	g.currFunk.hoisted, g.currFunk.substs = nil, nil
+	if err != nil {
+		return err
+	}
+	if len(hoisted) == 0 {
+		b.writex(stmt)
+		return nil
+	}
+	b.writes("{\n")
+	for _, h := range hoisted {
+		b.writes(h)
+	}
+	b.writex(stmt)
+	b.writes("}\n")
+	return nil
+}
+
+// writeCondition writes n, an if, while or switch subject expression (or an
+// iterate loop's slice), which has nowhere to hoist temporary variables to.
+func (g *gen) writeCondition(b *buffer, n *lower.Expr, depth uint32) error {
+	if err := g.writeExpr(b, n, depth); err != nil {
+		return err
+	}
+	if len(g.currFunk.hoisted) > 0 {
+		g.currFunk.hoisted, g.currFunk.substs = nil, nil
+		return fmt.Errorf("condition %q borrows from this while calling a mutating method", n.AST.Str(g.tm))
+	}
+	return nil
+}
+
+func (g *gen) writeStatementAssign(b *buffer, n *lower.Stmt, depth uint32) error {
+	lhs, rhs := n.LHS, n.RHS
+	if lhs == nil {
+		if err := g.writeExpr(b, rhs, depth); err != nil {
+			return err
+		}
+		b.writes(";\n")
+		return nil
+	}
+
+	if fName := rsMethodOpNames[n.Operator]; fName != "" {
+		// Rust evaluates an assignment's right hand side before its left
+		// hand side, so the "get" call does not conflict with "get_mut".
+		if err := g.writeLHS(b, lhs, depth); err != nil {
+			return err
+		}
+		b.writes(" = ")
+		if err := g.writeMethodOp(b, lhs.Type, fName, lhs, rhs, depth); err != nil {
+			return err
+		}
+		b.writes(";\n")
+		return nil
+	}
+
+	opName := rsOpNames[n.Operator]
+	if opName == "" {
+		return fmt.Errorf("unrecognized operator %q", n.Operator.AmbiguousForm().Str(g.tm))
+	}
+	if err := g.writeLHS(b, lhs, depth); err != nil {
+		return err
+	}
+	b.writes(opName)
+	if err := g.writeExpr(b, rhs, depth); err != nil {
+		return err
+	}
+	b.writes(";\n")
+	return nil
+}
+
+// writeLHS writes n as a Rust place expression, the left hand side of an
+// assignment.
+func (g *gen) writeLHS(b *buffer, n *lower.Expr, depth uint32) error {
+	if n.Op == lower.ExprOpLoad {
+		return g.writeExprLoad(b, n, true, depth)
+	}
+	return g.writeExpr(b, n, depth)
+}
+
+func (g *gen) writeStatementIf(b *buffer, n *lower.Stmt, depth uint32) error {
+	b.writes("if ")
+	for {
+		if err := g.writeCondition(b, n.Cond, 0); err != nil {
+			return err
+		}
+		b.writes(" {\n")
+		for _, o := range n.Body {
+			if err := g.writeStatement(b, o, depth); err != nil {
+				return err
+			}
+		}
+		if (len(n.Else) == 1) && (n.Else[0].Op == lower.StmtOpIf) {
+			n = n.Else[0]
+			b.writes("} else if ")
+			continue
+		}
+		if len(n.Else) > 0 {
+			b.writes("} else {\n")
+			for _, o := range n.Else {
+				if err := g.writeStatement(b, o, depth); err != nil {
+					return err
+				}
+			}
+		}
+		break
+	}
+	b.writes("}\n")
+	return nil
+}
+
+func (g *gen) writeStatementIterate(b *buffer, n *lower.Stmt, depth uint32) error {
+	it := n.Iterate
+	names := make([]string, len(it.Vars))
+	for i, v := range it.Vars {
+		names[i] = v.Str(g.tm)
+	}
+
+	b.writes("{\n")
+	for i, name := range names {
+		typ, err := g.rsTypeName(it.Types[i])
+		if err != nil {
+			return err
+		}
+		b.printf("let mut %sslice_%s: %s = ", iPrefix, name, typ)
+		if err := g.writeCondition(b, it.Slices[i], depth); err != nil {
+			return err
+		}
+		b.writes(";\n")
+	}
+	if len(names) > 1 {
+		// Truncate every slice to the shortest one's length.
+		b.printf("let %slen = %sslice_%s.len()", iPrefix, iPrefix, names[0])
+		for _, name := range names[1:] {
+			b.printf(".min(%sslice_%s.len())", iPrefix, name)
+		}
+		b.writes(";\n")
+		for _, name := range names {
+			b.printf("%sslice_%s = &%sslice_%s[..%slen];\n", iPrefix, name, iPrefix, name, iPrefix)
+		}
+	}
+
+	for _, r := range it.Rounds {
+		b.printf("while %sslice_%s.len() >= %d {\n", iPrefix, names[0], r.Length+(r.Advance*(r.Unroll-1)))
+		for i := 0; i < r.Unroll; i++ {
+			for _, name := range names {
+				b.printf("%s%s = &%sslice_%s[..%d];\n", vPrefix, name, iPrefix, name, r.Length)
+			}
+			for _, o := range r.Body {
+				if err := g.writeStatement(b, o, depth); err != nil {
+					return err
+				}
+			}
+			for _, name := range names {
+				b.printf("%sslice_%s = &%sslice_%s[%d..];\n", iPrefix, name, iPrefix, name, r.Advance)
+			}
+		}
+		b.writes("}\n")
+	}
+
+	for _, name := range names {
+		b.printf("%s%s = &[];\n", vPrefix, name)
+	}
+	b.writes("}\n")
+	return nil
+}
+
+func (g *gen) writeStatementJump(b *buffer, n *lower.Stmt) error {
+	keyword := "continue"
+	if n.Op == lower.StmtOpBreak {
+		keyword = "break"
+	}
+	if n.Target.Op == lower.StmtOpIterate {
+		// Each unrolled copy of the body ends by advancing the slices, which
+		// a Rust break or continue would skip.
+		return fmt.Errorf("%s inside iterate is not supported", keyword)
+	}
+	if loops := g.currFunk.activeLoops; (len(loops) > 0) && (loops[len(loops)-1] == n.Target) {
+		b.printf("%s;\n", keyword)
+		return nil
+	}
+	label, ok := g.currFunk.jumpTargets[n.Target]
+	if !ok {
+		return fmt.Errorf("no label for %s", keyword)
+	}
+	b.printf("%s '%s;\n", keyword, label)
+	return nil
+}
+
+func (g *gen) writeStatementRet(b *buffer, n *lower.Stmt, depth uint32) error {
+	if n.RHS == nil {
+		b.writes("return;\n")
+		return nil
+	}
+	b.writes("return ")
+	if err := g.writeExpr(b, n.RHS, depth); err != nil {
+		return err
+	}
+	if n.MaybeSuspension {
+		b.writes(".ensure_not_a_suspension()")
+	}
+	b.writes(";\n")
+	return nil
+}
+
+func (g *gen) writeStatementSwitch(b *buffer, n *lower.Stmt, depth uint32) error {
+	b.writes("match ")
+	if err := g.writeCondition(b, n.Cond, 0); err != nil {
+		return err
+	}
+	b.writes(" {\n")
+	hasDefault := false
+	for _, o := range n.Cases {
+		if o.Values == nil {
+			hasDefault = true
+			b.writes("_")
+		} else {
+			for i, v := range o.Values {
+				if i > 0 {
+					b.writes(" | ")
+				}
+				if err := g.writeExpr(b, v, 0); err != nil {
+					return err
+				}
+			}
+		}
+		b.writes(" => {\n")
+		for _, p := range o.Body {
+			if err := g.writeStatement(b, p, depth); err != nil {
+				return err
+			}
+		}
+		b.writes("}\n")
+	}
+	if !hasDefault {
+		b.writes("_ => {}\n")
+	}
+	b.writes("}\n")
+	return nil
+}
+
+func (g *gen) writeStatementWhile(b *buffer, n *lower.Stmt, depth uint32) error {
+	if n.HasDeepJump {
+		label := ""
+		if n.Label != 0 {
+			label = "label_" + n.Label.Str(g.tm)
+		} else {
+			label = fmt.Sprintf("label_%d", len(g.currFunk.jumpTargets))
+		}
+		if g.currFunk.jumpTargets == nil {
+			g.currFunk.jumpTargets = map[*lower.Stmt]string{}
+		}
+		g.currFunk.jumpTargets[n] = label
+		b.printf("'%s: ", label)
+	}
+
+	if n.Cond == nil {
+		b.writes("loop {\n")
+	} else {
+		b.writes("while ")
+		if err := g.writeCondition(b, n.Cond, 0); err != nil {
+			return err
+		}
+		b.writes(" {\n")
+	}
+
+	g.currFunk.activeLoops = append(g.currFunk.activeLoops, n)
+	for _, o := range n.Body {
+		if err := g.writeStatement(b, o, depth); err != nil {
+			return err
+		}
+	}
+	g.currFunk.activeLoops = g.currFunk.activeLoops[:len(g.currFunk.activeLoops)-1]
+	b.writes("}\n")
+	return nil
+}
+
+// writeStatementMemLoop writes n, a fill or copy loop, as a call to fill or
+// copy_from_slice on the destination array's elements i .. n, followed by
+// setting i to n, as the while loop would have left it.
+func (g *gen) writeStatementMemLoop(b *buffer, n *lower.Stmt, depth uint32) error {
+	i, bound, dst := n.Cond.Args[0], n.Cond.Args[1], n.LHS.Args[0]
+	if !dst.Type.IsEitherArrayType() {
+		return fmt.Errorf("cannot assign to an element of %q: mutable slices are not supported", dst.AST.Str(g.tm))
+	} else if dst.Op == lower.ExprOpLoad {
+		return fmt.Errorf("cannot assign to %q: nested indexes are not supported", n.LHS.AST.Str(g.tm))
+	}
+
+	writeRange := func(b *buffer, arr *lower.Expr) error {
+		if err := g.writeExpr(b, arr, depth); err != nil {
+			return err
+		}
+		b.writes("[")
+		if err := g.writeExprAsUsize(b, i, depth); err != nil {
+			return err
+		}
+		b.writes("..")
+		if err := g.writeExprAsUsize(b, bound, depth); err != nil {
+			return err
+		}
+		b.writes("]")
+		return nil
+	}
+
+	b.writes("if ")
+	if err := g.writeCondition(b, n.Cond, 0); err != nil {
+		return err
+	}
+	b.writes(" {\n")
+	if err := writeRange(b, dst); err != nil {
+		return err
+	}
+	if n.RHS.Op == lower.ExprOpLoad {
+		b.writes(".copy_from_slice(&")
+		if err := writeRange(b, n.RHS.Args[0]); err != nil {
+			return err
+		}
+	} else {
+		b.writes(".fill(")
+		if err := g.writeExpr(b, n.RHS, depth); err != nil {
+			return err
+		}
+	}
+	b.writes(");\n")
+	if err := g.writeExpr(b, i, depth); err != nil {
+		return err
+	}
+	b.writes(" = ")
+	if err := g.writeExpr(b, bound, depth); err != nil {
+		return err
+	}
+	b.writes(";\n}\n")
+	return nil
+}
@@ -36,6 +36,7 @@ const (
 	KArg
 	KAssert
 	KAssign
+	KCase
 	KChoose
 	KConst
 	KExpr
@@ -49,6 +50,7 @@ const (
 	KRet
 	KStatus
 	KStruct
+	KSwitch
 	KTypeExpr
 	KUse
 	KVar
@@ -68,6 +70,7 @@ var kindStrings = [...]string{
 	KArg:      "KArg",
 	KAssert:   "KAssert",
 	KAssign:   "KAssign",
+	KCase:     "KCase",
 	KChoose:   "KChoose",
 	KConst:    "KConst",
 	KExpr:     "KExpr",
@@ -81,12 +84,21 @@ var kindStrings = [...]string{
 	KRet:      "KRet",
 	KStatus:   "KStatus",
 	KStruct:   "KStruct",
+	KSwitch:   "KSwitch",
 	KTypeExpr: "KTypeExpr",
 	KUse:      "KUse",
 	KVar:      "KVar",
 	KWhile:    "KWhile",
 }
 
+// Span is the half-open range [Begin, End) of indexes into the []token.Token
+// slice that a node was parsed from. Nodes that were not parsed from source,
+// such as those synthesized by the type checker, have a zero Span.
+type Span struct {
+	Begin int
+	End   int
+}
+
 type Flags uint32
 
 const (
@@ -105,6 +117,11 @@ const (
 	FlagsPrivateData      = Flags(0x00020000)
 	FlagsChoosy           = Flags(0x00040000)
 	FlagsHasChooseCPUArch = Flags(0x00080000)
+	FlagsErrorKeyword     = Flags(0x00100000)
+	FlagsTruncate         = Flags(0x00200000)
+	FlagsSecret           = Flags(0x00400000)
+	FlagsTest             = Flags(0x00800000)
+	FlagsInline           = Flags(0x01000000)
 )
 
 func breakFlags(deep bool) Flags {
@@ -163,10 +180,13 @@ type Node struct {
 	constValue *big.Int
 	mBounds    interval.IntRange
 	mType      *TypeExpr
+	mIntrinsic IntrinsicKind
 	jumpTarget Loop
 
 	filename string
 	line     uint32
+	col      uint32
+	span     Span
 
 	// The idX fields' meaning depend on what kind of node it is.
 	//
@@ -175,11 +195,12 @@ type Node struct {
 	// Arg           .             .             name          Arg
 	// Assert        keyword       .             lit(reason)   Assert
 	// Assign        operator      .             .             Assign
+	// Case          keyword       .             .             Case
 	// Choose        .             .             name          Choose
 	// Const         .             pkg           name          Const
 	// Expr          operator      .             literal/ident Expr
 	// Field         .             .             name          Field
-	// File          .             .             .             File
+	// File          .             .             lit(prefix)   File
 	// Func          funcName      receiverPkg   receiverName  Func
 	// IOManip       keyword       .             .             IOManip
 	// If            .             likelihood    .             If
@@ -188,6 +209,7 @@ type Node struct {
 	// Ret           keyword       .             .             Ret
 	// Status        keyword       pkg           lit(message)  Status
 	// Struct        .             pkg           name          Struct
+	// Switch        .             .             .             Switch
 	// TypeExpr      decorator     pkg           name          TypeExpr
 	// Use           .             .             lit(path)     Use
 	// Var           operator      .             name          Var
@@ -203,17 +225,22 @@ type Node struct {
 	list0 []*Node
 	list1 []*Node
 	list2 []*Node
+
+	// doc holds a top-level declaration's "///" doc comment lines, if any.
+	doc []string
 }
 
 func (n *Node) Kind() Kind                     { return n.kind }
 func (n *Node) MBounds() interval.IntRange     { return n.mBounds }
 func (n *Node) MType() *TypeExpr               { return n.mType }
+func (n *Node) Span() Span                     { return n.span }
 func (n *Node) SetMBounds(x interval.IntRange) { n.mBounds = x }
 func (n *Node) SetMType(x *TypeExpr)           { n.mType = x }
 
 func (n *Node) AsArg() *Arg           { return (*Arg)(n) }
 func (n *Node) AsAssert() *Assert     { return (*Assert)(n) }
 func (n *Node) AsAssign() *Assign     { return (*Assign)(n) }
+func (n *Node) AsCase() *Case         { return (*Case)(n) }
 func (n *Node) AsChoose() *Choose     { return (*Choose)(n) }
 func (n *Node) AsConst() *Const       { return (*Const)(n) }
 func (n *Node) AsExpr() *Expr         { return (*Expr)(n) }
@@ -228,30 +255,23 @@ func (n *Node) AsRaw() *Raw           { return (*Raw)(n) }
 func (n *Node) AsRet() *Ret           { return (*Ret)(n) }
 func (n *Node) AsStatus() *Status     { return (*Status)(n) }
 func (n *Node) AsStruct() *Struct     { return (*Struct)(n) }
+func (n *Node) AsSwitch() *Switch     { return (*Switch)(n) }
 func (n *Node) AsTypeExpr() *TypeExpr { return (*TypeExpr)(n) }
 func (n *Node) AsUse() *Use           { return (*Use)(n) }
 func (n *Node) AsVar() *Var           { return (*Var)(n) }
 func (n *Node) AsWhile() *While       { return (*While)(n) }
 
+// Walk calls f for n and then, recursively, for each of n's sub-nodes. It is
+// a simpler form of the package-level Walk function, without exit calls or
+// node replacement.
 func (n *Node) Walk(f func(*Node) error) error {
-	if n != nil {
-		if err := f(n); err != nil {
-			return err
+	_, err := Walk(n, func(o *Node, exit bool) (*Node, error) {
+		if exit {
+			return nil, nil
 		}
-		for _, o := range n.AsRaw().SubNodes() {
-			if err := o.Walk(f); err != nil {
-				return err
-			}
-		}
-		for _, l := range n.AsRaw().SubLists() {
-			for _, o := range l {
-				if err := o.Walk(f); err != nil {
-					return err
-				}
-			}
-		}
-	}
-	return nil
+		return nil, f(o)
+	})
+	return err
 }
 
 func dropExprCachedMBounds(n *Node) error {
@@ -305,10 +325,14 @@ type Raw Node
 func (n *Raw) AsNode() *Node                  { return (*Node)(n) }
 func (n *Raw) Flags() Flags                   { return n.flags }
 func (n *Raw) FilenameLine() (string, uint32) { return n.filename, n.line }
+func (n *Raw) Col() uint32                    { return n.col }
 func (n *Raw) SubNodes() [3]*Node             { return [3]*Node{n.lhs, n.mhs, n.rhs} }
 func (n *Raw) SubLists() [3][]*Node           { return [3][]*Node{n.list0, n.list1, n.list2} }
 
+func (n *Raw) SetDoc(doc []string)                { n.doc = doc }
 func (n *Raw) SetFilenameLine(f string, l uint32) { n.filename, n.line = f, l }
+func (n *Raw) SetCol(c uint32)                    { n.col = c }
+func (n *Raw) SetSpan(s Span)                     { n.span = s }
 
 func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 	return n.AsNode().Walk(func(o *Node) error {
@@ -373,6 +397,9 @@ const MaxExprDepth = 255
 //
 // For selectors, like "LHS.ID2", ID0 is IDDot.
 //
+// For conversions, like "LHS as RHS", ID0 is IDXBinaryAs and RHS is a
+// TypeExpr. FlagsTruncate is set for "LHS as RHS via truncate".
+//
 // For lists, like "[0, 1, 2]", ID0 is IDComma.
 type Expr Node
 
@@ -384,24 +411,27 @@ const (
 	ExprOperatorSlice    = t.IDDotDot
 )
 
-func (n *Expr) AsNode() *Node              { return (*Node)(n) }
-func (n *Expr) Effect() Effect             { return Effect(n.flags) }
-func (n *Expr) GlobalIdent() bool          { return n.flags&FlagsGlobalIdent != 0 }
-func (n *Expr) SubExprHasEffect() bool     { return n.flags&FlagsSubExprHasEffect != 0 }
-func (n *Expr) ConstValue() *big.Int       { return n.constValue }
-func (n *Expr) MBounds() interval.IntRange { return n.mBounds }
-func (n *Expr) MType() *TypeExpr           { return n.mType }
-func (n *Expr) Operator() t.ID             { return n.id0 }
-func (n *Expr) Ident() t.ID                { return n.id2 }
-func (n *Expr) LHS() *Node                 { return n.lhs }
-func (n *Expr) MHS() *Node                 { return n.mhs }
-func (n *Expr) RHS() *Node                 { return n.rhs }
-func (n *Expr) Args() []*Node              { return n.list0 }
-
-func (n *Expr) SetConstValue(x *big.Int)       { n.constValue = x }
-func (n *Expr) SetGlobalIdent()                { n.flags |= FlagsGlobalIdent }
-func (n *Expr) SetMBounds(x interval.IntRange) { n.mBounds = x }
-func (n *Expr) SetMType(x *TypeExpr)           { n.mType = x }
+func (n *Expr) AsNode() *Node                { return (*Node)(n) }
+func (n *Expr) Effect() Effect               { return Effect(n.flags) }
+func (n *Expr) GlobalIdent() bool            { return n.flags&FlagsGlobalIdent != 0 }
+func (n *Expr) SubExprHasEffect() bool       { return n.flags&FlagsSubExprHasEffect != 0 }
+func (n *Expr) Truncates() bool              { return n.flags&FlagsTruncate != 0 }
+func (n *Expr) ConstValue() *big.Int         { return n.constValue }
+func (n *Expr) MBounds() interval.IntRange   { return n.mBounds }
+func (n *Expr) MType() *TypeExpr             { return n.mType }
+func (n *Expr) Operator() t.ID               { return n.id0 }
+func (n *Expr) Ident() t.ID                  { return n.id2 }
+func (n *Expr) LHS() *Node                   { return n.lhs }
+func (n *Expr) MHS() *Node                   { return n.mhs }
+func (n *Expr) RHS() *Node                   { return n.rhs }
+func (n *Expr) Args() []*Node                { return n.list0 }
+func (n *Expr) IntrinsicKind() IntrinsicKind { return n.mIntrinsic }
+
+func (n *Expr) SetConstValue(x *big.Int)         { n.constValue = x }
+func (n *Expr) SetIntrinsicKind(x IntrinsicKind) { n.mIntrinsic = x }
+func (n *Expr) SetGlobalIdent()                  { n.flags |= FlagsGlobalIdent }
+func (n *Expr) SetMBounds(x interval.IntRange)   { n.mBounds = x }
+func (n *Expr) SetMType(x *TypeExpr)             { n.mType = x }
 
 func (n *Expr) IsArgsDotFoo() (foo t.ID) {
 	if (n.id0 == t.IDDot) && (n.lhs.id0 == 0) && (n.lhs.id2 == t.IDArgs) {
@@ -575,6 +605,7 @@ type Var Node
 func (n *Var) AsNode() *Node    { return (*Node)(n) }
 func (n *Var) Filename() string { return n.filename }
 func (n *Var) Line() uint32     { return n.line }
+func (n *Var) Col() uint32      { return n.col }
 func (n *Var) Name() t.ID       { return n.id2 }
 func (n *Var) XType() *TypeExpr { return n.lhs.AsTypeExpr() }
 
@@ -588,12 +619,14 @@ func NewVar(name t.ID, xType *TypeExpr) *Var {
 
 // Field is a "name : type" struct field:
 //   - FlagsPrivateData is the initializer need not explicitly memset to zero.
+//   - FlagsSecret      is the field (or func argument) is declared "secret".
 //   - ID2:   name
 //   - LHS:   <TypeExpr>
 type Field Node
 
 func (n *Field) AsNode() *Node     { return (*Node)(n) }
 func (n *Field) PrivateData() bool { return n.flags&FlagsPrivateData != 0 }
+func (n *Field) Secret() bool      { return n.flags&FlagsSecret != 0 }
 func (n *Field) Name() t.ID        { return n.id2 }
 func (n *Field) XType() *TypeExpr  { return n.lhs.AsTypeExpr() }
 
@@ -746,6 +779,47 @@ func NewIf(likelihood t.ID, condition *Expr, bodyIfTrue []*Node, bodyIfFalse []*
 	}
 }
 
+// Switch is "switch MHS { List0 }":
+//   - MHS:   <Expr>
+//   - List0: <Case>, with any "default" Case last
+type Switch Node
+
+func (n *Switch) AsNode() *Node  { return (*Node)(n) }
+func (n *Switch) Subject() *Expr { return n.mhs.AsExpr() }
+func (n *Switch) Cases() []*Node { return n.list0 }
+func (n *Switch) HasDefault() bool {
+	return (len(n.list0) > 0) && n.list0[len(n.list0)-1].AsCase().IsDefault()
+}
+
+func NewSwitch(subject *Expr, cases []*Node) *Switch {
+	return &Switch{
+		kind:  KSwitch,
+		mhs:   subject.AsNode(),
+		list0: cases,
+	}
+}
+
+// Case is "case List0 { List2 }" or "default { List2 }", within a Switch:
+//   - ID0:   <IDCase|IDDefault>
+//   - List0: <Expr> values, empty for "default"
+//   - List2: <Statement> body
+type Case Node
+
+func (n *Case) AsNode() *Node   { return (*Node)(n) }
+func (n *Case) Keyword() t.ID   { return n.id0 }
+func (n *Case) IsDefault() bool { return n.id0 == t.IDDefault }
+func (n *Case) Values() []*Node { return n.list0 }
+func (n *Case) Body() []*Node   { return n.list2 }
+
+func NewCase(keyword t.ID, values []*Node, body []*Node) *Case {
+	return &Case{
+		kind:  KCase,
+		id0:   keyword,
+		list0: values,
+		list2: body,
+	}
+}
+
 // Choose is "choose ID2: List0":
 //   - ID2:   name
 //   - List0: <Expr> method names.
@@ -765,22 +839,25 @@ func NewChoose(name t.ID, args []*Node) *Choose {
 
 // Ret is "return LHS" or "yield LHS":
 //   - FlagsReturnsError LHS is an error status
+//   - FlagsErrorKeyword the source was return error "msg", and LHS is "#msg"
 //   - ID0:   <IDReturn|IDYield>
 //   - LHS:   <Expr>
 type Ret Node
 
-func (n *Ret) AsNode() *Node   { return (*Node)(n) }
-func (n *Ret) RetsError() bool { return n.flags&FlagsRetsError != 0 }
-func (n *Ret) Keyword() t.ID   { return n.id0 }
-func (n *Ret) Value() *Expr    { return n.lhs.AsExpr() }
+func (n *Ret) AsNode() *Node         { return (*Node)(n) }
+func (n *Ret) RetsError() bool       { return n.flags&FlagsRetsError != 0 }
+func (n *Ret) HasErrorKeyword() bool { return n.flags&FlagsErrorKeyword != 0 }
+func (n *Ret) Keyword() t.ID         { return n.id0 }
+func (n *Ret) Value() *Expr          { return n.lhs.AsExpr() }
 
 func (n *Ret) SetRetsError() { n.flags |= FlagsRetsError }
 
-func NewRet(keyword t.ID, value *Expr) *Ret {
+func NewRet(flags Flags, keyword t.ID, value *Expr) *Ret {
 	return &Ret{
-		kind: KRet,
-		id0:  keyword,
-		lhs:  value.AsNode(),
+		kind:  KRet,
+		flags: flags,
+		id0:   keyword,
+		lhs:   value.AsNode(),
 	}
 }
 
@@ -1013,6 +1090,11 @@ func (n *TypeExpr) IsSmallInteger() bool {
 		(n.id2 == t.IDU8 || n.id2 == t.IDU16)
 }
 
+func (n *TypeExpr) IsSignedInteger() bool {
+	return n.id0 == 0 && n.id1 == t.IDBase &&
+		(n.id2 == t.IDI8 || n.id2 == t.IDI16 || n.id2 == t.IDI32 || n.id2 == t.IDI64)
+}
+
 func (n *TypeExpr) IsUnsignedInteger() bool {
 	return n.id0 == 0 && n.id1 == t.IDBase &&
 		(n.id2 == t.IDU8 || n.id2 == t.IDU16 || n.id2 == t.IDU32 || n.id2 == t.IDU64)
@@ -1061,13 +1143,18 @@ func NewTypeExpr(decorator t.ID, pkg t.ID, name t.ID, alenRecvMin *Node, max *Ex
 // MaxBodyDepth is an advisory limit for a function body's recursion depth.
 const MaxBodyDepth = 255
 
-// Func is "func ID2.ID0(LHS)(RHS) { List2 }":
+// Func is "func ID2.ID0(LHS) RHS { List2 }" or "func ID2.ID0(LHS)(MHS) {
+// List2 }":
 //   - FlagsPublic      is "pub" vs "pri"
+//   - FlagsTest        is "test", instead of "pub" or "pri"
 //   - ID0:   funcName
 //   - ID1:   <0|receiverPkg> (set by calling SetPackage)
 //   - ID2:   <0|receiverName>
 //   - LHS:   <Struct> in-parameters
-//   - RHS:   <Struct> out-parameters
+//   - MHS:   <nil|Struct> out-parameters, for multiple return values
+//   - RHS:   <nil|TypeExpr> return type
+//
+// At most one of MHS and RHS is non-nil.
 //   - List1: <Assert> asserts
 //   - List2: <Statement> body
 type Func Node
@@ -1076,16 +1163,21 @@ func (n *Func) AsNode() *Node          { return (*Node)(n) }
 func (n *Func) Choosy() bool           { return n.flags&FlagsChoosy != 0 }
 func (n *Func) Effect() Effect         { return Effect(n.flags) }
 func (n *Func) HasChooseCPUArch() bool { return n.flags&FlagsHasChooseCPUArch != 0 }
+func (n *Func) Inline() bool           { return n.flags&FlagsInline != 0 }
 func (n *Func) Public() bool           { return n.flags&FlagsPublic != 0 }
+func (n *Func) Test() bool             { return n.flags&FlagsTest != 0 }
 func (n *Func) Filename() string       { return n.filename }
 func (n *Func) Line() uint32           { return n.line }
+func (n *Func) Col() uint32            { return n.col }
 func (n *Func) QQID() t.QQID           { return t.QQID{n.id1, n.id2, n.id0} }
 func (n *Func) Receiver() t.QID        { return t.QID{n.id1, n.id2} }
 func (n *Func) FuncName() t.ID         { return n.id0 }
 func (n *Func) In() *Struct            { return n.lhs.AsStruct() }
+func (n *Func) Outs() *Struct          { return n.mhs.AsStruct() }
 func (n *Func) Out() *TypeExpr         { return n.rhs.AsTypeExpr() }
 func (n *Func) Asserts() []*Node       { return n.list1 }
 func (n *Func) Body() []*Node          { return n.list2 }
+func (n *Func) Doc() []string          { return n.doc }
 
 func (n *Func) BodyEndsWithReturn() bool {
 	if len(n.list2) == 0 {
@@ -1115,13 +1207,14 @@ func (n *Func) CheckChooseCompatible(o *Func) error {
 	if !fieldsEq(n.In().Fields(), o.In().Fields()) {
 		return fmt.Errorf("different args type")
 	}
-	if !n.Out().Eq(o.Out()) {
+	if !n.Out().Eq(o.Out()) || ((n.Outs() == nil) != (o.Outs() == nil)) ||
+		((n.Outs() != nil) && !fieldsEq(n.Outs().Fields(), o.Outs().Fields())) {
 		return fmt.Errorf("different return type")
 	}
 	return nil
 }
 
-func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, out *TypeExpr, asserts []*Node, body []*Node) *Func {
+func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, outs *Struct, out *TypeExpr, asserts []*Node, body []*Node) *Func {
 	return &Func{
 		kind:     KFunc,
 		flags:    flags,
@@ -1130,6 +1223,7 @@ func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcN
 		id0:      funcName,
 		id2:      receiverName,
 		lhs:      in.AsNode(),
+		mhs:      outs.AsNode(),
 		rhs:      out.AsNode(),
 		list1:    asserts,
 		list2:    body,
@@ -1146,7 +1240,9 @@ func (n *Status) AsNode() *Node    { return (*Node)(n) }
 func (n *Status) Public() bool     { return n.flags&FlagsPublic != 0 }
 func (n *Status) Filename() string { return n.filename }
 func (n *Status) Line() uint32     { return n.line }
+func (n *Status) Col() uint32      { return n.col }
 func (n *Status) QID() t.QID       { return t.QID{n.id1, n.id2} }
+func (n *Status) Doc() []string    { return n.doc }
 
 func NewStatus(flags Flags, filename string, line uint32, message t.ID) *Status {
 	return &Status{
@@ -1170,9 +1266,11 @@ func (n *Const) AsNode() *Node    { return (*Node)(n) }
 func (n *Const) Public() bool     { return n.flags&FlagsPublic != 0 }
 func (n *Const) Filename() string { return n.filename }
 func (n *Const) Line() uint32     { return n.line }
+func (n *Const) Col() uint32      { return n.col }
 func (n *Const) QID() t.QID       { return t.QID{n.id1, n.id2} }
 func (n *Const) XType() *TypeExpr { return n.lhs.AsTypeExpr() }
 func (n *Const) Value() *Expr     { return n.rhs.AsExpr() }
+func (n *Const) Doc() []string    { return n.doc }
 
 func NewConst(flags Flags, filename string, line uint32, name t.ID, xType *TypeExpr, value *Expr) *Const {
 	return &Const{
@@ -1207,9 +1305,11 @@ func (n *Struct) Classy() bool        { return n.flags&FlagsClassy != 0 }
 func (n *Struct) Public() bool        { return n.flags&FlagsPublic != 0 }
 func (n *Struct) Filename() string    { return n.filename }
 func (n *Struct) Line() uint32        { return n.line }
+func (n *Struct) Col() uint32         { return n.col }
 func (n *Struct) QID() t.QID          { return t.QID{n.id1, n.id2} }
 func (n *Struct) Implements() []*Node { return n.list0 }
 func (n *Struct) Fields() []*Node     { return n.list1 }
+func (n *Struct) Doc() []string       { return n.doc }
 
 func NewStruct(flags Flags, filename string, line uint32, name t.ID, implements []*Node, fields []*Node) *Struct {
 	return &Struct{
@@ -1230,7 +1330,9 @@ type Use Node
 func (n *Use) AsNode() *Node    { return (*Node)(n) }
 func (n *Use) Filename() string { return n.filename }
 func (n *Use) Line() uint32     { return n.line }
+func (n *Use) Col() uint32      { return n.col }
 func (n *Use) Path() t.ID       { return n.id2 }
+func (n *Use) Doc() []string    { return n.doc }
 
 func NewUse(filename string, line uint32, path t.ID) *Use {
 	return &Use{
@@ -1242,6 +1344,7 @@ func NewUse(filename string, line uint32, path t.ID) *Use {
 }
 
 // File is a file of source code:
+//   - ID2:   <0|"-string literal> `use "cgen prefix etc"` pragma
 //   - List0: <Const|Func|Status|Struct|Use> top-level declarations
 type File Node
 
@@ -1249,10 +1352,16 @@ func (n *File) AsNode() *Node          { return (*Node)(n) }
 func (n *File) Filename() string       { return n.filename }
 func (n *File) TopLevelDecls() []*Node { return n.list0 }
 
-func NewFile(filename string, topLevelDecls []*Node) *File {
+// CgenPrefixPragma returns the "-string literal of the file's `use "cgen
+// prefix etc"` pragma, or zero if it has none. The parse.CgenPrefixPragma
+// function gives the prefix itself.
+func (n *File) CgenPrefixPragma() t.ID { return n.id2 }
+
+func NewFile(filename string, cgenPrefixPragma t.ID, topLevelDecls []*Node) *File {
 	return &File{
 		kind:     KFile,
 		filename: filename,
+		id2:      cgenPrefixPragma,
 		list0:    topLevelDecls,
 	}
 }
@@ -1266,13 +1375,15 @@ func NewFile(filename string, topLevelDecls []*Node) *File {
 //  - Iterate
 //  - Jump
 //  - Ret
+//  - Switch
 //  - Var
 //  - While
 
 // Terminates returns whether a block of statements terminates. In other words,
 // whether the block is non-empty and its final statement is a "return",
-// "break", "continue", a "while true" that doesn't break or an "if-else" chain
-// where all branches terminate.
+// "break", "continue", a "while true" that doesn't break, an "if-else" chain
+// where all branches terminate or a "switch" with a "default" where all cases
+// terminate.
 func Terminates(body []*Node) bool {
 	if len(body) == 0 {
 		return false
@@ -1296,6 +1407,17 @@ func Terminates(body []*Node) bool {
 		}
 	case KJump:
 		return true
+	case KSwitch:
+		n := n.AsSwitch()
+		if !n.HasDefault() {
+			return false
+		}
+		for _, o := range n.Cases() {
+			if !Terminates(o.AsCase().Body()) {
+				return false
+			}
+		}
+		return true
 	case KRet:
 		return n.AsRet().Keyword() == t.IDReturn
 	case KWhile:
@@ -42,7 +42,8 @@ func (n *Expr) Eq(o *Expr) bool {
 	}
 
 	if n.id0 == t.IDXBinaryAs {
-		if !n.rhs.AsTypeExpr().Eq(o.rhs.AsTypeExpr()) {
+		if !n.rhs.AsTypeExpr().Eq(o.rhs.AsTypeExpr()) ||
+			((n.flags & FlagsTruncate) != (o.flags & FlagsTruncate)) {
 			return false
 		}
 	} else if !n.rhs.AsExpr().Eq(o.rhs.AsExpr()) {
@@ -0,0 +1,90 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast
+
+// Equal returns whether n and o are structurally equal: whether they have the
+// same Kind, Flags and IDs and, recursively, equal sub-nodes in the same LHS,
+// MHS, RHS, List0, List1 and List2 positions.
+//
+// Unlike Expr.Eq, it ignores anything set by the type checker, such as the
+// ConstValue, MBounds and MType. It also ignores source positions (filenames,
+// lines and spans) and doc comments, so that the same code, parsed from
+// differently formatted source, compares equal.
+func Equal(n *Node, o *Node) bool {
+	if n == o {
+		return true
+	}
+	if n == nil || o == nil {
+		return false
+	}
+	if n.kind != o.kind || n.flags != o.flags ||
+		n.id0 != o.id0 || n.id1 != o.id1 || n.id2 != o.id2 {
+		return false
+	}
+	if !Equal(n.lhs, o.lhs) || !Equal(n.mhs, o.mhs) || !Equal(n.rhs, o.rhs) {
+		return false
+	}
+	return equalList(n.list0, o.list0) &&
+		equalList(n.list1, o.list1) &&
+		equalList(n.list2, o.list2)
+}
+
+func equalList(ns []*Node, os []*Node) bool {
+	if len(ns) != len(os) {
+		return false
+	}
+	for i, n := range ns {
+		if !Equal(n, os[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	hashOffset = 0xCBF29CE484222325
+	hashPrime  = 0x00000100000001B3
+)
+
+// Hash returns a structural hash of n. It is consistent with Equal: if
+// Equal(n, o) then Hash(n) == Hash(o).
+//
+// The hash is only stable for a given token.Map, as IDs are interned
+// per-Map.
+func Hash(n *Node) uint64 {
+	return hashNode(hashOffset, n)
+}
+
+// hashNode mixes n into h, FNV-1a style, one uint64 at a time.
+func hashNode(h uint64, n *Node) uint64 {
+	if n == nil {
+		return hashUint64(h, 0)
+	}
+	h = hashUint64(h, 1+uint64(n.kind))
+	h = hashUint64(h, uint64(n.flags))
+	h = hashUint64(h, uint64(n.id0))
+	h = hashUint64(h, uint64(n.id1))
+	h = hashUint64(h, uint64(n.id2))
+	h = hashNode(h, n.lhs)
+	h = hashNode(h, n.mhs)
+	h = hashNode(h, n.rhs)
+	for _, l := range [3][]*Node{n.list0, n.list1, n.list2} {
+		h = hashUint64(h, uint64(len(l)))
+		for _, o := range l {
+			h = hashNode(h, o)
+		}
+	}
+	return h
+}
+
+func hashUint64(h uint64, x uint64) uint64 {
+	return (h ^ x) * hashPrime
+}
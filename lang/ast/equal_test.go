@@ -0,0 +1,58 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast_test
+
+import (
+	"testing"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestEqualAndHash(tt *testing.T) {
+	testCases := []struct {
+		x, y string
+		want bool
+	}{
+		{"a + b", "a+b", true},
+		{"(a + b) * c", "(a+b)\t*   c", true},
+		{"f(x: 1, y: 2)", "f(x:1,y:2)", true},
+		{"a[1 .. 2]", "a[1..2]", true},
+		{"a + b", "b + a", false},
+		{"a + b", "a - b", false},
+		{"a + b", "a + b + c", false},
+		{"f(x: 1)", "f(x: 2)", false},
+		{"a[1 ..]", "a[.. 1]", false},
+		{"x.y", "x", false},
+	}
+
+	tm := &t.Map{}
+	for _, tc := range testCases {
+		x := parseExpr(tt, tm, tc.x).AsNode()
+		y := parseExpr(tt, tm, tc.y).AsNode()
+		if got := a.Equal(x, y); got != tc.want {
+			tt.Errorf("Equal(%q, %q): got %t, want %t", tc.x, tc.y, got, tc.want)
+			continue
+		}
+		if hx, hy := a.Hash(x), a.Hash(y); tc.want && (hx != hy) {
+			tt.Errorf("Hash(%q), Hash(%q): got 0x%X and 0x%X, want equal", tc.x, tc.y, hx, hy)
+		} else if !tc.want && (hx == hy) {
+			tt.Errorf("Hash(%q), Hash(%q): got 0x%X for both, want different", tc.x, tc.y, hx)
+		}
+	}
+
+	if !a.Equal(nil, nil) {
+		tt.Errorf("Equal(nil, nil): got false, want true")
+	}
+	if x := parseExpr(tt, tm, "a").AsNode(); a.Equal(x, nil) || a.Equal(nil, x) {
+		tt.Errorf("Equal(x, nil): got true, want false")
+	}
+}
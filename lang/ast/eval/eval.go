@@ -0,0 +1,289 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+// Package eval evaluates constant expressions, such as "(1 << 12) - 1", with
+// ideal number semantics: arbitrary precision integers that never overflow.
+//
+// The type checker uses it to fold constants. Other tools can use it to
+// evaluate the same expressions identically, without type checking.
+package eval
+
+import (
+	"fmt"
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+var (
+	zero = big.NewInt(0)
+	one  = big.NewInt(1)
+	ffff = big.NewInt(0xFFFF)
+)
+
+// maxExpBitLen is the maximum bit length of an exponentiation's result. Like
+// the 0xFFFF cap on the exponent, it stops nested "**" operators, such as
+// "(2 ** 0xFFFF) ** 0xFFFF", from allocating huge numbers.
+const maxExpBitLen = 0xFFFF
+
+func btoi(b bool) *big.Int {
+	if b {
+		return one
+	}
+	return zero
+}
+
+// Literal returns the value of a numeric literal, such as "0x10", a '-string
+// literal, such as "'\x01\x02'be", or "false" or "true". It returns nil (and
+// a nil error) if id is not such a literal.
+//
+// A '-string literal's value is its bytes, big-endian by default or
+// little-endian for a "le" suffix.
+func Literal(tm *t.Map, id t.ID) (*big.Int, error) {
+	switch {
+	case id.IsFloatLiteral(tm):
+		return nil, fmt.Errorf("eval: floating point literal %q is not an integer", id.Str(tm))
+
+	case id.IsNumLiteral(tm):
+		z := big.NewInt(0)
+		s := id.Str(tm)
+		if _, ok := z.SetString(s, 0); !ok {
+			return nil, fmt.Errorf("eval: invalid numeric literal %q", s)
+		}
+		return z, nil
+
+	case id.IsSQStrLiteral(tm):
+		s := id.Str(tm)
+		unescaped, ok := t.Unescape(s)
+		if !ok {
+			return nil, fmt.Errorf("eval: invalid '-string literal %q", s)
+		}
+
+		z := big.NewInt(0)
+		i, iEnd, iDelta := 0, len(unescaped), +1 // Big-endian.
+		if (len(s) > 2) && (s[len(s)-2] == 'l') {
+			i, iEnd, iDelta = len(unescaped)-1, -1, -1 // Little-endian.
+		}
+		for ; i != iEnd; i += iDelta {
+			z.Lsh(z, 8)
+			z.Or(z, big.NewInt(int64(unescaped[i])))
+		}
+		return z, nil
+
+	case id == t.IDFalse:
+		return zero, nil
+	case id == t.IDTrue:
+		return one, nil
+	}
+	return nil, nil
+}
+
+// UnaryOp returns the value of n, a unary operator expression, given the
+// value of its operand. Booleans are represented as 0 (false) or 1 (true).
+func UnaryOp(tm *t.Map, n *a.Expr, r *big.Int) (*big.Int, error) {
+	switch n.Operator() {
+	case t.IDXUnaryPlus:
+		return r, nil
+	case t.IDXUnaryMinus:
+		return big.NewInt(0).Neg(r), nil
+	case t.IDXUnaryNot:
+		return btoi(r.Sign() == 0), nil
+	case t.IDXUnaryTilde:
+		return nil, fmt.Errorf("eval: cannot apply %q to ideal numbers", n.Operator().AmbiguousForm().Str(tm))
+	}
+	return nil, fmt.Errorf("eval: unrecognized token (0x%X) for UnaryOp", n.Operator())
+}
+
+// BinaryOp returns the value of n, a binary operator expression, given the
+// values of its operands. Booleans are represented as 0 (false) or 1 (true).
+func BinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.Int, error) {
+	switch n.Operator() {
+	case t.IDXBinaryPlus:
+		return big.NewInt(0).Add(l, r), nil
+	case t.IDXBinaryMinus:
+		return big.NewInt(0).Sub(l, r), nil
+	case t.IDXBinaryStar:
+		return big.NewInt(0).Mul(l, r), nil
+	case t.IDXBinarySlash:
+		if r.Sign() == 0 {
+			return nil, fmt.Errorf("eval: division by zero in const expression %q", n.Str(tm))
+		}
+		// TODO: decide on Euclidean division vs other definitions. See "go doc
+		// math/big int.divmod" for details.
+		return big.NewInt(0).Div(l, r), nil
+	case t.IDXBinaryShiftL:
+		if r.Sign() < 0 || r.Cmp(ffff) > 0 {
+			return nil, fmt.Errorf("eval: shift %q out of range in const expression %q",
+				n.RHS().AsExpr().Str(tm), n.Str(tm))
+		}
+		return big.NewInt(0).Lsh(l, uint(r.Uint64())), nil
+	case t.IDXBinaryShiftR:
+		if r.Sign() < 0 || r.Cmp(ffff) > 0 {
+			return nil, fmt.Errorf("eval: shift %q out of range in const expression %q",
+				n.RHS().AsExpr().Str(tm), n.Str(tm))
+		}
+		return big.NewInt(0).Rsh(l, uint(r.Uint64())), nil
+	case t.IDXBinaryAmp:
+		return big.NewInt(0).And(l, r), nil
+	case t.IDXBinaryPipe:
+		return big.NewInt(0).Or(l, r), nil
+	case t.IDXBinaryHat:
+		return big.NewInt(0).Xor(l, r), nil
+	case t.IDXBinaryPercent:
+		if r.Sign() == 0 {
+			return nil, fmt.Errorf("eval: division by zero in const expression %q", n.Str(tm))
+		}
+		return big.NewInt(0).Mod(l, r), nil
+	case t.IDXBinaryStarStar:
+		if r.Sign() < 0 || r.Cmp(ffff) > 0 {
+			return nil, fmt.Errorf("eval: exponent %q out of range in const expression %q",
+				n.RHS().AsExpr().Str(tm), n.Str(tm))
+		}
+		// The result has at most (l.BitLen() * r) bits. For |l| > 1, it has
+		// at least ((l.BitLen() - 1) * r) + 1 bits.
+		if bl := uint64(l.BitLen()); (bl > 1) && ((bl-1)*r.Uint64() >= maxExpBitLen) {
+			return nil, fmt.Errorf("eval: result too large in const expression %q", n.Str(tm))
+		}
+		return big.NewInt(0).Exp(l, r, nil), nil
+	case t.IDXBinaryLessQuestion:
+		if l.Cmp(r) < 0 {
+			return big.NewInt(0).Set(l), nil
+		}
+		return big.NewInt(0).Set(r), nil
+	case t.IDXBinaryGreaterQuestion:
+		if l.Cmp(r) > 0 {
+			return big.NewInt(0).Set(l), nil
+		}
+		return big.NewInt(0).Set(r), nil
+	case t.IDXBinaryNotEq:
+		return btoi(l.Cmp(r) != 0), nil
+	case t.IDXBinaryLessThan:
+		return btoi(l.Cmp(r) < 0), nil
+	case t.IDXBinaryLessEq:
+		return btoi(l.Cmp(r) <= 0), nil
+	case t.IDXBinaryEqEq:
+		return btoi(l.Cmp(r) == 0), nil
+	case t.IDXBinaryGreaterEq:
+		return btoi(l.Cmp(r) >= 0), nil
+	case t.IDXBinaryGreaterThan:
+		return btoi(l.Cmp(r) > 0), nil
+	case t.IDXBinaryAnd:
+		return btoi((l.Sign() != 0) && (r.Sign() != 0)), nil
+	case t.IDXBinaryOr:
+		return btoi((l.Sign() != 0) || (r.Sign() != 0)), nil
+
+	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
+		t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL,
+		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
+
+		return nil, fmt.Errorf("eval: cannot apply tilde-operators to ideal numbers")
+	}
+	return nil, fmt.Errorf("eval: unrecognized token (0x%X) for BinaryOp", n.Operator())
+}
+
+// AssociativeOp returns the value of n, an associative operator expression,
+// given the values of its operands.
+func AssociativeOp(tm *t.Map, n *a.Expr, args []*big.Int) (*big.Int, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("eval: no operands for associative operator")
+	}
+	ncv := big.NewInt(0).Set(args[0])
+	args = args[1:]
+
+	switch n.Operator() {
+	case t.IDXAssociativePlus:
+		for _, cv := range args {
+			ncv.Add(ncv, cv)
+		}
+	case t.IDXAssociativeStar:
+		for _, cv := range args {
+			ncv.Mul(ncv, cv)
+		}
+	case t.IDXAssociativeAmp, t.IDXAssociativeAnd:
+		for _, cv := range args {
+			ncv.And(ncv, cv)
+		}
+	case t.IDXAssociativePipe, t.IDXAssociativeOr:
+		for _, cv := range args {
+			ncv.Or(ncv, cv)
+		}
+	case t.IDXAssociativeHat:
+		for _, cv := range args {
+			ncv.Xor(ncv, cv)
+		}
+	default:
+		return nil, fmt.Errorf("eval: unrecognized token (0x%X) for AssociativeOp", n.Operator())
+	}
+	return ncv, nil
+}
+
+// Expr returns the value of n, a constant expression made of literals, names
+// and unary, binary and associative operators. Names, such as those of
+// consts, are resolved by calling lookup, which may be nil if n has no names.
+//
+// Expr does not type check n. It neither uses nor sets n's ConstValue.
+func Expr(tm *t.Map, n *a.Expr, lookup func(name t.ID) (*big.Int, bool)) (*big.Int, error) {
+	return evalExpr(tm, n, lookup, 0)
+}
+
+func evalExpr(tm *t.Map, n *a.Expr, lookup func(name t.ID) (*big.Int, bool), depth uint32) (*big.Int, error) {
+	if depth > a.MaxExprDepth {
+		return nil, fmt.Errorf("eval: expression recursion depth too large")
+	}
+	depth++
+
+	switch op := n.Operator(); {
+	case op == 0:
+		id := n.Ident()
+		if cv, err := Literal(tm, id); (cv != nil) || (err != nil) {
+			return cv, err
+		}
+		if lookup != nil {
+			if cv, ok := lookup(id); ok {
+				return cv, nil
+			}
+		}
+		return nil, fmt.Errorf("eval: cannot resolve %q in const expression", id.Str(tm))
+
+	case op.IsXUnaryOp():
+		r, err := evalExpr(tm, n.RHS().AsExpr(), lookup, depth)
+		if err != nil {
+			return nil, err
+		}
+		return UnaryOp(tm, n, r)
+
+	case op.IsXBinaryOp():
+		if op == t.IDXBinaryAs {
+			break
+		}
+		l, err := evalExpr(tm, n.LHS().AsExpr(), lookup, depth)
+		if err != nil {
+			return nil, err
+		}
+		r, err := evalExpr(tm, n.RHS().AsExpr(), lookup, depth)
+		if err != nil {
+			return nil, err
+		}
+		return BinaryOp(tm, n, l, r)
+
+	case op.IsXAssociativeOp():
+		args := make([]*big.Int, 0, len(n.Args()))
+		for _, o := range n.Args() {
+			cv, err := evalExpr(tm, o.AsExpr(), lookup, depth)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, cv)
+		}
+		return AssociativeOp(tm, n, args)
+	}
+	return nil, fmt.Errorf("eval: %q is not a constant expression", n.Str(tm))
+}
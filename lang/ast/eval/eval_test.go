@@ -0,0 +1,92 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package eval_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/ast/eval"
+	"github.com/google/wuffs/lang/parse"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestExpr(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		want    string
+		wantErr string
+	}{
+		{"42", "42", ""},
+		{"0x10 + 0b11", "19", ""},
+		{"(1 << 12) - 1", "4095", ""},
+		{"1 << 100", "1267650600228229401496703205376", ""},
+		{"-3 + 1", "-2", ""},
+		{"2 ** 10", "1024", ""},
+		{"(-1) ** 0xFFFF", "-1", ""},
+		{"(2 ** 0xFFFE) >> 0xFFFE", "1", ""},
+		{"7 / 2", "3", ""},
+		{"7 % 2", "1", ""},
+		{"1 + 2 + 3 + 4", "10", ""},
+		{"0xF0 | 0x0F", "255", ""},
+		{"3 <? 2", "2", ""},
+		{"3 >? 2", "3", ""},
+		{"(1 < 2) and not false", "1", ""},
+		{"'\\x01\\x02'be + 0", "258", ""},
+		{"'\\x01\\x02'le + 0", "513", ""},
+		{"N * 2", "200", ""},
+
+		{"1 / 0", "", "division by zero"},
+		{"1 << -1", "", "out of range"},
+		{"2 ** 0x10000", "", "out of range"},
+		{"2 ** 0xFFFF", "", "too large"},
+		{"(2 ** 0x100) ** 0x100", "", "too large"},
+		{"(2 ** 0x10) ** 0x10", "115792089237316195423570985008687907853269984665640564039457584007913129639936", ""},
+		{"(3 ** 0x100) ** 0x100", "", "too large"},
+		{"1 ~mod+ 2", "", "tilde-operators"},
+		{"M + 1", "", `cannot resolve "M"`},
+		{"f(x: 1)", "", "not a constant expression"},
+	}
+
+	tm := &t.Map{}
+	lookup := func(name t.ID) (*big.Int, bool) {
+		if name.Str(tm) == "N" {
+			return big.NewInt(100), true
+		}
+		return nil, false
+	}
+
+	for _, tc := range testCases {
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(tc.src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.src, err)
+		}
+		expr, err := parse.ParseExpr(tm, "test.wuffs", tokens, nil)
+		if err != nil {
+			tt.Fatalf("%q: ParseExpr: %v", tc.src, err)
+		}
+
+		got, err := eval.Expr(tm, expr, lookup)
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got error %v, want one containing %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: %v", tc.src, err)
+		} else if got.String() != tc.want {
+			tt.Errorf("%q: got %v, want %s", tc.src, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast
+
+import (
+	t "github.com/google/wuffs/lang/token"
+)
+
+// IntrinsicKind categorizes a call to a built-in method, such as
+// "args.src.read_u8?()" or "x.min(no_more_than: y)", by its receiver's type.
+// It is set, on call Exprs, by the type checker. Code generators can switch
+// on it instead of re-deriving it from the receiver's type.
+//
+// The zero value, IntrinsicNone, means a call to a non-built-in func (or an
+// Expr that is not a call, or has not been type checked).
+type IntrinsicKind uint8
+
+const (
+	IntrinsicNone = IntrinsicKind(iota)
+
+	IntrinsicCPUArch       // A base.arm_etc or base.x86_etc receiver.
+	IntrinsicIOReader      // A base.io_reader receiver.
+	IntrinsicIOWriter      // A base.io_writer receiver.
+	IntrinsicNumType       // A numeric receiver, such as base.u32.
+	IntrinsicPixelSwizzler // A base.pixel_swizzler receiver.
+	IntrinsicPtr           // A ptr or nptr receiver, such as "ptr base.image_config".
+	IntrinsicSlice         // A slice or roslice receiver.
+	IntrinsicTable         // A table or rotable receiver.
+	IntrinsicTokenReader   // A base.token_reader receiver.
+	IntrinsicTokenWriter   // A base.token_writer receiver.
+	IntrinsicUtility       // A base.utility receiver.
+	IntrinsicOther         // Any other base receiver, such as base.status.
+)
+
+var intrinsicKindStrings = [...]string{
+	IntrinsicNone:          "IntrinsicNone",
+	IntrinsicCPUArch:       "IntrinsicCPUArch",
+	IntrinsicIOReader:      "IntrinsicIOReader",
+	IntrinsicIOWriter:      "IntrinsicIOWriter",
+	IntrinsicNumType:       "IntrinsicNumType",
+	IntrinsicPixelSwizzler: "IntrinsicPixelSwizzler",
+	IntrinsicPtr:           "IntrinsicPtr",
+	IntrinsicSlice:         "IntrinsicSlice",
+	IntrinsicTable:         "IntrinsicTable",
+	IntrinsicTokenReader:   "IntrinsicTokenReader",
+	IntrinsicTokenWriter:   "IntrinsicTokenWriter",
+	IntrinsicUtility:       "IntrinsicUtility",
+	IntrinsicOther:         "IntrinsicOther",
+}
+
+func (k IntrinsicKind) String() string {
+	if uint(k) < uint(len(intrinsicKindStrings)) {
+		return intrinsicKindStrings[k]
+	}
+	return "IntrinsicInvalid"
+}
+
+// Intrinsic is a type checked call to a built-in method, "Recv.Method(Args)".
+type Intrinsic struct {
+	Kind   IntrinsicKind
+	Recv   *Expr
+	Method t.ID
+	Args   []*Node // Each element is an Arg.
+}
+
+// Intrinsic returns n as an Intrinsic, if it is a type checked call to a
+// built-in method. Otherwise, it returns false.
+func (n *Expr) Intrinsic() (Intrinsic, bool) {
+	if (n.mIntrinsic == IntrinsicNone) || (n.id0 != ExprOperatorCall) {
+		return Intrinsic{}, false
+	}
+	method := n.lhs.AsExpr()
+	return Intrinsic{
+		Kind:   n.mIntrinsic,
+		Recv:   method.lhs.AsExpr(),
+		Method: method.id2,
+		Args:   n.list0,
+	}, true
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Print writes n and its sub-nodes to w as an S-expression, one node per
+// line. Each node is printed as its Kind, its non-zero Flags and its non-zero
+// IDs (resolved to strings by tm), followed by its non-nil sub-nodes, labeled
+// by their LHS, MHS, RHS, List0, List1 or List2 position. For example, "x +
+// 1" is printed as:
+//
+//	(KExpr id0="+"
+//	  lhs: (KExpr id2="x")
+//	  rhs: (KExpr id2="1"))
+//
+// It is intended for debugging and golden tests. The ast package's doc
+// comments, such as for the Func type, explain what each position means for
+// each Kind.
+func Print(w io.Writer, tm *t.Map, n *Node) error {
+	buf := appendPrint(nil, tm, n, 0)
+	buf = append(buf, '\n')
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendPrint(buf []byte, tm *t.Map, n *Node, depth uint32) []byte {
+	if n == nil {
+		return append(buf, "()"...)
+	} else if depth > (MaxBodyDepth + MaxExprDepth + MaxTypeExprDepth) {
+		return append(buf, "!print_recursion_depth_too_large!"...)
+	}
+	depth++
+
+	buf = append(buf, '(')
+	buf = append(buf, n.kind.String()...)
+	if n.flags != 0 {
+		buf = append(buf, " flags=0x"...)
+		buf = strconv.AppendUint(buf, uint64(n.flags), 16)
+	}
+	for i, id := range [3]t.ID{n.id0, n.id1, n.id2} {
+		if id != 0 {
+			buf = append(buf, " id"...)
+			buf = append(buf, byte('0'+i))
+			buf = append(buf, '=')
+			buf = strconv.AppendQuote(buf, printIDStr(tm, id))
+		}
+	}
+
+	for i, o := range [3]*Node{n.lhs, n.mhs, n.rhs} {
+		if o != nil {
+			buf = appendPrintIndent(buf, depth)
+			buf = append(buf, [3]string{"lhs: ", "mhs: ", "rhs: "}[i]...)
+			buf = appendPrint(buf, tm, o, depth)
+		}
+	}
+	for i, l := range [3][]*Node{n.list0, n.list1, n.list2} {
+		for j, o := range l {
+			buf = appendPrintIndent(buf, depth)
+			buf = append(buf, "list"...)
+			buf = append(buf, byte('0'+i))
+			buf = append(buf, '[')
+			buf = strconv.AppendInt(buf, int64(j), 10)
+			buf = append(buf, "]: "...)
+			buf = appendPrint(buf, tm, o, depth)
+		}
+	}
+	return append(buf, ')')
+}
+
+// printIDStr is like id.Str(tm) but also handles the built-in IDs, such as
+// t.IDXBinaryPlus, that have no source form of their own.
+func printIDStr(tm *t.Map, id t.ID) string {
+	if s := id.Str(tm); s != "" {
+		return s
+	} else if (id < t.ID(len(opStrings))) && (opStrings[id] != "") {
+		return strings.TrimSpace(opStrings[id])
+	}
+	return "0x" + strconv.FormatUint(uint64(id), 16)
+}
+
+func appendPrintIndent(buf []byte, depth uint32) []byte {
+	buf = append(buf, '\n')
+	for ; depth > 0; depth-- {
+		buf = append(buf, "  "...)
+	}
+	return buf
+}
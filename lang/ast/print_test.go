@@ -0,0 +1,61 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestPrint(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		src  string
+		want string
+	}{{
+		"x + 1",
+		"" +
+			"(KExpr id0=\"+\"\n" +
+			"  lhs: (KExpr id2=\"x\")\n" +
+			"  rhs: (KExpr id2=\"1\"))\n",
+	}, {
+		"f(a: i)",
+		"" +
+			"(KExpr id0=\"(\"\n" +
+			"  lhs: (KExpr id2=\"f\")\n" +
+			"  list0[0]: (KArg id2=\"a\"\n" +
+			"    rhs: (KExpr id2=\"i\")))\n",
+	}}
+
+	tm := &t.Map{}
+	for _, tc := range testCases {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(tc.src))
+		if err != nil {
+			tt.Fatalf("Tokenize(%q): %v", tc.src, err)
+		}
+		expr, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("ParseExpr(%q): %v", tc.src, err)
+		}
+		buf := &strings.Builder{}
+		if err := a.Print(buf, tm, expr.AsNode()); err != nil {
+			tt.Fatalf("Print(%q): %v", tc.src, err)
+		}
+		if got := buf.String(); got != tc.want {
+			tt.Errorf("%q:\ngot:\n%s\nwant:\n%s", tc.src, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast
+
+import (
+	"errors"
+)
+
+var errRewriteReplacedDecl = errors.New("ast: Rewriter cannot replace a top level declaration")
+
+// Rewriter rewrites the sub-nodes of top level declarations, such as Funcs,
+// recording which declarations it changed. After rewriting a type checked
+// tree, pass Changed to the lang/check package's Checker.Recheck to re-verify
+// only the affected declarations, instead of re-checking everything.
+//
+// The zero value is ready to use.
+type Rewriter struct {
+	changed []*Node
+	seen    map[*Node]bool
+}
+
+// Rewrite walks decl, as per Walk, calling f for decl and each of its
+// sub-nodes. If f replaces any node, decl is recorded as changed. f may not
+// replace decl itself.
+//
+// Replacement nodes need not be type checked, but they should otherwise be
+// well formed, with the same Flags (such as effects) that the parser would
+// have set. Rewrite returns Validate's error for a malformed replacement.
+func (r *Rewriter) Rewrite(decl *Node, f WalkFunc) error {
+	changed := false
+	_, err := Walk(decl, func(n *Node, exit bool) (*Node, error) {
+		replacement, err := f(n, exit)
+		if (replacement != nil) && (replacement != n) {
+			if n == decl {
+				return nil, errRewriteReplacedDecl
+			} else if err := Validate(replacement); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		return replacement, err
+	})
+
+	// A partial rewrite still changes decl.
+	if changed && !r.seen[decl] {
+		if r.seen == nil {
+			r.seen = map[*Node]bool{}
+		}
+		r.seen[decl] = true
+		r.changed = append(r.changed, decl)
+	}
+	return err
+}
+
+// Changed returns the declarations changed by Rewrite, in the order that they
+// were first changed.
+func (r *Rewriter) Changed() []*Node { return r.changed }
+
+// Reset forgets which declarations were changed.
+func (r *Rewriter) Reset() {
+	r.changed = nil
+	r.seen = nil
+}
@@ -49,6 +49,9 @@ func (n *Expr) appendStr(buf []byte, tm *t.Map, parenthesize bool, depth uint32)
 			buf = append(buf, opString(n.id0)...)
 			if n.id0 == t.IDXBinaryAs {
 				buf = append(buf, n.rhs.AsTypeExpr().Str(tm)...)
+				if n.flags&FlagsTruncate != 0 {
+					buf = append(buf, " via truncate"...)
+				}
 			} else {
 				buf = n.rhs.AsExpr().appendStr(buf, tm, true, depth)
 			}
@@ -155,6 +158,7 @@ var opStrings = [...]string{
 	t.IDXBinaryPipe:           " | ",
 	t.IDXBinaryHat:            " ^ ",
 	t.IDXBinaryPercent:        " % ",
+	t.IDXBinaryStarStar:       " ** ",
 	t.IDXBinaryTildeModPlus:   " ~mod+ ",
 	t.IDXBinaryTildeModMinus:  " ~mod- ",
 	t.IDXBinaryTildeModStar:   " ~mod* ",
@@ -171,6 +175,9 @@ var opStrings = [...]string{
 	t.IDXBinaryOr:             " or ",
 	t.IDXBinaryAs:             " as ",
 
+	t.IDXBinaryLessQuestion:    " <? ",
+	t.IDXBinaryGreaterQuestion: " >? ",
+
 	t.IDXAssociativePlus: " + ",
 	t.IDXAssociativeStar: " * ",
 	t.IDXAssociativeAmp:  " & ",
@@ -181,6 +188,7 @@ var opStrings = [...]string{
 
 	t.IDXUnaryPlus:  "+",
 	t.IDXUnaryMinus: "-",
+	t.IDXUnaryTilde: "~",
 	t.IDXUnaryNot:   "not ",
 }
 
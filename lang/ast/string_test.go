@@ -45,12 +45,22 @@ func TestString(tt *testing.T) {
 		"not x",
 		"not not x",
 		"+++-x",
+		"~x",
+		"~(x & y)",
 
 		"x + 42",
 		"x and (y < z)",
 		"x & (y as base.u8)",
 		"x * ((a / b) - (i / j))",
 
+		"2 ** 32",
+		"x <? 255",
+		"(x >? 0) <? y",
+		"x ~mod+ y",
+		"x ~mod<< (y ~mod* z)",
+		"x ~sat+ y",
+		"(x ~sat- y) ~sat+ z",
+
 		"x + y + z",
 		"x + (i * j.k[l] * (-m << 4) * (n & o(o0: p, o1: q[.. r.s + 5]))) + z",
 
@@ -59,6 +69,8 @@ func TestString(tt *testing.T) {
 		"x as base.u32[1 ..=]",
 		"x as base.u32[..= 2]",
 		"x as base.u32[1 ..= 2]",
+		"x as base.u8 via truncate",
+		"(x + y) as base.i16 via truncate",
 		"x as T",
 		"x as T",
 		"x as pkg.T",
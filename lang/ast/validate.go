@@ -0,0 +1,206 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast
+
+import (
+	"fmt"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// kindSet is a set of Kinds, one bit per Kind. The KInvalid bit means that a
+// nil sub-node is allowed.
+type kindSet uint32
+
+const (
+	ksNil = kindSet(1 << KInvalid)
+
+	ksArg      = kindSet(1 << KArg)
+	ksAssert   = kindSet(1 << KAssert)
+	ksAssign   = kindSet(1 << KAssign)
+	ksCase     = kindSet(1 << KCase)
+	ksExpr     = kindSet(1 << KExpr)
+	ksField    = kindSet(1 << KField)
+	ksIf       = kindSet(1 << KIf)
+	ksIterate  = kindSet(1 << KIterate)
+	ksStruct   = kindSet(1 << KStruct)
+	ksTypeExpr = kindSet(1 << KTypeExpr)
+
+	ksStatement = kindSet(1<<KAssert | 1<<KAssign | 1<<KChoose | 1<<KIOManip |
+		1<<KIf | 1<<KIterate | 1<<KJump | 1<<KRet | 1<<KSwitch | 1<<KVar | 1<<KWhile)
+	ksTopLevelDecl = kindSet(1<<KConst | 1<<KFunc | 1<<KStatus | 1<<KStruct | 1<<KUse)
+)
+
+func (s kindSet) String() string {
+	buf := []byte(nil)
+	if s&ksNil != 0 {
+		buf = append(buf, "nil"...)
+	}
+	for k := KInvalid + 1; k < Kind(len(kindStrings)); k++ {
+		if s&(1<<k) != 0 {
+			if len(buf) > 0 {
+				buf = append(buf, '|')
+			}
+			buf = append(buf, k.String()...)
+		}
+	}
+	if len(buf) == 0 {
+		return "none"
+	}
+	return string(buf)
+}
+
+// shapes holds, for each Kind, the kinds of sub-node allowed in its LHS, MHS,
+// RHS, List0, List1 and List2 positions, per that Kind's doc comment. A zero
+// kindSet means that the position must be nil or empty.
+var shapes = [...][6]kindSet{
+	KArg:      {0, 0, ksExpr, 0, 0, 0},
+	KAssert:   {0, 0, ksExpr, ksArg, 0, 0},
+	KAssign:   {ksNil | ksExpr, 0, ksExpr, 0, 0, 0},
+	KCase:     {0, 0, 0, ksExpr, 0, ksStatement},
+	KChoose:   {0, 0, 0, ksExpr, 0, 0},
+	KConst:    {ksTypeExpr, 0, ksExpr, 0, 0, 0},
+	KExpr:     {ksNil | ksExpr, ksNil | ksExpr, ksNil | ksExpr | ksTypeExpr, ksArg | ksExpr, 0, 0},
+	KField:    {ksTypeExpr, 0, 0, 0, 0, 0},
+	KFile:     {0, 0, 0, ksTopLevelDecl, 0, 0},
+	KFunc:     {ksStruct, ksNil | ksStruct, ksNil | ksTypeExpr, 0, ksAssert, ksStatement},
+	KIOManip:  {ksExpr, ksNil | ksExpr, ksNil | ksExpr, 0, 0, ksStatement},
+	KIf:       {0, ksExpr, ksNil | ksIf, 0, ksStatement, ksStatement},
+	KIterate:  {ksExpr, 0, ksNil | ksIterate, ksAssign, ksAssert, ksStatement},
+	KJump:     {0, 0, 0, 0, 0, 0},
+	KRet:      {ksExpr, 0, 0, 0, 0, 0},
+	KStatus:   {0, 0, 0, 0, 0, 0},
+	KStruct:   {0, 0, 0, ksTypeExpr, ksField, 0},
+	KSwitch:   {0, ksExpr, 0, ksCase, 0, 0},
+	KTypeExpr: {ksNil | ksExpr | ksTypeExpr, ksNil | ksExpr, ksNil | ksTypeExpr, 0, 0, 0},
+	KUse:      {0, 0, 0, 0, 0, 0},
+	KVar:      {ksTypeExpr, 0, 0, 0, 0, 0},
+	KWhile:    {0, ksExpr, 0, 0, ksAssert, ksStatement},
+}
+
+var shapePositions = [6]string{"LHS", "MHS", "RHS", "List0", "List1", "List2"}
+
+// Validate checks that the tree rooted at n is well formed: that every node's
+// sub-nodes are of the kinds, and in the positions, that the ast package's
+// documentation for that node's Kind allows. For example, a While's MHS must
+// be an Expr and its List2 must hold only statements.
+//
+// Validate does not type check. The parser calls it on each top level
+// declaration that it produces, and a Rewriter calls it on each replacement
+// node, so that a malformed tree is reported where it is built instead of
+// where a later pass trips over it.
+func Validate(n *Node) error {
+	return validate(n, 0)
+}
+
+func validate(n *Node, depth uint32) error {
+	if n == nil {
+		return fmt.Errorf("ast: nil node")
+	} else if depth > (MaxBodyDepth + MaxExprDepth + MaxTypeExprDepth) {
+		return fmt.Errorf("ast: recursion depth too large")
+	}
+	depth++
+
+	if (n.kind == KInvalid) || (int(n.kind) >= len(shapes)) {
+		return fmt.Errorf("ast: invalid kind %d", n.kind)
+	}
+	if err := validateShape(n); err != nil {
+		return fmt.Errorf("ast: %s node%s: %v", n.kind, validateWhere(n), err)
+	}
+
+	for _, o := range [3]*Node{n.lhs, n.mhs, n.rhs} {
+		if o != nil {
+			if err := validate(o, depth); err != nil {
+				return err
+			}
+		}
+	}
+	for _, l := range [3][]*Node{n.list0, n.list1, n.list2} {
+		for _, o := range l {
+			if err := validate(o, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateWhere(n *Node) string {
+	if n.filename == "" {
+		return ""
+	}
+	return fmt.Sprintf(" at %s:%d", n.filename, n.line)
+}
+
+func validateShape(n *Node) error {
+	shape := &shapes[n.kind]
+	for i, o := range [3]*Node{n.lhs, n.mhs, n.rhs} {
+		if o == nil {
+			if (shape[i] != 0) && (shape[i]&ksNil == 0) {
+				return fmt.Errorf("missing %s", shapePositions[i])
+			}
+		} else if shape[i]&(1<<o.kind) == 0 {
+			return fmt.Errorf("%s is %s, want %s", shapePositions[i], o.kind, shape[i]&^ksNil)
+		}
+	}
+	for i, l := range [3][]*Node{n.list0, n.list1, n.list2} {
+		for j, o := range l {
+			if o == nil {
+				return fmt.Errorf("%s[%d] is nil", shapePositions[3+i], j)
+			} else if shape[3+i]&(1<<o.kind) == 0 {
+				return fmt.Errorf("%s[%d] is %s, want %s", shapePositions[3+i], j, o.kind, shape[3+i])
+			}
+		}
+	}
+
+	switch n.kind {
+	case KExpr:
+		return validateExprOperands(n.AsExpr())
+	case KFunc:
+		if (n.mhs != nil) && (n.rhs != nil) {
+			return fmt.Errorf("both MHS and RHS are non-nil")
+		}
+	case KTypeExpr:
+		switch n.id0 {
+		case t.IDArray, t.IDRoarray:
+			if (n.lhs == nil) || (n.rhs == nil) {
+				return fmt.Errorf("array type without a length or inner type")
+			}
+		case t.IDNptr, t.IDPtr, t.IDRoslice, t.IDRotable, t.IDSlice, t.IDTable:
+			if n.rhs == nil {
+				return fmt.Errorf("missing inner type")
+			}
+		}
+	}
+	return nil
+}
+
+func validateExprOperands(n *Expr) error {
+	switch op := n.Operator(); {
+	case op.IsXUnaryOp():
+		if n.rhs == nil {
+			return fmt.Errorf("unary operator without an operand")
+		}
+	case op.IsXBinaryOp(), op == ExprOperatorIndex:
+		if (n.lhs == nil) || (n.rhs == nil) {
+			return fmt.Errorf("binary operator without two operands")
+		}
+	case op.IsXAssociativeOp():
+		if len(n.list0) < 2 {
+			return fmt.Errorf("associative operator has %d operands", len(n.list0))
+		}
+	case op == ExprOperatorCall, op == ExprOperatorSelector, op == ExprOperatorSlice:
+		if n.lhs == nil {
+			return fmt.Errorf("missing LHS")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestValidate(tt *testing.T) {
+	const src = `
+pub struct foo?(
+	x : base.u32,
+	y : array[4] base.u8,
+)
+
+pub const BAR : base.u32 = 42
+
+pri func foo.baz!(a: base.u32[..= 100], s: slice base.u8) base.u32 {
+	var i : base.u32
+	var j : base.u32
+
+	assert args.a <= 100
+	while i < 10,
+		inv j <= 100,
+	{
+		if (i + j) > 5 {
+			break
+		} else if i == 0 {
+			i = 1
+		} else {
+			i += 1
+		}
+	}
+	iterate (p = args.s)(length: 1, advance: 1, unroll: 1) {
+		j = p[0] as base.u32
+	}
+	return args.a + j
+}
+`
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := parse.Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	if err := a.Validate(f.AsNode()); err != nil {
+		tt.Fatalf("Validate: %v", err)
+	}
+
+	x := parseExpr(tt, tm, "x")
+	y := parseExpr(tt, tm, "y")
+	u32 := a.NewTypeExpr(0, t.IDBase, t.IDU32, nil, nil, nil)
+	testCases := []struct {
+		n       *a.Node
+		wantErr string
+	}{
+		{nil, "nil node"},
+		{a.NewAssign(t.IDEq, x, nil).AsNode(), "KAssign node: missing RHS"},
+		{a.NewVar(0, nil).AsNode(), "KVar node: missing LHS"},
+		{a.NewConst(0, "f.wuffs", 7, 0, u32, a.NewExpr(0, t.IDXBinaryPlus, 0, x.AsNode(), nil, nil, nil)).AsNode(),
+			"KExpr node: binary operator without two operands"},
+		{a.NewRet(0, t.IDReturn, u32.AsNode().AsExpr()).AsNode(), "KRet node: LHS is KTypeExpr, want KExpr"},
+		{a.NewFile("f.wuffs", 0, []*a.Node{x.AsNode()}).AsNode(),
+			"KFile node at f.wuffs:0: List0[0] is KExpr, want KConst|KFunc|KStatus|KStruct|KUse"},
+		{a.NewWhile(0, x, nil).AsNode(), ""},
+		{a.NewIf(0, x, []*a.Node{y.AsNode()}, nil, nil).AsNode(), "KIf node: List2[0] is KExpr"},
+		{a.NewTypeExpr(t.IDPtr, 0, 0, nil, nil, nil).AsNode(), "KTypeExpr node: missing inner type"},
+		{a.NewTypeExpr(t.IDArray, 0, 0, nil, nil, u32).AsNode(), "array type without a length or inner type"},
+		{a.NewExpr(0, t.IDXUnaryNot, 0, nil, nil, nil, nil).AsNode(), "unary operator without an operand"},
+		{a.NewExpr(0, t.IDXAssociativePlus, 0, nil, nil, nil, []*a.Node{x.AsNode()}).AsNode(),
+			"associative operator has 1 operands"},
+		{a.NewExpr(0, a.ExprOperatorCall, 0, nil, nil, nil, nil).AsNode(), "KExpr node: missing LHS"},
+		{a.NewSwitch(x, []*a.Node{y.AsNode()}).AsNode(), "KSwitch node: List0[0] is KExpr, want KCase"},
+		{a.NewCase(0, []*a.Node{x.AsNode()}, []*a.Node{a.NewJump(t.IDBreak, 0).AsNode()}).AsNode(), ""},
+		{a.NewIOManip(t.IDIOBind, x, nil, nil, []*a.Node{nil}).AsNode(), "KIOManip node: List2[0] is nil"},
+		{a.NewAssert(t.IDAssert, x, 0, []*a.Node{y.AsNode()}).AsNode(), "KAssert node: List0[0] is KExpr, want KArg"},
+		{a.NewArg(0, u32.AsNode().AsExpr()).AsNode(), "KArg node: RHS is KTypeExpr, want KExpr"},
+		{a.NewFunc(0, "f.wuffs", 3, 0, 0, a.NewStruct(0, "", 0, 0, nil, nil), a.NewStruct(0, "", 0, 0, nil, nil), u32, nil, nil).AsNode(),
+			"KFunc node at f.wuffs:3: both MHS and RHS are non-nil"},
+	}
+
+	for _, tc := range testCases {
+		err := a.Validate(tc.n)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("Validate(%v): got %v, want nil", tc.n.Kind(), err)
+			}
+		} else if (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("Validate: got %v, want an error containing %q", err, tc.wantErr)
+		}
+	}
+}
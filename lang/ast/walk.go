@@ -0,0 +1,83 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast
+
+import (
+	"errors"
+)
+
+// SkipSubNodes can be returned by a WalkFunc, when entering a node, to skip
+// walking that node's sub-nodes. It is not returned as an error by Walk.
+var SkipSubNodes = errors.New("ast: skip sub-nodes")
+
+// WalkFunc is the type of the function called by Walk for each node visited.
+// It is called twice per node: once before (exit is false) and once after
+// (exit is true) walking that node's sub-nodes.
+//
+// If it returns a non-nil replacement other than n, then replacement takes n's
+// place in n's parent (or, for the root node, is returned by Walk). When
+// entering, it is replacement's sub-nodes that are then walked and replacement
+// that is later exited.
+type WalkFunc func(n *Node, exit bool) (replacement *Node, err error)
+
+// Walk walks the tree rooted at n, in depth first order, calling f when
+// entering and exiting each non-nil node. Sub-nodes are visited in LHS, MHS,
+// RHS, List0, List1, List2 order. It returns the possibly replaced root node.
+//
+// Walking stops at the first non-nil error returned by f, other than
+// SkipSubNodes, and Walk returns that error.
+func Walk(n *Node, f WalkFunc) (*Node, error) {
+	if n == nil {
+		return nil, nil
+	}
+
+	skip := false
+	if r, err := f(n, false); err == SkipSubNodes {
+		skip = true
+		if r != nil {
+			n = r
+		}
+	} else if err != nil {
+		return nil, err
+	} else if r != nil {
+		n = r
+	}
+
+	if !skip {
+		for _, p := range [3]**Node{&n.lhs, &n.mhs, &n.rhs} {
+			if *p == nil {
+				continue
+			} else if r, err := Walk(*p, f); err != nil {
+				return nil, err
+			} else {
+				*p = r
+			}
+		}
+		for _, l := range [3][]*Node{n.list0, n.list1, n.list2} {
+			for i, o := range l {
+				if o == nil {
+					continue
+				} else if r, err := Walk(o, f); err != nil {
+					return nil, err
+				} else {
+					l[i] = r
+				}
+			}
+		}
+	}
+
+	if r, err := f(n, true); err != nil {
+		return nil, err
+	} else if r != nil {
+		n = r
+	}
+	return n, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func parseExpr(tt *testing.T, tm *t.Map, src string) *a.Expr {
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize(%q): %v", src, err)
+	}
+	expr, err := parse.ParseExpr(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("ParseExpr(%q): %v", src, err)
+	}
+	return expr
+}
+
+func TestWalkOrder(tt *testing.T) {
+	tm := &t.Map{}
+	expr := parseExpr(tt, tm, "(a + b) * c")
+
+	events := []string(nil)
+	_, err := a.Walk(expr.AsNode(), func(n *a.Node, exit bool) (*a.Node, error) {
+		s := "enter "
+		if exit {
+			s = "exit "
+		}
+		events = append(events, s+n.AsExpr().Str(tm))
+		return nil, nil
+	})
+	if err != nil {
+		tt.Fatalf("Walk: %v", err)
+	}
+	got := strings.Join(events, "; ")
+	want := "enter (a + b) * c; enter a + b; enter a; exit a; enter b; exit b; exit a + b; " +
+		"enter c; exit c; exit (a + b) * c"
+	if got != want {
+		tt.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWalkSkipSubNodes(tt *testing.T) {
+	tm := &t.Map{}
+	expr := parseExpr(tt, tm, "(a + b) * c")
+
+	entered := []string(nil)
+	_, err := a.Walk(expr.AsNode(), func(n *a.Node, exit bool) (*a.Node, error) {
+		if exit {
+			return nil, nil
+		}
+		entered = append(entered, n.AsExpr().Str(tm))
+		if n.AsExpr().Operator() == t.IDXBinaryPlus {
+			return nil, a.SkipSubNodes
+		}
+		return nil, nil
+	})
+	if err != nil {
+		tt.Fatalf("Walk: %v", err)
+	}
+	if got, want := strings.Join(entered, "; "), "(a + b) * c; a + b; c"; got != want {
+		tt.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWalkReplace(tt *testing.T) {
+	tm := &t.Map{}
+	expr := parseExpr(tt, tm, "f(x: a + b, y: a)")
+	z := parseExpr(tt, tm, "z")
+
+	// Replace every "a" with "z".
+	root, err := a.Walk(expr.AsNode(), func(n *a.Node, exit bool) (*a.Node, error) {
+		if exit && (n.Kind() == a.KExpr) && (n.AsExpr().Operator() == 0) && (n.AsExpr().Ident().Str(tm) == "a") {
+			return z.AsNode(), nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		tt.Fatalf("Walk: %v", err)
+	}
+	if got, want := root.AsExpr().Str(tm), "f(x: z + b, y: z)"; got != want {
+		tt.Errorf("got %q, want %q", got, want)
+	}
+
+	// Replace the root.
+	root, err = a.Walk(expr.AsNode(), func(n *a.Node, exit bool) (*a.Node, error) {
+		if !exit && (n == expr.AsNode()) {
+			return z.AsNode(), nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		tt.Fatalf("Walk: %v", err)
+	}
+	if root != z.AsNode() {
+		tt.Errorf("root: got %q, want %q", root.AsExpr().Str(tm), "z")
+	}
+}
+
+func TestRewriteMalformed(tt *testing.T) {
+	tm := &t.Map{}
+	x := parseExpr(tt, tm, "a + b")
+	u32 := a.NewTypeExpr(0, t.IDBase, t.IDU32, nil, nil, nil)
+	decl := a.NewConst(0, "test.wuffs", 1, tm.ByName("a"), u32, x).AsNode()
+
+	// Replace "a" with a binary operator that has no RHS.
+	r := &a.Rewriter{}
+	err := r.Rewrite(decl, func(n *a.Node, exit bool) (*a.Node, error) {
+		if !exit && (n.Kind() == a.KExpr) && (n.AsExpr().Ident().Str(tm) == "a") {
+			return a.NewExpr(0, t.IDXBinaryPlus, 0, n, nil, nil, nil).AsNode(), a.SkipSubNodes
+		}
+		return nil, nil
+	})
+	if want := "binary operator without two operands"; (err == nil) || !strings.Contains(err.Error(), want) {
+		tt.Errorf("Rewrite: got %v, want an error containing %q", err, want)
+	}
+	if n := len(r.Changed()); n != 0 {
+		tt.Errorf("Changed: got %d nodes, want 0", n)
+	}
+	if got, want := x.Str(tm), "a + b"; got != want {
+		tt.Errorf("got %q, want %q", got, want)
+	}
+}
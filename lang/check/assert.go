@@ -15,6 +15,8 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/google/wuffs/lang/ast/eval"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -84,6 +86,14 @@ func (z *facts) appendFact(fact *a.Expr) {
 	*z = append(*z, fact)
 }
 
+// markAssumed adds, to m, the facts from index i onwards, such as those that
+// entering an if/else or switch branch assumes.
+func (z *facts) markAssumed(m map[string]bool, i int, tm *t.Map) {
+	for _, x := range (*z)[i:] {
+		m[x.Str(tm)] = true
+	}
+}
+
 func (z *facts) dropAnyFactsMentioning(n *a.Expr) error {
 	return z.update(func(x *a.Expr) (*a.Expr, error) {
 		if x.Mentions(n) {
@@ -179,7 +189,7 @@ func simplify(tm *t.Map, n *a.Expr) (*a.Expr, error) {
 	op, lhs, rhs := parseBinaryOp(n)
 	if lhs != nil && rhs != nil {
 		if lcv, rcv := lhs.ConstValue(), rhs.ConstValue(); lcv != nil && rcv != nil {
-			ncv, err := evalConstValueBinaryOp(tm, n, lcv, rcv)
+			ncv, err := eval.BinaryOp(tm, n, lcv, rcv)
 			if err != nil {
 				return nil, err
 			}
@@ -288,6 +298,10 @@ func (q *checker) proveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
 		}
 	}
 
+	if q.proveModularBinaryOp(op, lhs, rhs) || q.proveBitwiseBinaryOp(op, lhs, rhs) {
+		return nil
+	}
+
 	for _, x := range q.facts {
 		if !x.LHS().AsExpr().Eq(lhs) {
 			continue
@@ -319,6 +333,102 @@ func (q *checker) proveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
 	return errFailed
 }
 
+// proveModularBinaryOp proves "x % n op rhs" (or "lhs op x % n") for ops such
+// as "<" when "n <= rhs" (or "lhs >= n"). Bounds checking a "%" already proves
+// that n is positive, so "x % n" is less than n even if n is not a constant,
+// such as in "s[x % s.length()]".
+func (q *checker) proveModularBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) bool {
+	switch op {
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq:
+		if lhs.Operator() == t.IDXBinaryPercent {
+			n := lhs.RHS().AsExpr()
+			return n.Eq(rhs) || (q.proveBinaryOp(t.IDXBinaryLessEq, n, rhs) == nil)
+		}
+	}
+	switch op {
+	case t.IDXBinaryNotEq, t.IDXBinaryGreaterThan, t.IDXBinaryGreaterEq:
+		if rhs.Operator() == t.IDXBinaryPercent {
+			n := rhs.RHS().AsExpr()
+			return n.Eq(lhs) || (q.proveBinaryOp(t.IDXBinaryGreaterEq, lhs, n) == nil)
+		}
+	}
+	return false
+}
+
+// proveBitwiseBinaryOp proves "x & y op rhs" for ops such as "<=" when "x op
+// rhs" or "y op rhs", and likewise "x | y op rhs" for ops such as ">=".
+// Bounds checking a bitwise op already proves that its arguments are
+// non-negative, so "x & y" is at most both x and y, and "x | y" is at least
+// both, even if neither is a constant, such as in "s[x & mask]" given that
+// "mask < s.length()". The mirrored forms, such as "lhs >= x & y", are proved
+// similarly.
+func (q *checker) proveBitwiseBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) bool {
+	// The "x & y" on the left side is at most x, so proving "x < rhs" proves
+	// "x & y != rhs". The other three cases are analogous.
+	lessOp, greaterOp := op, op
+	switch op {
+	case t.IDXBinaryNotEq:
+		lessOp, greaterOp = t.IDXBinaryLessThan, t.IDXBinaryGreaterThan
+	case t.IDXBinaryLessThan, t.IDXBinaryLessEq:
+		greaterOp = 0
+	case t.IDXBinaryGreaterThan, t.IDXBinaryGreaterEq:
+		lessOp = 0
+	default:
+		return false
+	}
+
+	if lessOp != 0 {
+		for _, x := range bitwiseArgs(lhs, t.IDXBinaryAmp, t.IDXAssociativeAmp) {
+			if q.proveBinaryOpOrEq(lessOp, x, rhs) {
+				return true
+			}
+		}
+		for _, x := range bitwiseArgs(rhs, t.IDXBinaryPipe, t.IDXAssociativePipe) {
+			if q.proveBinaryOpOrEq(lessOp, lhs, x) {
+				return true
+			}
+		}
+	}
+	if greaterOp != 0 {
+		for _, x := range bitwiseArgs(lhs, t.IDXBinaryPipe, t.IDXAssociativePipe) {
+			if q.proveBinaryOpOrEq(greaterOp, x, rhs) {
+				return true
+			}
+		}
+		for _, x := range bitwiseArgs(rhs, t.IDXBinaryAmp, t.IDXAssociativeAmp) {
+			if q.proveBinaryOpOrEq(greaterOp, lhs, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bitwiseArgs returns the arguments of n if it is a binaryOp or associativeOp
+// bitwise op, such as "x & y" or "x & y & z", and nil otherwise.
+func bitwiseArgs(n *a.Expr, binaryOp t.ID, associativeOp t.ID) []*a.Expr {
+	switch n.Operator() {
+	case binaryOp:
+		return []*a.Expr{n.LHS().AsExpr(), n.RHS().AsExpr()}
+	case associativeOp:
+		ret := make([]*a.Expr, 0, len(n.Args()))
+		for _, o := range n.Args() {
+			ret = append(ret, o.AsExpr())
+		}
+		return ret
+	}
+	return nil
+}
+
+// proveBinaryOpOrEq is like proveBinaryOp, except that it also holds when lhs
+// and rhs are the same expression and op is "<=" or ">=".
+func (q *checker) proveBinaryOpOrEq(op t.ID, lhs *a.Expr, rhs *a.Expr) bool {
+	if ((op == t.IDXBinaryLessEq) || (op == t.IDXBinaryGreaterEq)) && lhs.Eq(rhs) {
+		return true
+	}
+	return q.proveBinaryOp(op, lhs, rhs) == nil
+}
+
 // opImpliesOp returns whether the first op implies the second. For example,
 // knowing "x < y" implies that "x != y" and "x <= y".
 func opImpliesOp(op0 t.ID, op1 t.ID) bool {
@@ -14,9 +14,11 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/google/wuffs/lang/render"
 	"github.com/google/wuffs/lib/interval"
 
 	a "github.com/google/wuffs/lang/ast"
@@ -59,7 +61,6 @@ var (
 	thirtyTwo      = big.NewInt(+32)
 	sixtyFour      = big.NewInt(+64)
 	oneTwentyEight = big.NewInt(+128)
-	ffff           = big.NewInt(0xFFFF)
 
 	// maxPointerBounds is the artificial value in the [0 ..= maxPointerBounds]
 	// range for bounds-checking pointer-typed values. Its value is arbitrary
@@ -94,13 +95,6 @@ func isErrorStatus(literal t.ID, tm *t.Map) bool {
 	return (len(s) >= 2) && (s[0] == '"') && (s[1] == '#')
 }
 
-func btoi(b bool) *big.Int {
-	if b {
-		return one
-	}
-	return zero
-}
-
 func add1(i *big.Int) *big.Int {
 	return big.NewInt(0).Add(i, one)
 }
@@ -234,13 +228,30 @@ func updateFactsForSuspension(x *a.Expr) (*a.Expr, error) {
 	return x, nil
 }
 
+// explain calls Options.Explain, if n, the statement at q.errFilename and
+// q.errLine, is one that it asks about.
+func (q *checker) explain(n *a.Node) {
+	opts := &q.c.opts
+	if (opts.Explain == nil) || (opts.ExplainLine != q.errLine) || q.c.rechecking ||
+		((opts.ExplainFilename != "") && (opts.ExplainFilename != q.errFilename)) {
+		return
+	}
+	facts := make([]string, 0, len(q.facts))
+	for _, x := range q.facts {
+		facts = append(facts, render.Expr(x, q.tm))
+	}
+	opts.Explain(q.errFilename, q.errLine, render.Stmt(n, q.tm), facts)
+}
+
 func (q *checker) bcheckBlock(block []*a.Node) error {
 	unreachable := false
 	for _, o := range block {
 		q.errFilename, q.errLine = o.AsRaw().FilenameLine()
+		q.errCol = o.AsRaw().Col()
 		if unreachable {
 			return fmt.Errorf("check: unreachable code")
 		}
+		q.explain(o)
 		if err := q.bcheckStatement(o); err != nil {
 			return err
 		}
@@ -272,7 +283,11 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 
 	case a.KAssign:
 		n := n.AsAssign()
-		if err := q.bcheckAssignment(n.LHS(), n.Operator(), n.RHS()); err != nil {
+		if lhs := n.LHS(); (lhs != nil) && (lhs.Operator() == a.ExprOperatorList) {
+			if err := q.bcheckAssignmentMultiple(lhs, n.RHS()); err != nil {
+				return err
+			}
+		} else if err := q.bcheckAssignment(n.LHS(), n.Operator(), n.RHS()); err != nil {
 			return err
 		}
 
@@ -357,6 +372,15 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 
 	case a.KRet:
 		n := n.AsRet()
+		if outs := q.astFunc.Outs(); outs != nil {
+			for i, o := range n.Value().Args() {
+				lTyp := outs.Fields()[i].AsField().XType()
+				if _, err := q.bcheckAssignment1(nil, lTyp, t.IDEq, o.AsExpr()); err != nil {
+					return err
+				}
+			}
+			break
+		}
 		lTyp := q.astFunc.Out()
 		if q.astFunc.Effect().Coroutine() {
 			lTyp = typeExprStatus
@@ -375,6 +399,17 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 			}
 		}
 
+		if n.Keyword() == t.IDReturn {
+			if err := q.bcheckFuncPosts(); err != nil {
+				return err
+			}
+		}
+
+	case a.KSwitch:
+		if err := q.bcheckSwitch(n.AsSwitch()); err != nil {
+			return err
+		}
+
 	case a.KVar:
 		if err := q.bcheckVar(n.AsVar()); err != nil {
 			return err
@@ -411,7 +446,15 @@ func (q *checker) bcheckFuncAssert(n *a.Assert) error {
 		cond.RHS().AsExpr().SetMBounds(b)
 		return nil
 	}
-	return fmt.Errorf("check: function assertions are not supported yet")
+	if _, err := q.bcheckExpr(n.Condition(), 0); err != nil {
+		return err
+	}
+	for _, o := range n.Args() {
+		if _, err := q.bcheckExpr(o.AsArg().Value(), 0); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (q *checker) bcheckAssert(n *a.Assert) error {
@@ -429,6 +472,12 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 		}
 	}
 
+	if q.astFunc.Test() && (n.Keyword() == t.IDAssert) {
+		// In a test func, an assert is checked at run time instead of
+		// proven. The code after it only runs if it holds.
+		return q.bcheckAssertAppendFact(condition)
+	}
+
 	for _, x := range q.facts {
 		if x.Eq(condition) {
 			return nil
@@ -451,12 +500,24 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 			condition.LHS().AsExpr(), condition.RHS().AsExpr())
 	}
 
+	if (err == errFailed) && (q.c.opts.Prover != nil) {
+		if proved, perr := q.proveWithProver(condition); perr != nil {
+			err = perr
+		} else if proved {
+			err = nil
+		}
+	}
+
 	if err != nil {
 		if err == errFailed {
 			return fmt.Errorf("check: cannot prove %q", condition.Str(q.tm))
 		}
 		return fmt.Errorf("check: cannot prove %q: %v", condition.Str(q.tm), err)
 	}
+	return q.bcheckAssertAppendFact(condition)
+}
+
+func (q *checker) bcheckAssertAppendFact(condition *a.Expr) error {
 	o, err := simplify(q.tm, condition)
 	if err != nil {
 		return err
@@ -466,6 +527,7 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 }
 
 func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
+	q.callPosts = nil
 	oldFacts := (map[*a.Expr]struct{})(nil)
 	if (rhs.Operator() == a.ExprOperatorCall) && rhs.Effect().Impure() {
 		oldFacts = map[*a.Expr]struct{}{}
@@ -494,29 +556,12 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 	}
 
 	if (rhs.Operator() == a.ExprOperatorCall) && rhs.Effect().Impure() {
-		recv := rhs.LHS().AsExpr().LHS().AsExpr()
+		frame, fields := q.callFrame(rhs)
 		if err := q.facts.update(func(x *a.Expr) (*a.Expr, error) {
 			if _, ok := oldFacts[x]; !ok {
 				// No-op. Don't drop any newly minted facts.
-			} else {
-				// Drop any old facts involving the receiver.
-				if x.Mentions(recv) {
-					return nil, nil
-				}
-				// Drop any facts involving a pass-by-reference argument.
-				for _, arg := range rhs.Args() {
-					v := arg.AsArg().Value()
-					if typ := v.MType(); typ.IsBool() || typ.IsNullptr() ||
-						typ.IsNumTypeOrIdeal() || typ.IsStatus() {
-						continue
-					}
-					// TODO: take extra care if v is a slice? For example,
-					// facts involving "v.length()" aren't affected by passing
-					// v to an impure function.
-					if x.Mentions(v) {
-						return nil, nil
-					}
-				}
+			} else if q.callAffects(rhs, frame, fields, x) {
+				return nil, nil
 			}
 			return x, nil
 		}); err != nil {
@@ -524,6 +569,15 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 		}
 	}
 
+	// Assume the post conditions of any calls, unless a coroutine call might
+	// have suspended instead of completing.
+	if (rhs.Operator() != a.ExprOperatorCall) || !rhs.Effect().Coroutine() || (op != t.IDEqQuestion) {
+		for _, x := range q.callPosts {
+			q.facts.appendFact(x)
+		}
+	}
+	q.callPosts = nil
+
 	if lhs == nil {
 		return nil
 	}
@@ -643,6 +697,93 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 	return nil
 }
 
+func (q *checker) bcheckAssignmentMultiple(lhs *a.Expr, rhs *a.Expr) error {
+	// Check the call, and drop any facts that it invalidates, as if it was
+	// an expression statement.
+	if err := q.bcheckAssignment(nil, t.IDEq, rhs); err != nil {
+		return err
+	}
+	f, err := q.c.resolveFunc(rhs.LHS().AsExpr().MType())
+	if err != nil {
+		return err
+	}
+
+	for i, o := range lhs.Args() {
+		o := o.AsExpr()
+		if _, err := q.bcheckExpr(o, 0); err != nil {
+			return err
+		}
+		lb, err := q.bcheckTypeExpr(o.MType())
+		if err != nil {
+			return err
+		}
+		out := f.Outs().Fields()[i].AsField()
+		ob, err := q.bcheckTypeExpr(out.XType())
+		if err != nil {
+			return err
+		}
+		if (ob[0].Cmp(lb[0]) < 0) || (ob[1].Cmp(lb[1]) > 0) {
+			return fmt.Errorf("check: %q's %q bounds %v is not within bounds %v",
+				rhs.Str(q.tm), out.Name().Str(q.tm), ob, lb)
+		}
+
+		if err := q.facts.dropAnyFactsMentioning(o); err != nil {
+			return err
+		}
+		if !o.MType().IsNumType() {
+			continue
+		}
+		if lb[0].Cmp(ob[0]) < 0 {
+			c, err := makeConstValueExpr(q.tm, ob[0])
+			if err != nil {
+				return err
+			}
+			q.facts.appendBinaryOpFact(t.IDXBinaryGreaterEq, o, c)
+		}
+		if lb[1].Cmp(ob[1]) > 0 {
+			c, err := makeConstValueExpr(q.tm, ob[1])
+			if err != nil {
+				return err
+			}
+			q.facts.appendBinaryOpFact(t.IDXBinaryLessEq, o, c)
+		}
+	}
+	return nil
+}
+
+// callAffects returns whether call, an impure call whose frame and fields
+// are as returned by callFrame, can change the value of x.
+func (q *checker) callAffects(call *a.Expr, frame *frame, fields map[t.ID]bool, x *a.Expr) bool {
+	// Any x involving the receiver or, for a "this.foo!()" call, the part of
+	// it that foo can modify.
+	if frame != nil {
+		if q.c.frameAffects(frame, fields, x) {
+			return true
+		}
+	} else if x.Mentions(call.LHS().AsExpr().LHS().AsExpr()) {
+		return true
+	}
+	// Any x involving a pass-by-reference argument.
+	for _, arg := range call.Args() {
+		v := arg.AsArg().Value()
+		if typ := v.MType(); typ.IsBool() || typ.IsNullptr() ||
+			typ.IsNumTypeOrIdeal() || typ.IsStatus() {
+			continue
+		}
+		// TODO: take extra care if v is a slice? For example, facts
+		// involving "v.length()" aren't affected by passing v to an impure
+		// function.
+		if x.Mentions(v) {
+			return true
+		}
+		// Writing through "this.buf[i .. j]" modifies this.buf.
+		if field := thisField(v); (field != nil) && x.Mentions(field) {
+			return true
+		}
+	}
+	return false
+}
+
 func (q *checker) bcheckAssignment1(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs *a.Expr) (bounds, error) {
 	if lhs == nil && op != t.IDEq {
 		return bounds{}, fmt.Errorf("check: internal error: missing LHS for op key 0x%X", op)
@@ -668,11 +809,12 @@ func (q *checker) bcheckAssignment1(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs
 
 	if (lTyp != nil) && ((rb[0].Cmp(lb[0]) < 0) || (rb[1].Cmp(lb[1]) > 0)) {
 		if op == t.IDEq {
-			return bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
-				rhs.Str(q.tm), rb, lb)
+			return bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v%s",
+				rhs.Str(q.tm), rb, lb, q.witness(rhs, lb))
 		} else {
-			return bounds{}, fmt.Errorf("check: assignment %q bounds %v is not within bounds %v",
-				lhs.Str(q.tm)+" "+op.Str(q.tm)+" "+rhs.Str(q.tm), rb, lb)
+			n := a.NewExpr(0, op.BinaryForm(), 0, lhs.AsNode(), nil, rhs.AsNode(), nil)
+			return bounds{}, fmt.Errorf("check: assignment %q bounds %v is not within bounds %v%s",
+				lhs.Str(q.tm)+" "+op.Str(q.tm)+" "+rhs.Str(q.tm), rb, lb, q.witness(n, lb))
 		}
 	}
 	return rb, nil
@@ -740,7 +882,36 @@ func (q *checker) unify(branches [][]*a.Expr) error {
 	})
 }
 
+// noteDroppedFacts calls Options.DroppedFact for each fact that holds at the
+// end of some, but not all, of the branches that join after n, an if/else
+// chain or switch. Facts that are assumed on entry to a branch, such as an if
+// condition, are expected to hold in that branch only, and are not noted.
+func (q *checker) noteDroppedFacts(n *a.Node, construct string, branches [][]*a.Expr, assumed map[string]bool) {
+	if (q.c.opts.DroppedFact == nil) || q.c.rechecking || (len(branches) < 2) {
+		return
+	}
+	m := map[string]int{}
+	for _, b := range branches {
+		for _, f := range b {
+			m[f.Str(q.tm)]++
+		}
+	}
+	filename, line := n.AsRaw().FilenameLine()
+	for _, b := range branches {
+		for _, f := range b {
+			s := f.Str(q.tm)
+			if (m[s] > 0) && (m[s] < len(branches)) && !assumed[s] {
+				q.c.opts.DroppedFact(filename, line, render.Expr(f, q.tm), construct)
+			}
+			// Note each fact once, even if it holds in multiple branches.
+			m[s] = 0
+		}
+	}
+}
+
 func (q *checker) bcheckIf(n *a.If) error {
+	node := n.AsNode()
+	assumed := map[string]bool{}
 	branches := [][]*a.Expr(nil)
 	for n != nil {
 		snap := snapshot(q.facts)
@@ -753,6 +924,7 @@ func (q *checker) bcheckIf(n *a.If) error {
 		if n.Condition().ConstValue() == nil {
 			q.facts.appendFact(n.Condition())
 		}
+		q.facts.markAssumed(assumed, len(snap), q.tm)
 		if err := q.bcheckBlock(n.BodyIfTrue()); err != nil {
 			return err
 		}
@@ -769,6 +941,7 @@ func (q *checker) bcheckIf(n *a.If) error {
 				q.facts.appendFact(inverse)
 			}
 		}
+		q.facts.markAssumed(assumed, len(snap), q.tm)
 		if bif := n.BodyIfFalse(); len(bif) > 0 {
 			if err := q.bcheckBlock(bif); err != nil {
 				return err
@@ -784,6 +957,100 @@ func (q *checker) bcheckIf(n *a.If) error {
 			break
 		}
 	}
+	q.noteDroppedFacts(node, "if/else", branches, assumed)
+	return q.unify(branches)
+}
+
+func (q *checker) bcheckSwitch(n *a.Switch) error {
+	subject := n.Subject()
+	sb, err := q.bcheckExpr(subject, 0)
+	if err != nil {
+		return err
+	}
+
+	tb, err := q.bcheckTypeExpr(subject.MType())
+	if err != nil {
+		return err
+	}
+
+	// Check that every case value fits the subject's type, and, absent a
+	// default case, that the case values cover every value that the subject
+	// can have here, given its bounds.
+	values := []*big.Int(nil)
+	for _, o := range n.Cases() {
+		for _, v := range o.AsCase().Values() {
+			v := v.AsExpr()
+			if _, err := q.bcheckExpr(v, 0); err != nil {
+				return err
+			}
+			cv := v.ConstValue()
+			if !tb.ContainsInt(cv) {
+				return fmt.Errorf("check: case value %v is outside the range %v of switch subject %q",
+					cv, tb, subject.Str(q.tm))
+			}
+			values = append(values, cv)
+		}
+	}
+	if !n.HasDefault() {
+		sort.Slice(values, func(i int, j int) bool {
+			return values[i].Cmp(values[j]) < 0
+		})
+		next := sb[0]
+		for _, v := range values {
+			if c := v.Cmp(next); c < 0 {
+				continue
+			} else if c > 0 {
+				break
+			}
+			next = big.NewInt(0).Add(next, one)
+		}
+		if next.Cmp(sb[1]) <= 0 {
+			return fmt.Errorf("check: switch on %q is not exhaustive: no case for %v",
+				subject.Str(q.tm), next)
+		}
+	}
+
+	// Check each case body, assuming that the subject matches its values.
+	assumed := map[string]bool{}
+	branches := [][]*a.Expr(nil)
+	snap := snapshot(q.facts)
+	for _, o := range n.Cases() {
+		o := o.AsCase()
+		q.facts = append(q.facts[:0], snap...)
+		if vs := o.Values(); len(vs) == 1 {
+			q.facts.appendBinaryOpFact(t.IDXBinaryEqEq, subject, vs[0].AsExpr())
+		} else if len(vs) > 1 {
+			lo, hi := vs[0].AsExpr().ConstValue(), vs[0].AsExpr().ConstValue()
+			for _, v := range vs[1:] {
+				if cv := v.AsExpr().ConstValue(); cv.Cmp(lo) < 0 {
+					lo = cv
+				} else if cv.Cmp(hi) > 0 {
+					hi = cv
+				}
+			}
+			for _, x := range [...]struct {
+				op t.ID
+				cv *big.Int
+			}{
+				{t.IDXBinaryGreaterEq, lo},
+				{t.IDXBinaryLessEq, hi},
+			} {
+				c, err := makeConstValueExpr(q.tm, x.cv)
+				if err != nil {
+					return err
+				}
+				q.facts.appendBinaryOpFact(x.op, subject, c)
+			}
+		}
+		q.facts.markAssumed(assumed, len(snap), q.tm)
+		if err := q.bcheckBlock(o.Body()); err != nil {
+			return err
+		}
+		if !a.Terminates(o.Body()) {
+			branches = append(branches, snapshot(q.facts))
+		}
+	}
+	q.noteDroppedFacts(n.AsNode(), "switch", branches, assumed)
 	return q.unify(branches)
 }
 
@@ -878,6 +1145,16 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		}
 		q.facts.appendFact(o.AsAssert().Condition())
 	}
+
+	// Without any break, the only way out of the loop is for the while
+	// condition to be false, so also assume the inverted while condition.
+	if cv := n.Condition().ConstValue(); (cv == nil) && !n.HasBreak() {
+		if inverse, err := invert(q.tm, n.Condition()); err != nil {
+			return err
+		} else {
+			q.facts.appendFact(inverse)
+		}
+	}
 	return nil
 }
 
@@ -922,8 +1199,21 @@ func (q *checker) bcheckExpr(n *a.Expr, depth uint32) (bounds, error) {
 	}
 
 	if (nb[0].Cmp(tb[0]) < 0) || (nb[1].Cmp(tb[1]) > 0) {
-		return bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
-			n.Str(q.tm), nb, tb)
+		if n.Operator() == t.IDXBinaryAs {
+			lhs, witness := n.LHS().AsExpr(), ""
+			if isWitnessOp(lhs.Operator()) {
+				witness = q.witness(lhs, tb)
+			}
+			return bounds{}, fmt.Errorf("check: cannot convert %q, with bounds %v, as type %q, with bounds %v, "+
+				"without truncating (use \"%s via truncate\" if that is intended)%s",
+				lhs.Str(q.tm), nb, n.MType().Str(q.tm), tb, n.Str(q.tm), witness)
+		}
+		if op := n.Operator(); n.MType().IsSignedInteger() && (op != 0) && (op != t.IDXBinaryAs) {
+			return bounds{}, fmt.Errorf("check: signed expression %q bounds %v may overflow %q bounds %v%s",
+				n.Str(q.tm), nb, n.MType().Str(q.tm), tb, q.witness(n, tb))
+		}
+		return bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v%s",
+			n.Str(q.tm), nb, tb, q.witness(n, tb))
 	}
 
 	n.SetMBounds(nb)
@@ -971,6 +1261,16 @@ func (q *checker) bcheckExpr1(n *a.Expr, depth uint32) (bounds, error) {
 		b, err := q.bcheckExpr(n.LHS().AsExpr(), depth)
 		if err != nil {
 			return bounds{}, err
+		} else if n.Truncates() {
+			// If the value does not already fit, it wraps around (or, for
+			// signed types, uses two's complement), so it could be anything.
+			tb, err := q.bcheckTypeExpr(n.MType())
+			if err != nil {
+				return bounds{}, err
+			}
+			if (b[0].Cmp(tb[0]) < 0) || (b[1].Cmp(tb[1]) > 0) {
+				b = tb
+			}
 		} else if lhs := n.LHS().AsExpr(); lhs.MType().IsEitherSliceType() {
 			cv := (*big.Int)(nil)
 			rhs := n.RHS().AsTypeExpr()
@@ -1136,7 +1436,6 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 }
 
 func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
-	// TODO: handle func pre/post conditions.
 	lhs := n.LHS().AsExpr()
 	f, err := q.c.resolveFunc(lhs.MType())
 	if err != nil {
@@ -1152,6 +1451,11 @@ func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
 			return err
 		}
 	}
+	posts, err := q.bcheckCallPres(f, n)
+	if err != nil {
+		return err
+	}
+	q.callPosts = append(q.callPosts, posts...)
 
 	recv := lhs.LHS().AsExpr()
 	if recv.MType().Decorator() != t.IDNptr {
@@ -1648,6 +1952,13 @@ func (q *checker) bcheckExprUnaryOp(n *a.Expr, depth uint32) (bounds, error) {
 		return rb, nil
 	case t.IDXUnaryMinus:
 		return bounds{neg(rb[1]), neg(rb[0])}, nil
+	case t.IDXUnaryTilde:
+		// For an unsigned type with maximum m, "~x" equals "m - x".
+		m := numTypeBounds[n.MType().QID()[1]][1]
+		return bounds{
+			big.NewInt(0).Sub(m, rb[1]),
+			big.NewInt(0).Sub(m, rb[0]),
+		}, nil
 	case t.IDXUnaryNot:
 		return bounds{zero, one}, nil
 	}
@@ -1680,6 +1991,17 @@ func (q *checker) bcheckExprXBinaryMinus(lhs *a.Expr, lb bounds, rhs *a.Expr, rb
 	return nb, nil
 }
 
+// modularBounds returns the bounds of a modular (wrapping) arithmetic result
+// whose exact (non-wrapping) bounds are nb. If nb fits within typeBounds then
+// no wrapping can occur and nb is exact. Otherwise, the result can be any
+// value of the type.
+func modularBounds(nb bounds, typeBounds bounds) bounds {
+	if (typeBounds[0] != nil) && (nb[0] != nil) && typeBounds.ContainsIntRange(nb) {
+		return nb
+	}
+	return typeBounds
+}
+
 func (q *checker) bcheckExprBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) (bounds, error) {
 	lb, err := q.bcheckExpr(lhs, depth)
 	if err != nil {
@@ -1716,9 +2038,10 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			nb, _ := lb.TryQuo(rb)
 			return nb, nil
 		}
+		// "x % y" is less than y and, as x is non-negative, no more than x.
 		return bounds{
 			zero,
-			big.NewInt(0).Sub(rb[1], one),
+			min(lb[1], big.NewInt(0).Sub(rb[1], one)),
 		}, nil
 
 	case t.IDXBinaryShiftL, t.IDXBinaryTildeModShiftL, t.IDXBinaryShiftR:
@@ -1746,8 +2069,7 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			return nb, nil
 		case t.IDXBinaryTildeModShiftL:
 			nb, _ := lb.TryLsh(rb)
-			nb[1] = min(nb[1], typeBounds[1])
-			return nb, nil
+			return modularBounds(nb, typeBounds), nil
 		case t.IDXBinaryShiftR:
 			nb, _ := lb.TryRsh(rb)
 			return nb, nil
@@ -1783,7 +2105,16 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			typ = rhs.MType()
 		}
 		if qid := typ.QID(); qid[0] == t.IDBase {
-			return numTypeBounds[qid[1]], nil
+			nb := bounds{}
+			switch op {
+			case t.IDXBinaryTildeModPlus:
+				nb, _ = q.bcheckExprXBinaryPlus(lhs, lb, rhs, rb)
+			case t.IDXBinaryTildeModMinus:
+				nb, _ = q.bcheckExprXBinaryMinus(lhs, lb, rhs, rb)
+			case t.IDXBinaryTildeModStar:
+				nb = lb.Mul(rb)
+			}
+			return modularBounds(nb, numTypeBounds[qid[1]]), nil
 		}
 
 	case t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
@@ -1813,6 +2144,12 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			return nb, nil
 		}
 
+	case t.IDXBinaryLessQuestion:
+		return bounds{min(lb[0], rb[0]), min(lb[1], rb[1])}, nil
+
+	case t.IDXBinaryGreaterQuestion:
+		return bounds{max(lb[0], rb[0]), max(lb[1], rb[1])}, nil
+
 	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq, t.IDXBinaryEqEq,
 		t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan, t.IDXBinaryAnd, t.IDXBinaryOr:
 		return bounds{zero, one}, nil
@@ -1935,6 +2272,10 @@ func (q *checker) bcheckTypeExpr1(typ *a.TypeExpr) (bounds, error) {
 				b[1] = cv
 			}
 		}
+
+		if b[0].Cmp(b[1]) > 0 {
+			return bounds{}, fmt.Errorf("check: type refinement for %q is empty", typ.Str(q.tm))
+		}
 	}
 
 	return b, nil
@@ -0,0 +1,280 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// cacheVersion is part of every cache key. Change it whenever the checker
+// changes what it can prove (its proof rules), what verifying a func body
+// depends on (what cacheKey hashes) or what it records in the AST.
+const cacheVersion = "wuffs-check-cache-2"
+
+// Cache stores the results of verifying func bodies, so that re-checking a
+// package after editing one func only re-proves that func and those that
+// depend on it. Keys and values are opaque to the Cache.
+//
+// Type checking is not cached, as code generation needs its results.
+type Cache interface {
+	// Get returns the value for key, or false if there is none.
+	Get(key string) ([]byte, bool)
+	// Put sets the value for key. Failing to do so is not an error, as the
+	// cache is only an optimization.
+	Put(key string, value []byte)
+}
+
+// DirCache is a Cache that stores each value in its own file under a
+// directory, which is created if necessary.
+type DirCache struct {
+	Dir string
+}
+
+func (d *DirCache) filename(key string) string {
+	return filepath.Join(d.Dir, key[:2], key)
+}
+
+func (d *DirCache) Get(key string) ([]byte, bool) {
+	if len(key) < 2 {
+		return nil, false
+	}
+	value, err := os.ReadFile(d.filename(key))
+	return value, err == nil
+}
+
+func (d *DirCache) Put(key string, value []byte) {
+	if len(key) < 2 {
+		return
+	}
+	filename := d.filename(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+	// Write to a temporary file and rename it, so that concurrent readers
+	// never see a partial value.
+	f, err := os.CreateTemp(filepath.Dir(filename), "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// funcDeps returns the funcs that n's body and asserts call, sorted by name.
+// Verifying n depends on their signatures and contracts and, for methods of
+// this package's structs, on their frames (the fields that a "this.foo!()"
+// call can modify), so these are the edges of the dependency graph that the
+// cache key follows. A frame depends on the callee's body and, transitively,
+// its callees' bodies, so cacheKey hashes the computed frame instead of
+// following those edges. The other nodes of that graph, the package's (and
+// used packages') consts, statuses and structs, are covered by declsHash.
+func (c *Checker) funcDeps(n *a.Func) ([]*a.Func, error) {
+	seen := map[*a.Func]bool{}
+	ret := []*a.Func(nil)
+	for _, l := range [2][]*a.Node{n.Asserts(), n.Body()} {
+		for _, o := range l {
+			if err := o.Walk(func(o *a.Node) error {
+				if o.Kind() != a.KExpr {
+					return nil
+				}
+				o1 := o.AsExpr()
+				if o1.Operator() != a.ExprOperatorCall {
+					return nil
+				}
+				f, err := c.resolveFunc(o1.LHS().AsExpr().MType())
+				if err != nil {
+					return err
+				}
+				if !seen[f] {
+					seen[f] = true
+					ret = append(ret, f)
+				}
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(ret, func(i int, j int) bool {
+		return ret[i].QQID().Str(c.tm) < ret[j].QQID().Str(c.tm)
+	})
+	return ret, nil
+}
+
+// declsHash returns a hash of every const, status and struct that c knows of.
+func (c *Checker) declsHash() []byte {
+	if c.cachedDeclsHash != nil {
+		return c.cachedDeclsHash
+	}
+	nodes := map[string]*a.Node{}
+	for qid, o := range c.consts {
+		nodes["const "+qid.Str(c.tm)] = o.AsNode()
+	}
+	for qid, o := range c.statuses {
+		nodes["status "+qid.Str(c.tm)] = o.AsNode()
+	}
+	for qid, o := range c.structs {
+		nodes["struct "+qid.Str(c.tm)] = o.AsNode()
+	}
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\n", name)
+		a.Print(h, c.tm, nodes[name])
+	}
+	c.cachedDeclsHash = h.Sum(nil)
+	return c.cachedDeclsHash
+}
+
+// cacheKey returns the key for the result of verifying n's body. Registered
+// rules are Go code, which cannot be hashed, so only their names are part of
+// the key: changing what a rule accepts needs a new name or a cleared cache.
+func (c *Checker) cacheKey(n *a.Func) (string, error) {
+	deps, err := c.funcDeps(n)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%t %#v\n%x\n%q\n", cacheVersion,
+		c.opts.RequireDefiniteAssignment, c.opts.Prover, c.declsHash(), registeredRuleNames())
+	a.Print(h, c.tm, n.AsNode())
+	for _, f := range deps {
+		fmt.Fprintf(h, "dep %s %s\n", f.QQID().Str(c.tm), f.Effect())
+		if in := f.In(); in != nil {
+			a.Print(h, c.tm, in.AsNode())
+		}
+		if out := f.Out(); out != nil {
+			a.Print(h, c.tm, out.AsNode())
+		}
+		if outs := f.Outs(); outs != nil {
+			a.Print(h, c.tm, outs.AsNode())
+		}
+		if r := f.Receiver(); (r[0] == 0) && (r[1] != 0) {
+			fmt.Fprintf(h, "frame %s\n", c.funcFrame(f).str(c.tm))
+		}
+		for _, o := range f.Asserts() {
+			a.Print(h, c.tm, o)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedResult is what verifying a func body records in its AST, beyond the
+// type checking results.
+type cachedResult struct {
+	// Bounds are the MBounds of every node in the body, in walk order, as
+	// decimal strings.
+	Bounds [][2]string
+	// RetsError numbers, in walk order, the return (and yield) statements
+	// that return an error.
+	RetsError []int
+}
+
+// bodyNodes returns the nodes of body, in walk order.
+func bodyNodes(body []*a.Node) []*a.Node {
+	ret := []*a.Node(nil)
+	for _, o := range body {
+		o.Walk(func(o *a.Node) error {
+			ret = append(ret, o)
+			return nil
+		})
+	}
+	return ret
+}
+
+// loadCachedResult applies a cached result for n, if there is one, returning
+// whether it did.
+func (c *Checker) loadCachedResult(n *a.Func, key string) bool {
+	value, ok := c.opts.Cache.Get(key)
+	if !ok {
+		return false
+	}
+	r := cachedResult{}
+	if err := json.Unmarshal(value, &r); err != nil {
+		return false
+	}
+	nodes := bodyNodes(n.Body())
+	if len(r.Bounds) != len(nodes) {
+		return false
+	}
+	bs := make([]bounds, len(nodes))
+	for i, x := range r.Bounds {
+		for j := range x {
+			v, ok := big.NewInt(0).SetString(x[j], 10)
+			if !ok {
+				return false
+			}
+			bs[i][j] = v
+		}
+	}
+	rets := []*a.Ret(nil)
+	for _, o := range nodes {
+		if o.Kind() == a.KRet {
+			rets = append(rets, o.AsRet())
+		}
+	}
+	for _, i := range r.RetsError {
+		if (i < 0) || (len(rets) <= i) {
+			return false
+		}
+	}
+
+	for i, o := range nodes {
+		o.SetMBounds(bs[i])
+	}
+	for _, i := range r.RetsError {
+		rets[i].SetRetsError()
+	}
+	return true
+}
+
+func (c *Checker) storeCachedResult(n *a.Func, key string) {
+	r := cachedResult{}
+	numRets := 0
+	for _, o := range bodyNodes(n.Body()) {
+		b := o.MBounds()
+		if (b[0] == nil) || (b[1] == nil) {
+			return
+		}
+		r.Bounds = append(r.Bounds, [2]string{b[0].String(), b[1].String()})
+		if o.Kind() == a.KRet {
+			if o.AsRet().RetsError() {
+				r.RetsError = append(r.RetsError, numRets)
+			}
+			numRets++
+		}
+	}
+	if value, err := json.Marshal(r); err == nil {
+		c.opts.Cache.Put(key, value)
+	}
+}
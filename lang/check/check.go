@@ -18,9 +18,11 @@ import (
 	"math/big"
 	"path"
 	"sort"
+	"strings"
 
 	"github.com/google/wuffs/lang/builtin"
 	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/lang/render"
 
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
@@ -30,13 +32,14 @@ type Error struct {
 	Err      error
 	Filename string
 	Line     uint32
+	Col      uint32 // 1-based, or 0 if unknown.
 
 	TMap  *t.Map
 	Facts []*a.Expr
 }
 
 func (e *Error) Error() string {
-	s := fmt.Sprintf("%s at %s:%d", e.Err, e.Filename, e.Line)
+	s := fmt.Sprintf("%s at %s", e.Err, pos(e.Filename, e.Line, e.Col))
 	if e.TMap == nil {
 		return s
 	}
@@ -49,7 +52,60 @@ func (e *Error) Error() string {
 	return string(b)
 }
 
+// Options are optional features of CheckWithOptions. The zero value gives
+// the same behavior as Check.
+type Options struct {
+	// Prover, if non-nil, is consulted for any assert statement that the
+	// built-in reasoning cannot prove.
+	//
+	// TODO: also consult it for the implicit bounds checks, such as on array
+	// indexes and assignments.
+	Prover Prover
+
+	// RequireDefiniteAssignment rejects reading a numeric or boolean local
+	// variable that, on some path, has not yet been assigned. Without it,
+	// such reads see the variable's implicit zero value.
+	RequireDefiniteAssignment bool
+
+	// RequireResetFields rejects a reset func, one named "reset_foo", that
+	// does not assign every numeric or boolean "foo_" field of its receiver
+	// on every path. Without it, Checker.Lint only warns.
+	RequireResetFields bool
+
+	// ConstantTime rejects code whose run time or memory access pattern
+	// could depend on secret values: those of struct fields and func
+	// arguments declared "secret", and those computed from them.
+	ConstantTime bool
+
+	// Cache, if non-nil, holds the results of verifying func bodies from
+	// previous runs. A func whose body, signature and dependencies are
+	// unchanged is type checked but not re-proved.
+	Cache Cache
+
+	// Explain, if non-nil, is called with the facts (as rendered expressions)
+	// that the bounds checker knows just before each statement that starts
+	// at line ExplainLine of ExplainFilename, or of any file if that is
+	// empty. The statement itself is also rendered, as stmt. It can be
+	// called more than once per statement, such as for the statements of a
+	// loop body, and funcs whose results are in Cache are re-checked.
+	Explain         func(filename string, line uint32, stmt string, facts []string)
+	ExplainFilename string
+	ExplainLine     uint32
+
+	// DroppedFact, if non-nil, is called with each fact (as a rendered
+	// expression) that holds at the end of some, but not all, of the
+	// branches of an if/else chain or switch, and so is dropped where they
+	// join. The filename and line are those of the if or switch, and
+	// construct is "if/else" or "switch". Asserting the fact at the end of
+	// the other branches would keep it. Like Explain, it disables Cache.
+	DroppedFact func(filename string, line uint32, fact string, construct string)
+}
+
 func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error)) (*Checker, error) {
+	return CheckWithOptions(tm, files, resolveUse, nil)
+}
+
+func CheckWithOptions(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error), opts *Options) (*Checker, error) {
 	for _, f := range files {
 		if f == nil {
 			return nil, errors.New("check: Check given a nil *ast.File")
@@ -72,11 +128,20 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 			rMap[id] = r.r
 		}
 	}
+	addRegisteredRules(rMap, tm)
 	c := &Checker{
 		tm:         tm,
 		resolveUse: resolveUse,
 		reasonMap:  rMap,
 
+		provedScripts: map[string]bool{},
+
+		cachedFuncEffects:       map[*a.Func]FuncEffects{},
+		cachedFuncStatusKinds:   map[*a.Func]statusKinds{},
+		cachedFuncFrames:        map[*a.Func]*frame{},
+		cachedFuncReturnsSecret: map[*a.Func]bool{},
+		callerViews:             map[*a.Func]string{},
+
 		topLevelNames: map[t.ID]a.Kind{
 			t.IDBase: a.KUse,
 		},
@@ -102,6 +167,9 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		chooseAlternatives: map[t.QID][]t.ID{},
 		noRecursiveMarks:   map[t.QID]uint8{},
 	}
+	if opts != nil {
+		c.opts = *opts
+	}
 
 	for _, funcs := range builtin.Funcs {
 		if err := c.parseBuiltInFuncs(nil, nil, funcs); err != nil {
@@ -136,19 +204,15 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		if err != nil {
 			return nil, err
 		}
-		xType := (*a.TypeExpr)(nil)
 		switch z.Type {
-		case t.IDU8:
-			xType = typeExprU8
-		case t.IDU16:
-			xType = typeExprU16
-		case t.IDU32:
-			xType = typeExprU32
-		case t.IDU64:
-			xType = typeExprU64
+		case t.IDU8, t.IDU16, t.IDU32, t.IDU64:
 		default:
 			return nil, fmt.Errorf("check: unsupported built-in const type %q", z.Type.Str(tm))
 		}
+		// Each Check call gets its own xType, instead of sharing a package
+		// level typeExprU8 etc, as checkConst sets xType's MType and Check
+		// calls can run concurrently.
+		xType := a.NewTypeExpr(0, t.IDBase, z.Type, nil, nil, nil)
 		value, err := tm.Insert(z.Value)
 		if err != nil {
 			return nil, err
@@ -192,6 +256,136 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 	return c, nil
 }
 
+// Recheck re-verifies decls, top level declarations that were type checked by
+// c but have since been modified, such as those returned by an
+// ast.Rewriter's Changed method. It discards the decls' previous type and
+// bounds checking results and checks their asserts and bodies again.
+//
+// A caller's proofs rely on its callees' asserts and, for "this.foo!()" calls,
+// on their frames. If re-verifying a func changes either of those, its callers
+// in this package are re-verified too, and so on.
+//
+// Only changes to func asserts and bodies can be re-verified incrementally.
+// Other changes, such as to func signatures or to struct fields, require a
+// full Check.
+func (c *Checker) Recheck(decls []*a.Node) error {
+	for _, n := range decls {
+		if n.Kind() != a.KFunc {
+			return fmt.Errorf("check: cannot recheck a %s; use Check instead", n.Kind())
+		}
+		f := n.AsFunc()
+		if c.funcs[f.QQID()] != f {
+			return fmt.Errorf("check: cannot recheck unknown func %s", f.QQID().Str(c.tm))
+		}
+	}
+
+	c.rechecking = true
+	defer func() { c.rechecking = false }()
+	c.noRecursiveMarks = map[t.QID]uint8{}
+	c.cachedFuncEffects = map[*a.Func]FuncEffects{}
+	c.cachedFuncStatusKinds = map[*a.Func]statusKinds{}
+	c.cachedFuncFrames = map[*a.Func]*frame{}
+	c.cachedFuncReturnsSecret = map[*a.Func]bool{}
+
+	queue := append([]*a.Node(nil), decls...)
+	queued := map[*a.Func]bool{}
+	for _, n := range queue {
+		queued[n.AsFunc()] = true
+	}
+	for i := 0; i < len(queue); i++ {
+		n := queue[i]
+		f := n.AsFunc()
+		oldView := c.callerViews[f]
+		if err := c.recheck1(n); err != nil {
+			return err
+		} else if c.callerViews[f] == oldView {
+			continue
+		}
+		callers, err := c.funcCallers(f, queued)
+		if err != nil {
+			return err
+		}
+		for _, g := range callers {
+			queued[g] = true
+			queue = append(queue, g.AsNode())
+		}
+	}
+	return nil
+}
+
+// recheck1 re-verifies n, one of Recheck's decls or their callers.
+func (c *Checker) recheck1(n *a.Node) error {
+	f := n.AsFunc()
+	for _, l := range [2][]*a.Node{f.Asserts(), f.Body()} {
+		for _, o := range l {
+			o.Walk(dropCheckResults)
+		}
+	}
+	// Drop the body's local variables, keeping those that
+	// checkFuncSignature added.
+	lv := c.localVars[f.QQID()]
+	for name := range lv {
+		if (name != t.IDArgs) && (name != t.IDCoroutineResumed) && (name != t.IDThis) {
+			delete(lv, name)
+		}
+	}
+
+	if err := c.checkFuncContract(n); err != nil {
+		return err
+	}
+	if err := c.checkFuncBody(n); err != nil {
+		return err
+	}
+	if err := c.checkNoRecursiveFuncs(n); err != nil {
+		return err
+	}
+	if err := c.checkFuncResetFields(n); err != nil {
+		return err
+	}
+	if err := c.checkFuncStatuses(n); err != nil {
+		return err
+	}
+	if err := c.checkFuncConstantTime(n); err != nil {
+		return err
+	}
+	return allTypeChecked(c.tm, n)
+}
+
+// funcCallers returns this package's funcs, other than those in skip, that
+// call f, sorted by name.
+func (c *Checker) funcCallers(f *a.Func, skip map[*a.Func]bool) ([]*a.Func, error) {
+	ret := []*a.Func(nil)
+	for qqid, g := range c.funcs {
+		if (qqid[0] != 0) || skip[g] {
+			continue
+		}
+		deps, err := c.funcDeps(g)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deps {
+			if d == f {
+				ret = append(ret, g)
+				break
+			}
+		}
+	}
+	sort.Slice(ret, func(i int, j int) bool {
+		return ret[i].QQID().Str(c.tm) < ret[j].QQID().Str(c.tm)
+	})
+	return ret, nil
+}
+
+func dropCheckResults(n *a.Node) error {
+	n.SetMBounds(bounds{})
+	n.SetMType(nil)
+	if n.Kind() == a.KExpr {
+		n.AsExpr().SetConstValue(nil)
+		n.AsExpr().SetIntrinsicKind(a.IntrinsicNone)
+	}
+	return nil
+}
+
 var phases = [...]struct {
 	kind  a.Kind
 	check func(*Checker, *a.Node) error
@@ -208,6 +402,9 @@ var phases = [...]struct {
 	{a.KFunc, (*Checker).checkFuncImplements},
 	{a.KFunc, (*Checker).checkFuncBody},
 	{a.KFunc, (*Checker).checkNoRecursiveFuncs},
+	{a.KFunc, (*Checker).checkFuncResetFields},
+	{a.KFunc, (*Checker).checkFuncStatuses},
+	{a.KFunc, (*Checker).checkFuncConstantTime},
 	{a.KInvalid, (*Checker).checkInterfacesSatisfied},
 	{a.KStruct, (*Checker).checkFieldMethodCollisions},
 	{a.KInvalid, (*Checker).checkAllTypeChecked},
@@ -221,6 +418,30 @@ type Checker struct {
 	tm         *t.Map
 	resolveUse func(usePath string) ([]byte, error)
 	reasonMap  reasonMap
+	opts       Options
+
+	// provedScripts caches the prover's answers, keyed by SMT-LIB2 script.
+	provedScripts map[string]bool
+
+	// cachedFuncEffects memoizes funcEffects.
+	cachedFuncEffects map[*a.Func]FuncEffects
+	// cachedFuncStatusKinds memoizes funcStatusKinds.
+	cachedFuncStatusKinds map[*a.Func]statusKinds
+	// cachedFuncFrames memoizes funcFrame. A nil value means that the frame
+	// is still being computed.
+	cachedFuncFrames map[*a.Func]*frame
+	// cachedFuncReturnsSecret memoizes funcReturnsSecret.
+	cachedFuncReturnsSecret map[*a.Func]bool
+	// cachedDeclsHash memoizes declsHash.
+	cachedDeclsHash []byte
+
+	// callerViews holds each func's callerView, as of when the func was last
+	// checked, so that Recheck can tell whether it changed.
+	callerViews map[*a.Func]string
+
+	// rechecking is whether Recheck is running, whose results are not
+	// stored in (or loaded from) opts.Cache.
+	rechecking bool
 
 	// The topLevelNames map is keyed by the const/status/struct/use
 	// unqualified name (ID, not QID).
@@ -268,6 +489,7 @@ func (c *Checker) checkUse(node *a.Node) error {
 			Err:      fmt.Errorf("check: duplicate top level name %q", baseName.Str(c.tm)),
 			Filename: node.AsUse().Filename(),
 			Line:     node.AsUse().Line(),
+			Col:      node.AsUse().Col(),
 		}
 	}
 	filename += ".wuffs"
@@ -279,7 +501,11 @@ func (c *Checker) checkUse(node *a.Node) error {
 	if err != nil {
 		return err
 	}
-	tokens, _, err := t.Tokenize(c.tm, filename, src)
+	// The used package's API is generated from already checked code, whose
+	// identifiers may be non-ASCII if it was tokenized with that option.
+	tokens, _, err := t.TokenizeOptions(c.tm, filename, src, &t.Options{
+		UnicodeIdents: true,
+	})
 	if err != nil {
 		return err
 	}
@@ -291,6 +517,10 @@ func (c *Checker) checkUse(node *a.Node) error {
 	}
 
 	for _, n := range f.TopLevelDecls() {
+		// Only the used package's pub declarations are visible to this one.
+		if (n.AsRaw().Flags() & a.FlagsPublic) == 0 {
+			continue
+		}
 		if err := n.AsRaw().SetPackage(c.tm, baseName); err != nil {
 			return err
 		}
@@ -328,6 +558,7 @@ func (c *Checker) checkStatus(node *a.Node) error {
 				Err:      fmt.Errorf("check: duplicate top level name %q", qid[1].Str(c.tm)),
 				Filename: n.Filename(),
 				Line:     n.Line(),
+				Col:      n.Col(),
 			}
 		}
 		c.topLevelNames[qid[1]] = a.KStatus
@@ -336,6 +567,7 @@ func (c *Checker) checkStatus(node *a.Node) error {
 			Err:      fmt.Errorf("check: duplicate top level name %q", qid.Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	c.statuses[qid] = n
@@ -353,6 +585,7 @@ func (c *Checker) checkConst(node *a.Node) error {
 				Err:      fmt.Errorf("check: duplicate top level name %q", qid[1].Str(c.tm)),
 				Filename: n.Filename(),
 				Line:     n.Line(),
+				Col:      n.Col(),
 			}
 		}
 		c.topLevelNames[qid[1]] = a.KConst
@@ -361,6 +594,7 @@ func (c *Checker) checkConst(node *a.Node) error {
 			Err:      fmt.Errorf("check: duplicate top level %q", qid.Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	c.consts[qid] = n
@@ -442,6 +676,7 @@ func (c *Checker) checkStructDecl(node *a.Node) error {
 				Err:      fmt.Errorf("check: duplicate top level name %q", qid[1].Str(c.tm)),
 				Filename: n.Filename(),
 				Line:     n.Line(),
+				Col:      n.Col(),
 			}
 		}
 		c.topLevelNames[qid[1]] = a.KStruct
@@ -450,6 +685,7 @@ func (c *Checker) checkStructDecl(node *a.Node) error {
 			Err:      fmt.Errorf("check: duplicate top level name %q", qid.Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	c.structs[qid] = n
@@ -487,7 +723,7 @@ func (c *Checker) checkStructDecl(node *a.Node) error {
 
 	// A struct declaration implies a reset method.
 	in := a.NewStruct(0, n.Filename(), n.Line(), t.IDArgs, nil, nil)
-	f := a.NewFunc(a.EffectImpure.AsFlags(), n.Filename(), n.Line(), qid[1], t.IDReset, in, nil, nil, nil)
+	f := a.NewFunc(a.EffectImpure.AsFlags(), n.Filename(), n.Line(), qid[1], t.IDReset, in, nil, nil, nil, nil)
 	if qid[0] != 0 {
 		f.AsNode().AsRaw().SetPackage(c.tm, qid[0])
 	}
@@ -508,6 +744,7 @@ func (c *Checker) checkStructFields(node *a.Node) error {
 			Err:      fmt.Errorf("%v in struct %s", err, n.QID().Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	return nil
@@ -603,6 +840,7 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 			Err:      fmt.Errorf("%v in in-params for func %s", err, n.QQID().Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	if banCPUArchTypes && (n.Out() != nil) && n.Out().Innermost().IsCPUArchType() {
@@ -610,6 +848,7 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 			Err:      fmt.Errorf("check: cpu_arch type %q not allowed as return type", n.Out().Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	setPlaceholderMBoundsMType(n.In().AsNode())
@@ -619,6 +858,7 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 				Err:      fmt.Errorf("func %s has ? effect but non-empty return type", n.QQID().Str(c.tm)),
 				Filename: n.Filename(),
 				Line:     n.Line(),
+				Col:      n.Col(),
 			}
 		}
 		// TODO: does checking a TypeExpr need a q?
@@ -631,9 +871,21 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 				Err:      fmt.Errorf("%v in out-param for func %s", err, n.QQID().Str(c.tm)),
 				Filename: n.Filename(),
 				Line:     n.Line(),
+				Col:      n.Col(),
 			}
 		}
 	}
+	if outs := n.Outs(); outs != nil {
+		if err := c.checkFuncOuts(n, outs); err != nil {
+			return &Error{
+				Err:      err,
+				Filename: n.Filename(),
+				Line:     n.Line(),
+				Col:      n.Col(),
+			}
+		}
+		setPlaceholderMBoundsMType(outs.AsNode())
+	}
 	setPlaceholderMBoundsMType(n.AsNode())
 
 	// TODO: check somewhere that, if n.Out() is non-nil (or we are
@@ -646,6 +898,7 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 			Err:      fmt.Errorf("check: duplicate top level name %q", qqid.Str(c.tm)),
 			Filename: n.Filename(),
 			Line:     n.Line(),
+			Col:      n.Col(),
 		}
 	}
 	c.funcs[qqid] = n
@@ -672,6 +925,7 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 				Err:      fmt.Errorf("check: no receiver struct defined for function %s", qqid.Str(c.tm)),
 				Filename: n.Filename(),
 				Line:     n.Line(),
+				Col:      n.Col(),
 			}
 		}
 
@@ -689,14 +943,43 @@ func (c *Checker) checkFuncSignature1(node *a.Node, banCPUArchTypes bool) error
 	return nil
 }
 
+func (c *Checker) checkFuncOuts(n *a.Func, outs *a.Struct) error {
+	// Multiple return values are lowered to a C struct type specific to the
+	// func, which rules out sharing a signature with other funcs.
+	switch {
+	case n.Effect().Coroutine():
+		return fmt.Errorf("check: func %s has ? effect but multiple return values", n.QQID().Str(c.tm))
+	case n.Public():
+		return fmt.Errorf("check: pub func %s cannot have multiple return values", n.QQID().Str(c.tm))
+	case n.Choosy(), n.HasChooseCPUArch():
+		return fmt.Errorf("check: choosy or cpu_arch func %s cannot have multiple return values", n.QQID().Str(c.tm))
+	case !n.BodyEndsWithReturn():
+		return fmt.Errorf("check: func %s has multiple return values but does not end with a return", n.QQID().Str(c.tm))
+	}
+	if err := c.checkFields(outs.Fields(), true, true, true, false); err != nil {
+		return fmt.Errorf("%v in out-params for func %s", err, n.QQID().Str(c.tm))
+	}
+	for _, o := range outs.Fields() {
+		if o := o.AsField(); o.XType().IsEitherArrayType() {
+			return fmt.Errorf("check: array type %q not allowed for out-param %q in func %s",
+				o.XType().Str(c.tm), o.Name().Str(c.tm), n.QQID().Str(c.tm))
+		}
+	}
+	return nil
+}
+
 func (c *Checker) checkFuncContract(node *a.Node) error {
 	n := node.AsFunc()
+	c.callerViews[n] = c.callerView(n)
 	if len(n.Asserts()) == 0 {
 		return nil
 	}
 	q := &checker{
-		c:  c,
-		tm: c.tm,
+		c:         c,
+		tm:        c.tm,
+		reasonMap: c.reasonMap,
+		astFunc:   n,
+		localVars: c.localVars[n.QQID()],
 	}
 	for _, o := range n.Asserts() {
 		setPlaceholderMBoundsMType(o)
@@ -710,6 +993,26 @@ func (c *Checker) checkFuncContract(node *a.Node) error {
 	return nil
 }
 
+// callerView returns what verifying n's callers relies on: n's asserts'
+// keywords and conditions (their reasons matter only for verifying n) and, for
+// methods of this package's structs, n's frame.
+func (c *Checker) callerView(n *a.Func) string {
+	b := strings.Builder{}
+	for _, o := range n.Asserts() {
+		o := o.AsAssert()
+		b.WriteString(o.Keyword().Str(c.tm))
+		b.WriteByte(' ')
+		b.WriteString(o.Condition().Str(c.tm))
+		b.WriteByte('\n')
+	}
+	if r := n.Receiver(); (r[0] == 0) && (r[1] != 0) {
+		b.WriteString("frame ")
+		b.WriteString(c.funcFrame(n).str(c.tm))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
 func (c *Checker) checkFuncImplements(node *a.Node) error {
 	n := node.AsFunc()
 	o := c.unseenInterfaceImpls[n.QQID()]
@@ -743,7 +1046,7 @@ func (c *Checker) checkFuncImplements(node *a.Node) error {
 
 func (c *Checker) checkFuncBody(node *a.Node) error {
 	n := node.AsFunc()
-	if len(n.Body()) == 0 {
+	if (len(n.Body()) == 0) && !hasFuncPosts(n) {
 		return nil
 	}
 
@@ -761,31 +1064,64 @@ func (c *Checker) checkFuncBody(node *a.Node) error {
 			Err:      err,
 			Filename: q.errFilename,
 			Line:     q.errLine,
+			Col:      q.errCol,
 		}
 	}
 
-	// TODO: check that variables are never used before they're initialized.
-
 	for _, o := range n.Body() {
 		if err := q.tcheckStatement(o); err != nil {
 			return &Error{
 				Err:      err,
 				Filename: q.errFilename,
 				Line:     q.errLine,
+				Col:      q.errCol,
 			}
 		}
 	}
 
-	if err := q.bcheckBlock(n.Body()); err != nil {
+	key := ""
+	if (c.opts.Cache != nil) && (c.opts.Explain == nil) && (c.opts.DroppedFact == nil) &&
+		!c.rechecking {
+		var err error
+		if key, err = c.cacheKey(n); err != nil {
+			return err
+		} else if c.loadCachedResult(n, key) {
+			return nil
+		}
+	}
+
+	if c.opts.RequireDefiniteAssignment {
+		if err := q.dcheckFuncBody(n.Body()); err != nil {
+			return &Error{
+				Err:      err,
+				Filename: q.errFilename,
+				Line:     q.errLine,
+				Col:      q.errCol,
+			}
+		}
+	}
+
+	q.assumeFuncPres()
+	err := q.bcheckBlock(n.Body())
+	if (err == nil) && !a.Terminates(n.Body()) {
+		// Falling off the end of the body is an implicit return.
+		q.errFilename, q.errLine, q.errCol = n.Filename(), n.Line(), n.Col()
+		err = q.bcheckFuncPosts()
+	}
+	if err != nil {
 		return &Error{
 			Err:      err,
 			Filename: q.errFilename,
 			Line:     q.errLine,
+			Col:      q.errCol,
 			TMap:     c.tm,
 			Facts:    q.facts,
 		}
 	}
 
+	if key != "" {
+		c.storeCachedResult(n, key)
+	}
 	return nil
 }
 
@@ -934,7 +1270,7 @@ func nodeDebugString(tm *t.Map, n *a.Node) string {
 	case a.KConst:
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsConst().QID().Str(tm))
 	case a.KExpr:
-		return fmt.Sprintf("%s node %q", n.Kind(), n.AsExpr().Str(tm))
+		return fmt.Sprintf("%s node %q", n.Kind(), render.Expr(n.AsExpr(), tm))
 	case a.KFunc:
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsFunc().QQID().Str(tm))
 	case a.KTypeExpr:
@@ -943,6 +1279,14 @@ func nodeDebugString(tm *t.Map, n *a.Node) string {
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsStatus().QID().Str(tm))
 	case a.KStruct:
 		return fmt.Sprintf("%s node %q", n.Kind(), n.AsStruct().QID().Str(tm))
+	case a.KAssert, a.KAssign, a.KCase, a.KChoose, a.KIOManip, a.KIf, a.KIterate, a.KJump,
+		a.KRet, a.KSwitch, a.KVar, a.KWhile:
+		// Quote only the first line of a statement with a body.
+		s := render.Stmt(n, tm)
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[:i] + " ..."
+		}
+		return fmt.Sprintf("%s node %q", n.Kind(), s)
 	}
 	return fmt.Sprintf("%s node", n.Kind())
 }
@@ -993,6 +1337,15 @@ type checker struct {
 
 	errFilename string
 	errLine     uint32
+	errCol      uint32
 
 	facts facts
+
+	// callPosts are the post conditions of the funcs called by the current
+	// statement, to be assumed once it completes.
+	callPosts []*a.Expr
+
+	// idealShiftTypes are the types, from the context of an assignment or
+	// return, of shifts such as "1 << x" whose left operand is ideal.
+	idealShiftTypes map[*a.Expr]*a.TypeExpr
 }
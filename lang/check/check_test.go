@@ -14,10 +14,12 @@ import (
 	"bytes"
 	"fmt"
 	"math/big"
+	"os/exec"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/wuffs/lang/builtin"
 	"github.com/google/wuffs/lang/parse"
@@ -52,6 +54,53 @@ func compareToWuffsfmt(tm *t.Map, tokens []t.Token, comments []string, src strin
 	return nil
 }
 
+// checkSrc tokenizes, parses and checks src as the single file "test.wuffs",
+// returning the parse or check error. A tokenizing error fails the test.
+func checkSrc(tt *testing.T, src string, opts *Options) error {
+	tt.Helper()
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		return err
+	}
+	_, err = CheckWithOptions(tm, []*a.File{file}, nil, opts)
+	return err
+}
+
+// parseSrc tokenizes and parses src as the file "test.wuffs". Either error
+// fails the test.
+func parseSrc(tt *testing.T, tm *t.Map, src string) *a.File {
+	tt.Helper()
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	return file
+}
+
+// errMismatch returns "" if err is nil and want is empty, or if err contains
+// the non-empty want. Otherwise, it returns a description of the mismatch.
+func errMismatch(err error, want string) string {
+	if want == "" {
+		if err != nil {
+			return fmt.Sprintf("got error %v, want nil", err)
+		}
+	} else if err == nil {
+		return fmt.Sprintf("got nil error, want one containing %q", want)
+	} else if !strings.Contains(err.Error(), want) {
+		return fmt.Sprintf("got error %v, want one containing %q", err, want)
+	}
+	return ""
+}
+
 func TestCheck(tt *testing.T) {
 	const filename = "test.wuffs"
 	src := strings.TrimSpace(`
@@ -59,6 +108,9 @@ func TestCheck(tt *testing.T) {
 			i : base.i32,
 		)
 
+		/// bar is a method.
+		///
+		/// It has a two paragraph doc comment.
 		pri func foo.bar() {
 			var x : base.u8
 			var y : base.i32
@@ -71,12 +123,27 @@ func TestCheck(tt *testing.T) {
 
 			x = 0
 			x = 1 + (x * 0)
+			x = ~x & 0x0F
+			x <?= 0x07
+			q = (p >? 0) <? 8
 			y = -y - 1
 			y = this.i
 			b = not true
 
 			y = x as base.i32
 
+			switch x & 3 {
+				case 0 {
+					y = 1
+				}
+				case 1, 2 {
+					y = 2
+				}
+				default {
+					y = 3
+				}
+			}
+
 			assert true
 
 			while.label p == q,
@@ -137,6 +204,13 @@ func TestCheck(tt *testing.T) {
 		tt.Fatalf("func name: got %q, want %q", got, want)
 	}
 
+	if got, want := strings.Join(fooBar.Doc(), "\n"), ""+
+		"/// bar is a method.\n"+
+		"///\n"+
+		"/// It has a two paragraph doc comment."; got != want {
+		tt.Fatalf("func doc: got %q, want %q", got, want)
+	}
+
 	got := [][2]string(nil)
 	for id, typ := range fooBarLocalVars {
 		got = append(got, [2]string{
@@ -186,6 +260,10 @@ func TestConstValues(tt *testing.T) {
 		"i = 10  & 3": 2,
 		"i = 10  | 3": 11,
 		"i = 10  ^ 3": 9,
+		"i = 10  % 3": 1,
+		"i = 2 ** 10": 1024,
+		"i = 10 <? 3": 3,
+		"i = 10 >? 3": 10,
 
 		"b = 10 <> 3": 1,
 		"b = 10  < 3": 0,
@@ -266,6 +344,37 @@ func TestConstValues(tt *testing.T) {
 	}
 }
 
+func TestRawStrLiteralConst(tt *testing.T) {
+	const filename = "test.wuffs"
+	src := "pri const RAW : roarray[4] base.u8 = `a\\b\x7F`\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	c, err := Check(tm, []*a.File{file}, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	cv := c.consts[t.QID{0, tm.ByName("RAW")}]
+	if cv == nil {
+		tt.Fatalf("cannot look up const RAW")
+	}
+	got := []int64(nil)
+	for _, o := range cv.Value().Args() {
+		got = append(got, o.AsExpr().ConstValue().Int64())
+	}
+	if want := []int64{0x61, 0x5C, 0x62, 0x7F}; !reflect.DeepEqual(got, want) {
+		tt.Fatalf("got %v, want %v", got, want)
+	}
+}
+
 func TestBitMask(tt *testing.T) {
 	testCases := [][2]uint64{
 		{0, 0},
@@ -319,3 +428,1649 @@ func TestBuiltInTypeMap(tt *testing.T) {
 		}
 	}
 }
+
+func TestFloatLiteralRejected(tt *testing.T) {
+	const filename = "test.wuffs"
+	src := "pri func foo() {\nvar i : base.i32\ni = 1.5\n}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	_, err = Check(tm, []*a.File{file}, nil)
+	if (err == nil) || !strings.Contains(err.Error(), "floating point literal \"1.5\"") {
+		tt.Fatalf("got error %v, want a floating point literal error", err)
+	}
+}
+
+func TestErrorPositions(tt *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{{
+		// A type checking error.
+		"pri func foo() {\n\tvar x : base.u8\n\tx = true\n}\n",
+		" at test.wuffs:3:2",
+	}, {
+		// A bounds checking error, in a nested block.
+		"pri func foo() {\n\tvar x : base.u8\n\tif true {\n\t\tx = 300\n\t}\n}\n",
+		" at test.wuffs:4:3",
+	}, {
+		// A top level declaration error.
+		"pri const X : base.u32 = 1\n  pri const X : base.u32 = 2\n",
+		" at test.wuffs:2:3",
+	}}
+
+	for _, tc := range testCases {
+		err := checkSrc(tt, tc.src, nil)
+		if err == nil {
+			tt.Errorf("src=%q: got nil error, want non-nil", tc.src)
+			continue
+		}
+		got := err.Error()
+		if i := strings.Index(got, ". Facts:"); i >= 0 {
+			got = got[:i]
+		}
+		if !strings.HasSuffix(got, tc.want) {
+			tt.Errorf("src=%q: got %q, want suffix %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestCgenPrefixPragma(tt *testing.T) {
+	src := "use \"cgen prefix myapp_foo\"\npri func foo() {\n}\n"
+
+	tm := &t.Map{}
+	file := parseSrc(tt, tm, src)
+	// A nil resolveUse would reject a `use` that refers to a package.
+	if _, err := Check(tm, []*a.File{file}, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	// The pragma is not a use declaration.
+	if n := len(file.TopLevelDecls()); n != 1 {
+		tt.Fatalf("TopLevelDecls: got %d, want 1", n)
+	}
+	if got, ok := parse.CgenPrefixPragma(tm, file.CgenPrefixPragma()); !ok || (got != "myapp_foo") {
+		tt.Fatalf("CgenPrefixPragma: got %q, %t, want %q, true", got, ok, "myapp_foo")
+	}
+}
+
+func TestSwitchExhaustiveness(tt *testing.T) {
+	testCases := []struct {
+		cases   string
+		wantErr string
+	}{
+		{"case 0 {\n}\ncase 1, 2, 3 {\n}\n", ""},
+		{"case 0, 1 {\n}\ndefault {\n}\n", ""},
+		{"case 0 {\n}\ncase 2, 3 {\n}\n", "not exhaustive: no case for 1"},
+		{"case 0, 1, 2, 3 {\n}\ncase 3 {\n}\n", "duplicate case value 3"},
+		{"case 256 {\n}\ndefault {\n}\n", "outside the range"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u8) {\nswitch args.x & 3 {\n" + tc.cases + "}\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.cases, msg)
+		}
+	}
+}
+
+func TestNamedArguments(tt *testing.T) {
+	testCases := []struct {
+		call    string
+		wantErr string
+	}{
+		{"this.bar!(x: 10, y: 20)", ""},
+		{"this.bar!(y: 10, x: 20)", `argument name: got "y", want "x"`},
+		{"this.bar!(x: 10, z: 20)", `argument name: got "z", want "y"`},
+		{"this.bar!(x: 10)", "has 2 arguments but 1 were given"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\ni : base.u32,\n)\n" +
+			"pri func foo.bar!(x: base.u32, y: base.u32) {\n}\n" +
+			"pri func foo.baz!() {\n" + tc.call + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.call, msg)
+		}
+	}
+}
+
+func TestMethodInAnotherFile(tt *testing.T) {
+	srcs := []struct {
+		filename string
+		src      string
+	}{
+		{"b.wuffs", "pri func foo.bar!() {\nthis.i = this.baz()\n}\n"},
+		{"a.wuffs", "pri struct foo(\ni : base.u32,\n)\npri func foo.baz() base.u32 {\nreturn 1\n}\n"},
+	}
+
+	tm := &t.Map{}
+	files := []*a.File(nil)
+	for _, s := range srcs {
+		tokens, _, err := t.Tokenize(tm, s.filename, []byte(s.src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		file, err := parse.Parse(tm, s.filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("Parse: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	c, err := Check(tm, files, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	if f := c.funcs[t.QQID{0, tm.ByName("foo"), tm.ByName("bar")}]; f == nil {
+		tt.Fatalf("no func foo.bar")
+	} else if got := f.Filename(); got != "b.wuffs" {
+		tt.Fatalf("foo.bar filename: got %q, want %q", got, "b.wuffs")
+	}
+}
+
+func TestIOParameters(tt *testing.T) {
+	testCases := []struct {
+		stmt    string
+		wantErr string
+	}{
+		{"args.dst.write_u8?(a: c)", ""},
+		{"args.src.write_u8?(a: c)", `no built-in function "base.io_reader.write_u8"`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\ni : base.u32,\n)\n" +
+			"pri func foo.copy?(dst: base.io_writer, src: base.io_reader) {\n" +
+			"var c : base.u8\nc = args.src.read_u8?()\n" + tc.stmt + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.stmt, msg)
+		}
+	}
+}
+
+func TestReturnError(tt *testing.T) {
+	testCases := []struct {
+		sig     string
+		wantErr string
+	}{
+		{"pri func foo.bar?()", ""},
+		{"pri func foo.bar!() base.status", ""},
+		{"pri func foo.bar!()", "does not return a status"},
+		{"pri func foo.bar() base.u32", "does not return a status"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri status \"#bad header\"\n" +
+			"pri struct foo(\ni : base.u32,\n)\n" +
+			tc.sig + " {\nreturn error \"bad header\"\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.sig, msg)
+		}
+	}
+}
+
+func TestAssertVia(tt *testing.T) {
+	testCases := []struct {
+		assert  string
+		wantErr string
+	}{
+		{`assert args.x < args.y via "a < b: a < c; c < b"(c: args.z)`, ""},
+		{`assert args.x < args.y via "a < b: a < c; c < b"(c: args.x)`, "cannot prove"},
+		{`assert args.x < args.y via "no such proof"(c: args.z)`, `no such reason "no such proof"`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func f(x: base.u32, y: base.u32, z: base.u32) {\n" +
+			"if (args.x < args.z) and (args.z < args.y) {\n" + tc.assert + "\n}\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.assert, msg)
+		}
+	}
+}
+
+func TestTestFuncAsserts(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		// A test func's asserts are run-time checks, not proofs, and later
+		// code can rely on them.
+		{"test func f() {\nvar x : base.u32\nx = 7\nassert x == 8\nx = x + 1\n}\n", ""},
+		{"test func f() {\nvar x : base.u8[..= 9]\nvar y : base.u8\nassert y < 10\nx = y\n}\n", ""},
+		// Other funcs' asserts still need proofs.
+		{"pri func f() {\nvar x : base.u32\nx = 7\nassert x == 8\n}\n", "cannot prove"},
+		// Test funcs cannot be called.
+		{"test func f() {\n}\npri struct s(\nx : base.u32,\n)\n" +
+			"test func s.g() {\n}\npri func s.h() {\nthis.g()\n}\n", `cannot call test function "s.g"`},
+	}
+
+	for _, tc := range testCases {
+		err := checkSrc(tt, tc.src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.src, msg)
+		}
+	}
+}
+
+func TestMultipleReturnValues(tt *testing.T) {
+	testCases := []struct {
+		sig     string
+		ret     string
+		assign  string
+		wantErr string
+	}{
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1, 2", "p, q = this.bar()", ""},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1, 300", "p, q = this.bar()", "not within bounds"},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1, 2", "p, q = this.bar()\nassert q <= 200", ""},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1, 2", "p, q = this.bar()\nassert q <= 199", "cannot prove"},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "if true {\nreturn 1, 2\n}", "p, q = this.bar()", "does not end with a return"},
+		{"pri func foo.bar() (x: base.u32, y: base.u32)", "return 1, 2", "p, q = this.bar()", "not within bounds"},
+		{"pri func foo.bar() (x: base.u32, y: base.u8)", "return 1, 2", "p, q = this.bar()", "cannot assign"},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1", "p, q = this.bar()", "returns 2 values"},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1, 2, 3", "p, q = this.bar()", "returns 2 values"},
+		{"pri func foo.bar() (x: base.u32, y: base.u32[..= 200])", "return 1, 2", "p, q, p = this.bar()", "but 3 were assigned"},
+		{"pri func foo.bar() base.u32", "return 1", "p, q = this.bar()", "does not return multiple values"},
+		{"pri func foo.bar() base.u32", "return 1, 2", "p = this.bar()", "cannot return multiple values"},
+		{"pub func foo.bar() (x: base.u32, y: base.u32)", "return 1, 2", "p, q = this.bar()", "cannot have multiple return values"},
+		{"pri func foo.bar?() (x: base.u32, y: base.u32)", "return 1, 2", "p, q =? this.bar?()", "multiple assignment"},
+		{"pri func foo.bar() (x: base.u32, y: array[2] base.u32)", "return 1, 2", "p, q = this.bar()", "array type"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\ni : base.u32,\n)\n" +
+			tc.sig + " {\n" + tc.ret + "\n}\n" +
+			"pri func foo.baz() {\nvar p : base.u32\nvar q : base.u32[..= 255]\n" + tc.assign + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q, %q: %s", tc.sig, tc.assign, msg)
+		}
+	}
+}
+
+func TestFuncContracts(tt *testing.T) {
+	testCases := []struct {
+		sig     string
+		body    string
+		caller  string
+		wantErr string
+	}{
+		{"pri func foo.bar(x: base.u32) base.u32,\npre args.x < 10,\n", "return args.x + 1", "p = this.bar(x: 9)", ""},
+		{"pri func foo.bar(x: base.u32) base.u32", "return args.x + 1", "p = this.bar(x: 9)", "not within bounds"},
+		{"pri func foo.bar(x: base.u32) base.u32,\npre args.x < 10,\n", "return args.x + 1", "p = this.bar(x: args.n)", ""},
+		{"pri func foo.bar(x: base.u32) base.u32,\npre args.x < 10,\n", "return args.x + 1", "p = this.bar(x: 10)", `cannot prove foo.bar's precondition "10 < 10"`},
+		{"pri func foo.bar(x: base.u32) base.u32,\npre args.x < 10,\n", "return args.x + 1", "p = this.bar(x: args.n + 1)", `cannot prove foo.bar's precondition "(args.n + 1) < 10"`},
+		{"pri func foo.set!(x: base.u32[..= 100]),\npost this.i <= 100,\n", "this.i = args.x", "this.set!(x: 50)\np = this.i + 1", ""},
+		{"pri func foo.set!(x: base.u32[..= 100])", "this.i = args.x", "this.set!(x: 50)\np = this.i + 1", "not within bounds"},
+		{"pri func foo.set!(x: base.u32[..= 100]),\npost this.i <= 100,\n", "this.i = 200", "this.set!(x: 50)", `cannot prove postcondition "this.i <= 100"`},
+		{"pri func foo.set!(x: base.u32) base.u32,\npost this.i <= 100,\n", "if args.x > 0 {\nreturn 1\n}\nthis.i = 0\nreturn 0", "p = this.set!(x: 50)", `cannot prove postcondition "this.i <= 100"`},
+		{"pri func foo.set!(x: base.u32) base.u32,\npost this.i <= 100,\n", "if args.x > 100 {\nthis.i = 0\nreturn 1\n}\nthis.i = args.x\nreturn 0", "p = this.set!(x: 50)", ""},
+		{"pri func foo.set!(x: base.u32),\npre args.x <= 100,\npost this.i <= 100,\n", "this.i = args.x", "this.set!(x: args.n)\np = this.i + 1", ""},
+		{"pri func foo.set!(x: base.u32),\npost this.i <= 100,\n", "this.i = 0", "this.set!(x: 50)\nthis.i = 300\np = this.i + 1", ""},
+		{"pri func foo.set?(x: base.u32),\npost this.i <= 100,\n", "this.i = 0", "var s : base.status\ns =? this.set?(x: 50)\np = this.i + 1", "not within bounds"},
+		{"pri func foo.set!(x: base.u32),\npre this.j < 10,\n", "this.i = 0", "this.set!(x: 50)", `no field or method named "j"`},
+		{"pri func foo.set!(x: base.u32),\npost args.y < 10,\n", "this.i = 0", "this.set!(x: 50)", `no field or method named "y"`},
+		{"pri func foo.set!(x: base.u32),\ninv args.x < 10,\n", "this.i = 0", "this.set!(x: 50)", "not supported"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\ni : base.u32,\n)\n" +
+			tc.sig + " {\n" + tc.body + "\n}\n" +
+			"pri func foo.baz!(n: base.u32[..= 9]) {\nvar p : base.u32\n" + tc.caller + "\n}\n"
+		if strings.Contains(tc.caller, "=?") {
+			src = strings.Replace(src, "foo.baz!", "foo.baz?", 1)
+		}
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q, %q: %s", tc.sig, tc.caller, msg)
+		}
+	}
+}
+
+func TestFuncContractPostArgsModifiedByCall(tt *testing.T) {
+	testCases := []struct {
+		arg     string
+		wantErr string
+	}{
+		// foo.f modifies this.b, so its post condition's "args.n" is not the
+		// new value of this.b.
+		{"this.b", "cannot prove"},
+		{"this.c", ""},
+		{"n", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\na : base.u32,\nb : base.u32,\nc : base.u32,\narr : array[4] base.u8,\n)\n" +
+			"pri func foo.f!(n: base.u32),\npost this.a >= args.n,\n{\n" +
+			"this.a = args.n\nassert this.a >= args.n via \"a >= b: a == b\"()\nthis.b = 1000\n}\n" +
+			"pri func foo.g!() {\nvar n : base.u32\nvar x : base.u8\n" +
+			"this.f!(n: " + tc.arg + ")\n" +
+			"if this.a < 4 {\n" +
+			"assert " + tc.arg + " <= this.a via \"a <= b: b >= a\"()\n" +
+			"assert " + tc.arg + " < 4 via \"a < b: a <= c; c < b\"(c: this.a)\n" +
+			"x = this.arr[" + tc.arg + "]\n}\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.arg, msg)
+		}
+	}
+}
+
+func TestShiftAndMulBounds(tt *testing.T) {
+	testCases := []struct {
+		dst     string
+		expr    string
+		wantErr string
+	}{
+		{"base.u32[..= 225]", "args.x * args.y", ""},
+		{"base.u32[..= 224]", "args.x * args.y", "not within bounds"},
+		{"base.u32[..= 120]", "args.x << args.n", ""},
+		{"base.u32[..= 119]", "args.x << args.n", "not within bounds"},
+		{"base.u32[..= 15]", "args.x >> args.n", ""},
+		{"base.u32[..= 14]", "args.x >> args.n", "not within bounds"},
+		{"base.u32[1 ..= 15]", "args.x >> args.n", "not within bounds"},
+		{"base.u8[..= 225]", "args.p ~mod* args.q", ""},
+		{"base.u8[..= 120]", "args.p ~mod<< args.n", ""},
+		{"base.u8[..= 30]", "args.p ~mod+ args.q", ""},
+		{"base.u8[1 ..= 255]", "args.b ~mod<< 1", "not within bounds"},
+		{"base.u8[..= 15]", "args.p ~mod- args.q", "not within bounds"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u32[..= 15], y: base.u32[..= 15], n: base.u32[..= 3],\n" +
+			"p: base.u8[..= 15], q: base.u8[..= 15], b: base.u8[128 ..= 255]) {\n" +
+			"var v : " + tc.dst + "\nv = " + tc.expr + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q = %q: %s", tc.dst, tc.expr, msg)
+		}
+	}
+}
+
+func TestModulusBounds(tt *testing.T) {
+	testCases := []struct {
+		dst     string
+		expr    string
+		wantErr string
+	}{
+		// "x % y" is at most y's upper bound minus one.
+		{"base.u32[..= 7]", "args.x % args.y", ""},
+		{"base.u32[..= 6]", "args.x % args.y", "not within bounds"},
+		{"base.u32[..= 100]", "args.x % args.y", ""},
+		{"base.u32[1 ..= 7]", "args.x % args.y", "not within bounds"},
+		// It is also at most x's upper bound.
+		{"base.u32[..= 5]", "args.w % args.y", ""},
+		{"base.u32[..= 4]", "args.w % args.y", "not within bounds"},
+		// Modulus by a possibly zero divisor is still rejected.
+		{"base.u32[..= 100]", "args.x % args.z", `divide/modulus op argument "args.z" is possibly non-positive`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u32[..= 100], y: base.u32[1 ..= 8], z: base.u32[..= 8], w: base.u32[..= 5]) {\n" +
+			"var v : " + tc.dst + "\nv = " + tc.expr + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q = %q: %s", tc.dst, tc.expr, msg)
+		}
+	}
+}
+
+func TestSignedArithmetic(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"a = args.x + args.y", `signed expression "args.x + args.y" bounds [-4294967296 ..= 4294967294] may overflow "base.i32"`},
+		{"a = args.x - args.y", "may overflow"},
+		{"a = args.x * args.y", "may overflow"},
+		{"a = -args.x", "may overflow"},
+		{"a = (args.s as base.i32) * (args.s as base.i32)", ""},
+		{"b = (args.s - 100) * 200", `signed expression "(args.s - 100) * 200" bounds [-40000 ..= 0] may overflow "base.i16"`},
+		{"b = (args.s - 100) / 2", `possibly negative`},
+		{"a = args.x ~mod+ args.y", ""},
+		{"a = args.x ~mod- args.y", ""},
+		{"a = args.x ~mod* args.y", ""},
+		{"a = args.x\na ~mod*= args.y", ""},
+		{"a = args.x ~mod<< 1", "does not have unsigned integer type"},
+		{"a = args.x ~sat+ args.y", "do not have unsigned integer types"},
+		{"a = args.x\na ~sat+= 1", "does not have unsigned integer type"},
+		{"b = args.s ~mod+ 1", ""},
+		{"a = args.s ~mod+ 1", "cannot assign"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.i32, y: base.i32, s: base.i16[-100 ..= 100]) {\n" +
+			"var a : base.i32\nvar b : base.i16\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+}
+
+func TestWitness(tt *testing.T) {
+	testCases := []struct {
+		body        string
+		wantWitness string
+	}{
+		{"a = args.x + args.y", "; for example, args.x = 4294967295, args.y = 4294967295 gives 8589934590"},
+		{"if args.y < 2 {\na = args.x + args.y\n}", "; for example, args.x = 4294967295, args.y = 1 gives 4294967296"},
+		{"a = args.x\na += 1", "; for example, a = 4294967295 gives 4294967296"},
+		{"a = args.x - (args.w as base.u32)", "; for example, args.x = 0, args.w as base.u32 = 65535 gives -65535"},
+		{"b = (args.s - 100) * 200", "; for example, args.s = -100 gives -40000"},
+		// The facts rule out every candidate, each at one end of its
+		// sub-expressions' bounds, so there is no witness.
+		{"if args.x < args.z {\na = (args.z - args.x) - 1\n}", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u32, y: base.u32, z: base.u32, w: base.u16, s: base.i16[-100 ..= 100]) {\n" +
+			"var a : base.u32\nvar b : base.i16\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if err == nil {
+			tt.Errorf("%q: got nil error, want non-nil", tc.body)
+			continue
+		}
+		msg := err.Error()
+		if tc.wantWitness == "" {
+			if strings.Contains(msg, "for example") {
+				tt.Errorf("%q: got error %v, want one without a witness", tc.body, err)
+			}
+		} else if !strings.Contains(msg, tc.wantWitness) {
+			tt.Errorf("%q: got error %v, want one containing %q", tc.body, err, tc.wantWitness)
+		}
+	}
+}
+
+func TestFactPropagation(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"if x < 10 {\n} else {\nassert x >= 10\n}", ""},
+		{"if x < 10 {\n} else if x < 20 {\nassert x >= 10\n} else {\nassert x >= 20\n}", ""},
+		{"if x < 10 {\nassert x >= 10\n}", "cannot prove"},
+		{"while x < 10 {\nx += 1\n}\nassert x >= 10", ""},
+		{"x = 0\nwhile x < 10,\ninv x <= 10,\n{\nx += 1\n}\nassert x == 10", ""},
+		{"while x < 10 {\nif x == 5 {\nbreak\n}\nx += 1\n}\nassert x >= 10", "cannot prove"},
+		{"while.outer x < 10 {\nwhile true {\nbreak.outer\n}\n}.outer\nassert x >= 10", "cannot prove"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(n: base.u32[..= 100]) {\nvar x : base.u32[..= 100]\nx = args.n\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+}
+
+func TestModularFacts(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"v = args.t[args.x & 0xFF]", ""},
+		{"v = args.t[args.x % 256]", ""},
+		{"v = args.t[args.x % 257]", "cannot prove"},
+		{"assert (args.x & 0xFF) < 256", ""},
+		{"assert (args.x % args.n) < args.n", ""},
+		{"assert args.n > (args.x % args.n)", ""},
+		{"assert (args.x % args.n) <> args.n", ""},
+		{"assert (args.x % args.n) <= args.n", ""},
+		{"if args.n <= args.x {\nassert (args.x % args.n) < args.x\n}", ""},
+		{"assert (args.x % args.n) < args.x", "cannot prove"},
+		{"if args.s.length() > 0 {\nv = args.s[args.x % args.s.length()]\n}", ""},
+		{"if args.s.length() > 0 {\nv = args.s[(args.x % args.s.length()) + 1]\n}", "cannot prove"},
+		{"if args.n <= args.s.length() {\nv = args.s[args.x % args.n]\n}", ""},
+		{"v = args.s[args.x % args.s.length()]", "possibly non-positive"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u64, n: base.u64[1 ..= 256], s: slice base.u8, t: array[256] base.u8) {\n" +
+			"var v : base.u8\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+}
+
+func TestBitwiseFacts(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"assert (args.x & args.m) <= args.m", ""},
+		{"assert (args.x & args.m) <= args.x", ""},
+		{"assert args.m >= (args.x & args.m)", ""},
+		{"assert (args.x & args.m) < args.m", "cannot prove"},
+		{"assert (args.x | args.m) >= args.m", ""},
+		{"assert args.x <= (args.x | args.m)", ""},
+		{"assert (args.x | args.m) <= args.m", "cannot prove"},
+		{"if args.m < 10 {\nassert (args.x & args.m) < 10\n}", ""},
+		{"if args.m < 10 {\nassert (args.x & args.y & args.m) <> 10\n}", ""},
+		{"if args.m > 10 {\nassert 10 < (args.y | args.m | args.x)\n}", ""},
+		{"if args.m > 10 {\nassert 10 < (args.x & args.m)\n}", "cannot prove"},
+		{"v = args.t[args.x & args.n]", ""},
+		{"if args.m < args.s.length() {\nv = args.s[args.x & args.m]\n}", ""},
+		{"v = args.s[args.x & args.m]", "cannot prove"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u64, y: base.u64, m: base.u64, n: base.u64[..= 255], " +
+			"s: slice base.u8, t: array[256] base.u8) {\n" +
+			"var v : base.u8\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+}
+
+func TestLoopInvariants(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		// The invariant holds on entry, is preserved by the body and is
+		// available after the loop.
+		{"x = 0\nwhile x < 10,\ninv x <= 10,\n{\nx += 1\n}\nassert x <= 10", ""},
+		// The invariant does not hold on entry.
+		{"x = 20\nwhile x < 10,\ninv x <= 10,\n{\nx += 1\n}", "cannot prove \"x <= 10\""},
+		// The body does not preserve the invariant.
+		{"x = 0\nwhile x < 10,\ninv x <= 10,\n{\nx += 2\n}", "cannot prove \"x <= 10\""},
+		// An explicit continue does not preserve the invariant.
+		{"x = 0\nwhile x < 10,\ninv x <= 10,\n{\nx = 50\ncontinue\n}", "cannot prove \"x <= 10\""},
+		// Post conditions are proven from the invariant and the inverted
+		// while condition.
+		{"x = 0\nwhile x < 10,\ninv x <= 10,\npost x == 10,\n{\nx += 1\n}\nassert x == 10", ""},
+		{"x = 0\nwhile x < 10,\npost x == 10,\n{\nx += 1\n}", "cannot prove \"x == 10\""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo() {\nvar x : base.u32[..= 100]\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+}
+
+func TestRefinementTypes(tt *testing.T) {
+	testCases := []struct {
+		typ     string
+		body    string
+		wantErr string
+	}{
+		{"base.u32[..= 0xFF]", "x = 0xFF", ""},
+		{"base.u32[..= 0xFF]", "x = 0x100", "not within bounds"},
+		{"base.u32[..= 0xFF]", "x = args.n", "not within bounds"},
+		{"base.u32[..= 0xFF]", "x = args.n & 0xFF", ""},
+		{"base.u32[..= 0xFF]", "x = args.n & 0xFF\nx += 1", "not within bounds"},
+		{"base.u32[..= 0xFF]", "x = args.n & 0x7F\nx += 1", ""},
+		{"base.u32[..= 0xFF]", "if args.n < 0x100 {\nx = args.n\n}", ""},
+		{"base.u8[..= 300]", "", "out of bounds"},
+		{"base.u32[10 ..= 5]", "", "type refinement for \"base.u32[10 ..= 5]\" is empty"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(n: base.u32) {\nvar x : " + tc.typ + "\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q, %q: %s", tc.typ, tc.body, msg)
+		}
+	}
+}
+
+func TestDefiniteAssignment(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"x = 1\ny = x", ""},
+		{"y = x", `variable "x" is read before it is definitely assigned`},
+		{"x += 1", `variable "x" is read before it is definitely assigned`},
+		{"x = x + 1", `variable "x" is read before it is definitely assigned`},
+		{"if args.n > 0 {\nx = 1\n} else {\nx = 2\n}\ny = x", ""},
+		{"if args.n > 0 {\nx = 1\n}\ny = x", `variable "x"`},
+		{"if args.n > 0 {\nx = 1\n} else if args.n > 1 {\nx = 2\n}\ny = x", `variable "x"`},
+		{"if args.n > 0 {\nx = 1\n} else {\nreturn nothing\n}\ny = x", ""},
+		{"switch args.n & 1 {\ncase 0 {\nx = 1\n}\ncase 1 {\nx = 2\n}\n}\ny = x", ""},
+		{"switch args.n & 1 {\ncase 0 {\nx = 1\n}\ncase 1 {\n}\n}\ny = x", `variable "x"`},
+		{"while args.n > 0 {\nx = 1\n}\ny = x", `variable "x"`},
+		{"while true {\nx = 1\nbreak\n}\ny = x", ""},
+		{"while true {\nif args.n > 0 {\nbreak\n}\nx = 1\n}\ny = x", `variable "x"`},
+		{"while.a true {\nwhile true {\nx = 1\nbreak.a\n}\n}.a\ny = x", ""},
+		{"x = 1\nwhile x < 10 {\nx += 1\n}", ""},
+		{"b = args.n > 0\nif b {\n}", ""},
+		{"if b {\n}", `variable "b"`},
+		{"assert x == 0\nx = 1", ""},
+		{"a[0] = 1\nx = a[0] as base.u32", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(n: base.u32) {\n" +
+			"var x : base.u32\nvar y : base.u32\nvar b : base.bool\nvar a : array[4] base.u8\n" +
+			tc.body + "\n}\n"
+
+		for _, require := range []bool{false, true} {
+			wantErr := tc.wantErr
+			if !require {
+				wantErr = ""
+			}
+			err := checkSrc(tt, src, &Options{RequireDefiniteAssignment: require})
+			if msg := errMismatch(err, wantErr); msg != "" {
+				tt.Errorf("%q (require=%t): %s", tc.body, require, msg)
+			}
+		}
+	}
+}
+
+func TestFuncEffects(tt *testing.T) {
+	src := "pri struct foo(\ni : base.u32,\n)\n" +
+		"pri func foo.get() base.u32 {\nreturn this.i\n}\n" +
+		"pri func foo.set!() {\nthis.i = 1\n}\n" +
+		"pri func foo.fill!(s: slice base.u8) {\nvar s : slice base.u8\ns = args.s\n" +
+		"if s.length() > 0 {\ns[0] = 1\n}\n}\n" +
+		"pri func foo.lazy!() base.u32 {\nreturn this.i\n}\n" +
+		"pri func foo.read?(src: base.io_reader) {\nvar x : base.u8\n" +
+		"x = args.src.read_u8?()\nthis.i = x as base.u32\n}\n" +
+		"pri func foo.call?(src: base.io_reader) {\nthis.read?(src: args.src)\n}\n" +
+		"pri func foo.write!(dst: base.io_writer) {\nif args.dst.length() > 0 {\n" +
+		"args.dst.write_u8_fast!(a: 1)\n}\n}\n"
+
+	tm := &t.Map{}
+	file := parseSrc(tt, tm, src)
+	files := []*a.File{file}
+	c, err := Check(tm, files, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"get", "none"},
+		{"set", "writes_this"},
+		{"fill", "writes_args"},
+		{"lazy", "none"},
+		{"read", "writes_this|reads_io|suspends"},
+		{"call", "writes_this|reads_io|suspends"},
+		{"write", "reads_io|writes_io"},
+	}
+	for _, tc := range testCases {
+		qqid := t.QQID{0, tm.ByName("foo"), tm.ByName(tc.name)}
+		e, err := c.FuncEffects(qqid)
+		if err != nil {
+			tt.Errorf("%s: FuncEffects: %v", tc.name, err)
+			continue
+		}
+		if got := e.String(); got != tc.want {
+			tt.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	warnings, err := c.Lint(files)
+	if err != nil {
+		tt.Fatalf("Lint: %v", err)
+	}
+	got := []string(nil)
+	for _, w := range warnings {
+		got = append(got, w.Error())
+	}
+	want := []string{
+		`check: func foo.lazy is impure (has a "!" effect) but could be pure at test.wuffs:17:1`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Errorf("Lint:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestResetFields(tt *testing.T) {
+	const assignAll = "this.gc_a = 0\nthis.gc_b = false\nthis.gc_x = 0"
+	testCases := []struct {
+		funcs   string
+		wantErr string
+	}{
+		{"pri func foo.reset_gc!() {\n" + assignAll + "\n}", ""},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.gc_x = 0\n}",
+			`reset func foo.reset_gc does not assign field "gc_b" on every path`},
+		{"pri func foo.reset_gc!() {\n" + assignAll + "\nthis.gc_a ~mod+= 1\n}", ""},
+		{"pri func foo.reset_gc!() {\nthis.gc_a ~mod+= 1\nthis.gc_b = false\nthis.gc_x = 0\n}",
+			`field "gc_a"`},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.gc_x = 0\n" +
+			"if this.n > 0 {\nthis.gc_b = true\n}\n}", `field "gc_b"`},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.gc_x = 0\n" +
+			"if this.n > 0 {\nthis.gc_b = true\n} else {\nthis.gc_b = false\n}\n}", ""},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.gc_x = 0\n" +
+			"while true {\nthis.gc_b = false\nbreak\n}\n}", ""},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.gc_x = 0\n" +
+			"while this.n < 10 {\nthis.gc_b = false\nthis.n += 1\n}\n}", `field "gc_b"`},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.set_gc_bx!()\n}\n" +
+			"pri func foo.set_gc_bx!() {\nthis.gc_b = false\nthis.gc_x = 0\n}", ""},
+		{"pri func foo.reset_gc!() {\nthis.gc_a = 0\nthis.set_gc_bx!()\n}\n" +
+			"pri func foo.set_gc_bx!() {\nthis.gc_b = false\nif this.n > 0 {\nthis.gc_x = 0\n}\n}", `field "gc_x"`},
+		{"pri func foo.reset_n!() {\nthis.n = 0\n}", ""},
+		{"pri func foo.restart!() {\nthis.n = 0\n}", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\nn : base.u32,\ngc_a : base.u32,\ngc_b : base.bool,\ngc_x : base.u8,\n" +
+			"gc_arr : array[4] base.u8,\n)\n" + tc.funcs + "\n"
+
+		for _, require := range []bool{false, true} {
+			tm := &t.Map{}
+			files := []*a.File{parseSrc(tt, tm, src)}
+			c, err := CheckWithOptions(tm, files, nil, &Options{RequireResetFields: require})
+			if !require {
+				if err != nil {
+					tt.Fatalf("%q: Check: %v", tc.funcs, err)
+				}
+				warnings, lintErr := c.Lint(files)
+				if lintErr != nil {
+					tt.Fatalf("%q: Lint: %v", tc.funcs, lintErr)
+				}
+				for _, w := range warnings {
+					if strings.Contains(w.Error(), "reset func") {
+						err = w
+					}
+				}
+			}
+			if msg := errMismatch(err, tc.wantErr); msg != "" {
+				tt.Errorf("%q (require=%t): %s", tc.funcs, require, msg)
+			}
+		}
+	}
+}
+
+func TestFuncStatuses(tt *testing.T) {
+	const mayFail = "pri func foo.may_fail!() base.status {\nif this.n > 0 {\nreturn \"#bad\"\n}\nreturn ok\n}\n"
+	testCases := []struct {
+		funcs   string
+		wantErr string
+	}{
+		{"pri func foo.f?() {\nyield? base.\"$short read\"\n}", ""},
+		{"pri func foo.f?() {\nyield? \"#bad\"\n}",
+			`cannot yield "\"#bad\"", whose status kinds (error) exclude suspension`},
+		{mayFail + "pri func foo.f?() {\nvar s : base.status\ns = this.may_fail!()\nyield? s\n}",
+			`cannot yield "s", whose status kinds (ok|error) exclude suspension`},
+		{"pri func foo.g?() {\n}\n" +
+			"pri func foo.f?() {\nvar s : base.status\ns =? this.g?()\nyield? s\n}", ""},
+		{"pri func foo.f?() {\nreturn base.\"$short read\"\n}",
+			`cannot return "base.\"$short read\"", which is always a suspension`},
+		{"pri func foo.f!() base.status {\nreturn base.\"$short read\"\n}",
+			`which can be a suspension, from non-coroutine func foo.f`},
+		{"pri func foo.f!() base.status {\nvar s : base.status\nif this.n > 0 {\ns = base.\"$short read\"\n}\nreturn s\n}",
+			`cannot return "s", which can be a suspension`},
+		{mayFail + "pri func foo.f!() base.status {\nvar s : base.status\ns = this.may_fail!()\nreturn s\n}", ""},
+		{mayFail + "pri func foo.f!() {\nthis.may_fail!()\n}",
+			`status from foo.may_fail, which can be an error, is discarded`},
+		{"pri func foo.never_fails!() base.status {\nthis.n = 0\nreturn ok\n}\n" +
+			"pri func foo.f!() {\nthis.never_fails!()\n}", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri status \"#bad\"\npri struct foo(\nn : base.u32,\n)\n" + tc.funcs + "\n"
+
+		tm := &t.Map{}
+		files := []*a.File{parseSrc(tt, tm, src)}
+		c, err := Check(tm, files, nil)
+		if err == nil {
+			warnings, lintErr := c.Lint(files)
+			if lintErr != nil {
+				tt.Fatalf("%q: Lint: %v", tc.funcs, lintErr)
+			}
+			for _, w := range warnings {
+				if strings.Contains(w.Error(), "status") {
+					err = w
+				}
+			}
+		}
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.funcs, msg)
+		}
+	}
+}
+
+func TestConversions(tt *testing.T) {
+	testCases := []struct {
+		arg     string
+		value   string
+		wantErr string
+	}{
+		{"base.u32[..= 255]", "args.x as base.u8", ""},
+		{"base.u32", "args.x as base.u8", `cannot convert "args.x", with bounds [0 ..= 4294967295], ` +
+			`as type "base.u8", with bounds [0 ..= 255], without truncating ` +
+			`(use "args.x as base.u8 via truncate" if that is intended) at`},
+		{"base.u32[..= 200]", "(args.x + 100) as base.u8",
+			`cannot convert "args.x + 100", with bounds [100 ..= 300], as type "base.u8", with bounds [0 ..= 255], ` +
+				`without truncating (use "(args.x + 100) as base.u8 via truncate" if that is intended); ` +
+				`for example, args.x = 200 gives 300 at`},
+		{"base.u32", "args.x as base.u8 via truncate", ""},
+		{"base.u32[..= 200]", "(args.x + 100) as base.u8 via truncate", ""},
+		{"base.i32", "args.x as base.u8 via truncate", ""},
+		{"base.u32", "args.x as base.i8", `cannot convert "args.x"`},
+		{"base.u32", "args.x as base.i8 via truncate", ""},
+		{"base.u32", "args.x as base.u64", ""},
+		{"base.u32", "300 as base.u8 via truncate", ""},
+		{"slice base.u8", "args.x as ptr array[4] base.u8 via truncate",
+			`cannot truncate expression "args.x", of type "roslice base.u8", as type "ptr array[4] base.u8"`},
+	}
+
+	for _, tc := range testCases {
+		ret := "base.u8"
+		if strings.Contains(tc.value, "base.i8") {
+			ret = "base.i8"
+		} else if strings.Contains(tc.value, "base.u64") {
+			ret = "base.u64"
+		} else if strings.Contains(tc.value, "ptr") {
+			ret = "ptr array[4] base.u8"
+		}
+		src := "pri func foo(x: " + tc.arg + ") " + ret + " {\nreturn " + tc.value + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.value, msg)
+		}
+	}
+}
+
+func TestIdealConstants(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"y = args.x + 1", ""},
+		{"y = 1 + args.x", ""},
+		{"y = args.x + 300", "not within bounds"},
+		{"z = 1 << args.x", ""},
+		{"z = (1 << args.x) - 1", ""},
+		{"y = (1 << args.x) - 1", ""},
+		{"y = (1 << args.n) - 1", `shift op argument "args.n" is outside the range [0 ..= 7]`},
+		{"z |= (3 << args.x) & 0xFF", ""},
+		{"z = 0x1_0000_0000 << args.x", `"0x1_0000_0000", with value 4294967296, does not fit in type "base.u32"`},
+		{"b = (1 << args.x) > 3", `cannot shift an ideal number by a non-ideal number; ` +
+			`give it a type explicitly, as in "(1 as base.u32) << args.x"`},
+		{"z = args.n + args.x", `do not have compatible types; convert explicitly, as in "args.x as base.u32"`},
+		{"z = args.n + (args.x + 1)", `convert explicitly, as in "(args.x + 1) as base.u32"`},
+		{"z = args.x", `cannot assign "args.x" of type "base.u8[..= 7]" to "z" of type "base.u32"; ` +
+			`convert explicitly, as in "args.x as base.u32"`},
+		{"z = (args.x as base.u32) + args.n", ""},
+		{"if args.n > 0 {\nreturn (1 << args.x) | 1\n}", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u8[..= 7], n: base.u32[..= 100]) base.u32 {\n" +
+			"var y : base.u8\nvar z : base.u32\nvar b : base.bool\n" + tc.body + "\nreturn 0\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+}
+
+func TestFrames(tt *testing.T) {
+	const before = "this.a = 1\nthis.b = 2\n"
+	testCases := []struct {
+		funcs   string
+		wantErr string
+	}{
+		// set_a's frame is this.a, so facts about this.b survive the call.
+		{"pri func foo.f!() {\n" + before + "this.set_a!()\nassert this.b == 2\n}", ""},
+		{"pri func foo.f!() {\n" + before + "this.set_a!()\nassert this.a == 1\n}",
+			`cannot prove "this.a == 1"`},
+		// Frames are transitive.
+		{"pri func foo.f!() {\n" + before + "this.set_ab!()\nassert this.b == 2\n}",
+			`cannot prove "this.b == 2"`},
+		// Writing through a local slice could modify any field.
+		{"pri func foo.f!() {\n" + before + "this.set_via_slice!()\nassert this.b == 2\n}",
+			`cannot prove "this.b == 2"`},
+		// Writing through a slice of this.buf only modifies this.buf.
+		{"pri func foo.f!() {\n" + before + "this.set_buf!()\nassert this.b == 2\n}", ""},
+		// Passing a slice of this.buf lets the callee modify it.
+		{"pri func foo.f!() {\nthis.buf[0] = 3\nthis.fill!(s: this.buf[..])\nassert this.buf[0] == 3\n}",
+			`cannot prove "this.buf[0] == 3"`},
+		{"pri func foo.f!() {\nthis.buf[0] = 3\nthis.set_a!()\nassert this.buf[0] == 3\n}", ""},
+		// A pure method's result can depend on any field.
+		{"pri func foo.f!() {\nif this.get_b() == 0 {\nassert this.get_b() == 0\n}\n}", ""},
+		{"pri func foo.f!() {\nif this.get_b() == 0 {\nthis.set_a!()\nassert this.get_b() == 0\n}\n}",
+			`cannot prove "this.get_b() == 0"`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\na : base.u32,\nb : base.u32,\nbuf : array[4] base.u8,\n)\n" +
+			"pri func foo.set_a!() {\nthis.a = 5\n}\n" +
+			"pri func foo.set_ab!() {\nthis.set_a!()\nthis.b = 5\n}\n" +
+			"pri func foo.set_via_slice!() {\nvar s : slice base.u8\ns = this.buf[..]\nif s.length() > 0 {\ns[0] = 5\n}\n}\n" +
+			"pri func foo.set_buf!() {\nthis.buf[..].bulk_memset!(byte_value: 0)\n}\n" +
+			"pri func foo.fill!(s: slice base.u8) {\nif args.s.length() > 0 {\nargs.s[0] = 4\n}\n}\n" +
+			"pri func foo.get_b() base.u32 {\nreturn this.b\n}\n" +
+			tc.funcs + "\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.funcs, msg)
+		}
+	}
+}
+
+func TestExplain(tt *testing.T) {
+	const filename = "test.wuffs"
+	src := strings.TrimSpace(`
+pri func foo(x: base.u32[..= 10]) base.u32 {
+	var y : base.u32
+	y = args.x + 1
+	if y < 5 {
+		return y
+	}
+	return 0
+}
+`) + "\n"
+
+	testCases := []struct {
+		filename string
+		line     uint32
+		want     []string
+	}{
+		{"", 3, []string{"3: y = args.x + 1: [y == 0]"}},
+		{"", 5, []string{"5: return y: [y == (args.x + 1) y >= 1 y <= 11 y < 5]"}},
+		{filename, 7, []string{"7: return 0: [y == (args.x + 1) y >= 1 y <= 11 y >= 5]"}},
+		{"other.wuffs", 7, nil},
+		{"", 8, nil},
+	}
+
+	for _, tc := range testCases {
+		got := []string(nil)
+		opts := &Options{
+			Explain: func(filename string, line uint32, stmt string, facts []string) {
+				got = append(got, fmt.Sprintf("%d: %s: %v", line, stmt, facts))
+			},
+			ExplainFilename: tc.filename,
+			ExplainLine:     tc.line,
+		}
+		if err := checkSrc(tt, src, opts); err != nil {
+			tt.Fatalf("Check: %v", err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			tt.Errorf("%s:%d: got %q, want %q", tc.filename, tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestDroppedFacts(tt *testing.T) {
+	testCases := []struct {
+		body string
+		want []string
+	}{
+		// The if and else conditions are only assumed in their own branch.
+		{"if args.x < 5 {\ny = 1\n} else {\ny = 1\n}", nil},
+		{"if args.x < 5 {\ny = 1\n} else {\ny = 2\n}",
+			[]string{"3 if/else: y == 1", "3 if/else: y == 2"}},
+		{"if args.x < 5 {\ny = 1\nassert y <= 7\n} else if args.x < 9 {\ny = 2\nassert y <= 7\n}",
+			[]string{"3 if/else: y == 1", "3 if/else: y <= 7", "3 if/else: y == 2", "3 if/else: y == 0"}},
+		// A terminating branch does not join.
+		{"if args.x < 5 {\nreturn nothing\n} else {\ny = 2\n}", nil},
+		{"switch args.x & 1 {\ncase 0 {\ny = 1\n}\ncase 1 {\ny = 1\nassert y < 2\n}\n}",
+			[]string{"3 switch: y < 2"}},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u32) {\nvar y : base.u32\n" + tc.body + "\n}\n"
+
+		got := []string(nil)
+		opts := &Options{
+			DroppedFact: func(filename string, line uint32, fact string, construct string) {
+				got = append(got, fmt.Sprintf("%d %s: %s", line, construct, fact))
+			},
+		}
+		if err := checkSrc(tt, src, opts); err != nil {
+			tt.Fatalf("%q: Check: %v", tc.body, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			tt.Errorf("%q: got %q, want %q", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestConstantTime(tt *testing.T) {
+	const decls = "pri struct foo(\n" +
+		"secret key : array[16] base.u8,\n" +
+		"tab : array[256] base.u8,\n" +
+		"n : base.u32,\n" +
+		"secret : base.u32,\n" +
+		")\n" +
+		"pri func foo.key_byte() base.u8 {\nreturn this.key[0]\n}\n" +
+		"pri func foo.public(x: base.u8) base.u8 {\nreturn args.x\n}\n" +
+		"pri func foo.private(secret x: base.u8) base.u8 {\nreturn args.x\n}\n"
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"var x : base.u8\nx = this.key[args.i & 15] ^ args.s", ""},
+		{"var x : base.u8\nx = this.tab[args.i]\nif x > 0 {\nreturn nothing\n}", ""},
+		{"var x : base.u32\nx = this.secret\nif x > 0 {\nreturn nothing\n}", ""},
+		{"if args.s > 0 {\nreturn nothing\n}", "cannot if \"args.s > 0\""},
+		{"var x : base.u8\nx = args.s >> 1\nwhile x > 0 {\nx -= 1\n}", "cannot while \"x > 0\""},
+		{"switch args.s & 1 {\ncase 0 {\n}\ncase 1 {\n}\n}", "cannot switch on \"args.s & 1\""},
+		{"var x : base.u8\nx = this.tab[args.s]", "cannot index \"this.tab\" with \"args.s\""},
+		{"var x : base.u8\nx = this.key_byte()\nx = this.tab[x]", "cannot index \"this.tab\" with \"x\""},
+		{"var b : base.bool\nb = (args.s > 0) and (args.i > 0)", "cannot short-circuit on \"args.s > 0\""},
+		{"var b : base.bool\nb = (args.i > 0) and (args.s > 0)", ""},
+		{"this.n = args.s as base.u32", "cannot assign \"args.s as base.u32\""},
+		{"this.key[0] = args.s", ""},
+		{"var x : base.u8\nx = this.public(x: args.s)", "as foo.public's non-secret argument \"x\""},
+		{"var x : base.u8\nx = this.private(x: args.s)\nx = this.tab[x]", "cannot index"},
+		{"var x : base.u8\nx = args.s.min(no_more_than: 3)", ""},
+		{"var x : base.u8\nx = args.s.high_bits(n: 2)", ""},
+		{"var x : base.u8\nx = args.s / 3", "cannot divide with \"args.s\""},
+		{"var x : base.u8\nx = args.i % (args.s | 1)", "cannot divide with \"args.s | 1\""},
+		{"var x : base.u8\nx = args.s\nx %= 7", "cannot divide with \"x\""},
+		{"var x : base.u8\nx = args.i / 3", ""},
+		{"var v : slice base.u8\nv = this.tab[..].suffix(up_to: args.s as base.u64)", "is not known to be constant-time"},
+		{"var v : slice base.u8\nv = this.tab[..].suffix(up_to: args.i as base.u64)", ""},
+		{"var x : base.u64\nx = this.key[..].length()\nif x > 0 {\nreturn nothing\n}", ""},
+	}
+
+	for _, tc := range testCases {
+		src := decls + "pri func foo.bar!(i: base.u8, secret s: base.u8) {\n" + tc.body + "\n}\n"
+
+		for _, constantTime := range []bool{false, true} {
+			wantErr := tc.wantErr
+			if !constantTime {
+				wantErr = ""
+			}
+			err := checkSrc(tt, src, &Options{ConstantTime: constantTime})
+			if msg := errMismatch(err, wantErr); msg != "" {
+				tt.Errorf("%q (constantTime=%t): %s", tc.body, constantTime, msg)
+			}
+		}
+	}
+}
+
+type mapCache struct {
+	m    map[string][]byte
+	hits int
+	puts int
+}
+
+func (c *mapCache) Get(key string) ([]byte, bool) {
+	value, ok := c.m[key]
+	if ok {
+		c.hits++
+	}
+	return value, ok
+}
+
+func (c *mapCache) Put(key string, value []byte) {
+	c.m[key] = value
+	c.puts++
+}
+
+func TestCache(tt *testing.T) {
+	const callee = "pri func foo.callee!(x : base.u32[..= 10]) base.u32[..= %d] {\nreturn args.x + %d\n}\n"
+	const caller = "pri func foo.caller!() base.status {\nvar y : base.u32\ny = this.callee!(x: 3)\n" +
+		"if y > 0 {\nreturn \"#bad\"\n}\nreturn ok\n}\n"
+	testCases := []struct {
+		desc     string
+		src      string
+		wantHits int
+		wantPuts int
+	}{
+		{"first run", fmt.Sprintf(callee, 20, 1) + caller, 0, 2},
+		{"unchanged", fmt.Sprintf(callee, 20, 1) + caller, 2, 0},
+		{"callee body changed", fmt.Sprintf(callee, 20, 2) + caller, 1, 1},
+		{"callee signature changed", fmt.Sprintf(callee, 30, 2) + caller, 0, 2},
+		{"proof fails", fmt.Sprintf(callee, 10, 20) + caller, 0, 0},
+	}
+
+	cache := &mapCache{m: map[string][]byte{}}
+	for _, tc := range testCases {
+		src := "pri status \"#bad\"\npri struct foo(\nn : base.u32,\n)\n" + tc.src
+		tm := &t.Map{}
+		file := parseSrc(tt, tm, src)
+		cache.hits, cache.puts = 0, 0
+		_, err := CheckWithOptions(tm, []*a.File{file}, nil, &Options{Cache: cache})
+		if gotErr, wantErr := err != nil, tc.wantPuts+tc.wantHits == 0; gotErr != wantErr {
+			tt.Fatalf("%s: got error %v, want error %t", tc.desc, err, wantErr)
+		}
+		if (cache.hits != tc.wantHits) || (cache.puts != tc.wantPuts) {
+			tt.Errorf("%s: got %d hits and %d puts, want %d and %d",
+				tc.desc, cache.hits, cache.puts, tc.wantHits, tc.wantPuts)
+		}
+		if err != nil {
+			continue
+		}
+
+		// Whether or not it came from the cache, the caller's first return
+		// statement returns an error.
+		callerFunc := file.TopLevelDecls()[3].AsFunc()
+		rets := []*a.Ret(nil)
+		for _, o := range bodyNodes(callerFunc.Body()) {
+			if o.Kind() == a.KRet {
+				rets = append(rets, o.AsRet())
+			}
+		}
+		if (len(rets) != 2) || !rets[0].RetsError() || rets[1].RetsError() {
+			tt.Errorf("%s: caller's returns do not have the RetsError flags as expected", tc.desc)
+		}
+	}
+}
+
+// TestCacheCalleeChanges tests that a cached result is not re-used after a
+// change to a callee that the caller's proof depends on, even if the callee's
+// In, Out and asserts are unchanged.
+func TestCacheCalleeChanges(tt *testing.T) {
+	testCases := []struct {
+		desc    string
+		before  string
+		after   string
+		caller  string
+		wantErr string
+	}{{
+		// The fact "this.b < 10" survives the "this.f!()" call only if f's
+		// frame, which depends on its body, does not include this.b.
+		desc:    "callee frame",
+		before:  "pri func foo.f!() {\nthis.a = 1000\n}\n",
+		after:   "pri func foo.f!() {\nthis.b = 1000\n}\n",
+		caller:  "pri func foo.g!() {\nif this.b < 10 {\nthis.f!()\nthis.arr[this.b] = 0\n}\n}\n",
+		wantErr: "cannot prove",
+	}, {
+		desc:    "callee outs",
+		before:  "pri func foo.f!() (x: base.u32, y: base.u32[..= 200]) {\nreturn 1, 2\n}\n",
+		after:   "pri func foo.f!() (x: base.u32, y: base.u32[..= 300]) {\nreturn 1, 2\n}\n",
+		caller:  "pri func foo.g!() {\nvar p : base.u32\nvar q : base.u32[..= 255]\np, q = this.f!()\n}\n",
+		wantErr: "not within bounds",
+	}}
+
+	for _, tc := range testCases {
+		cache := &mapCache{m: map[string][]byte{}}
+		for i, callee := range [2]string{tc.before, tc.after} {
+			src := "pri struct foo(\na : base.u32,\nb : base.u32,\narr : array[10] base.u8,\n)\n" +
+				callee + tc.caller
+			err := checkSrc(tt, src, &Options{Cache: cache})
+			if i == 0 {
+				if err != nil {
+					tt.Fatalf("%s: before: got error %v, want nil", tc.desc, err)
+				}
+			} else if msg := errMismatch(err, tc.wantErr); msg != "" {
+				tt.Errorf("%s: after: %s", tc.desc, msg)
+			}
+		}
+	}
+}
+
+func TestLint(tt *testing.T) {
+	testCases := []struct {
+		body string
+		want []string
+	}{
+		{"x = args.n\nreturn x", nil},
+		{"x = args.n\nreturn 0", []string{
+			`check: variable "x" is never read at test.wuffs:2:1`,
+		}},
+		{"x = args.n / 2\nx += 1\nreturn 0", []string{
+			`check: variable "x" is never read at test.wuffs:2:1`,
+		}},
+		{"if args.n < 10 {\nassert args.n < 10\nreturn args.n\n}\nreturn x", []string{
+			`check: assert "args.n < 10" is not needed at test.wuffs:4:1`,
+		}},
+		{"x = args.n / 2\nassert x < 100 via \"a < b: a < c; c <= b\"(c: 51)\nreturn x", []string{
+			`check: assert "x < 100" is not needed at test.wuffs:4:1`,
+		}},
+		{"x = args.n / 10\nif args.n < x {\nassert args.n < 11 via \"a < b: a < c; c < b\"(c: x)\n" +
+			"return args.n * args.n\n}\nreturn 0", nil},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(n: base.u32[..= 100]) base.u32[..= 100] {\nvar x : base.u32[..= 100]\n" +
+			tc.body + "\n}\n"
+
+		tm := &t.Map{}
+		file := parseSrc(tt, tm, src)
+		files := []*a.File{file}
+		c, err := Check(tm, files, nil)
+		if err != nil {
+			tt.Fatalf("%q: Check: %v", tc.body, err)
+		}
+		warnings, err := c.Lint(files)
+		if err != nil {
+			tt.Fatalf("%q: Lint: %v", tc.body, err)
+		}
+		got := []string(nil)
+		for _, w := range warnings {
+			got = append(got, w.Error())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			tt.Errorf("%q:\ngot  %q\nwant %q", tc.body, got, tc.want)
+		}
+
+		// Linting should leave the funcs as they were checked.
+		if err := allTypeChecked(tm, file.AsNode()); err != nil {
+			tt.Errorf("%q: allTypeChecked: %v", tc.body, err)
+		}
+	}
+}
+
+type fakeProver struct {
+	answer  bool
+	scripts []string
+}
+
+func (p *fakeProver) Prove(script string) (bool, error) {
+	p.scripts = append(p.scripts, script)
+	return p.answer, nil
+}
+
+func TestExternalProverTimeout(tt *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		tt.Skipf("no sleep command: %v", err)
+	}
+	p, err := NewExternalProver("sleep 60", 50*time.Millisecond)
+	if err != nil {
+		tt.Fatalf("NewExternalProver: %v", err)
+	}
+	start := time.Now()
+	proved, err := p.Prove("(check-sat)\n")
+	if err != nil {
+		tt.Fatalf("Prove: %v", err)
+	} else if proved {
+		tt.Fatalf("Prove: got proved, want not proved")
+	} else if elapsed := time.Since(start); elapsed > 30*time.Second {
+		tt.Fatalf("Prove: took %v, want it killed after its timeout", elapsed)
+	}
+}
+
+func TestProver(tt *testing.T) {
+	src := "pri func foo(x: base.u32[..= 100], y: base.u32[..= 100]) {\n" +
+		"if args.x <= args.y {\nassert (args.x * args.x) <= (args.x * args.y)\n}\n}\n"
+
+	testCases := []struct {
+		prover  *fakeProver
+		wantErr string
+	}{
+		{nil, "cannot prove"},
+		{&fakeProver{answer: false}, "cannot prove"},
+		{&fakeProver{answer: true}, ""},
+	}
+
+	for i, tc := range testCases {
+		p := Prover(nil)
+		if tc.prover != nil {
+			p = tc.prover
+		}
+		err := checkSrc(tt, src, &Options{Prover: p})
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("tc #%d: %s", i, msg)
+		}
+
+		if tc.prover == nil {
+			continue
+		}
+		if len(tc.prover.scripts) != 1 {
+			tt.Fatalf("tc #%d: got %d scripts, want 1", i, len(tc.prover.scripts))
+		}
+		script := tc.prover.scripts[0]
+		for _, want := range []string{
+			"(declare-const v0 (_ BitVec 256)) ; args.x\n",
+			"(assert (bvsle v0 (_ bv100 256)))\n",
+			"(assert (bvsle v0 v1))\n",
+			"(assert (not (bvsle (bvmul v0 v0) (bvmul v0 v1))))\n(check-sat)\n",
+		} {
+			if !strings.Contains(script, want) {
+				tt.Errorf("tc #%d: script does not contain %q:\n%s", i, want, script)
+			}
+		}
+	}
+}
+
+func TestPubAcrossUse(tt *testing.T) {
+	const usedSrc = "" +
+		"pub const A : base.u32 = 1\n" +
+		"pri const B : base.u32 = 2\n" +
+		"pub struct s?(\n)\n" +
+		"pub func s.f() base.u32 {\n}\n" +
+		"pri func s.g() base.u32 {\n}\n"
+	resolveUse := func(usePath string) ([]byte, error) {
+		if usePath != "std/foo.wuffs" {
+			return nil, fmt.Errorf("no such file %q", usePath)
+		}
+		return []byte(usedSrc), nil
+	}
+
+	testCases := []struct {
+		decl    string
+		wantErr string
+	}{
+		{"pri const X : base.u32 = foo.A", ""},
+		{"pri const X : base.u32 = foo.B", "foo.B"},
+		{"pri struct t(\nh : foo.s,\n)\npri func t.m() base.u32 {\nreturn this.h.f()\n}", ""},
+		{"pri struct t(\nh : foo.s,\n)\npri func t.m() base.u32 {\nreturn this.h.g()\n}", `no field or method named "g"`},
+	}
+
+	for _, tc := range testCases {
+		src := "use \"std/foo\"\n" + tc.decl + "\n"
+		tm := &t.Map{}
+		_, err := Check(tm, []*a.File{parseSrc(tt, tm, src)}, resolveUse)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.decl, msg)
+		}
+	}
+}
+
+func TestRecheck(tt *testing.T) {
+	const src = "" +
+		"pri struct foo(\ni : base.u32,\n)\n" +
+		"pri func foo.bar!() {\nvar x : base.u8\nx = 100\nthis.i = x as base.u32\n}\n" +
+		"pri func foo.baz!() {\nthis.i = 7\n}\n"
+
+	tm := &t.Map{}
+	file := parseSrc(tt, tm, src)
+	c, err := Check(tm, []*a.File{file}, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	bar := c.funcs[t.QQID{0, tm.ByName("foo"), tm.ByName("bar")}]
+	if bar == nil {
+		tt.Fatalf("c.funcs: no entry for foo.bar")
+	}
+
+	// replaceLiteral rewrites the literal assigned to x.
+	r := &a.Rewriter{}
+	prev := tm.ByName("100")
+	replaceLiteral := func(s string) *a.Expr {
+		id, err := tm.Insert(s)
+		if err != nil {
+			tt.Fatalf("Insert: %v", err)
+		}
+		lit := a.NewExpr(0, 0, id, nil, nil, nil, nil)
+		for _, d := range file.TopLevelDecls() {
+			if err := r.Rewrite(d, func(n *a.Node, exit bool) (*a.Node, error) {
+				if !exit && (n.Kind() == a.KExpr) && (n.AsExpr().Ident() == prev) {
+					return lit.AsNode(), nil
+				}
+				return nil, nil
+			}); err != nil {
+				tt.Fatalf("Rewrite: %v", err)
+			}
+		}
+		prev = id
+		return lit
+	}
+
+	lit := replaceLiteral("200")
+	if got := len(r.Changed()); got != 1 || r.Changed()[0] != bar.AsNode() {
+		tt.Fatalf("Changed: got %d nodes, want only foo.bar", got)
+	}
+	if err := c.Recheck(r.Changed()); err != nil {
+		tt.Fatalf("Recheck: %v", err)
+	}
+	if cv := lit.ConstValue(); (cv == nil) || (cv.Int64() != 200) {
+		tt.Errorf("ConstValue: got %v, want 200", cv)
+	}
+	if lit.MType() == nil {
+		tt.Errorf("MType: got nil, want non-nil")
+	}
+
+	r.Reset()
+	replaceLiteral("300")
+	if err := c.Recheck(r.Changed()); (err == nil) || !strings.Contains(err.Error(), "not within bounds") {
+		tt.Errorf("Recheck: got error %v, want one containing %q", err, "not within bounds")
+	}
+
+	if err := r.Rewrite(bar.AsNode(), func(n *a.Node, exit bool) (*a.Node, error) {
+		return a.NewExpr(0, 0, prev, nil, nil, nil, nil).AsNode(), nil
+	}); err == nil {
+		tt.Errorf("Rewrite: replacing a func: got nil error, want non-nil")
+	}
+	if err := c.Recheck([]*a.Node{file.TopLevelDecls()[0]}); err == nil {
+		tt.Errorf("Recheck: a struct: got nil error, want non-nil")
+	}
+}
+
+func TestRecheckCallers(tt *testing.T) {
+	testCases := []struct {
+		desc    string
+		callee  string
+		caller  string
+		from    string
+		to      string
+		wantErr string
+	}{{
+		desc:    "a tightened precondition",
+		callee:  "pri func foo.bar(x: base.u32),\npre args.x < 10,\n{\n}\n",
+		caller:  "this.bar(x: 7)",
+		from:    "10",
+		to:      "5",
+		wantErr: `cannot prove foo.bar's precondition "7 < 5"`,
+	}, {
+		desc:    "a loosened postcondition",
+		callee:  "pri func foo.bar!(),\npost this.i < 10,\n{\nthis.i = 0\n}\n",
+		caller:  "this.bar!()\nthis.a[this.i] = 0",
+		from:    "10",
+		to:      "20",
+		wantErr: `cannot prove "this.i < 10"`,
+	}, {
+		desc:    "a larger frame",
+		callee:  "pri func foo.bar!() {\nthis.j = 0\n}\n",
+		caller:  "this.i = 3\nthis.bar!()\nassert this.i == 3",
+		from:    "j",
+		to:      "i",
+		wantErr: `cannot prove "this.i == 3"`,
+	}, {
+		desc:   "an unchanged caller view",
+		callee: "pri func foo.bar(x: base.u32),\npre args.x < 10,\n{\nvar y : base.u32\ny = 1\n}\n",
+		caller: "this.bar(x: 7)",
+		from:   "1",
+		to:     "2",
+	}}
+
+	for _, tc := range testCases {
+		src := "pri struct foo(\ni : base.u32,\nj : base.u32,\na : array[10] base.u8,\n)\n" +
+			tc.callee + "pri func foo.baz!() {\n" + tc.caller + "\n}\n"
+		tm := &t.Map{}
+		file := parseSrc(tt, tm, src)
+		c, err := Check(tm, []*a.File{file}, nil)
+		if err != nil {
+			tt.Fatalf("%s: Check: %v", tc.desc, err)
+		}
+
+		// Rewrite only the callee, replacing the from ident with the to ident.
+		from, to := tm.ByName(tc.from), tm.ByName(tc.to)
+		if to == 0 {
+			if to, err = tm.Insert(tc.to); err != nil {
+				tt.Fatalf("%s: Insert: %v", tc.desc, err)
+			}
+		}
+		r := &a.Rewriter{}
+		if err := r.Rewrite(file.TopLevelDecls()[1], func(n *a.Node, exit bool) (*a.Node, error) {
+			if exit || (n.Kind() != a.KExpr) || (n.AsExpr().Ident() != from) {
+				return nil, nil
+			}
+			o := n.AsExpr()
+			return a.NewExpr(0, o.Operator(), to, o.LHS(), nil, nil, nil).AsNode(), nil
+		}); err != nil {
+			tt.Fatalf("%s: Rewrite: %v", tc.desc, err)
+		}
+		if len(r.Changed()) != 1 {
+			tt.Fatalf("%s: Changed: got %d nodes, want 1", tc.desc, len(r.Changed()))
+		}
+
+		err = c.Recheck(r.Changed())
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%s: %s", tc.desc, msg)
+		}
+	}
+}
+
+func TestIntrinsicKind(tt *testing.T) {
+	const src = "" +
+		"pri struct foo(\ni : base.u32,\n)\n" +
+		"pri func foo.bar!(src: base.io_reader, s: slice base.u8) {\n" +
+		"var x : base.u32\n" +
+		"var y : base.u64\n" +
+		"x = this.i.min(no_more_than: 3)\n" +
+		"y = args.s.length()\n" +
+		"y = args.src.length()\n" +
+		"this.baz!()\n" +
+		"}\n" +
+		"pri func foo.baz!() {\n}\n"
+
+	tm := &t.Map{}
+	file := parseSrc(tt, tm, src)
+	if _, err := Check(tm, []*a.File{file}, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	got := []string(nil)
+	file.AsNode().Walk(func(n *a.Node) error {
+		if (n.Kind() == a.KExpr) && (n.AsExpr().Operator() == a.ExprOperatorCall) {
+			s := n.AsExpr().Str(tm) + ": "
+			if x, ok := n.AsExpr().Intrinsic(); ok {
+				s += x.Kind.String() + " " + x.Recv.Str(tm) + " " + x.Method.Str(tm)
+			} else {
+				s += n.AsExpr().IntrinsicKind().String()
+			}
+			got = append(got, s)
+		}
+		return nil
+	})
+	want := []string{
+		"this.i.min(no_more_than: 3): IntrinsicNumType this.i min",
+		"args.s.length(): IntrinsicSlice args.s length",
+		"args.src.length(): IntrinsicIOReader args.src length",
+		"this.baz!(): IntrinsicNone",
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		tt.Errorf("got:\n%s\nwant:\n%s", g, w)
+	}
+}
+
+func init() {
+	RegisterRule("test: a < b: a < c; c <= b", func(r *RuleRequest) error {
+		c := r.Arg("c")
+		if (r.Goal.Operator() != t.IDXBinaryLessThan) || (c == nil) {
+			return fmt.Errorf("test: goal %q is not of the form \"a < b\"", r.Goal.Str(r.TMap))
+		}
+		if err := r.ProveBinaryOp(t.IDXBinaryLessThan, r.Goal.LHS().AsExpr(), c); err != nil {
+			return err
+		}
+		return r.ProveBinaryOp(t.IDXBinaryLessEq, c, r.Goal.RHS().AsExpr())
+	})
+	RegisterRule("test: fact count", func(r *RuleRequest) error {
+		if n := r.Arg("n"); (n == nil) || (n.ConstValue() == nil) ||
+			(n.ConstValue().Cmp(big.NewInt(int64(len(r.Facts)))) != 0) {
+			return fmt.Errorf("test: there are %d facts", len(r.Facts))
+		}
+		return nil
+	})
+}
+
+func TestRules(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"if args.x < args.y {\nassert args.x < 10 via \"test: a < b: a < c; c <= b\"(c: args.y)\n}", ""},
+		{"assert args.x < 10 via \"test: a < b: a < c; c <= b\"(c: args.y)", "cannot prove \"args.x < args.y\""},
+		{"assert args.x <= 10 via \"test: a < b: a < c; c <= b\"(c: args.y)", "is not of the form"},
+		{"if args.x < 5 {\nassert args.x < 6 via \"test: fact count\"(n: 1)\n}", ""},
+		{"if args.x < 5 {\nassert args.x < 6 via \"test: fact count\"(n: 2)\n}", "there are 1 facts"},
+		{"assert args.x < 10 via \"test: no such rule\"()", "no such reason"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x: base.u32, y: base.u32[..= 10]) {\n" + tc.body + "\n}\n"
+
+		err := checkSrc(tt, src, nil)
+		if msg := errMismatch(err, tc.wantErr); msg != "" {
+			tt.Errorf("%q: %s", tc.body, msg)
+		}
+	}
+
+	for _, name := range []string{
+		"",
+		"bad \" quote",
+		"test: fact count",
+		"a < b: a < c; c <= b",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					tt.Errorf("RegisterRule(%q): got no panic, want one", name)
+				}
+			}()
+			RegisterRule(name, func(r *RuleRequest) error { return nil })
+		}()
+	}
+}
+
+// TestConcurrentCheck runs Check calls concurrently, as "wuffs-c gen -jobs"
+// does. It is most useful under "go test -race", which reports any package
+// level state that the calls share and modify.
+func TestConcurrentCheck(tt *testing.T) {
+	const filename = "test.wuffs"
+	const src = "" +
+		"pri const A : base.u32 = 1\n" +
+		"pri func foo(x: base.u32[..= 10]) base.u32 {\n" +
+		"\treturn args.x + A\n" +
+		"}\n"
+
+	const n = 32
+	start := make(chan struct{})
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			<-start
+			tm := &t.Map{}
+			tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+			if err != nil {
+				errs <- err
+				return
+			}
+			file, err := parse.Parse(tm, filename, tokens, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = Check(tm, []*a.File{file}, nil)
+			errs <- err
+		}()
+	}
+	close(start)
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			tt.Errorf("%v", err)
+		}
+	}
+}
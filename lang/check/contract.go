@@ -0,0 +1,191 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"errors"
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// A func's "pre" and "post" conditions form a contract between the func and
+// its callers. Inside the func body, the pre conditions are assumed and the
+// post conditions are proved at every return. At each call site, the pre
+// conditions are proved and, once the call completes, the post conditions are
+// assumed. Either way, "this" and "args.x" are replaced by the call's receiver
+// and "x" argument. A post condition's "args.x" means x's value on entry, so
+// the post condition is not assumed if the call can modify its "x" argument,
+// such as a "this.foo!(x: this.y)" call where foo can assign to this.y.
+//
+// Contract conditions can only refer to args, this and consts. Wuffs has no
+// name for a func's return value, so post conditions cannot refer to it.
+
+func (q *checker) tcheckFuncContractAssert(n *a.Assert) error {
+	if err := q.tcheckAssert(n); err != nil {
+		return err
+	}
+	cond := n.Condition()
+	return cond.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		if o := o.AsExpr(); (o.Operator() == 0) && (o.ConstValue() == nil) &&
+			(o.Ident() != t.IDArgs) && (o.Ident() != t.IDThis) {
+			return fmt.Errorf("check: function assertion %q can only refer to args, this and consts",
+				cond.Str(q.tm))
+		}
+		return nil
+	})
+}
+
+func hasFuncPosts(n *a.Func) bool {
+	for _, o := range n.Asserts() {
+		if o.AsAssert().Keyword() == t.IDPost {
+			return true
+		}
+	}
+	return false
+}
+
+// assumeFuncPres adds q.astFunc's pre conditions to q.facts.
+func (q *checker) assumeFuncPres() {
+	for _, o := range q.astFunc.Asserts() {
+		if o := o.AsAssert(); o.Keyword() == t.IDPre {
+			q.facts.appendFact(o.Condition())
+		}
+	}
+}
+
+// bcheckFuncPosts proves q.astFunc's post conditions, given q.facts.
+func (q *checker) bcheckFuncPosts() error {
+	for _, o := range q.astFunc.Asserts() {
+		if o := o.AsAssert(); o.Keyword() == t.IDPost {
+			if err := q.bcheckAssert(o); err != nil {
+				return fmt.Errorf("check: cannot prove postcondition %q", o.Condition().Str(q.tm))
+			}
+		}
+	}
+	return nil
+}
+
+// bcheckCallPres proves f's pre conditions at call, a call to f, and returns
+// f's post conditions as seen from that call site.
+func (q *checker) bcheckCallPres(f *a.Func, call *a.Expr) (posts []*a.Expr, retErr error) {
+	recv := call.LHS().AsExpr().LHS().AsExpr()
+	for _, o := range f.Asserts() {
+		o := o.AsAssert()
+		switch o.Keyword() {
+		case t.IDPre:
+			x := substituteContract(o.Condition(), recv, call)
+			if err := q.bcheckAssert(a.NewAssert(t.IDAssert, x, 0, nil)); err != nil {
+				return nil, fmt.Errorf("check: cannot prove %s's precondition %q",
+					f.QQID().Str(q.tm), x.Str(q.tm))
+			}
+		case t.IDPost:
+			if !q.callAffectsContractArgs(o.Condition(), call) {
+				posts = append(posts, substituteContract(o.Condition(), recv, call))
+			}
+		}
+	}
+	return posts, nil
+}
+
+// callAffectsContractArgs returns whether call can change the value of any
+// of its arguments that n, a post condition, refers to as "args.x". Such a
+// post condition is about the argument's value before the call, so it cannot
+// be assumed, with the argument substituted in, after the call.
+func (q *checker) callAffectsContractArgs(n *a.Expr, call *a.Expr) bool {
+	if !call.Effect().Impure() {
+		return false
+	}
+	frame, fields := q.callFrame(call)
+	return n.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		x := o.AsExpr()
+		if x.Operator() != a.ExprOperatorSelector {
+			return nil
+		}
+		if lhs := x.LHS().AsExpr(); (lhs.Operator() != 0) || (lhs.Ident() != t.IDArgs) {
+			return nil
+		}
+		for _, arg := range call.Args() {
+			if arg := arg.AsArg(); (arg.Name() == x.Ident()) &&
+				q.callAffects(call, frame, fields, arg.Value()) {
+				return errCallAffectsContractArgs
+			}
+		}
+		return nil
+	}) != nil
+}
+
+var errCallAffectsContractArgs = errors.New("call affects contract args")
+
+// substituteContract returns a copy of n, part of a contract condition, with
+// "this" replaced by recv and "args.x" replaced by call's "x" argument.
+func substituteContract(n *a.Expr, recv *a.Expr, call *a.Expr) *a.Expr {
+	if n == nil {
+		return nil
+	}
+	switch n.Operator() {
+	case 0:
+		if n.Ident() == t.IDThis {
+			return recv
+		}
+		return n
+	case a.ExprOperatorSelector:
+		if lhs := n.LHS().AsExpr(); (lhs.Operator() == 0) && (lhs.Ident() == t.IDArgs) {
+			for _, o := range call.Args() {
+				if o := o.AsArg(); o.Name() == n.Ident() {
+					return o.Value()
+				}
+			}
+		}
+	}
+
+	var args []*a.Node
+	if len(n.Args()) > 0 {
+		args = make([]*a.Node, 0, len(n.Args()))
+		for _, o := range n.Args() {
+			if o.Kind() == a.KArg {
+				o := o.AsArg()
+				x := a.NewArg(o.Name(), substituteContract(o.Value(), recv, call)).AsNode()
+				x.SetMBounds(o.AsNode().MBounds())
+				x.SetMType(o.AsNode().MType())
+				args = append(args, x)
+			} else {
+				args = append(args, substituteContract(o.AsExpr(), recv, call).AsNode())
+			}
+		}
+	}
+
+	ret := a.NewExpr(n.AsNode().AsRaw().Flags(), n.Operator(), n.Ident(),
+		substituteContractNode(n.LHS(), recv, call),
+		substituteContractNode(n.MHS(), recv, call),
+		substituteContractNode(n.RHS(), recv, call),
+		args)
+	ret.SetConstValue(n.ConstValue())
+	ret.SetMBounds(n.MBounds())
+	ret.SetMType(n.MType())
+	return ret
+}
+
+// substituteContractNode is like substituteContract, but n is nil or a node
+// that is either a KExpr or a KTypeExpr (such as the RHS of an "as").
+func substituteContractNode(n *a.Node, recv *a.Expr, call *a.Expr) *a.Node {
+	if (n == nil) || (n.Kind() != a.KExpr) {
+		return n
+	}
+	return substituteContract(n.AsExpr(), recv, call).AsNode()
+}
@@ -0,0 +1,273 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// assigned is the set of local variables that are definitely assigned at a
+// program point. A nil assigned means that the program point is unreachable.
+type assigned map[t.ID]struct{}
+
+func (z assigned) clone() assigned {
+	if z == nil {
+		return nil
+	}
+	ret := make(assigned, len(z))
+	for k := range z {
+		ret[k] = struct{}{}
+	}
+	return ret
+}
+
+// meet returns the intersection of x and y, the set of variables that are
+// definitely assigned when control can flow from either x or y. An
+// unreachable (nil) x or y does not constrain the result.
+func meet(x assigned, y assigned) assigned {
+	if x == nil {
+		return y.clone()
+	} else if y == nil {
+		return x.clone()
+	}
+	ret := make(assigned, len(x))
+	for k := range x {
+		if _, ok := y[k]; ok {
+			ret[k] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// dchecker checks that no local variable is read before it is definitely
+// assigned, on every path through a function body. Wuffs zero-initializes
+// local variables, but code that relies on that can mask logic errors, so
+// Options.RequireDefiniteAssignment opts in to this stricter check.
+//
+// Only variables of numeric or boolean type are tracked. Array variables, for
+// example, are often deliberately zero-initialized scratch buffers.
+type dchecker struct {
+	q       *checker
+	tracked map[t.ID]bool
+
+	// breaks maps a loop to the variables definitely assigned at every break
+	// out of that loop seen so far.
+	breaks map[a.Loop]assigned
+}
+
+func (q *checker) dcheckFuncBody(body []*a.Node) error {
+	d := &dchecker{
+		q:       q,
+		tracked: map[t.ID]bool{},
+		breaks:  map[a.Loop]assigned{},
+	}
+	for _, o := range body {
+		if o.Kind() != a.KVar {
+			break
+		}
+		o := o.AsVar()
+		if typ := o.XType(); typ.IsNumType() || typ.IsBool() {
+			d.tracked[o.Name()] = true
+		}
+	}
+	if len(d.tracked) == 0 {
+		return nil
+	}
+	_, err := d.dcheckBlock(body, assigned{})
+	return err
+}
+
+func (d *dchecker) dcheckBlock(block []*a.Node, z assigned) (assigned, error) {
+	for _, o := range block {
+		if z == nil {
+			// The rest of the block is unreachable.
+			break
+		}
+		d.q.errFilename, d.q.errLine = o.AsRaw().FilenameLine()
+		d.q.errCol = o.AsRaw().Col()
+		var err error
+		if z, err = d.dcheckStatement(o, z); err != nil {
+			return nil, err
+		}
+	}
+	return z, nil
+}
+
+func (d *dchecker) dcheckStatement(n *a.Node, z assigned) (assigned, error) {
+	switch n.Kind() {
+	case a.KAssert, a.KChoose, a.KVar:
+		// No-op. Assertions are compile-time only.
+
+	case a.KAssign:
+		n := n.AsAssign()
+		if err := d.dcheckExpr(n.RHS(), z); err != nil {
+			return nil, err
+		}
+		lhs := n.LHS()
+		if lhs == nil {
+			break
+		}
+		if (n.Operator() != t.IDEq) && (n.Operator() != t.IDEqQuestion) {
+			// A compound assignment, such as "x += 1", also reads x.
+			if err := d.dcheckExpr(lhs, z); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if lhs.Operator() == a.ExprOperatorList {
+			for _, o := range lhs.Args() {
+				if err := d.dcheckAssignee(o.AsExpr(), z); err != nil {
+					return nil, err
+				}
+			}
+		} else if err := d.dcheckAssignee(lhs, z); err != nil {
+			return nil, err
+		}
+
+	case a.KIf:
+		n := n.AsIf()
+		if err := d.dcheckExpr(n.Condition(), z); err != nil {
+			return nil, err
+		}
+		zTrue, err := d.dcheckBlock(n.BodyIfTrue(), z.clone())
+		if err != nil {
+			return nil, err
+		}
+		zFalse := z.clone()
+		if elseIf := n.ElseIf(); elseIf != nil {
+			zFalse, err = d.dcheckStatement(elseIf.AsNode(), zFalse)
+		} else {
+			zFalse, err = d.dcheckBlock(n.BodyIfFalse(), zFalse)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return meet(zTrue, zFalse), nil
+
+	case a.KIOManip:
+		n := n.AsIOManip()
+		for _, o := range [...]*a.Expr{n.IO(), n.Arg1(), n.HistoryPosition()} {
+			if err := d.dcheckExpr(o, z); err != nil {
+				return nil, err
+			}
+		}
+		return d.dcheckBlock(n.Body(), z)
+
+	case a.KIterate:
+		n := n.AsIterate()
+		for _, o := range n.Assigns() {
+			o := o.AsAssign()
+			if err := d.dcheckExpr(o.RHS(), z); err != nil {
+				return nil, err
+			}
+			if err := d.dcheckAssignee(o.LHS(), z); err != nil {
+				return nil, err
+			}
+		}
+		// Each iterate body can run zero or more times.
+		for m := n; m != nil; m = m.ElseIterate() {
+			if _, err := d.dcheckBlock(m.Body(), z.clone()); err != nil {
+				return nil, err
+			}
+		}
+
+	case a.KJump:
+		n := n.AsJump()
+		if n.Keyword() == t.IDBreak {
+			loop := n.JumpTarget()
+			if b, ok := d.breaks[loop]; ok {
+				d.breaks[loop] = meet(b, z)
+			} else {
+				d.breaks[loop] = z.clone()
+			}
+		}
+		return nil, nil
+
+	case a.KRet:
+		if err := d.dcheckExpr(n.AsRet().Value(), z); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case a.KSwitch:
+		n := n.AsSwitch()
+		if err := d.dcheckExpr(n.Subject(), z); err != nil {
+			return nil, err
+		}
+		// The bounds checker ensures that the cases are exhaustive.
+		ret := assigned(nil)
+		for _, o := range n.Cases() {
+			zCase, err := d.dcheckBlock(o.AsCase().Body(), z.clone())
+			if err != nil {
+				return nil, err
+			}
+			ret = meet(ret, zCase)
+		}
+		return ret, nil
+
+	case a.KWhile:
+		n := n.AsWhile()
+		if err := d.dcheckExpr(n.Condition(), z); err != nil {
+			return nil, err
+		}
+		// The body's entry state is z: every continue, explicit or implicit,
+		// can only add assignments.
+		if _, err := d.dcheckBlock(n.Body(), z.clone()); err != nil {
+			return nil, err
+		}
+		b, hasBreak := d.breaks[n]
+		if n.IsWhileTrue() {
+			// The loop can only be exited by a break.
+			if !hasBreak {
+				return nil, nil
+			}
+			return b, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("check: unrecognized ast.Kind (%s) for dcheckStatement", n.Kind())
+	}
+	return z, nil
+}
+
+// dcheckAssignee marks n, the LHS of a plain assignment, as assigned if it is
+// a tracked variable. Otherwise, n is something like "x[i]" or "this.x" and
+// its sub-expressions are read.
+func (d *dchecker) dcheckAssignee(n *a.Expr, z assigned) error {
+	if (n.Operator() == 0) && d.tracked[n.Ident()] {
+		z[n.Ident()] = struct{}{}
+		return nil
+	}
+	return d.dcheckExpr(n, z)
+}
+
+func (d *dchecker) dcheckExpr(n *a.Expr, z assigned) error {
+	if n == nil {
+		return nil
+	}
+	return n.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		o1 := o.AsExpr()
+		if (o1.Operator() != 0) || !d.tracked[o1.Ident()] {
+			return nil
+		}
+		if _, ok := z[o1.Ident()]; !ok {
+			return fmt.Errorf("check: variable %q is read before it is definitely assigned",
+				o1.Ident().Str(d.q.tm))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// FuncEffects are what a func's body does, as inferred by the checker. This
+// is finer grained than the a.Effect (pure, "!" or "?") that a func's
+// signature declares, which only bounds what its body may do.
+//
+// The C code generator const-qualifies the receivers of funcs whose declared
+// effect is pure, and Lint suggests declaring that effect for "!" funcs that
+// could be pure. It does not consult FuncEffects to const-qualify other funcs,
+// such as a "!" func that writes only to args: code generators are not given
+// the Checker, and such a func's C body can take non-const pointers into
+// this's arrays, such as when slicing "this.buf[..]".
+type FuncEffects uint32
+
+const (
+	// FuncEffectWritesThis means assigning to this's fields or making impure
+	// calls on this or its fields.
+	FuncEffectWritesThis = FuncEffects(1 << iota)
+	// FuncEffectWritesArgs means assigning through, or making impure calls on,
+	// args (other than I/O arguments) or other slices, whose elements can be
+	// shared with the caller.
+	FuncEffectWritesArgs
+	// FuncEffectReadsIO means calling methods on an I/O reader, or pure
+	// methods on an I/O writer.
+	FuncEffectReadsIO
+	// FuncEffectWritesIO means calling impure methods on an I/O writer.
+	FuncEffectWritesIO
+	// FuncEffectSuspends means yielding or calling a coroutine that can
+	// suspend.
+	FuncEffectSuspends
+)
+
+func (e FuncEffects) String() string {
+	if e == 0 {
+		return "none"
+	}
+	s := []string(nil)
+	for i, name := range [...]string{"writes_this", "writes_args", "reads_io", "writes_io", "suspends"} {
+		if e&(1<<uint(i)) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+// FuncEffects returns the inferred effects of the func named qqid, which must
+// have been successfully checked by c. Effects are transitive: calling a func
+// on this or on args has that func's effects.
+func (c *Checker) FuncEffects(qqid t.QQID) (FuncEffects, error) {
+	f := c.funcs[qqid]
+	if f == nil {
+		return 0, fmt.Errorf("check: no func named %s", qqid.Str(c.tm))
+	}
+	return c.funcEffects(f)
+}
+
+func (c *Checker) funcEffects(f *a.Func) (FuncEffects, error) {
+	if e, ok := c.cachedFuncEffects[f]; ok {
+		return e, nil
+	}
+	ret := FuncEffects(0)
+	for _, o := range f.Body() {
+		if err := o.Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KAssign:
+				lhs := o.AsAssign().LHS()
+				if lhs == nil {
+					return nil
+				}
+				if lhs.Operator() == a.ExprOperatorList {
+					for _, x := range lhs.Args() {
+						ret |= writeEffects(x.AsExpr())
+					}
+				} else {
+					ret |= writeEffects(lhs)
+				}
+
+			case a.KRet:
+				if o.AsRet().Keyword() == t.IDYield {
+					ret |= FuncEffectSuspends
+				}
+
+			case a.KExpr:
+				if o := o.AsExpr(); o.Operator() == a.ExprOperatorCall {
+					e, err := c.callEffects(o)
+					if err != nil {
+						return err
+					}
+					ret |= e
+				}
+			}
+			return nil
+		}); err != nil {
+			return 0, err
+		}
+	}
+	c.cachedFuncEffects[f] = ret
+	return ret, nil
+}
+
+// callEffects returns the effects of n, a call expression.
+func (c *Checker) callEffects(n *a.Expr) (FuncEffects, error) {
+	ret := FuncEffects(0)
+	recv := n.LHS().AsExpr().LHS().AsExpr()
+	if typ := recv.MType(); typ.IsIOTokenType() {
+		if n.Effect().Impure() && ((typ.QID()[1] == t.IDIOWriter) || (typ.QID()[1] == t.IDTokenWriter)) {
+			ret |= FuncEffectWritesIO
+		} else {
+			ret |= FuncEffectReadsIO
+		}
+	} else if n.Effect().Impure() {
+		ret |= writeEffects(recv)
+	}
+
+	f, err := c.resolveFunc(n.LHS().AsExpr().MType())
+	if err != nil {
+		return 0, err
+	}
+	if f.Receiver()[0] == t.IDBase {
+		if n.Effect().Coroutine() {
+			// Built-in coroutines, such as "read_u8?", can always suspend.
+			ret |= FuncEffectSuspends
+		}
+		return ret, nil
+	}
+	e, err := c.funcEffects(f)
+	if err != nil {
+		return 0, err
+	}
+	// The callee's I/O and suspension effects carry over, as I/O arguments
+	// are passed through. Its writes to its own this and args are accounted
+	// for by the receiver above.
+	return ret | (e & (FuncEffectReadsIO | FuncEffectWritesIO | FuncEffectSuspends)), nil
+}
+
+// writeEffects returns the effects of writing to n, such as "this.x[i]".
+func writeEffects(n *a.Expr) FuncEffects {
+	ret := FuncEffects(0)
+	for ; n != nil; n = n.LHS().AsExpr() {
+		if typ := n.MType(); (typ != nil) && (typ.IsEitherSliceType() || typ.IsPointerType()) {
+			ret = FuncEffectWritesArgs
+		}
+		switch n.Operator() {
+		case 0:
+			switch n.Ident() {
+			case t.IDThis:
+				return FuncEffectWritesThis
+			case t.IDArgs:
+				return FuncEffectWritesArgs
+			}
+			return ret
+		case t.IDDot, t.IDOpenBracket, t.IDDotDot:
+			// No-op.
+		default:
+			return ret
+		}
+	}
+	return ret
+}
+
+// neededEffect returns the weakest a.Effect that f's body needs, based on the
+// effects of the calls it makes, the statements it contains and its
+// assignments to this, args or slices. The language allows pure funcs to
+// write through local slices, but by convention such funcs are marked "!".
+func neededEffect(f *a.Func) a.Effect {
+	ret := a.EffectPure
+	for _, o := range f.Body() {
+		o.Walk(func(o *a.Node) error {
+			e := a.EffectPure
+			switch o.Kind() {
+			case a.KAssign:
+				if lhs := o.AsAssign().LHS(); (lhs != nil) && (writeEffects(lhs) != 0) {
+					e = a.EffectImpure
+				}
+			case a.KChoose, a.KIOManip:
+				e = a.EffectImpure
+			case a.KRet:
+				if o.AsRet().Keyword() == t.IDYield {
+					e = a.EffectImpureCoroutine
+				}
+			case a.KExpr:
+				e = o.AsExpr().Effect()
+			}
+			if ret.WeakerThan(e) {
+				ret = e
+			}
+			return nil
+		})
+	}
+	return ret
+}
+
+// lintStrongerEffect warns about a "!" func whose body could be pure. Public
+// funcs are exempt, as they may implement an interface, and so are choosy,
+// cpu_arch and "choose" alternative funcs, which must all have the same
+// effect.
+func (c *Checker) lintStrongerEffect(n *a.Func) []*Warning {
+	if n.Public() || n.Choosy() || n.HasChooseCPUArch() || c.isChooseAlternative(n) ||
+		(n.Effect() != a.EffectImpure) || (neededEffect(n) != a.EffectPure) {
+		return nil
+	}
+	return []*Warning{{
+		Err: fmt.Errorf("check: func %s is impure (has a \"!\" effect) but could be pure",
+			n.QQID().Str(c.tm)),
+		Filename: n.Filename(),
+		Line:     n.Line(),
+		Col:      n.Col(),
+	}}
+}
+
+func (c *Checker) isChooseAlternative(n *a.Func) bool {
+	for qid, alts := range c.chooseAlternatives {
+		if qid[0] != n.Receiver()[1] {
+			continue
+		}
+		for _, alt := range alts {
+			if alt == n.FuncName() {
+				return true
+			}
+		}
+	}
+	return false
+}
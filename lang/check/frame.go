@@ -0,0 +1,241 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"sort"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// After an impure call, the bounds checker drops the facts that the call
+// could invalidate. For a "this.foo!()" call, instead of dropping every fact
+// that mentions this, it drops only those that mention the fields of this
+// that foo's frame (the state that it can modify) includes.
+//
+// The analysis is syntactic, as a callee's body might not have been type
+// checked yet. It is also conservative: writing through a local slice or
+// pointer, which might refer to any of this's fields, puts all of them in the
+// frame.
+
+// frame is the set of this's fields that a func can modify. If all is set,
+// that is every field.
+type frame struct {
+	all    bool
+	fields map[t.ID]bool
+}
+
+func (f *frame) add(o *frame) {
+	if o.all {
+		f.all = true
+		return
+	}
+	for k := range o.fields {
+		f.fields[k] = true
+	}
+}
+
+// str returns a canonical form of f, such as "all" or "{a b}", for cacheKey.
+func (f *frame) str(tm *t.Map) string {
+	if f.all {
+		return "all"
+	}
+	names := make([]string, 0, len(f.fields))
+	for k := range f.fields {
+		names = append(names, k.Str(tm))
+	}
+	sort.Strings(names)
+	return "{" + strings.Join(names, " ") + "}"
+}
+
+// funcFrame returns the frame of n, a method of a struct in this package.
+// It relies on checkNoRecursiveFuncs having already run on n's callees, or on
+// them being checked later, as recursive calls are conservatively treated as
+// modifying everything.
+func (c *Checker) funcFrame(n *a.Func) *frame {
+	if f, ok := c.cachedFuncFrames[n]; ok {
+		if f == nil {
+			// A recursive call chain, which checkNoRecursiveFuncs rejects.
+			return &frame{all: true}
+		}
+		return f
+	}
+	c.cachedFuncFrames[n] = nil
+
+	ret := &frame{fields: map[t.ID]bool{}}
+	localVars := map[t.ID]*a.TypeExpr{}
+	for _, o := range n.Body() {
+		if o.Kind() == a.KVar {
+			localVars[o.AsVar().Name()] = o.AsVar().XType()
+		}
+	}
+
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KAssign:
+				if lhs := o.AsAssign().LHS(); lhs == nil {
+					// No-op.
+				} else if lhs.Operator() == a.ExprOperatorList {
+					for _, x := range lhs.Args() {
+						ret.add(writeFrame(x.AsExpr(), localVars))
+					}
+				} else {
+					ret.add(writeFrame(lhs, localVars))
+				}
+
+			case a.KIOManip:
+				// The I/O data, such as "this.buf[..]" in "io_bind (io: args.src,
+				// data: this.buf[..])", can be written to.
+				o := o.AsIOManip()
+				for _, x := range [...]*a.Expr{o.IO(), o.Arg1()} {
+					if x != nil {
+						ret.add(writeFrame(x, localVars))
+					}
+				}
+
+			case a.KExpr:
+				o := o.AsExpr()
+				if (o.Operator() != a.ExprOperatorCall) || !o.Effect().Impure() {
+					break
+				}
+				callee := o.LHS().AsExpr()
+				if callee.Operator() != a.ExprOperatorSelector {
+					ret.all = true
+					break
+				}
+				recv := callee.LHS().AsExpr()
+				if (recv.Operator() != 0) || (recv.Ident() != t.IDThis) {
+					ret.add(writeFrame(recv, localVars))
+				} else if f := c.funcs[t.QQID{0, n.Receiver()[1], callee.Ident()}]; f != nil {
+					ret.add(c.funcFrame(f))
+				} else {
+					ret.all = true
+				}
+				// Arguments that are slices of this's fields can be written
+				// through.
+				for _, arg := range o.Args() {
+					ret.add(writeFrame(arg.AsArg().Value(), localVars))
+				}
+			}
+			return nil
+		})
+	}
+
+	c.cachedFuncFrames[n] = ret
+	return ret
+}
+
+// writeFrame returns the frame of writing to n, such as "this.x[i]" or "s[i]"
+// for a local slice variable s.
+func writeFrame(n *a.Expr, localVars map[t.ID]*a.TypeExpr) *frame {
+	if field := thisField(n); field != nil {
+		return &frame{fields: map[t.ID]bool{field.Ident(): true}}
+	}
+	for ; n != nil; n = n.LHS().AsExpr() {
+		switch n.Operator() {
+		case 0:
+			// Only local slices and pointers (and, conservatively, other
+			// local types such as tables) can refer to this's fields.
+			if typ := localVars[n.Ident()]; (typ == nil) ||
+				typ.IsNumType() || typ.IsBool() || typ.IsStatus() || typ.IsIOTokenType() {
+				return &frame{}
+			}
+			return &frame{all: true}
+		case a.ExprOperatorSelector, a.ExprOperatorIndex, a.ExprOperatorSlice:
+			// No-op.
+		default:
+			return &frame{}
+		}
+	}
+	return &frame{}
+}
+
+// thisField returns the "this.x" sub-expression of n, such as "this.x[i]" or
+// "this.x.y", or nil if n is not rooted in a field of this.
+func thisField(n *a.Expr) *a.Expr {
+	for ; n != nil; n = n.LHS().AsExpr() {
+		switch n.Operator() {
+		case a.ExprOperatorSelector:
+			if lhs := n.LHS().AsExpr(); (lhs.Operator() == 0) && (lhs.Ident() == t.IDThis) {
+				return n
+			}
+		case a.ExprOperatorIndex, a.ExprOperatorSlice:
+			// No-op.
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// frameAffects returns whether a call whose frame is f can change the value
+// of x, a fact. It can if x mentions one of f's fields, or if it mentions this
+// other than through a field, such as in "this.foo()", whose value could
+// depend on any field.
+func (c *Checker) frameAffects(f *frame, fields map[t.ID]bool, x *a.Expr) bool {
+	if x == nil {
+		return false
+	}
+	switch x.Operator() {
+	case 0:
+		return x.Ident() == t.IDThis
+	case a.ExprOperatorSelector:
+		if lhs := x.LHS().AsExpr(); (lhs.Operator() == 0) && (lhs.Ident() == t.IDThis) {
+			if !fields[x.Ident()] {
+				return true
+			}
+			return f.all || f.fields[x.Ident()]
+		}
+	}
+	if c.frameAffects(f, fields, x.LHS().AsExpr()) || c.frameAffects(f, fields, x.MHS().AsExpr()) {
+		return true
+	}
+	if (x.Operator() != t.IDXBinaryAs) && c.frameAffects(f, fields, x.RHS().AsExpr()) {
+		return true
+	}
+	for _, o := range x.Args() {
+		if o.Kind() == a.KArg {
+			if c.frameAffects(f, fields, o.AsArg().Value()) {
+				return true
+			}
+		} else if c.frameAffects(f, fields, o.AsExpr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// callFrame returns the frame of call, a "this.foo!()" call, and the names
+// of this's fields. It returns a nil frame for other calls.
+func (q *checker) callFrame(call *a.Expr) (*frame, map[t.ID]bool) {
+	callee := call.LHS().AsExpr()
+	if callee.Operator() != a.ExprOperatorSelector {
+		return nil, nil
+	}
+	recv := callee.LHS().AsExpr()
+	if (recv.Operator() != 0) || (recv.Ident() != t.IDThis) {
+		return nil, nil
+	}
+	qid := q.astFunc.Receiver()
+	f := q.c.funcs[t.QQID{qid[0], qid[1], callee.Ident()}]
+	s := q.c.structs[qid]
+	if (f == nil) || (s == nil) || (qid[0] != 0) {
+		return nil, nil
+	}
+	fields := map[t.ID]bool{}
+	for _, o := range s.Fields() {
+		fields[o.AsField().Name()] = true
+	}
+	return q.c.funcFrame(f), fields
+}
@@ -0,0 +1,194 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Warning is a lint finding: code that is valid, but that is probably not what
+// the programmer intended. Unlike an Error, it does not stop code generation.
+type Warning struct {
+	Err      error
+	Filename string
+	Line     uint32
+	Col      uint32 // 1-based, or 0 if unknown.
+}
+
+func (w *Warning) Error() string {
+	return fmt.Sprintf("%s at %s", w.Err, pos(w.Filename, w.Line, w.Col))
+}
+
+// pos formats a source position as "filename:line:col", or as "filename:line"
+// if the column is unknown.
+func pos(filename string, line uint32, col uint32) string {
+	if col == 0 {
+		return fmt.Sprintf("%s:%d", filename, line)
+	}
+	return fmt.Sprintf("%s:%d:%d", filename, line, col)
+}
+
+// Lint looks for likely mistakes in the funcs of files, which must have been
+// successfully checked by c:
+//   - local variables that are never read.
+//   - impure funcs that could be pure.
+//   - reset funcs that do not reset all of their fields.
+//   - discarded statuses, from non-coroutine calls, that can be errors.
+//   - assert statements that are never needed to prove anything, as the
+//     function still checks when they are removed.
+//
+// Unreachable code, such as statements after a return, is already an error.
+//
+// Finding unneeded asserts re-checks each function once per assert, which can
+// be slow for large functions. The funcs are left as c checked them.
+func (c *Checker) Lint(files []*a.File) ([]*Warning, error) {
+	ws := []*Warning(nil)
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KFunc {
+				continue
+			}
+			ws = append(ws, c.lintUnreadVars(n.AsFunc())...)
+			ws = append(ws, c.lintStrongerEffect(n.AsFunc())...)
+			w, err := c.lintResetFields(n.AsFunc())
+			if err != nil {
+				return nil, err
+			}
+			ws = append(ws, w...)
+			w, err = c.lintDiscardedStatuses(n.AsFunc())
+			if err != nil {
+				return nil, err
+			}
+			ws = append(ws, w...)
+			w, err = c.lintUnneededAsserts(n.AsFunc())
+			if err != nil {
+				return nil, err
+			}
+			ws = append(ws, w...)
+		}
+	}
+	return ws, nil
+}
+
+func (c *Checker) lintUnreadVars(n *a.Func) []*Warning {
+	vars := []*a.Var(nil)
+	for _, o := range n.Body() {
+		if o.Kind() != a.KVar {
+			break
+		}
+		vars = append(vars, o.AsVar())
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	// Assigning to "x", including with "x += 1", does not read it.
+	assignees := map[*a.Expr]bool{}
+	reads := map[t.ID]bool{}
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			if o.Kind() == a.KAssign {
+				if lhs := o.AsAssign().LHS(); lhs == nil {
+					// No-op.
+				} else if lhs.Operator() == a.ExprOperatorList {
+					for _, x := range lhs.Args() {
+						assignees[x.AsExpr()] = true
+					}
+				} else {
+					assignees[lhs] = true
+				}
+			} else if o.Kind() == a.KExpr {
+				if x := o.AsExpr(); (x.Operator() == 0) && !assignees[x] {
+					reads[x.Ident()] = true
+				}
+			}
+			return nil
+		})
+	}
+
+	ws := []*Warning(nil)
+	for _, v := range vars {
+		if !reads[v.Name()] {
+			ws = append(ws, &Warning{
+				Err:      fmt.Errorf("check: variable %q is never read", v.Name().Str(c.tm)),
+				Filename: v.Filename(),
+				Line:     v.Line(),
+				Col:      v.Col(),
+			})
+		}
+	}
+	return ws
+}
+
+func (c *Checker) lintUnneededAsserts(n *a.Func) ([]*Warning, error) {
+	if n.Test() {
+		// A test func's asserts are run-time checks, not proof hints.
+		return nil, nil
+	}
+	asserts := []*a.Node(nil)
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			if (o.Kind() == a.KAssert) && (o.AsAssert().Keyword() == t.IDAssert) &&
+				!o.AsAssert().IsChooseCPUArch() {
+				asserts = append(asserts, o)
+			}
+			return nil
+		})
+	}
+	if len(asserts) == 0 {
+		return nil, nil
+	}
+
+	ws := []*Warning(nil)
+	decls := []*a.Node{n.AsNode()}
+	for _, x := range asserts {
+		// Replace the assert with "assert true", which proves nothing.
+		xTrue := a.NewExpr(0, 0, t.IDTrue, nil, nil, nil, nil)
+		y := a.NewAssert(x.AsAssert().Keyword(), xTrue, 0, nil).AsNode()
+		y.AsRaw().SetFilenameLine(x.AsRaw().FilenameLine())
+		y.AsRaw().SetCol(x.AsRaw().Col())
+		if err := replaceNode(n.AsNode(), x, y); err != nil {
+			return nil, err
+		}
+		if c.Recheck(decls) == nil {
+			filename, line := x.AsRaw().FilenameLine()
+			col := x.AsRaw().Col()
+			ws = append(ws, &Warning{
+				Err:      fmt.Errorf("check: assert %q is not needed", x.AsAssert().Condition().Str(c.tm)),
+				Filename: filename,
+				Line:     line,
+				Col:      col,
+			})
+		}
+		if err := replaceNode(n.AsNode(), y, x); err != nil {
+			return nil, err
+		}
+	}
+
+	// Restore the check results for the unmodified func.
+	if err := c.Recheck(decls); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func replaceNode(decl *a.Node, old *a.Node, new *a.Node) error {
+	r := a.Rewriter{}
+	return r.Rewrite(decl, func(o *a.Node, exit bool) (*a.Node, error) {
+		if o == old {
+			return new, a.SkipSubNodes
+		}
+		return nil, nil
+	})
+}
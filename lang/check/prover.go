@@ -0,0 +1,354 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"strings"
+	"time"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Prover is an optional fallback for assertions that the checker's built-in
+// reasoning cannot prove, such as those involving non-linear arithmetic.
+type Prover interface {
+	// Prove returns whether the assertions in an SMT-LIB2 script are
+	// unsatisfiable. The script's final assertion is the negation of the
+	// condition to prove, so unsatisfiable means proved.
+	Prove(script string) (bool, error)
+}
+
+// ExternalProver is a Prover that runs an SMT solver, such as "z3 -in" or
+// "cvc5 --lang smt2", passing the script on its standard input.
+//
+// If Timeout is positive, the solver is killed if it runs for longer than
+// that, which is treated like an "unknown" answer: the condition is not
+// proved. Solvers can take hours on non-linear bitvector arithmetic.
+type ExternalProver struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+// NewExternalProver returns an ExternalProver for a space-separated command
+// line, such as "z3 -in", and a timeout (zero means no timeout).
+func NewExternalProver(commandLine string, timeout time.Duration) (*ExternalProver, error) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return nil, errors.New("check: empty prover command line")
+	}
+	return &ExternalProver{
+		Command: fields[0],
+		Args:    fields[1:],
+		Timeout: timeout,
+	}, nil
+}
+
+func (p *ExternalProver) Prove(script string) (bool, error) {
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Stdin = strings.NewReader(script)
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return false, nil
+		}
+		return false, fmt.Errorf("check: running prover %q: %v", p.Command, err)
+	}
+	switch answer := strings.TrimSpace(stdout.String()); answer {
+	case "unsat":
+		return true, nil
+	case "sat", "unknown":
+		return false, nil
+	default:
+		return false, fmt.Errorf("check: prover %q gave unexpected answer %q", p.Command, answer)
+	}
+}
+
+// smtWidth is the bit width of the SMT-LIB2 bitvectors used to model Wuffs'
+// (mathematical, arbitrary precision) integers. Expressions whose values
+// might not fit in a smtWidth-bit signed integer are not translated.
+const smtWidth = 256
+
+var errNotTranslatable = errors.New("check: not translatable to SMT-LIB2")
+
+// smtScript is an SMT-LIB2 script under construction.
+type smtScript struct {
+	q *checker
+
+	// decls and asserts are SMT-LIB2 commands.
+	decls   []string
+	asserts []string
+
+	// opaque maps an opaque sub-expression's string form to its SMT-LIB2
+	// constant's name.
+	opaque map[string]string
+}
+
+// proveWithProver asks q.c.opts.Prover to prove condition, given q.facts.
+func (q *checker) proveWithProver(condition *a.Expr) (bool, error) {
+	s := &smtScript{
+		q:      q,
+		opaque: map[string]string{},
+	}
+
+	// Facts that we cannot translate are dropped, which is sound: it only
+	// means assuming less.
+	facts := []string(nil)
+	for _, x := range q.facts {
+		if f, _, err := s.translate(x); err == nil {
+			facts = append(facts, f)
+		} else if err != errNotTranslatable {
+			return false, err
+		}
+	}
+	c, _, err := s.translate(condition)
+	if err == errNotTranslatable {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("(set-logic QF_BV)\n")
+	for _, d := range s.decls {
+		b.WriteString(d)
+		b.WriteByte('\n')
+	}
+	for _, x := range s.asserts {
+		fmt.Fprintf(b, "(assert %s)\n", x)
+	}
+	for _, f := range facts {
+		fmt.Fprintf(b, "(assert %s)\n", f)
+	}
+	fmt.Fprintf(b, "(assert (not %s))\n(check-sat)\n", c)
+	script := b.String()
+
+	if proved, ok := q.c.provedScripts[script]; ok {
+		return proved, nil
+	}
+	proved, err := q.c.opts.Prover.Prove(script)
+	if err != nil {
+		return false, err
+	}
+	q.c.provedScripts[script] = proved
+	return proved, nil
+}
+
+func smtConst(i *big.Int) string {
+	if i.Sign() < 0 {
+		return fmt.Sprintf("(bvneg (_ bv%s %d))", big.NewInt(0).Neg(i), smtWidth)
+	}
+	return fmt.Sprintf("(_ bv%s %d)", i, smtWidth)
+}
+
+func maxInt(x int, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func bitLen(b bounds) int {
+	n := b[0].BitLen()
+	if m := b[1].BitLen(); n < m {
+		n = m
+	}
+	return n
+}
+
+// translate returns the SMT-LIB2 form of n. For a numeric n, it also returns
+// an upper bound on the number of bits (excluding the sign bit) of n's value.
+func (s *smtScript) translate(n *a.Expr) (str string, nBits int, retErr error) {
+	if cv := n.ConstValue(); cv != nil {
+		if n.MType().IsBool() {
+			if cv.Sign() == 0 {
+				return "false", 0, nil
+			}
+			return "true", 0, nil
+		}
+		return smtConst(cv), cv.BitLen(), nil
+	}
+
+	op := n.Operator()
+	switch op {
+	case t.IDXUnaryNot:
+		r, _, err := s.translate(n.RHS().AsExpr())
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("(not %s)", r), 0, nil
+
+	case t.IDXUnaryPlus:
+		return s.translate(n.RHS().AsExpr())
+
+	case t.IDXUnaryMinus:
+		r, rBits, err := s.translate(n.RHS().AsExpr())
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("(bvneg %s)", r), rBits, nil
+
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq, t.IDXBinaryEqEq,
+		t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan, t.IDXBinaryAnd, t.IDXBinaryOr,
+		t.IDXBinaryPlus, t.IDXBinaryMinus, t.IDXBinaryStar, t.IDXBinarySlash, t.IDXBinaryPercent,
+		t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryAmp, t.IDXBinaryPipe, t.IDXBinaryHat:
+		l, lBits, err := s.translate(n.LHS().AsExpr())
+		if err != nil {
+			return "", 0, err
+		}
+		r, rBits, err := s.translate(n.RHS().AsExpr())
+		if err != nil {
+			return "", 0, err
+		}
+		return s.translateBinaryOp(op, l, lBits, r, rBits)
+
+	case t.IDXAssociativePlus, t.IDXAssociativeStar, t.IDXAssociativeAmp,
+		t.IDXAssociativePipe, t.IDXAssociativeHat, t.IDXAssociativeAnd, t.IDXAssociativeOr:
+		bop := t.IDXBinaryPlus
+		switch op {
+		case t.IDXAssociativeStar:
+			bop = t.IDXBinaryStar
+		case t.IDXAssociativeAmp:
+			bop = t.IDXBinaryAmp
+		case t.IDXAssociativePipe:
+			bop = t.IDXBinaryPipe
+		case t.IDXAssociativeHat:
+			bop = t.IDXBinaryHat
+		case t.IDXAssociativeAnd:
+			bop = t.IDXBinaryAnd
+		case t.IDXAssociativeOr:
+			bop = t.IDXBinaryOr
+		}
+		str, nBits := "", 0
+		for i, o := range n.Args() {
+			x, xBits, err := s.translate(o.AsExpr())
+			if err != nil {
+				return "", 0, err
+			}
+			if i == 0 {
+				str, nBits = x, xBits
+				continue
+			}
+			str, nBits, err = s.translateBinaryOp(bop, str, nBits, x, xBits)
+			if err != nil {
+				return "", 0, err
+			}
+		}
+		return str, nBits, nil
+	}
+
+	return s.translateOpaque(n)
+}
+
+func (s *smtScript) translateBinaryOp(op t.ID, l string, lBits int, r string, rBits int) (str string, nBits int, retErr error) {
+	fn := ""
+	switch op {
+	case t.IDXBinaryNotEq:
+		return fmt.Sprintf("(not (= %s %s))", l, r), 0, nil
+	case t.IDXBinaryLessThan:
+		return fmt.Sprintf("(bvslt %s %s)", l, r), 0, nil
+	case t.IDXBinaryLessEq:
+		return fmt.Sprintf("(bvsle %s %s)", l, r), 0, nil
+	case t.IDXBinaryEqEq:
+		return fmt.Sprintf("(= %s %s)", l, r), 0, nil
+	case t.IDXBinaryGreaterEq:
+		return fmt.Sprintf("(bvsge %s %s)", l, r), 0, nil
+	case t.IDXBinaryGreaterThan:
+		return fmt.Sprintf("(bvsgt %s %s)", l, r), 0, nil
+	case t.IDXBinaryAnd:
+		return fmt.Sprintf("(and %s %s)", l, r), 0, nil
+	case t.IDXBinaryOr:
+		return fmt.Sprintf("(or %s %s)", l, r), 0, nil
+
+	case t.IDXBinaryPlus:
+		fn, nBits = "bvadd", 1+maxInt(lBits, rBits)
+	case t.IDXBinaryMinus:
+		fn, nBits = "bvsub", 1+maxInt(lBits, rBits)
+	case t.IDXBinaryStar:
+		fn, nBits = "bvmul", lBits+rBits
+	case t.IDXBinarySlash:
+		// Division truncates towards zero, like Go's big.Int.Quo.
+		fn, nBits = "bvsdiv", lBits
+	case t.IDXBinaryPercent:
+		fn, nBits = "bvsrem", lBits
+	case t.IDXBinaryShiftL:
+		// The shift amount is less than (1 << rBits).
+		if rBits > 7 {
+			return "", 0, errNotTranslatable
+		}
+		fn, nBits = "bvshl", lBits+(1<<uint(rBits))-1
+	case t.IDXBinaryShiftR:
+		fn, nBits = "bvashr", lBits
+	case t.IDXBinaryAmp:
+		fn, nBits = "bvand", maxInt(lBits, rBits)
+	case t.IDXBinaryPipe:
+		fn, nBits = "bvor", maxInt(lBits, rBits)
+	case t.IDXBinaryHat:
+		fn, nBits = "bvxor", maxInt(lBits, rBits)
+	default:
+		return "", 0, errNotTranslatable
+	}
+	if nBits >= smtWidth-1 {
+		return "", 0, errNotTranslatable
+	}
+	return fmt.Sprintf("(%s %s %s)", fn, l, r), nBits, nil
+}
+
+// translateOpaque models n, an expression whose operator we don't translate
+// (such as a variable, a field or a method call), as an unknown value
+// constrained only by its type.
+func (s *smtScript) translateOpaque(n *a.Expr) (str string, nBits int, retErr error) {
+	typ := n.MType()
+	key := n.Str(s.q.tm)
+	name, seen := s.opaque[key]
+	if !seen {
+		name = fmt.Sprintf("v%d", len(s.opaque))
+	}
+
+	if typ.IsBool() {
+		if !seen {
+			s.opaque[key] = name
+			s.decls = append(s.decls, fmt.Sprintf("(declare-const %s Bool) ; %s", name, key))
+		}
+		return name, 0, nil
+	}
+
+	if !typ.IsNumType() {
+		return "", 0, errNotTranslatable
+	}
+	b, err := s.q.bcheckTypeExpr(typ)
+	if err != nil {
+		return "", 0, err
+	}
+	if !seen {
+		s.opaque[key] = name
+		s.decls = append(s.decls, fmt.Sprintf("(declare-const %s (_ BitVec %d)) ; %s", name, smtWidth, key))
+		s.asserts = append(s.asserts,
+			fmt.Sprintf("(bvsle %s %s)", smtConst(b[0]), name),
+			fmt.Sprintf("(bvsle %s %s)", name, smtConst(b[1])),
+		)
+	}
+	return name, bitLen(b), nil
+}
@@ -0,0 +1,306 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Reset funcs re-initialize part of a struct's state, such as between frames.
+// By convention, a func named "reset_foo" must assign every numeric or boolean
+// field of its receiver whose name starts with "foo_". It must do so on every
+// path to a return, directly or by calling other methods on this. ("reset"
+// itself is reserved for the generated C code.)
+//
+// Other fields, such as arrays or sub-structs, are not checked.
+
+// resetFields returns the fields that n, a reset func, must assign, in
+// declaration order. It returns nil if n is not a reset func.
+func (c *Checker) resetFields(n *a.Func) []t.ID {
+	name := n.FuncName().Str(c.tm)
+	if !strings.HasPrefix(name, "reset_") {
+		return nil
+	}
+	prefix := name[len("reset_"):] + "_"
+	s := c.structs[n.Receiver()]
+	if s == nil {
+		return nil
+	}
+	ret := []t.ID(nil)
+	for _, o := range s.Fields() {
+		o := o.AsField()
+		if typ := o.XType(); (typ.IsNumType() || typ.IsBool()) &&
+			strings.HasPrefix(o.Name().Str(c.tm), prefix) {
+			ret = append(ret, o.Name())
+		}
+	}
+	return ret
+}
+
+// unassignedResetField returns the first of n's resetFields that n does not
+// assign on every path, or zero if there is no such field.
+func (c *Checker) unassignedResetField(n *a.Func) (t.ID, error) {
+	fields := c.resetFields(n)
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	r := &rchecker{
+		c:     c,
+		exits: map[*a.Func]assigned{},
+	}
+	z, err := r.funcExit(n)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range fields {
+		if _, ok := z[f]; !ok {
+			return f, nil
+		}
+	}
+	return 0, nil
+}
+
+// checkFuncResetFields runs after checkNoRecursiveFuncs, as rchecker follows
+// method calls.
+func (c *Checker) checkFuncResetFields(node *a.Node) error {
+	if !c.opts.RequireResetFields {
+		return nil
+	}
+	n := node.AsFunc()
+	field, err := c.unassignedResetField(n)
+	if (err != nil) || (field == 0) {
+		return err
+	}
+	return &Error{
+		Err:      c.errUnassignedResetField(n, field),
+		Filename: n.Filename(),
+		Line:     n.Line(),
+		Col:      n.Col(),
+	}
+}
+
+func (c *Checker) errUnassignedResetField(n *a.Func, field t.ID) error {
+	return fmt.Errorf("check: reset func %s does not assign field %q on every path",
+		n.QQID().Str(c.tm), field.Str(c.tm))
+}
+
+// rchecker finds the fields of this that a func definitely assigns, on every
+// path through its body.
+type rchecker struct {
+	c *Checker
+
+	// exits maps a func to the fields definitely assigned when it returns.
+	exits map[*a.Func]assigned
+
+	// breaks maps a loop to the fields definitely assigned at every break out
+	// of that loop seen so far. exit is the meet of the fields definitely
+	// assigned at every return seen so far.
+	breaks map[a.Loop]assigned
+	exit   assigned
+}
+
+func (r *rchecker) funcExit(n *a.Func) (assigned, error) {
+	if z, ok := r.exits[n]; ok {
+		return z, nil
+	}
+
+	// Save the state of any caller, which is mid-way through its body.
+	oldBreaks, oldExit := r.breaks, r.exit
+	r.breaks, r.exit = map[a.Loop]assigned{}, nil
+	z, err := r.rcheckBlock(n.Body(), assigned{})
+	if err != nil {
+		return nil, err
+	}
+	z = meet(r.exit, z)
+	if z == nil {
+		// The func never returns.
+		z = assigned{}
+	}
+	r.breaks, r.exit = oldBreaks, oldExit
+
+	r.exits[n] = z
+	return z, nil
+}
+
+func (r *rchecker) rcheckBlock(block []*a.Node, z assigned) (assigned, error) {
+	for _, o := range block {
+		if z == nil {
+			// The rest of the block is unreachable.
+			break
+		}
+		var err error
+		if z, err = r.rcheckStatement(o, z); err != nil {
+			return nil, err
+		}
+	}
+	return z, nil
+}
+
+func (r *rchecker) rcheckStatement(n *a.Node, z assigned) (assigned, error) {
+	switch n.Kind() {
+	case a.KAssign:
+		n := n.AsAssign()
+		if err := r.rcheckCalls(n.RHS(), z); err != nil {
+			return nil, err
+		}
+		if (n.Operator() != t.IDEq) && (n.Operator() != t.IDEqQuestion) {
+			break
+		}
+		if lhs := n.LHS(); lhs == nil {
+			// No-op.
+		} else if lhs.Operator() == a.ExprOperatorList {
+			for _, o := range lhs.Args() {
+				r.rcheckAssignee(o.AsExpr(), z)
+			}
+		} else {
+			r.rcheckAssignee(lhs, z)
+		}
+
+	case a.KIf:
+		n := n.AsIf()
+		zTrue, err := r.rcheckBlock(n.BodyIfTrue(), z.clone())
+		if err != nil {
+			return nil, err
+		}
+		zFalse := z.clone()
+		if elseIf := n.ElseIf(); elseIf != nil {
+			zFalse, err = r.rcheckStatement(elseIf.AsNode(), zFalse)
+		} else {
+			zFalse, err = r.rcheckBlock(n.BodyIfFalse(), zFalse)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return meet(zTrue, zFalse), nil
+
+	case a.KIOManip:
+		return r.rcheckBlock(n.AsIOManip().Body(), z)
+
+	case a.KIterate:
+		// Each iterate body can run zero or more times.
+		for m := n.AsIterate(); m != nil; m = m.ElseIterate() {
+			if _, err := r.rcheckBlock(m.Body(), z.clone()); err != nil {
+				return nil, err
+			}
+		}
+
+	case a.KJump:
+		n := n.AsJump()
+		if n.Keyword() == t.IDBreak {
+			loop := n.JumpTarget()
+			if b, ok := r.breaks[loop]; ok {
+				r.breaks[loop] = meet(b, z)
+			} else {
+				r.breaks[loop] = z.clone()
+			}
+		}
+		return nil, nil
+
+	case a.KRet:
+		if n.AsRet().Keyword() == t.IDYield {
+			break
+		}
+		r.exit = meet(r.exit, z)
+		return nil, nil
+
+	case a.KSwitch:
+		ret := assigned(nil)
+		for _, o := range n.AsSwitch().Cases() {
+			zCase, err := r.rcheckBlock(o.AsCase().Body(), z.clone())
+			if err != nil {
+				return nil, err
+			}
+			ret = meet(ret, zCase)
+		}
+		return ret, nil
+
+	case a.KWhile:
+		n := n.AsWhile()
+		if _, err := r.rcheckBlock(n.Body(), z.clone()); err != nil {
+			return nil, err
+		}
+		if n.IsWhileTrue() {
+			// The loop can only be exited by a break.
+			b, hasBreak := r.breaks[n]
+			if !hasBreak {
+				return nil, nil
+			}
+			return b, nil
+		}
+	}
+	return z, nil
+}
+
+// rcheckAssignee marks n as assigned if it is a field of this, such as
+// "this.x".
+func (r *rchecker) rcheckAssignee(n *a.Expr, z assigned) {
+	if n.Operator() != a.ExprOperatorSelector {
+		return
+	}
+	if lhs := n.LHS().AsExpr(); (lhs.Operator() == 0) && (lhs.Ident() == t.IDThis) {
+		z[n.Ident()] = struct{}{}
+	}
+}
+
+// rcheckCalls marks the fields that any "this.foo()" method calls in n
+// definitely assign.
+func (r *rchecker) rcheckCalls(n *a.Expr, z assigned) error {
+	if n == nil {
+		return nil
+	}
+	return n.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		o1 := o.AsExpr()
+		if o1.Operator() != a.ExprOperatorCall {
+			return nil
+		}
+		callee := o1.LHS().AsExpr()
+		if recv := callee.LHS().AsExpr(); (recv.Operator() != 0) || (recv.Ident() != t.IDThis) {
+			return nil
+		}
+		f, err := r.c.resolveFunc(callee.MType())
+		if err != nil {
+			return err
+		}
+		zCallee, err := r.funcExit(f)
+		if err != nil {
+			return err
+		}
+		for k := range zCallee {
+			z[k] = struct{}{}
+		}
+		return nil
+	})
+}
+
+// lintResetFields warns about a reset func that does not assign all of its
+// fields. With Options.RequireResetFields, that is an error instead.
+func (c *Checker) lintResetFields(n *a.Func) ([]*Warning, error) {
+	if c.opts.RequireResetFields {
+		return nil, nil
+	}
+	field, err := c.unassignedResetField(n)
+	if (err != nil) || (field == 0) {
+		return nil, err
+	}
+	return []*Warning{{
+		Err:      c.errUnassignedResetField(n, field),
+		Filename: n.Filename(),
+		Line:     n.Line(),
+		Col:      n.Col(),
+	}}, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Rule is a proof rule implemented in Go, for domain-specific reasoning (such
+// as about Huffman code lengths) that the built-in axioms do not cover. Like
+// an axiom, it is invoked by an assert's "via" clause:
+//
+//	assert n < 320 via "huffman: n < 320"(lengths: this.code_lengths[..])
+//
+// It returns nil if it proves r.Goal, and an error otherwise. Like an axiom,
+// a Rule is assumed, not proved, by the Wuffs toolchain, so it must only
+// accept goals that actually hold.
+type Rule func(r *RuleRequest) error
+
+// RuleRequest is what a Rule is given: the goal to prove and the facts that
+// are known at the assert.
+type RuleRequest struct {
+	TMap *t.Map
+	// Goal is the assert's condition, such as "n < 320".
+	Goal *a.Expr
+	// Args are the via clause's arguments, such as "lengths:
+	// this.code_lengths[..]". They have been type and bounds checked.
+	Args []*a.Arg
+	// Facts are the facts known just before the assert.
+	Facts []*a.Expr
+
+	q *checker
+}
+
+// Arg returns the value of the via clause's argument with the given name, or
+// nil if there is no such argument.
+func (r *RuleRequest) Arg(name string) *a.Expr {
+	if x := r.TMap.ByName(name); x != 0 {
+		for _, o := range r.Args {
+			if o.Name() == x {
+				return o.Value()
+			}
+		}
+	}
+	return nil
+}
+
+// ProveBinaryOp returns nil if the built-in reasoning proves "lhs op rhs",
+// where op is an XBinaryOp comparison such as t.IDXBinaryLessThan, from the
+// facts and the bounds of lhs and rhs. A Rule can use it to discharge its
+// premises.
+func (r *RuleRequest) ProveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
+	return proveReasonRequirement(r.q, op, lhs, rhs)
+}
+
+var (
+	registeredRulesMutex sync.Mutex
+	registeredRules      = map[string]Rule{}
+)
+
+// RegisterRule registers a Rule under a name, such as "huffman: n < 320",
+// which an assert's via clause gives as a string literal. It is typically
+// called from an init function, in a package that a build of the Wuffs tools
+// imports for its side effects. It panics if the name is invalid, is already
+// registered or is that of a built-in axiom.
+func RegisterRule(name string, rule Rule) {
+	if (name == "") || strings.ContainsAny(name, "\"\\\n") {
+		panic(fmt.Sprintf("check: RegisterRule: invalid name %q", name))
+	} else if rule == nil {
+		panic(fmt.Sprintf("check: RegisterRule: nil rule for %q", name))
+	}
+	for _, r := range reasons {
+		if r.s == `"`+name+`"` {
+			panic(fmt.Sprintf("check: RegisterRule: %q is a built-in axiom", name))
+		}
+	}
+
+	registeredRulesMutex.Lock()
+	defer registeredRulesMutex.Unlock()
+	if _, ok := registeredRules[name]; ok {
+		panic(fmt.Sprintf("check: RegisterRule: %q is already registered", name))
+	}
+	registeredRules[name] = rule
+}
+
+// registeredRuleNames returns the names of the registered rules, sorted.
+func registeredRuleNames() []string {
+	registeredRulesMutex.Lock()
+	defer registeredRulesMutex.Unlock()
+	ret := make([]string, 0, len(registeredRules))
+	for name := range registeredRules {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// addRegisteredRules adds the registered rules that tm's source code mentions
+// to m.
+func addRegisteredRules(m reasonMap, tm *t.Map) {
+	registeredRulesMutex.Lock()
+	defer registeredRulesMutex.Unlock()
+	for name, rule := range registeredRules {
+		if id := tm.ByName(`"` + name + `"`); id != 0 {
+			m[id] = rule.reason()
+		}
+	}
+}
+
+func (rule Rule) reason() reason {
+	return func(q *checker, n *a.Assert) error {
+		args := make([]*a.Arg, 0, len(n.Args()))
+		for _, o := range n.Args() {
+			args = append(args, o.AsArg())
+		}
+		return rule(&RuleRequest{
+			TMap:  q.tm,
+			Goal:  n.Condition(),
+			Args:  args,
+			Facts: append([]*a.Expr(nil), q.facts...),
+			q:     q,
+		})
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// With Options.ConstantTime, secret values, those of struct fields and func
+// arguments declared "secret" and those computed from them, must not affect
+// which instructions run or which memory addresses are accessed. Concretely,
+// they cannot be branched on (including by the short-circuiting "and" and
+// "or" operators), used as an index or slice bound or used as an operand of
+// division, whose run time can depend on its operands. They also cannot flow
+// into fields or arguments that are not declared secret, as code that uses
+// those is not checked, or into built-in funcs other than those listed by
+// constantTimeBuiltIn.
+//
+// The analysis is flow insensitive: a local variable is secret if any value
+// assigned to it is. A slice's length, unlike its elements, is never secret.
+
+// ctchecker tracks which of a func's local variables hold secret values.
+type ctchecker struct {
+	c      *Checker
+	f      *a.Func
+	fields map[t.ID]bool
+	vars   map[t.ID]bool
+}
+
+func (c *Checker) newCTChecker(f *a.Func) *ctchecker {
+	s := &ctchecker{
+		c:      c,
+		f:      f,
+		fields: map[t.ID]bool{},
+		vars:   map[t.ID]bool{},
+	}
+	if st := c.structs[f.Receiver()]; (st != nil) && (f.Receiver()[0] == 0) {
+		for _, o := range st.Fields() {
+			if o.AsField().Secret() {
+				s.fields[o.AsField().Name()] = true
+			}
+		}
+	}
+
+	// Gather the assignments to local variables, or through them for slices
+	// and I/O buffers.
+	type assign struct {
+		name t.ID
+		rhs  *a.Expr
+	}
+	assigns := []assign(nil)
+	for _, o := range f.Body() {
+		o.Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KAssign:
+				o := o.AsAssign()
+				if name := localRoot(o.LHS()); name != 0 {
+					assigns = append(assigns, assign{name, o.RHS()})
+				}
+			case a.KIOManip:
+				o := o.AsIOManip()
+				if name := localRoot(o.IO()); (name != 0) && (o.Arg1() != nil) {
+					assigns = append(assigns, assign{name, o.Arg1()})
+				}
+			}
+			return nil
+		})
+	}
+
+	// Iterate to a fixed point, as one variable can be assigned from another.
+	for changed := true; changed; {
+		changed = false
+		for _, o := range assigns {
+			if !s.vars[o.name] && s.exprSecret(o.rhs) {
+				s.vars[o.name] = true
+				changed = true
+			}
+		}
+	}
+	return s
+}
+
+// localRoot returns the name of the local variable that n, such as "x" or
+// "s[i]", is rooted in, or zero if it is rooted in this or args.
+func localRoot(n *a.Expr) t.ID {
+	for ; n != nil; n = n.LHS().AsExpr() {
+		switch n.Operator() {
+		case 0:
+			if (n.Ident() == t.IDThis) || (n.Ident() == t.IDArgs) {
+				return 0
+			}
+			return n.Ident()
+		case a.ExprOperatorSelector, a.ExprOperatorIndex, a.ExprOperatorSlice:
+			// No-op.
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// fieldSecret returns whether "recv.name" is a secret field or argument, and
+// whether that is known (for example, recv could be a local variable).
+func (s *ctchecker) fieldSecret(recv *a.Expr, name t.ID) (secret bool, known bool) {
+	if recv.Operator() == 0 {
+		switch recv.Ident() {
+		case t.IDThis:
+			return s.fields[name], true
+		case t.IDArgs:
+			return paramSecret(s.f, name), true
+		}
+	}
+	typ := recv.MType()
+	if typ.IsPointerType() {
+		typ = typ.Inner()
+	}
+	if st := s.c.structs[typ.QID()]; st != nil {
+		for _, o := range st.Fields() {
+			if o.AsField().Name() == name {
+				return o.AsField().Secret(), true
+			}
+		}
+	}
+	return false, false
+}
+
+// paramSecret returns whether f's argument with the given name is secret.
+func paramSecret(f *a.Func, name t.ID) bool {
+	if in := f.In(); in != nil {
+		for _, o := range in.Fields() {
+			if o.AsField().Name() == name {
+				return o.AsField().Secret()
+			}
+		}
+	}
+	return false
+}
+
+func (s *ctchecker) exprSecret(n *a.Expr) bool {
+	if (n == nil) || (n.ConstValue() != nil) {
+		return false
+	}
+	switch n.Operator() {
+	case 0:
+		return s.vars[n.Ident()]
+	case a.ExprOperatorSelector:
+		if secret, known := s.fieldSecret(n.LHS().AsExpr(), n.Ident()); known {
+			return secret
+		}
+		return s.exprSecret(n.LHS().AsExpr())
+	case a.ExprOperatorCall:
+		return s.callSecret(n)
+	case t.IDXBinaryAs:
+		return s.exprSecret(n.LHS().AsExpr())
+	}
+
+	if s.exprSecret(n.LHS().AsExpr()) || s.exprSecret(n.MHS().AsExpr()) || s.exprSecret(n.RHS().AsExpr()) {
+		return true
+	}
+	for _, o := range n.Args() {
+		if (o.Kind() == a.KExpr) && s.exprSecret(o.AsExpr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// callSecret returns whether the result of the call n is secret: whether its
+// receiver or any argument is, or whether the callee returns a secret value
+// regardless of its arguments, such as a method returning a secret field.
+func (s *ctchecker) callSecret(n *a.Expr) bool {
+	callee := n.LHS().AsExpr()
+	if callee.Ident() == t.IDLength {
+		return false
+	}
+	if s.exprSecret(callee.LHS().AsExpr()) {
+		return true
+	}
+	for _, o := range n.Args() {
+		if s.exprSecret(o.AsArg().Value()) {
+			return true
+		}
+	}
+	f, err := s.c.resolveFunc(callee.MType())
+	return (err == nil) && s.c.funcReturnsSecret(f)
+}
+
+// funcReturnsSecret returns whether f, a func in this package, can return a
+// secret value even if its arguments are not secret.
+func (c *Checker) funcReturnsSecret(f *a.Func) bool {
+	if ret, ok := c.cachedFuncReturnsSecret[f]; ok {
+		return ret
+	}
+	// A recursive call chain, which checkNoRecursiveFuncs rejects, is treated
+	// as not returning a secret value.
+	c.cachedFuncReturnsSecret[f] = false
+
+	ret := false
+	if f.Receiver()[0] == 0 {
+		s := c.newCTChecker(f)
+		for _, o := range f.Body() {
+			o.Walk(func(o *a.Node) error {
+				if (o.Kind() == a.KRet) && s.exprSecret(o.AsRet().Value()) {
+					ret = true
+				}
+				return nil
+			})
+		}
+	}
+	c.cachedFuncReturnsSecret[f] = ret
+	return ret
+}
+
+// checkFuncConstantTime checks, with Options.ConstantTime, that the func's
+// run time and memory access pattern do not depend on secret values.
+func (c *Checker) checkFuncConstantTime(node *a.Node) error {
+	if !c.opts.ConstantTime {
+		return nil
+	}
+	s := c.newCTChecker(node.AsFunc())
+	return s.checkBlock(node.AsFunc().Body())
+}
+
+func (s *ctchecker) checkBlock(block []*a.Node) error {
+	for _, o := range block {
+		if err := s.checkStatement(o); err != nil {
+			filename, line := o.AsRaw().FilenameLine()
+			col := o.AsRaw().Col()
+			if _, ok := err.(*Error); ok {
+				return err
+			}
+			return &Error{
+				Err:      err,
+				Filename: filename,
+				Line:     line,
+				Col:      col,
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ctchecker) checkStatement(n *a.Node) error {
+	switch n.Kind() {
+	case a.KAssign:
+		n := n.AsAssign()
+		if err := s.checkExpr(n.RHS()); err != nil {
+			return err
+		}
+		if lhs := n.LHS(); lhs != nil {
+			if err := s.checkExpr(lhs); err != nil {
+				return err
+			}
+			if op := n.Operator(); (op == t.IDSlashEq) || (op == t.IDPercentEq) {
+				if err := s.checkDivision(lhs, n.RHS()); err != nil {
+					return err
+				}
+			}
+			return s.checkFlow(n.RHS(), lhs)
+		}
+
+	case a.KIOManip:
+		n := n.AsIOManip()
+		for _, o := range [...]*a.Expr{n.IO(), n.Arg1(), n.HistoryPosition()} {
+			if err := s.checkExpr(o); err != nil {
+				return err
+			}
+		}
+		if arg1 := n.Arg1(); arg1 != nil {
+			if err := s.checkFlow(arg1, n.IO()); err != nil {
+				return err
+			}
+		}
+		return s.checkBlock(n.Body())
+
+	case a.KIf:
+		for n := n.AsIf(); n != nil; n = n.ElseIf() {
+			if err := s.checkCondition(n.Condition(), "if"); err != nil {
+				return err
+			}
+			if err := s.checkBlock(n.BodyIfTrue()); err != nil {
+				return err
+			}
+			if err := s.checkBlock(n.BodyIfFalse()); err != nil {
+				return err
+			}
+		}
+
+	case a.KIterate:
+		for n := n.AsIterate(); n != nil; n = n.ElseIterate() {
+			if err := s.checkBlock(n.Assigns()); err != nil {
+				return err
+			}
+			if err := s.checkBlock(n.Body()); err != nil {
+				return err
+			}
+		}
+
+	case a.KRet:
+		return s.checkExpr(n.AsRet().Value())
+
+	case a.KSwitch:
+		n := n.AsSwitch()
+		if err := s.checkCondition(n.Subject(), "switch on"); err != nil {
+			return err
+		}
+		for _, o := range n.Cases() {
+			if err := s.checkBlock(o.AsCase().Body()); err != nil {
+				return err
+			}
+		}
+
+	case a.KWhile:
+		n := n.AsWhile()
+		if err := s.checkCondition(n.Condition(), "while"); err != nil {
+			return err
+		}
+		return s.checkBlock(n.Body())
+	}
+	return nil
+}
+
+// checkCondition checks an if, switch or while statement's condition.
+func (s *ctchecker) checkCondition(n *a.Expr, keyword string) error {
+	if err := s.checkExpr(n); err != nil {
+		return err
+	}
+	if s.exprSecret(n) {
+		return fmt.Errorf("check: constant-time: cannot %s %q, which depends on a secret value",
+			keyword, n.Str(s.c.tm))
+	}
+	return nil
+}
+
+// checkFlow checks that assigning rhs to lhs does not make a secret value
+// flow into a non-secret field or argument.
+func (s *ctchecker) checkFlow(rhs *a.Expr, lhs *a.Expr) error {
+	if !s.exprSecret(rhs) || (localRoot(lhs) != 0) {
+		return nil
+	}
+	for n := lhs; n != nil; n = n.LHS().AsExpr() {
+		if n.Operator() != a.ExprOperatorSelector {
+			continue
+		}
+		if secret, known := s.fieldSecret(n.LHS().AsExpr(), n.Ident()); known && !secret {
+			return fmt.Errorf("check: constant-time: cannot assign %q, which depends on a secret value, "+
+				"to %q, which is not secret", rhs.Str(s.c.tm), lhs.Str(s.c.tm))
+		} else if known {
+			break
+		}
+	}
+	return nil
+}
+
+// checkDivision checks that neither operand of "x / y" or "x % y" (or their
+// assignment forms) is secret.
+func (s *ctchecker) checkDivision(x *a.Expr, y *a.Expr) error {
+	for _, o := range [...]*a.Expr{x, y} {
+		if s.exprSecret(o) {
+			return fmt.Errorf("check: constant-time: cannot divide with %q, which depends on a secret value",
+				o.Str(s.c.tm))
+		}
+	}
+	return nil
+}
+
+// constantTimeBuiltIn returns whether f, a built-in func, is assumed to run
+// in constant time, and without secret-dependent memory accesses, regardless
+// of its receiver's and arguments' values. cgen implements the numeric types'
+// high_bits and low_bits and the utility.sign_extend_etc funcs with shifts
+// and masks. It implements min and max as "x < y ? x : y", which mainstream
+// compilers turn into a conditional move instead of a branch, although C does
+// not guarantee that. Lengths are not secret.
+func constantTimeBuiltIn(f *a.Func, tm *t.Map) bool {
+	switch name := f.FuncName(); name {
+	case t.IDLength:
+		return true
+	case t.IDHighBits, t.IDLowBits, t.IDMax, t.IDMin:
+		return f.Receiver()[1].IsNumType()
+	default:
+		return (f.Receiver()[1] == t.IDUtility) && strings.HasPrefix(name.Str(tm), "sign_extend_")
+	}
+}
+
+// checkExpr checks that n does not index, slice, divide or short-circuit on a
+// secret value, or pass one as a non-secret argument.
+func (s *ctchecker) checkExpr(n *a.Expr) error {
+	if n == nil {
+		return nil
+	}
+	return n.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		o1 := o.AsExpr()
+		switch o1.Operator() {
+		case a.ExprOperatorIndex, a.ExprOperatorSlice:
+			for _, x := range [...]*a.Expr{o1.MHS().AsExpr(), o1.RHS().AsExpr()} {
+				if s.exprSecret(x) {
+					return fmt.Errorf("check: constant-time: cannot index %q with %q, which depends on a secret value",
+						o1.LHS().AsExpr().Str(s.c.tm), x.Str(s.c.tm))
+				}
+			}
+
+		case t.IDXBinarySlash, t.IDXBinaryPercent:
+			return s.checkDivision(o1.LHS().AsExpr(), o1.RHS().AsExpr())
+
+		case t.IDXBinaryAnd, t.IDXBinaryOr:
+			if x := o1.LHS().AsExpr(); s.exprSecret(x) {
+				return fmt.Errorf("check: constant-time: cannot short-circuit on %q, which depends on a secret value",
+					x.Str(s.c.tm))
+			}
+
+		case t.IDXAssociativeAnd, t.IDXAssociativeOr:
+			for _, x := range o1.Args()[:len(o1.Args())-1] {
+				if s.exprSecret(x.AsExpr()) {
+					return fmt.Errorf("check: constant-time: cannot short-circuit on %q, which depends on a secret value",
+						x.AsExpr().Str(s.c.tm))
+				}
+			}
+
+		case a.ExprOperatorCall:
+			f, err := s.c.resolveFunc(o1.LHS().AsExpr().MType())
+			if err != nil {
+				return nil
+			} else if f.Receiver()[0] == t.IDBase {
+				if constantTimeBuiltIn(f, s.c.tm) || !s.exprSecret(o1) {
+					return nil
+				}
+				return fmt.Errorf("check: constant-time: cannot call %q, which depends on a secret value, "+
+					"as %s is not known to be constant-time", o1.Str(s.c.tm), f.QQID().Str(s.c.tm))
+			}
+			for _, x := range o1.Args() {
+				arg := x.AsArg()
+				if !paramSecret(f, arg.Name()) && s.exprSecret(arg.Value()) {
+					return fmt.Errorf("check: constant-time: cannot pass %q, which depends on a secret value, "+
+						"as %s's non-secret argument %q", arg.Value().Str(s.c.tm), f.QQID().Str(s.c.tm),
+						arg.Name().Str(s.c.tm))
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,286 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// statusKinds is the set of kinds (ok, note, suspension or error) that a
+// base.status value can have. These sets form a lattice, ordered by inclusion,
+// whose join is set union and whose top, statusKindsAny, means that nothing is
+// known about the value.
+type statusKinds uint8
+
+const (
+	statusKindOK = statusKinds(1 << iota)
+	statusKindNote
+	statusKindSuspension
+	statusKindError
+
+	statusKindsAny = statusKindOK | statusKindNote | statusKindSuspension | statusKindError
+)
+
+func (k statusKinds) String() string {
+	if k == 0 {
+		return "none"
+	}
+	s := []string(nil)
+	for i, name := range [...]string{"ok", "note", "suspension", "error"} {
+		if k&(1<<uint(i)) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+// literalStatusKinds returns the kind of the status literal id, such as
+// "#bad header" or "$short read", or zero if id is not a status literal.
+func literalStatusKinds(id t.ID, tm *t.Map) statusKinds {
+	if id == t.IDOk {
+		return statusKindOK
+	}
+	if s := id.Str(tm); (len(s) >= 2) && (s[0] == '"') {
+		switch s[1] {
+		case '@':
+			return statusKindNote
+		case '$':
+			return statusKindSuspension
+		case '#':
+			return statusKindError
+		}
+	}
+	return 0
+}
+
+// funcStatusKinds returns the kinds of status that calling f can produce.
+//
+// A coroutine's "?" effect declares that it can produce any status: even if
+// its current body never suspends, a later version might. A non-coroutine's
+// kinds are inferred from its return statements, except that funcs without a
+// body, such as built-in or other packages' funcs, are assumed to produce any
+// status but a suspension. The runtime turns a suspension returned from a
+// non-coroutine into an error.
+func (c *Checker) funcStatusKinds(f *a.Func) (statusKinds, error) {
+	if f.Effect().Coroutine() {
+		return statusKindsAny, nil
+	} else if k, ok := c.cachedFuncStatusKinds[f]; ok {
+		return k, nil
+	} else if f.Receiver()[0] != 0 {
+		return statusKindsAny &^ statusKindSuspension, nil
+	}
+
+	s, err := c.newSChecker(f)
+	if err != nil {
+		return 0, err
+	}
+	ret := statusKinds(0)
+	if !a.Terminates(f.Body()) {
+		ret |= statusKindOK
+	}
+	for _, o := range f.Body() {
+		if err := o.Walk(func(o *a.Node) error {
+			if o.Kind() == a.KRet {
+				k, err := s.exprStatusKinds(o.AsRet().Value())
+				if err != nil {
+					return err
+				}
+				ret |= k
+			}
+			return nil
+		}); err != nil {
+			return 0, err
+		}
+	}
+	c.cachedFuncStatusKinds[f] = ret
+	return ret, nil
+}
+
+// schecker tracks the statusKinds of a func's base.status local variables.
+// It is flow insensitive: a variable's kinds are the join of those of every
+// value assigned to it, including its initial ok value.
+type schecker struct {
+	c    *Checker
+	vars map[t.ID]statusKinds
+}
+
+func (c *Checker) newSChecker(f *a.Func) (*schecker, error) {
+	s := &schecker{
+		c:    c,
+		vars: map[t.ID]statusKinds{},
+	}
+	assigns := []*a.Assign(nil)
+	for _, o := range f.Body() {
+		if o.Kind() == a.KVar {
+			if o := o.AsVar(); o.XType().IsStatus() {
+				s.vars[o.Name()] = statusKindOK
+			}
+			continue
+		}
+		o.Walk(func(o *a.Node) error {
+			if o.Kind() != a.KAssign {
+				return nil
+			}
+			o1 := o.AsAssign()
+			if lhs := o1.LHS(); (lhs != nil) && (lhs.Operator() == 0) {
+				if _, ok := s.vars[lhs.Ident()]; ok {
+					assigns = append(assigns, o1)
+				}
+			}
+			return nil
+		})
+	}
+
+	// Iterate to a fixed point, as one variable can be assigned from another.
+	for changed := true; changed; {
+		changed = false
+		for _, o := range assigns {
+			k, err := s.exprStatusKinds(o.RHS())
+			if err != nil {
+				return nil, err
+			}
+			id := o.LHS().Ident()
+			if k|s.vars[id] != s.vars[id] {
+				s.vars[id] |= k
+				changed = true
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *schecker) exprStatusKinds(n *a.Expr) (statusKinds, error) {
+	switch n.Operator() {
+	case 0:
+		if k := literalStatusKinds(n.Ident(), s.c.tm); k != 0 {
+			return k, nil
+		} else if k, ok := s.vars[n.Ident()]; ok {
+			return k, nil
+		}
+	case a.ExprOperatorSelector:
+		// For example, base."$short read" or otherpkg."#bad header".
+		if k := literalStatusKinds(n.Ident(), s.c.tm); k != 0 {
+			return k, nil
+		}
+	case a.ExprOperatorCall:
+		f, err := s.c.resolveFunc(n.LHS().AsExpr().MType())
+		if err != nil {
+			return 0, err
+		}
+		return s.c.funcStatusKinds(f)
+	}
+	return statusKindsAny, nil
+}
+
+// checkFuncStatuses checks that every yield can suspend, so that the
+// coroutine can later resume, and that no return is of a suspension, which
+// cannot be resumed. It runs after checkNoRecursiveFuncs, as funcStatusKinds
+// follows calls.
+func (c *Checker) checkFuncStatuses(node *a.Node) error {
+	n := node.AsFunc()
+	if !n.Effect().Coroutine() && ((n.Out() == nil) || !n.Out().IsStatus()) {
+		return nil
+	}
+	s, err := c.newSChecker(n)
+	if err != nil {
+		return err
+	}
+	for _, o := range n.Body() {
+		if err := o.Walk(func(o *a.Node) error {
+			if o.Kind() != a.KRet {
+				return nil
+			}
+			value := o.AsRet().Value()
+			k, err := s.exprStatusKinds(value)
+			if err != nil {
+				return err
+			}
+			if err = c.errFuncStatus(n, o.AsRet(), k); err == nil {
+				return nil
+			}
+			filename, line := o.AsRaw().FilenameLine()
+			col := o.AsRaw().Col()
+			return &Error{
+				Err:      err,
+				Filename: filename,
+				Line:     line,
+				Col:      col,
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Checker) errFuncStatus(n *a.Func, r *a.Ret, k statusKinds) error {
+	value := r.Value()
+	if r.Keyword() == t.IDYield {
+		if k&statusKindSuspension == 0 {
+			return fmt.Errorf("check: cannot yield %q, whose status kinds (%s) exclude suspension",
+				value.Str(c.tm), k)
+		}
+	} else if !n.Effect().Coroutine() {
+		if k&statusKindSuspension != 0 {
+			return fmt.Errorf("check: cannot return %q, which can be a suspension, from non-coroutine func %s",
+				value.Str(c.tm), n.QQID().Str(c.tm))
+		}
+	} else if k == statusKindSuspension {
+		return fmt.Errorf("check: cannot return %q, which is always a suspension; use yield instead",
+			value.Str(c.tm))
+	}
+	return nil
+}
+
+// lintDiscardedStatuses warns about calls to non-coroutine funcs that return a
+// status, which can be an error, when that status is discarded. A "?" call's
+// error, in comparison, is propagated unless it is assigned with "=?".
+func (c *Checker) lintDiscardedStatuses(n *a.Func) ([]*Warning, error) {
+	ws := []*Warning(nil)
+	for _, o := range n.Body() {
+		if err := o.Walk(func(o *a.Node) error {
+			if o.Kind() != a.KAssign {
+				return nil
+			}
+			call := o.AsAssign().RHS()
+			if (o.AsAssign().LHS() != nil) || (call.Operator() != a.ExprOperatorCall) ||
+				call.Effect().Coroutine() || !call.MType().IsStatus() {
+				return nil
+			}
+			f, err := c.resolveFunc(call.LHS().AsExpr().MType())
+			if err != nil {
+				return err
+			}
+			if k, err := c.funcStatusKinds(f); err != nil {
+				return err
+			} else if k&statusKindError == 0 {
+				return nil
+			}
+			filename, line := o.AsRaw().FilenameLine()
+			col := o.AsRaw().Col()
+			ws = append(ws, &Warning{
+				Err: fmt.Errorf("check: status from %s, which can be an error, is discarded",
+					f.QQID().Str(c.tm)),
+				Filename: filename,
+				Line:     line,
+				Col:      col,
+			})
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return ws, nil
+}
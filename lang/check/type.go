@@ -14,6 +14,8 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/google/wuffs/lang/ast/eval"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -74,6 +76,7 @@ func (q *checker) tcheckVars(cab cpuArchBits, block []*a.Node) error {
 		}
 
 		q.errFilename, q.errLine = o.AsRaw().FilenameLine()
+		q.errCol = o.AsRaw().Col()
 
 		o := o.AsVar()
 		name := o.Name()
@@ -84,6 +87,7 @@ func (q *checker) tcheckVars(cab cpuArchBits, block []*a.Node) error {
 				Err:      fmt.Errorf("check: var %q shadows top level name", name.Str(q.tm)),
 				Filename: o.Filename(),
 				Line:     o.Line(),
+				Col:      o.Col(),
 			}
 		}
 		if err := q.tcheckTypeExpr(o.XType(), 0); err != nil {
@@ -99,6 +103,7 @@ func (q *checker) tcheckVars(cab cpuArchBits, block []*a.Node) error {
 
 func (q *checker) tcheckStatement(n *a.Node) error {
 	q.errFilename, q.errLine = n.AsRaw().FilenameLine()
+	q.errCol = n.AsRaw().Col()
 
 	switch n.Kind() {
 	case a.KAssert:
@@ -229,8 +234,22 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 	case a.KJump:
 		// No-op.
 
+	case a.KSwitch:
+		if err := q.tcheckSwitch(n.AsSwitch()); err != nil {
+			return err
+		}
+
 	case a.KRet:
 		n := n.AsRet()
+		if outs := q.astFunc.Outs(); outs != nil {
+			if err := q.tcheckRetMultiple(n, outs); err != nil {
+				return err
+			}
+			break
+		} else if n.Value().Operator() == a.ExprOperatorList {
+			return fmt.Errorf("check: cannot return multiple values %q from func %s",
+				n.Value().Str(q.tm), q.astFunc.QQID().Str(q.tm))
+		}
 		lTyp := q.astFunc.Out()
 		if q.astFunc.Effect().Coroutine() {
 			lTyp = typeExprStatus
@@ -238,6 +257,11 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			lTyp = typeExprEmptyStruct
 		}
 		value := n.Value()
+		if n.HasErrorKeyword() && !lTyp.IsStatus() {
+			return fmt.Errorf("check: cannot return error %s from func %s, which does not return a status",
+				value.Str(q.tm), q.astFunc.QQID().Str(q.tm))
+		}
+		q.markIdealShifts(value, lTyp)
 		if err := q.tcheckExpr(value, 0); err != nil {
 			return err
 		}
@@ -295,6 +319,52 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 	return nil
 }
 
+func (q *checker) tcheckSwitch(n *a.Switch) error {
+	subject := n.Subject()
+	if subject.Effect() != 0 {
+		return fmt.Errorf("check: internal error: switch subject is not effect-free")
+	}
+	if err := q.tcheckExpr(subject, 0); err != nil {
+		return err
+	}
+	sTyp := subject.MType()
+	if !sTyp.IsNumType() {
+		return fmt.Errorf("check: switch subject %q, of type %q, does not have an integer type",
+			subject.Str(q.tm), sTyp.Str(q.tm))
+	}
+
+	seen := map[string]bool{}
+	for _, o := range n.Cases() {
+		o := o.AsCase()
+		for _, v := range o.Values() {
+			v := v.AsExpr()
+			if err := q.tcheckExpr(v, 0); err != nil {
+				return err
+			}
+			cv := v.ConstValue()
+			if cv == nil {
+				return fmt.Errorf("check: case value %q is not a constant", v.Str(q.tm))
+			}
+			if vTyp := v.MType(); !vTyp.IsIdeal() && !sTyp.EqIgnoringRefinements(vTyp) {
+				return fmt.Errorf("check: case value %q, of type %q, does not match switch subject %q, of type %q",
+					v.Str(q.tm), vTyp.Str(q.tm), subject.Str(q.tm), sTyp.Str(q.tm))
+			}
+			if key := cv.String(); seen[key] {
+				return fmt.Errorf("check: duplicate case value %s", key)
+			} else {
+				seen[key] = true
+			}
+		}
+		for _, b := range o.Body() {
+			if err := q.tcheckStatement(b); err != nil {
+				return err
+			}
+		}
+		setPlaceholderMBoundsMType(o.AsNode())
+	}
+	return nil
+}
+
 func (q *checker) tcheckFuncAssert(n *a.Assert) error {
 	if n.IsChooseCPUArch() {
 		cond := n.Condition()
@@ -303,6 +373,10 @@ func (q *checker) tcheckFuncAssert(n *a.Assert) error {
 		cond.RHS().AsExpr().SetMType(typeExprU32)
 		return nil
 	}
+	switch n.Keyword() {
+	case t.IDPre, t.IDPost:
+		return q.tcheckFuncContractAssert(n)
+	}
 	return fmt.Errorf("check: function assertions are not supported yet")
 }
 
@@ -337,18 +411,100 @@ func (q *checker) tcheckEq(lID t.ID, lhs *a.Expr, lTyp *a.TypeExpr, rhs *a.Expr,
 	} else if lhs != nil {
 		lStr = lhs.Str(q.tm)
 	}
-	return fmt.Errorf("check: cannot assign %q of type %q to %q of type %q",
-		rhs.Str(q.tm), rTyp.Str(q.tm), lStr, lTyp.Str(q.tm))
+	return fmt.Errorf("check: cannot assign %q of type %q to %q of type %q%s",
+		rhs.Str(q.tm), rTyp.Str(q.tm), lStr, lTyp.Str(q.tm), conversionHint(q.tm, rhs, lTyp))
+}
+
+func (q *checker) tcheckRetMultiple(n *a.Ret, outs *a.Struct) error {
+	value := n.Value()
+	if n.HasErrorKeyword() {
+		return fmt.Errorf("check: cannot return error %s from func %s, which does not return a status",
+			value.Str(q.tm), q.astFunc.QQID().Str(q.tm))
+	}
+	fields := outs.Fields()
+	if (value.Operator() != a.ExprOperatorList) || (len(value.Args()) != len(fields)) {
+		return fmt.Errorf("check: func %s returns %d values, cannot return %q",
+			q.astFunc.QQID().Str(q.tm), len(fields), value.Str(q.tm))
+	}
+	for i, o := range value.Args() {
+		o := o.AsExpr()
+		if err := q.tcheckExpr(o, 0); err != nil {
+			return err
+		}
+		f := fields[i].AsField()
+		if err := q.tcheckEq(f.Name(), nil, f.XType(), o, o.MType()); err != nil {
+			return err
+		}
+	}
+	// The list Expr itself has no value of its own.
+	value.SetMBounds(bounds{zero, zero})
+	value.SetMType(typeExprEmptyStruct)
+	return nil
+}
+
+// tcheckAssignMultiple checks "x, y = etc", assigning a func call's multiple
+// return values.
+func (q *checker) tcheckAssignMultiple(n *a.Assign) error {
+	lhs, rhs := n.LHS(), n.RHS()
+	f, err := q.c.resolveFunc(rhs.LHS().AsExpr().MType())
+	if err != nil {
+		return err
+	}
+	outs := f.Outs()
+	if outs == nil {
+		return fmt.Errorf("check: %q does not return multiple values", rhs.Str(q.tm))
+	} else if len(outs.Fields()) != len(lhs.Args()) {
+		return fmt.Errorf("check: %q returns %d values but %d were assigned",
+			rhs.Str(q.tm), len(outs.Fields()), len(lhs.Args()))
+	}
+	for i, o := range lhs.Args() {
+		o := o.AsExpr()
+		if err := q.tcheckExpr(o, 0); err != nil {
+			return err
+		}
+		for l := o; l != nil; l = l.LHS().AsExpr() {
+			if l.Operator() != t.IDOpenBracket {
+				// No-op.
+			} else if lTyp := l.LHS().MType(); lTyp.IsRecursivelyReadOnly() {
+				return fmt.Errorf("check: assignment %q: assignee fragment %q, of type %q, has read-only type",
+					n.Operator().Str(q.tm), l.LHS().AsExpr().Str(q.tm), lTyp.Str(q.tm))
+			}
+		}
+		f := outs.Fields()[i].AsField()
+		if !o.MType().EqIgnoringRefinementsLHSReadOnly(f.XType()) {
+			return fmt.Errorf("check: cannot assign %q's %q of type %q to %q of type %q",
+				rhs.Str(q.tm), f.Name().Str(q.tm), f.XType().Str(q.tm), o.Str(q.tm), o.MType().Str(q.tm))
+		}
+	}
+	// The list Expr itself has no value of its own.
+	lhs.SetMBounds(bounds{zero, zero})
+	lhs.SetMType(typeExprEmptyStruct)
+	return nil
 }
 
 func (q *checker) tcheckAssign(n *a.Assign) error {
 	rhs := n.RHS()
+	switch op := n.Operator(); {
+	case (op == t.IDEqQuestion) || (op == t.IDShiftLEq) || (op == t.IDShiftREq) || (op == t.IDTildeModShiftLEq):
+		// No-op. The RHS's type is not the LHS's.
+	case (n.LHS() == nil) || (n.LHS().Operator() == a.ExprOperatorList):
+		// No-op.
+	default:
+		if len(spineShifts(rhs, nil)) > 0 {
+			if err := q.tcheckExpr(n.LHS(), 0); err != nil {
+				return err
+			}
+			q.markIdealShifts(rhs, n.LHS().MType())
+		}
+	}
 	if err := q.tcheckExpr(rhs, 0); err != nil {
 		return err
 	}
 	lhs := n.LHS()
 	if lhs == nil {
 		return nil
+	} else if lhs.Operator() == a.ExprOperatorList {
+		return q.tcheckAssignMultiple(n)
 	}
 	if err := q.tcheckExpr(lhs, 0); err != nil {
 		return err
@@ -384,9 +540,15 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 		}
 		return nil
 
-	case t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeModStarEq,
-		t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
+	case t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeModStarEq:
+		// Modular arithmetic wraps around, as two's complement for signed
+		// integers.
+		if !lTyp.IsUnsignedInteger() && !lTyp.IsSignedInteger() {
+			return fmt.Errorf("check: assignment %q: %q, of type %q, does not have integer type",
+				n.Operator().Str(q.tm), lhs.Str(q.tm), lTyp.Str(q.tm))
+		}
 
+	case t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
 		if !lTyp.IsUnsignedInteger() {
 			return fmt.Errorf("check: assignment %q: %q, of type %q, does not have unsigned integer type",
 				n.Operator().Str(q.tm), lhs.Str(q.tm), lTyp.Str(q.tm))
@@ -394,10 +556,11 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 	}
 
 	if !(rTyp.IsIdeal() && lTyp.IsNumType()) && !lTyp.EqIgnoringRefinementsLHSReadOnly(rTyp) {
-		return fmt.Errorf("check: assignment %q: %q and %q, of types %q and %q, do not have compatible types",
+		return fmt.Errorf("check: assignment %q: %q and %q, of types %q and %q, do not have compatible types%s",
 			n.Operator().Str(q.tm),
 			lhs.Str(q.tm), rhs.Str(q.tm),
 			lTyp.Str(q.tm), rTyp.Str(q.tm),
+			conversionHint(q.tm, rhs, lTyp),
 		)
 	}
 	return nil
@@ -443,34 +606,16 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 	switch n.Operator() {
 	case 0:
 		id1 := n.Ident()
-		if id1.IsNumLiteral(q.tm) {
-			z := big.NewInt(0)
-			s := id1.Str(q.tm)
-			if _, ok := z.SetString(s, 0); !ok {
-				return fmt.Errorf("check: invalid numeric literal %q", s)
-			}
-			n.SetConstValue(z)
-			n.SetMType(typeExprIdeal)
-			return nil
+		if id1.IsFloatLiteral(q.tm) {
+			return fmt.Errorf("check: floating point literal %q requires a fixed-point type, "+
+				"which is not yet supported", id1.Str(q.tm))
 
-		} else if id1.IsSQStrLiteral(q.tm) {
-			s := id1.Str(q.tm)
-			unescaped, ok := t.Unescape(id1.Str(q.tm))
-			if !ok {
-				return fmt.Errorf("check: invalid '-string literal %q", s)
-			}
-
-			z := big.NewInt(0)
-			i, iEnd, iDelta := 0, len(unescaped), +1 // Big-endian.
-			if (len(s) > 2) && (s[len(s)-2] == 'l') {
-				i, iEnd, iDelta = len(unescaped)-1, -1, -1 // Little-endian.
-			}
-			for ; i != iEnd; i += iDelta {
-				z.Lsh(z, 8)
-				z.Or(z, big.NewInt(int64(unescaped[i])))
+		} else if id1.IsNumLiteral(q.tm) || id1.IsSQStrLiteral(q.tm) {
+			cv, err := eval.Literal(q.tm, id1)
+			if err != nil {
+				return err
 			}
-
-			n.SetConstValue(z)
+			n.SetConstValue(cv)
 			n.SetMType(typeExprIdeal)
 			return nil
 
@@ -653,6 +798,9 @@ func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 		return fmt.Errorf(`check: cannot call cpu_arch function %q directly, only via "choose"`,
 			f.QQID().Str(q.tm))
 	}
+	if f.Test() {
+		return fmt.Errorf("check: cannot call test function %q", f.QQID().Str(q.tm))
+	}
 
 	genericType1 := (*a.TypeExpr)(nil)
 	genericType2 := (*a.TypeExpr)(nil)
@@ -727,9 +875,54 @@ func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 	} else {
 		n.SetMType(oTyp)
 	}
+
+	if (f.Receiver()[0] == t.IDBase) && (lhs.Operator() == t.IDDot) {
+		n.SetIntrinsicKind(intrinsicKind(lhs.LHS().AsExpr().MType()))
+	}
 	return nil
 }
 
+// intrinsicKind returns the a.IntrinsicKind of a call to a built-in method
+// whose receiver has type recvTyp.
+func intrinsicKind(recvTyp *a.TypeExpr) a.IntrinsicKind {
+	switch recvTyp.Decorator() {
+	case 0:
+		// No-op.
+	case t.IDNptr, t.IDPtr:
+		return a.IntrinsicPtr
+	case t.IDRoslice, t.IDSlice:
+		return a.IntrinsicSlice
+	case t.IDRotable, t.IDTable:
+		return a.IntrinsicTable
+	default:
+		return a.IntrinsicOther
+	}
+
+	qid := recvTyp.QID()
+	if qid[0] != t.IDBase {
+		return a.IntrinsicOther
+	} else if qid[1].IsNumType() {
+		return a.IntrinsicNumType
+	} else if qid[1].IsBuiltInCPUArch() {
+		return a.IntrinsicCPUArch
+	}
+	switch qid[1] {
+	case t.IDIOReader:
+		return a.IntrinsicIOReader
+	case t.IDIOWriter:
+		return a.IntrinsicIOWriter
+	case t.IDPixelSwizzler:
+		return a.IntrinsicPixelSwizzler
+	case t.IDTokenReader:
+		return a.IntrinsicTokenReader
+	case t.IDTokenWriter:
+		return a.IntrinsicTokenWriter
+	case t.IDUtility:
+		return a.IntrinsicUtility
+	}
+	return a.IntrinsicOther
+}
+
 func (c *Checker) isBuiltInSliceFunc(qqid t.QQID, typ *a.TypeExpr) bool {
 	if typ.Decorator() == t.IDRoslice {
 		return (c.builtInRosliceFuncs[qqid] != nil) ||
@@ -840,10 +1033,22 @@ func (q *checker) tcheckExprUnaryOp(n *a.Expr, depth uint32) error {
 				n.Operator().AmbiguousForm().Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
 		}
 		if cv := rhs.ConstValue(); cv != nil {
-			if n.Operator() == t.IDXUnaryMinus {
-				cv = neg(cv)
+			ncv, err := eval.UnaryOp(q.tm, n, cv)
+			if err != nil {
+				return err
 			}
-			n.SetConstValue(cv)
+			n.SetConstValue(ncv)
+		}
+		n.SetMType(rTyp.Unrefined())
+		return nil
+
+	case t.IDXUnaryTilde:
+		if !rTyp.IsUnsignedInteger() {
+			return fmt.Errorf("check: unary %q: %q, of type %q, does not have an unsigned integer type",
+				n.Operator().AmbiguousForm().Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
+		}
+		if cv := rhs.ConstValue(); cv != nil {
+			n.SetConstValue(big.NewInt(0).Xor(cv, numTypeBounds[rTyp.QID()[1]][1]))
 		}
 		n.SetMType(rTyp.Unrefined())
 		return nil
@@ -854,7 +1059,11 @@ func (q *checker) tcheckExprUnaryOp(n *a.Expr, depth uint32) error {
 				n.Operator().AmbiguousForm().Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
 		}
 		if cv := rhs.ConstValue(); cv != nil {
-			n.SetConstValue(btoi(cv.Sign() == 0))
+			ncv, err := eval.UnaryOp(q.tm, n, cv)
+			if err != nil {
+				return err
+			}
+			n.SetConstValue(ncv)
 		}
 		n.SetMType(typeExprBool)
 		return nil
@@ -877,6 +1086,9 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 		if lTyp.IsNumTypeOrIdeal() && rhs.IsNumType() {
 			n.SetMType(rhs)
 			return nil
+		} else if n.Truncates() {
+			return fmt.Errorf("check: cannot truncate expression %q, of type %q, as type %q",
+				lhs.Str(q.tm), lTyp.Str(q.tm), rhs.Str(q.tm))
 		} else if lTyp.IsEitherSliceType() &&
 			(rhs.Decorator() == t.IDPtr) &&
 			rhs.Inner().IsEitherArrayType() &&
@@ -947,19 +1159,33 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 			break
 		}
 		if !lTyp.EqIgnoringRefinements(rTyp) && !lTyp.IsIdeal() && !rTyp.IsIdeal() {
-			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have compatible types",
+			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have compatible types%s",
 				op.AmbiguousForm().Str(q.tm),
 				lhs.Str(q.tm), rhs.Str(q.tm),
 				lTyp.Str(q.tm), rTyp.Str(q.tm),
+				widenHint(q.tm, lhs, lTyp, rhs, rTyp),
 			)
 		}
 	case t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftL:
-		if lTyp.IsIdeal() && !rTyp.IsIdeal() {
+		if !lTyp.IsIdeal() || rTyp.IsIdeal() {
+			break
+		} else if typ := q.idealShiftTypes[n]; (typ != nil) && (lhs.ConstValue() != nil) {
+			// Take the type from the context, such as the "z" in "z = 1 << x".
+			if b := numTypeBounds[typ.QID()[1]]; !b.ContainsInt(lhs.ConstValue()) {
+				return fmt.Errorf("check: binary %q: %q, with value %v, does not fit in type %q, "+
+					"the type of the shift's context", op.AmbiguousForm().Str(q.tm),
+					lhs.Str(q.tm), lhs.ConstValue(), typ.Str(q.tm))
+			}
+			lhs.SetMType(typ)
+			lTyp = typ
+		} else {
 			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q; "+
-				"cannot shift an ideal number by a non-ideal number",
+				"cannot shift an ideal number by a non-ideal number; "+
+				"give it a type explicitly, as in \"(%s as base.u32) %s %s\"",
 				op.AmbiguousForm().Str(q.tm),
 				lhs.Str(q.tm), rhs.Str(q.tm),
 				lTyp.Str(q.tm), rTyp.Str(q.tm),
+				operandStr(q.tm, lhs), op.AmbiguousForm().Str(q.tm), operandStr(q.tm, rhs),
 			)
 		}
 	}
@@ -979,7 +1205,10 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 				)
 			}
 		}
-		if !typ.IsUnsignedInteger() {
+		if typ.IsSignedInteger() && (op != t.IDXBinaryTildeSatPlus) && (op != t.IDXBinaryTildeSatMinus) {
+			// Modular arithmetic wraps around, as two's complement for
+			// signed integers.
+		} else if !typ.IsUnsignedInteger() {
 			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have unsigned integer types",
 				op.AmbiguousForm().Str(q.tm),
 				lhs.Str(q.tm), rhs.Str(q.tm),
@@ -988,8 +1217,18 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 		}
 	}
 
+	if op == t.IDXBinaryStarStar {
+		if (lhs.ConstValue() == nil) || !lTyp.IsIdeal() || (rhs.ConstValue() == nil) || !rTyp.IsIdeal() {
+			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, are not both ideal constants",
+				op.AmbiguousForm().Str(q.tm),
+				lhs.Str(q.tm), rhs.Str(q.tm),
+				lTyp.Str(q.tm), rTyp.Str(q.tm),
+			)
+		}
+	}
+
 	if lcv, rcv := lhs.ConstValue(), rhs.ConstValue(); lcv != nil && rcv != nil {
-		ncv, err := evalConstValueBinaryOp(q.tm, n, lcv, rcv)
+		ncv, err := eval.BinaryOp(q.tm, n, lcv, rcv)
 		if err != nil {
 			return err
 		}
@@ -1007,68 +1246,76 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 	return nil
 }
 
-func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.Int, error) {
-	switch n.Operator() {
-	case t.IDXBinaryPlus:
-		return big.NewInt(0).Add(l, r), nil
-	case t.IDXBinaryMinus:
-		return big.NewInt(0).Sub(l, r), nil
-	case t.IDXBinaryStar:
-		return big.NewInt(0).Mul(l, r), nil
-	case t.IDXBinarySlash:
-		if r.Sign() == 0 {
-			return nil, fmt.Errorf("check: division by zero in const expression %q", n.Str(tm))
-		}
-		// TODO: decide on Euclidean division vs other definitions. See "go doc
-		// math/big int.divmod" for details.
-		return big.NewInt(0).Div(l, r), nil
-	case t.IDXBinaryShiftL:
-		if r.Sign() < 0 || r.Cmp(ffff) > 0 {
-			return nil, fmt.Errorf("check: shift %q out of range in const expression %q",
-				n.RHS().AsExpr().Str(tm), n.Str(tm))
-		}
-		return big.NewInt(0).Lsh(l, uint(r.Uint64())), nil
-	case t.IDXBinaryShiftR:
-		if r.Sign() < 0 || r.Cmp(ffff) > 0 {
-			return nil, fmt.Errorf("check: shift %q out of range in const expression %q",
-				n.RHS().AsExpr().Str(tm), n.Str(tm))
-		}
-		return big.NewInt(0).Rsh(l, uint(r.Uint64())), nil
-	case t.IDXBinaryAmp:
-		return big.NewInt(0).And(l, r), nil
-	case t.IDXBinaryPipe:
-		return big.NewInt(0).Or(l, r), nil
-	case t.IDXBinaryHat:
-		return big.NewInt(0).Xor(l, r), nil
-	case t.IDXBinaryPercent:
-		if r.Sign() == 0 {
-			return nil, fmt.Errorf("check: division by zero in const expression %q", n.Str(tm))
-		}
-		return big.NewInt(0).Mod(l, r), nil
-	case t.IDXBinaryNotEq:
-		return btoi(l.Cmp(r) != 0), nil
-	case t.IDXBinaryLessThan:
-		return btoi(l.Cmp(r) < 0), nil
-	case t.IDXBinaryLessEq:
-		return btoi(l.Cmp(r) <= 0), nil
-	case t.IDXBinaryEqEq:
-		return btoi(l.Cmp(r) == 0), nil
-	case t.IDXBinaryGreaterEq:
-		return btoi(l.Cmp(r) >= 0), nil
-	case t.IDXBinaryGreaterThan:
-		return btoi(l.Cmp(r) > 0), nil
-	case t.IDXBinaryAnd:
-		return btoi((l.Sign() != 0) && (r.Sign() != 0)), nil
-	case t.IDXBinaryOr:
-		return btoi((l.Sign() != 0) || (r.Sign() != 0)), nil
-
-	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
-		t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL,
+// spineShifts appends, to dst, the shifts on the arithmetic spine of n, such
+// as "1 << x" in "(1 << x) - 1". Such a shift has the same type as n, even if
+// its left operand is an ideal constant.
+func spineShifts(n *a.Expr, dst []*a.Expr) []*a.Expr {
+	switch op := n.Operator(); op {
+	case t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftL:
+		dst = append(dst, n)
+		return spineShifts(n.LHS().AsExpr(), dst)
+
+	case t.IDXBinaryPlus, t.IDXBinaryMinus, t.IDXBinaryStar, t.IDXBinarySlash, t.IDXBinaryPercent,
+		t.IDXBinaryAmp, t.IDXBinaryPipe, t.IDXBinaryHat,
+		t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar,
 		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
+		dst = spineShifts(n.LHS().AsExpr(), dst)
+		return spineShifts(n.RHS().AsExpr(), dst)
+
+	case t.IDXAssociativePlus, t.IDXAssociativeStar,
+		t.IDXAssociativeAmp, t.IDXAssociativePipe, t.IDXAssociativeHat:
+		for _, o := range n.Args() {
+			dst = spineShifts(o.AsExpr(), dst)
+		}
+	}
+	return dst
+}
 
-		return nil, fmt.Errorf("check: cannot apply tilde-operators to ideal numbers")
+// markIdealShifts records that n's spineShifts have type typ, if it is a
+// numeric type, for when their left operand is an ideal constant.
+func (q *checker) markIdealShifts(n *a.Expr, typ *a.TypeExpr) {
+	if (typ == nil) || !typ.IsNumType() {
+		return
+	}
+	for _, o := range spineShifts(n, nil) {
+		if q.idealShiftTypes == nil {
+			q.idealShiftTypes = map[*a.Expr]*a.TypeExpr{}
+		}
+		q.idealShiftTypes[o] = typ.Unrefined()
 	}
-	return nil, fmt.Errorf("check: unrecognized token (0x%X) for evalConstValueBinaryOp", n.Operator())
+}
+
+// widenHint returns a suggestion, for an error message, to convert the
+// narrower of x and y to the other's type, if they are integers of the same
+// signedness.
+func widenHint(tm *t.Map, x *a.Expr, xTyp *a.TypeExpr, y *a.Expr, yTyp *a.TypeExpr) string {
+	if !(xTyp.IsUnsignedInteger() && yTyp.IsUnsignedInteger()) &&
+		!(xTyp.IsSignedInteger() && yTyp.IsSignedInteger()) {
+		return ""
+	}
+	xb, yb := numTypeBounds[xTyp.QID()[1]], numTypeBounds[yTyp.QID()[1]]
+	if xb[1].Cmp(yb[1]) < 0 {
+		return conversionHint(tm, x, yTyp)
+	}
+	return conversionHint(tm, y, xTyp)
+}
+
+// conversionHint returns a suggestion, for an error message, to convert x to
+// typ, if typ is numeric.
+func conversionHint(tm *t.Map, x *a.Expr, typ *a.TypeExpr) string {
+	if !typ.IsNumType() || !x.MType().IsNumType() {
+		return ""
+	}
+	return fmt.Sprintf("; convert explicitly, as in \"%s as %s\"", operandStr(tm, x), typ.Unrefined().Str(tm))
+}
+
+// operandStr returns x as a string, parenthesized if it is an operator
+// expression, so that it can be an operand of another operator.
+func operandStr(tm *t.Map, x *a.Expr) string {
+	if x.Operator().IsXOp() {
+		return "(" + x.Str(tm) + ")"
+	}
+	return x.Str(tm)
 }
 
 func (q *checker) tcheckExprAssociativeOp(n *a.Expr, depth uint32) error {
@@ -1096,10 +1343,11 @@ func (q *checker) tcheckExprAssociativeOp(n *a.Expr, depth uint32) error {
 			}
 			if !typ.EqIgnoringRefinements(oTyp) {
 				return fmt.Errorf("check: associative %q: %q and %q, of types %q and %q, "+
-					"do not have compatible types",
+					"do not have compatible types%s",
 					n.Operator().AmbiguousForm().Str(q.tm),
 					expr.Str(q.tm), o.Str(q.tm),
-					expr.MType().Str(q.tm), o.MType().Str(q.tm))
+					expr.MType().Str(q.tm), o.MType().Str(q.tm),
+					widenHint(q.tm, expr, expr.MType(), o, o.MType()))
 			}
 		}
 		if typ == nil {
@@ -1124,74 +1372,17 @@ func (q *checker) tcheckExprAssociativeOp(n *a.Expr, depth uint32) error {
 		return fmt.Errorf("check: unrecognized token (0x%X) for tcheckExprAssociativeOp", n.Operator())
 	}
 
-	ncv, err := evalConstValueAssociativeOp(q.tm, n)
-	n.SetConstValue(ncv)
-	return err
-}
-
-func evalConstValueAssociativeOp(tm *t.Map, n *a.Expr) (*big.Int, error) {
-	args := n.Args()
-	if len(args) == 0 {
-		return nil, fmt.Errorf("check: no operands for associative operator")
-	}
-	cv0 := args[0].AsExpr().ConstValue()
-	if cv0 == nil {
-		return nil, nil
-	}
-	args = args[1:]
-	ncv := big.NewInt(0).Set(cv0)
-
-	switch n.Operator() {
-	case t.IDXAssociativePlus:
-		for _, o := range args {
-			if cv := o.AsExpr().ConstValue(); cv == nil {
-				return nil, nil
-			} else {
-				ncv.Add(ncv, cv)
-			}
-		}
-
-	case t.IDXAssociativeStar:
-		for _, o := range args {
-			if cv := o.AsExpr().ConstValue(); cv == nil {
-				return nil, nil
-			} else {
-				ncv.Mul(ncv, cv)
-			}
-		}
-
-	case t.IDXAssociativeAmp, t.IDXAssociativeAnd:
-		for _, o := range args {
-			if cv := o.AsExpr().ConstValue(); cv == nil {
-				return nil, nil
-			} else {
-				ncv.And(ncv, cv)
-			}
-		}
-
-	case t.IDXAssociativePipe, t.IDXAssociativeOr:
-		for _, o := range args {
-			if cv := o.AsExpr().ConstValue(); cv == nil {
-				return nil, nil
-			} else {
-				ncv.Or(ncv, cv)
-			}
-		}
-
-	case t.IDXAssociativeHat:
-		for _, o := range args {
-			if cv := o.AsExpr().ConstValue(); cv == nil {
-				return nil, nil
-			} else {
-				ncv.Xor(ncv, cv)
-			}
+	cvs := make([]*big.Int, 0, len(n.Args()))
+	for _, o := range n.Args() {
+		cv := o.AsExpr().ConstValue()
+		if cv == nil {
+			return nil
 		}
-
-	default:
-		return nil, fmt.Errorf("check: unrecognized token (0x%X) for evalConstValueAssociativeOp", n.Operator())
+		cvs = append(cvs, cv)
 	}
-
-	return ncv, nil
+	ncv, err := eval.AssociativeOp(q.tm, n, cvs)
+	n.SetConstValue(ncv)
+	return err
 }
 
 func (q *checker) tcheckTypeExpr(typ *a.TypeExpr, depth uint32) error {
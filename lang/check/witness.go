@@ -0,0 +1,188 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package check
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/google/wuffs/lang/ast/eval"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// maxWitnessLeaves bounds the number of leaves that witness will consider.
+// It tries up to (1 << maxWitnessLeaves) assignments.
+const maxWitnessLeaves = 10
+
+var errNoWitness = errors.New("check: no witness")
+
+// witnessLeaf is a sub-expression, such as a variable, a field or a method
+// call, whose value witness chooses from its (already checked) bounds.
+type witnessLeaf struct {
+	key string
+	b   bounds
+}
+
+// witness returns a counterexample for an expression n whose bounds are not
+// within tb: an assignment of values to n's leaves, each at one end of that
+// leaf's bounds, under which n's value is outside tb, such as
+// `; for example, x = 4294967295, y = 1 gives 4294967296`. The assignment is
+// consistent with those of q.facts that can be evaluated under it.
+//
+// It returns "" if no such assignment is found. The bounds checker's interval
+// arithmetic can over-approximate, so the check failing does not imply that a
+// counterexample exists.
+func (q *checker) witness(n *a.Expr, tb bounds) string {
+	leaves := []witnessLeaf(nil)
+	if err := q.witnessLeaves(n, &leaves); (err != nil) || (len(leaves) == 0) {
+		// With no leaves, the expression is constant and is its own witness.
+		return ""
+	}
+
+	values := map[string]*big.Int{}
+	for i := 0; i < (1 << uint(len(leaves))); i++ {
+		for j, l := range leaves {
+			values[l.key] = l.b[(i>>uint(j))&1]
+		}
+		if !q.witnessSatisfiesFacts(values) {
+			continue
+		}
+		v, err := q.witnessEval(n, values)
+		if (err != nil) || ((v.Cmp(tb[0]) >= 0) && (v.Cmp(tb[1]) <= 0)) {
+			continue
+		}
+
+		b := &strings.Builder{}
+		b.WriteString("; for example, ")
+		for j, l := range leaves {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(l.key)
+			b.WriteString(" = ")
+			b.WriteString(values[l.key].String())
+		}
+		b.WriteString(" gives ")
+		b.WriteString(v.String())
+		return b.String()
+	}
+	return ""
+}
+
+// isWitnessOp returns whether witnessEval evaluates an expression with
+// operator op, instead of treating it as a leaf.
+func isWitnessOp(op t.ID) bool {
+	switch {
+	case op.IsXUnaryOp():
+		return op != t.IDXUnaryTilde
+	case op.IsXBinaryOp():
+		switch op {
+		case t.IDXBinaryAs,
+			t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
+			t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL,
+			t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
+			return false
+		}
+		return true
+	case op.IsXAssociativeOp():
+		return true
+	}
+	return false
+}
+
+func (q *checker) witnessLeaves(n *a.Expr, leaves *[]witnessLeaf) error {
+	if n.ConstValue() != nil {
+		return nil
+	}
+	if op := n.Operator(); isWitnessOp(op) {
+		if op.IsXAssociativeOp() {
+			for _, o := range n.Args() {
+				if err := q.witnessLeaves(o.AsExpr(), leaves); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if op.IsXBinaryOp() {
+			if err := q.witnessLeaves(n.LHS().AsExpr(), leaves); err != nil {
+				return err
+			}
+		}
+		return q.witnessLeaves(n.RHS().AsExpr(), leaves)
+	}
+
+	key := n.Str(q.tm)
+	for _, l := range *leaves {
+		if l.key == key {
+			return nil
+		}
+	}
+	b := n.MBounds()
+	if (b[0] == nil) || (b[1] == nil) || (len(*leaves) >= maxWitnessLeaves) {
+		return errNoWitness
+	}
+	*leaves = append(*leaves, witnessLeaf{key: key, b: b})
+	return nil
+}
+
+// witnessSatisfiesFacts returns whether no fact evaluates to false. Facts that
+// mention other (non-leaf) sub-expressions are ignored.
+func (q *checker) witnessSatisfiesFacts(values map[string]*big.Int) bool {
+	for _, x := range q.facts {
+		if v, err := q.witnessEval(x, values); (err == nil) && (v.Sign() == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// witnessEval returns n's value, given its leaves' values. Booleans are
+// represented as 0 (false) or 1 (true).
+func (q *checker) witnessEval(n *a.Expr, values map[string]*big.Int) (*big.Int, error) {
+	if cv := n.ConstValue(); cv != nil {
+		return cv, nil
+	}
+	op := n.Operator()
+	if !isWitnessOp(op) {
+		if v, ok := values[n.Str(q.tm)]; ok {
+			return v, nil
+		}
+		return nil, errNoWitness
+	}
+
+	if op.IsXAssociativeOp() {
+		args := make([]*big.Int, 0, len(n.Args()))
+		for _, o := range n.Args() {
+			v, err := q.witnessEval(o.AsExpr(), values)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+		return eval.AssociativeOp(q.tm, n, args)
+	}
+
+	r, err := q.witnessEval(n.RHS().AsExpr(), values)
+	if err != nil {
+		return nil, err
+	}
+	if op.IsXUnaryOp() {
+		return eval.UnaryOp(q.tm, n, r)
+	}
+	l, err := q.witnessEval(n.LHS().AsExpr(), values)
+	if err != nil {
+		return nil, err
+	}
+	return eval.BinaryOp(q.tm, n, l, r)
+}
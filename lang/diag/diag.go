@@ -0,0 +1,184 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+// Package diag provides machine-readable diagnostics, such as syntax and type
+// checking errors, for editors and continuous integration tools to consume.
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+type Severity uint8
+
+const (
+	SeverityError   = Severity(0)
+	SeverityWarning = Severity(1)
+	SeverityNote    = Severity(2)
+)
+
+var severityStrings = [...]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityNote:    "note",
+}
+
+func (s Severity) String() string {
+	if uint(s) < uint(len(severityStrings)) {
+		return severityStrings[s]
+	}
+	return "severity" + strconv.Itoa(int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is a single problem found in Wuffs source code.
+//
+// Code identifies the stage that found the problem: "token", "parse" or
+// "check", or "other" if unknown. Filename, Line and Col give its position,
+// where known. Col, like Line, is 1-based, and zero means unknown.
+//
+// Notes give supporting detail, such as the facts that the bounds checker
+// knew when it failed to prove an assertion.
+type Diagnostic struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Filename string   `json:"filename,omitempty"`
+	Line     uint32   `json:"line,omitempty"`
+	Col      uint32   `json:"col,omitempty"`
+	Message  string   `json:"message"`
+	Notes    []string `json:"notes,omitempty"`
+}
+
+// Error formats d in the same "code: message at filename:line:col" style as
+// the errors that the token, parse and check packages return.
+func (d *Diagnostic) Error() string {
+	b := strings.Builder{}
+	if d.Code != "other" {
+		b.WriteString(d.Code)
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Message)
+	if d.Filename != "" {
+		fmt.Fprintf(&b, " at %s:%d", d.Filename, d.Line)
+		if d.Col != 0 {
+			fmt.Fprintf(&b, ":%d", d.Col)
+		}
+	}
+	return b.String()
+}
+
+// Collector accumulates Diagnostics. The zero value is ready to use.
+type Collector struct {
+	Diagnostics []Diagnostic
+}
+
+// Add converts err, as per FromError, and adds the result to c. It is a no-op
+// if err is nil.
+func (c *Collector) Add(err error) {
+	c.Diagnostics = append(c.Diagnostics, FromError(err)...)
+}
+
+// HasErrors returns whether any of c's Diagnostics have SeverityError.
+func (c *Collector) HasErrors() bool {
+	for i := range c.Diagnostics {
+		if c.Diagnostics[i].Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes c's Diagnostics to w as a JSON array, followed by a new
+// line. An empty Collector is written as "[]".
+func (c *Collector) WriteJSON(w io.Writer) error {
+	ds := c.Diagnostics
+	if ds == nil {
+		ds = []Diagnostic{}
+	}
+	buf, err := json.MarshalIndent(ds, "", "\t")
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	_, err = w.Write(buf)
+	return err
+}
+
+// FromError converts err, as returned by the token, parse or check packages,
+// to Diagnostics. A parse.ErrorList yields one Diagnostic per element.
+//
+// The Diagnostics' parts come from the structured errors that those packages
+// return: *token.Error, *check.Error and *check.Warning. Any other error
+// yields a Diagnostic with the "other" code and err's message.
+func FromError(err error) []Diagnostic {
+	switch err := err.(type) {
+	case nil:
+		return nil
+
+	case parse.ErrorList:
+		ds := make([]Diagnostic, 0, len(err))
+		for _, e := range err {
+			ds = append(ds, FromError(e)...)
+		}
+		return ds
+
+	case *t.Error:
+		return []Diagnostic{{
+			Code:     err.Code,
+			Severity: SeverityError,
+			Filename: err.Filename,
+			Line:     err.Line,
+			Col:      err.Col,
+			Message:  err.Msg,
+		}}
+
+	case *check.Error:
+		d := fromCheck(err.Err, SeverityError, err.Filename, err.Line, err.Col)
+		if err.TMap != nil {
+			for _, f := range err.Facts {
+				d.Notes = append(d.Notes, "fact: "+f.Str(err.TMap))
+			}
+		}
+		return []Diagnostic{d}
+
+	case *check.Warning:
+		return []Diagnostic{fromCheck(err.Err, SeverityWarning, err.Filename, err.Line, err.Col)}
+	}
+	return []Diagnostic{{
+		Code:     "other",
+		Severity: SeverityError,
+		Message:  err.Error(),
+	}}
+}
+
+// fromCheck converts the Err of a *check.Error or *check.Warning, whose
+// position is held separately from its "check: " prefixed message.
+func fromCheck(err error, severity Severity, filename string, line uint32, col uint32) Diagnostic {
+	return Diagnostic{
+		Code:     "check",
+		Severity: severity,
+		Filename: filename,
+		Line:     line,
+		Col:      col,
+		Message:  strings.TrimPrefix(err.Error(), "check: "),
+	}
+}
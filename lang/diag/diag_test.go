@@ -0,0 +1,151 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestFromError(tt *testing.T) {
+	tm := &t.Map{}
+	errOf := func(src string, maxErrors int) error {
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+		if err != nil {
+			return err
+		}
+		f, err := parse.Parse(tm, "test.wuffs", tokens, &parse.Options{MaxErrors: maxErrors})
+		if err != nil {
+			return err
+		}
+		_, err = check.Check(tm, []*a.File{f}, nil)
+		return err
+	}
+
+	testCases := []struct {
+		err  error
+		want []Diagnostic
+	}{{
+		err:  nil,
+		want: nil,
+	}, {
+		err: errOf("pri const X : base.u32 = 1 $\n", 1),
+		want: []Diagnostic{
+			{Code: "token", Filename: "test.wuffs", Line: 1, Col: 28, Message: `unrecognized byte '\x24' ('$')`},
+		},
+	}, {
+		err: errOf("pri func f( {\n}\npri func g() {\n\tx = (\n}\n", 10),
+		want: []Diagnostic{
+			{Code: "parse", Filename: "test.wuffs", Line: 1, Col: 13, Message: `expected identifier, got "{"`},
+			{Code: "parse", Filename: "test.wuffs", Line: 5, Col: 1, Message: `expected identifier, got "}"`},
+		},
+	}, {
+		err: errOf("pri func f() {\n\tvar x : base.u8\n\tx = 300\n}\n", 1),
+		want: []Diagnostic{{
+			Code:     "check",
+			Filename: "test.wuffs",
+			Line:     3,
+			Col:      2,
+			Message:  `expression "300" bounds [300 ..= 300] is not within bounds [0 ..= 255]`,
+			Notes:    []string{"fact: x == 0"},
+		}},
+	}, {
+		err: &check.Warning{
+			Err:      errors.New(`check: variable "x" is never read`),
+			Filename: "test.wuffs",
+			Line:     2,
+			Col:      2,
+		},
+		want: []Diagnostic{{
+			Code:     "check",
+			Severity: SeverityWarning,
+			Filename: "test.wuffs",
+			Line:     2,
+			Col:      2,
+			Message:  `variable "x" is never read`,
+		}},
+	}, {
+		err:  errors.New("something else"),
+		want: []Diagnostic{{Code: "other", Message: "something else"}},
+	}}
+
+	for i, tc := range testCases {
+		got := FromError(tc.err)
+		if !reflect.DeepEqual(got, tc.want) {
+			tt.Errorf("#%d: %v:\ngot  %#v\nwant %#v", i, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDiagnosticError(tt *testing.T) {
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte("pri func f( {\n}\n"))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	_, err = parse.Parse(tm, "test.wuffs", tokens, nil)
+	if err == nil {
+		tt.Fatalf("Parse: got nil error, want non-nil")
+	}
+
+	for _, e := range []error{err, errors.New("something else")} {
+		ds := FromError(e)
+		if len(ds) != 1 {
+			tt.Fatalf("FromError: got %d Diagnostics, want 1", len(ds))
+		}
+		if got, want := ds[0].Error(), e.Error(); got != want {
+			tt.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCollectorWriteJSON(tt *testing.T) {
+	c := Collector{}
+	buf := &bytes.Buffer{}
+	if err := c.WriteJSON(buf); err != nil {
+		tt.Fatalf("WriteJSON: %v", err)
+	} else if got, want := buf.String(), "[]\n"; got != want {
+		tt.Errorf("empty: got %q, want %q", got, want)
+	}
+
+	c.Add(&check.Error{
+		Err:      errors.New("check: bad thing"),
+		Filename: "a.wuffs",
+		Line:     7,
+	})
+	if !c.HasErrors() {
+		tt.Errorf("HasErrors: got false, want true")
+	}
+	buf.Reset()
+	if err := c.WriteJSON(buf); err != nil {
+		tt.Fatalf("WriteJSON: %v", err)
+	}
+	const want = "[\n" +
+		"\t{\n" +
+		"\t\t\"code\": \"check\",\n" +
+		"\t\t\"severity\": \"error\",\n" +
+		"\t\t\"filename\": \"a.wuffs\",\n" +
+		"\t\t\"line\": 7,\n" +
+		"\t\t\"message\": \"bad thing\"\n" +
+		"\t}\n" +
+		"]\n"
+	if got := buf.String(); got != want {
+		tt.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
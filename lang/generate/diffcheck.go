@@ -0,0 +1,79 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// diffCheck writes the generated code to a temporary directory and compares
+// it with the (presumably checked in) files in outDir, printing a line to w
+// for each file that is missing or differs. It returns an error if any do,
+// in which case the temporary directory is kept, so that it can be diff'ed
+// against outDir in full.
+func diffCheck(w io.Writer, outDir string, filenames []string, outs [][]byte) error {
+	tmpDir, err := os.MkdirTemp("", "wuffs-diff-check-")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputs(tmpDir, filenames, outs); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	numStale := 0
+	for _, filename := range filenames {
+		generated, err := os.ReadFile(filepath.Join(tmpDir, filename))
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+		existingFilename := filepath.Join(outDir, filename)
+		existing, err := os.ReadFile(existingFilename)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(w, "diff_check: %s is missing\n", existingFilename)
+			numStale++
+			continue
+		} else if err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+		if line := firstDifferentLine(existing, generated); line > 0 {
+			fmt.Fprintf(w, "diff_check: %s differs from the generated code, from line %d\n", existingFilename, line)
+			numStale++
+		}
+	}
+
+	if numStale > 0 {
+		return fmt.Errorf("diff_check: %d of %d files are stale (the generated code is in %s)",
+			numStale, len(filenames), tmpDir)
+	}
+	return os.RemoveAll(tmpDir)
+}
+
+// firstDifferentLine returns the 1-based number of the first line that
+// differs between x and y, or 0 if they are equal.
+func firstDifferentLine(x []byte, y []byte) int {
+	if bytes.Equal(x, y) {
+		return 0
+	}
+	line := 1
+	for i := 0; (i < len(x)) && (i < len(y)) && (x[i] == y[i]); i++ {
+		if x[i] == '\n' {
+			line++
+		}
+	}
+	return line
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package generate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFirstDifferentLine(tt *testing.T) {
+	testCases := []struct {
+		x, y string
+		want int
+	}{
+		{"", "", 0},
+		{"a\nb\n", "a\nb\n", 0},
+		{"a\nb\n", "a\nc\n", 2},
+		{"a\nb\n", "a\nb\nc\n", 3},
+		{"a\n", "b\n", 1},
+		{"", "a", 1},
+	}
+
+	for _, tc := range testCases {
+		if got := firstDifferentLine([]byte(tc.x), []byte(tc.y)); got != tc.want {
+			tt.Errorf("x=%q, y=%q: got %d, want %d", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestDiffCheck(tt *testing.T) {
+	outDir := tt.TempDir()
+	if err := os.WriteFile(filepath.Join(outDir, "wuffs-fresh.c"), []byte("x\ny\n"), 0644); err != nil {
+		tt.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "wuffs-stale.c"), []byte("x\ny\n"), 0644); err != nil {
+		tt.Fatal(err)
+	}
+
+	filenames := []string{"wuffs-fresh.c"}
+	outs := [][]byte{[]byte("x\ny\n")}
+	buf := &bytes.Buffer{}
+	if err := diffCheck(buf, outDir, filenames, outs); err != nil {
+		tt.Fatalf("fresh: %v", err)
+	} else if buf.Len() != 0 {
+		tt.Fatalf("fresh: got output %q, want none", buf.String())
+	}
+
+	filenames = []string{"wuffs-fresh.c", "wuffs-stale.c", "wuffs-missing.c"}
+	outs = [][]byte{[]byte("x\ny\n"), []byte("x\nz\n"), []byte("x\n")}
+	buf.Reset()
+	err := diffCheck(buf, outDir, filenames, outs)
+	if err == nil {
+		tt.Fatalf("stale: got nil error, want non-nil")
+	}
+	// The error names the kept temporary directory.
+	if i := strings.LastIndex(err.Error(), " "); i >= 0 {
+		os.RemoveAll(strings.TrimSuffix(err.Error()[i+1:], ")"))
+	}
+	got := buf.String()
+	for _, want := range []string{"wuffs-stale.c differs from the generated code, from line 2", "wuffs-missing.c is missing"} {
+		if !strings.Contains(got, want) {
+			tt.Errorf("stale: got output %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "wuffs-fresh.c") {
+		tt.Errorf("stale: got output %q, want it to not mention wuffs-fresh.c", got)
+	}
+
+	// The -outdir files themselves are unchanged.
+	if existing, err := os.ReadFile(filepath.Join(outDir, "wuffs-stale.c")); err != nil {
+		tt.Fatal(err)
+	} else if string(existing) != "x\ny\n" {
+		tt.Errorf("stale: wuffs-stale.c was overwritten with %q", existing)
+	}
+}
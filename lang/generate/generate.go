@@ -11,16 +11,21 @@
 package generate
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/diag"
 	"github.com/google/wuffs/lang/parse"
-	"github.com/google/wuffs/lang/wuffsroot"
 
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
@@ -28,44 +33,273 @@ import (
 
 type Generator func(packageName string, tm *t.Map, files []*a.File) ([]byte, error)
 
-func Do(flags *flag.FlagSet, args []string, g Generator) error {
-	packageName := flags.String("package_name", "", "the package name of the Wuffs input code")
+// Do runs a "wuffs-lang gen" sub-command. Its arguments are .wuffs files or
+// directories of them. Each directory (or, for files, each parent directory)
+// is a package, whose name is the directory's base name unless the
+// -package_name flag overrides it. Packages that use other packages given on
+// the same command line are generated after them, and resolve those `use`
+// declarations against them instead of the -pkgpath search path, as per
+// resolver. Without the -outdir flag, there must be exactly one package and
+// its generated code is written to stdout. The lang, such as "c", is the
+// -outdir files' extension. With the -diff_check flag, the -outdir files are
+// compared with, instead of overwritten by, the generated code, as per
+// diffCheck.
+//
+// Up to -jobs packages are parsed, checked and generated concurrently, each
+// after the packages that it uses, so g must be safe for concurrent use. The
+// output doesn't depend on -jobs.
+func Do(flags *flag.FlagSet, lang string, args []string, g Generator) error {
+	packageName := flags.String("package_name", "", "the package name of the Wuffs input code; if empty, it is the input directory's base name")
+	pkgPath := flags.String("pkgpath", "", "a list of directories, separated by the OS path list separator (such as ':'), to search for used packages (as .wuffs API files or directories of .wuffs source files) before the Wuffs root's gen/wuffs directory")
+	diffCheckFlag := flags.Bool("diff_check", false, "whether to check, instead of writing, that the -outdir files are up to date, for use as a presubmit: the code is generated into a temporary directory and compared with them")
+	jobs := flags.Int("jobs", 0, "the maximum number of packages to parse, check and generate concurrently; 0 means the number of CPUs")
+	outDir := flags.String("outdir", "", "if non-empty, write each package's generated code to a \"wuffs-etc."+lang+"\" file in this directory, instead of to stdout (which only allows one package)")
+	dumpAST := flags.Bool("dump_ast", false, "print the parsed AST, as S-expressions, instead of generating code")
+	jsonDiags := flags.Bool("json", false, "on a syntax or type checking error, also print it to stdout as a JSON array of diagnostics")
+	requireDefiniteAssignment := flags.Bool("require_definite_assignment", false, "reject reading numeric or boolean local variables before they are definitely assigned, instead of relying on their implicit zero value")
+	requireResetFields := flags.Bool("require_reset_fields", false, "reject reset funcs (named \"reset_foo\") that do not assign every numeric or boolean \"foo_\" field on every path")
+	constantTime := flags.Bool("constant_time", false, "reject code whose run time or memory access pattern could depend on the values of \"secret\" fields and arguments")
+	wAll := flags.Bool("Wall", false, "print lint warnings, such as for unread variables or unneeded asserts, to stderr")
+	wError := flags.Bool("Werror", false, "treat lint warnings as errors (implies -Wall)")
+	cacheDir := flags.String("cache_dir", "", "a directory for caching func verification results, so that re-running after an edit only re-proves the funcs affected by it")
+	explain := flags.String("explain", "", "print, to stderr, the facts known before each statement at a LINE or FILENAME:LINE, to debug failing proofs")
+	verbosity := flags.Int("v", 0, "the verbosity level: 1 or more also prints notes to stderr, such as for facts that are dropped where if/else or switch branches join")
+	proverCmd := flags.String("prover", "", "an SMT solver command line, such as \"z3 -in\", for asserts that the checker cannot otherwise prove")
+	proverTimeout := flags.Duration("prover_timeout", 10*time.Second, "how long the -prover can run for each assert before it is killed and the assert is not proved; 0 means no limit")
+	unicodeIdents := flags.Bool("unicode_idents", false, "whether identifiers can contain non-ASCII letters, as per UAX #31; the generated code then needs a compiler that accepts them")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	out := []byte(nil)
+	if *diffCheckFlag && (*outDir == "") {
+		return fmt.Errorf("-diff_check requires the -outdir flag")
+	}
+	finish := func(filenames []string, outs [][]byte) error {
+		if *diffCheckFlag {
+			return diffCheck(os.Stdout, *outDir, filenames, outs)
+		}
+		return writeOutputs(*outDir, filenames, outs)
+	}
 
 	if *packageName == "base" && len(flags.Args()) == 0 {
-		var err error
-		out, err = g("base", nil, nil)
+		out, err := g("base", nil, nil)
 		if err != nil {
 			return err
 		}
+		return finish([]string{"wuffs-base." + lang}, [][]byte{out})
+	}
+
+	// diagnose optionally reports an error as JSON, for editors and CI.
+	diagnose := func(err error) error {
+		if *jsonDiags {
+			c := diag.Collector{}
+			c.Add(err)
+			if werr := c.WriteJSON(os.Stdout); werr != nil {
+				return werr
+			}
+		}
+		return err
+	}
 
+	pkgs := []*inputPackage(nil)
+	if len(flags.Args()) == 0 {
+		// Read a single package from stdin.
+		pkgs = []*inputPackage{{usePath: *packageName}}
 	} else {
-		pkgName := checkPackageName(*packageName)
-		if pkgName == "" {
-			return fmt.Errorf("prohibited package name %q", *packageName)
+		var err error
+		if pkgs, err = groupPackages(flags.Args()); err != nil {
+			return err
+		}
+	}
+	if *packageName != "" {
+		if len(pkgs) > 1 {
+			return fmt.Errorf("-package_name is incompatible with more than one package")
+		}
+		pkgs[0].name = *packageName
+	}
+	if (len(pkgs) > 1) && (*outDir == "") && !*dumpAST {
+		return fmt.Errorf("more than one package requires the -outdir flag")
+	}
+
+	for _, p := range pkgs {
+		name := checkPackageName(p.name)
+		if name == "" {
+			return fmt.Errorf("prohibited package name %q", p.name)
 		}
+		p.name = name
+	}
+	numJobs := *jobs
+	if numJobs <= 0 {
+		numJobs = runtime.NumCPU()
+	}
 
-		tm := &t.Map{}
-		files, err := parseFiles(tm, flags.Args())
+	// Parse every package before checking any of them, so that they can be
+	// sorted by their use declarations. Packages given on the command line
+	// resolve each other's uses by their public API.
+	tokOpts := &t.Options{UnicodeIdents: *unicodeIdents}
+	r := newResolver(*pkgPath, tokOpts)
+	err := runPackages(pkgs, false, numJobs, func(i int, p *inputPackage) error {
+		p.tm = &t.Map{}
+		files, err := parseFiles(p.tm, p.filenames, tokOpts)
 		if err != nil {
-			return err
+			return diagnosable{err}
+		}
+		p.files = files
+		p.findUses()
+
+		if len(pkgs) > 1 {
+			api, err := PublicAPI(p.tm, p.files)
+			if err != nil {
+				return err
+			}
+			r.setCached(p.usePath+".wuffs", api)
+		}
+		return nil
+	})
+	if d, ok := err.(diagnosable); ok {
+		return diagnose(d.err)
+	} else if err != nil {
+		return err
+	}
+	if pkgs, err = sortPackages(pkgs); err != nil {
+		return err
+	}
+
+	if *dumpAST {
+		buf := &bytes.Buffer{}
+		for _, p := range pkgs {
+			for _, f := range p.files {
+				if err := a.Print(buf, p.tm, f.AsNode()); err != nil {
+					return err
+				}
+			}
 		}
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
 
-		if _, err := check.Check(tm, files, resolveUse); err != nil {
+	opts := &check.Options{
+		RequireDefiniteAssignment: *requireDefiniteAssignment,
+		RequireResetFields:        *requireResetFields,
+		ConstantTime:              *constantTime,
+	}
+	if *cacheDir != "" {
+		opts.Cache = &check.DirCache{Dir: *cacheDir}
+	}
+	explainMutex, explained := sync.Mutex{}, false
+	if *explain != "" {
+		if opts.ExplainFilename, opts.ExplainLine, err = parseExplain(*explain); err != nil {
+			return err
+		}
+		opts.Explain = func(filename string, line uint32, stmt string, facts []string) {
+			explainMutex.Lock()
+			defer explainMutex.Unlock()
+			explained = true
+			if i := strings.IndexByte(stmt, '\n'); i >= 0 {
+				stmt = stmt[:i] + " ..."
+			}
+			fmt.Fprintf(os.Stderr, "explain: %d facts at %s:%d, before %s\n", len(facts), filename, line, stmt)
+			for _, f := range facts {
+				fmt.Fprintf(os.Stderr, "\t%s\n", f)
+			}
+		}
+		defer func() {
+			if !explained {
+				fmt.Fprintf(os.Stderr, "explain: no statement at %s was bounds checked\n", *explain)
+			}
+		}()
+	}
+	if *verbosity >= 1 {
+		opts.DroppedFact = func(filename string, line uint32, fact string, construct string) {
+			fmt.Fprintf(os.Stderr, "note: fact %s discarded after %s at %s:%d "+
+				"(assert it at the end of every branch to keep it)\n", fact, construct, filename, line)
+		}
+	}
+	if *proverCmd != "" {
+		if opts.Prover, err = check.NewExternalProver(*proverCmd, *proverTimeout); err != nil {
 			return err
 		}
+	}
 
-		out, err = g(pkgName, tm, files)
+	// Generate every package before writing any of them, so that an error
+	// in one package doesn't leave the others half-written. Packages are
+	// generated concurrently, but each package's results are kept separate,
+	// so that the output (including any warnings) is in sorted package order.
+	outFilenames := make([]string, len(pkgs))
+	outs := make([][]byte, len(pkgs))
+	warnings := make([][]error, len(pkgs))
+	err = runPackages(pkgs, true, numJobs, func(i int, p *inputPackage) error {
+		c, err := check.CheckWithOptions(p.tm, p.files, r.resolve, opts)
 		if err != nil {
+			return diagnosable{err}
+		}
+
+		if *wAll || *wError {
+			ws, err := c.Lint(p.files)
+			if err != nil {
+				return err
+			}
+			for _, w := range ws {
+				if *wError {
+					return diagnosable{w}
+				}
+				warnings[i] = append(warnings[i], w)
+			}
+		}
+
+		outFilenames[i] = p.outputFilename(lang)
+		outs[i], err = g(p.name, p.tm, p.files)
+		return err
+	})
+	for _, ws := range warnings {
+		for _, w := range ws {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+		}
+	}
+	if d, ok := err.(diagnosable); ok {
+		return diagnose(d.err)
+	} else if err != nil {
+		return err
+	}
+	return finish(outFilenames, outs)
+}
+
+// diagnosable wraps a syntax or type checking error, which the -json flag
+// also reports as JSON.
+type diagnosable struct {
+	err error
+}
+
+func (d diagnosable) Error() string { return d.err.Error() }
+
+// writeOutputs writes the generated code to stdout (when outDir is empty,
+// in which case there is only one output) or to files in outDir.
+func writeOutputs(outDir string, filenames []string, outs [][]byte) error {
+	if outDir == "" {
+		_, err := os.Stdout.Write(outs[0])
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	for i, filename := range filenames {
+		if err := os.WriteFile(filepath.Join(outDir, filename), outs[i], 0644); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	_, err := os.Stdout.Write(out)
-	return err
+// parseExplain parses the -explain flag's "LINE" or "FILENAME:LINE" value.
+func parseExplain(s string) (filename string, line uint32, err error) {
+	lineStr := s
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		filename, lineStr = s[:i], s[i+1:]
+	}
+	n, err := strconv.ParseUint(lineStr, 10, 32)
+	if (err != nil) || (n == 0) {
+		return "", 0, fmt.Errorf("bad -explain value %q, want LINE or FILENAME:LINE", s)
+	}
+	return filename, uint32(n), nil
 }
 
 func checkPackageName(s string) string {
@@ -94,14 +328,14 @@ func checkPackageName(s string) string {
 	return s
 }
 
-func parseFiles(tm *t.Map, filenames []string) (files []*a.File, err error) {
+func parseFiles(tm *t.Map, filenames []string, tokOpts *t.Options) (files []*a.File, err error) {
 	if len(filenames) == 0 {
 		const filename = "stdin"
 		src, err := io.ReadAll(os.Stdin)
 		if err != nil {
 			return nil, err
 		}
-		tokens, _, err := t.Tokenize(tm, filename, src)
+		tokens, _, err := t.TokenizeOptions(tm, filename, src, tokOpts)
 		if err != nil {
 			return nil, err
 		}
@@ -111,20 +345,47 @@ func parseFiles(tm *t.Map, filenames []string) (files []*a.File, err error) {
 		}
 		return []*a.File{f}, nil
 	}
-	return ParseFiles(tm, filenames, nil)
+	return parseFilesOptions(tm, filenames, tokOpts, nil)
 }
 
 func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.File, err error) {
-	for _, filename := range filenames {
-		src, err := os.ReadFile(filename)
-		if err != nil {
-			return nil, err
+	return parseFilesOptions(tm, filenames, nil, opts)
+}
+
+func parseFilesOptions(tm *t.Map, filenames []string, tokOpts *t.Options, opts *parse.Options) (files []*a.File, err error) {
+	// Read and tokenize the files concurrently, each with its own fork of tm.
+	// Merging the forks in filename order keeps the token IDs deterministic.
+	type result struct {
+		fork   *t.Map
+		tokens []t.Token
+		err    error
+	}
+	results := make([]result, len(filenames))
+	wg := sync.WaitGroup{}
+	for i, filename := range filenames {
+		results[i].fork = tm.Fork()
+		wg.Add(1)
+		go func(r *result, filename string) {
+			defer wg.Done()
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				r.err = err
+				return
+			}
+			r.tokens, _, r.err = t.TokenizeOptions(r.fork, filename, src, tokOpts)
+		}(&results[i], filename)
+	}
+	wg.Wait()
+
+	for i, filename := range filenames {
+		r := &results[i]
+		if r.err != nil {
+			return nil, r.err
 		}
-		tokens, _, err := t.Tokenize(tm, filename, src)
-		if err != nil {
+		if err := tm.Merge(r.fork, r.tokens); err != nil {
 			return nil, err
 		}
-		f, err := parse.Parse(tm, filename, tokens, opts)
+		f, err := parse.Parse(tm, filename, r.tokens, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -132,11 +393,3 @@ func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.
 	}
 	return files, nil
 }
-
-func resolveUse(usePath string) ([]byte, error) {
-	wuffsRoot, err := wuffsroot.Value()
-	if err != nil {
-		return nil, err
-	}
-	return os.ReadFile(filepath.Join(wuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
-}
@@ -0,0 +1,298 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/wuffs/lang/wuffsroot"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// inputPackage is one package's worth of the command line arguments. All of a
+// package's .wuffs files are in the same directory.
+type inputPackage struct {
+	// usePath is how other packages' `use` declarations refer to this one,
+	// such as "std/lzw". It is the directory relative to the Wuffs root
+	// directory or, outside of that, just the directory's base name.
+	usePath string
+
+	// name is the package name, such as "lzw".
+	name string
+
+	filenames []string
+	tm        *t.Map
+	files     []*a.File
+
+	// uses lists the usePaths of this package's `use` declarations.
+	uses []string
+}
+
+// outputFilename returns the filename, such as "wuffs-std-lzw.c", that -outdir
+// writes p's generated code to.
+func (p *inputPackage) outputFilename(lang string) string {
+	return "wuffs-" + strings.Replace(p.usePath, "/", "-", -1) + "." + lang
+}
+
+// groupPackages groups the command line arguments, each a .wuffs file or a
+// directory of them, into packages by directory. Packages are returned in
+// order of their first appearance in args.
+func groupPackages(args []string) ([]*inputPackage, error) {
+	wuffsRoot, _ := wuffsroot.Value()
+
+	pkgs := []*inputPackage(nil)
+	byDir := map[string]*inputPackage{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		dir, filenames := filepath.Dir(arg), []string{arg}
+		if info.IsDir() {
+			dir, filenames = arg, nil
+			infos, err := os.ReadDir(arg)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range infos {
+				if !o.IsDir() && strings.HasSuffix(o.Name(), ".wuffs") {
+					filenames = append(filenames, filepath.Join(arg, o.Name()))
+				}
+			}
+			if len(filenames) == 0 {
+				return nil, fmt.Errorf("no .wuffs files in directory %q", arg)
+			}
+		}
+
+		dir, err = filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		p := byDir[dir]
+		if p == nil {
+			p = &inputPackage{
+				usePath: filepath.Base(dir),
+			}
+			if wuffsRoot != "" {
+				if rel, err := filepath.Rel(wuffsRoot, dir); (err == nil) && (rel != ".") &&
+					(rel != "..") && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					p.usePath = filepath.ToSlash(rel)
+				}
+			}
+			p.name = path.Base(p.usePath)
+			byDir[dir] = p
+			pkgs = append(pkgs, p)
+		}
+		p.filenames = append(p.filenames, filenames...)
+	}
+	return pkgs, nil
+}
+
+// findUses sets p.uses from p's parsed files.
+func (p *inputPackage) findUses() {
+	seen := map[string]struct{}{}
+	for _, f := range p.files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			usePath, _ := t.Unescape(n.AsUse().Path().Str(p.tm))
+			if _, ok := seen[usePath]; !ok {
+				seen[usePath] = struct{}{}
+				p.uses = append(p.uses, usePath)
+			}
+		}
+	}
+}
+
+// sortPackages returns pkgs in topological order: each package comes after
+// the packages (in pkgs) that it uses. Uses of packages that aren't in pkgs
+// are ignored. Otherwise, the order of pkgs is preserved.
+func sortPackages(pkgs []*inputPackage) ([]*inputPackage, error) {
+	byUsePath := map[string]*inputPackage{}
+	for _, p := range pkgs {
+		if q := byUsePath[p.usePath]; q != nil {
+			return nil, fmt.Errorf("duplicate package %q", p.usePath)
+		}
+		byUsePath[p.usePath] = p
+	}
+
+	const (
+		unvisited = 0
+		visiting  = 1
+		visited   = 2
+	)
+	states := map[*inputPackage]int{}
+	sorted := make([]*inputPackage, 0, len(pkgs))
+
+	var visit func(p *inputPackage) error
+	visit = func(p *inputPackage) error {
+		switch states[p] {
+		case visiting:
+			return fmt.Errorf("cyclic use declarations involving package %q", p.usePath)
+		case visited:
+			return nil
+		}
+		states[p] = visiting
+		for _, u := range p.uses {
+			if q := byUsePath[u]; q != nil {
+				if err := visit(q); err != nil {
+					return err
+				}
+			}
+		}
+		states[p] = visited
+		sorted = append(sorted, p)
+		return nil
+	}
+
+	for _, p := range pkgs {
+		if err := visit(p); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// errSkipped is the error for a package that wasn't processed because a
+// package that it uses failed.
+var errSkipped = errors.New("skipped")
+
+// runPackages calls f for each of pkgs, with up to jobs calls running
+// concurrently. If waitForUses, pkgs must be sorted as per sortPackages, and
+// each package's call waits for those of the packages (in pkgs) that it
+// uses. If any of those fail, the call is skipped. It returns the first
+// non-nil error, in pkgs order, which is the root cause of any skips.
+func runPackages(pkgs []*inputPackage, waitForUses bool, jobs int, f func(i int, p *inputPackage) error) error {
+	indexes := map[string]int{}
+	for i, p := range pkgs {
+		indexes[p.usePath] = i
+	}
+
+	errs := make([]error, len(pkgs))
+	done := make([]chan struct{}, len(pkgs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, jobs)
+
+	for i, p := range pkgs {
+		go func(i int, p *inputPackage) {
+			defer close(done[i])
+			if waitForUses {
+				for _, u := range p.uses {
+					if j, ok := indexes[u]; ok {
+						<-done[j]
+						if errs[j] != nil {
+							errs[i] = errSkipped
+							return
+						}
+					}
+				}
+			}
+			sem <- struct{}{}
+			errs[i] = f(i, p)
+			<-sem
+		}(i, p)
+	}
+
+	for _, d := range done {
+		<-d
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublicAPI returns the Wuffs source code for a package's public
+// declarations: its pub consts, statuses, structs (without their fields) and
+// func signatures (with empty bodies). Other packages' `use` declarations
+// refer to that API, not to the package's full source code.
+func PublicAPI(tm *t.Map, files []*a.File) ([]byte, error) {
+	out := &bytes.Buffer{}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			switch n.Kind() {
+			case a.KConst:
+				n := n.AsConst()
+				if !n.Public() {
+					continue
+				}
+				fmt.Fprintf(out, "pub const %s : %s = %v\n",
+					n.QID().Str(tm), n.XType().Str(tm), n.Value().Str(tm))
+
+			case a.KFunc:
+				n := n.AsFunc()
+				if !n.Public() {
+					continue
+				}
+				if n.Receiver().IsZero() {
+					return nil, fmt.Errorf("TODO: PublicAPI for a free-standing function")
+				}
+				// TODO: look at n.Asserts().
+				fmt.Fprintf(out, "pub func %s.%s%v(", n.Receiver().Str(tm), n.FuncName().Str(tm), n.Effect())
+				for i, field := range n.In().Fields() {
+					field := field.AsField()
+					if i > 0 {
+						fmt.Fprintf(out, ", ")
+					}
+					// TODO: what happens if the XType is from another package?
+					// Similarly for the out-param.
+					fmt.Fprintf(out, "%s: %s", field.Name().Str(tm), field.XType().Str(tm))
+				}
+				fmt.Fprintf(out, ") ")
+				if o := n.Out(); o != nil {
+					fmt.Fprintf(out, "%s ", o.Str(tm))
+				}
+				fmt.Fprintf(out, "{ }\n")
+
+			case a.KStatus:
+				n := n.AsStatus()
+				if !n.Public() {
+					continue
+				}
+				fmt.Fprintf(out, "pub status %s\n", n.QID().Str(tm))
+
+			case a.KStruct:
+				n := n.AsStruct()
+				if !n.Public() {
+					continue
+				}
+				fmt.Fprintf(out, "pub struct %s", n.QID().Str(tm))
+				if n.Classy() {
+					fmt.Fprintf(out, "?")
+				}
+				if imps := n.Implements(); len(imps) > 0 {
+					fmt.Fprintf(out, " implements ")
+					for i, imp := range imps {
+						if i > 0 {
+							fmt.Fprintf(out, ", ")
+						}
+						fmt.Fprintf(out, "%s", imp.AsTypeExpr().Str(tm))
+					}
+				}
+				fmt.Fprintf(out, "()\n")
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package generate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortPackages(tt *testing.T) {
+	testCases := []struct {
+		// uses is a space-separated list of "pkg:use1,use2" packages.
+		uses string
+		want string
+	}{
+		{"a b c", "a b c"},
+		{"a:b b", "b a"},
+		{"std/png:std/zlib,std/crc32 std/crc32 std/zlib:std/deflate std/deflate",
+			"std/deflate std/zlib std/crc32 std/png"},
+		{"std/gif:std/lzw", "std/gif"},
+		{"a:b b:c c", "c b a"},
+		{"a:b b:a", "cyclic"},
+		{"a:a", "cyclic"},
+		{"a a", "duplicate"},
+	}
+
+	for _, tc := range testCases {
+		pkgs := []*inputPackage(nil)
+		for _, s := range strings.Fields(tc.uses) {
+			p := &inputPackage{}
+			if i := strings.IndexByte(s, ':'); i >= 0 {
+				p.usePath, p.uses = s[:i], strings.Split(s[i+1:], ",")
+			} else {
+				p.usePath = s
+			}
+			pkgs = append(pkgs, p)
+		}
+
+		got := ""
+		if sorted, err := sortPackages(pkgs); err != nil {
+			got = strings.Fields(err.Error())[0]
+		} else {
+			usePaths := []string(nil)
+			for _, p := range sorted {
+				usePaths = append(usePaths, p.usePath)
+			}
+			got = strings.Join(usePaths, " ")
+		}
+		if got != tc.want {
+			tt.Errorf("uses=%q: got %q, want %q", tc.uses, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/wuffsroot"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// resolver finds the public API of the packages that `use` declarations
+// refer to. A `use "std/deflate"` looks, in each of the search path's
+// directories in turn, for a "std/deflate.wuffs" file (such as those that
+// "wuffs gen" writes to the Wuffs root's "gen/wuffs" directory) or for a
+// "std/deflate" directory of .wuffs source files. Such source packages are
+// parsed and checked, and their public API is extracted, as per PublicAPI.
+//
+// The Wuffs root's "gen/wuffs" directory is implicitly at the end of the
+// search path.
+//
+// A resolver is safe for concurrent use.
+type resolver struct {
+	pkgPath []string
+	tokOpts *t.Options
+
+	// apis caches the used packages' public APIs, keyed by the `use` path
+	// plus ".wuffs", such as "std/deflate.wuffs". It is guarded by mu.
+	mu   sync.Mutex
+	apis map[string][]byte
+}
+
+func newResolver(pkgPath string, tokOpts *t.Options) *resolver {
+	r := &resolver{
+		tokOpts: tokOpts,
+		apis:    map[string][]byte{},
+	}
+	for _, dir := range filepath.SplitList(pkgPath) {
+		if dir != "" {
+			r.pkgPath = append(r.pkgPath, dir)
+		}
+	}
+	return r
+}
+
+// resolve returns the public API of the package for filename, such as
+// "std/deflate.wuffs". Its signature matches check.Check's resolveUse
+// argument.
+func (r *resolver) resolve(filename string) ([]byte, error) {
+	return r.resolveFrom(nil, filename)
+}
+
+// resolveFrom is like resolve, where chain lists the source packages being
+// checked (each using the next) that led to filename, to detect cyclic use
+// declarations. Two goroutines can both resolve the same package, redundantly
+// but harmlessly, as the results are the same.
+func (r *resolver) resolveFrom(chain []string, filename string) ([]byte, error) {
+	if src, ok := r.cached(filename); ok {
+		return src, nil
+	}
+	usePath := strings.TrimSuffix(filename, ".wuffs")
+	for _, c := range chain {
+		if c == usePath {
+			return nil, fmt.Errorf("cyclic use declarations involving package %q", usePath)
+		}
+	}
+
+	for _, dir := range r.pkgPath {
+		src, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(filename)))
+		if err == nil {
+			r.setCached(filename, src)
+			return src, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		srcDir := filepath.Join(dir, filepath.FromSlash(usePath))
+		if info, err := os.Stat(srcDir); (err == nil) && info.IsDir() {
+			src, err := r.resolveSourceDir(chain, usePath, srcDir)
+			if err != nil {
+				return nil, err
+			}
+			r.setCached(filename, src)
+			return src, nil
+		}
+	}
+
+	wuffsRoot, err := wuffsroot.Value()
+	if err != nil {
+		if len(r.pkgPath) > 0 {
+			return nil, fmt.Errorf("cannot find package %q in -pkgpath %q (%v)",
+				usePath, strings.Join(r.pkgPath, string(filepath.ListSeparator)), err)
+		}
+		return nil, err
+	}
+	genWuffs := filepath.Join(wuffsRoot, "gen", "wuffs")
+	src, err := os.ReadFile(filepath.Join(genWuffs, filepath.FromSlash(filename)))
+	if err != nil {
+		if (len(r.pkgPath) > 0) && os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot find package %q in -pkgpath %q or %q",
+				usePath, strings.Join(r.pkgPath, string(filepath.ListSeparator)), genWuffs)
+		}
+		return nil, err
+	}
+	r.setCached(filename, src)
+	return src, nil
+}
+
+func (r *resolver) cached(filename string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	src, ok := r.apis[filename]
+	return src, ok
+}
+
+func (r *resolver) setCached(filename string, src []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apis[filename] = src
+}
+
+// resolveSourceDir parses and checks the .wuffs files in srcDir, resolving
+// their own use declarations recursively, and returns their public API.
+func (r *resolver) resolveSourceDir(chain []string, usePath string, srcDir string) ([]byte, error) {
+	pkgs, err := groupPackages([]string{srcDir})
+	if err != nil {
+		return nil, err
+	}
+	p := pkgs[0]
+
+	tm := &t.Map{}
+	files, err := parseFilesOptions(tm, p.filenames, r.tokOpts, nil)
+	if err != nil {
+		return nil, err
+	}
+	api, err := PublicAPI(tm, files)
+	if err != nil {
+		return nil, err
+	}
+
+	chain = append(chain[:len(chain):len(chain)], usePath)
+	_, err = check.Check(tm, files, func(filename string) ([]byte, error) {
+		return r.resolveFrom(chain, filename)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("package %q: %v", usePath, err)
+	}
+	return api, nil
+}
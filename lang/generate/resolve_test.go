@@ -0,0 +1,79 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolver(tt *testing.T) {
+	srcs := map[string]string{
+		// An API file, as written by "wuffs gen".
+		"api/one.wuffs": "pub struct one?()\n",
+
+		// Directories of source files.
+		"src/two/two.wuffs": "" +
+			"use \"one\"\n" +
+			"\n" +
+			"pub struct two?(\n" +
+			"\tn : base.u32,\n" +
+			")\n" +
+			"\n" +
+			"pub func two.get() base.u32 {\n" +
+			"\treturn this.n\n" +
+			"}\n",
+		"src/bad/bad.wuffs": "" +
+			"pub struct bad?()\n" +
+			"\n" +
+			"pub func bad.get() base.u32 {\n" +
+			"\treturn this.n\n" +
+			"}\n",
+		"src/cyc1/cyc1.wuffs": "use \"cyc2\"\n\npub struct cyc1?()\n",
+		"src/cyc2/cyc2.wuffs": "use \"cyc1\"\n\npub struct cyc2?()\n",
+	}
+
+	root := tt.TempDir()
+	for name, src := range srcs {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			tt.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+			tt.Fatal(err)
+		}
+	}
+	pkgPath := filepath.Join(root, "src") + string(filepath.ListSeparator) + filepath.Join(root, "api")
+
+	testCases := []struct {
+		filename string
+		want     string
+	}{
+		{"one.wuffs", "pub struct one?()\n"},
+		{"two.wuffs", "pub struct two?()\npub func two.get() base.u32 { }\n"},
+		{"bad.wuffs", `error: package "bad"`},
+		{"cyc1.wuffs", "cyclic use declarations"},
+	}
+
+	for _, tc := range testCases {
+		got := ""
+		if src, err := newResolver(pkgPath, nil).resolve(tc.filename); err != nil {
+			got = "error: " + err.Error()
+		} else {
+			got = string(src)
+		}
+		if !strings.Contains(got, tc.want) {
+			tt.Errorf("filename=%q: got %q, want it to contain %q", tc.filename, got, tc.want)
+		}
+	}
+}
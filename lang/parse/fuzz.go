@@ -0,0 +1,129 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+//go:build gofuzz
+// +build gofuzz
+
+package parse
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Fuzz is the entry point for go-fuzz (https://github.com/dvyukov/go-fuzz),
+// including its libFuzzer mode ("go-fuzz-build -libfuzzer"). It tokenizes data
+// and parses the resultant tokens, both with and without error recovery. It
+// returns 1 if data parsed successfully (making it an interesting input) and 0
+// otherwise. It panics if Parse panics or if the AST breaks an invariant, such
+// as a binary operator Expr having a nil operand (see ast.Validate).
+func Fuzz(data []byte) int {
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "fuzz.wuffs", data)
+	if err != nil {
+		return 0
+	}
+
+	// A partial AST, after error recovery, should still be well formed.
+	if f, _ := Parse(tm, "fuzz.wuffs", tokens, &Options{MaxErrors: 10}); f != nil {
+		if err := fuzzCheck(tokens, f); err != nil {
+			panic(err)
+		}
+	}
+
+	f, err := Parse(tm, "fuzz.wuffs", tokens, nil)
+	if err != nil {
+		return 0
+	}
+	if err := fuzzCheck(tokens, f); err != nil {
+		panic(err)
+	}
+	return 1
+}
+
+func fuzzCheck(tokens []t.Token, f *a.File) error {
+	if err := a.Validate(f.AsNode()); err != nil {
+		return err
+	}
+
+	// The File node's span is all of the tokens, even those that failed to
+	// parse, so only check its top level declarations.
+	if s := f.AsNode().Span(); s != (a.Span{Begin: 0, End: len(tokens)}) {
+		return fmt.Errorf("File node: span %v does not cover all %d tokens", s, len(tokens))
+	}
+	for _, o := range f.TopLevelDecls() {
+		if err := fuzzCheckNode(tokens, o, f.AsNode().Span()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fuzzCheckNode(tokens []t.Token, n *a.Node, parent a.Span) error {
+	s := n.Span()
+	if (s.Begin >= s.End) || (s.Begin < parent.Begin) || (s.End > parent.End) {
+		return fmt.Errorf("%s node: span %v is not within %v", n.Kind(), s, parent)
+	} else if !balanced(tokens[s.Begin:s.End]) {
+		return fmt.Errorf("%s node: unbalanced brackets in span %v", n.Kind(), s)
+	}
+
+	for _, o := range n.AsRaw().SubNodes() {
+		if o == nil {
+			continue
+		} else if err := fuzzCheckNode(tokens, o, s); err != nil {
+			return err
+		}
+	}
+	for _, l := range n.AsRaw().SubLists() {
+		for _, o := range l {
+			if err := fuzzCheckNode(tokens, o, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func balanced(tokens []t.Token) bool {
+	stack := []t.ID(nil)
+	for _, tok := range tokens {
+		switch tok.ID {
+		case t.IDOpenParen, t.IDOpenBracket, t.IDOpenCurly, t.IDOpenDoubleCurly:
+			stack = append(stack, tok.ID)
+			continue
+		case t.IDCloseParen:
+			if (len(stack) > 0) && (stack[len(stack)-1] == t.IDOpenParen) {
+				break
+			}
+			return false
+		case t.IDCloseBracket:
+			if (len(stack) > 0) && (stack[len(stack)-1] == t.IDOpenBracket) {
+				break
+			}
+			return false
+		case t.IDCloseCurly:
+			if (len(stack) > 0) && (stack[len(stack)-1] == t.IDOpenCurly) {
+				break
+			}
+			return false
+		case t.IDCloseDoubleCurly:
+			if (len(stack) > 0) && (stack[len(stack)-1] == t.IDOpenDoubleCurly) {
+				break
+			}
+			return false
+		default:
+			continue
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return len(stack) == 0
+}
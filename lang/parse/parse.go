@@ -14,6 +14,8 @@ package parse
 
 import (
 	"fmt"
+	"io"
+	"strings"
 
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
@@ -22,6 +24,49 @@ import (
 type Options struct {
 	AllowBuiltInNames          bool
 	AllowDoubleUnderscoreNames bool
+
+	// MaxErrors is the maximum number of syntax errors that Parse reports.
+	// If it is more than 1 then, after an error, Parse skips to the next
+	// top level declaration and carries on. It then returns a partial
+	// *ast.File, holding the declarations that parsed successfully, and an
+	// ErrorList. Otherwise, Parse stops at the first error.
+	MaxErrors int
+}
+
+// ErrorList is the error returned by Parse when Options.MaxErrors is more than
+// 1 and there were syntax errors. Each element gives its own position.
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	switch len(e) {
+	case 0:
+		return "parse: no errors"
+	case 1:
+		return e[0].Error()
+	}
+	b := strings.Builder{}
+	for i, err := range e {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// errorf returns a *t.Error at the next token.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return errorAt(p.file(), p.line(), p.col(), format, args...)
+}
+
+func errorAt(filename string, line uint32, col uint32, format string, args ...interface{}) error {
+	return &t.Error{
+		Code:     "parse",
+		Filename: filename,
+		Line:     line,
+		Col:      col,
+		Msg:      fmt.Sprintf(format, args...),
+	}
 }
 
 func validConstName(s string) bool {
@@ -57,52 +102,241 @@ func isStatusMessage(s string) bool {
 	return (c == '@') || (c == '#') || (c == '$')
 }
 
+// CgenPrefixPragma returns the prefix in x's `use "cgen prefix etc"` pragma,
+// and whether x is the "-string literal of such a pragma. That prefix, such as
+// "myapp_gif", replaces the default (e.g. "wuffs_gif") at the start of the C
+// code generator's identifiers.
+func CgenPrefixPragma(tm *t.Map, x t.ID) (prefix string, ok bool) {
+	const pre = `"cgen prefix `
+	if !x.IsDQStrLiteral(tm) {
+		return "", false
+	}
+	s := tm.ByID(x)
+	if !strings.HasPrefix(s, pre) {
+		return "", false
+	}
+	return s[len(pre) : len(s)-1], true
+}
+
 func Parse(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.File, error) {
-	p := &parser{
-		tm:       tm,
-		filename: filename,
-		src:      src,
+	return newParser(tm, filename, src, opts).parseFile()
+}
+
+// Incremental parses a file's tokens one top level declaration at a time,
+// so that a caller need not hold every declaration's AST at once.
+type Incremental struct {
+	p    *parser
+	err  error
+	errs int
+}
+
+// NewIncremental returns an Incremental that parses src. The opts' MaxErrors
+// applies as for Parse: Next keeps going after up to that many syntax errors.
+func NewIncremental(tm *t.Map, filename string, src []t.Token, opts *Options) *Incremental {
+	return &Incremental{
+		p: newParser(tm, filename, src, opts),
 	}
-	if len(src) > 0 {
-		p.lastLine = src[len(src)-1].Line
+}
+
+// Next returns the next top level declaration. It returns io.EOF when there
+// are no more. After a syntax error, Next skips to the following declaration
+// unless the error limit has been reached, in which case every later call
+// returns that same error.
+func (n *Incremental) Next() (*a.Node, error) {
+	if n.err != nil {
+		return nil, n.err
 	}
-	if opts != nil {
-		p.opts = *opts
+	d, err := n.p.nextTopLevelDecl()
+	if err != nil {
+		n.errs++
+		if (n.p.opts.MaxErrors <= 1) || (n.errs == n.p.opts.MaxErrors) {
+			n.err = err
+		} else {
+			n.p.skipToTopLevelDecl()
+		}
+		return nil, err
+	} else if d == nil {
+		n.err = io.EOF
+		return nil, io.EOF
 	}
-	return p.parseFile()
+	return d, nil
 }
 
-func ParseExpr(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.Expr, error) {
+func newParser(tm *t.Map, filename string, src []t.Token, opts *Options) *parser {
+	nOrigTokens := len(src)
+	src, docs, lineDirs, origIndexes := extractCommentTokens(tm, src)
 	p := &parser{
-		tm:       tm,
-		filename: filename,
-		src:      src,
+		tm:          tm,
+		filename:    filename,
+		tokens:      src,
+		src:         src,
+		docs:        docs,
+		lineDirs:    lineDirs,
+		origIndexes: origIndexes,
+		nOrigTokens: nOrigTokens,
 	}
 	if len(src) > 0 {
 		p.lastLine = src[len(src)-1].Line
+		p.lastCol = src[len(src)-1].Col
 	}
 	if opts != nil {
 		p.opts = *opts
 	}
-	return p.parseExpr()
+	return p
+}
+
+func ParseExpr(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.Expr, error) {
+	return newParser(tm, filename, src, opts).parseExpr()
+}
+
+// lineDirective is a `//#line N "file"` directive, which applies to the
+// tokens after it: those for which len(p.src) is no more than remaining.
+type lineDirective struct {
+	remaining int
+	filename  string
+	dLine     uint32
+}
+
+// extractCommentTokens returns src without any "///" doc comment or `//#line`
+// directive tokens. Each run of doc comments is returned in docs, keyed by the
+// number of remaining tokens (after extraction) at the point the run ends. If
+// any tokens were extracted, origIndexes maps each index in dst to the
+// corresponding index in src.
+func extractCommentTokens(tm *t.Map, src []t.Token) (dst []t.Token, docs map[int][]string, lineDirs []lineDirective, origIndexes []int) {
+	n := 0
+	for _, tok := range src {
+		if tok.ID.IsDocComment(tm) || tok.ID.IsLineDirective(tm) {
+			n++
+		}
+	}
+	if n == 0 {
+		return src, nil, nil, nil
+	}
+
+	dst = make([]t.Token, 0, len(src)-n)
+	origIndexes = make([]int, 0, len(src)-n)
+	run := []string(nil)
+	filename := ""
+	for i, tok := range src {
+		if tok.ID.IsDocComment(tm) {
+			run = append(run, tm.ByID(tok.ID))
+			continue
+		} else if tok.ID.IsLineDirective(tm) {
+			// The tokenizer has already rejected invalid directives.
+			line, f, _ := t.ParseLineDirective(tm.ByID(tok.ID))
+			if f != "" {
+				filename = f
+			}
+			lineDirs = append(lineDirs, lineDirective{
+				remaining: len(src) - n - len(dst),
+				filename:  filename,
+				dLine:     line - (tok.Line + 1),
+			})
+			continue
+		}
+		if run != nil {
+			if docs == nil {
+				docs = map[int][]string{}
+			}
+			docs[len(src)-n-len(dst)] = run
+			run = nil
+		}
+		dst = append(dst, tok)
+		origIndexes = append(origIndexes, i)
+	}
+	return dst, docs, lineDirs, origIndexes
 }
 
 type parser struct {
 	tm         *t.Map
 	filename   string
 	src        []t.Token
+	docs       map[int][]string
+	lineDirs   []lineDirective
 	opts       Options
 	lastLine   uint32
+	lastCol    uint32
 	funcEffect a.Effect
 	loops      a.LoopStack
 	allowVar   bool
+
+	// tokens is the complete (after extractCommentTokens) token slice, of
+	// which src is a suffix. origIndexes and nOrigTokens relate it to the
+	// token slice passed to Parse, for ast.Span values.
+	tokens      []t.Token
+	origIndexes []int
+	nOrigTokens int
+
+	// switchDepth is 1 plus the number of enclosing loops at the innermost
+	// enclosing switch statement, or 0 if there is no such switch.
+	switchDepth int
+
+	// cgenPrefixPragma is the "-string literal of the file's `use "cgen
+	// prefix etc"` pragma, if any.
+	cgenPrefixPragma t.ID
+}
+
+// lineDirective returns the `//#line` directive, if any, that applies to the
+// next token.
+func (p *parser) lineDirective() *lineDirective {
+	ret := (*lineDirective)(nil)
+	for i := range p.lineDirs {
+		if p.lineDirs[i].remaining < len(p.src) {
+			break
+		}
+		ret = &p.lineDirs[i]
+	}
+	return ret
+}
+
+// file returns the filename to report for the next token's position.
+func (p *parser) file() string {
+	if d := p.lineDirective(); (d != nil) && (d.filename != "") {
+		return d.filename
+	}
+	return p.filename
 }
 
 func (p *parser) line() uint32 {
+	line := p.lastLine
 	if len(p.src) != 0 {
-		return p.src[0].Line
+		line = p.src[0].Line
+	}
+	if d := p.lineDirective(); d != nil {
+		line += d.dLine
+	}
+	return line
+}
+
+func (p *parser) col() uint32 {
+	if len(p.src) != 0 {
+		return p.src[0].Col
+	}
+	return p.lastCol
+}
+
+// index returns the index, in p.tokens, of the next token.
+func (p *parser) index() int {
+	return len(p.tokens) - len(p.src)
+}
+
+// span returns the Span of the tokens consumed since p.index() was begin,
+// excluding any final (implicit) semicolon.
+func (p *parser) span(begin int) a.Span {
+	end := p.index()
+	if (end > (begin + 1)) && (p.tokens[end-1].ID == t.IDSemicolon) {
+		end--
+	}
+	if end <= begin {
+		return a.Span{}
+	} else if p.origIndexes == nil {
+		return a.Span{Begin: begin, End: end}
 	}
-	return p.lastLine
+	return a.Span{Begin: p.origIndexes[begin], End: p.origIndexes[end-1] + 1}
+}
+
+func (p *parser) setSpan(n *a.Node, begin int) {
+	n.AsRaw().SetSpan(p.span(begin))
 }
 
 func (p *parser) peek1() t.ID {
@@ -113,41 +347,119 @@ func (p *parser) peek1() t.ID {
 }
 
 func (p *parser) parseFile() (*a.File, error) {
-	topLevelDecls := []*a.Node(nil)
+	topLevelDecls, errs := []*a.Node(nil), ErrorList(nil)
+	for {
+		d, err := p.nextTopLevelDecl()
+		if err != nil {
+			if p.opts.MaxErrors <= 1 {
+				return nil, err
+			}
+			errs = append(errs, err)
+			if len(errs) == p.opts.MaxErrors {
+				break
+			}
+			p.skipToTopLevelDecl()
+		} else if d == nil {
+			break
+		} else {
+			topLevelDecls = append(topLevelDecls, d)
+		}
+	}
+	f := a.NewFile(p.filename, p.cgenPrefixPragma, topLevelDecls)
+	f.AsNode().AsRaw().SetSpan(a.Span{Begin: 0, End: p.nOrigTokens})
+	if errs != nil {
+		return f, errs
+	}
+	return f, nil
+}
+
+// nextTopLevelDecl returns the next top level declaration, with its doc
+// comment attached, or nil if there are no more.
+func (p *parser) nextTopLevelDecl() (*a.Node, error) {
 	for len(p.src) > 0 {
+		doc, begin, col := p.docs[len(p.src)], p.index(), p.col()
 		d, err := p.parseTopLevelDecl()
 		if err != nil {
 			return nil, err
+		} else if d != nil {
+			d.AsRaw().SetDoc(doc)
+			d.AsRaw().SetCol(col)
+			p.setSpan(d, begin)
+			// The parser should only build well formed nodes. Checking that
+			// here catches a constructor call with misplaced arguments.
+			if err := a.Validate(d); err != nil {
+				return nil, fmt.Errorf("parse: internal error: %v", err)
+			}
+			return d, nil
 		}
-		topLevelDecls = append(topLevelDecls, d)
 	}
-	return a.NewFile(p.filename, topLevelDecls), nil
+	return nil, nil
+}
+
+// skipToTopLevelDecl recovers from a syntax error by skipping tokens up to the
+// next "pub", "pri", "test" or "use" that starts a line, since those keywords
+// only begin top level declarations. It always skips at least one token, to
+// guarantee progress, and resets any per-function parser state.
+func (p *parser) skipToTopLevelDecl() {
+	for prevLine := uint32(0); len(p.src) > 0; {
+		if (prevLine != 0) && (prevLine < p.src[0].Line) {
+			switch p.src[0].ID {
+			case t.IDPub, t.IDPri, t.IDTest, t.IDUse:
+				p.funcEffect, p.loops, p.allowVar, p.switchDepth = 0, nil, false, 0
+				return
+			}
+		}
+		prevLine = p.src[0].Line
+		p.src = p.src[1:]
+	}
+	p.funcEffect, p.loops, p.allowVar, p.switchDepth = 0, nil, false, 0
 }
 
 func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 	flags := a.Flags(0)
-	line := p.src[0].Line
+	filename, line := p.file(), p.line()
 	switch k := p.peek1(); k {
 	case t.IDUse:
 		p.src = p.src[1:]
 		path := p.peek1()
 		if !path.IsDQStrLiteral(p.tm) {
 			got := p.tm.ByID(path)
-			return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "-string literal, got %q`, got)
 		}
 		p.src = p.src[1:]
 		if x := p.peek1(); x != t.IDSemicolon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected (implicit) ";", got %q`, got)
 		}
 		p.src = p.src[1:]
-		return a.NewUse(p.filename, line, path).AsNode(), nil
+		if path.IsDialectPragma(p.tm) {
+			// A `use "wuffs vX.Y"` pragma was handled by the tokenizer. It
+			// does not produce an AST node.
+			return nil, nil
+		} else if prefix, ok := CgenPrefixPragma(p.tm, path); ok {
+			// A `use "cgen prefix etc"` pragma is recorded on the ast.File,
+			// for the C code generator. It does not refer to a package.
+			if (p.cgenPrefixPragma != 0) && (p.cgenPrefixPragma != path) {
+				prev, _ := CgenPrefixPragma(p.tm, p.cgenPrefixPragma)
+				return nil, errorAt(filename, line, 0, `conflicting cgen prefix pragmas %q and %q`, prev, prefix)
+			}
+			p.cgenPrefixPragma = path
+			return nil, nil
+		}
+		return a.NewUse(filename, line, path).AsNode(), nil
 
 	case t.IDPub:
 		flags |= a.FlagsPublic
 		fallthrough
-	case t.IDPri:
+	case t.IDPri, t.IDTest:
 		p.src = p.src[1:]
+		if k == t.IDTest {
+			if x := p.peek1(); x != t.IDFunc {
+				got := p.tm.ByID(x)
+				return nil, p.errorf(`expected "func" after "test", got %q`, got)
+			}
+			flags |= a.FlagsTest
+		}
 		switch p.peek1() {
 		case t.IDConst:
 			p.src = p.src[1:]
@@ -156,13 +468,12 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if !validConstName(p.tm.ByID(id)) {
-				return nil, fmt.Errorf(`parse: invalid const name %q at %s:%d`,
-					p.tm.ByID(id), p.filename, p.line())
+				return nil, p.errorf(`invalid const name %q`, p.tm.ByID(id))
 			}
 
 			if x := p.peek1(); x != t.IDColon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected ":", got %q`, got)
 			}
 			p.src = p.src[1:]
 
@@ -171,8 +482,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if p.peek1() != t.IDEq {
-				return nil, fmt.Errorf(`parse: const %q has no value at %s:%d`,
-					p.tm.ByID(id), p.filename, p.line())
+				return nil, p.errorf(`const %q has no value`, p.tm.ByID(id))
 			}
 			p.src = p.src[1:]
 			value, err := p.parsePossibleListExpr()
@@ -181,10 +491,10 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected (implicit) ";", got %q`, got)
 			}
 			p.src = p.src[1:]
-			return a.NewConst(flags, p.filename, line, id, typ, value).AsNode(), nil
+			return a.NewConst(flags, filename, line, id, typ, value).AsNode(), nil
 
 		case t.IDFunc:
 			p.src = p.src[1:]
@@ -195,25 +505,36 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			if !p.opts.AllowBuiltInNames {
 				switch id1 {
 				case t.IDInitialize, t.IDReset:
-					return nil, fmt.Errorf(`parse: cannot have a method named %q at %s:%d`,
-						id1.Str(p.tm), p.filename, p.line())
+					return nil, p.errorf(`cannot have a method named %q`, id1.Str(p.tm))
 				}
 			}
 			// TODO: should we require id0 != 0? In other words, always methods
 			// (attached to receivers) and never free standing functions?
 			if !p.opts.AllowDoubleUnderscoreNames && containsDoubleUnderscore(p.tm.ByID(id1)) {
-				return nil, fmt.Errorf(`parse: double-underscore %q used for func name at %s:%d`,
-					p.tm.ByID(id1), p.filename, p.line())
+				return nil, p.errorf(`double-underscore %q used for func name`, p.tm.ByID(id1))
 			}
 
 			p.funcEffect = p.parseEffect()
 			flags |= p.funcEffect.AsFlags()
+			argBegin := p.index()
 			argFields, err := p.parseList(t.IDCloseParen, (*parser).parseFieldNode)
 			if err != nil {
 				return nil, err
 			}
-			out := (*a.TypeExpr)(nil)
-			if x := p.peek1(); (x != t.IDOpenCurly) && (x != t.IDComma) {
+			argSpan := p.span(argBegin)
+			outs, out := (*a.Struct)(nil), (*a.TypeExpr)(nil)
+			if x := p.peek1(); x == t.IDOpenParen {
+				outBegin := p.index()
+				outFields, err := p.parseList(t.IDCloseParen, (*parser).parseFieldNode)
+				if err != nil {
+					return nil, err
+				}
+				if len(outFields) < 2 {
+					return nil, p.errorf(`multiple return values need at least two out-params`)
+				}
+				outs = a.NewStruct(0, filename, line, 0, nil, outFields)
+				p.setSpan(outs.AsNode(), outBegin)
+			} else if (x != t.IDOpenCurly) && (x != t.IDComma) {
 				out, err = p.parseTypeExpr()
 				if err != nil {
 					return nil, err
@@ -225,17 +546,27 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				if p.peek1() == t.IDChoosy {
 					p.src = p.src[1:]
 					if (flags & a.FlagsPublic) != 0 {
-						return nil, fmt.Errorf(`parse: choosy function cannot be pub at %s:%d`,
-							p.filename, p.line())
+						return nil, p.errorf(`choosy function cannot be pub`)
 					} else if p.funcEffect.Coroutine() {
-						return nil, fmt.Errorf(`parse: choosy function cannot be a coroutine at %s:%d`,
-							p.filename, p.line())
+						return nil, p.errorf(`choosy function cannot be a coroutine`)
 					}
 					flags |= a.FlagsChoosy
 					if p.peek1() != t.IDOpenCurly {
 						if x := p.peek1(); x != t.IDComma {
-							return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`,
-								p.tm.ByID(x), p.filename, p.line())
+							return nil, p.errorf(`expected ",", got %q`, p.tm.ByID(x))
+						}
+						p.src = p.src[1:]
+					}
+				}
+				if p.peek1() == t.IDVia {
+					if (len(p.src) < 2) || (p.src[1].ID != t.IDInline) {
+						return nil, p.errorf(`expected "via inline"`)
+					}
+					p.src = p.src[2:]
+					flags |= a.FlagsInline
+					if p.peek1() != t.IDOpenCurly {
+						if x := p.peek1(); x != t.IDComma {
+							return nil, p.errorf(`expected ",", got %q`, p.tm.ByID(x))
 						}
 						p.src = p.src[1:]
 					}
@@ -255,8 +586,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 					} else if o.IsChooseCPUArch() {
 						flags |= a.FlagsHasChooseCPUArch
 					} else {
-						return nil, fmt.Errorf(`parse: invalid "choose" condition at %s:%d`,
-							p.filename, p.line())
+						return nil, p.errorf(`invalid "choose" condition`)
 					}
 				}
 			}
@@ -270,23 +600,62 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected (implicit) ";", got %q`, got)
 			}
 			p.src = p.src[1:]
 
+			if (flags & a.FlagsTest) != 0 {
+				// A test func's asserts are run-time checks in its body, and
+				// the generated test program calls it with no arguments.
+				msg := ""
+				switch {
+				case p.funcEffect.Coroutine():
+					msg = "be a coroutine"
+				case len(argFields) != 0:
+					msg = "have arguments"
+				case (outs != nil) || (out != nil):
+					msg = "have a return type"
+				case (flags & a.FlagsChoosy) != 0:
+					msg = "be choosy"
+				case len(asserts) != 0:
+					msg = "have pre or post conditions"
+				}
+				if msg != "" {
+					return nil, errorAt(filename, line, 0, `test function cannot %s`, msg)
+				}
+			}
+			if (flags & a.FlagsInline) != 0 {
+				// An inline func's calls are replaced by its body, or by a C
+				// call that the C compiler is told to inline.
+				msg := ""
+				switch {
+				case (flags & a.FlagsPublic) != 0:
+					msg = "be public"
+				case p.funcEffect.Coroutine():
+					msg = "be a coroutine"
+				case (flags & a.FlagsTest) != 0:
+					msg = "be a test function"
+				case (flags & a.FlagsChoosy) != 0:
+					msg = "be choosy"
+				case (flags & a.FlagsHasChooseCPUArch) != 0:
+					msg = "be a cpu_arch function"
+				}
+				if msg != "" {
+					return nil, errorAt(filename, line, 0, `inline function cannot %s`, msg)
+				}
+			}
 			if (flags & a.FlagsHasChooseCPUArch) != 0 {
 				if (flags & a.FlagsPublic) != 0 {
-					return nil, fmt.Errorf(`parse: cpu_arch function cannot be public at %s:%d`,
-						p.filename, p.line())
+					return nil, p.errorf(`cpu_arch function cannot be public`)
 				}
 				if (flags & a.FlagsChoosy) != 0 {
-					return nil, fmt.Errorf(`parse: cpu_arch function cannot be choosy at %s:%d`,
-						p.filename, p.line())
+					return nil, p.errorf(`cpu_arch function cannot be choosy`)
 				}
 			}
 			p.funcEffect = 0
-			in := a.NewStruct(0, p.filename, line, t.IDArgs, nil, argFields)
-			return a.NewFunc(flags, p.filename, line, id0, id1, in, out, asserts, body).AsNode(), nil
+			in := a.NewStruct(0, filename, line, t.IDArgs, nil, argFields)
+			in.AsNode().AsRaw().SetSpan(argSpan)
+			return a.NewFunc(flags, filename, line, id0, id1, in, outs, out, asserts, body).AsNode(), nil
 
 		case t.IDStatus:
 			p.src = p.src[1:]
@@ -294,19 +663,19 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			message := p.peek1()
 			if !message.IsDQStrLiteral(p.tm) {
 				got := p.tm.ByID(message)
-				return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected "-string literal, got %q`, got)
 			}
 			if s, _ := t.Unescape(p.tm.ByID(message)); !isStatusMessage(s) {
-				return nil, fmt.Errorf(`parse: status message %q does not start with `+
-					`@, # or $ at %s:%d`, s, p.filename, p.line())
+				return nil, p.errorf(`status message %q does not start with `+
+					`@, # or $`, s)
 			}
 			p.src = p.src[1:]
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected (implicit) ";", got %q`, got)
 			}
 			p.src = p.src[1:]
-			return a.NewStatus(flags, p.filename, line, message).AsNode(), nil
+			return a.NewStatus(flags, filename, line, message).AsNode(), nil
 
 		case t.IDStruct:
 			p.src = p.src[1:]
@@ -315,8 +684,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if !p.opts.AllowDoubleUnderscoreNames && containsDoubleUnderscore(p.tm.ByID(name)) {
-				return nil, fmt.Errorf(`parse: double-underscore %q used for struct name at %s:%d`,
-					p.tm.ByID(name), p.filename, p.line())
+				return nil, p.errorf(`double-underscore %q used for struct name`, p.tm.ByID(name))
 			}
 
 			if p.peek1() == t.IDQuestion {
@@ -332,7 +700,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 					return nil, err
 				}
 				if len(implements) > a.MaxImplements {
-					return nil, fmt.Errorf(`parse: too many implements listed at %s:%d`, p.filename, p.line())
+					return nil, p.errorf(`too many implements listed`)
 				}
 			}
 
@@ -343,8 +711,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			if x := p.peek1(); x == t.IDPlus {
 				p.src = p.src[1:]
 				if x := p.peek1(); x != t.IDOpenParen {
-					return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`,
-						p.tm.ByID(x), p.filename, p.line())
+					return nil, p.errorf(`expected "(", got %q`, p.tm.ByID(x))
 				}
 				extraFields, err := p.parseList(t.IDCloseParen, (*parser).parseExtraFieldNode)
 				if err != nil {
@@ -354,13 +721,13 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected (implicit) ";", got %q`, got)
 			}
 			p.src = p.src[1:]
-			return a.NewStruct(flags, p.filename, line, name, implements, fields).AsNode(), nil
+			return a.NewStruct(flags, filename, line, name, implements, fields).AsNode(), nil
 		}
 	}
-	return nil, fmt.Errorf(`parse: unrecognized top level declaration at %s:%d`, p.filename, line)
+	return nil, errorAt(filename, line, 0, `unrecognized top level declaration`)
 }
 
 func (p *parser) parseQualifiedIdentAsTypeExprNode() (*a.Node, error) {
@@ -400,12 +767,12 @@ func (p *parser) parseIdentAsExprNode() (*a.Node, error) {
 
 func (p *parser) parseIdent() (t.ID, error) {
 	if len(p.src) == 0 {
-		return 0, fmt.Errorf(`parse: expected identifier at %s:%d`, p.filename, p.line())
+		return 0, p.errorf(`expected identifier`)
 	}
 	x := p.src[0]
 	if !x.ID.IsIdent(p.tm) {
 		got := p.tm.ByID(x.ID)
-		return 0, fmt.Errorf(`parse: expected identifier, got %q at %s:%d`, got, p.filename, p.line())
+		return 0, p.errorf(`expected identifier, got %q`, got)
 	}
 	p.src = p.src[1:]
 	return x.ID, nil
@@ -414,8 +781,7 @@ func (p *parser) parseIdent() (t.ID, error) {
 func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error)) ([]*a.Node, error) {
 	if stop == t.IDCloseParen {
 		if x := p.peek1(); x != t.IDOpenParen {
-			return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`,
-				p.tm.ByID(x), p.filename, p.line())
+			return nil, p.errorf(`expected "(", got %q`, p.tm.ByID(x))
 		}
 		p.src = p.src[1:]
 	}
@@ -431,10 +797,12 @@ func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error))
 			return ret, nil
 		}
 
+		begin := p.index()
 		elem, err := parseElem(p)
 		if err != nil {
 			return nil, err
 		}
+		p.setSpan(elem, begin)
 		ret = append(ret, elem)
 
 		switch x := p.peek1(); x {
@@ -446,11 +814,10 @@ func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error))
 		case t.IDComma:
 			p.src = p.src[1:]
 		default:
-			return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d`,
-				p.tm.ByID(stop), p.tm.ByID(x), p.filename, p.line())
+			return nil, p.errorf(`expected %q, got %q`, p.tm.ByID(stop), p.tm.ByID(x))
 		}
 	}
-	return nil, fmt.Errorf(`parse: expected %q at %s:%d`, p.tm.ByID(stop), p.filename, p.line())
+	return nil, p.errorf(`expected %q`, p.tm.ByID(stop))
 }
 
 func (p *parser) parseFieldNode() (*a.Node, error) {
@@ -469,20 +836,25 @@ func (p *parser) parseExtraFieldNode() (*a.Node, error) {
 	if (typ.Decorator() != 0) ||
 		(typ.QID()[0] == t.IDBase) && (!typ.IsNumType() || typ.IsRefined()) {
 
-		return nil, fmt.Errorf(`parse: invalid extra-field type %q at %s:%d`,
-			n.AsField().XType().Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`invalid extra-field type %q`, n.AsField().XType().Str(p.tm))
 	}
 	return n, nil
 }
 
 func (p *parser) parseFieldNode1(flags a.Flags) (*a.Node, error) {
+	// "secret" is a modifier, as in "secret key : array[32] base.u8", unless
+	// it is the field's name, as in "secret : base.u32".
+	if (len(p.src) > 1) && (p.src[0].ID == t.IDSecret) && (p.src[1].ID != t.IDColon) {
+		p.src = p.src[1:]
+		flags |= a.FlagsSecret
+	}
 	name, err := p.parseIdent()
 	if err != nil {
 		return nil, err
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 	typ, err := p.parseTypeExpr()
@@ -496,6 +868,16 @@ func (p *parser) parseFieldNode1(flags a.Flags) (*a.Node, error) {
 }
 
 func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
+	begin := p.index()
+	n, err := p.parseTypeExpr1()
+	if err != nil {
+		return nil, err
+	}
+	p.setSpan(n.AsNode(), begin)
+	return n, nil
+}
+
+func (p *parser) parseTypeExpr1() (*a.TypeExpr, error) {
 	if x := p.peek1(); x == t.IDNptr || x == t.IDPtr {
 		p.src = p.src[1:]
 		rhs, err := p.parseTypeExpr()
@@ -513,7 +895,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 		if x := p.peek1(); x != t.IDOpenBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "[", got %q`, got)
 		}
 		p.src = p.src[1:]
 
@@ -525,7 +907,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 		if x := p.peek1(); x != t.IDCloseBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "]", got %q`, got)
 		}
 		p.src = p.src[1:]
 
@@ -557,7 +939,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 			((pkg == t.IDBase) || ((pkg == 0) && p.opts.AllowBuiltInNames)) {
 			// No-op.
 		} else {
-			return nil, fmt.Errorf(`parse: cannot refine non-numeric type at %s:%d`, p.filename, p.line())
+			return nil, p.errorf(`cannot refine non-numeric type`)
 		}
 	}
 
@@ -571,7 +953,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err error) {
 	if x := p.peek1(); x != t.IDOpenBracket {
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+		return 0, nil, nil, p.errorf(`expected "[", got %q`, got)
 	}
 	p.src = p.src[1:]
 
@@ -596,8 +978,7 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 			extra = ` or "]"`
 		}
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected %q%s, got %q at %s:%d`,
-			p.tm.ByID(sep), extra, got, p.filename, p.line())
+		return 0, nil, nil, p.errorf(`expected %q%s, got %q`, p.tm.ByID(sep), extra, got)
 	}
 
 	if p.peek1() != t.IDCloseBracket {
@@ -609,7 +990,7 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 
 	if x := p.peek1(); x != t.IDCloseBracket {
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+		return 0, nil, nil, p.errorf(`expected "]", got %q`, got)
 	}
 	p.src = p.src[1:]
 
@@ -620,12 +1001,12 @@ func (p *parser) parseBlock(doubleCurly bool) ([]*a.Node, error) {
 	if doubleCurly {
 		if x := p.peek1(); x != t.IDOpenDoubleCurly {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "{{", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "{{", got %q`, got)
 		}
 	} else {
 		if x := p.peek1(); x != t.IDOpenCurly {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "{", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "{", got %q`, got)
 		}
 	}
 	p.src = p.src[1:]
@@ -633,7 +1014,7 @@ func (p *parser) parseBlock(doubleCurly bool) ([]*a.Node, error) {
 	block := []*a.Node(nil)
 	for {
 		if len(p.src) == 0 {
-			return nil, fmt.Errorf(`parse: expected "}" or "}}" at %s:%d`, p.filename, p.line())
+			return nil, p.errorf(`expected "}" or "}}"`)
 		}
 
 		if doubleCurly {
@@ -654,7 +1035,7 @@ func (p *parser) parseBlock(doubleCurly bool) ([]*a.Node, error) {
 
 		if x := p.peek1(); x != t.IDSemicolon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected (implicit) ";", got %q`, got)
 		}
 		p.src = p.src[1:]
 	}
@@ -668,11 +1049,11 @@ func (p *parser) assertsSorted(asserts []*a.Node, allowChoose bool) error {
 	for _, o := range asserts {
 		switch o.AsAssert().Keyword() {
 		case t.IDAssert:
-			return fmt.Errorf(`parse: assertion chain cannot contain "assert", `+
-				`only "pre", "inv" and "post" at %s:%d`, p.filename, p.line())
+			return p.errorf(`assertion chain cannot contain "assert", ` +
+				`only "pre", "inv" and "post"`)
 		case t.IDChoose:
 			if !allowChoose {
-				return fmt.Errorf(`parse: invalid "choose" at %s:%d`, p.filename, p.line())
+				return p.errorf(`invalid "choose"`)
 			}
 			if seenPre || seenPost || seenInv {
 				break
@@ -694,8 +1075,7 @@ func (p *parser) assertsSorted(asserts []*a.Node, allowChoose bool) error {
 			seenPost = true
 			continue
 		}
-		return fmt.Errorf(`parse: assertion chain not in "choose", "pre", "inv", "post" order at %s:%d`,
-			p.filename, p.line())
+		return p.errorf(`assertion chain not in "choose", "pre", "inv", "post" order`)
 	}
 	return nil
 }
@@ -709,8 +1089,7 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 			return nil, err
 		}
 		if condition.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: assert-condition %q is not effect-free at %s:%d`,
-				condition.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`assert-condition %q is not effect-free`, condition.Str(p.tm))
 		}
 		reason, args := t.ID(0), []*a.Node(nil)
 		if p.peek1() == t.IDVia {
@@ -718,7 +1097,7 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 			reason = p.peek1()
 			if !reason.IsDQStrLiteral(p.tm) {
 				got := p.tm.ByID(reason)
-				return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, p.errorf(`expected "-string literal, got %q`, got)
 			}
 			p.src = p.src[1:]
 			args, err = p.parseList(t.IDCloseParen, (*parser).parseArgNode)
@@ -728,20 +1107,23 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 		}
 		return a.NewAssert(x, condition, reason, args).AsNode(), nil
 	}
-	return nil, fmt.Errorf(`parse: expected "assert", "pre" or "post" at %s:%d`, p.filename, p.line())
+	return nil, p.errorf(`expected "assert", "pre" or "post"`)
 }
 
 func (p *parser) parseStatement() (*a.Node, error) {
-	line := uint32(0)
+	filename, line, col, begin := p.file(), uint32(0), uint32(0), p.index()
 	if len(p.src) > 0 {
-		line = p.src[0].Line
+		line, col = p.line(), p.col()
 	}
 	n, err := p.parseStatement1()
 	if n != nil {
-		n.AsRaw().SetFilenameLine(p.filename, line)
+		n.AsRaw().SetFilenameLine(filename, line)
+		n.AsRaw().SetCol(col)
+		p.setSpan(n, begin)
 		if n.Kind() == a.KIterate {
 			for _, o := range n.AsIterate().Assigns() {
-				o.AsRaw().SetFilenameLine(p.filename, line)
+				o.AsRaw().SetFilenameLine(filename, line)
+				o.AsRaw().SetCol(col)
 			}
 		}
 	}
@@ -760,8 +1142,7 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 	x := p.peek1()
 	if x == t.IDVar {
 		if !p.allowVar {
-			return nil, fmt.Errorf(`parse: var statement not at the top of a function at %s:%d`,
-				p.filename, p.line())
+			return nil, p.errorf(`var statement not at the top of a function`)
 		}
 		p.src = p.src[1:]
 		return p.parseVarNode()
@@ -785,8 +1166,8 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		} else if label == 0 {
 			loop = p.loops.Top()
 			if loop.Label() != 0 {
-				return nil, fmt.Errorf(`parse: unlabeled %s for labeled %s.%s at %s:%d`,
-					x.Str(p.tm), loop.Keyword().Str(p.tm), loop.Label().Str(p.tm), p.filename, p.line())
+				return nil, p.errorf(`unlabeled %s for labeled %s.%s`,
+					x.Str(p.tm), loop.Keyword().Str(p.tm), loop.Label().Str(p.tm))
 			}
 		} else {
 			for i := len(p.loops) - 1; i >= 0; i-- {
@@ -801,11 +1182,13 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 			if label != 0 {
 				sepStr, labelStr = ".", label.Str(p.tm)
 			}
-			return nil, fmt.Errorf(`parse: no matching while/iterate statement for %s%s%s at %s:%d`,
-				x.Str(p.tm), sepStr, labelStr, p.filename, p.line())
+			return nil, p.errorf(`no matching while/iterate statement for %s%s%s`, x.Str(p.tm), sepStr, labelStr)
 		}
 
-		deep := loop != p.loops.Top()
+		// A "break" from within a switch, even of the innermost loop, is
+		// deep: the C code can't use C's "break" to leave both the C switch
+		// and the loop.
+		deep := (loop != p.loops.Top()) || ((x == t.IDBreak) && (p.switchDepth > len(p.loops)))
 		if x == t.IDBreak {
 			loop.SetHasBreak(deep)
 		} else {
@@ -818,7 +1201,7 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 	case t.IDChoose:
 		p.src = p.src[1:]
 		if p.funcEffect.Pure() {
-			return nil, fmt.Errorf(`parse: choose within pure function at %s:%d`, p.filename, p.line())
+			return nil, p.errorf(`choose within pure function`)
 		}
 		name, err := p.parseIdent()
 		if err != nil {
@@ -826,12 +1209,12 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		}
 		if x := p.peek1(); x != t.IDEq {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "=", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "=", got %q`, got)
 		}
 		p.src = p.src[1:]
 		if x := p.peek1(); x != t.IDOpenBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "[", got %q`, got)
 		}
 		p.src = p.src[1:]
 		args, err := p.parseList(t.IDCloseBracket, (*parser).parseIdentAsExprNode)
@@ -850,31 +1233,56 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 	case t.IDIterate:
 		return p.parseIterateNode()
 
+	case t.IDSwitch:
+		return p.parseSwitchNode()
+
 	case t.IDReturn, t.IDYield:
 		p.src = p.src[1:]
 		if x == t.IDYield {
 			if !p.funcEffect.Coroutine() {
-				return nil, fmt.Errorf(`parse: yield within non-coroutine at %s:%d`, p.filename, p.line())
+				return nil, p.errorf(`yield within non-coroutine`)
 			}
 			if p.peek1() != t.IDQuestion {
-				return nil, fmt.Errorf(`parse: yield not followed by '?' at %s:%d`, p.filename, p.line())
+				return nil, p.errorf(`yield not followed by '?'`)
 			}
 			p.src = p.src[1:]
+		} else if (p.peek1() == t.IDError) && (len(p.src) > 1) && p.src[1].ID.IsDQStrLiteral(p.tm) {
+			value, err := p.parseErrorStatus()
+			if err != nil {
+				return nil, err
+			}
+			return a.NewRet(a.FlagsErrorKeyword, x, value).AsNode(), nil
 		}
+		valueBegin := p.index()
 		value, err := p.parseExpr()
 		if err != nil {
 			return nil, err
 		}
 		if value.Effect().Impure() {
-			return nil, fmt.Errorf(`parse: %s an impure expression at %s:%d`,
-				x.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`%s an impure expression`, x.Str(p.tm))
+		}
+		if (x == t.IDReturn) && (p.peek1() == t.IDComma) {
+			values := []*a.Node{value.AsNode()}
+			for p.peek1() == t.IDComma {
+				p.src = p.src[1:]
+				v, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				if v.Effect().Impure() {
+					return nil, p.errorf(`%s an impure expression`, x.Str(p.tm))
+				}
+				values = append(values, v.AsNode())
+			}
+			value = a.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, values)
+			p.setSpan(value.AsNode(), valueBegin)
 		}
 		if (x == t.IDReturn) && (value.Operator() == 0) {
 			if s := p.tm.ByID(value.Ident()); (len(s) > 1) && (s[0] == '"') && (s[1] == '$') {
-				return nil, fmt.Errorf(`parse: cannot return a suspension at %s:%d`, p.filename, p.line())
+				return nil, p.errorf(`cannot return a suspension`)
 			}
 		}
-		return a.NewRet(x, value).AsNode(), nil
+		return a.NewRet(0, x, value).AsNode(), nil
 
 	case t.IDWhile:
 		p.src = p.src[1:]
@@ -887,8 +1295,7 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 			return nil, err
 		}
 		if condition.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: while-condition %q is not effect-free at %s:%d`,
-				condition.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`while-condition %q is not effect-free`, condition.Str(p.tm))
 		}
 		asserts, err := p.parseAsserts()
 		if err != nil {
@@ -897,13 +1304,11 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 
 		n := a.NewWhile(label, condition, asserts)
 		if !p.loops.Push(n) {
-			return nil, fmt.Errorf(`parse: duplicate loop label %s at %s:%d`,
-				label.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`duplicate loop label %s`, label.Str(p.tm))
 		}
 		doubleCurly := p.peek1() == t.IDOpenDoubleCurly
 		if doubleCurly && !n.IsWhileTrue() {
-			return nil, fmt.Errorf(`parse: double {{ }} while loop condition isn't "true" at %s:%d`,
-				p.filename, p.line())
+			return nil, p.errorf(`double {{ }} while loop condition isn't "true"`)
 		}
 		body, err := p.parseBlock(doubleCurly)
 		if err != nil {
@@ -922,19 +1327,16 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 				}
 			}
 			if !seenDotLabel {
-				return nil, fmt.Errorf(`parse: expected .%s at %s:%d`,
-					label.Str(p.tm), p.filename, p.line())
+				return nil, p.errorf(`expected .%s`, label.Str(p.tm))
 			}
 		}
 
 		if !doubleCurly {
 			// No-op.
 		} else if n.HasContinue() {
-			return nil, fmt.Errorf(`parse: double {{ }} while loop has explicit continue at %s:%d`,
-				p.filename, p.line())
+			return nil, p.errorf(`double {{ }} while loop has explicit continue`)
 		} else if !a.Terminates(body) {
-			return nil, fmt.Errorf(`parse: double {{ }} while loop doesn't terminate at %s:%d`,
-				p.filename, p.line())
+			return nil, p.errorf(`double {{ }} while loop doesn't terminate`)
 		}
 		return n.AsNode(), nil
 	}
@@ -943,41 +1345,59 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 
 func (p *parser) parseAssignNode() (*a.Node, error) {
 	lhs := (*a.Expr)(nil)
+	begin := p.index()
 	rhs, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
 
+	// A multiple assignment, "x, y = etc", has a list Expr LHS.
+	lhsElems := []*a.Node{rhs.AsNode()}
+	if p.peek1() == t.IDComma {
+		for p.peek1() == t.IDComma {
+			p.src = p.src[1:]
+			o, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			lhsElems = append(lhsElems, o.AsNode())
+		}
+		rhs = a.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, lhsElems)
+		p.setSpan(rhs.AsNode(), begin)
+		if x := p.peek1(); x != t.IDEq {
+			got := p.tm.ByID(x)
+			return nil, p.errorf(`expected "=" after multiple assignment LHS, got %q`, got)
+		}
+	}
+
 	op := p.peek1()
 	if op.IsAssign() {
 		p.src = p.src[1:]
 		lhs = rhs
-		if lhs.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: assignment LHS %q is not effect-free at %s:%d`,
-				lhs.Str(p.tm), p.filename, p.line())
-		}
-
-		for l := lhs; l != nil; l = l.LHS().AsExpr() {
-			switch l.Operator() {
-			case 0:
-				if id := l.Ident(); id.IsLiteral(p.tm) {
-					return nil, fmt.Errorf(`parse: assignment LHS %q is a literal at %s:%d`,
-						l.Str(p.tm), p.filename, p.line())
-				} else if id.IsCannotAssignTo() {
-					if l == lhs {
-						return nil, fmt.Errorf(`parse: cannot assign to %q at %s:%d`,
-							id.Str(p.tm), p.filename, p.line())
-					}
-					if !p.funcEffect.Impure() {
-						return nil, fmt.Errorf(`parse: cannot assign to %q in a pure function at %s:%d`,
-							lhs.Str(p.tm), p.filename, p.line())
+
+		for _, o := range lhsElems {
+			elem := o.AsExpr()
+			if elem.Effect() != 0 {
+				return nil, p.errorf(`assignment LHS %q is not effect-free`, elem.Str(p.tm))
+			}
+			for l := elem; l != nil; l = l.LHS().AsExpr() {
+				switch l.Operator() {
+				case 0:
+					if id := l.Ident(); id.IsLiteral(p.tm) {
+						return nil, p.errorf(`assignment LHS %q is a literal`, l.Str(p.tm))
+					} else if id.IsCannotAssignTo() {
+						if l == elem {
+							return nil, p.errorf(`cannot assign to %q`, id.Str(p.tm))
+						}
+						if !p.funcEffect.Impure() {
+							return nil, p.errorf(`cannot assign to %q in a pure function`, elem.Str(p.tm))
+						}
 					}
+				case t.IDDot, t.IDOpenBracket:
+					// No-op.
+				default:
+					return nil, p.errorf(`invalid assignment LHS %q`, elem.Str(p.tm))
 				}
-			case t.IDDot, t.IDOpenBracket:
-				// No-op.
-			default:
-				return nil, fmt.Errorf(`parse: invalid assignment LHS %q at %s:%d`,
-					lhs.Str(p.tm), p.filename, p.line())
 			}
 		}
 
@@ -986,10 +1406,12 @@ func (p *parser) parseAssignNode() (*a.Node, error) {
 			return nil, err
 		}
 
+		if (lhs.Operator() == a.ExprOperatorList) && (rhs.Operator() != a.ExprOperatorCall) {
+			return nil, p.errorf(`expected function call after multiple assignment LHS, got %q`, rhs.Str(p.tm))
+		}
 		if op == t.IDEqQuestion {
 			if (rhs.Operator() != a.ExprOperatorCall) || (!rhs.Effect().Coroutine()) {
-				return nil, fmt.Errorf(`parse: expected ?-function call after "=?", got %q at %s:%d`,
-					rhs.Str(p.tm), p.filename, p.line())
+				return nil, p.errorf(`expected ?-function call after "=?", got %q`, rhs.Str(p.tm))
 			}
 		}
 	} else {
@@ -997,8 +1419,8 @@ func (p *parser) parseAssignNode() (*a.Node, error) {
 	}
 
 	if p.funcEffect.WeakerThan(rhs.Effect()) {
-		return nil, fmt.Errorf(`parse: value %q's effect %q is stronger than the func's effect %q at %s:%d`,
-			rhs.Str(p.tm), rhs.Effect(), p.funcEffect, p.filename, p.line())
+		return nil, p.errorf(`value %q's effect %q is stronger than the func's effect %q`,
+			rhs.Str(p.tm), rhs.Effect(), p.funcEffect)
 	}
 
 	return a.NewAssign(op, lhs, rhs).AsNode(), nil
@@ -1011,13 +1433,15 @@ func (p *parser) parseIterateAssignNode() (*a.Node, error) {
 	}
 	o := n.AsAssign()
 	if op := o.Operator(); op != t.IDEq {
-		return nil, fmt.Errorf(`parse: expected "=", got %q at %s:%d`, op.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`expected "=", got %q`, op.Str(p.tm))
 	}
-	if lhs := o.LHS(); lhs.Operator() != 0 {
-		return nil, fmt.Errorf(`parse: expected variable, got %q at %s:%d`, lhs.Str(p.tm), p.filename, p.line())
+	if lhs := o.LHS(); lhs == nil {
+		return nil, p.errorf(`expected variable, got %q`, o.RHS().Str(p.tm))
+	} else if lhs.Operator() != 0 {
+		return nil, p.errorf(`expected variable, got %q`, lhs.Str(p.tm))
 	}
 	if rhs := o.RHS(); rhs.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: value %q is not effect-free at %s:%d`, rhs.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`value %q is not effect-free`, rhs.Str(p.tm))
 	}
 	return o.AsNode(), nil
 }
@@ -1043,19 +1467,19 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 
 	if x := p.peek1(); x != t.IDOpenParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "(", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDIO {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "io", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "io", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 
@@ -1064,8 +1488,7 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 		return nil, err
 	}
 	if io.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d`,
-			io.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`argument %q is not effect-free`, io.Str(p.tm))
 	}
 
 	arg1Name := t.ID(0)
@@ -1073,16 +1496,14 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 	case t.IDIOBind:
 		arg1Name = t.IDData
 		if io.Operator() != 0 {
-			return nil, fmt.Errorf(`parse: invalid %s argument %q at %s:%d`,
-				keyword.Str(p.tm), io.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`invalid %s argument %q`, keyword.Str(p.tm), io.Str(p.tm))
 		}
 	case t.IDIOForgetHistory:
 		// No-op.
 	case t.IDIOLimit:
 		arg1Name = t.IDLimit
 		if (io.Operator() != 0) && (io.IsArgsDotFoo() == 0) {
-			return nil, fmt.Errorf(`parse: invalid %s argument %q at %s:%d`,
-				keyword.Str(p.tm), io.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`invalid %s argument %q`, keyword.Str(p.tm), io.Str(p.tm))
 		}
 	}
 
@@ -1090,19 +1511,19 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 	if arg1Name != 0 {
 		if x := p.peek1(); x != t.IDComma {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected ",", got %q`, got)
 		}
 		p.src = p.src[1:]
 
 		if x := p.peek1(); x != arg1Name {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d`, arg1Name.Str(p.tm), got, p.filename, p.line())
+			return nil, p.errorf(`expected %q, got %q`, arg1Name.Str(p.tm), got)
 		}
 		p.src = p.src[1:]
 
 		if x := p.peek1(); x != t.IDColon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected ":", got %q`, got)
 		}
 		p.src = p.src[1:]
 
@@ -1111,8 +1532,7 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 			return nil, err
 		}
 		if arg1.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d`,
-				io.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`argument %q is not effect-free`, io.Str(p.tm))
 		}
 	}
 
@@ -1120,19 +1540,19 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 	if keyword == t.IDIOBind {
 		if x := p.peek1(); x != t.IDComma {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected ",", got %q`, got)
 		}
 		p.src = p.src[1:]
 
 		if x := p.peek1(); x != t.IDHistoryPosition {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "history_position", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected "history_position", got %q`, got)
 		}
 		p.src = p.src[1:]
 
 		if x := p.peek1(); x != t.IDColon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected ":", got %q`, got)
 		}
 		p.src = p.src[1:]
 
@@ -1141,14 +1561,13 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 			return nil, err
 		}
 		if histPos.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d`,
-				io.Str(p.tm), p.filename, p.line())
+			return nil, p.errorf(`argument %q is not effect-free`, io.Str(p.tm))
 		}
 	}
 
 	if x := p.peek1(); x != t.IDCloseParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ")", got %q`, got)
 	}
 	p.src = p.src[1:]
 
@@ -1163,7 +1582,7 @@ func (p *parser) parseIOManipNode() (*a.Node, error) {
 func (p *parser) parseIf() (*a.If, error) {
 	if x := p.peek1(); x != t.IDIf {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "if", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "if", got %q`, got)
 	}
 	p.src = p.src[1:]
 	likelihood, err := p.parseLabel()
@@ -1174,15 +1593,14 @@ func (p *parser) parseIf() (*a.If, error) {
 	case 0, t.IDLikely, t.IDUnlikely:
 	default:
 		got := p.tm.ByID(likelihood)
-		return nil, fmt.Errorf(`parse: expected "if.likely" or "if.unlikely", got %q at %s:%d`, "if."+got, p.filename, p.line())
+		return nil, p.errorf(`expected "if.likely" or "if.unlikely", got %q`, "if."+got)
 	}
 	condition, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
 	if condition.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: if-condition %q is not effect-free at %s:%d`,
-			condition.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`if-condition %q is not effect-free`, condition.Str(p.tm))
 	}
 	bodyIfTrue, err := p.parseBlock(false)
 	if err != nil {
@@ -1192,10 +1610,12 @@ func (p *parser) parseIf() (*a.If, error) {
 	if p.peek1() == t.IDElse {
 		p.src = p.src[1:]
 		if p.peek1() == t.IDIf {
+			begin := p.index()
 			elseIf, err = p.parseIf()
 			if err != nil {
 				return nil, err
 			}
+			p.setSpan(elseIf.AsNode(), begin)
 		} else {
 			bodyIfFalse, err = p.parseBlock(false)
 			if err != nil {
@@ -1206,12 +1626,104 @@ func (p *parser) parseIf() (*a.If, error) {
 	return a.NewIf(likelihood, condition, bodyIfTrue, bodyIfFalse, elseIf), nil
 }
 
+func (p *parser) parseSwitchNode() (*a.Node, error) {
+	if x := p.peek1(); x != t.IDSwitch {
+		got := p.tm.ByID(x)
+		return nil, p.errorf(`expected "switch", got %q`, got)
+	}
+	p.src = p.src[1:]
+	subject, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if subject.Effect() != 0 {
+		return nil, p.errorf(`switch subject %q is not effect-free`, subject.Str(p.tm))
+	}
+	if x := p.peek1(); x != t.IDOpenCurly {
+		got := p.tm.ByID(x)
+		return nil, p.errorf(`expected "{", got %q`, got)
+	}
+	p.src = p.src[1:]
+
+	oldSwitchDepth := p.switchDepth
+	p.switchDepth = len(p.loops) + 1
+	defer func() { p.switchDepth = oldSwitchDepth }()
+
+	cases, seenDefault := []*a.Node(nil), false
+	for {
+		x, begin := p.peek1(), p.index()
+		if x == t.IDCloseCurly {
+			p.src = p.src[1:]
+			break
+		} else if seenDefault {
+			got := p.tm.ByID(x)
+			return nil, p.errorf(`expected "}" after "default", got %q`, got)
+		} else if (x != t.IDCase) && (x != t.IDDefault) {
+			got := p.tm.ByID(x)
+			return nil, p.errorf(`expected "case", "default" or "}", got %q`, got)
+		}
+		p.src = p.src[1:]
+
+		values := []*a.Node(nil)
+		if x == t.IDCase {
+			for {
+				value, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				if value.Effect() != 0 {
+					return nil, p.errorf(`case value %q is not effect-free`, value.Str(p.tm))
+				}
+				values = append(values, value.AsNode())
+				if p.peek1() != t.IDComma {
+					break
+				}
+				p.src = p.src[1:]
+			}
+		} else {
+			seenDefault = true
+		}
+
+		body, err := p.parseBlock(false)
+		if err != nil {
+			return nil, err
+		}
+		c := a.NewCase(x, values, body).AsNode()
+		p.setSpan(c, begin)
+		cases = append(cases, c)
+
+		if p.peek1() == t.IDSemicolon {
+			p.src = p.src[1:]
+		}
+	}
+	return a.NewSwitch(subject, cases).AsNode(), nil
+}
+
+// parseErrorStatus parses the `error "msg"` in `return error "msg"`,
+// returning the equivalent `"#msg"` status literal.
+func (p *parser) parseErrorStatus() (*a.Expr, error) {
+	begin := p.index()
+	p.src = p.src[1:]
+	msg := p.tm.ByID(p.src[0].ID)
+	if (len(msg) > 1) && ((msg[1] == '#') || (msg[1] == '$') || (msg[1] == '@')) {
+		return nil, p.errorf(`error message %s already has a status prefix`, msg)
+	}
+	p.src = p.src[1:]
+	id, err := p.tm.Insert(`"#` + msg[1:])
+	if err != nil {
+		return nil, err
+	}
+	n := a.NewExpr(0, 0, id, nil, nil, nil, nil)
+	p.setSpan(n.AsNode(), begin)
+	return n, nil
+}
+
 func (p *parser) parseIterateNode() (*a.Node, error) {
 	if p.funcEffect.Coroutine() {
-		return nil, fmt.Errorf(`parse: "iterate" inside coroutine at %s:%d`, p.filename, p.line())
+		return nil, p.errorf(`"iterate" inside coroutine`)
 	} else if x := p.peek1(); x != t.IDIterate {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "iterate", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "iterate", got %q`, got)
 	}
 	p.src = p.src[1:]
 	label, err := p.parseLabel()
@@ -1232,87 +1744,84 @@ func (p *parser) parseIterateNode() (*a.Node, error) {
 func (p *parser) parseIterateBlock(label t.ID, assigns []*a.Node) (*a.Iterate, error) {
 	if x := p.peek1(); x != t.IDOpenParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "(", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDLength {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "length", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "length", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	length := p.peek1()
 	lengthInt := asSmallPositiveInt256(p.tm, length)
 	if lengthInt == 0 {
-		return nil, fmt.Errorf(`parse: expected length count in [1 ..= 256], got %q at %s:%d`,
-			p.tm.ByID(length), p.filename, p.line())
+		return nil, p.errorf(`expected length count in [1 ..= 256], got %q`, p.tm.ByID(length))
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDComma {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ",", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDAdvance {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "advance", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "advance", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	advance := p.peek1()
 	advanceInt := asSmallPositiveInt256(p.tm, advance)
 	if advanceInt == 0 {
-		return nil, fmt.Errorf(`parse: expected advance count in [1 ..= 256], got %q at %s:%d`,
-			p.tm.ByID(advance), p.filename, p.line())
+		return nil, p.errorf(`expected advance count in [1 ..= 256], got %q`, p.tm.ByID(advance))
 	} else if advanceInt > lengthInt {
-		return nil, fmt.Errorf(`parse: advance %d is larger than length %d at %s:%d`,
-			advanceInt, lengthInt, p.filename, p.line())
+		return nil, p.errorf(`advance %d is larger than length %d`, advanceInt, lengthInt)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDComma {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ",", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDUnroll {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "unroll", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected "unroll", got %q`, got)
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 
-	unroll := p.peek1()
+	unroll, unrollBegin := p.peek1(), p.index()
 	if asSmallPositiveInt256(p.tm, unroll) == 0 {
-		return nil, fmt.Errorf(`parse: expected unroll count in [1 ..= 256], got %q at %s:%d`,
-			p.tm.ByID(unroll), p.filename, p.line())
+		return nil, p.errorf(`expected unroll count in [1 ..= 256], got %q`, p.tm.ByID(unroll))
 	}
 	p.src = p.src[1:]
+	unrollSpan := p.span(unrollBegin)
 
 	if x := p.peek1(); x != t.IDCloseParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ")", got %q`, got)
 	}
 	p.src = p.src[1:]
 
@@ -1321,10 +1830,10 @@ func (p *parser) parseIterateBlock(label t.ID, assigns []*a.Node) (*a.Iterate, e
 		return nil, err
 	}
 	n := a.NewIterate(label, assigns, length, advance, unroll, asserts)
+	n.UnrollAsExpr().AsNode().AsRaw().SetSpan(unrollSpan)
 	// TODO: decide how break/continue work with iterate loops.
 	if !p.loops.Push(n) {
-		return nil, fmt.Errorf(`parse: duplicate loop label %s at %s:%d`,
-			label.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`duplicate loop label %s`, label.Str(p.tm))
 	}
 	body, err := p.parseBlock(false)
 	if err != nil {
@@ -1335,10 +1844,12 @@ func (p *parser) parseIterateBlock(label t.ID, assigns []*a.Node) (*a.Iterate, e
 
 	if x := p.peek1(); x == t.IDElse {
 		p.src = p.src[1:]
+		begin := p.index()
 		elseIterate, err := p.parseIterateBlock(0, nil)
 		if err != nil {
 			return nil, err
 		}
+		p.setSpan(elseIterate.AsNode(), begin)
 		n.SetElseIterate(elseIterate)
 	}
 
@@ -1375,7 +1886,7 @@ func (p *parser) parseArgNode() (*a.Node, error) {
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 	value, err := p.parseExpr()
@@ -1383,8 +1894,7 @@ func (p *parser) parseArgNode() (*a.Node, error) {
 		return nil, err
 	}
 	if value.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: arg-value %q is not effect-free at %s:%d`,
-			value.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`arg-value %q is not effect-free`, value.Str(p.tm))
 	}
 	return a.NewArg(name, value).AsNode(), nil
 }
@@ -1396,7 +1906,7 @@ func (p *parser) parseVarNode() (*a.Node, error) {
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, p.errorf(`expected ":", got %q`, got)
 	}
 	p.src = p.src[1:]
 	typ, err := p.parseTypeExpr()
@@ -1416,15 +1926,44 @@ func (p *parser) parsePossibleListExprNode() (*a.Node, error) {
 
 func (p *parser) parsePossibleListExpr() (*a.Expr, error) {
 	// TODO: put the [ and ] parsing into parseExpr.
-	if x := p.peek1(); x != t.IDOpenBracket {
+	if x := p.peek1(); x.IsRawStrLiteral(p.tm) {
+		return p.parseRawStrLiteral()
+	} else if x != t.IDOpenBracket {
 		return p.parseExpr()
 	}
+	begin := p.index()
 	p.src = p.src[1:]
 	args, err := p.parseList(t.IDCloseBracket, (*parser).parsePossibleListExprNode)
 	if err != nil {
 		return nil, err
 	}
-	return a.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, args), nil
+	n := a.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, args)
+	p.setSpan(n.AsNode(), begin)
+	return n, nil
+}
+
+// parseRawStrLiteral converts a `raw` string literal to the equivalent list
+// of byte values, such as [0x72, 0x61, 0x77], suitable for initializing an
+// "array[N] base.u8" const.
+func (p *parser) parseRawStrLiteral() (*a.Expr, error) {
+	begin := p.index()
+	s := p.tm.ByID(p.src[0].ID)
+	s = s[1 : len(s)-1]
+	args := make([]*a.Node, 0, len(s))
+	p.src = p.src[1:]
+	span := p.span(begin)
+	for i := 0; i < len(s); i++ {
+		id, err := p.tm.Insert(fmt.Sprintf("0x%02X", s[i]))
+		if err != nil {
+			return nil, err
+		}
+		arg := a.NewExpr(0, 0, id, nil, nil, nil, nil).AsNode()
+		arg.AsRaw().SetSpan(span)
+		args = append(args, arg)
+	}
+	n := a.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, args)
+	n.AsNode().AsRaw().SetSpan(span)
+	return n, nil
 }
 
 func (p *parser) parseExpr() (*a.Expr, error) {
@@ -1433,26 +1972,33 @@ func (p *parser) parseExpr() (*a.Expr, error) {
 		return nil, err
 	}
 	if e.SubExprHasEffect() {
-		return nil, fmt.Errorf(`parse: expression %q has an effect-ful sub-expression at %s:%d`,
-			e.Str(p.tm), p.filename, p.line())
+		return nil, p.errorf(`expression %q has an effect-ful sub-expression`, e.Str(p.tm))
 	}
 	return e, nil
 }
 
 func (p *parser) parseExpr1() (*a.Expr, error) {
+	begin := p.index()
 	lhs, err := p.parseOperand()
 	if err != nil {
 		return nil, err
 	}
 	if x := p.peek1(); x.IsBinaryOp() {
 		p.src = p.src[1:]
-		rhs := (*a.Node)(nil)
+		rhs, flags := (*a.Node)(nil), a.Flags(0)
 		if x == t.IDAs {
 			o, err := p.parseTypeExpr()
 			if err != nil {
 				return nil, err
 			}
 			rhs = o.AsNode()
+			if p.peek1() == t.IDVia {
+				if (len(p.src) < 2) || (p.src[1].ID != t.IDTruncate) {
+					return nil, p.errorf(`expected "via truncate"`)
+				}
+				p.src = p.src[2:]
+				flags = a.FlagsTruncate
+			}
 		} else {
 			o, err := p.parseOperand()
 			if err != nil {
@@ -1466,7 +2012,9 @@ func (p *parser) parseExpr1() (*a.Expr, error) {
 			if op == 0 {
 				return nil, fmt.Errorf(`parse: internal error: no binary form for token 0x%02X`, x)
 			}
-			return a.NewExpr(0, op, 0, lhs.AsNode(), nil, rhs, nil), nil
+			n := a.NewExpr(flags, op, 0, lhs.AsNode(), nil, rhs, nil)
+			p.setSpan(n.AsNode(), begin)
+			return n, nil
 		}
 
 		args := []*a.Node{lhs.AsNode(), rhs}
@@ -1482,12 +2030,15 @@ func (p *parser) parseExpr1() (*a.Expr, error) {
 		if op == 0 {
 			return nil, fmt.Errorf(`parse: internal error: no associative form for token 0x%02X`, x)
 		}
-		return a.NewExpr(0, op, 0, nil, nil, nil, args), nil
+		n := a.NewExpr(0, op, 0, nil, nil, nil, args)
+		p.setSpan(n.AsNode(), begin)
+		return n, nil
 	}
 	return lhs, nil
 }
 
 func (p *parser) parseOperand() (*a.Expr, error) {
+	begin := p.index()
 	switch x := p.peek1(); {
 	case x.IsUnaryOp():
 		p.src = p.src[1:]
@@ -1499,11 +2050,20 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		if op == 0 {
 			return nil, fmt.Errorf(`parse: internal error: no unary form for token 0x%02X`, x)
 		}
-		return a.NewExpr(0, op, 0, nil, nil, rhs.AsNode(), nil), nil
+		n := a.NewExpr(0, op, 0, nil, nil, rhs.AsNode(), nil)
+		p.setSpan(n.AsNode(), begin)
+		return n, nil
+
+	case x.IsRawStrLiteral(p.tm):
+		// parsePossibleListExpr handles the raw literals that initialize a
+		// const, so this one is somewhere else.
+		return nil, p.errorf(`raw literal is only allowed in a const initializer`)
 
 	case x.IsLiteral(p.tm):
 		p.src = p.src[1:]
-		return a.NewExpr(0, 0, x, nil, nil, nil, nil), nil
+		n := a.NewExpr(0, 0, x, nil, nil, nil, nil)
+		p.setSpan(n.AsNode(), begin)
+		return n, nil
 
 	case x == t.IDOpenParen:
 		p.src = p.src[1:]
@@ -1513,7 +2073,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		}
 		if x := p.peek1(); x != t.IDCloseParen {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, p.errorf(`expected ")", got %q`, got)
 		}
 		p.src = p.src[1:]
 		return expr, nil
@@ -1526,6 +2086,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 	lhs := a.NewExpr(0, 0, id, nil, nil, nil, nil)
 
 	for first := true; ; first = false {
+		p.setSpan(lhs.AsNode(), begin)
 		flags := a.Flags(0)
 		switch p.peek1() {
 		default:
@@ -0,0 +1,546 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package parse
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestErrorRecovery(tt *testing.T) {
+	const src = "" +
+		"pri func a() {\n" +
+		"\tx = (\n" +
+		"}\n" +
+		"pri func b() {\n" +
+		"}\n" +
+		"pri struct c[\n" +
+		"pri func d() {\n" +
+		"\tvar 3 : base.u8\n" +
+		"}\n" +
+		"pri func e() {\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+
+	if _, err := Parse(tm, "test.wuffs", tokens, nil); err == nil {
+		tt.Fatalf("Parse: got nil error, want non-nil")
+	} else if _, ok := err.(ErrorList); ok {
+		tt.Fatalf("Parse: got an ErrorList without MaxErrors")
+	}
+
+	f, err := Parse(tm, "test.wuffs", tokens, &Options{MaxErrors: 10})
+	errs, ok := err.(ErrorList)
+	if !ok {
+		tt.Fatalf("Parse: got %v, want an ErrorList", err)
+	}
+	wantPositions := [][2]uint32{{3, 1}, {6, 13}, {8, 6}}
+	if len(errs) != len(wantPositions) {
+		tt.Fatalf("Parse: got %d errors, want %d:\n%v", len(errs), len(wantPositions), err)
+	}
+	for i, want := range wantPositions {
+		e, ok := errs[i].(*t.Error)
+		if !ok {
+			tt.Errorf("error #%d: got %T, want *token.Error", i, errs[i])
+		} else if got := [2]uint32{e.Line, e.Col}; (e.Code != "parse") || (e.Filename != "test.wuffs") || (got != want) {
+			tt.Errorf("error #%d: got %s %s:%d:%d, want parse test.wuffs:%d:%d",
+				i, e.Code, e.Filename, e.Line, e.Col, want[0], want[1])
+		}
+	}
+
+	got := []string(nil)
+	for _, d := range f.TopLevelDecls() {
+		got = append(got, d.AsFunc().FuncName().Str(tm))
+	}
+	if s := strings.Join(got, ","); s != "b,e" {
+		tt.Errorf("TopLevelDecls: got %q, want %q", s, "b,e")
+	}
+
+	if _, err := Parse(tm, "test.wuffs", tokens, &Options{MaxErrors: 2}); err == nil {
+		tt.Fatalf("Parse: got nil error, want non-nil")
+	} else if n := len(err.(ErrorList)); n != 2 {
+		tt.Errorf("MaxErrors 2: got %d errors", n)
+	}
+}
+
+func TestReturnError(tt *testing.T) {
+	const src = "" +
+		"pri func f?() {\n" +
+		"\treturn error \"bad header\"\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	body := f.TopLevelDecls()[0].AsFunc().Body()
+	if len(body) != 1 {
+		tt.Fatalf("got %d statements, want 1", len(body))
+	}
+	n := body[0].AsRet()
+	if !n.HasErrorKeyword() {
+		tt.Errorf("HasErrorKeyword: got false, want true")
+	}
+	if got, want := n.Value().Str(tm), `"#bad header"`; got != want {
+		tt.Errorf("Value: got %s, want %s", got, want)
+	}
+
+	for _, bad := range []string{`"#bad header"`, `"$bad header"`} {
+		src := "pri func f?() {\n\treturn error " + bad + "\n}\n"
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		if _, err := Parse(tm, "test.wuffs", tokens, nil); err == nil {
+			tt.Errorf("%s: got nil error, want non-nil", bad)
+		}
+	}
+}
+
+func TestTestFunc(tt *testing.T) {
+	const src = "" +
+		"test func foo.test_bar!() {\n" +
+		"\tassert this.x == 0\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	n := f.TopLevelDecls()[0].AsFunc()
+	if !n.Test() || n.Public() {
+		tt.Errorf("Test, Public: got %t, %t, want true, false", n.Test(), n.Public())
+	}
+
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"test const X : base.u32 = 1\n", `expected "func" after "test"`},
+		{"test func f?() {\n}\n", "test function cannot be a coroutine"},
+		{"test func f(x: base.u32) {\n}\n", "test function cannot have arguments"},
+		{"test func f() base.u32 {\n\treturn 0\n}\n", "test function cannot have a return type"},
+		{"test func f(),\n\tpre true,\n{\n}\n", "test function cannot have pre or post conditions"},
+	}
+	for _, tc := range testCases {
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(tc.src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		if _, err := Parse(tm, "test.wuffs", tokens, nil); (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got error %v, want one containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestInlineFunc(tt *testing.T) {
+	const src = "" +
+		"pri func foo.bar(x: base.u8) base.u8, via inline {\n" +
+		"\treturn args.x\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	if n := f.TopLevelDecls()[0].AsFunc(); !n.Inline() {
+		tt.Errorf("Inline: got false, want true")
+	}
+
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri func f(), via truncate {\n}\n", `expected "via inline"`},
+		{"pri func f(), via inline pre true {\n}\n", `expected ","`},
+		{"pub func f(), via inline {\n}\n", "inline function cannot be public"},
+		{"pri func f?(), via inline {\n}\n", "inline function cannot be a coroutine"},
+		{"pri func f(), choosy, via inline {\n}\n", "inline function cannot be choosy"},
+	}
+	for _, tc := range testCases {
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(tc.src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		if _, err := Parse(tm, "test.wuffs", tokens, nil); (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got error %v, want one containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestIncremental(tt *testing.T) {
+	const src = "" +
+		"pri func a() {\n" +
+		"}\n" +
+		"pri func b() {\n" +
+		"\tx = (\n" +
+		"}\n" +
+		"/// c is documented.\n" +
+		"pri func c() {\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+
+	testCases := []struct {
+		maxErrors int
+		want      string
+	}{
+		{0, "a,error,error"},
+		{10, "a,error,c+doc,EOF,EOF"},
+	}
+	for _, tc := range testCases {
+		inc := NewIncremental(tm, "test.wuffs", tokens, &Options{MaxErrors: tc.maxErrors})
+		got := []string(nil)
+		for i := strings.Count(tc.want, ","); i >= 0; i-- {
+			if d, err := inc.Next(); err == io.EOF {
+				got = append(got, "EOF")
+			} else if err != nil {
+				got = append(got, "error")
+			} else {
+				got = append(got, d.AsFunc().FuncName().Str(tm))
+				if doc := d.AsFunc().Doc(); len(doc) != 0 {
+					got[len(got)-1] += "+doc"
+				}
+			}
+		}
+		if s := strings.Join(got, ","); s != tc.want {
+			tt.Errorf("MaxErrors %d: got %q, want %q", tc.maxErrors, s, tc.want)
+		}
+	}
+}
+
+func TestSpan(tt *testing.T) {
+	const src = "" +
+		"/// f is documented.\n" +
+		"pri func f(x: base.u32[..= 9]) base.u32 {\n" +
+		"\tif args.x > 3 {\n" +
+		"\t\treturn (args.x + 1) * 2\n" +
+		"\t}\n" +
+		"\treturn 0\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+
+	str := func(s a.Span) string {
+		b := []string(nil)
+		for _, tok := range tokens[s.Begin:s.End] {
+			b = append(b, tm.ByID(tok.ID))
+		}
+		return strings.Join(b, " ")
+	}
+
+	// Every node's span is non-empty and nested within its parent's span.
+	var walk func(n *a.Node, parent a.Span)
+	walk = func(n *a.Node, parent a.Span) {
+		s := n.Span()
+		if (s.Begin >= s.End) || (s.Begin < parent.Begin) || (s.End > parent.End) {
+			tt.Errorf("%s node: span %v is not within %v", n.Kind(), s, parent)
+		}
+		for _, o := range n.AsRaw().SubNodes() {
+			if o != nil {
+				walk(o, s)
+			}
+		}
+		for _, l := range n.AsRaw().SubLists() {
+			for _, o := range l {
+				walk(o, s)
+			}
+		}
+	}
+	walk(f.AsNode(), f.AsNode().Span())
+
+	fn := f.TopLevelDecls()[0].AsFunc()
+	ret := fn.Body()[0].AsIf().BodyIfTrue()[0].AsRet()
+	testCases := []struct {
+		n    *a.Node
+		want string
+	}{
+		{fn.In().Fields()[0], "x : base . u32 [ ..= 9 ]"},
+		{fn.Out().AsNode(), "base . u32"},
+		{fn.Body()[0].AsIf().Condition().AsNode(), "args . x > 3"},
+		{ret.AsNode(), "return ( args . x + 1 ) * 2"},
+		{ret.Value().LHS(), "args . x + 1"},
+		{fn.Body()[1], "return 0"},
+	}
+	for _, tc := range testCases {
+		if got := str(tc.n.Span()); got != tc.want {
+			tt.Errorf("%s node: got %q, want %q", tc.n.Kind(), got, tc.want)
+		}
+	}
+}
+
+func TestIterateNonAssignment(tt *testing.T) {
+	// This used to panic, dereferencing the nil LHS of a non-assignment.
+	const src = "" +
+		"pri func f() {\n" +
+		"\titerate (x)(length: 1, advance: 1, unroll: 1) {\n" +
+		"\t}\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	_, err = Parse(tm, "test.wuffs", tokens, nil)
+	if err == nil {
+		tt.Fatalf("Parse: got nil error, want non-nil")
+	}
+	if got, want := err.Error(), `parse: expected variable, got "x"`; !strings.HasPrefix(got, want) {
+		tt.Errorf("Parse: got %q, want prefix %q", got, want)
+	}
+}
+
+func TestRawStrLiteralOutsideConst(tt *testing.T) {
+	const src = "" +
+		"pri func f() {\n" +
+		"\tvar x : base.u8\n" +
+		"\tx = `ab`\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	_, err = Parse(tm, "test.wuffs", tokens, nil)
+	if err == nil {
+		tt.Fatalf("Parse: got nil error, want non-nil")
+	}
+	if got, want := err.Error(), "parse: raw literal is only allowed in a const initializer at test.wuffs:3:6"; got != want {
+		tt.Errorf("Parse: got %q, want %q", got, want)
+	}
+}
+
+func TestCgenPrefixPragma(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		want    string
+		wantErr string
+	}{
+		{"pri func f() {\n}\n", "", ""},
+		{"use \"cgen prefix myapp_foo\"\npri func f() {\n}\n", "myapp_foo", ""},
+		{"use \"cgen prefix myapp_foo\"\nuse \"cgen prefix myapp_foo\"\n", "myapp_foo", ""},
+		{"use \"cgen prefix myapp_foo\"\nuse \"cgen prefix myapp_bar\"\n", "",
+			`parse: conflicting cgen prefix pragmas "myapp_foo" and "myapp_bar" at test.wuffs:2`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(tc.src))
+		if err != nil {
+			tt.Fatalf("%q: Tokenize: %v", tc.src, err)
+		}
+		f, err := Parse(tm, "test.wuffs", tokens, nil)
+		if tc.wantErr != "" {
+			if (err == nil) || (err.Error() != tc.wantErr) {
+				tt.Errorf("%q: got error %v, want %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Errorf("%q: Parse: %v", tc.src, err)
+			continue
+		}
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() == a.KUse {
+				tt.Errorf("%q: got a use declaration, want none", tc.src)
+			}
+		}
+		if got, _ := CgenPrefixPragma(tm, f.CgenPrefixPragma()); got != tc.want {
+			tt.Errorf("%q: got prefix %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestElseIfChain(tt *testing.T) {
+	const src = "" +
+		"pri func f(x: base.u32) base.u32 {\n" +
+		"    if args.x == 0 {\n" +
+		"        return 10\n" +
+		"    } else if args.x == 1 {\n" +
+		"        return 11\n" +
+		"    } else if.likely args.x == 2 {\n" +
+		"        return 12\n" +
+		"    } else {\n" +
+		"        return 13\n" +
+		"    }\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+
+	// The chain is a linked list of If nodes, not nested blocks.
+	n := f.TopLevelDecls()[0].AsFunc().Body()[0].AsIf()
+	conditions := []string(nil)
+	for ; n.ElseIf() != nil; n = n.ElseIf() {
+		if len(n.BodyIfFalse()) != 0 {
+			tt.Fatalf("%q: got both ElseIf and BodyIfFalse", n.Condition().Str(tm))
+		}
+		conditions = append(conditions, n.Condition().Str(tm))
+	}
+	conditions = append(conditions, n.Condition().Str(tm))
+	if got, want := strings.Join(conditions, "; "), "args.x == 0; args.x == 1; args.x == 2"; got != want {
+		tt.Errorf("conditions: got %q, want %q", got, want)
+	}
+	if got := len(n.BodyIfFalse()); got != 1 {
+		tt.Errorf("final BodyIfFalse: got %d statements, want 1", got)
+	}
+}
+
+func TestLabeledJumps(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"while.outer true {\nwhile.inner true {\nbreak.outer\n}.inner\n}.outer\n", ""},
+		{"while.outer true {\nwhile true {\ncontinue.outer\n}\n}.outer\n", ""},
+		{"while.outer true {\nbreak\n}.outer\n", "unlabeled break for labeled while.outer"},
+		{"while.outer true {\nbreak.inner\n}.outer\n", "no matching while/iterate statement for break.inner"},
+		{"while.a true {\n}.a\nwhile true {\nbreak.a\n}\n", "no matching while/iterate statement for break.a"},
+		{"while.a true {\nwhile.a true {\n}.a\n}.a\n", "duplicate loop label a"},
+		{"break\n", "no matching while/iterate statement for break"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func f() {\n" + tc.body + "}\n"
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		f, err := Parse(tm, "test.wuffs", tokens, nil)
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got error %v, want one containing %q", tc.body, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Errorf("%q: got error %v, want nil", tc.body, err)
+			continue
+		}
+
+		// The jump's target is the outer loop, which records that it is
+		// jumped to from an inner loop.
+		outer := f.TopLevelDecls()[0].AsFunc().Body()[0].AsWhile()
+		jump := outer.Body()[0].AsWhile().Body()[0].AsJump()
+		if jump.JumpTarget() != a.Loop(outer) {
+			tt.Errorf("%q: JumpTarget: got %v, want the outer loop", tc.body, jump.JumpTarget())
+		}
+		if jump.Keyword() == t.IDBreak && !outer.HasDeepBreak() {
+			tt.Errorf("%q: HasDeepBreak: got false, want true", tc.body)
+		} else if jump.Keyword() == t.IDContinue && !outer.HasDeepContinue() {
+			tt.Errorf("%q: HasDeepContinue: got false, want true", tc.body)
+		}
+	}
+}
+
+func TestDocComments(tt *testing.T) {
+	const src = "" +
+		"/// u is a use.\n" +
+		"use \"std/crc32\"\n" +
+		"\n" +
+		"/// S is a status.\n" +
+		"pub status \"#s\"\n" +
+		"\n" +
+		"/// C is a const.\n" +
+		"///\n" +
+		"/// It has two paragraphs.\n" +
+		"pub const C : base.u32 = 1\n" +
+		"\n" +
+		"// foo has a regular comment, not a doc comment.\n" +
+		"pub struct foo(\n" +
+		"\tx : base.u32,\n" +
+		")\n" +
+		"\n" +
+		"/// bar is a func.\n" +
+		"pub func foo.bar() {\n" +
+		"}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	f, err := Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+
+	got := []string(nil)
+	for _, d := range f.TopLevelDecls() {
+		doc := []string(nil)
+		switch d.Kind() {
+		case a.KConst:
+			doc = d.AsConst().Doc()
+		case a.KFunc:
+			doc = d.AsFunc().Doc()
+		case a.KStatus:
+			doc = d.AsStatus().Doc()
+		case a.KStruct:
+			doc = d.AsStruct().Doc()
+		case a.KUse:
+			doc = d.AsUse().Doc()
+		}
+		got = append(got, d.Kind().String()+": "+strings.Join(doc, "|"))
+	}
+	want := []string{
+		"KUse: /// u is a use.",
+		"KStatus: /// S is a status.",
+		"KConst: /// C is a const.|///|/// It has two paragraphs.",
+		"KStruct: ",
+		"KFunc: /// bar is a func.",
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		tt.Errorf("got:\n%s\nwant:\n%s", g, w)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+//go:build gofuzz
+// +build gofuzz
+
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/google/wuffs/lang/parse"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Fuzz is the entry point for go-fuzz (https://github.com/dvyukov/go-fuzz). It
+// formats data, like wuffsfmt does, and returns 1 if data parsed successfully
+// (making it an interesting input) and 0 otherwise. It panics if formatting is
+// not idempotent (if format(format(x)) != format(x)) or if it loses a comment.
+//
+// It also panics if rendering any tokenizable data, parseable or not, changes
+// its tokens. That round trip checks the tokenizer against the renderer and
+// lives here, not in token.Fuzz, as package token cannot import package render.
+func Fuzz(data []byte) int {
+	if err := fuzzRoundTrip(data); err != nil {
+		panic(err.Error())
+	}
+	dst1, comments1, err := fuzzFormat(data)
+	if err != nil {
+		return 0
+	}
+	dst2, comments2, err := fuzzFormat(dst1)
+	if err != nil {
+		panic(fmt.Sprintf("re-formatting: %v", err))
+	} else if !bytes.Equal(dst1, dst2) {
+		panic(fmt.Sprintf("not idempotent:\n%s\n----\n%s", dst1, dst2))
+	} else if comments1 != comments2 {
+		panic(fmt.Sprintf("comments not preserved: had %d, now %d", comments1, comments2))
+	}
+	return 1
+}
+
+// fuzzFormat returns the formatted data and the number of non-empty comments
+// in data.
+func fuzzFormat(data []byte) (dst []byte, numComments int, err error) {
+	tm := &t.Map{}
+	tokens, comments, err := t.Tokenize(tm, "fuzz.wuffs", data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := parse.Parse(tm, "fuzz.wuffs", tokens, nil); err != nil {
+		return nil, 0, err
+	}
+	for _, c := range comments {
+		if c != "" {
+			numComments++
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := Render(buf, tm, tokens, comments); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), numComments, nil
+}
+
+// fuzzRoundTrip checks that re-tokenizing rendered tokens gives the same
+// tokens, other than semi-colons, which can be implicit in either. Rendering
+// normalizes numeric literals, such as "0xffa" to "0xFFA" and "1_000" to
+// "1000", so those are compared by fuzzNumKey instead of by ID.
+func fuzzRoundTrip(data []byte) error {
+	tm := &t.Map{}
+	tokens0, comments, err := t.Tokenize(tm, "fuzz.wuffs", data)
+	if err != nil {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	if err := Render(buf, tm, tokens0, comments); err != nil {
+		return nil
+	}
+	tokens1, _, err := t.Tokenize(tm, "fuzz.wuffs", buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("re-tokenizing: %v", err)
+	}
+	ids0, ids1 := fuzzIDs(tokens0), fuzzIDs(tokens1)
+	if len(ids0) != len(ids1) {
+		return fmt.Errorf("round trip: got %d tokens, want %d", len(ids1), len(ids0))
+	}
+	for i := range ids0 {
+		if ids0[i] == ids1[i] {
+			continue
+		} else if ids0[i].IsNumLiteral(tm) && ids1[i].IsNumLiteral(tm) &&
+			(fuzzNumKey(tm.ByID(ids0[i])) == fuzzNumKey(tm.ByID(ids1[i]))) {
+			continue
+		}
+		return fmt.Errorf("round trip: token #%d: got %q, want %q",
+			i, tm.ByID(ids1[i]), tm.ByID(ids0[i]))
+	}
+	return nil
+}
+
+// fuzzNumKey returns s, a numeric literal, without underscores and in lower
+// case, so that it is the same for every way that the renderer can spell it.
+func fuzzNumKey(s string) string {
+	return strings.ToLower(strings.Replace(s, "_", "", -1))
+}
+
+func fuzzIDs(tokens []t.Token) (ids []t.ID) {
+	for _, tok := range tokens {
+		if tok.ID != t.IDSemicolon {
+			ids = append(ids, tok.ID)
+		}
+	}
+	return ids
+}
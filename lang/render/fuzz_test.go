@@ -0,0 +1,38 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+//go:build gofuzz
+// +build gofuzz
+
+package render
+
+import (
+	"testing"
+)
+
+// Run these tests with "go test -tags gofuzz".
+
+func TestFuzzNormalizedNumbers(tt *testing.T) {
+	testCases := []string{
+		"pri const X : base.u32 = 0xffa\n",
+		"pri const X : base.u32 = 1_000\n",
+		"pri const X : base.u32 = 0b1_0101\n",
+		"pri const X : base.u32 = 12345678\n",
+	}
+
+	for _, src := range testCases {
+		if err := fuzzRoundTrip([]byte(src)); err != nil {
+			tt.Errorf("%q: fuzzRoundTrip: %v", src, err)
+		}
+		if got := Fuzz([]byte(src)); got != 1 {
+			tt.Errorf("%q: Fuzz: got %d, want 1", src, got)
+		}
+	}
+}
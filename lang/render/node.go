@@ -0,0 +1,448 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package render
+
+import (
+	"bytes"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Expr returns n as Wuffs source code, formatted like wuffsfmt would, such as
+// "(args.x + 1) as base.u32". It is meant for quoting sub-trees, such as in
+// diagnostics, not for re-generating a file: n's comments and original line
+// breaks are lost.
+func Expr(n *a.Expr, tm *t.Map) string {
+	w := &nodeWriter{tm: tm, line: 1}
+	w.expr(n, false, 0)
+	return w.render()
+}
+
+// Stmt is like Expr but for a statement, such as an *a.Assign or an *a.If.
+// Any nested blocks are rendered on multiple, indented lines. A node that is
+// not a statement is rendered as "«Kind»", such as "«KFunc»".
+func Stmt(n *a.Node, tm *t.Map) string {
+	w := &nodeWriter{tm: tm, line: 1}
+	w.stmt(n)
+	return w.render()
+}
+
+// nodeWriter converts an AST sub-tree to tokens, which are then rendered by
+// the same code that renders a tokenized file.
+type nodeWriter struct {
+	tm     *t.Map
+	tokens []t.Token
+	line   uint32
+	// failure, if non-empty, is returned instead of rendering the tokens.
+	failure string
+}
+
+func (w *nodeWriter) render() string {
+	if w.failure != "" {
+		return w.failure
+	}
+	w.endLine()
+	buf := &bytes.Buffer{}
+	if err := Render(buf, w.tm, w.tokens, nil); err != nil {
+		return "«" + err.Error() + "»"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (w *nodeWriter) id(x t.ID) {
+	w.tokens = append(w.tokens, t.Token{ID: x, Line: w.line})
+}
+
+// endLine ends the current line, if it has any tokens, with a semi-colon.
+func (w *nodeWriter) endLine() {
+	if (len(w.tokens) == 0) || (w.tokens[len(w.tokens)-1].Line != w.line) {
+		return
+	}
+	if x := w.tokens[len(w.tokens)-1].ID; (x != t.IDOpenCurly) && (x != t.IDSemicolon) {
+		w.id(t.IDSemicolon)
+	}
+	w.line++
+}
+
+func (w *nodeWriter) label(x t.ID) {
+	if x != 0 {
+		w.id(t.IDDot)
+		w.id(x)
+	}
+}
+
+func (w *nodeWriter) expr(n *a.Expr, parenthesize bool, depth uint32) {
+	if depth > a.MaxExprDepth {
+		w.failure = "«expr_recursion_depth_too_large»"
+		return
+	}
+	depth++
+
+	if n == nil {
+		return
+	}
+
+	switch op := n.Operator(); {
+	case op.IsXUnaryOp():
+		w.id(op.AmbiguousForm())
+		w.expr(n.RHS().AsExpr(), true, depth)
+
+	case op.IsXBinaryOp():
+		if parenthesize {
+			w.id(t.IDOpenParen)
+		}
+		w.expr(n.LHS().AsExpr(), true, depth)
+		w.id(op.AmbiguousForm())
+		if op == t.IDXBinaryAs {
+			w.typeExpr(n.RHS().AsTypeExpr(), 0)
+			if n.Truncates() {
+				w.id(t.IDVia)
+				w.id(t.IDTruncate)
+			}
+		} else {
+			w.expr(n.RHS().AsExpr(), true, depth)
+		}
+		if parenthesize {
+			w.id(t.IDCloseParen)
+		}
+
+	case op.IsXAssociativeOp():
+		if parenthesize {
+			w.id(t.IDOpenParen)
+		}
+		for i, o := range n.Args() {
+			if i != 0 {
+				w.id(op.AmbiguousForm())
+			}
+			w.expr(o.AsExpr(), true, depth)
+		}
+		if parenthesize {
+			w.id(t.IDCloseParen)
+		}
+
+	case op == 0:
+		w.id(n.Ident())
+
+	case op == a.ExprOperatorCall:
+		w.expr(n.LHS().AsExpr(), true, depth)
+		if e := n.Effect(); e.Coroutine() {
+			w.id(t.IDQuestion)
+		} else if e.Impure() {
+			w.id(t.IDExclam)
+		}
+		w.id(t.IDOpenParen)
+		for i, o := range n.Args() {
+			if i != 0 {
+				w.id(t.IDComma)
+			}
+			w.id(o.AsArg().Name())
+			w.id(t.IDColon)
+			w.expr(o.AsArg().Value(), false, depth)
+		}
+		w.id(t.IDCloseParen)
+
+	case op == a.ExprOperatorIndex:
+		w.expr(n.LHS().AsExpr(), true, depth)
+		w.id(t.IDOpenBracket)
+		w.expr(n.RHS().AsExpr(), false, depth)
+		w.id(t.IDCloseBracket)
+
+	case op == a.ExprOperatorSlice:
+		w.expr(n.LHS().AsExpr(), true, depth)
+		w.id(t.IDOpenBracket)
+		w.expr(n.MHS().AsExpr(), false, depth)
+		w.id(t.IDDotDot)
+		w.expr(n.RHS().AsExpr(), false, depth)
+		w.id(t.IDCloseBracket)
+
+	case op == a.ExprOperatorSelector:
+		w.expr(n.LHS().AsExpr(), true, depth)
+		w.id(t.IDDot)
+		w.id(n.Ident())
+
+	case op == a.ExprOperatorList:
+		w.id(t.IDOpenBracket)
+		w.exprs(n.Args(), depth)
+		w.id(t.IDCloseBracket)
+	}
+}
+
+// exprs writes a comma-separated list of expressions.
+func (w *nodeWriter) exprs(list []*a.Node, depth uint32) {
+	for i, o := range list {
+		if i != 0 {
+			w.id(t.IDComma)
+		}
+		w.expr(o.AsExpr(), false, depth)
+	}
+}
+
+func (w *nodeWriter) typeExpr(n *a.TypeExpr, depth uint32) {
+	if depth > a.MaxTypeExprDepth {
+		w.failure = "«type_expr_recursion_depth_too_large»"
+		return
+	}
+	depth++
+	if n == nil {
+		return
+	}
+
+	switch dec := n.Decorator(); dec {
+	case 0:
+		if pkg := n.QID()[0]; pkg != 0 {
+			w.id(pkg)
+			w.id(t.IDDot)
+		}
+		w.id(n.QID()[1])
+	case t.IDNptr, t.IDPtr, t.IDRoslice, t.IDSlice, t.IDRotable, t.IDTable:
+		w.id(dec)
+		w.typeExpr(n.Inner(), depth)
+		return
+	case t.IDArray, t.IDRoarray:
+		w.id(dec)
+		w.id(t.IDOpenBracket)
+		w.expr(n.ArrayLength(), false, 0)
+		w.id(t.IDCloseBracket)
+		w.typeExpr(n.Inner(), depth)
+		return
+	case t.IDFunc:
+		w.id(dec)
+		if r := n.Receiver(); r != nil {
+			w.id(t.IDOpenParen)
+			w.typeExpr(r, depth)
+			w.id(t.IDCloseParen)
+			w.id(t.IDDot)
+		}
+		w.id(n.FuncName())
+		return
+	}
+
+	if (n.Min() != nil) || (n.Max() != nil) {
+		w.id(t.IDOpenBracket)
+		w.expr(n.Min(), false, 0)
+		w.id(t.IDDotDotEq)
+		w.expr(n.Max(), false, 0)
+		w.id(t.IDCloseBracket)
+	}
+}
+
+// block writes "{", the statements and "}", but not what follows the "}".
+func (w *nodeWriter) block(body []*a.Node) {
+	w.id(t.IDOpenCurly)
+	w.endLine()
+	for _, o := range body {
+		w.stmt(o)
+	}
+	w.id(t.IDCloseCurly)
+}
+
+// asserts writes any ", pre etc, inv etc," that precede a loop's body. Like
+// the std library's code, each assertion, and then the body's "{", starts a
+// new line. The tokenizer never implies a semi-colon after a ",".
+func (w *nodeWriter) asserts(asserts []*a.Node) {
+	for _, o := range asserts {
+		w.id(t.IDComma)
+		w.line++
+		w.assert(o.AsAssert())
+	}
+	if len(asserts) > 0 {
+		w.id(t.IDComma)
+		w.line++
+	}
+}
+
+func (w *nodeWriter) assert(n *a.Assert) {
+	w.id(n.Keyword())
+	w.expr(n.Condition(), false, 0)
+	if n.Reason() != 0 {
+		w.id(t.IDVia)
+		w.id(n.Reason())
+		w.id(t.IDOpenParen)
+		for i, o := range n.Args() {
+			if i != 0 {
+				w.id(t.IDComma)
+			}
+			w.id(o.AsArg().Name())
+			w.id(t.IDColon)
+			w.expr(o.AsArg().Value(), false, 0)
+		}
+		w.id(t.IDCloseParen)
+	}
+}
+
+func (w *nodeWriter) assign(n *a.Assign) {
+	if lhs := n.LHS(); lhs == nil {
+		// No-op.
+	} else if lhs.Operator() == a.ExprOperatorList {
+		w.exprs(lhs.Args(), 0)
+		w.id(n.Operator())
+	} else {
+		w.expr(lhs, false, 0)
+		w.id(n.Operator())
+	}
+	w.expr(n.RHS(), false, 0)
+}
+
+func (w *nodeWriter) iterateBlock(n *a.Iterate) {
+	w.id(t.IDOpenParen)
+	w.id(t.IDLength)
+	w.id(t.IDColon)
+	w.id(n.Length())
+	w.id(t.IDComma)
+	w.id(t.IDAdvance)
+	w.id(t.IDColon)
+	w.id(n.Advance())
+	w.id(t.IDComma)
+	w.id(t.IDUnroll)
+	w.id(t.IDColon)
+	w.id(n.Unroll())
+	w.id(t.IDCloseParen)
+	w.asserts(n.Asserts())
+	w.block(n.Body())
+	if o := n.ElseIterate(); o != nil {
+		w.id(t.IDElse)
+		w.iterateBlock(o)
+	}
+}
+
+func (w *nodeWriter) stmt(n *a.Node) {
+	switch n.Kind() {
+	case a.KAssert:
+		w.assert(n.AsAssert())
+
+	case a.KAssign:
+		w.assign(n.AsAssign())
+
+	case a.KChoose:
+		o := n.AsChoose()
+		w.id(t.IDChoose)
+		w.id(o.Name())
+		w.id(t.IDEq)
+		w.id(t.IDOpenBracket)
+		w.exprs(o.Args(), 0)
+		w.id(t.IDCloseBracket)
+
+	case a.KIOManip:
+		o := n.AsIOManip()
+		w.id(o.Keyword())
+		w.id(t.IDOpenParen)
+		w.id(t.IDIO)
+		w.id(t.IDColon)
+		w.expr(o.IO(), false, 0)
+		if arg1 := o.Arg1(); arg1 != nil {
+			w.id(t.IDComma)
+			if o.Keyword() == t.IDIOBind {
+				w.id(t.IDData)
+			} else {
+				w.id(t.IDLimit)
+			}
+			w.id(t.IDColon)
+			w.expr(arg1, false, 0)
+		}
+		if hp := o.HistoryPosition(); hp != nil {
+			w.id(t.IDComma)
+			w.id(t.IDHistoryPosition)
+			w.id(t.IDColon)
+			w.expr(hp, false, 0)
+		}
+		w.id(t.IDCloseParen)
+		w.block(o.Body())
+
+	case a.KIf:
+		o := n.AsIf()
+		for {
+			w.id(t.IDIf)
+			w.label(o.Likelihood())
+			w.expr(o.Condition(), false, 0)
+			w.block(o.BodyIfTrue())
+			if o.ElseIf() != nil {
+				w.id(t.IDElse)
+				o = o.ElseIf()
+				continue
+			}
+			if o.BodyIfFalse() != nil {
+				w.id(t.IDElse)
+				w.block(o.BodyIfFalse())
+			}
+			break
+		}
+
+	case a.KIterate:
+		o := n.AsIterate()
+		w.id(t.IDIterate)
+		w.label(o.Label())
+		w.id(t.IDOpenParen)
+		for i, x := range o.Assigns() {
+			if i != 0 {
+				w.id(t.IDComma)
+			}
+			w.assign(x.AsAssign())
+		}
+		w.id(t.IDCloseParen)
+		w.iterateBlock(o)
+
+	case a.KJump:
+		o := n.AsJump()
+		w.id(o.Keyword())
+		w.label(o.Label())
+
+	case a.KRet:
+		o := n.AsRet()
+		w.id(o.Keyword())
+		if o.Keyword() == t.IDYield {
+			w.id(t.IDQuestion)
+		}
+		if v := o.Value(); (v != nil) && (v.Operator() == a.ExprOperatorList) {
+			w.exprs(v.Args(), 0)
+		} else {
+			w.expr(v, false, 0)
+		}
+
+	case a.KSwitch:
+		o := n.AsSwitch()
+		w.id(t.IDSwitch)
+		w.expr(o.Subject(), false, 0)
+		w.id(t.IDOpenCurly)
+		w.endLine()
+		for _, c := range o.Cases() {
+			w.stmt(c)
+		}
+		w.id(t.IDCloseCurly)
+
+	case a.KCase:
+		o := n.AsCase()
+		w.id(o.Keyword())
+		w.exprs(o.Values(), 0)
+		w.block(o.Body())
+
+	case a.KVar:
+		o := n.AsVar()
+		w.id(t.IDVar)
+		w.id(o.Name())
+		w.id(t.IDColon)
+		w.typeExpr(o.XType(), 0)
+
+	case a.KWhile:
+		o := n.AsWhile()
+		w.id(t.IDWhile)
+		w.label(o.Label())
+		w.expr(o.Condition(), false, 0)
+		w.asserts(o.Asserts())
+		w.block(o.Body())
+		w.label(o.Label())
+
+	default:
+		w.failure = "«" + n.Kind().String() + "»"
+	}
+	w.endLine()
+}
@@ -0,0 +1,176 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestExpr(tt *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{
+		{"x", "x"},
+		{"-x", "-x"},
+		{"not (a and b)", "not (a and b)"},
+		{"(a+b)*c", "(a + b) * c"},
+		{"a+b+c", "a + b + c"},
+		{"(x~mod+ 0xff) as base.u8", "(x ~mod+ 0xFF) as base.u8"},
+		{"x as base.u8 via truncate", "x as base.u8 via truncate"},
+		{"this.f!(a: 1,b:x[2])", "this.f!(a: 1, b: x[2])"},
+		{"a and (not b)", "a and not b"},
+		{"args.s[1 .. ][.. 2][3]", "args.s[1 ..][.. 2][3]"},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(tc.src))
+		if err != nil {
+			tt.Errorf("src %q: %v", tc.src, err)
+			continue
+		}
+		for (len(tokens) > 0) && (tokens[len(tokens)-1].ID == t.IDSemicolon) {
+			tokens = tokens[:len(tokens)-1]
+		}
+		n, err := parse.ParseExpr(tm, "test.wuffs", tokens, nil)
+		if err != nil {
+			tt.Errorf("src %q: %v", tc.src, err)
+			continue
+		}
+		if got := Expr(n, tm); got != tc.want {
+			tt.Errorf("src %q: got %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestStmt(tt *testing.T) {
+	const body = "" +
+		"var x : base.u32[0 ..= 10]\n" +
+		"var s : slice base.u8\n" +
+		"x = (args.a + 1) as base.u32[0 ..= 10]\n" +
+		"assert x < 11 via \"a < b: a < c; c <= b\"(c: 11)\n" +
+		"if.likely x > 0 {\n" +
+		"    x -= 1\n" +
+		"} else if x == 0 {\n" +
+		"    return 0\n" +
+		"} else {\n" +
+		"    x, s = this.g!()\n" +
+		"}\n" +
+		"while.outer x > 0,\n" +
+		"        inv x <= 10,\n" +
+		"{\n" +
+		"    iterate (p = s)(length: 4, advance: 4, unroll: 2) {\n" +
+		"        x = p[0] as base.u32\n" +
+		"    } else (length: 1, advance: 1, unroll: 1) {\n" +
+		"        break.outer\n" +
+		"    }\n" +
+		"}.outer\n" +
+		"io_limit (io: args.src, limit: 4) {\n" +
+		"    x = this.h!(a: args.src, b: s[1 .. 2])\n" +
+		"}\n" +
+		"return x"
+	src := "pri func f!(a: base.u32) base.u32 {\n" + body + "\n}\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatal(err)
+	}
+	f, err := parse.Parse(tm, "test.wuffs", tokens, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	stmts := []string(nil)
+	for _, o := range f.TopLevelDecls()[0].AsFunc().Body() {
+		stmts = append(stmts, Stmt(o, tm))
+	}
+	if got := strings.Join(stmts, "\n"); got != body {
+		tt.Errorf("got\n%s\nwant\n%s", got, body)
+	}
+
+	if got, want := Stmt(f.TopLevelDecls()[0], tm), "«KFunc»"; got != want {
+		tt.Errorf("non-statement: got %q, want %q", got, want)
+	}
+}
+
+// TestStmtStd tests that every std function's statements render to their
+// source code, apart from line breaks, redundant parentheses and "{{ }}".
+func TestStmtStd(tt *testing.T) {
+	filenames, err := filepath.Glob("../../std/*/*.wuffs")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// tokenStrings returns the tokens' strings, less those that the
+	// rendering of an AST does not necessarily reproduce.
+	tokenStrings := func(tm *t.Map, tokens []t.Token) string {
+		s := []string(nil)
+		for _, tok := range tokens {
+			switch tok.ID {
+			case t.IDSemicolon, t.IDOpenParen, t.IDCloseParen:
+				continue
+			case t.IDOpenDoubleCurly:
+				tok.ID = t.IDOpenCurly
+			case t.IDCloseDoubleCurly:
+				tok.ID = t.IDCloseCurly
+			}
+			if !tok.ID.IsComment(tm) {
+				s = append(s, tm.ByID(tok.ID))
+			}
+		}
+		return strings.Join(s, " ")
+	}
+
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, src)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		f, err := parse.Parse(tm, filename, tokens, &parse.Options{
+			AllowDoubleUnderscoreNames: true,
+		})
+		if err != nil {
+			tt.Fatal(err)
+		}
+		for _, d := range f.TopLevelDecls() {
+			if d.Kind() != a.KFunc {
+				continue
+			}
+			for _, o := range d.AsFunc().Body() {
+				s := o.Span()
+				want := tokenStrings(tm, tokens[s.Begin:s.End])
+				rendered := Stmt(o, tm)
+				gotTokens, _, err := t.Tokenize(tm, filename, []byte(rendered+"\n"))
+				if err != nil {
+					tt.Errorf("%s: %v in\n%s", filename, err, rendered)
+					continue
+				}
+				if got := tokenStrings(tm, gotTokens); got != want {
+					tt.Errorf("%s: got\n%s\nwant\n%s", filename, got, want)
+				}
+			}
+		}
+	}
+}
@@ -17,6 +17,7 @@ package render
 import (
 	"errors"
 	"io"
+	"unicode/utf8"
 
 	t "github.com/google/wuffs/lang/token"
 )
@@ -30,12 +31,59 @@ func max(a, b int) int {
 	return b
 }
 
+// Options are optional arguments to RenderOptions. A nil *Options means the
+// default options.
+type Options struct {
+	// MaxWidth, if positive, is the number of columns that a rendered line
+	// should fit in, not counting any trailing comment. Wider lines are
+	// wrapped: after each top-level "and" or "or" of a boolean chain or,
+	// failing that, after the "(" and each top-level "," of the line's first
+	// call argument list. The resultant pieces are each rendered as a hanging
+	// line, and are themselves wrapped if they are still too wide. Struct
+	// declarations and the lines that are aligned on their ":" are not
+	// wrapped.
+	//
+	// The renderer never joins lines, so wrapping is idempotent: re-rendering
+	// the output produces the same output.
+	MaxWidth int
+
+	// TokenStream is whether to write src as a token stream instead of as
+	// formatted source code, for comparing tokenizer output, such as in
+	// golden tests. The comments argument and the other options are ignored.
+	// Each token is written on its own line, as tab-separated fields:
+	//
+	//	line:col	0xID	flags	"text"
+	//
+	// The ID is six hex digits. The flags are one byte per property, or '.'
+	// if the token lacks that property. In order, they are: 'K' keyword, 'I'
+	// identifier, 'L' literal, 'N' number literal, 'S' string literal, 'C'
+	// comment, '(' open, ')' close, '<' tight left, '>' tight right, 'U'
+	// unary operator, 'B' binary operator, 'A' associative operator, '='
+	// assignment and ';' implies a semi-colon at the end of a line. The text
+	// is Go-quoted.
+	TokenStream bool
+}
+
+// Render is like RenderOptions with the default options.
 func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error) {
-	if len(src) == 0 {
-		return nil
+	return RenderOptions(w, tm, src, comments, nil)
+}
+
+// RenderOptions writes src, formatted, to w, along with the comments, indexed
+// by line number, that t.Tokenize returned with src.
+func RenderOptions(w io.Writer, tm *t.Map, src []t.Token, comments []string, opts *Options) (err error) {
+	maxWidth := 0
+	if opts != nil {
+		if opts.TokenStream {
+			return renderTokenStream(w, tm, src)
+		}
+		maxWidth = opts.MaxWidth
 	}
 
-	const maxIndent = 0xFFFF
+	// Comment tokens (including "///" doc comments) are rendered from the
+	// comments slice, not from src.
+	src = stripCommentTokens(tm, src)
+
 	indent := 0
 	buf := make([]byte, 0, 1024)
 	commentLine := uint32(0)
@@ -43,7 +91,12 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 	inStruct := false
 	varNameLength := uint32(0)
 
-	prevLine := src[0].Line - 1
+	// prevLine starts just before the first token, if any, so that leading
+	// blank lines are dropped. A file of only comments has no tokens.
+	prevLine := uint32(len(comments))
+	if len(src) > 0 {
+		prevLine = src[0].Line - 1
+	}
 	prevLineHanging := false
 
 	for len(src) > 0 {
@@ -104,24 +157,16 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 		// Render any leading indentation. If this line starts with a close
 		// token, outdent it so that it hopefully aligns vertically with the
 		// line containing the matching open token.
-		buf = buf[:0]
-		indentAdjustment := 0
-		if id := lineTokens[0].ID; id == t.IDCloseDoubleCurly {
-			// No-op.
-		} else if id.IsClose() {
-			indentAdjustment--
-		} else if hanging && ((id != t.IDOpenCurly) && (id != t.IDOpenDoubleCurly)) {
-			indentAdjustment += 2
-		}
-		buf = appendTabs(buf, indent+indentAdjustment)
+		buf = appendTabs(buf[:0], indent+indentAdjustment(lineTokens[0].ID, hanging))
 
 		// Apply or update varNameLength.
+		aligned := false
 		if len(lineTokens) < 4 {
 			varNameLength = 0
 		} else {
 			id0 := lineTokens[0].ID
 			id1 := lineTokens[1].ID
-			if (id0 == t.IDPri) || (id0 == t.IDPub) {
+			if (id0 == t.IDPri) || (id0 == t.IDPub) || (id0 == t.IDTest) {
 				inStruct = id1 == t.IDStruct
 				if id1 != t.IDConst {
 					varNameLength = 0
@@ -142,57 +187,47 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 						buf = append(buf, ' ')
 					}
 					lineTokens = lineTokens[colon:]
+					aligned = true
 				}
 			} else {
 				varNameLength = 0
 			}
 		}
-
-		// Render the lineTokens.
-		prevID, prevIsTightRight := t.ID(0), false
-		for _, tok := range lineTokens {
-			if prevID == t.IDEq || (prevID != 0 && !prevIsTightRight && !tok.ID.IsTightLeft()) {
-				// The "(" token's tight-left-ness is context dependent. For
-				// "f(x)", the "(" is tight-left. For "a * (b + c)", it is not.
-				if tok.ID != t.IDOpenParen || !isCloseIdentStrLiteralQuestion(tm, prevID) {
-					buf = append(buf, ' ')
-				}
+		wrappable := (maxWidth > 0) && !aligned && !inStruct
+
+		// Render the lineTokens. If they are too wide, split them into
+		// pieces, rendering each piece after the first as a hanging line, the
+		// same as re-rendering the output would.
+		pieces := [][]t.Token{lineTokens}
+		for havePrefix := true; len(pieces) > 0; {
+			if !havePrefix {
+				buf = appendTabs(buf[:0], indent+indentAdjustment(pieces[0][0].ID, true))
 			}
-
-			if s := tm.ByID(tok.ID); (s == "") || (s[0] < '0') || ('9' < s[0]) {
-				buf = append(buf, s...)
-			} else {
-				buf = appendNum(buf, s)
+			prefixLen := len(buf)
+			newIndent := 0
+			buf, newIndent, err = appendTokens(buf, tm, pieces[0], indent)
+			if err != nil {
+				return err
 			}
-
-			if tok.ID == t.IDOpenCurly {
-				if indent == maxIndent {
-					return errors.New("render: too many \"{\" tokens")
-				}
-				indent++
-			} else if tok.ID == t.IDCloseCurly {
-				if indent == 0 {
-					return errors.New("render: too many \"}\" tokens")
+			if wrappable && (utf8.RuneCount(buf) > maxWidth) {
+				if split := splitLine(tm, pieces[0]); split != nil {
+					buf = buf[:prefixLen]
+					pieces = append(split, pieces[1:]...)
+					havePrefix = true
+					continue
 				}
-				indent--
 			}
+			indent = newIndent
+			pieces = pieces[1:]
 
-			prevIsTightRight = tok.ID.IsTightRight()
-			// The "+" and "-" tokens' tight-right-ness is context dependent.
-			// The unary flavor is tight-right, the binary flavor is not.
-			if prevID != 0 && tok.ID.IsUnaryOp() && tok.ID.IsBinaryOp() {
-				// Token-based (not ast.Node-based) heuristic for whether the
-				// operator looks unary instead of binary.
-				prevIsTightRight = !isCloseIdentLiteral(tm, prevID)
+			if len(pieces) == 0 {
+				buf = appendComment(buf, comments, line, 0, false)
 			}
-
-			prevID = tok.ID
-		}
-
-		buf = appendComment(buf, comments, line, 0, false)
-		buf = append(buf, '\n')
-		if _, err = w.Write(buf); err != nil {
-			return err
+			buf = append(buf, '\n')
+			if _, err = w.Write(buf); err != nil {
+				return err
+			}
+			havePrefix = false
 		}
 		commentLine = line + 1
 		prevLine = line
@@ -222,12 +257,165 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 	return nil
 }
 
+func stripCommentTokens(tm *t.Map, src []t.Token) []t.Token {
+	for i, tok := range src {
+		if !tok.ID.IsComment(tm) {
+			continue
+		}
+		dst := append([]t.Token(nil), src[:i]...)
+		for _, tok := range src[i+1:] {
+			if !tok.ID.IsComment(tm) {
+				dst = append(dst, tok)
+			}
+		}
+		return dst
+	}
+	return src
+}
+
+// indentAdjustment returns the number of tabs to add to (or, if negative, to
+// remove from) the current indentation for a line that starts with id.
+func indentAdjustment(id t.ID, hanging bool) int {
+	if id == t.IDCloseDoubleCurly {
+		return 0
+	} else if id.IsClose() {
+		return -1
+	} else if hanging && ((id != t.IDOpenCurly) && (id != t.IDOpenDoubleCurly)) {
+		return +2
+	}
+	return 0
+}
+
+// appendTokens appends the rendered tokens to buf, returning the indentation
+// after them, given the indentation before them.
+func appendTokens(buf []byte, tm *t.Map, tokens []t.Token, indent int) ([]byte, int, error) {
+	const maxIndent = 0xFFFF
+	prevID, prevIsTightRight := t.ID(0), false
+	for _, tok := range tokens {
+		if prevID == t.IDEq || (prevID != 0 && !prevIsTightRight && !tok.ID.IsTightLeft()) {
+			// The "(" token's tight-left-ness is context dependent. For
+			// "f(x)", the "(" is tight-left. For "a * (b + c)", it is not.
+			if tok.ID != t.IDOpenParen || !isCloseIdentStrLiteralQuestion(tm, prevID) {
+				buf = append(buf, ' ')
+			}
+		}
+
+		if s := tm.ByID(tok.ID); (s == "") || (s[0] < '0') || ('9' < s[0]) || tok.ID.IsFloatLiteral(tm) {
+			buf = append(buf, s...)
+		} else {
+			buf = appendNum(buf, s)
+		}
+
+		if tok.ID == t.IDOpenCurly {
+			if indent == maxIndent {
+				return nil, 0, errors.New("render: too many \"{\" tokens")
+			}
+			indent++
+		} else if tok.ID == t.IDCloseCurly {
+			if indent == 0 {
+				return nil, 0, errors.New("render: too many \"}\" tokens")
+			}
+			indent--
+		}
+
+		prevIsTightRight = tok.ID.IsTightRight()
+		// The "+" and "-" tokens' tight-right-ness is context dependent.
+		// The unary flavor is tight-right, the binary flavor is not.
+		if tok.ID.IsUnaryOp() && tok.ID.IsBinaryOp() {
+			// Token-based (not ast.Node-based) heuristic for whether the
+			// operator looks unary instead of binary. At the start of a line,
+			// such as when rendering an ast.Expr on its own, it is unary.
+			prevIsTightRight = (prevID == 0) || !isCloseIdentLiteral(tm, prevID)
+		}
+
+		prevID = tok.ID
+	}
+	return buf, indent, nil
+}
+
+// splitLine splits a line that is too wide into two or more non-empty pieces,
+// or returns nil if there is nowhere to split it. It only looks at the line's
+// tokens, with bracket depth relative to the start of the line, so splitting a
+// piece that is still too wide gives the same result as re-rendering that
+// piece on its own line would.
+func splitLine(tm *t.Map, tokens []t.Token) [][]t.Token {
+	// Split after each top-level "and" or "or".
+	breaks := []int(nil)
+	depth := 0
+	for i, tok := range tokens[:len(tokens)-1] {
+		if tok.ID.IsOpen() && (tok.ID != t.IDOpenCurly) && (tok.ID != t.IDOpenDoubleCurly) {
+			depth++
+		} else if tok.ID.IsClose() && (tok.ID != t.IDCloseCurly) && (tok.ID != t.IDCloseDoubleCurly) {
+			depth--
+		} else if (depth == 0) && ((tok.ID == t.IDAnd) || (tok.ID == t.IDOr)) {
+			breaks = append(breaks, i)
+		}
+	}
+
+	// Otherwise, split after the "(" and each top-level "," of the first
+	// non-empty call argument list.
+	if breaks == nil {
+		depth = 0
+		for i, tok := range tokens {
+			if (tok.ID == t.IDOpenParen) && (depth == 0) && (i > 0) && isCallee(tm, tokens[i-1].ID) {
+				if breaks = splitArgs(tokens, i); breaks != nil {
+					break
+				}
+			}
+			if (tok.ID == t.IDOpenParen) || (tok.ID == t.IDOpenBracket) {
+				depth++
+			} else if (tok.ID == t.IDCloseParen) || (tok.ID == t.IDCloseBracket) {
+				depth--
+			}
+		}
+	}
+
+	if breaks == nil {
+		return nil
+	}
+	ret := make([][]t.Token, 0, len(breaks)+1)
+	prev := 0
+	for _, b := range breaks {
+		ret = append(ret, tokens[prev:b+1])
+		prev = b + 1
+	}
+	return append(ret, tokens[prev:])
+}
+
+// splitArgs returns the indexes of the "(" at tokens[open] and of the ","
+// tokens that separate its arguments, or nil if its argument list is empty
+// or does not end within tokens.
+func splitArgs(tokens []t.Token, open int) []int {
+	ret := []int{open}
+	depth := 0
+	for i := open + 1; i < len(tokens); i++ {
+		switch tokens[i].ID {
+		case t.IDOpenParen, t.IDOpenBracket:
+			depth++
+		case t.IDCloseParen, t.IDCloseBracket:
+			if depth > 0 {
+				depth--
+			} else if i == open+1 {
+				return nil
+			} else {
+				return ret
+			}
+		case t.IDComma:
+			if depth == 0 {
+				ret = append(ret, i)
+			}
+		}
+	}
+	return nil
+}
+
 func appendComment(buf []byte, comments []string, line uint32, indent int, otherwiseEmpty bool) []byte {
 	if uint(line) < uint(len(comments)) {
 		if com := comments[line]; com != "" {
-			// Strip trailing spaces.
+			// Strip trailing whitespace, including the '\r' of a "\r\n" line
+			// ending, so that the output's lines all end in a plain '\n'.
 			for len(com) > 0 {
-				if com[len(com)-1] != ' ' {
+				if c := com[len(com)-1]; (c != ' ') && (c != '\t') && (c != '\r') {
 					break
 				}
 				com = com[:len(com)-1]
@@ -315,6 +503,12 @@ func isCloseIdentStrLiteralQuestion(tm *t.Map, x t.ID) bool {
 		x.IsSQStrLiteral(tm) || (x == t.IDQuestion)
 }
 
+// isCallee returns whether a "(" after x starts a call's argument list, as
+// in "f(", "f!(" or "f?(", instead of a parenthesized expression.
+func isCallee(tm *t.Map, x t.ID) bool {
+	return isCloseIdentStrLiteralQuestion(tm, x) || (x == t.IDExclam)
+}
+
 func findColon(lineTokens []t.Token) int {
 	for i, lt := range lineTokens {
 		if lt.ID == t.IDColon {
@@ -0,0 +1,313 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package render
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+func format(filename string, src []byte) ([]byte, error) {
+	return formatOptions(filename, src, nil)
+}
+
+func formatOptions(filename string, src []byte, opts *Options) ([]byte, error) {
+	tm := &t.Map{}
+	tokens, comments, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parse.Parse(tm, filename, tokens, &parse.Options{
+		AllowDoubleUnderscoreNames: true,
+	}); err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := RenderOptions(buf, tm, tokens, comments, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// commentsOf returns src's comments, one per line, without trailing
+// whitespace.
+func commentsOf(src []byte) string {
+	_, comments, _ := t.Tokenize(&t.Map{}, "test.wuffs", src)
+	s := []string(nil)
+	for _, c := range comments {
+		if c != "" {
+			s = append(s, strings.TrimRight(c, " \t\r"))
+		}
+	}
+	return strings.Join(s, "\n")
+}
+
+func TestRender(tt *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{{
+		// Leading blank lines are dropped and other runs of blank lines are
+		// collapsed to one.
+		src:  "\n\n// a\n\n\n// b\npri const A : base.u32 = 1\n\n\n\npri const B : base.u32 = 2\n",
+		want: "// a\n\n// b\npri const A : base.u32 = 1\n\npri const B : base.u32 = 2\n",
+	}, {
+		// A file of only comments keeps them.
+		src:  "\n// a\n\n\n// b\n",
+		want: "// a\n\n// b\n",
+	}, {
+		src:  "pri const A : base.u32 = 1\r\n// a \t\r\n",
+		want: "pri const A : base.u32 = 1\n// a\n",
+	}, {
+		src: "" +
+			"pri func f() {  // f\n" +
+			"  var x : base.u32\n" +
+			"// b\n" +
+			"\n" +
+			"\n" +
+			"\t\tx = 1 +  // c\n" +
+			"// d\n" +
+			"2\n" +
+			"}\n" +
+			"// e\n",
+		want: "" +
+			"pri func f() {  // f\n" +
+			"    var x : base.u32\n" +
+			"    // b\n" +
+			"\n" +
+			"    x = 1 +  // c\n" +
+			"            // d\n" +
+			"            2\n" +
+			"}\n" +
+			"// e\n",
+	}, {
+		// An else-if chain is already formatted.
+		src: "" +
+			"pri func f(x: base.u32) base.u32 {\n" +
+			"    if args.x == 0 {\n" +
+			"        return 10\n" +
+			"    } else if args.x == 1 {\n" +
+			"        return 11\n" +
+			"    } else if.likely args.x == 2 {\n" +
+			"        return 12\n" +
+			"    } else {\n" +
+			"        return 13\n" +
+			"    }\n" +
+			"}\n",
+		want: "" +
+			"pri func f(x: base.u32) base.u32 {\n" +
+			"    if args.x == 0 {\n" +
+			"        return 10\n" +
+			"    } else if args.x == 1 {\n" +
+			"        return 11\n" +
+			"    } else if.likely args.x == 2 {\n" +
+			"        return 12\n" +
+			"    } else {\n" +
+			"        return 13\n" +
+			"    }\n" +
+			"}\n",
+	}}
+
+	for _, tc := range testCases {
+		got, err := format("test.wuffs", []byte(tc.src))
+		if err != nil {
+			tt.Errorf("src %q: %v", tc.src, err)
+			continue
+		}
+		if string(got) != tc.want {
+			tt.Errorf("src %q:\ngot\n%s\nwant\n%s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestMaxWidth(tt *testing.T) {
+	const src = "" +
+		"pri func f!(a: base.u32, b: base.u32) base.bool {\n" +
+		"\tif (args.a > 1) and (args.b > 2) and (args.a < 3) {  // c\n" +
+		"\t\tthis.g!(x: args.a, y: this.h(p: args.b, q: 4), z: 5)\n" +
+		"\t}\n" +
+		"\treturn false\n" +
+		"}\n"
+
+	testCases := []struct {
+		maxWidth int
+		want     string
+	}{{
+		maxWidth: 0,
+		want: "" +
+			"pri func f!(a: base.u32, b: base.u32) base.bool {\n" +
+			"    if (args.a > 1) and (args.b > 2) and (args.a < 3) {  // c\n" +
+			"        this.g!(x: args.a, y: this.h(p: args.b, q: 4), z: 5)\n" +
+			"    }\n" +
+			"    return false\n" +
+			"}\n",
+	}, {
+		maxWidth: 55,
+		want: "" +
+			"pri func f!(a: base.u32, b: base.u32) base.bool {\n" +
+			"    if (args.a > 1) and (args.b > 2) and (args.a < 3) {  // c\n" +
+			"        this.g!(\n" +
+			"                x: args.a,\n" +
+			"                y: this.h(p: args.b, q: 4),\n" +
+			"                z: 5)\n" +
+			"    }\n" +
+			"    return false\n" +
+			"}\n",
+	}, {
+		maxWidth: 30,
+		want: "" +
+			"pri func f!(\n" +
+			"        a: base.u32,\n" +
+			"        b: base.u32) base.bool {\n" +
+			"    if (args.a > 1) and\n" +
+			"            (args.b > 2) and\n" +
+			"            (args.a < 3) {  // c\n" +
+			"        this.g!(\n" +
+			"                x: args.a,\n" +
+			"                y: this.h(\n" +
+			"                p: args.b,\n" +
+			"                q: 4),\n" +
+			"                z: 5)\n" +
+			"    }\n" +
+			"    return false\n" +
+			"}\n",
+	}}
+
+	for _, tc := range testCases {
+		opts := &Options{MaxWidth: tc.maxWidth}
+		got, err := formatOptions("test.wuffs", []byte(src), opts)
+		if err != nil {
+			tt.Errorf("maxWidth=%d: %v", tc.maxWidth, err)
+			continue
+		}
+		if string(got) != tc.want {
+			tt.Errorf("maxWidth=%d:\ngot\n%s\nwant\n%s", tc.maxWidth, got, tc.want)
+			continue
+		}
+		if again, err := formatOptions("test.wuffs", got, opts); err != nil {
+			tt.Errorf("maxWidth=%d: re-formatting: %v", tc.maxWidth, err)
+		} else if !bytes.Equal(again, got) {
+			tt.Errorf("maxWidth=%d: not idempotent:\n%s", tc.maxWidth, again)
+		}
+	}
+}
+
+// TestStd tests that the std library's Wuffs code is in canonical form.
+func TestStd(tt *testing.T) {
+	filenames, err := filepath.Glob("../../std/*/*.wuffs")
+	if err != nil {
+		tt.Fatal(err)
+	} else if len(filenames) == 0 {
+		tt.Fatal("no std files found")
+	}
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		got, err := format(filename, src)
+		if err != nil {
+			tt.Errorf("%s: %v", filename, err)
+		} else if !bytes.Equal(got, src) {
+			tt.Errorf("%s: not formatted by wuffsfmt", filename)
+		}
+	}
+}
+
+// mutate returns src with random but syntax-preserving changes to its layout:
+// blank lines, comments, indentation and where some lines break.
+func mutate(rng *rand.Rand, src []byte) []byte {
+	dst := []byte(nil)
+	for _, line := range bytes.Split(bytes.TrimSuffix(src, []byte("\n")), []byte("\n")) {
+		hasComment := bytes.Contains(line, []byte("//"))
+		switch rng.Intn(12) {
+		case 0:
+			dst = append(dst, "\n\n\n"...)
+		case 1:
+			dst = append(dst, "\t  // a  \n"...)
+		case 2:
+			line = bytes.TrimLeft(line, " \t")
+		case 3:
+			line = append([]byte("\t\t  "), line...)
+		case 4:
+			if !hasComment {
+				line = append(line, " // b\t"...)
+			}
+		case 5:
+			line = append(line, " \t"...)
+		case 6:
+			if !hasComment {
+				// A semi-colon is never implied after a comma.
+				line = bytes.Replace(line, []byte(", "), []byte(",\n"), 1)
+			}
+		case 7:
+			if !hasComment {
+				line = bytes.Replace(line, []byte("("), []byte("(  // c\n"), 1)
+			}
+		case 8:
+			// Join this line with the next, if that doesn't change the
+			// implied semi-colons.
+			if s := bytes.TrimRight(line, " \t"); !hasComment && (len(s) > 0) {
+				if c := s[len(s)-1]; (c == ',') || (c == '(') || (c == '{') {
+					dst = append(dst, s...)
+					dst = append(dst, ' ')
+					continue
+				}
+			}
+		}
+		dst = append(dst, line...)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+// TestIdempotent tests that format(format(x)) == format(x), and that
+// formatting keeps every comment, for randomly re-laid-out std files.
+func TestIdempotent(tt *testing.T) {
+	filenames, err := filepath.Glob("../../std/*/*.wuffs")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			// Mutation #0 is rendered without wrapping, the others with.
+			opts := &Options{MaxWidth: 40 * i}
+			src1 := mutate(rng, src)
+			dst1, err := formatOptions(filename, src1, opts)
+			if err != nil {
+				// Some mutations, such as breaking a line inside a string
+				// literal, lead to invalid code.
+				continue
+			}
+			dst2, err := formatOptions(filename, dst1, opts)
+			if err != nil {
+				tt.Errorf("%s, mutation #%d: re-formatting: %v", filename, i, err)
+			} else if !bytes.Equal(dst1, dst2) {
+				tt.Errorf("%s, mutation #%d: not idempotent", filename, i)
+			} else if c1, c2 := commentsOf(src1), commentsOf(dst1); c1 != c2 {
+				tt.Errorf("%s, mutation #%d: comments not preserved", filename, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package render
+
+import (
+	"io"
+	"strconv"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// tokenFlags are the token properties that Options.TokenStream shows, in
+// order. A token that has a property is shown with that property's byte, and
+// one that doesn't with a '.'.
+var tokenFlags = [...]struct {
+	b  byte
+	fn func(tm *t.Map, x t.ID) bool
+}{
+	{'K', func(tm *t.Map, x t.ID) bool { return x.IsKeyword() }},
+	{'I', func(tm *t.Map, x t.ID) bool { return x.IsIdent(tm) }},
+	{'L', func(tm *t.Map, x t.ID) bool { return x.IsLiteral(tm) }},
+	{'N', func(tm *t.Map, x t.ID) bool { return x.IsNumLiteral(tm) }},
+	{'S', func(tm *t.Map, x t.ID) bool {
+		return x.IsDQStrLiteral(tm) || x.IsSQStrLiteral(tm) || x.IsRawStrLiteral(tm)
+	}},
+	{'C', func(tm *t.Map, x t.ID) bool { return x.IsComment(tm) }},
+	{'(', func(tm *t.Map, x t.ID) bool { return x.IsOpen() }},
+	{')', func(tm *t.Map, x t.ID) bool { return x.IsClose() }},
+	{'<', func(tm *t.Map, x t.ID) bool { return x.IsTightLeft() }},
+	{'>', func(tm *t.Map, x t.ID) bool { return x.IsTightRight() }},
+	{'U', func(tm *t.Map, x t.ID) bool { return x.IsUnaryOp() }},
+	{'B', func(tm *t.Map, x t.ID) bool { return x.IsBinaryOp() }},
+	{'A', func(tm *t.Map, x t.ID) bool { return x.IsAssociativeOp() }},
+	{'=', func(tm *t.Map, x t.ID) bool { return x.IsAssign() }},
+	{';', func(tm *t.Map, x t.ID) bool { return x.IsImplicitSemicolon(tm) }},
+}
+
+// renderTokenStream writes src, one token per line, for Options.TokenStream.
+func renderTokenStream(w io.Writer, tm *t.Map, src []t.Token) error {
+	buf := make([]byte, 0, 1024)
+	for _, tok := range src {
+		buf = strconv.AppendUint(buf, uint64(tok.Line), 10)
+		buf = append(buf, ':')
+		buf = strconv.AppendUint(buf, uint64(tok.Col), 10)
+		buf = append(buf, "\t0x"...)
+		for shift := 20; shift >= 0; shift -= 4 {
+			buf = append(buf, "0123456789ABCDEF"[(tok.ID>>uint(shift))&15])
+		}
+		buf = append(buf, '\t')
+		for _, f := range tokenFlags {
+			if f.fn(tm, tok.ID) {
+				buf = append(buf, f.b)
+			} else {
+				buf = append(buf, '.')
+			}
+		}
+		buf = append(buf, '\t')
+		buf = strconv.AppendQuote(buf, tm.ByID(tok.ID))
+		buf = append(buf, '\n')
+
+		if len(buf) >= 512 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
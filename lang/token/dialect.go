@@ -0,0 +1,88 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token
+
+import (
+	"strings"
+)
+
+// Dialect is a version of the Wuffs language, as far as tokenization is
+// concerned. Newer versions can add keywords. In older dialects, such words
+// are tokenized as ordinary identifiers.
+//
+// A .wuffs file selects its dialect with a `use "wuffs vX.Y"` pragma, which
+// applies to the rest of that file. Without a pragma, the Options' Dialect
+// (or, if that is nil, DefaultDialect) applies.
+type Dialect struct {
+	// Name is the pragma's string, without the quotes, such as "wuffs v0.2".
+	Name string
+
+	// notKeywords are the keyword IDs that are not keywords in this dialect.
+	notKeywords []ID
+}
+
+var (
+	DialectV0_2 = &Dialect{
+		Name:        "wuffs v0.2",
+		notKeywords: []ID{IDChoose, IDChoosy, IDImplements, IDSwitch, IDCase, IDDefault, IDTest},
+	}
+	DialectV0_3 = &Dialect{
+		Name: "wuffs v0.3",
+	}
+
+	DefaultDialect = DialectV0_3
+
+	dialects = [...]*Dialect{
+		DialectV0_2,
+		DialectV0_3,
+	}
+)
+
+// LookupDialect returns the Dialect with the given name, or nil if there is
+// no such Dialect.
+func LookupDialect(name string) *Dialect {
+	for _, d := range dialects {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// IsKeyword returns whether x is a keyword in this dialect.
+func (d *Dialect) IsKeyword(x ID) bool {
+	if !x.IsKeyword() {
+		return false
+	}
+	for _, y := range d.notKeywords {
+		if x == y {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDialectPragma returns whether x is the "-string literal of a `use "wuffs
+// vX.Y"` pragma, as opposed to the path of a `use` declaration.
+func (x ID) IsDialectPragma(m *Map) bool {
+	return x.IsDQStrLiteral(m) && strings.HasPrefix(m.ByID(x), `"wuffs v`)
+}
+
+// insertIdent is like m.Insert but, for words that are keywords in general
+// but not in dialect d, it returns a non-built-in (identifier) ID.
+func (m *Map) insertIdent(name string, d *Dialect) (ID, error) {
+	if id, ok := builtInsByName[name]; ok {
+		if (d == nil) || !id.IsKeyword() || d.IsKeyword(id) {
+			return id, nil
+		}
+	}
+	return m.insertNonBuiltIn(name)
+}
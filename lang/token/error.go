@@ -0,0 +1,47 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token
+
+import (
+	"fmt"
+)
+
+// Error is a problem at a position in Wuffs source code. The token and parse
+// packages return them, so that tools such as lang/diag can report the parts
+// separately instead of parsing the message.
+//
+// Code is the package that found the problem, such as "token" or "parse".
+// Msg excludes the "code: " prefix and the " at filename:line:col" suffix
+// that the Error method adds.
+type Error struct {
+	Code     string
+	Filename string
+	Line     uint32
+	Col      uint32 // 1-based, or 0 if unknown.
+	Msg      string
+}
+
+func (e *Error) Error() string {
+	if e.Col == 0 {
+		return fmt.Sprintf("%s: %s at %s:%d", e.Code, e.Msg, e.Filename, e.Line)
+	}
+	return fmt.Sprintf("%s: %s at %s:%d:%d", e.Code, e.Msg, e.Filename, e.Line, e.Col)
+}
+
+func errorAt(filename string, line uint32, col uint32, format string, args ...interface{}) error {
+	return &Error{
+		Code:     "token",
+		Filename: filename,
+		Line:     line,
+		Col:      col,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
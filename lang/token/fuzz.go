@@ -0,0 +1,78 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+//go:build gofuzz
+// +build gofuzz
+
+package token
+
+import (
+	"fmt"
+)
+
+// Fuzz is the entry point for go-fuzz (https://github.com/dvyukov/go-fuzz),
+// including its libFuzzer mode ("go-fuzz-build -libfuzzer"). It returns 1 if
+// data tokenized successfully (making it an interesting input) and 0
+// otherwise. It panics if Tokenize panics or if its output is inconsistent,
+// such as a token's text not matching the source at its Offset.
+//
+// The round trip through the renderer is checked by render.Fuzz, as this
+// package cannot import package render.
+func Fuzz(data []byte) int {
+	m := &Map{}
+	tokens, _, err := TokenizeOptions(m, "fuzz.wuffs", data, &Options{
+		CommentTokens: true,
+	})
+	if err != nil {
+		return 0
+	}
+	if err := fuzzCheck(data, tokens, m); err != nil {
+		panic(err)
+	}
+	return 1
+}
+
+func fuzzCheck(src []byte, tokens []Token, m *Map) error {
+	prevOffset := uint32(0)
+	for i, tok := range tokens {
+		if tok.Offset < prevOffset {
+			return fmt.Errorf("token #%d: offset %d decreased", i, tok.Offset)
+		}
+		prevOffset = tok.Offset
+
+		if (tok.Line == 0) || (tok.Col == 0) || (tok.Col > tok.Offset+1) {
+			return fmt.Errorf("token #%d: invalid position %d:%d", i, tok.Line, tok.Col)
+		} else if lineStart := tok.Offset + 1 - tok.Col; (lineStart > 0) && (src[lineStart-1] != '\n') {
+			return fmt.Errorf("token #%d: column %d is not relative to a line start", i, tok.Col)
+		}
+
+		// Semi-colons can be implicit, with no corresponding source text.
+		if tok.ID == IDSemicolon {
+			continue
+		}
+		s := m.ByID(tok.ID)
+		if (s == "") || !hasPrefix(src[tok.Offset:], s) {
+			return fmt.Errorf("token #%d: text %q does not match the source at offset %d", i, s, tok.Offset)
+		}
+	}
+
+	tokens1, m1, err := Unmarshal(Marshal(tokens, m))
+	if err != nil {
+		return fmt.Errorf("Unmarshal: %v", err)
+	} else if len(tokens1) != len(tokens) {
+		return fmt.Errorf("Unmarshal: got %d tokens, want %d", len(tokens1), len(tokens))
+	}
+	for i := range tokens {
+		if (tokens1[i] != tokens[i]) || (m1.ByID(tokens1[i].ID) != m.ByID(tokens[i].ID)) {
+			return fmt.Errorf("Unmarshal: token #%d differs", i)
+		}
+	}
+	return nil
+}
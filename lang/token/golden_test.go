@@ -0,0 +1,112 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/wuffs/lang/render"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+var update = flag.Bool("update", false, "update the testdata/*.golden files")
+
+// tokenStream returns the canonical token stream of the named file.
+func tokenStream(filename string) ([]byte, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := render.RenderOptions(buf, tm, tokens, nil, &render.Options{
+		TokenStream: true,
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkGolden compares got with the golden file, or updates the golden file
+// if the -update flag is set.
+func checkGolden(tt *testing.T, golden string, got []byte) {
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			tt.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines := bytes.Split(got, []byte("\n"))
+	wantLines := bytes.Split(want, []byte("\n"))
+	for i := 0; ; i++ {
+		if (i >= len(gotLines)) || (i >= len(wantLines)) || !bytes.Equal(gotLines[i], wantLines[i]) {
+			g, w := "(EOF)", "(EOF)"
+			if i < len(gotLines) {
+				g = string(gotLines[i])
+			}
+			if i < len(wantLines) {
+				w = string(wantLines[i])
+			}
+			tt.Fatalf("%s: line %d differs (run \"go test -update\" to update the golden file):\n"+
+				"got  %s\nwant %s", golden, i+1, g, w)
+		}
+	}
+}
+
+// TestGolden tests the tokenizer's output, token by token, for a file that
+// exercises its features.
+func TestGolden(tt *testing.T) {
+	got, err := tokenStream("testdata/tokens.wuffs")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	checkGolden(tt, "testdata/tokens.golden", got)
+}
+
+// TestGoldenStd tests the tokenizer's output for the std library's Wuffs
+// code. The token streams are too large to check in, so the golden file has
+// each stream's length (in tokens) and CRC-32 checksum.
+func TestGoldenStd(tt *testing.T) {
+	filenames, err := filepath.Glob("../../std/*/*.wuffs")
+	if err != nil {
+		tt.Fatal(err)
+	} else if len(filenames) == 0 {
+		tt.Fatal("no std files found")
+	}
+	buf := &bytes.Buffer{}
+	for _, filename := range filenames {
+		stream, err := tokenStream(filename)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		fmt.Fprintf(buf, "%08x %6d %s\n", crc32.ChecksumIEEE(stream),
+			bytes.Count(stream, []byte("\n")), filepath.ToSlash(filename[len("../../"):]))
+	}
+	checkGolden(tt, "testdata/std.golden", buf.Bytes())
+}
@@ -20,6 +20,11 @@ const MaxIntBits = 64
 // Some IDs are built-in: the "func" keyword always has the same numerical ID
 // value. Others are mapped at runtime. For example, the ID value for the
 // "foobar" identifier (e.g. a variable name) is looked up in a Map.
+//
+// An ID is a plain index, with no flag bits packed alongside it. A token's
+// class (keyword, operator, literal, etc.) is derived from its built-in ID
+// range or, for mapped IDs, from its text, so all of an ID's bits are
+// available for distinct tokens, up to a Map's limit of 16777215 (24 bits).
 type ID uint32
 
 // Str returns a string form of x.
@@ -63,7 +68,7 @@ func (x ID) IsLiteral(m *Map) bool {
 	if x < nBuiltInIDs {
 		return minBuiltInLiteral <= x && x <= maxBuiltInLiteral
 	} else if s := m.ByID(x); s != "" {
-		return !alpha(s[0])
+		return !alpha(s[0]) && (s[0] < 0x80) && !isComment(s)
 	}
 	return false
 }
@@ -77,6 +82,26 @@ func (x ID) IsNumLiteral(m *Map) bool {
 	return false
 }
 
+// IsFloatLiteral returns whether x is a floating point literal, such as "1.5"
+// or "2.25e-3". These are also numeric literals (IsNumLiteral returns true),
+// but they are reserved for a future fixed-point type and the checker
+// currently rejects them.
+func (x ID) IsFloatLiteral(m *Map) bool {
+	if x < nBuiltInIDs {
+		return false
+	} else if s := m.ByID(x); (s != "") && numeric(s[0]) {
+		if (len(s) >= 2) && (s[0] == '0') && ((s[1] | 0x20) == 'x') {
+			return false
+		}
+		for i := 0; i < len(s); i++ {
+			if c := s[i]; (c == '.') || (c == 'e') || (c == 'E') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // IsDQStrLiteral returns whether x is a double-quote string literal.
 func (x ID) IsDQStrLiteral(m *Map) bool {
 	if x < nBuiltInIDs {
@@ -97,11 +122,48 @@ func (x ID) IsSQStrLiteral(m *Map) bool {
 	return false
 }
 
+// IsComment returns whether x is a "//" comment. Such IDs only occur in token
+// streams produced with Options.CommentTokens set.
+func (x ID) IsComment(m *Map) bool {
+	if x < nBuiltInIDs {
+		return false
+	}
+	return isComment(m.ByID(x))
+}
+
+// IsDocComment returns whether x is a "///" doc comment. Unlike other "//"
+// comments, the tokenizer always returns these as tokens.
+func (x ID) IsDocComment(m *Map) bool {
+	if x < nBuiltInIDs {
+		return false
+	}
+	return isDocComment(m.ByID(x))
+}
+
+// IsLineDirective returns whether x is a `//#line N "file"` comment. Like
+// "///" doc comments, the tokenizer always returns these as tokens.
+func (x ID) IsLineDirective(m *Map) bool {
+	if x < nBuiltInIDs {
+		return false
+	}
+	return isLineDirective(m.ByID(x))
+}
+
+// IsRawStrLiteral returns whether x is a backtick-quoted raw string literal.
+func (x ID) IsRawStrLiteral(m *Map) bool {
+	if x < nBuiltInIDs {
+		return false
+	} else if s := m.ByID(x); s != "" {
+		return s[0] == '`'
+	}
+	return false
+}
+
 func (x ID) IsIdent(m *Map) bool {
 	if x < nBuiltInIDs {
 		return minBuiltInIdent <= x && x <= maxBuiltInIdent
 	} else if s := m.ByID(x); s != "" {
-		return alpha(s[0])
+		return alpha(s[0]) || (s[0] >= 0x80)
 	}
 	return false
 }
@@ -196,10 +258,14 @@ func (x QQID) QIDSuffix() QID {
 	return QID{x[1], x[2]}
 }
 
-// Token combines an ID and the line number it was seen.
+// Token combines an ID and the source position it was seen. Line and Col are
+// 1-based, with Col counting bytes (not runes) from the start of the line.
+// Offset is the 0-based byte offset from the start of the source.
 type Token struct {
-	ID   ID
-	Line uint32
+	ID     ID
+	Line   uint32
+	Col    uint32
+	Offset uint32
 }
 
 // nBuiltInIDs is the number of built-in IDs. The packing is:
@@ -266,6 +332,9 @@ const (
 	IDHatEq     = ID(0x28)
 	IDPercentEq = ID(0x29)
 
+	IDLessQuestionEq    = ID(0x2A)
+	IDGreaterQuestionEq = ID(0x2B)
+
 	IDTildeModPlusEq   = ID(0x30)
 	IDTildeModMinusEq  = ID(0x31)
 	IDTildeModStarEq   = ID(0x32)
@@ -297,6 +366,10 @@ const (
 	IDHat     = ID(0x48)
 	IDPercent = ID(0x49)
 
+	IDStarStar        = ID(0x4A)
+	IDLessQuestion    = ID(0x4B)
+	IDGreaterQuestion = ID(0x4C)
+
 	IDTildeModPlus   = ID(0x50)
 	IDTildeModMinus  = ID(0x51)
 	IDTildeModStar   = ID(0x52)
@@ -316,7 +389,8 @@ const (
 	IDOr  = ID(0x69)
 	IDAs  = ID(0x6A)
 
-	IDNot = ID(0x6F)
+	IDTilde = ID(0x6E)
+	IDNot   = ID(0x6F)
 
 	// The IDXFoo IDs are not returned by the tokenizer. They are used by the
 	// ast.Node ID-typed fields to disambiguate e.g. unary vs binary plus.
@@ -332,6 +406,10 @@ const (
 	IDXBinaryHat     = ID(0x78)
 	IDXBinaryPercent = ID(0x79)
 
+	IDXBinaryStarStar        = ID(0x7A)
+	IDXBinaryLessQuestion    = ID(0x7B)
+	IDXBinaryGreaterQuestion = ID(0x7C)
+
 	IDXBinaryTildeModPlus   = ID(0x80)
 	IDXBinaryTildeModMinus  = ID(0x81)
 	IDXBinaryTildeModStar   = ID(0x82)
@@ -361,6 +439,7 @@ const (
 
 	IDXUnaryPlus  = ID(0xAC)
 	IDXUnaryMinus = ID(0xAD)
+	IDXUnaryTilde = ID(0xAE)
 	IDXUnaryNot   = ID(0xAF)
 )
 
@@ -394,6 +473,10 @@ const (
 	IDVia             = ID(0xC7)
 	IDWhile           = ID(0xC8)
 	IDYield           = ID(0xC9)
+	IDSwitch          = ID(0xCA)
+	IDCase            = ID(0xCB)
+	IDDefault         = ID(0xCC)
+	IDTest            = ID(0xCD)
 )
 
 const (
@@ -445,6 +528,8 @@ const (
 	IDCoroutineResumed = ID(0x101)
 	IDThis             = ID(0x102)
 
+	IDError = ID(0x103)
+
 	IDR1      = ID(0x104)
 	IDT1      = ID(0x105)
 	IDT2      = ID(0x106)
@@ -674,6 +759,9 @@ const (
 	IDUnlikely       = ID(0x208)
 	IDUnroll         = ID(0x209)
 	IDUpdate         = ID(0x20A)
+	IDTruncate       = ID(0x20B)
+	IDSecret         = ID(0x20C)
+	IDInline         = ID(0x20D)
 
 	// TODO: range/rect methods like intersection and contains?
 
@@ -776,6 +864,9 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDHatEq:     "^=",
 	IDPercentEq: "%=",
 
+	IDLessQuestionEq:    "<?=",
+	IDGreaterQuestionEq: ">?=",
+
 	IDTildeModPlusEq:   "~mod+=",
 	IDTildeModMinusEq:  "~mod-=",
 	IDTildeModStarEq:   "~mod*=",
@@ -798,6 +889,10 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDHat:     "^",
 	IDPercent: "%",
 
+	IDStarStar:        "**",
+	IDLessQuestion:    "<?",
+	IDGreaterQuestion: ">?",
+
 	IDTildeModPlus:   "~mod+",
 	IDTildeModMinus:  "~mod-",
 	IDTildeModStar:   "~mod*",
@@ -817,7 +912,8 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDOr:  "or",
 	IDAs:  "as",
 
-	IDNot: "not",
+	IDTilde: "~",
+	IDNot:   "not",
 
 	IDAssert:          "assert",
 	IDBreak:           "break",
@@ -845,6 +941,10 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDVia:             "via",
 	IDWhile:           "while",
 	IDYield:           "yield",
+	IDSwitch:          "switch",
+	IDCase:            "case",
+	IDDefault:         "default",
+	IDTest:            "test",
 
 	IDArray:   "array",
 	IDNptr:    "nptr",
@@ -869,6 +969,8 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDCoroutineResumed: "coroutine_resumed",
 	IDThis:             "this",
 
+	IDError: "error",
+
 	// Some of the next few IDs are never returned by the tokenizer, as it
 	// rejects non-ASCII input. The string representations "¶", "ℤ" etc. are
 	// specifically non-ASCII so that no user-defined (non built-in) identifier
@@ -1125,6 +1227,9 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDUnlikely:       "unlikely",
 	IDUnroll:         "unroll",
 	IDUpdate:         "update",
+	IDTruncate:       "truncate",
+	IDSecret:         "secret",
+	IDInline:         "inline",
 
 	IDHighBits: "high_bits",
 	IDLowBits:  "low_bits",
@@ -1247,6 +1352,7 @@ var lexers = [256][]suffixLexer{
 	},
 	'*': {
 		{"=", IDStarEq},
+		{"*", IDStarStar},
 		{"", IDStar},
 	},
 	'/': {
@@ -1265,6 +1371,8 @@ var lexers = [256][]suffixLexer{
 	'<': {
 		{"<=", IDShiftLEq},
 		{"<", IDShiftL},
+		{"?=", IDLessQuestionEq},
+		{"?", IDLessQuestion},
 		{"=", IDLessEq},
 		{">", IDNotEq},
 		{"", IDLessThan},
@@ -1272,6 +1380,8 @@ var lexers = [256][]suffixLexer{
 	'>': {
 		{">=", IDShiftREq},
 		{">", IDShiftR},
+		{"?=", IDGreaterQuestionEq},
+		{"?", IDGreaterQuestion},
 		{"=", IDGreaterEq},
 		{"", IDGreaterThan},
 	},
@@ -1296,6 +1406,7 @@ var lexers = [256][]suffixLexer{
 		{"sat+", IDTildeSatPlus},
 		{"sat-=", IDTildeSatMinusEq},
 		{"sat-", IDTildeSatMinus},
+		{"", IDTilde},
 	},
 }
 
@@ -1310,6 +1421,7 @@ var ambiguousForms = [nBuiltInSymbolicIDs]ID{
 	IDXBinaryPipe:           IDPipe,
 	IDXBinaryHat:            IDHat,
 	IDXBinaryPercent:        IDPercent,
+	IDXBinaryStarStar:       IDStarStar,
 	IDXBinaryTildeModPlus:   IDTildeModPlus,
 	IDXBinaryTildeModMinus:  IDTildeModMinus,
 	IDXBinaryTildeModStar:   IDTildeModStar,
@@ -1326,6 +1438,9 @@ var ambiguousForms = [nBuiltInSymbolicIDs]ID{
 	IDXBinaryOr:             IDOr,
 	IDXBinaryAs:             IDAs,
 
+	IDXBinaryLessQuestion:    IDLessQuestion,
+	IDXBinaryGreaterQuestion: IDGreaterQuestion,
+
 	IDXAssociativePlus: IDPlus,
 	IDXAssociativeStar: IDStar,
 	IDXAssociativeAmp:  IDAmp,
@@ -1336,6 +1451,7 @@ var ambiguousForms = [nBuiltInSymbolicIDs]ID{
 
 	IDXUnaryPlus:  IDPlus,
 	IDXUnaryMinus: IDMinus,
+	IDXUnaryTilde: IDTilde,
 	IDXUnaryNot:   IDNot,
 }
 
@@ -1386,6 +1502,9 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDTildeSatPlusEq:   IDXBinaryTildeSatPlus,
 	IDTildeSatMinusEq:  IDXBinaryTildeSatMinus,
 
+	IDLessQuestionEq:    IDXBinaryLessQuestion,
+	IDGreaterQuestionEq: IDXBinaryGreaterQuestion,
+
 	IDPlus:           IDXBinaryPlus,
 	IDMinus:          IDXBinaryMinus,
 	IDStar:           IDXBinaryStar,
@@ -1395,6 +1514,7 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDAmp:            IDXBinaryAmp,
 	IDPipe:           IDXBinaryPipe,
 	IDHat:            IDXBinaryHat,
+	IDStarStar:       IDXBinaryStarStar,
 	IDPercent:        IDXBinaryPercent,
 	IDTildeModPlus:   IDXBinaryTildeModPlus,
 	IDTildeModMinus:  IDXBinaryTildeModMinus,
@@ -1403,6 +1523,9 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDTildeSatPlus:   IDXBinaryTildeSatPlus,
 	IDTildeSatMinus:  IDXBinaryTildeSatMinus,
 
+	IDLessQuestion:    IDXBinaryLessQuestion,
+	IDGreaterQuestion: IDXBinaryGreaterQuestion,
+
 	IDNotEq:       IDXBinaryNotEq,
 	IDLessThan:    IDXBinaryLessThan,
 	IDLessEq:      IDXBinaryLessEq,
@@ -1428,6 +1551,7 @@ var associativeForms = [nBuiltInSymbolicIDs]ID{
 var unaryForms = [nBuiltInSymbolicIDs]ID{
 	IDPlus:  IDXUnaryPlus,
 	IDMinus: IDXUnaryMinus,
+	IDTilde: IDXUnaryTilde,
 	IDNot:   IDXUnaryNot,
 }
 
@@ -1451,4 +1575,5 @@ var isTightRight = [...]bool{
 
 	IDDot:    true,
 	IDExclam: true,
+	IDTilde:  true,
 }
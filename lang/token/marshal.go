@@ -0,0 +1,124 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// marshalMagic starts every Marshal output. Its final byte is a format
+// version number.
+const marshalMagic = "WuffsTok\x01"
+
+var errInvalidMarshaledTokens = errors.New("token: invalid marshaled tokens")
+
+// Marshal encodes tokens, and the Map that gives meaning to their IDs, in a
+// compact binary form. Unmarshal reverses this, such as when caching the
+// results of Tokenize between runs.
+//
+// The encoding is the magic string, the number of m's non-built-in names, each
+// name (a uvarint length then its bytes), the number of tokens and then each
+// token's ID, line delta, column and offset delta, all as uvarints.
+func Marshal(tokens []Token, m *Map) []byte {
+	buf := make([]byte, 0, len(marshalMagic)+4*len(tokens))
+	buf = append(buf, marshalMagic...)
+
+	buf = appendUvarint(buf, uint64(len(m.byID)))
+	for _, name := range m.byID {
+		buf = appendUvarint(buf, uint64(len(name)))
+		buf = append(buf, name...)
+	}
+
+	buf = appendUvarint(buf, uint64(len(tokens)))
+	prevLine, prevOffset := uint32(0), uint32(0)
+	for _, tok := range tokens {
+		buf = appendUvarint(buf, uint64(tok.ID))
+		buf = appendUvarint(buf, uint64(tok.Line-prevLine))
+		buf = appendUvarint(buf, uint64(tok.Col))
+		buf = appendUvarint(buf, uint64(tok.Offset-prevOffset))
+		prevLine, prevOffset = tok.Line, tok.Offset
+	}
+	return buf
+}
+
+// Unmarshal decodes the output of Marshal, returning the tokens and a new Map
+// that assigns them the same IDs as the original Map did.
+func Unmarshal(data []byte) (tokens []Token, m *Map, retErr error) {
+	if (len(data) < len(marshalMagic)) || (string(data[:len(marshalMagic)]) != marshalMagic) {
+		return nil, nil, errInvalidMarshaledTokens
+	}
+	data = data[len(marshalMagic):]
+
+	u := func() uint64 {
+		x, n := binary.Uvarint(data)
+		if n <= 0 {
+			retErr = errInvalidMarshaledTokens
+			data = nil
+			return 0
+		}
+		data = data[n:]
+		return x
+	}
+
+	m = &Map{}
+	nNames := u()
+	if nNames > uint64(len(data)) {
+		return nil, nil, errInvalidMarshaledTokens
+	}
+	for ; (nNames > 0) && (retErr == nil); nNames-- {
+		n := u()
+		if (n == 0) || (n > uint64(len(data))) {
+			return nil, nil, errInvalidMarshaledTokens
+		}
+		id, err := m.insertNonBuiltIn(string(data[:n]))
+		if err != nil {
+			return nil, nil, err
+		} else if id != nBuiltInIDs+ID(len(m.byID)-1) {
+			// A duplicate name would shift every later name's ID.
+			return nil, nil, errInvalidMarshaledTokens
+		}
+		data = data[n:]
+	}
+
+	nTokens := u()
+	if nTokens > uint64(len(data)) {
+		return nil, nil, errInvalidMarshaledTokens
+	}
+	tokens = make([]Token, 0, nTokens)
+	// Every ID must be a built-in or one of the names decoded above, so that
+	// m.ByID(id) is valid.
+	idLimit := uint64(nBuiltInIDs) + uint64(len(m.byID))
+	line, offset := uint64(0), uint64(0)
+	for ; (nTokens > 0) && (retErr == nil); nTokens-- {
+		id := u()
+		line += u()
+		col := u()
+		offset += u()
+		if (id >= idLimit) || (line > maxLine) || (col > maxSrcSize) || (offset > maxSrcSize) {
+			return nil, nil, errInvalidMarshaledTokens
+		}
+		tokens = append(tokens, Token{ID(id), uint32(line), uint32(col), uint32(offset)})
+	}
+
+	if retErr != nil {
+		return nil, nil, retErr
+	} else if len(data) != 0 {
+		return nil, nil, errInvalidMarshaledTokens
+	}
+	return tokens, m, nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	b := [binary.MaxVarintLen64]byte{}
+	n := binary.PutUvarint(b[:], x)
+	return append(buf, b[:n]...)
+}
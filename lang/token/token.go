@@ -11,15 +11,18 @@
 package token
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"unicode/utf8"
 )
 
 const (
-	maxID        = 1048575
+	maxID        = 0x00FFFFFF
 	maxLine      = 1048575
 	maxTokenSize = 1023
+	maxSrcSize   = 0xFFFFFFFF
 )
 
 var backslashes = [256]byte{
@@ -136,6 +139,56 @@ func Unescape(s string) (unescaped string, ok bool) {
 type Map struct {
 	byName map[string]ID
 	byID   []string
+
+	// forkedFrom and forkedLen are set for a Map returned by Fork: the parent
+	// Map and its len(byID) at the time of the fork.
+	forkedFrom *Map
+	forkedLen  int
+}
+
+// Fork returns a copy of m that can be extended independently of m, such as by
+// tokenizing a file in another goroutine. The fork's new entries are folded
+// back into m by Merge.
+//
+// Fork and Merge must not be called concurrently with other uses of m, but
+// forks of a common parent can be used concurrently with each other.
+func (m *Map) Fork() *Map {
+	f := &Map{
+		byName:     make(map[string]ID, len(m.byName)),
+		byID:       append([]string(nil), m.byID...),
+		forkedFrom: m,
+		forkedLen:  len(m.byID),
+	}
+	for k, v := range m.byName {
+		f.byName[k] = v
+	}
+	return f
+}
+
+// Merge inserts f's new entries into m, where f was returned by m.Fork, and
+// rewrites the IDs in tokens (which were produced using f) to be m's IDs.
+//
+// Merging forks in a fixed order assigns the same IDs regardless of how the
+// forks' work was scheduled, even if other forks were merged in the meantime.
+func (m *Map) Merge(f *Map, tokens []Token) error {
+	if f.forkedFrom != m {
+		return errors.New("token: merging a Map that was not forked from this Map")
+	}
+	remap := make([]ID, len(f.byID)-f.forkedLen)
+	for i, name := range f.byID[f.forkedLen:] {
+		id, err := m.insertNonBuiltIn(name)
+		if err != nil {
+			return err
+		}
+		remap[i] = id
+	}
+	lo := nBuiltInIDs + ID(f.forkedLen)
+	for i := range tokens {
+		if x := tokens[i].ID; x >= lo {
+			tokens[i].ID = remap[x-lo]
+		}
+	}
+	return nil
 }
 
 func (m *Map) Insert(name string) (ID, error) {
@@ -145,6 +198,10 @@ func (m *Map) Insert(name string) (ID, error) {
 	if id, ok := builtInsByName[name]; ok {
 		return id, nil
 	}
+	return m.insertNonBuiltIn(name)
+}
+
+func (m *Map) insertNonBuiltIn(name string) (ID, error) {
 	if m.byName == nil {
 		m.byName = map[string]ID{}
 	}
@@ -182,6 +239,21 @@ func (m *Map) ByID(x ID) string {
 	return ""
 }
 
+// Len returns the number of m's non-built-in entries.
+func (m *Map) Len() int {
+	return len(m.byID)
+}
+
+// Range calls f for each of m's non-built-in entries, in increasing ID order
+// (the order in which they were inserted). It stops early if f returns false.
+func (m *Map) Range(f func(x ID, name string) bool) {
+	for i, name := range m.byID {
+		if !f(nBuiltInIDs+ID(i), name) {
+			return
+		}
+	}
+}
+
 func unhex(c byte) int32 {
 	switch {
 	case 'A' <= c && c <= 'F':
@@ -234,6 +306,28 @@ func hasPrefix(a []byte, s string) bool {
 	return true
 }
 
+// scanFloatSuffix returns the end of a decimal number's optional fraction
+// (such as ".25") and exponent (such as "e-3"), given the end j of its integer
+// part. A '.' only starts a fraction if a digit follows it, so that "0 .. 8"
+// and "x[0 ..]" still tokenize as ranges.
+func scanFloatSuffix(src []byte, j int) int {
+	if (j+1 < len(src)) && (src[j] == '.') && numeric(src[j+1]) {
+		for j += 2; (j < len(src)) && numeric(src[j]); j++ {
+		}
+	}
+	if (j < len(src)) && ((src[j] == 'e') || (src[j] == 'E')) {
+		k := j + 1
+		if (k < len(src)) && ((src[k] == '+') || (src[k] == '-')) {
+			k++
+		}
+		if (k < len(src)) && numeric(src[k]) {
+			for j = k + 1; (j < len(src)) && numeric(src[j]); j++ {
+			}
+		}
+	}
+	return j
+}
+
 // checkNumericUnderscores rejects consecutive or trailing underscores.
 func checkNumericUnderscores(a []byte) bool {
 	prevUnderscore := false
@@ -247,21 +341,191 @@ func checkNumericUnderscores(a []byte) bool {
 	return !prevUnderscore
 }
 
+func isComment(s string) bool {
+	return (len(s) >= 2) && (s[0] == '/') && (s[1] == '/')
+}
+
+// isDocComment returns whether s starts with exactly three slashes.
+func isDocComment(s string) bool {
+	return (len(s) >= 3) && (s[0] == '/') && (s[1] == '/') && (s[2] == '/') &&
+		((len(s) == 3) || (s[3] != '/'))
+}
+
+// isLineDirective returns whether s starts with "//#line".
+func isLineDirective(s string) bool {
+	return (len(s) >= 7) && (s[:7] == "//#line")
+}
+
+// ParseLineDirective parses a `//#line N "file"` comment, where the "file"
+// part is optional. Such a directive says that the next line is line N of that
+// file (or, if omitted, of the file named by the previous directive, if any).
+// Code generators that emit .wuffs can use them so that error messages refer
+// to their own source.
+func ParseLineDirective(s string) (line uint32, filename string, ok bool) {
+	if !isLineDirective(s) || (len(s) < 9) || (s[7] != ' ') {
+		return 0, "", false
+	}
+	s = s[8:]
+	n := uint64(0)
+	for ; (len(s) > 0) && numeric(s[0]); s = s[1:] {
+		n = (10 * n) + uint64(s[0]-'0')
+		if n > maxLine {
+			return 0, "", false
+		}
+	}
+	if n == 0 {
+		return 0, "", false
+	} else if s == "" {
+		return uint32(n), "", true
+	} else if s[0] != ' ' {
+		return 0, "", false
+	}
+	filename, ok = Unescape(s[1:])
+	if !ok || (s[1] != '"') || (filename == "") {
+		return 0, "", false
+	}
+	return uint32(n), filename, true
+}
+
+// needsSemicolon returns whether an implicit semicolon goes after the last of
+// tokens, given that a line break or comment comes next.
+func needsSemicolon(m *Map, tokens []Token) bool {
+	return (len(tokens) > 0) && tokens[len(tokens)-1].ID.IsImplicitSemicolon(m)
+}
+
+// InsertSemicolons returns tokens, which were produced without implicit
+// semicolons (see Options.NoSemicolons), with those semicolons inserted. The
+// rules are the same as the tokenizer's: a semicolon follows a token that
+// could end a statement (see ID.IsImplicitSemicolon) when the next token is on
+// a later line or is a comment. The final token is only followed by one if a
+// line break follows it in src, the source that the tokens came from. m is the
+// Map that the tokens' IDs are relative to.
+//
+// The semicolons' positions are approximate: they immediately follow the
+// previous token or, if followed by a comment, are at that comment.
+//
+// If no semicolons are needed, the result is tokens itself.
+func InsertSemicolons(m *Map, tokens []Token, src []byte) []Token {
+	n := 0
+	for i := range tokens {
+		if insertSemicolonAfter(m, tokens, src, i) {
+			n++
+		}
+	}
+	if n == 0 {
+		return tokens
+	}
+
+	dst := make([]Token, 0, len(tokens)+n)
+	for i, tok := range tokens {
+		dst = append(dst, tok)
+		if !insertSemicolonAfter(m, tokens, src, i) {
+			continue
+		}
+		if (i+1 < len(tokens)) && tokens[i+1].ID.IsComment(m) {
+			next := tokens[i+1]
+			dst = append(dst, Token{IDSemicolon, next.Line, next.Col, next.Offset})
+		} else {
+			length := uint32(len(m.ByID(tok.ID)))
+			dst = append(dst, Token{IDSemicolon, tok.Line, tok.Col + length, tok.Offset + length})
+		}
+	}
+	return dst
+}
+
+func insertSemicolonAfter(m *Map, tokens []Token, src []byte, i int) bool {
+	if !needsSemicolon(m, tokens[:i+1]) {
+		return false
+	} else if i+1 == len(tokens) {
+		end := uint64(tokens[i].Offset) + uint64(len(m.ByID(tokens[i].ID)))
+		return (end < uint64(len(src))) && (bytes.IndexByte(src[end:], '\n') >= 0)
+	}
+	next := tokens[i+1]
+	return (next.Line > tokens[i].Line) || next.ID.IsComment(m)
+}
+
+// Options are optional arguments to TokenizeOptions. The zero value is the
+// default behavior, as used by Tokenize.
+type Options struct {
+	// CommentTokens is whether "//" comments are also returned as tokens,
+	// interleaved with the other tokens. Each comment's text (including the
+	// leading "//") is interned in the Map and ID.IsComment reports true for
+	// its ID. Such token streams are for tools like formatters that need to
+	// round-trip the source; they should not be passed to the parser.
+	//
+	// Regardless of this option, "///" doc comments are always returned as
+	// tokens, which the parser attaches to the following declaration, as are
+	// `//#line` directives (see ParseLineDirective), which the parser uses to
+	// adjust the positions that it reports.
+	CommentTokens bool
+
+	// UnicodeIdents is whether identifiers can contain non-ASCII letters, as
+	// per UAX #31. Such identifiers are interned in NFC form. See unicode.go
+	// for details.
+	UnicodeIdents bool
+
+	// Dialect is the initial Dialect, before any `use "wuffs vX.Y"` pragma.
+	// Nil means DefaultDialect.
+	Dialect *Dialect
+
+	// Trace, if non-nil, receives a line of text for each token as it is
+	// produced, giving its position, ID, kind and text. On a tokenization
+	// error, the tokens produced before the error are still written. This is
+	// a debugging aid, so write errors are ignored.
+	Trace io.Writer
+
+	// NoSemicolons is whether to omit the implicit semicolons that end each
+	// line (see InsertSemicolons).
+	NoSemicolons bool
+}
+
+// Tokenize is equivalent to TokenizeOptions with nil Options.
 func Tokenize(m *Map, filename string, src []byte) (tokens []Token, comments []string, retErr error) {
-	line := uint32(1)
+	return TokenizeOptions(m, filename, src, nil)
+}
+
+// TokenizeOptions breaks src into tokens. It also returns any "//" comments,
+// indexed by line number.
+func TokenizeOptions(m *Map, filename string, src []byte, opts *Options) (tokens []Token, comments []string, retErr error) {
+	if uint64(len(src)) > maxSrcSize {
+		return nil, nil, fmt.Errorf("token: source too long in %q", filename)
+	}
+	commentTokens, unicodeIdents, dialect, trace := false, false, DefaultDialect, io.Writer(nil)
+	semicolons := true
+	if opts != nil {
+		commentTokens = opts.CommentTokens
+		unicodeIdents = opts.UnicodeIdents
+		if opts.Dialect != nil {
+			dialect = opts.Dialect
+		}
+		trace = opts.Trace
+		semicolons = !opts.NoSemicolons
+	}
+	line, lineStart, nTraced := uint32(1), 0, 0
+
+	// dFilename and dLine adjust the positions reported in error messages,
+	// per any `//#line N "file"` directive. The tokens' Line fields are not
+	// adjusted: they remain physical line numbers.
+	dFilename, dLine := filename, uint32(0)
+
 loop:
 	for i := 0; i < len(src); {
+		if trace != nil {
+			nTraced = traceTokens(trace, m, filename, tokens, nTraced)
+		}
 		c := src[i]
+		col, offset := uint32(i-lineStart)+1, uint32(i)
 
 		if c <= ' ' {
 			if c == '\n' {
-				if len(tokens) > 0 && tokens[len(tokens)-1].ID.IsImplicitSemicolon(m) {
-					tokens = append(tokens, Token{IDSemicolon, line})
+				if semicolons && needsSemicolon(m, tokens) {
+					tokens = append(tokens, Token{IDSemicolon, line, col, offset})
 				}
 				if line == maxLine {
 					return nil, nil, fmt.Errorf("token: too many lines in %q", filename)
 				}
 				line++
+				lineStart = i + 1
 			}
 			i++
 			continue
@@ -277,12 +541,12 @@ loop:
 					break
 				} else if c == '\\' {
 					if quote == '"' {
-						return nil, nil, fmt.Errorf("token: backslash in \"-string at %s:%d", filename, line)
+						return nil, nil, errorAt(dFilename, line+dLine, col, "backslash in \"-string")
 					}
 				} else if c == '\n' {
-					return nil, nil, fmt.Errorf("token: expected final %c in string at %s:%d", quote, filename, line)
+					return nil, nil, errorAt(dFilename, line+dLine, col, "expected final %c in string", quote)
 				} else if c < ' ' {
-					return nil, nil, fmt.Errorf("token: control character in string at %s:%d", filename, line)
+					return nil, nil, errorAt(dFilename, line+dLine, col, "control character in string")
 				}
 			}
 
@@ -294,14 +558,14 @@ loop:
 			}
 
 			if j-i > maxTokenSize {
-				return nil, nil, fmt.Errorf("token: string too long at %s:%d", filename, line)
+				return nil, nil, errorAt(dFilename, line+dLine, col, "string too long")
 			}
 			s := string(src[i:j])
 			if quote == '\'' {
 				if unescaped, ok := Unescape(s); !ok {
-					return nil, nil, fmt.Errorf("token: invalid '-string at %s:%d", filename, line)
+					return nil, nil, errorAt(dFilename, line+dLine, col, "invalid '-string")
 				} else if (len(unescaped) > 1) && !hasEndian {
-					return nil, nil, fmt.Errorf("token: multi-byte '-string needs be or le suffix at %s:%d", filename, line)
+					return nil, nil, errorAt(dFilename, line+dLine, col, "multi-byte '-string needs be or le suffix")
 				}
 			}
 
@@ -309,52 +573,87 @@ loop:
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			if (len(tokens) > 0) && (tokens[len(tokens)-1].ID == IDUse) && id.IsDialectPragma(m) {
+				if dialect = LookupDialect(s[1 : len(s)-1]); dialect == nil {
+					return nil, nil, errorAt(dFilename, line+dLine, col, "unknown dialect %s", s)
+				}
+			}
+			tokens = append(tokens, Token{id, line, col, offset})
 			i = j
 			continue
 		}
 
-		if alpha(c) {
+		if c == '`' {
+			// A raw string literal has no escape sequences. Every byte other
+			// than '`' and '\n' is taken verbatim.
 			j := i + 1
-			for ; j < len(src) && alphaNumeric(src[j]); j++ {
-				if j-i == maxTokenSize {
-					return nil, nil, fmt.Errorf("token: identifier too long at %s:%d", filename, line)
+			for ; ; j++ {
+				if (j == len(src)) || (src[j] == '\n') {
+					return nil, nil, errorAt(dFilename, line+dLine, col, "expected final ` in raw string")
+				} else if src[j] == '`' {
+					j++
+					break
 				}
 			}
+			if j-i > maxTokenSize {
+				return nil, nil, errorAt(dFilename, line+dLine, col, "raw string too long")
+			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, col, offset})
+			i = j
+			continue
+		}
+
+		if alpha(c) || (unicodeIdents && (c >= utf8.RuneSelf)) {
+			j, name, errMsg := scanIdent(src, i, unicodeIdents)
+			if errMsg != "" {
+				return nil, nil, errorAt(dFilename, line+dLine, col, "%s", errMsg)
+			} else if j-i > maxTokenSize {
+				return nil, nil, errorAt(dFilename, line+dLine, col, "identifier too long")
+			}
+			id, err := m.insertIdent(name, dialect)
+			if err != nil {
+				return nil, nil, err
+			}
+			tokens = append(tokens, Token{id, line, col, offset})
 			i = j
 			continue
 		}
 
 		if numeric(c) {
 			// TODO: 0b11 binary numbers.
-			j, isDigit := i+1, numericUnderscore
+			j, isDigit, decimal := i+1, numericUnderscore, true
 			if c == '0' && j < len(src) {
 				if next := src[j]; next == 'x' || next == 'X' {
-					j, isDigit = j+1, hexaNumericUnderscore
+					j, isDigit, decimal = j+1, hexaNumericUnderscore, false
 				} else if next == 'b' || next == 'B' {
-					j, isDigit = j+1, zeroOneUnderscore
+					j, isDigit, decimal = j+1, zeroOneUnderscore, false
 				} else if numeric(next) {
-					return nil, nil, fmt.Errorf("token: legacy octal syntax at %s:%d", filename, line)
+					return nil, nil, errorAt(dFilename, line+dLine, col, "legacy octal syntax")
 				}
 			}
 			for ; j < len(src) && isDigit(src[j]); j++ {
 				if j-i == maxTokenSize {
-					return nil, nil, fmt.Errorf("token: constant too long at %s:%d", filename, line)
+					return nil, nil, errorAt(dFilename, line+dLine, col, "constant too long")
 				}
 			}
 			if !checkNumericUnderscores(src[i:j]) {
-				return nil, nil, fmt.Errorf("token: invalid numeric literal at %s:%d", filename, line)
+				return nil, nil, errorAt(dFilename, line+dLine, col, "invalid numeric literal")
+			}
+			if decimal {
+				j = scanFloatSuffix(src, j)
+				if j-i > maxTokenSize {
+					return nil, nil, errorAt(dFilename, line+dLine, col, "constant too long")
+				}
 			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, col, offset})
 			i = j
 			continue
 		}
@@ -368,18 +667,41 @@ loop:
 				comments = append(comments, "")
 			}
 			comments = append(comments, string(src[h:i]))
+			isLineDirective := isLineDirective(comments[len(comments)-1])
+			if isLineDirective {
+				dirLine, dirFilename, ok := ParseLineDirective(comments[len(comments)-1])
+				if !ok {
+					return nil, nil, errorAt(dFilename, line+dLine, col, "invalid line directive")
+				}
+				dLine = dirLine - (line + 1)
+				if dirFilename != "" {
+					dFilename = dirFilename
+				}
+			}
+			if commentTokens || isLineDirective || isDocComment(comments[len(comments)-1]) {
+				// Any implicit semicolon goes before, not after, a trailing
+				// comment.
+				if semicolons && needsSemicolon(m, tokens) {
+					tokens = append(tokens, Token{IDSemicolon, line, col, offset})
+				}
+				id, err := m.Insert(string(src[h:i]))
+				if err != nil {
+					return nil, nil, err
+				}
+				tokens = append(tokens, Token{id, line, col, offset})
+			}
 			continue
 		}
 
 		if id := squiggles[c]; id != 0 {
 			i++
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, col, offset})
 			continue
 		}
 		for _, x := range lexers[c] {
 			if hasPrefix(src[i+1:], x.suffix) {
 				i += len(x.suffix) + 1
-				tokens = append(tokens, Token{x.id, line})
+				tokens = append(tokens, Token{x.id, line, col, offset})
 				continue loop
 			}
 		}
@@ -390,7 +712,10 @@ loop:
 		} else {
 			msg = fmt.Sprintf("non-ASCII byte '\\x%02X'", c)
 		}
-		return nil, nil, fmt.Errorf("token: unrecognized %s at %s:%d", msg, filename, line)
+		return nil, nil, errorAt(dFilename, line+dLine, col, "unrecognized %s", msg)
+	}
+	if trace != nil {
+		traceTokens(trace, m, filename, tokens, nTraced)
 	}
 	return tokens, comments, nil
 }
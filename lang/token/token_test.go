@@ -0,0 +1,473 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenizePositions(tt *testing.T) {
+	const src = "" +
+		"x = y  // Hello.\n" +
+		"\tz += 0x12\n"
+
+	m := &Map{}
+	tokens, comments, err := TokenizeOptions(m, "test.wuffs", []byte(src), &Options{
+		CommentTokens: true,
+	})
+	if err != nil {
+		tt.Fatalf("TokenizeOptions: %v", err)
+	}
+	if len(comments) != 2 || comments[1] != "// Hello." {
+		tt.Fatalf("comments: got %q", comments)
+	}
+
+	type pos struct {
+		s      string
+		line   uint32
+		col    uint32
+		offset uint32
+	}
+	want := []pos{
+		{"x", 1, 1, 0},
+		{"=", 1, 3, 2},
+		{"y", 1, 5, 4},
+		{";", 1, 8, 7},
+		{"// Hello.", 1, 8, 7},
+		{"z", 2, 2, 18},
+		{"+=", 2, 4, 20},
+		{"0x12", 2, 7, 23},
+		{";", 2, 11, 27},
+	}
+	got := []pos(nil)
+	for _, tok := range tokens {
+		got = append(got, pos{m.ByID(tok.ID), tok.Line, tok.Col, tok.Offset})
+	}
+	if len(got) != len(want) {
+		tt.Fatalf("tokens:\ngot  %v\nwant %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			tt.Errorf("token #%d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if id := tokens[4].ID; !id.IsComment(m) || id.IsLiteral(m) || id.IsImplicitSemicolon(m) {
+		tt.Errorf("comment token %q: wrong classification", m.ByID(id))
+	}
+}
+
+func TestTokenizeErrorColumn(tt *testing.T) {
+	_, _, err := Tokenize(&Map{}, "test.wuffs", []byte("x = y\n  $\n"))
+	if err == nil {
+		tt.Fatalf("got nil error, want non-nil")
+	}
+	if got, want := err.Error(), `token: unrecognized byte '\x24' ('$') at test.wuffs:2:3`; got != want {
+		tt.Fatalf("got %q, want %q", got, want)
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		tt.Fatalf("got %T, want *Error", err)
+	}
+	if got, want := *e, (Error{"token", "test.wuffs", 2, 3, `unrecognized byte '\x24' ('$')`}); got != want {
+		tt.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestForkMerge(tt *testing.T) {
+	m := &Map{}
+	if _, err := m.Insert("shared"); err != nil {
+		tt.Fatalf("Insert: %v", err)
+	}
+
+	srcs := []string{"shared + alpha + beta", "gamma + alpha + shared"}
+	forks := make([]*Map, len(srcs))
+	tokens := make([][]Token, len(srcs))
+	for i := len(srcs) - 1; i >= 0; i-- {
+		forks[i] = m.Fork()
+		toks, _, err := Tokenize(forks[i], "test.wuffs", []byte(srcs[i]))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		tokens[i] = toks
+	}
+	for i := range srcs {
+		if err := m.Merge(forks[i], tokens[i]); err != nil {
+			tt.Fatalf("Merge: %v", err)
+		}
+	}
+
+	for i, src := range srcs {
+		got := ""
+		for j, tok := range tokens[i] {
+			if j > 0 {
+				got += " "
+			}
+			got += m.ByID(tok.ID)
+		}
+		if got != src {
+			tt.Errorf("src #%d: got %q, want %q", i, got, src)
+		}
+	}
+	if got, want := m.ByName("gamma"), m.ByName("beta")+1; got != want {
+		tt.Errorf("gamma: got ID 0x%X, want 0x%X", got, want)
+	}
+
+	if err := (&Map{}).Merge(forks[0], nil); err == nil {
+		tt.Errorf("Merge of an unrelated fork: got nil error, want non-nil")
+	}
+}
+
+func TestDialectPragma(tt *testing.T) {
+	const src = "" +
+		"choose x\n" +
+		"use \"wuffs v0.2\"\n" +
+		"choose x\n"
+
+	m := &Map{}
+	tokens, _, err := Tokenize(m, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	kinds := []bool(nil)
+	for _, tok := range tokens {
+		if m.ByID(tok.ID) == "choose" {
+			kinds = append(kinds, tok.ID.IsKeyword(), tok.ID.IsIdent(m))
+		}
+	}
+	if got, want := fmt.Sprint(kinds), "[true false false true]"; got != want {
+		tt.Errorf("(IsKeyword, IsIdent) pairs: got %s, want %s", got, want)
+	}
+
+	if _, _, err := Tokenize(m, "test.wuffs", []byte("use \"wuffs v9.9\"\n")); err == nil {
+		tt.Errorf("unknown dialect: got nil error, want non-nil")
+	}
+}
+
+func TestMarshal(tt *testing.T) {
+	const src = "" +
+		"pub func foo() {\n" +
+		"\tx = `raw` + 0x12  // Comment.\n" +
+		"}\n"
+
+	m0 := &Map{}
+	tokens0, _, err := TokenizeOptions(m0, "test.wuffs", []byte(src), &Options{
+		CommentTokens: true,
+	})
+	if err != nil {
+		tt.Fatalf("TokenizeOptions: %v", err)
+	}
+
+	data := Marshal(tokens0, m0)
+	tokens1, m1, err := Unmarshal(data)
+	if err != nil {
+		tt.Fatalf("Unmarshal: %v", err)
+	}
+	if len(tokens1) != len(tokens0) {
+		tt.Fatalf("len(tokens): got %d, want %d", len(tokens1), len(tokens0))
+	}
+	for i := range tokens0 {
+		if tokens1[i] != tokens0[i] {
+			tt.Errorf("token #%d: got %v, want %v", i, tokens1[i], tokens0[i])
+		} else if s1, s0 := m1.ByID(tokens1[i].ID), m0.ByID(tokens0[i].ID); s1 != s0 {
+			tt.Errorf("token #%d: got %q, want %q", i, s1, s0)
+		}
+	}
+
+	for n := 0; n < len(data); n++ {
+		if _, _, err := Unmarshal(data[:n]); err == nil {
+			tt.Errorf("Unmarshal(data[:%d]): got nil error, want non-nil", n)
+		}
+	}
+}
+
+func TestUnmarshalCorrupt(tt *testing.T) {
+	// encode returns a Marshal-format stream with the given names and a single
+	// token with the given ID.
+	encode := func(names []string, id uint64) []byte {
+		buf := []byte(marshalMagic)
+		buf = appendUvarint(buf, uint64(len(names)))
+		for _, name := range names {
+			buf = appendUvarint(buf, uint64(len(name)))
+			buf = append(buf, name...)
+		}
+		buf = appendUvarint(buf, 1)
+		buf = appendUvarint(buf, id)
+		buf = appendUvarint(buf, 1) // Line delta.
+		buf = appendUvarint(buf, 1) // Column.
+		buf = appendUvarint(buf, 0) // Offset delta.
+		return buf
+	}
+
+	testCases := []struct {
+		names   []string
+		id      uint64
+		wantErr bool
+	}{
+		{[]string{"foo"}, uint64(IDFunc), false},
+		{[]string{"foo"}, uint64(nBuiltInIDs), false},
+		{[]string{"foo"}, uint64(nBuiltInIDs) + 1, true},
+		{[]string{"foo", "bar"}, uint64(nBuiltInIDs) + 1, false},
+		{[]string{"foo", "foo"}, uint64(nBuiltInIDs) + 1, true},
+		{nil, uint64(nBuiltInIDs), true},
+		{nil, uint64(maxID), true},
+	}
+
+	for _, tc := range testCases {
+		tokens, m, err := Unmarshal(encode(tc.names, tc.id))
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			tt.Errorf("names=%q, id=0x%X: got error %v, want error: %t", tc.names, tc.id, err, tc.wantErr)
+		} else if err == nil {
+			// This would panic for an ID that does not map to any name.
+			_ = tokens[0].ID.Str(m)
+		}
+	}
+}
+
+func TestMapRange(tt *testing.T) {
+	m := &Map{}
+	for _, s := range []string{"zebra", "if", "apple", "zebra", "0x10"} {
+		if _, err := m.Insert(s); err != nil {
+			tt.Fatalf("Insert(%q): %v", s, err)
+		}
+	}
+	if got, want := m.Len(), 3; got != want {
+		tt.Fatalf("Len: got %d, want %d", got, want)
+	}
+
+	got := []string(nil)
+	m.Range(func(x ID, name string) bool {
+		if m.ByID(x) != name {
+			tt.Errorf("ByID(0x%X): got %q, want %q", x, m.ByID(x), name)
+		}
+		got = append(got, name)
+		return len(got) < 2
+	})
+	if want := []string{"zebra", "apple"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		tt.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestUnicodeIdents(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		want    string
+		wantErr string
+	}{
+		{"größe", "größe", ""},
+		{"δ_2", "δ_2", ""},
+		{"\u212Aelvin", "Kelvin", ""},
+		{"Ångström", "Ångström", ""},
+		{"変数名", "変数名", ""},
+		{"ká", "", "combining mark U+0301"},
+		{"pаypal", "", "mixes the"},
+		{"x_δ", "", "mixes the Latin and Greek scripts"},
+		{"²x", "", "invalid identifier start U+00B2"},
+	}
+
+	for _, tc := range testCases {
+		m := &Map{}
+		tokens, _, err := TokenizeOptions(m, "test.wuffs", []byte(tc.src), &Options{
+			UnicodeIdents: true,
+		})
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got error %v, want %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: %v", tc.src, err)
+			continue
+		}
+		if len(tokens) != 1 {
+			tt.Errorf("%q: got %d tokens, want 1", tc.src, len(tokens))
+		} else if id := tokens[0].ID; (m.ByID(id) != tc.want) || !id.IsIdent(m) || id.IsLiteral(m) {
+			tt.Errorf("%q: got %q (IsIdent=%t), want %q", tc.src, m.ByID(id), id.IsIdent(m), tc.want)
+		}
+	}
+
+	if _, _, err := Tokenize(&Map{}, "test.wuffs", []byte("größe")); err == nil {
+		tt.Errorf("without UnicodeIdents: got nil error, want non-nil")
+	}
+}
+
+func TestFloatLiterals(tt *testing.T) {
+	const src = "1.5 2.25e-3 6E+2 0x1E5 0 .. 8 x[1 ..]"
+
+	m := &Map{}
+	tokens, _, err := Tokenize(m, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	got := []string(nil)
+	for _, tok := range tokens {
+		s := m.ByID(tok.ID)
+		if tok.ID.IsFloatLiteral(m) {
+			if !tok.ID.IsNumLiteral(m) {
+				tt.Errorf("%q: IsFloatLiteral but not IsNumLiteral", s)
+			}
+			s = "F:" + s
+		}
+		got = append(got, s)
+	}
+	want := "[F:1.5 F:2.25e-3 F:6E+2 0x1E5 0 .. 8 x [ 1 .. ]]"
+	if fmt.Sprint(got) != want {
+		tt.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTrace(tt *testing.T) {
+	buf := &strings.Builder{}
+	_, _, err := TokenizeOptions(&Map{}, "test.wuffs", []byte("x += 0x12\n$"), &Options{
+		Trace: buf,
+	})
+	if err == nil {
+		tt.Fatalf("got nil error, want non-nil")
+	}
+	const want = "" +
+		"test.wuffs:1:1\t0x0400\tident\t\"x\"\n" +
+		"test.wuffs:1:3\t0x0020\tassign\t\"+=\"\n" +
+		"test.wuffs:1:6\t0x0401\tnum\t\"0x12\"\n" +
+		"test.wuffs:1:10\t0x0001\tsemicolon\t\";\"\n"
+	if got := buf.String(); got != want {
+		tt.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestManyIDs(tt *testing.T) {
+	// Machine-generated programs can intern far more than 65536 literals.
+	const n = 100000
+	m := &Map{}
+	for i := 0; i < n; i++ {
+		id, err := m.Insert(fmt.Sprintf("0x%X", i+0x100))
+		if err != nil {
+			tt.Fatalf("Insert #%d: %v", i, err)
+		}
+		if want := nBuiltInIDs + ID(i); id != want {
+			tt.Fatalf("Insert #%d: got ID 0x%X, want 0x%X", i, id, want)
+		}
+	}
+	if got := m.ByID(nBuiltInIDs + n - 1); got != fmt.Sprintf("0x%X", n-1+0x100) {
+		tt.Errorf("ByID: got %q", got)
+	}
+}
+
+func TestLineDirective(tt *testing.T) {
+	testCases := []struct {
+		s        string
+		line     uint32
+		filename string
+		ok       bool
+	}{
+		{`//#line 42 "orig.wuffs"`, 42, "orig.wuffs", true},
+		{`//#line 7`, 7, "", true},
+		{`//#line 0 "orig.wuffs"`, 0, "", false},
+		{`//#line 42 orig.wuffs`, 0, "", false},
+		{`//#line 42 ""`, 0, "", false},
+		{`//#line x`, 0, "", false},
+		{`//#line`, 0, "", false},
+	}
+	for _, tc := range testCases {
+		line, filename, ok := ParseLineDirective(tc.s)
+		if (line != tc.line) || (filename != tc.filename) || (ok != tc.ok) {
+			tt.Errorf("%q: got (%d, %q, %t), want (%d, %q, %t)",
+				tc.s, line, filename, ok, tc.line, tc.filename, tc.ok)
+		}
+	}
+
+	const src = "" +
+		"x = y\n" +
+		"//#line 42 \"orig.wuffs\"\n" +
+		"z = w\n" +
+		"  $\n"
+	m := &Map{}
+	_, _, err := Tokenize(m, "gen.wuffs", []byte(src))
+	if err == nil {
+		tt.Fatalf("got nil error, want non-nil")
+	}
+	if got, want := err.Error(), `token: unrecognized byte '\x24' ('$') at orig.wuffs:43:3`; got != want {
+		tt.Fatalf("got %q, want %q", got, want)
+	}
+
+	tokens, _, err := Tokenize(m, "gen.wuffs", []byte(src[:len(src)-4]))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	if n := len(tokens); (n != 9) || !tokens[4].ID.IsLineDirective(m) || (tokens[5].Line != 3) {
+		tt.Fatalf("got %d tokens, want 9 including a line directive, with physical lines", n)
+	}
+}
+
+func TestInsertSemicolons(tt *testing.T) {
+	srcs := []string{
+		"" +
+			"pri func foo() {\n" +
+			"\tx = y  // Hello.\n" +
+			"\n" +
+			"\tif z {\n" +
+			"\t\treturn 0x12\n" +
+			"\t}\n" +
+			"}\n",
+		// Without a trailing line break, the tokenizer doesn't end the final
+		// line with a semicolon.
+		"x = y",
+		"x = y\n",
+		"x = y  // Hello.",
+		"x = y  // Hello.\n",
+	}
+
+	for _, src := range srcs {
+		testInsertSemicolons(tt, src)
+	}
+}
+
+func testInsertSemicolons(tt *testing.T, src string) {
+	for _, commentTokens := range []bool{false, true} {
+		m := &Map{}
+		want, _, err := TokenizeOptions(m, "test.wuffs", []byte(src), &Options{
+			CommentTokens: commentTokens,
+		})
+		if err != nil {
+			tt.Fatalf("src=%q: TokenizeOptions: %v", src, err)
+		}
+		tokens, _, err := TokenizeOptions(m, "test.wuffs", []byte(src), &Options{
+			CommentTokens: commentTokens,
+			NoSemicolons:  true,
+		})
+		if err != nil {
+			tt.Fatalf("src=%q: TokenizeOptions: %v", src, err)
+		}
+		for _, tok := range tokens {
+			if tok.ID == IDSemicolon {
+				tt.Fatalf("src=%q, commentTokens=%t: NoSemicolons produced a semicolon", src, commentTokens)
+			}
+		}
+
+		got := InsertSemicolons(m, tokens, []byte(src))
+		if len(got) != len(want) {
+			tt.Fatalf("src=%q, commentTokens=%t: got %d tokens, want %d", src, commentTokens, len(got), len(want))
+		}
+		for i := range want {
+			// Without comment tokens, a semicolon's column can differ: the
+			// tokenizer puts it at the end of the line, after any comment.
+			g, w := got[i], want[i]
+			if !commentTokens {
+				g.Col, g.Offset, w.Col, w.Offset = 0, 0, 0, 0
+			}
+			if g != w {
+				tt.Errorf("src=%q, commentTokens=%t: token #%d: got %v, want %v", src, commentTokens, i, got[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token
+
+import (
+	"fmt"
+	"io"
+)
+
+// traceTokens writes tokens[nTraced:] to w, one per line, and returns the new
+// number of traced tokens, len(tokens). Each line looks like:
+//
+//	foo.wuffs:12:5	0x0405	ident	"bar"
+func traceTokens(w io.Writer, m *Map, filename string, tokens []Token, nTraced int) int {
+	for _, tok := range tokens[nTraced:] {
+		fmt.Fprintf(w, "%s:%d:%d\t0x%04X\t%s\t%q\n",
+			filename, tok.Line, tok.Col, uint32(tok.ID), tokenKind(m, tok.ID), m.ByID(tok.ID))
+	}
+	return len(tokens)
+}
+
+// tokenKind returns a short description of the class of token that x is.
+func tokenKind(m *Map, x ID) string {
+	switch {
+	case x == IDSemicolon:
+		return "semicolon"
+	case x.IsKeyword():
+		return "keyword"
+	case x.IsComment(m):
+		return "comment"
+	case x.IsFloatLiteral(m):
+		return "float"
+	case x.IsNumLiteral(m):
+		return "num"
+	case x.IsDQStrLiteral(m), x.IsSQStrLiteral(m), x.IsRawStrLiteral(m):
+		return "str"
+	case x.IsLiteral(m):
+		return "literal"
+	case x.IsIdent(m):
+		return "ident"
+	case x.IsOpen(), x.IsClose():
+		return "bracket"
+	case x.IsAssign():
+		return "assign"
+	case x.IsUnaryOp(), x.IsBinaryOp(), x.IsAssociativeOp():
+		return "op"
+	}
+	return "punct"
+}
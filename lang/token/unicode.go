@@ -0,0 +1,159 @@
+// Copyright 2026 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+//
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+package token
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file implements non-ASCII identifiers, enabled by
+// Options.UnicodeIdents. They follow the UAX #31 Default Identifier Syntax,
+// with Go's unicode package approximating the XID_Start and XID_Continue
+// properties, and a UAX #39 style single-script restriction to catch
+// confusables such as a Cyrillic "а" within an otherwise Latin name.
+//
+// Identifiers are interned in NFC (Normalization Form C). Full normalization
+// needs tables that the standard library doesn't provide, so instead of
+// composing arbitrary sequences, identifiers with combining marks are
+// rejected: they must be written with precomposed characters. The remaining
+// characters whose NFC form differs (singletons such as U+212B ANGSTROM SIGN)
+// are mapped by nfcSingletons or, for the CJK compatibility ideographs,
+// rejected.
+
+// isXIDStart approximates the UAX #31 XID_Start property for non-ASCII runes.
+func isXIDStart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Nl, r)
+}
+
+// isXIDContinue approximates the UAX #31 XID_Continue property for non-ASCII
+// runes.
+func isXIDContinue(r rune) bool {
+	return isXIDStart(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc)
+}
+
+// nfcSingletons maps runes that NFC replaces with a single other rune.
+var nfcSingletons = map[rune]rune{
+	'\u2126': '\u03A9', // OHM SIGN => GREEK CAPITAL LETTER OMEGA.
+	'\u212A': '\u004B', // KELVIN SIGN => LATIN CAPITAL LETTER K.
+	'\u212B': '\u00C5', // ANGSTROM SIGN => LATIN CAPITAL LETTER A WITH RING ABOVE.
+}
+
+// scriptsThatMix lists the combinations of scripts that can be used together
+// in an identifier, per the UAX #39 "Highly Restrictive" level. Any other
+// identifier must use a single script (ignoring the Common and Inherited
+// pseudo-scripts, which include the ASCII digits and underscore).
+var scriptsThatMix = [...][]*unicode.RangeTable{
+	{unicode.Latin, unicode.Han, unicode.Hiragana, unicode.Katakana}, // Japanese.
+	{unicode.Latin, unicode.Han, unicode.Bopomofo},                   // Chinese.
+	{unicode.Latin, unicode.Han, unicode.Hangul},                     // Korean.
+}
+
+var scriptNames = map[*unicode.RangeTable]string{}
+
+func init() {
+	for name, table := range unicode.Scripts {
+		scriptNames[table] = name
+	}
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, table := range unicode.Scripts {
+		if (table != unicode.Common) && (table != unicode.Inherited) && unicode.Is(table, r) {
+			return table
+		}
+	}
+	return nil
+}
+
+// scanIdent returns the end of the identifier that starts at src[i], or an
+// error message. It also returns the identifier in NFC form.
+func scanIdent(src []byte, i int, unicodeIdents bool) (j int, nfc string, errMsg string) {
+	j, buf, hasNonASCII := i, []byte(nil), false
+	for j < len(src) {
+		if c := src[j]; c < utf8.RuneSelf {
+			if !alphaNumeric(c) {
+				break
+			}
+			buf = append(buf, c)
+			j++
+			continue
+		} else if !unicodeIdents {
+			break
+		}
+
+		r, size := utf8.DecodeRune(src[j:])
+		if r == utf8.RuneError {
+			return 0, "", "invalid UTF-8"
+		} else if j == i {
+			if !isXIDStart(r) {
+				return 0, "", fmt.Sprintf("invalid identifier start %U", r)
+			}
+		} else if !isXIDContinue(r) {
+			break
+		}
+		hasNonASCII = true
+
+		if unicode.In(r, unicode.Mn, unicode.Mc) {
+			return 0, "", fmt.Sprintf("combining mark %U in identifier (use a precomposed character)", r)
+		} else if (0xF900 <= r) && (r <= 0xFAFF) {
+			return 0, "", fmt.Sprintf("CJK compatibility ideograph %U in identifier", r)
+		} else if s, ok := nfcSingletons[r]; ok {
+			r = s
+		}
+		buf = append(buf, string(r)...)
+		j += size
+	}
+
+	if hasNonASCII {
+		if msg := checkScripts(string(buf)); msg != "" {
+			return 0, "", msg
+		}
+	}
+	return j, string(buf), ""
+}
+
+// checkScripts returns an error message if s mixes scripts in a way that
+// UAX #39's "Highly Restrictive" level disallows.
+func checkScripts(s string) string {
+	scripts := []*unicode.RangeTable(nil)
+	for _, r := range s {
+		if sc := scriptOf(r); sc != nil {
+			found := false
+			for _, x := range scripts {
+				found = found || (x == sc)
+			}
+			if !found {
+				scripts = append(scripts, sc)
+			}
+		}
+	}
+	if len(scripts) <= 1 {
+		return ""
+	}
+
+outer:
+	for _, allowed := range scriptsThatMix {
+		for _, sc := range scripts {
+			found := false
+			for _, x := range allowed {
+				found = found || (x == sc)
+			}
+			if !found {
+				continue outer
+			}
+		}
+		return ""
+	}
+	return fmt.Sprintf("identifier %q mixes the %s and %s scripts",
+		s, scriptNames[scripts[0]], scriptNames[scripts[1]])
+}
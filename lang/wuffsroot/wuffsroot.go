@@ -37,6 +37,9 @@ func setValue(value string) (string, error) {
 	return value, nil
 }
 
+// Value returns the Wuffs root directory: $WUFFSROOT if set, otherwise the
+// nearest working directory ancestor, or Go source directory, that contains
+// a wuffs-root-directory.txt file.
 func Value() (string, error) {
 	cache.mu.Lock()
 	value := cache.value
@@ -48,6 +51,14 @@ func Value() (string, error) {
 
 	const wrdTxt = "wuffs-root-directory.txt"
 
+	// An explicit $WUFFSROOT takes priority.
+	if p := os.Getenv("WUFFSROOT"); p != "" {
+		if _, err := os.Stat(filepath.Join(p, wrdTxt)); err != nil {
+			return "", errors.New("$WUFFSROOT does not contain " + wrdTxt)
+		}
+		return setValue(p)
+	}
+
 	// Look for "w-r-d.txt" in the working directory or its ancestors.
 	for p, q := initialWorkingDirectory, ""; p != q; p, q = filepath.Dir(p), p {
 		if _, err := os.Stat(filepath.Join(p, wrdTxt)); err == nil {